@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// runBencode converts a bencoded file, such as a torrent or a saved tracker response, to JSON or
+// YAML for tools like jq, or JSON back to bencode. The input is read from stdin if the path is
+// "-" or missing.
+func runBencode(fs *flag.FlagSet, args []string) error {
+	binary := fs.String("binary", "hex", "encoding of byte strings that are not valid UTF-8: hex or base64")
+	format := fs.String("format", "json", "output format: json or yaml")
+	compact := fs.Bool("compact", false, "write JSON on a single line")
+	reverse := fs.Bool("reverse", false, "convert JSON to bencode instead")
+	fs.Parse(args)
+	if fs.NArg() > 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var opts bencode.JSONOptions
+	switch *binary {
+	case "hex":
+		opts.Binary = bencode.BinaryHex
+	case "base64":
+		opts.Binary = bencode.BinaryBase64
+	default:
+		return fmt.Errorf("invalid binary encoding %q: must be hex or base64", *binary)
+	}
+	if *format != "json" && *format != "yaml" {
+		return fmt.Errorf("invalid format %q: must be json or yaml", *format)
+	}
+	if !*compact {
+		opts.Indent = "  "
+	}
+
+	in := os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+
+	if *reverse {
+		v, err := bencode.FromJSON(data)
+		if err != nil {
+			return err
+		}
+		return bencode.NewEncoder(os.Stdout).Encode(v)
+	}
+
+	v, err := bencode.DecodeBytes(data, bencode.DecodeOptions{ZeroCopy: true}) // data is never modified
+	if err != nil {
+		return err
+	}
+	var out []byte
+	if *format == "yaml" {
+		out, err = bencode.ToYAML(v, opts.Binary)
+	} else {
+		out, err = bencode.ToJSONWithOptions(v, opts)
+		out = append(out, '\n')
+	}
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(out)
+	return err
+}
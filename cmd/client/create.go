@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/peerid"
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// listFlag is a flag that may be repeated, collecting every value.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runCreate writes a torrent for the file or directory in args.
+func runCreate(fs *flag.FlagSet, args []string) error {
+	var trackers, webSeeds listFlag
+	fs.Var(&trackers, "announce", "tracker URL; repeat for more tiers, separate the URLs of one tier with commas")
+	fs.Var(&webSeeds, "webseed", "web seed URL; may be repeated")
+	output := fs.String("o", "", "path of the torrent file, the name of the content with .torrent appended if empty")
+	pieceSize := fs.String("piece-size", "auto", "piece size, a power of two such as 256KiB or 4MiB, or auto")
+	private := fs.Bool("private", false, "restrict peer discovery to the trackers")
+	comment := fs.String("comment", "", "free-form comment")
+	source := fs.String("source", "", "tag of the tracker or community the torrent is made for")
+	version := fs.String("version", "v1", "torrent version: v1, v2 or hybrid")
+	align := fs.Bool("align", false, "add padding files so that every file starts on a piece boundary")
+	attrs := fs.Bool("attrs", false, "record executable files and include symbolic links within the directory")
+	noDate := fs.Bool("no-date", false, "leave out the creation date, so identical content gives identical files")
+	quiet := fs.Bool("q", false, "do not report hashing progress")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	switch *version {
+	case "v1", "hybrid":
+	case "v2":
+		return fmt.Errorf("creating %s torrents is not supported yet", *version)
+	default:
+		return fmt.Errorf("invalid version %q: must be v1, v2 or hybrid", *version)
+	}
+	opts := metainfo.CreateOptions{
+		Private:        *private,
+		Comment:        *comment,
+		CreatedBy:      peerid.ClientName + " " + peerid.Version,
+		Source:         *source,
+		WebSeeds:       webSeeds,
+		AlignFiles:     *align,
+		FileAttributes: *attrs,
+		Hybrid:         *version == "hybrid",
+	}
+	if *pieceSize != "auto" {
+		size, err := parseSize(*pieceSize)
+		if err != nil {
+			return fmt.Errorf("invalid piece size: %w", err)
+		}
+		opts.PieceLength = size
+	}
+	for _, tier := range trackers {
+		opts.Trackers = append(opts.Trackers, strings.Split(tier, ","))
+	}
+	if !*quiet {
+		opts.Hash.Progress = func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\rhashing: %d/%d pieces", done, total)
+			if done == total {
+				fmt.Fprintln(os.Stderr)
+			}
+		}
+	}
+
+	root := fs.Arg(0)
+	mi, err := metainfo.Create(root, opts)
+	if err != nil {
+		return err
+	}
+	if !*noDate {
+		mi.SetCreationTime(time.Now())
+	}
+
+	path := *output
+	if path == "" {
+		path = filepath.Base(filepath.Clean(root)) + ".torrent"
+	}
+	if err := mi.Save(path); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d pieces of %s, info hash %x\n", path, mi.NumPieces(), metainfo.FormatSize(mi.Info.PieceLength), mi.InfoHash)
+	return nil
+}
+
+// parseSize parses a byte size made of a number and an optional binary unit: B, KiB, MiB or
+// GiB, the "i" and "B" being optional, such as "512KiB", "4M" or "16384".
+func parseSize(s string) (int64, error) {
+	number := strings.TrimRight(s, "BbiKkMmGg")
+	unit := strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(s[len(number):], "B"), "i"))
+	var multiplier int64
+	switch unit {
+	case "":
+		multiplier = 1
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	default:
+		return 0, fmt.Errorf("unknown unit in %q", s)
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return n * multiplier, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/logging"
+	"github.com/lcsabi/gobit/internal/rpc"
+	"github.com/lcsabi/gobit/internal/session"
+)
+
+// runDaemon runs a session controlled through the control API until the process is
+// interrupted or terminated, then shuts the session down like runDownload.
+func runDaemon(fs *flag.FlagSet, args []string) error {
+	config := sessionFlags(fs)
+	addr := fs.String("rpc", rpc.DefaultAddr(), "control address: unix:/path/to/socket or a loopback host:port")
+	remove := fs.Bool("seed-remove", false, "remove torrents reaching a seed limit, keeping their content")
+	command := fs.String("seed-exec", "", "program run for each torrent reaching a seed limit, with GOBIT_INFO_HASH, GOBIT_NAME, GOBIT_RATIO and GOBIT_SEEDING_TIME in its environment")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg, err := config()
+	if err != nil {
+		return err
+	}
+
+	s, err := session.New(cfg)
+	if err != nil {
+		return err
+	}
+	l, err := rpc.Listen(*addr)
+	if err != nil {
+		s.Close()
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go cfg.IPFilter.Watch(ctx, blocklistCheckInterval)
+	if *remove || *command != "" {
+		go onSeedLimit(ctx, s, *remove, *command)
+	}
+	logging.For(logging.RPC).Info("daemon listening", "addr", *addr)
+	err = rpc.NewServer(s, nil).Serve(ctx, l)
+	stop()
+	logging.For(logging.RPC).Info("daemon shutting down")
+	if closeErr := shutdown(s); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// onSeedLimit handles the torrents of s reaching a seed limit until ctx is cancelled: it runs
+// command, if not empty, with the torrent described in its environment, then removes the
+// torrent if remove is set.
+func onSeedLimit(ctx context.Context, s *session.Session, remove bool, command string) {
+	events := s.Subscribe(session.EventSeedLimitReached)
+	defer s.Unsubscribe(events)
+	logger := logging.For(logging.Session)
+	for {
+		var e session.Event
+		select {
+		case <-ctx.Done():
+			return
+		case e = <-events:
+		}
+		t := s.Torrent(e.InfoHash)
+		if t == nil {
+			continue
+		}
+		if command != "" {
+			cmd := exec.CommandContext(ctx, command)
+			cmd.Env = append(os.Environ(),
+				"GOBIT_INFO_HASH="+e.InfoHash.Hex(),
+				"GOBIT_NAME="+t.MetaInfo().Info.Name,
+				"GOBIT_RATIO="+strconv.FormatFloat(e.Ratio, 'f', 2, 64),
+				"GOBIT_SEEDING_TIME="+strconv.FormatInt(int64(e.SeedingTime/time.Second), 10))
+			cmd.Stdout, cmd.Stderr = os.Stderr, os.Stderr
+			if err := cmd.Run(); err != nil {
+				logger.Warn("seed limit command failed", "torrent", t.MetaInfo().Info.Name, "error", err)
+			}
+		}
+		if remove {
+			if err := s.RemoveTorrent(e.InfoHash); err != nil {
+				logger.Warn("removing torrent failed", "torrent", t.MetaInfo().Info.Name, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/session"
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// progressBarWidth is the number of characters of the progress bar.
+const progressBarWidth = 30
+
+// shutdownTimeout bounds the time spent telling the trackers the torrents stopped on exit.
+const shutdownTimeout = 10 * time.Second
+
+// runDownload downloads the torrent at the path or magnet link in args with a session of its
+// own, showing its progress until it completes, or until it reaches a seed limit if any is
+// set. On an interrupt the session is shut down, saving the resume data; a second interrupt
+// abandons the announces still in flight.
+func runDownload(fs *flag.FlagSet, args []string) error {
+	config := sessionFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	cfg, err := config()
+	if err != nil {
+		return err
+	}
+
+	s, err := session.New(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go cfg.IPFilter.Watch(ctx, blocklistCheckInterval)
+	seedLimits := s.Subscribe(session.EventSeedLimitReached)
+
+	t, err := addTorrent(ctx, s, fs.Arg(0))
+	if err == nil {
+		err = t.Start()
+	}
+	if err == nil {
+		err = showProgress(ctx, t, seedLimits)
+	}
+	if closeErr := shutdown(s); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// shutdown shuts s down within shutdownTimeout, or until the process is interrupted again.
+func shutdown(s *session.Session) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, shutdownTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// addTorrent adds the torrent at path, or behind a magnet link, to s.
+func addTorrent(ctx context.Context, s *session.Session, path string) (*session.Torrent, error) {
+	if strings.HasPrefix(path, "magnet:") {
+		fmt.Fprintln(os.Stderr, "fetching metadata...")
+		return s.AddMagnet(ctx, path)
+	}
+	mi, err := metainfo.ParseContext(ctx, path, metainfo.ParseOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return s.AddTorrent(mi)
+}
+
+// showProgress prints the progress of t every second until it completes, or ctx is
+// cancelled. If t has seed limits, it keeps seeding until seedLimits receives an event.
+// On a terminal, the progress is a single line redrawn in place.
+func showProgress(ctx context.Context, t *session.Torrent, seedLimits <-chan session.Event) error {
+	name := t.MetaInfo().Info.Name
+	limits := t.SeedLimits()
+	seeding := limits.Ratio > 0 || limits.Time > 0
+	interactive := isTerminal(os.Stdout)
+
+	var rate rateMeter
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		stats := t.Stats()
+		down, up := rate.update(stats)
+		line := progressLine(stats, down, up)
+		if interactive {
+			fmt.Printf("\r%s\033[K", line)
+		} else {
+			fmt.Println(line)
+		}
+
+		done := stats.Left == 0 && !seeding
+		select {
+		case <-ctx.Done():
+			done = true
+		case <-seedLimits:
+			done = true
+		default:
+		}
+		if done {
+			if interactive {
+				fmt.Println()
+			}
+			if ctx.Err() != nil {
+				fmt.Fprintln(os.Stderr, "interrupted, saving resume data")
+			} else {
+				fmt.Printf("%s: done, ratio %.2f\n", name, t.Stats().Ratio)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// progressLine formats the progress bar and the figures of a download.
+func progressLine(stats session.Stats, down, up float64) string {
+	filled := int(stats.Progress() * progressBarWidth / 100)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+
+	eta := "-"
+	switch {
+	case stats.Left == 0:
+		eta = "done"
+	case down > 0:
+		eta = (time.Duration(float64(stats.Left)/down) * time.Second).String()
+	}
+	return fmt.Sprintf("[%s] %5.1f%%  %s  down %s/s  up %s/s  ETA %s  peers %d  ratio %.2f",
+		bar, stats.Progress(), stats.State, metainfo.FormatSize(int64(down)), metainfo.FormatSize(int64(up)), eta, stats.Peers, stats.Ratio)
+}
+
+// rateMeter computes transfer rates from successive Stats.
+type rateMeter struct {
+	last       time.Time
+	downloaded int64
+	uploaded   int64
+}
+
+// update returns the download and upload rates in bytes per second since the previous call,
+// zero on the first one.
+func (m *rateMeter) update(stats session.Stats) (down, up float64) {
+	now := time.Now()
+	if !m.last.IsZero() {
+		if seconds := now.Sub(m.last).Seconds(); seconds > 0 {
+			down = float64(stats.Downloaded-m.downloaded) / seconds
+			up = float64(stats.Uploaded-m.uploaded) / seconds
+		}
+	}
+	m.last, m.downloaded, m.uploaded = now, stats.Downloaded, stats.Uploaded
+	return down, up
+}
+
+// isTerminal reports whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
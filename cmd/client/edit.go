@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// runEdit writes a modified copy of a torrent file.
+func runEdit(fs *flag.FlagSet, args []string) error {
+	var addTrackers, removeTrackers listFlag
+	fs.Var(&addTrackers, "add-tracker", "tracker URL to add as a new tier; separate the URLs of one tier with commas; may be repeated")
+	fs.Var(&removeTrackers, "remove-tracker", "tracker URL to remove from every tier; may be repeated")
+	clearTrackers := fs.Bool("clear-trackers", false, "remove every tracker before adding those of -add-tracker")
+	comment := fs.String("comment", "", "new comment, removed if empty")
+	createdBy := fs.String("created-by", "", "new name of the creating program, removed if empty")
+	private := fs.Bool("private", false, "set or clear the private flag (changes the info hash)")
+	stripUnknown := fs.Bool("strip-unknown", false, "remove the keys gobit does not know, at the root and in the info dictionary (may change the info hash)")
+	force := fs.Bool("force", false, "save the edited torrent even if other edits changed its info hash")
+	output := fs.String("o", "", "path of the edited torrent file (required)")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *output == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	mi, err := metainfo.Parse(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	before := mi.InfoHash
+
+	if *clearTrackers || len(addTrackers) > 0 || len(removeTrackers) > 0 {
+		var tiers [][]string
+		if !*clearTrackers {
+			tiers = trackerTiers(mi)
+		}
+		for i, tier := range tiers {
+			tiers[i] = slices.DeleteFunc(tier, func(url string) bool { return slices.Contains(removeTrackers, url) })
+		}
+		for _, tier := range addTrackers {
+			tiers = append(tiers, strings.Split(tier, ","))
+		}
+		setTrackers(mi, tiers)
+	}
+	if set["comment"] {
+		mi.Comment = *comment
+	}
+	if set["created-by"] {
+		mi.CreatedBy = *createdBy
+	}
+	if set["private"] {
+		mi.Info.Private = nil
+		if *private {
+			flag := bencode.Integer(1)
+			mi.Info.Private = &flag
+		}
+	}
+	if *stripUnknown {
+		mi.Extra = nil
+		mi.Info.Extra = nil
+		for i := range mi.Info.Files {
+			mi.Info.Files[i].Extra = nil
+		}
+	}
+
+	encoded, err := mi.Encode()
+	if err != nil {
+		return err
+	}
+	edited, err := metainfo.ParseReader(bytes.NewReader(encoded))
+	if err != nil {
+		return fmt.Errorf("edited torrent is invalid: %w", err)
+	}
+	if edited.InfoHash != before {
+		if !set["private"] && !*stripUnknown && !*force {
+			return fmt.Errorf("the info hash would change from %x to %x, the edited torrent would join a different swarm; use -force to save it anyway", before, edited.InfoHash)
+		}
+		fmt.Fprintf(os.Stderr, "warning: the info hash changed from %x to %x, the edited torrent joins a different swarm\n", before, edited.InfoHash)
+	}
+	if err := mi.Save(*output); err != nil {
+		return err
+	}
+	fmt.Printf("%s: info hash %x\n", *output, edited.InfoHash)
+	return nil
+}
+
+// trackerTiers returns the tracker tiers of mi: its announce-list, or its announce URL alone.
+func trackerTiers(mi *metainfo.MetaInfo) [][]string {
+	if len(mi.AnnounceList) > 0 {
+		tiers := make([][]string, len(mi.AnnounceList))
+		for i, tier := range mi.AnnounceList {
+			tiers[i] = slices.Clone(tier)
+		}
+		return tiers
+	}
+	if mi.Announce != "" {
+		return [][]string{{mi.Announce}}
+	}
+	return nil
+}
+
+// setTrackers replaces the trackers of mi with tiers, dropping empty ones. As in torrents made
+// by Create, the first URL becomes the announce URL, and the announce-list is only kept if
+// there is more than one URL.
+func setTrackers(mi *metainfo.MetaInfo, tiers [][]string) {
+	mi.Announce, mi.AnnounceList = "", nil
+	var count int
+	for _, tier := range tiers {
+		if len(tier) == 0 {
+			continue
+		}
+		if mi.Announce == "" {
+			mi.Announce = tier[0]
+		}
+		mi.AnnounceList = append(mi.AnnounceList, tier)
+		count += len(tier)
+	}
+	if count < 2 {
+		mi.AnnounceList = nil
+	}
+}
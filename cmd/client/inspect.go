@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// inspection is the description of a torrent printed by the inspect command with -json.
+type inspection struct {
+	Name           string          `json:"name"`
+	Size           int64           `json:"size"`
+	PieceLength    int64           `json:"pieceLength"`
+	NumPieces      int             `json:"numPieces"`
+	Private        bool            `json:"private"`
+	InfoHash       string          `json:"infoHash,omitempty"`       // hex v1 info hash
+	InfoHashBase32 string          `json:"infoHashBase32,omitempty"` // base32 v1 info hash, as in older magnet links
+	InfoHashV2     string          `json:"infoHashV2,omitempty"`     // hex v2 info hash
+	CreationDate   *time.Time      `json:"creationDate,omitempty"`
+	CreatedBy      string          `json:"createdBy,omitempty"`
+	Comment        string          `json:"comment,omitempty"`
+	Source         string          `json:"source,omitempty"`
+	Trackers       [][]string      `json:"trackers"` // tiers of tracker URLs
+	WebSeeds       []string        `json:"webSeeds"`
+	HTTPSeeds      []string        `json:"httpSeeds,omitempty"` // seeds of the older protocol of BEP 17
+	Files          []inspectedFile `json:"files"`
+}
+
+// inspectedFile is a file of an inspected torrent.
+type inspectedFile struct {
+	Path string `json:"path"` // slash-separated path, starting with the torrent name in multi-file torrents
+	Size int64  `json:"size"`
+}
+
+// inspect describes mi.
+func inspect(mi *metainfo.MetaInfo) inspection {
+	in := inspection{
+		Name:        mi.Info.Name,
+		Size:        mi.TotalLength(),
+		PieceLength: mi.Info.PieceLength,
+		NumPieces:   mi.NumPieces(),
+		Private:     mi.Info.Private != nil && *mi.Info.Private == 1,
+		CreatedBy:   mi.CreatedBy,
+		Comment:     mi.Comment,
+		Source:      mi.Info.Source,
+		Trackers:    [][]string{},
+		WebSeeds:    []string{},
+		Files:       []inspectedFile{},
+	}
+	if mi.HasV1() {
+		in.InfoHash = mi.InfoHash.Hex()
+		in.InfoHashBase32 = mi.InfoHash.Base32()
+	}
+	if mi.HasV2() {
+		in.InfoHashV2 = mi.InfoHashV2.Hex()
+	}
+	if date := mi.CreationTime(); !date.IsZero() {
+		in.CreationDate = &date
+	}
+
+	in.Trackers = append(in.Trackers, mi.AnnounceList...)
+	if len(in.Trackers) == 0 && mi.Announce != "" {
+		in.Trackers = append(in.Trackers, []string{mi.Announce})
+	}
+	in.WebSeeds = append(in.WebSeeds, mi.URLList...)
+	in.HTTPSeeds = mi.HTTPSeeds
+
+	for _, f := range mi.Info.Files {
+		if f.IsPadding() {
+			continue
+		}
+		path := strings.Join(f.Path, "/")
+		if mi.IsMultiFile() {
+			path = mi.Info.Name + "/" + path
+		}
+		in.Files = append(in.Files, inspectedFile{Path: path, Size: f.Length})
+	}
+	return in
+}
+
+// runInspect prints the description of the torrent files in args.
+func runInspect(fs *flag.FlagSet, args []string) error {
+	asJSON := fs.Bool("json", false, "print machine-readable JSON, one document per torrent")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	for i, path := range fs.Args() {
+		mi, err := metainfo.Parse(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(inspect(mi)); err != nil {
+				return err
+			}
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(mi)
+	}
+	return nil
+}
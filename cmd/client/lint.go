@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// errLint reports torrents that failed linting, making the command exit non-zero.
+var errLint = errors.New("problems found")
+
+// runLint prints the spec violations and warnings of the torrent files in args, both those found
+// while parsing and those reported by metainfo.Lint. It fails if any torrent has violations, or
+// warnings with -strict.
+func runLint(fs *flag.FlagSet, args []string) error {
+	strict := fs.Bool("strict", false, "also fail on warnings")
+	quiet := fs.Bool("q", false, "only print the torrents with problems")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	failed := false
+	for _, path := range fs.Args() {
+		mi, report, err := metainfo.ParseWithReport(path, metainfo.ParseOptions{})
+		if err != nil {
+			fmt.Printf("%s: %v\n", path, err)
+			failed = true
+			continue
+		}
+		for _, issue := range metainfo.Lint(mi).Issues {
+			if !slices.Contains(report.Issues, issue) { // both report torrents without trackers
+				report.Issues = append(report.Issues, issue)
+			}
+		}
+
+		violations, warnings := report.Violations(), report.Warnings()
+		if len(violations) > 0 || (*strict && len(warnings) > 0) {
+			failed = true
+		}
+		if len(violations) == 0 && len(warnings) == 0 {
+			if !*quiet {
+				fmt.Printf("%s: ok\n", path)
+			}
+			continue
+		}
+		for _, issue := range append(violations, warnings...) {
+			fmt.Printf("%s: %s\n", path, issue)
+		}
+	}
+	if failed {
+		return errLint
+	}
+	return nil
+}
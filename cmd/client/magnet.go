@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/session"
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// runMagnet prints the magnet link of a torrent file, or saves the torrent file of a magnet
+// link after downloading its metadata from the peers found through the link's trackers and
+// peer addresses.
+func runMagnet(fs *flag.FlagSet, args []string) error {
+	output := fs.String("o", "", "path of the torrent file saved for a magnet link, the torrent name with .torrent appended if empty")
+	timeout := fs.Duration("timeout", 2*time.Minute, "time allowed to download the metadata of a magnet link")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	arg := fs.Arg(0)
+	if !strings.HasPrefix(arg, "magnet:") {
+		mi, err := metainfo.Parse(arg)
+		if err != nil {
+			return err
+		}
+		fmt.Println(mi.Magnet().String())
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	// a session without a listener or a download directory of its own only fetches metadata
+	s, err := session.New(session.Config{})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	t, err := s.AddMagnet(ctx, arg)
+	if err != nil {
+		return fmt.Errorf("fetching metadata: %w", err)
+	}
+	mi := t.MetaInfo()
+
+	path := *output
+	if path == "" {
+		path = filepath.Base(mi.Info.Name) + ".torrent" // the name comes from peers, keep it in the current directory
+	}
+	// the torrent is encoded from the parsed metadata: make sure it still names the swarm of the link
+	data, err := mi.Encode()
+	if err != nil {
+		return err
+	}
+	saved, err := metainfo.ParseReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("checking the encoded torrent: %w", err)
+	}
+	if saved.InfoHash != mi.InfoHash {
+		return fmt.Errorf("the encoded torrent has info hash %x instead of %x", saved.InfoHash, mi.InfoHash)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s, %d files, info hash %x\n", path, mi.Info.Name, len(mi.Info.Files), mi.InfoHash)
+	return nil
+}
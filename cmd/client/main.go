@@ -1,20 +1,177 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"os"
+	"time"
 
-	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/internal/config"
+	"github.com/lcsabi/gobit/internal/ipfilter"
+	"github.com/lcsabi/gobit/internal/logging"
+	"github.com/lcsabi/gobit/internal/portmap"
+	"github.com/lcsabi/gobit/internal/ratelimit"
+	"github.com/lcsabi/gobit/internal/session"
 )
 
+// command is a subcommand of the client.
+type command struct {
+	name  string
+	args  string // synopsis of the arguments after the flags
+	short string // one-line description
+	run   func(fs *flag.FlagSet, args []string) error
+}
+
+// commands are the subcommands, in the order they are listed by the usage.
+var commands = []command{
+	{"inspect", "file.torrent...", "describe torrent files", runInspect},
+	{"create", "file|directory", "create a torrent file", runCreate},
+	{"edit", "file.torrent", "write a modified copy of a torrent file", runEdit},
+	{"lint", "file.torrent...", "check torrent files for spec violations and questionable content", runLint},
+	{"magnet", "file.torrent|magnet-link", "convert between torrent files and magnet links", runMagnet},
+	{"bencode", "[file|-]", "convert bencoded data to JSON or YAML, or JSON to bencode", runBencode},
+	{"verify", "file.torrent [data-dir]", "check downloaded content against the piece hashes", runVerify},
+	{"download", "file.torrent|magnet-link", "download a torrent without a daemon", runDownload},
+	{"daemon", "", "run a session controlled through the control API", runDaemon},
+	{"add", "file.torrent|magnet-link...", "add torrents to the daemon", runAdd},
+	{"list", "", "list the torrents of the daemon", runList},
+	{"start", "info-hash", "start or resume a torrent of the daemon", runStart},
+	{"pause", "info-hash", "disconnect a torrent of the daemon from its peers", runPause},
+	{"stop", "info-hash", "stop a torrent of the daemon", runStop},
+	{"remove", "info-hash", "remove a torrent from the daemon, keeping its content", runRemove},
+	{"peers", "info-hash", "list the peers of a torrent of the daemon", runPeers},
+	{"limits", "", "show or change the limits of the daemon", runLimits},
+	{"rates", "", "show or change the rate limits of the daemon", runRates},
+	{"blocklist", "", "show or reload the IP blocklist of the daemon", runBlocklist},
+	{"disk", "", "show the disk write queue and read cache activity of the daemon", runDisk},
+}
+
 func main() {
-	file, err := torrent.Parse("D:\\devstuff\\projects\\gobit\\cmd\\client\\info_hash2.torrent")
-	if err != nil {
-		fmt.Println(err)
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "usage: %s %s [flags] %s\n\n%s.\n", os.Args[0], cmd.name, cmd.args, cmd.short)
+			fs.PrintDefaults()
+		}
+		if err := cmd.run(fs, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s command [flags] [arguments]\n\ncommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-9s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(out, "\nRun '%s command -h' for the flags of a command.\n", os.Args[0])
+}
+
+// blocklistCheckInterval is how often the blocklist file is checked for changes.
+const blocklistCheckInterval = time.Minute
+
+// sessionFlags defines the flags configuring a session on fs, and returns the function
+// building the configuration once fs is parsed. The settings are the defaults, overridden by
+// the -config file, then by the GOBIT_* environment variables, then by the flags given.
+func sessionFlags(fs *flag.FlagSet) func() (session.Config, error) {
+	defaults := config.DefaultConfig()
+	path := fs.String("config", "", "configuration file to load: .json, .toml, .yaml or .yml")
+	dir := fs.String("download-dir", defaults.DownloadDir, "directory to download into")
+	fs.StringVar(dir, "dir", defaults.DownloadDir, "short for -download-dir")
+	fs.String("resume", defaults.ResumeDir, "directory to keep fast resume files in, disabled if empty")
+	fs.String("incomplete-dir", defaults.IncompleteDir, "directory to download into until complete, then move to -download-dir")
+	fs.Bool("part-files", defaults.PartFiles, "name the files of incomplete torrents with a .part suffix")
+	fs.String("allocation", defaults.Allocation.String(), "file allocation when a torrent starts: none, sparse or full")
+	fs.String("port", defaults.ListenPorts.String(), "port or range of ports to accept peers on, the first free one is used")
+	fs.Bool("portmap", defaults.PortMapping, "forward the port on the router with UPnP or NAT-PMP")
+	fs.String("encryption", defaults.Encryption.String(), "peer connection encryption: disabled, preferred or required")
+	fs.String("blocklist", defaults.Blocklist, "IP blocklist of peers not to connect to: eMule .dat, P2P plaintext or CIDR lines")
+	fs.String("download-rate", ratelimit.FormatRate(defaults.DownloadRate), "rate to download at, such as 1MiB/s")
+	fs.String("upload-rate", ratelimit.FormatRate(defaults.UploadRate), "rate to upload at, such as 256KiB/s")
+	fs.String("schedule", defaults.Schedule.String(), "other rates by time window, such as \"workdays 09:00-17:00 down=1MiB/s\"")
+	fs.Float64("seed-ratio", defaults.SeedRatio, "stop seeding once uploaded/downloaded reaches this ratio, never if 0")
+	fs.Duration("seed-time", defaults.SeedTime, "stop seeding after seeding this long, never if 0")
+	fs.String("seed-action", defaults.SeedAction.String(), "what a torrent reaching a seed limit does: stop or pause")
+	verbose := fs.Bool("v", false, "log debug output")
+
+	// configuration keys set by the flags
+	keys := map[string]string{
+		"download-dir":   "download_dir",
+		"dir":            "download_dir",
+		"resume":         "resume_dir",
+		"incomplete-dir": "incomplete_dir",
+		"part-files":     "part_files",
+		"allocation":     "allocation",
+		"port":           "listen_ports",
+		"portmap":        "port_mapping",
+		"encryption":     "encryption",
+		"blocklist":      "blocklist",
+		"download-rate":  "download_rate",
+		"upload-rate":    "upload_rate",
+		"schedule":       "schedule",
+		"seed-ratio":     "seed_ratio",
+		"seed-time":      "seed_time",
+		"seed-action":    "seed_action",
+	}
+
+	return func() (session.Config, error) {
+		level := slog.LevelInfo
+		if *verbose {
+			level = slog.LevelDebug
+		}
+		logging.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+		c := config.DefaultConfig()
+		if *path != "" {
+			if err := c.LoadFile(*path); err != nil {
+				return session.Config{}, err
+			}
+		}
+		if err := c.ApplyEnv(os.LookupEnv); err != nil {
+			return session.Config{}, err
+		}
+		var errs []error
+		fs.Visit(func(f *flag.Flag) {
+			if key, ok := keys[f.Name]; ok {
+				if err := c.Set(key, f.Value.String()); err != nil {
+					errs = append(errs, fmt.Errorf("-%s: %w", f.Name, err))
+				}
+			}
+		})
+		if err := errors.Join(append(errs, c.Validate())...); err != nil {
+			return session.Config{}, err
+		}
+
+		cfg := c.Session()
+		if c.PortMapping {
+			cfg.PortMappers = portmap.DefaultMappers()
+		}
+		if c.Blocklist != "" {
+			filter, err := ipfilter.Load(c.Blocklist)
+			if err != nil {
+				return session.Config{}, err
+			}
+			cfg.IPFilter = filter
+		}
+		return cfg, nil
 	}
-	fmt.Printf("%v\n", file.Announce)
-	fmt.Printf("%v\n", file.AnnounceList)
-	fmt.Printf("%v\n", file.Info.Name)
-	fmt.Printf("%v\n", file.Info.PieceLength)
-	fmt.Printf("%v\n", file.Info.Files)
-	fmt.Printf("%x\n", file.InfoHash)
 }
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/ratelimit"
+	"github.com/lcsabi/gobit/internal/rpc"
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// callTimeout bounds a call to the daemon; adding a magnet link waits for its metadata.
+const callTimeout = 3 * time.Minute
+
+// remoteFlags defines the flag selecting the daemon on fs, and returns the function
+// connecting to it once fs is parsed.
+func remoteFlags(fs *flag.FlagSet) func(ctx context.Context) (*rpc.Client, error) {
+	addr := fs.String("rpc", rpc.DefaultAddr(), "control address of the daemon: unix:/path/to/socket or host:port")
+	return func(ctx context.Context) (*rpc.Client, error) {
+		return rpc.Dial(ctx, *addr)
+	}
+}
+
+// remote parses the flags of a command talking to the daemon, checks that it has between
+// minArgs and maxArgs arguments, maxArgs being unlimited if negative, connects to the daemon
+// and calls f.
+func remote(fs *flag.FlagSet, args []string, minArgs, maxArgs int, f func(ctx context.Context, c *rpc.Client, args []string) error) error {
+	dial := remoteFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() < minArgs || (maxArgs >= 0 && fs.NArg() > maxArgs) {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	c, err := dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return f(ctx, c, fs.Args())
+}
+
+func runAdd(fs *flag.FlagSet, args []string) error {
+	paused := fs.Bool("paused", false, "add the torrents without starting them")
+	return remote(fs, args, 1, -1, func(ctx context.Context, c *rpc.Client, args []string) error {
+		for _, arg := range args {
+			p := rpc.AddParams{Magnet: arg, Paused: *paused}
+			if !strings.HasPrefix(arg, "magnet:") {
+				data, err := os.ReadFile(arg)
+				if err != nil {
+					return err
+				}
+				p = rpc.AddParams{Torrent: data, Paused: *paused}
+			}
+			status, err := c.Add(ctx, p)
+			if err != nil {
+				return fmt.Errorf("adding %s: %w", arg, err)
+			}
+			fmt.Printf("added %s %s\n", status.InfoHash, status.Name)
+		}
+		return nil
+	})
+}
+
+func runList(fs *flag.FlagSet, args []string) error {
+	return remote(fs, args, 0, 0, func(ctx context.Context, c *rpc.Client, _ []string) error {
+		statuses, err := c.List(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "INFO HASH\tSTATE\tPROGRESS\tPEERS\tDOWN\tUP\tRATIO\tNAME")
+		for _, s := range statuses {
+			fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%d\t%d\t%d\t%.2f\t%s\n",
+				s.InfoHash, s.State, s.Progress, s.Peers, s.Downloaded, s.Uploaded, s.Ratio, s.Name)
+		}
+		return w.Flush()
+	})
+}
+
+// control returns the command calling action on the torrent named by its argument.
+func control(action func(c *rpc.Client, ctx context.Context, infoHash metainfo.InfoHash) (rpc.TorrentStatus, error)) func(*flag.FlagSet, []string) error {
+	return func(fs *flag.FlagSet, args []string) error {
+		return remote(fs, args, 1, 1, func(ctx context.Context, c *rpc.Client, args []string) error {
+			infoHash, err := metainfo.ParseInfoHash(args[0])
+			if err != nil {
+				return err
+			}
+			status, err := action(c, ctx, infoHash)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", status.Name, status.State)
+			return nil
+		})
+	}
+}
+
+var (
+	runStart = control((*rpc.Client).Start)
+	runPause = control((*rpc.Client).Pause)
+	runStop  = control((*rpc.Client).Stop)
+)
+
+func runRemove(fs *flag.FlagSet, args []string) error {
+	return remote(fs, args, 1, 1, func(ctx context.Context, c *rpc.Client, args []string) error {
+		infoHash, err := metainfo.ParseInfoHash(args[0])
+		if err != nil {
+			return err
+		}
+		return c.Remove(ctx, infoHash)
+	})
+}
+
+func runPeers(fs *flag.FlagSet, args []string) error {
+	return remote(fs, args, 1, 1, func(ctx context.Context, c *rpc.Client, args []string) error {
+		infoHash, err := metainfo.ParseInfoHash(args[0])
+		if err != nil {
+			return err
+		}
+		peers, err := c.Peers(ctx, infoHash)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ADDRESS\tCLIENT\tFLAGS\tHAVE\tDOWN/S\tUP/S")
+		for _, p := range peers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%.0f\t%.0f\n",
+				p.Addr, p.Client, peerFlags(p), p.Have, p.DownloadRate, p.UploadRate)
+		}
+		return w.Flush()
+	})
+}
+
+// peerFlags summarizes the choking and interest of a connection in the style of µTorrent:
+// 'D' we download from the peer, 'd' we want to but are choked, 'U' we upload to the peer,
+// 'u' it wants us to but we choke it.
+func peerFlags(p rpc.PeerStatus) string {
+	var flags strings.Builder
+	switch {
+	case p.AmInterested && !p.PeerChoking:
+		flags.WriteByte('D')
+	case p.AmInterested:
+		flags.WriteByte('d')
+	}
+	switch {
+	case p.PeerInterested && !p.AmChoking:
+		flags.WriteByte('U')
+	case p.PeerInterested:
+		flags.WriteByte('u')
+	}
+	if flags.Len() == 0 {
+		return "-"
+	}
+	return flags.String()
+}
+
+func runLimits(fs *flag.FlagSet, args []string) error {
+	maxPeers := fs.Int("max-peers", 0, "maximum number of connections per torrent, unchanged if zero")
+	return remote(fs, args, 0, 0, func(ctx context.Context, c *rpc.Client, _ []string) error {
+		limits, err := c.SetLimits(ctx, rpc.Limits{MaxPeers: *maxPeers})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("max peers per torrent: %d\n", limits.MaxPeers)
+		return nil
+	})
+}
+
+func runRates(fs *flag.FlagSet, args []string) error {
+	down := fs.String("down", "", "rate to download at outside of the schedule, such as 1MiB/s or unlimited")
+	up := fs.String("up", "", "rate to upload at outside of the schedule")
+	schedule := fs.String("schedule", "", "other rates by time window, such as \"workdays 09:00-17:00 down=1MiB/s\", none if empty")
+	return remote(fs, args, 0, 0, func(ctx context.Context, c *rpc.Client, _ []string) error {
+		status, err := c.Rates(ctx)
+		if err != nil {
+			return err
+		}
+		rates, changed := status.Rates, false
+		fs.Visit(func(f *flag.Flag) {
+			if err != nil {
+				return
+			}
+			switch f.Name {
+			case "down":
+				rates.Download, err = ratelimit.ParseRate(*down)
+			case "up":
+				rates.Upload, err = ratelimit.ParseRate(*up)
+			case "schedule":
+				rates.Schedule = *schedule
+			default:
+				return
+			}
+			changed = true
+		})
+		if err != nil {
+			return err
+		}
+		if changed {
+			if status, err = c.SetRates(ctx, rates); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("download: %s, upload: %s\n", ratelimit.FormatRate(status.Download), ratelimit.FormatRate(status.Upload))
+		if status.Schedule != "" {
+			fmt.Printf("schedule: %s\n", status.Schedule)
+		}
+		fmt.Printf("now: download %s, upload %s\n", ratelimit.FormatRate(status.CurrentDownload), ratelimit.FormatRate(status.CurrentUpload))
+		return nil
+	})
+}
+
+func runBlocklist(fs *flag.FlagSet, args []string) error {
+	reload := fs.Bool("reload", false, "load the blocklist again from its file first")
+	return remote(fs, args, 0, 0, func(ctx context.Context, c *rpc.Client, _ []string) error {
+		get := c.Blocklist
+		if *reload {
+			get = c.ReloadBlocklist
+		}
+		status, err := get(ctx)
+		if err != nil {
+			return err
+		}
+		if !status.Enabled {
+			fmt.Println("no blocklist loaded")
+			return nil
+		}
+		fmt.Printf("blocked ranges: %d, loaded %s\n", status.Ranges, metainfo.FormatTime(status.LoadedAt))
+		fmt.Printf("blocked connections: %d inbound, %d outbound\n", status.BlockedInbound, status.BlockedOutbound)
+		return nil
+	})
+}
+
+func runDisk(fs *flag.FlagSet, args []string) error {
+	return remote(fs, args, 0, 0, func(ctx context.Context, c *rpc.Client, _ []string) error {
+		status, err := c.Disk(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("write queue: %d blocks, %s\n", status.QueuedBlocks, metainfo.FormatSize(status.QueuedBytes))
+		fmt.Printf("written: %d blocks in %d writes\n", status.Written, status.Writes)
+		fmt.Printf("read cache: %d pieces, %s, %d hits, %d misses\n",
+			status.CachePieces, metainfo.FormatSize(status.CacheBytes), status.CacheHits, status.CacheMisses)
+		return nil
+	})
+}
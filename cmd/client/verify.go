@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/lcsabi/gobit/pkg/metainfo"
+)
+
+// errIncomplete reports content that failed verification, making the command exit non-zero.
+var errIncomplete = errors.New("content is incomplete or corrupt")
+
+// runVerify checks the content of a torrent in a data directory against its piece hashes,
+// printing the completion of every file.
+func runVerify(fs *flag.FlagSet, args []string) error {
+	workers := fs.Int("workers", 0, "pieces hashed in parallel, the number of CPUs if zero")
+	quiet := fs.Bool("q", false, "only print the files that are not complete")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if fs.NArg() == 2 {
+		dir = fs.Arg(1)
+	}
+
+	mi, err := metainfo.Parse(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := metainfo.HashOptions{Workers: *workers}
+	if isTerminal(os.Stderr) {
+		opts.Progress = func(done, total int) {
+			fmt.Fprintf(os.Stderr, "\rverifying: %d/%d pieces", done, total)
+			if done == total {
+				fmt.Fprint(os.Stderr, "\r\033[K")
+			}
+		}
+	}
+	have, percent, err := mi.ScanProgressWithOptions(ctx, dir, opts)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, file := range mi.Info.Files {
+		if file.IsPadding() {
+			continue
+		}
+		status := fileStatus(mi, dir, i, have)
+		if *quiet && status == "100.0%" {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\n", status, mi.Info.ContentPath("", i))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	numPieces := mi.NumPieces()
+	valid := have.Count(numPieces)
+	fmt.Printf("%d/%d pieces valid (%.1f%%)\n", valid, numPieces, percent)
+	if valid != numPieces {
+		return errIncomplete
+	}
+	return nil
+}
+
+// fileStatus describes the content of the file at index in dir: "missing" or "short" if it is
+// absent or smaller than in the torrent, otherwise the percentage of its bytes covered by the
+// valid pieces in have, marked as corrupt when the file has its full size.
+func fileStatus(mi *metainfo.MetaInfo, dir string, index int, have metainfo.Bitfield) string {
+	length := mi.Info.Files[index].Length
+	info, err := os.Stat(mi.Info.ContentPath(dir, index))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "missing"
+	case err != nil:
+		return "unreadable"
+	case info.Size() < length:
+		return "short"
+	}
+	if length == 0 {
+		return "100.0%"
+	}
+	left := mi.LeftForSelection([]int{index}, have)
+	status := fmt.Sprintf("%.1f%%", float64(length-left)*100/float64(length))
+	if left > 0 {
+		status += " corrupt"
+	}
+	return status
+}
@@ -0,0 +1,180 @@
+// Package choke decides which peers a torrent uploads to.
+//
+// Uploading to every peer at once spreads the upload bandwidth too thin to be useful, so only
+// a few peers are unchoked at a time. The standard tit-for-tat choker gives these upload slots
+// to the interested peers that upload the most to us, rewarding reciprocation, and once every
+// 30 seconds hands an extra slot to a random peer, the optimistic unchoke, to discover peers
+// that would reciprocate better and to let new peers get their first pieces. Once the download
+// is complete, peers are ranked by how fast they download from us instead.
+//
+// Choker is an interface so other strategies, such as super-seeding, can be plugged in.
+//
+// Reference: https://bittorrent.org/beps/bep_0003.html#peer-protocol
+package choke
+
+import (
+	"math/rand/v2"
+	"slices"
+	"time"
+)
+
+// defaults for the zero values of TitForTat
+const (
+	DefaultSlots              = 4
+	DefaultRechokeInterval    = 10 * time.Second
+	DefaultOptimisticInterval = 30 * time.Second
+	DefaultSnubTimeout        = time.Minute
+)
+
+// newPeerWeight is how much more likely peers connected for less than an optimistic interval
+// are picked for the optimistic unchoke, since they have no pieces to reciprocate with yet.
+const newPeerWeight = 3
+
+// Peer is the state of a connected peer that the choker decides on.
+type Peer struct {
+	ID           string
+	Interested   bool      // the peer wants pieces from us
+	Unchoked     bool      // we currently unchoke the peer
+	DownloadRate float64   // payload bytes per second received from the peer
+	UploadRate   float64   // payload bytes per second sent to the peer
+	LastReceived time.Time // when the peer last sent us a block, zero if never
+	ConnectedAt  time.Time
+}
+
+// Round is the input of a rechoke, taken every RechokeInterval and whenever the interest
+// of a peer changes.
+type Round struct {
+	Now     time.Time
+	Seeding bool // every piece is downloaded, so peers have nothing left to reciprocate with
+	Peers   []Peer
+}
+
+// Choker decides which peers to unchoke.
+type Choker interface {
+	// Rechoke returns the IDs of the peers to unchoke. Every other peer is choked.
+	Rechoke(r Round) []string
+}
+
+// TitForTat is the standard choker. The zero value uses the defaults of this package.
+// It is not safe for concurrent use.
+type TitForTat struct {
+	Slots              int           // regular upload slots, DefaultSlots if zero
+	OptimisticInterval time.Duration // time between optimistic unchoke rotations, DefaultOptimisticInterval if zero
+
+	// SnubTimeout is how long a peer may go without sending us a block, while connected,
+	// before it counts as snubbing us, DefaultSnubTimeout if zero. Snubbing peers only get
+	// the regular slots no other peer wants. Snubbing is ignored while seeding.
+	SnubTimeout time.Duration
+
+	optimistic   string    // ID of the optimistically unchoked peer, empty if none
+	optimisticAt time.Time // when optimistic was picked
+}
+
+// Rechoke implements Choker. The interested peers are ranked by download rate, or by upload
+// rate while seeding, with snubbing peers last, and the best ones get the regular slots.
+// One more interested peer is unchoked optimistically, rotating every OptimisticInterval.
+func (c *TitForTat) Rechoke(r Round) []string {
+	slots := c.Slots
+	if slots <= 0 {
+		slots = DefaultSlots
+	}
+	optimisticInterval := c.OptimisticInterval
+	if optimisticInterval <= 0 {
+		optimisticInterval = DefaultOptimisticInterval
+	}
+
+	var candidates []Peer
+	for _, p := range r.Peers {
+		if p.Interested {
+			candidates = append(candidates, p)
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b Peer) int {
+		if r.Seeding {
+			return compareRates(a.UploadRate, b.UploadRate)
+		}
+		if snubA, snubB := c.snubbing(a, r.Now), c.snubbing(b, r.Now); snubA != snubB {
+			if snubA {
+				return 1
+			}
+			return -1
+		}
+		return compareRates(a.DownloadRate, b.DownloadRate)
+	})
+
+	unchoke := make([]string, 0, slots+1)
+	for _, p := range candidates[:min(slots, len(candidates))] {
+		unchoke = append(unchoke, p.ID)
+	}
+
+	// keep the optimistic unchoke until it is due for rotation, as long as it is still eligible
+	var others []Peer
+	keep := false
+	for _, p := range r.Peers {
+		if !p.Interested || slices.Contains(unchoke, p.ID) {
+			continue
+		}
+		if p.ID == c.optimistic {
+			keep = r.Now.Sub(c.optimisticAt) < optimisticInterval
+		}
+		others = append(others, p)
+	}
+	if !keep {
+		c.optimistic = pickOptimistic(others, r.Now, optimisticInterval)
+		c.optimisticAt = r.Now
+	}
+	if c.optimistic != "" {
+		unchoke = append(unchoke, c.optimistic)
+	}
+	return unchoke
+}
+
+// snubbing reports whether the peer has not sent us a block for SnubTimeout.
+func (c *TitForTat) snubbing(p Peer, now time.Time) bool {
+	timeout := c.SnubTimeout
+	if timeout <= 0 {
+		timeout = DefaultSnubTimeout
+	}
+	last := p.LastReceived
+	if last.IsZero() {
+		last = p.ConnectedAt
+	}
+	return now.Sub(last) >= timeout
+}
+
+// compareRates orders rates from highest to lowest.
+func compareRates(a, b float64) int {
+	switch {
+	case a > b:
+		return -1
+	case a < b:
+		return 1
+	}
+	return 0
+}
+
+// pickOptimistic returns the ID of a random peer, favoring peers connected for less than
+// interval, or an empty string if there are no peers.
+func pickOptimistic(peers []Peer, now time.Time, interval time.Duration) string {
+	total := 0
+	weights := make([]int, len(peers))
+	for i, p := range peers {
+		weights[i] = 1
+		if now.Sub(p.ConnectedAt) < interval {
+			weights[i] = newPeerWeight
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		return ""
+	}
+
+	n := rand.IntN(total)
+	for i, w := range weights {
+		if n < w {
+			return peers[i].ID
+		}
+		n -= w
+	}
+	return "" // unreachable
+}
@@ -0,0 +1,141 @@
+package choke
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testPeers returns six interested peers, p0 to p5, with download rates decreasing from p0
+// and upload rates increasing from p0, all connected long ago and recently sending blocks.
+func testPeers(now time.Time) []Peer {
+	peers := make([]Peer, 6)
+	for i := range peers {
+		peers[i] = Peer{
+			ID:           "p" + string(rune('0'+i)),
+			Interested:   true,
+			DownloadRate: float64(100 - 10*i),
+			UploadRate:   float64(10 * i),
+			LastReceived: now.Add(-time.Second),
+			ConnectedAt:  start.Add(-time.Hour),
+		}
+	}
+	return peers
+}
+
+// regular returns the regular slots of an unchoke list, without the optimistic unchoke.
+func regular(unchoke []string, slots int) []string {
+	return slices.Sorted(slices.Values(unchoke[:min(slots, len(unchoke))]))
+}
+
+// TestTitForTatRanking checks which peers get the regular slots while downloading and seeding.
+func TestTitForTatRanking(t *testing.T) {
+	tests := []struct {
+		name     string
+		seeding  bool
+		change   func(peers []Peer)
+		expected []string
+	}{
+		{"best uploaders to us", false, func([]Peer) {}, []string{"p0", "p1", "p2", "p3"}},
+		{"best downloaders from us while seeding", true, func([]Peer) {}, []string{"p2", "p3", "p4", "p5"}},
+		{"uninterested peer skipped", false, func(peers []Peer) {
+			peers[2].Interested = false
+		}, []string{"p0", "p1", "p3", "p4"}},
+		{"snubbing peer loses its slot", false, func(peers []Peer) {
+			peers[1].LastReceived = start.Add(-2 * time.Minute)
+		}, []string{"p0", "p2", "p3", "p4"}},
+		{"peer that never sent a block snubs once connected long enough", false, func(peers []Peer) {
+			peers[0].LastReceived = time.Time{}
+		}, []string{"p1", "p2", "p3", "p4"}},
+		{"snubbing ignored while seeding", true, func(peers []Peer) {
+			peers[5].LastReceived = start.Add(-time.Hour)
+		}, []string{"p2", "p3", "p4", "p5"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			peers := testPeers(start)
+			tc.change(peers)
+			var c TitForTat
+			unchoke := c.Rechoke(Round{Now: start, Seeding: tc.seeding, Peers: peers})
+			if len(unchoke) != DefaultSlots+1 {
+				t.Fatalf("Rechoke() = %v, want %d regular slots and an optimistic unchoke", unchoke, DefaultSlots)
+			}
+			if got := regular(unchoke, DefaultSlots); !slices.Equal(got, tc.expected) {
+				t.Errorf("regular slots = %v, want %v", got, tc.expected)
+			}
+			if optimistic := unchoke[DefaultSlots]; slices.Contains(tc.expected, optimistic) {
+				t.Errorf("optimistic unchoke %q already has a regular slot", optimistic)
+			}
+		})
+	}
+}
+
+// TestTitForTatSnubbedFillFreeSlots ensures that snubbing peers still get slots nobody else wants.
+func TestTitForTatSnubbedFillFreeSlots(t *testing.T) {
+	peers := testPeers(start)[:3]
+	for i := range peers {
+		peers[i].LastReceived = time.Time{}
+	}
+	c := TitForTat{Slots: 3}
+	unchoke := c.Rechoke(Round{Now: start, Peers: peers})
+	if got := regular(unchoke, 3); !slices.Equal(got, []string{"p0", "p1", "p2"}) || len(unchoke) != 3 {
+		t.Errorf("Rechoke() = %v, want every peer in a regular slot", unchoke)
+	}
+}
+
+// TestTitForTatOptimisticRotation verifies that the optimistic unchoke is kept until the
+// interval passes and then rotates among the remaining interested peers.
+func TestTitForTatOptimisticRotation(t *testing.T) {
+	peers := testPeers(start)
+	c := TitForTat{Slots: 1, OptimisticInterval: 30 * time.Second}
+
+	first := c.Rechoke(Round{Now: start, Peers: peers})
+	if len(first) != 2 || first[0] != "p0" {
+		t.Fatalf("Rechoke() = %v, want p0 and an optimistic unchoke", first)
+	}
+	optimistic := first[1]
+	for elapsed := 10 * time.Second; elapsed < 30*time.Second; elapsed += 10 * time.Second {
+		got := c.Rechoke(Round{Now: start.Add(elapsed), Peers: peers})
+		if got[1] != optimistic {
+			t.Fatalf("optimistic unchoke changed from %q to %q after %v", optimistic, got[1], elapsed)
+		}
+	}
+
+	// once the optimistic peer loses interest, another one is picked immediately
+	for i := range peers {
+		if peers[i].ID == optimistic {
+			peers[i].Interested = false
+		}
+	}
+	got := c.Rechoke(Round{Now: start.Add(20 * time.Second), Peers: peers})
+	if len(got) != 2 || got[1] == optimistic || got[1] == "p0" {
+		t.Errorf("Rechoke() = %v, want a new optimistic unchoke", got)
+	}
+
+	seen := map[string]bool{}
+	for round := range 200 {
+		got := c.Rechoke(Round{Now: start.Add(time.Duration(round+1) * time.Minute), Peers: peers})
+		seen[got[1]] = true
+	}
+	if len(seen) < 3 {
+		t.Errorf("optimistic unchoke rotated among %d peers only: %v", len(seen), seen)
+	}
+}
+
+// TestTitForTatNoPeers ensures that a round without interested peers unchokes nobody.
+func TestTitForTatNoPeers(t *testing.T) {
+	var c TitForTat
+	if got := c.Rechoke(Round{Now: start}); len(got) != 0 {
+		t.Errorf("Rechoke() = %v, want nobody", got)
+	}
+	peers := testPeers(start)
+	for i := range peers {
+		peers[i].Interested = false
+	}
+	if got := c.Rechoke(Round{Now: start, Peers: peers}); len(got) != 0 {
+		t.Errorf("Rechoke() = %v, want nobody", got)
+	}
+}
@@ -0,0 +1,92 @@
+// Package compact encodes and decodes peer addresses in the compact format shared by trackers,
+// the DHT and peer exchange: the IP address in network byte order followed by the 2-byte
+// big-endian port, 6 bytes for IPv4 peers and 18 bytes for IPv6 peers. Lists are the plain
+// concatenation of their entries, IPv4 and IPv6 peers being kept in separate lists.
+//
+// References:
+//   - https://bittorrent.org/beps/bep_0023.html
+//   - https://bittorrent.org/beps/bep_0007.html
+//   - https://bittorrent.org/beps/bep_0005.html
+//   - https://bittorrent.org/beps/bep_0011.html
+package compact
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+)
+
+// sizes of a compact peer in bytes
+const (
+	Size4 = 4 + 2
+	Size6 = 16 + 2
+)
+
+// ParsePeers decodes a list of compact IPv4 peers, such as the 'peers' string of a tracker
+// response. Returns an error if the length of data is not a multiple of Size4.
+func ParsePeers(data []byte) ([]netip.AddrPort, error) {
+	return parseList(data, Size4)
+}
+
+// ParsePeers6 decodes a list of compact IPv6 peers, such as the 'peers6' string of a tracker
+// response. IPv4-mapped addresses are returned as IPv4 addresses. Returns an error if the
+// length of data is not a multiple of Size6.
+func ParsePeers6(data []byte) ([]netip.AddrPort, error) {
+	return parseList(data, Size6)
+}
+
+// ParsePeer decodes a single compact peer of either family, as found in DHT node and peer
+// lists. Returns an error unless data is exactly Size4 or Size6 bytes long.
+func ParsePeer(data []byte) (netip.AddrPort, error) {
+	if len(data) != Size4 && len(data) != Size6 {
+		return netip.AddrPort{}, fmt.Errorf("invalid compact peer length: %d, expected %d or %d", len(data), Size4, Size6)
+	}
+	return decode(data), nil
+}
+
+// AppendPeer appends the compact form of addr to buf: 6 bytes for IPv4 addresses, including
+// IPv4-mapped IPv6 ones, and 18 bytes otherwise. Invalid addresses are skipped.
+func AppendPeer(buf []byte, addr netip.AddrPort) []byte {
+	if !addr.IsValid() {
+		return buf
+	}
+	buf = append(buf, addr.Addr().Unmap().AsSlice()...)
+	return binary.BigEndian.AppendUint16(buf, addr.Port())
+}
+
+// EncodePeers returns the compact lists of the IPv4 and the IPv6 peers among addrs, in their
+// original order. Invalid addresses are skipped.
+func EncodePeers(addrs []netip.AddrPort) (peers, peers6 []byte) {
+	for _, addr := range addrs {
+		if !addr.IsValid() {
+			continue
+		}
+		if addr.Addr().Unmap().Is4() {
+			peers = AppendPeer(peers, addr)
+		} else {
+			peers6 = AppendPeer(peers6, addr)
+		}
+	}
+	return peers, peers6
+}
+
+// parseList decodes a list of compact peers of the given size each.
+func parseList(data []byte, size int) ([]netip.AddrPort, error) {
+	if len(data)%size != 0 {
+		return nil, fmt.Errorf("invalid compact peers length: %d is not divisible by %d", len(data), size)
+	}
+
+	addrs := make([]netip.AddrPort, 0, len(data)/size)
+	for i := 0; i < len(data); i += size {
+		addrs = append(addrs, decode(data[i:i+size]))
+	}
+	return addrs, nil
+}
+
+// decode decodes a compact peer of Size4 or Size6 bytes.
+func decode(data []byte) netip.AddrPort {
+	ipLen := len(data) - 2
+	ip, _ := netip.AddrFromSlice(data[:ipLen]) // cannot fail, ipLen is 4 or 16
+	port := binary.BigEndian.Uint16(data[ipLen:])
+	return netip.AddrPortFrom(ip.Unmap(), port)
+}
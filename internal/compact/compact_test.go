@@ -0,0 +1,73 @@
+package compact
+
+import (
+	"bytes"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// TestParsePeers checks the decoding of both families and the rejection of truncated lists.
+func TestParsePeers(t *testing.T) {
+	peers, err := ParsePeers([]byte{10, 0, 0, 1, 0x1a, 0xe1, 192, 168, 1, 2, 0x00, 0x50})
+	expected := []netip.AddrPort{netip.MustParseAddrPort("10.0.0.1:6881"), netip.MustParseAddrPort("192.168.1.2:80")}
+	if err != nil || !reflect.DeepEqual(peers, expected) {
+		t.Errorf("ParsePeers() = %v, %v, expected %v", peers, err, expected)
+	}
+
+	v6 := netip.MustParseAddr("2001:db8::1").As16()
+	mapped := netip.MustParseAddr("::ffff:10.0.0.1").As16()
+	data := append(append(v6[:], 0x1a, 0xe1), append(mapped[:], 0x00, 0x50)...)
+	peers, err = ParsePeers6(data)
+	expected = []netip.AddrPort{netip.MustParseAddrPort("[2001:db8::1]:6881"), netip.MustParseAddrPort("10.0.0.1:80")}
+	if err != nil || !reflect.DeepEqual(peers, expected) {
+		t.Errorf("ParsePeers6() = %v, %v, expected %v", peers, err, expected)
+	}
+
+	if peers, err := ParsePeers(nil); err != nil || len(peers) != 0 {
+		t.Errorf("ParsePeers(nil) = %v, %v, expected no peers", peers, err)
+	}
+	if _, err := ParsePeers(make([]byte, 7)); err == nil || err.Error() != "invalid compact peers length: 7 is not divisible by 6" {
+		t.Errorf("ParsePeers() of 7 bytes returned error %v", err)
+	}
+	if _, err := ParsePeers6(make([]byte, 12)); err == nil {
+		t.Error("ParsePeers6() of 12 bytes returned no error")
+	}
+}
+
+// TestParsePeer checks the decoding of single peers of either family.
+func TestParsePeer(t *testing.T) {
+	for _, s := range []string{"1.2.3.4:5", "[2001:db8::2]:65535"} {
+		addr := netip.MustParseAddrPort(s)
+		if got, err := ParsePeer(AppendPeer(nil, addr)); err != nil || got != addr {
+			t.Errorf("ParsePeer(AppendPeer(%v)) = %v, %v", addr, got, err)
+		}
+	}
+	for _, size := range []int{0, 5, 7, 17, 19} {
+		if _, err := ParsePeer(make([]byte, size)); err == nil {
+			t.Errorf("ParsePeer() of %d bytes returned no error", size)
+		}
+	}
+}
+
+// TestEncodePeers checks the split by family, the unmapping of IPv4-mapped addresses and the
+// round trip through the parsers.
+func TestEncodePeers(t *testing.T) {
+	addrs := []netip.AddrPort{
+		netip.MustParseAddrPort("10.0.0.1:6881"),
+		netip.MustParseAddrPort("[2001:db8::1]:6881"),
+		{}, // invalid, skipped
+		netip.MustParseAddrPort("[::ffff:10.0.0.2]:80"),
+	}
+	peers, peers6 := EncodePeers(addrs)
+	if !bytes.Equal(peers, []byte{10, 0, 0, 1, 0x1a, 0xe1, 10, 0, 0, 2, 0x00, 0x50}) || len(peers6) != Size6 {
+		t.Fatalf("EncodePeers() = %v, %v", peers, peers6)
+	}
+
+	decoded, err := ParsePeers(peers)
+	decoded6, err6 := ParsePeers6(peers6)
+	expected := []netip.AddrPort{addrs[0], netip.MustParseAddrPort("10.0.0.2:80")}
+	if err != nil || err6 != nil || !reflect.DeepEqual(decoded, expected) || !reflect.DeepEqual(decoded6, addrs[1:2]) {
+		t.Errorf("round trip = %v, %v (%v, %v)", decoded, decoded6, err, err6)
+	}
+}
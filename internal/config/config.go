@@ -0,0 +1,463 @@
+// Package config loads the settings of the client from a configuration file and the
+// environment.
+//
+// A Config starts from DefaultConfig, is overridden by the keys of a file read with LoadFile,
+// then by the GOBIT_* environment variables read with ApplyEnv, and converts to the
+// session.Config the session runs with. The keys are the same everywhere: "max_peers" in a
+// file is GOBIT_MAX_PEERS in the environment.
+//
+// Files are JSON objects, or flat TOML and YAML documents of "key = value" or "key: value"
+// lines, chosen by the extension of the file:
+//
+//	download_dir = "/srv/torrents"
+//	listen_ports = "6881-6889"
+//	encryption = "required"
+//
+// Only the subset of TOML and YAML needed for flat settings is understood: tables, nested
+// mappings and lists are rejected rather than guessed at.
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/diskio"
+	"github.com/lcsabi/gobit/internal/mse"
+	"github.com/lcsabi/gobit/internal/ratelimit"
+	"github.com/lcsabi/gobit/internal/session"
+	"github.com/lcsabi/gobit/internal/storage"
+)
+
+// EnvPrefix starts the names of the environment variables read by ApplyEnv.
+const EnvPrefix = "GOBIT_"
+
+// default port range, the one conventionally used by BitTorrent clients
+const (
+	DefaultFirstPort = 6881
+	DefaultLastPort  = 6889
+)
+
+// Config holds the settings of the client.
+type Config struct {
+	DownloadDir   string                // directory the content is stored in
+	ResumeDir     string                // directory the resume files are kept in, fast resume is disabled if empty
+	IncompleteDir string                // directory torrents are downloaded into until complete, DownloadDir if empty
+	PartFiles     bool                  // whether the files of incomplete torrents are named with a .part suffix
+	Allocation    storage.Allocation    // how the files of a torrent are allocated when it starts
+	ReadCacheSize int64                 // bytes of the pieces kept in memory to be sent to peers, none if zero
+	ListenPorts   PortRange             // ports tried in order to accept peers on
+	PortMapping   bool                  // whether the listening port is forwarded with UPnP or NAT-PMP
+	MaxPeers      int                   // connections per torrent
+	MaxIncoming   int                   // inbound connections across all torrents
+	MaxConnsPerIP int                   // inbound connections from one IP address
+	Encryption    mse.Policy            // whether peer connections are encrypted
+	AddressFamily session.AddressFamily // IP versions of the peers to connect to
+	UserAgent     string                // User-Agent header of tracker and web seed requests
+	Blocklist     string                // IP blocklist file of the peers not to connect to, none if empty
+	DownloadRate  int64                 // bytes per second received by all torrents, unlimited if zero
+	UploadRate    int64                 // bytes per second sent by all torrents, unlimited if zero
+	Schedule      ratelimit.Schedule    // time windows with other rates
+	SeedRatio     float64               // upload ratio to stop seeding at, never if zero
+	SeedTime      time.Duration         // seeding time to stop seeding after, never if zero
+	SeedAction    session.SeedAction    // whether a torrent reaching a seed limit stops or pauses
+}
+
+// PortRange is an inclusive range of ports, written "6881-6889", or "6881" for a single port.
+type PortRange struct {
+	First, Last uint16
+}
+
+// ParsePortRange parses a port range written "first-last" or "port".
+func ParsePortRange(s string) (PortRange, error) {
+	firstText, lastText, isRange := strings.Cut(s, "-")
+	first, err := strconv.ParseUint(strings.TrimSpace(firstText), 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range %q", s)
+	}
+	last := first
+	if isRange {
+		if last, err = strconv.ParseUint(strings.TrimSpace(lastText), 10, 16); err != nil {
+			return PortRange{}, fmt.Errorf("invalid port range %q", s)
+		}
+	}
+	return PortRange{First: uint16(first), Last: uint16(last)}, nil
+}
+
+// Len returns the number of ports in r, zero if it is empty.
+func (r PortRange) Len() int {
+	if r.Last < r.First {
+		return 0
+	}
+	return int(r.Last) - int(r.First) + 1
+}
+
+func (r PortRange) String() string {
+	if r.First == r.Last {
+		return strconv.Itoa(int(r.First))
+	}
+	return fmt.Sprintf("%d-%d", r.First, r.Last)
+}
+
+// DefaultConfig returns the settings the client uses unless configured otherwise.
+func DefaultConfig() Config {
+	return Config{
+		DownloadDir:   session.DefaultDownloadDir,
+		ResumeDir:     DefaultResumeDir(),
+		ListenPorts:   PortRange{First: DefaultFirstPort, Last: DefaultLastPort},
+		PortMapping:   true,
+		MaxPeers:      session.DefaultMaxPeers,
+		MaxIncoming:   session.DefaultMaxIncoming,
+		MaxConnsPerIP: session.DefaultMaxConnsPerIP,
+		Encryption:    mse.Preferred,
+		AddressFamily: session.AnyFamily,
+		UserAgent:     session.DefaultUserAgent,
+		ReadCacheSize: diskio.DefaultCacheBytes,
+	}
+}
+
+// DefaultResumeDir returns the directory fast resume files are kept in by default, below the
+// user's cache directory, or "" if there is none.
+func DefaultResumeDir() string {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cache, "gobit", "resume")
+}
+
+// setting is a key of the configuration, settable from its text form.
+type setting struct {
+	key string
+	set func(c *Config, value string) error
+}
+
+// settings lists the keys of the configuration in the order of the Config fields.
+var settings = []setting{
+	{"download_dir", func(c *Config, v string) error { c.DownloadDir = v; return nil }},
+	{"resume_dir", func(c *Config, v string) error { c.ResumeDir = v; return nil }},
+	{"incomplete_dir", func(c *Config, v string) error { c.IncompleteDir = v; return nil }},
+	{"part_files", func(c *Config, v string) (err error) { c.PartFiles, err = parseBool(v); return err }},
+	{"allocation", func(c *Config, v string) (err error) { c.Allocation, err = storage.ParseAllocation(v); return err }},
+	{"read_cache_size", func(c *Config, v string) (err error) { c.ReadCacheSize, err = parseSize(v); return err }},
+	{"listen_ports", func(c *Config, v string) (err error) { c.ListenPorts, err = ParsePortRange(v); return err }},
+	{"port_mapping", func(c *Config, v string) (err error) { c.PortMapping, err = parseBool(v); return err }},
+	{"max_peers", func(c *Config, v string) (err error) { c.MaxPeers, err = parseInt(v); return err }},
+	{"max_incoming", func(c *Config, v string) (err error) { c.MaxIncoming, err = parseInt(v); return err }},
+	{"max_conns_per_ip", func(c *Config, v string) (err error) { c.MaxConnsPerIP, err = parseInt(v); return err }},
+	{"encryption", func(c *Config, v string) (err error) { c.Encryption, err = mse.ParsePolicy(v); return err }},
+	{"address_family", func(c *Config, v string) (err error) {
+		c.AddressFamily, err = session.ParseAddressFamily(v)
+		return err
+	}},
+	{"user_agent", func(c *Config, v string) error { c.UserAgent = v; return nil }},
+	{"blocklist", func(c *Config, v string) error { c.Blocklist = v; return nil }},
+	{"download_rate", func(c *Config, v string) (err error) { c.DownloadRate, err = ratelimit.ParseRate(v); return err }},
+	{"upload_rate", func(c *Config, v string) (err error) { c.UploadRate, err = ratelimit.ParseRate(v); return err }},
+	{"schedule", func(c *Config, v string) (err error) { c.Schedule, err = ratelimit.ParseSchedule(v); return err }},
+	{"seed_ratio", func(c *Config, v string) (err error) { c.SeedRatio, err = parseFloat(v); return err }},
+	{"seed_time", func(c *Config, v string) (err error) { c.SeedTime, err = parseDuration(v); return err }},
+	{"seed_action", func(c *Config, v string) (err error) { c.SeedAction, err = session.ParseSeedAction(v); return err }},
+}
+
+// Set sets the setting named key from its text form.
+func (c *Config) Set(key, value string) error {
+	for _, s := range settings {
+		if s.key == key {
+			if err := s.set(c, value); err != nil {
+				return fmt.Errorf("'%s': %w", key, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown setting '%s'", key)
+}
+
+// LoadFile sets the settings found in the file at path, leaving the others unchanged.
+// The format is chosen by the extension: .json, .toml, or .yaml and .yml.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		err = c.loadJSON(data)
+	case ".toml":
+		err = c.loadLines(data, "=")
+	case ".yaml", ".yml":
+		err = c.loadLines(data, ":")
+	default:
+		err = fmt.Errorf("unsupported configuration format %q: expected .json, .toml, .yaml or .yml", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("loading %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadJSON sets the settings of a JSON object whose values are strings, numbers or booleans.
+func (c *Config) loadJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var values map[string]any
+	if err := dec.Decode(&values); err != nil {
+		return err
+	}
+	var errs []error
+	for _, s := range settings {
+		raw, ok := values[s.key]
+		if !ok {
+			continue
+		}
+		delete(values, s.key)
+		var value string
+		switch v := raw.(type) {
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = strconv.FormatBool(v)
+		default:
+			errs = append(errs, fmt.Errorf("'%s': must be a string, number or boolean", s.key))
+			continue
+		}
+		errs = append(errs, c.Set(s.key, value))
+	}
+	for key := range values {
+		errs = append(errs, fmt.Errorf("unknown setting '%s'", key))
+	}
+	return errors.Join(errs...)
+}
+
+// loadLines sets the settings of a flat document of "key<sep>value" lines, skipping blank
+// lines and # comments. Values may be quoted.
+func (c *Config) loadLines(data []byte, sep string) error {
+	var errs []error
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' || text == "---" {
+			continue
+		}
+		key, value, ok := strings.Cut(text, sep)
+		if !ok || strings.HasPrefix(text, "[") {
+			errs = append(errs, fmt.Errorf("line %d: expected key%svalue, got %q", line, sep, text))
+			continue
+		}
+		value, err := parseValue(strings.TrimSpace(value))
+		if err == nil {
+			err = c.Set(strings.TrimSpace(key), value)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %w", line, err))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// parseValue returns the text of a value in a TOML or YAML line: the content of a quoted
+// string, or the bare word up to a trailing comment.
+func parseValue(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 || !isComment(s[end+1:]) {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 || !isComment(s[end+1:]) {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1:end], nil
+	case s == "" || strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{"):
+		return "", errors.New("nested values are not supported")
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s), nil
+}
+
+// isComment reports whether s, the rest of a line after a value, is blank or a comment.
+func isComment(s string) bool {
+	s = strings.TrimSpace(s)
+	return s == "" || s[0] == '#'
+}
+
+// ApplyEnv sets the settings found in the environment, read with lookup: GOBIT_ followed by
+// the key in uppercase, such as GOBIT_DOWNLOAD_DIR.
+func (c *Config) ApplyEnv(lookup func(name string) (string, bool)) error {
+	var errs []error
+	for _, s := range settings {
+		name := EnvPrefix + strings.ToUpper(s.key)
+		if value, ok := lookup(name); ok {
+			if err := c.Set(s.key, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the settings, returning an error naming every invalid one.
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(key, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("invalid '%s': %s", key, fmt.Sprintf(format, args...)))
+	}
+
+	if c.DownloadDir == "" {
+		invalid("download_dir", "must not be empty")
+	}
+	if c.ListenPorts.First == 0 {
+		invalid("listen_ports", "port 0 is not allowed, got %s", c.ListenPorts)
+	} else if c.ListenPorts.Len() == 0 {
+		invalid("listen_ports", "first port must not exceed the last, got %s", c.ListenPorts)
+	}
+	for _, limit := range []struct {
+		key   string
+		value int
+	}{
+		{"max_peers", c.MaxPeers},
+		{"max_incoming", c.MaxIncoming},
+		{"max_conns_per_ip", c.MaxConnsPerIP},
+	} {
+		if limit.value <= 0 {
+			invalid(limit.key, "must be positive, got %d", limit.value)
+		}
+	}
+	if c.Encryption < mse.Disabled || c.Encryption > mse.Required {
+		invalid("encryption", "unknown policy %d", int(c.Encryption))
+	}
+	if c.Allocation < storage.AllocateNone || c.Allocation > storage.AllocateFull {
+		invalid("allocation", "unknown allocation %d", int(c.Allocation))
+	}
+	if c.AddressFamily < session.AnyFamily || c.AddressFamily > session.IPv6Only {
+		invalid("address_family", "unknown family %d", int(c.AddressFamily))
+	}
+	if c.ReadCacheSize < 0 {
+		invalid("read_cache_size", "must not be negative, got %d", c.ReadCacheSize)
+	}
+	if c.SeedRatio < 0 {
+		invalid("seed_ratio", "must not be negative, got %g", c.SeedRatio)
+	}
+	if c.SeedTime < 0 {
+		invalid("seed_time", "must not be negative, got %s", c.SeedTime)
+	}
+	if c.SeedAction < session.SeedStop || c.SeedAction > session.SeedPause {
+		invalid("seed_action", "unknown action %d", int(c.SeedAction))
+	}
+	if c.DownloadRate < 0 {
+		invalid("download_rate", "must not be negative, got %d", c.DownloadRate)
+	}
+	if c.UploadRate < 0 {
+		invalid("upload_rate", "must not be negative, got %d", c.UploadRate)
+	}
+	if strings.ContainsAny(c.UserAgent, "\r\n") {
+		invalid("user_agent", "must be a single line")
+	}
+	return errors.Join(errs...)
+}
+
+// Session returns the session configuration using the settings of c. Port mapping and the
+// blocklist are left to the caller, which chooses the mappers when PortMapping is set and
+// loads the Blocklist file.
+func (c *Config) Session() session.Config {
+	return session.Config{
+		DownloadDir:   c.DownloadDir,
+		ResumeDir:     c.ResumeDir,
+		IncompleteDir: c.IncompleteDir,
+		PartFiles:     c.PartFiles,
+		Allocation:    c.Allocation,
+		ListenAddr:    fmt.Sprintf(":%d", c.ListenPorts.First),
+		ListenPorts:   c.ListenPorts.Len(),
+		MaxIncoming:   c.MaxIncoming,
+		MaxConnsPerIP: c.MaxConnsPerIP,
+		AddressFamily: c.AddressFamily,
+		MaxPeers:      c.MaxPeers,
+		Encryption:    c.Encryption,
+		UserAgent:     c.UserAgent,
+		DownloadRate:  c.DownloadRate,
+		UploadRate:    c.UploadRate,
+		Schedule:      c.Schedule,
+		SeedLimits:    session.SeedLimits{Ratio: c.SeedRatio, Time: c.SeedTime, Action: c.SeedAction},
+
+		ReadCacheBytes: c.ReadCacheSize,
+	}
+}
+
+// parseInt parses a decimal integer.
+func parseInt(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid integer %q", s)
+	}
+	return n, nil
+}
+
+// parseFloat parses a decimal number.
+func parseFloat(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return f, nil
+}
+
+// parseSize parses a size in bytes: a number with an optional binary unit, such as "64MiB",
+// "512K" or "1048576".
+func parseSize(s string) (int64, error) {
+	text := strings.TrimSpace(s)
+	number := strings.TrimRight(text, "BbiKkMmGg")
+	var shift uint
+	switch strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(text[len(number):], "B"), "i")) {
+	case "":
+	case "K":
+		shift = 10
+	case "M":
+		shift = 20
+	case "G":
+		shift = 30
+	default:
+		return 0, fmt.Errorf("unknown unit in size %q", s)
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(number), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n << shift, nil
+}
+
+// parseDuration parses a duration such as "36h" or "90m".
+func parseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: expected a number with a unit, such as 36h", s)
+	}
+	return d, nil
+}
+
+// parseBool parses true or false, in any case.
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(s) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q: must be true or false", s)
+}
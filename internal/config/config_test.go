@@ -0,0 +1,209 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/mse"
+	"github.com/lcsabi/gobit/internal/session"
+)
+
+// TestDefaultConfig checks that the defaults are valid and match the session defaults.
+func TestDefaultConfig(t *testing.T) {
+	c := DefaultConfig()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("Validate() returned error: %v", err)
+	}
+	cfg := c.Session()
+	if cfg.ListenAddr != ":6881" || cfg.ListenPorts != 9 {
+		t.Errorf("Session() listens on %q over %d ports, want \":6881\" over 9", cfg.ListenAddr, cfg.ListenPorts)
+	}
+	if cfg.MaxPeers != session.DefaultMaxPeers || cfg.UserAgent != session.DefaultUserAgent {
+		t.Errorf("Session() = %+v, want the session defaults", cfg)
+	}
+}
+
+// TestParsePortRange covers single ports, ranges and malformed input.
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    PortRange
+		wantErr bool
+	}{
+		{"6881", PortRange{6881, 6881}, false},
+		{"6881-6889", PortRange{6881, 6889}, false},
+		{" 6881 - 6882 ", PortRange{6881, 6882}, false},
+		{"", PortRange{}, true},
+		{"abc", PortRange{}, true},
+		{"6881-", PortRange{}, true},
+		{"70000", PortRange{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParsePortRange(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParsePortRange(%q) = %v, %v; want %v, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+// TestLoadFile loads the same settings from each supported format.
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"gobit.json": `{
+	"download_dir": "/srv/torrents",
+	"listen_ports": "7000-7001",
+	"port_mapping": false,
+	"max_peers": 50,
+	"encryption": "required"
+}`,
+		"gobit.toml": `# gobit settings
+download_dir = "/srv/torrents"
+listen_ports = '7000-7001'
+port_mapping = false # behind a static forward
+max_peers = 50
+encryption = "required"
+`,
+		"gobit.yaml": `---
+download_dir: /srv/torrents
+listen_ports: "7000-7001"
+port_mapping: false
+max_peers: 50 # per torrent
+encryption: required
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			c := DefaultConfig()
+			if err := c.LoadFile(path); err != nil {
+				t.Fatalf("LoadFile() returned error: %v", err)
+			}
+			want := DefaultConfig()
+			want.DownloadDir = "/srv/torrents"
+			want.ListenPorts = PortRange{7000, 7001}
+			want.PortMapping = false
+			want.MaxPeers = 50
+			want.Encryption = mse.Required
+			if !reflect.DeepEqual(c, want) {
+				t.Errorf("LoadFile() = %+v, want %+v", c, want)
+			}
+		})
+	}
+}
+
+// TestLoadFileErrors checks that malformed files are rejected with errors naming the setting
+// or line at fault.
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"unknown.toml", "max_peer = 5\n", "unknown setting 'max_peer'"},
+		{"value.toml", "\nmax_peers = many\n", "line 2: 'max_peers': invalid integer"},
+		{"table.toml", "[session]\n", "line 1: expected key=value"},
+		{"list.yaml", "listen_ports: [6881, 6882]\n", "nested values are not supported"},
+		{"quote.toml", "user_agent = \"gobit\n", "unterminated string"},
+		{"type.json", `{"max_peers": [1]}`, "'max_peers': must be a string, number or boolean"},
+		{"unknown.json", `{"dht": true}`, "unknown setting 'dht'"},
+		{"allocation.yaml", "allocation: compact\n", "'allocation': unknown allocation"},
+		{"family.json", `{"address_family": "ipv5"}`, "'address_family': unknown address family"},
+		{"rate.toml", "upload_rate = fast\n", "'upload_rate': invalid rate"},
+		{"schedule.yaml", "schedule: 09:00-17:00\n", "'schedule': rule 1: missing rates"},
+		{"ratio.json", `{"seed_ratio": "lots"}`, "'seed_ratio': invalid number"},
+		{"seed.toml", "seed_time = 2 days\n", "'seed_time': invalid duration"},
+		{"cache.yaml", "read_cache_size: 64 megs\n", "'read_cache_size': invalid size"},
+		{"config.ini", "max_peers=5", "unsupported configuration format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			c := DefaultConfig()
+			err := c.LoadFile(path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadFile() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestApplyEnv checks that environment variables override the settings they name.
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"GOBIT_MAX_CONNS_PER_IP": "5",
+		"GOBIT_ADDRESS_FAMILY":   "ipv4",
+		"GOBIT_USER_AGENT":       "test/1.0",
+		"GOBIT_DOWNLOAD_RATE":    "1MiB/s",
+		"GOBIT_SCHEDULE":         "23:00-07:00 down=unlimited",
+		"GOBIT_SEED_TIME":        "36h",
+		"GOBIT_SEED_ACTION":      "pause",
+		"GOBIT_INCOMPLETE_DIR":   "/srv/incomplete",
+		"GOBIT_PART_FILES":       "true",
+		"MAX_PEERS":              "1", // missing prefix, ignored
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	c := DefaultConfig()
+	if err := c.ApplyEnv(lookup); err != nil {
+		t.Fatalf("ApplyEnv() returned error: %v", err)
+	}
+	if c.MaxConnsPerIP != 5 || c.AddressFamily != session.IPv4Only || c.UserAgent != "test/1.0" {
+		t.Errorf("ApplyEnv() = %+v", c)
+	}
+	if c.DownloadRate != 1<<20 || len(c.Schedule) != 1 || c.Session().Schedule.String() != "daily 23:00-07:00 down=unlimited" {
+		t.Errorf("ApplyEnv() set rates %d and schedule %q", c.DownloadRate, c.Schedule)
+	}
+	if cfg := c.Session(); cfg.IncompleteDir != "/srv/incomplete" || !cfg.PartFiles {
+		t.Errorf("ApplyEnv() set incomplete directory %q, part files %v", cfg.IncompleteDir, cfg.PartFiles)
+	}
+	if limits := c.Session().SeedLimits; limits != (session.SeedLimits{Time: 36 * time.Hour, Action: session.SeedPause}) {
+		t.Errorf("ApplyEnv() set seed limits %+v", limits)
+	}
+	if c.MaxPeers != session.DefaultMaxPeers {
+		t.Errorf("MaxPeers = %d, want the default %d", c.MaxPeers, session.DefaultMaxPeers)
+	}
+
+	env = map[string]string{"GOBIT_PORT_MAPPING": "yes"}
+	err := c.ApplyEnv(lookup)
+	if err == nil || !strings.Contains(err.Error(), "GOBIT_PORT_MAPPING: 'port_mapping'") {
+		t.Errorf("ApplyEnv() error = %v, want one naming the variable", err)
+	}
+}
+
+// TestValidate checks that every invalid setting is reported by its key.
+func TestValidate(t *testing.T) {
+	c := DefaultConfig()
+	c.DownloadDir = ""
+	c.ListenPorts = PortRange{6889, 6881}
+	c.MaxPeers = 0
+	c.MaxIncoming = -1
+	c.Encryption = mse.Policy(7)
+	c.UserAgent = "a\nb"
+	c.SeedRatio = -1
+	c.ReadCacheSize = -1
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("Validate() returned no error")
+	}
+	for _, key := range []string{"download_dir", "listen_ports", "max_peers", "max_incoming", "encryption", "user_agent", "seed_ratio", "read_cache_size"} {
+		if !strings.Contains(err.Error(), "invalid '"+key+"'") {
+			t.Errorf("Validate() error %q does not name '%s'", err, key)
+		}
+	}
+	if strings.Contains(err.Error(), "max_conns_per_ip") {
+		t.Errorf("Validate() error %q names the valid 'max_conns_per_ip'", err)
+	}
+}
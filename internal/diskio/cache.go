@@ -0,0 +1,126 @@
+package diskio
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultCacheBytes is the read cache size of the client unless configured otherwise.
+const DefaultCacheBytes = 32 << 20
+
+// Reader is what a ReadCache reads pieces from, such as a *storage.Storage.
+type Reader interface {
+	ReadBlock(index int, begin int64, p []byte) error
+}
+
+// CacheStats is a snapshot of the activity of a ReadCache.
+type CacheStats struct {
+	Hits   int64 // blocks read from the cache
+	Misses int64 // blocks read from disk
+	Pieces int   // pieces cached
+	Bytes  int64 // bytes of the pieces cached
+}
+
+// cacheKey identifies a cached piece: the piece at index of r.
+type cacheKey struct {
+	r     Reader
+	index int
+}
+
+// cachedPiece is the content of a cached piece.
+type cachedPiece struct {
+	key  cacheKey
+	data []byte
+}
+
+// ReadCache is a cache of whole pieces read from disk, evicting the least recently used ones
+// to stay within its size, so the blocks of a piece requested by many peers are read once.
+// The pieces must not change on disk while cached: only verified pieces should be read through
+// it. Its methods are safe for concurrent use.
+type ReadCache struct {
+	maxBytes int64
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element // piece to element of order
+	order   *list.List                 // cached pieces, most recently used at the front
+	stats   CacheStats
+}
+
+// NewReadCache returns an empty ReadCache holding at most maxBytes of pieces. A maxBytes of
+// zero or less disables caching: every block is read from disk.
+func NewReadCache(maxBytes int64) *ReadCache {
+	return &ReadCache{
+		maxBytes: max(maxBytes, 0),
+		entries:  make(map[cacheKey]*list.Element),
+		order:    list.New(),
+	}
+}
+
+// ReadBlock fills p with the content at offset begin within the piece at index of r, whose
+// size is pieceSize. The piece is read whole and cached on a miss, unless it is larger than the
+// cache, in which case only the block is read.
+func (c *ReadCache) ReadBlock(r Reader, index int, pieceSize, begin int64, p []byte) error {
+	if begin < 0 || begin+int64(len(p)) > pieceSize {
+		return r.ReadBlock(index, begin, p) // reports the block out of range
+	}
+	key := cacheKey{r, index}
+	c.mu.Lock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		c.stats.Hits++
+		copy(p, elem.Value.(*cachedPiece).data[begin:])
+		c.mu.Unlock()
+		return nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	if pieceSize > c.maxBytes {
+		return r.ReadBlock(index, begin, p)
+	}
+	data := make([]byte, pieceSize)
+	if err := r.ReadBlock(index, 0, data); err != nil {
+		return err
+	}
+	copy(p, data[begin:])
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; ok {
+		return nil // cached by a concurrent miss
+	}
+	c.entries[key] = c.order.PushFront(&cachedPiece{key, data})
+	c.stats.Pieces++
+	c.stats.Bytes += pieceSize
+	for c.stats.Bytes > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Drop removes the pieces of r from the cache, such as when its files are closed.
+func (c *ReadCache) Drop(r Reader) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key, elem := range c.entries {
+		if key.r == r {
+			c.remove(elem)
+		}
+	}
+}
+
+// remove evicts the piece of elem. c.mu must be held.
+func (c *ReadCache) remove(elem *list.Element) {
+	piece := elem.Value.(*cachedPiece)
+	c.order.Remove(elem)
+	delete(c.entries, piece.key)
+	c.stats.Pieces--
+	c.stats.Bytes -= int64(len(piece.data))
+}
+
+// Stats returns the current activity of the cache.
+func (c *ReadCache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
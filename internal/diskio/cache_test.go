@@ -0,0 +1,78 @@
+package diskio
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// pieces is a Reader of pieces of 4 bytes holding their index, counting its reads.
+type pieces struct {
+	reads int
+}
+
+func (p *pieces) ReadBlock(index int, begin int64, data []byte) error {
+	p.reads++
+	if begin < 0 || begin+int64(len(data)) > 4 {
+		return fmt.Errorf("block out of range")
+	}
+	for i := range data {
+		data[i] = byte(index)
+	}
+	return nil
+}
+
+// TestReadCache reads blocks through a cache holding two pieces, checking the hits, misses and
+// least recently used evictions.
+func TestReadCache(t *testing.T) {
+	r := &pieces{}
+	c := NewReadCache(8)
+	for _, step := range []struct {
+		index int
+		reads int // reads of r once the block is read
+	}{
+		{0, 1}, // miss
+		{0, 1}, // hit
+		{1, 2}, // miss
+		{0, 2}, // hit, 1 becomes the least recently used
+		{2, 3}, // miss evicting 1
+		{0, 3}, // hit
+		{1, 4}, // miss evicting 2
+	} {
+		block := make([]byte, 2)
+		if err := c.ReadBlock(r, step.index, 4, 2, block); err != nil {
+			t.Fatalf("ReadBlock(%d) returned error: %v", step.index, err)
+		}
+		if !slices.Equal(block, []byte{byte(step.index), byte(step.index)}) {
+			t.Errorf("ReadBlock(%d) read %v", step.index, block)
+		}
+		if r.reads != step.reads {
+			t.Errorf("ReadBlock(%d) made %d reads in total, want %d", step.index, r.reads, step.reads)
+		}
+	}
+	if s := c.Stats(); s != (CacheStats{Hits: 3, Misses: 4, Pieces: 2, Bytes: 8}) {
+		t.Errorf("Stats() = %+v", s)
+	}
+
+	c.Drop(r)
+	if s := c.Stats(); s.Pieces != 0 || s.Bytes != 0 {
+		t.Errorf("Stats() = %+v after Drop()", s)
+	}
+	if err := c.ReadBlock(r, 0, 4, 3, make([]byte, 2)); err == nil {
+		t.Error("ReadBlock() past the end of the piece returned no error")
+	}
+}
+
+// TestReadCacheDisabled checks that a cache without memory reads every block from disk.
+func TestReadCacheDisabled(t *testing.T) {
+	r := &pieces{}
+	c := NewReadCache(0)
+	for range 3 {
+		if err := c.ReadBlock(r, 0, 4, 0, make([]byte, 4)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := c.Stats(); r.reads != 3 || s.Misses != 3 || s.Pieces != 0 {
+		t.Errorf("%d reads, Stats() = %+v; want 3 misses read from disk", r.reads, s)
+	}
+}
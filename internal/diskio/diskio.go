@@ -0,0 +1,221 @@
+// Package diskio writes the blocks received by a session to disk in the background, so a
+// slow disk does not hold up the peer connections, and caches the pieces it serves.
+//
+// A Queue hands the writes to a pool of workers. The blocks of a piece waiting in the queue
+// are written together, adjacent ones merged into a single write, and the memory held by the
+// blocks not yet written is bounded: Write waits while the queue is full, which slows the
+// peers sending the blocks down instead of buffering without limit.
+//
+// A ReadCache keeps the pieces recently read whole in memory, so seeding a piece to many peers
+// reads it from disk once.
+package diskio
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+// defaults for the zero values of Options
+const (
+	DefaultWorkers  = 4
+	DefaultMaxBytes = 64 << 20
+)
+
+// ErrClosed is returned by Write once the Queue is closed.
+var ErrClosed = errors.New("disk queue closed")
+
+// Options configure a Queue.
+type Options struct {
+	Workers  int   // goroutines writing to disk, DefaultWorkers if zero
+	MaxBytes int64 // bytes of the blocks queued or being written at once, DefaultMaxBytes if zero
+}
+
+// Writer is where a Queue writes blocks, such as a *storage.Storage.
+type Writer interface {
+	WriteBlock(index int, begin int64, data []byte) error
+}
+
+// Stats is a snapshot of the activity of a Queue.
+type Stats struct {
+	Queued      int   // blocks waiting for a worker
+	QueuedBytes int64 // bytes of the blocks queued or being written
+	Written     int64 // blocks written or failed to be written
+	Writes      int64 // writes made, fewer than Written when adjacent blocks are merged
+}
+
+// write is a block waiting to be written.
+type write struct {
+	begin int64
+	data  []byte
+	done  func(error)
+}
+
+// piece identifies the blocks written together: those of a piece of a Writer.
+type piece struct {
+	w     Writer
+	index int
+}
+
+// Queue writes blocks with a pool of workers. Its methods are safe for concurrent use.
+type Queue struct {
+	maxBytes int64
+	wg       sync.WaitGroup // workers
+
+	mu      sync.Mutex
+	work    sync.Cond // signalled when blocks are queued or the queue is closed
+	space   sync.Cond // broadcast when bytes are written or the queue is closed
+	pending map[piece][]write
+	order   []piece // pieces with queued blocks, oldest first
+	closed  bool
+	stats   Stats
+}
+
+// NewQueue returns a Queue whose workers run until Close.
+func NewQueue(opts Options) *Queue {
+	if opts.Workers <= 0 {
+		opts.Workers = DefaultWorkers
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultMaxBytes
+	}
+	q := &Queue{maxBytes: opts.MaxBytes, pending: make(map[piece][]write)}
+	q.work.L = &q.mu
+	q.space.L = &q.mu
+	q.wg.Add(opts.Workers)
+	for range opts.Workers {
+		go q.worker()
+	}
+	return q
+}
+
+// Write queues data to be written at offset begin within the piece at index of w, and calls
+// done with the result once it is written. It waits while the queue is full, and returns
+// the context's error if ctx is cancelled first, or ErrClosed once the queue is closed, in
+// which cases done is never called. The Queue holds on to data until then.
+func (q *Queue) Write(ctx context.Context, w Writer, index int, begin int64, data []byte, done func(error)) error {
+	size := int64(len(data))
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.full(size) {
+		stop := context.AfterFunc(ctx, func() {
+			q.mu.Lock()
+			q.space.Broadcast()
+			q.mu.Unlock()
+		})
+		defer stop()
+		for q.full(size) && ctx.Err() == nil && !q.closed {
+			q.space.Wait()
+		}
+	}
+	if q.closed {
+		return ErrClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p := piece{w, index}
+	if _, ok := q.pending[p]; !ok {
+		q.order = append(q.order, p)
+	}
+	q.pending[p] = append(q.pending[p], write{begin: begin, data: data, done: done})
+	q.stats.Queued++
+	q.stats.QueuedBytes += size
+	q.work.Signal()
+	return nil
+}
+
+// full reports whether size more bytes exceed the memory bound. A block is let through on its
+// own whatever its size. q.mu must be held.
+func (q *Queue) full(size int64) bool {
+	return q.stats.QueuedBytes > 0 && q.stats.QueuedBytes+size > q.maxBytes
+}
+
+// Stats returns the current activity of the queue.
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stats
+}
+
+// Close writes the blocks still queued, then stops the workers. Write fails once Close is
+// called.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.work.Broadcast()
+	q.space.Broadcast()
+	q.mu.Unlock()
+	q.wg.Wait()
+}
+
+// worker writes the queued blocks of one piece at a time until the queue is closed and empty.
+func (q *Queue) worker() {
+	defer q.wg.Done()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for {
+		for len(q.order) == 0 && !q.closed {
+			q.work.Wait()
+		}
+		if len(q.order) == 0 {
+			return
+		}
+		p := q.order[0]
+		q.order = q.order[1:]
+		writes := q.pending[p]
+		delete(q.pending, p)
+		q.stats.Queued -= len(writes)
+
+		q.mu.Unlock()
+		results, calls := writeRuns(p, writes)
+		q.mu.Lock()
+
+		for _, w := range writes {
+			q.stats.QueuedBytes -= int64(len(w.data))
+		}
+		q.stats.Written += int64(len(writes))
+		q.stats.Writes += int64(calls)
+		q.space.Broadcast()
+
+		q.mu.Unlock()
+		for i, w := range writes {
+			if w.done != nil {
+				w.done(results[i])
+			}
+		}
+		q.mu.Lock()
+	}
+}
+
+// writeRuns writes the blocks of p, merging each run of adjacent blocks into a single write.
+// It sorts writes by offset and returns the result of each and the number of writes made.
+func writeRuns(p piece, writes []write) (results []error, calls int) {
+	slices.SortFunc(writes, func(a, b write) int { return int(a.begin - b.begin) })
+	results = make([]error, len(writes))
+	for start := 0; start < len(writes); {
+		end := start + 1
+		size := len(writes[start].data)
+		for end < len(writes) && writes[end].begin == writes[start].begin+int64(size) {
+			size += len(writes[end].data)
+			end++
+		}
+
+		data := writes[start].data
+		if end-start > 1 {
+			data = make([]byte, 0, size)
+			for _, w := range writes[start:end] {
+				data = append(data, w.data...)
+			}
+		}
+		err := p.w.WriteBlock(p.index, writes[start].begin, data)
+		calls++
+		for i := start; i < end; i++ {
+			results[i] = err
+		}
+		start = end
+	}
+	return results, calls
+}
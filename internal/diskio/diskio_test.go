@@ -0,0 +1,170 @@
+package diskio
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a Writer recording its writes, blocking each until release is closed.
+type recorder struct {
+	release chan struct{}
+	err     error
+
+	mu     sync.Mutex
+	writes []recorded
+}
+
+type recorded struct {
+	index int
+	begin int64
+	data  []byte
+}
+
+func newRecorder() *recorder {
+	return &recorder{release: make(chan struct{})}
+}
+
+func (r *recorder) WriteBlock(index int, begin int64, data []byte) error {
+	<-r.release
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.writes = append(r.writes, recorded{index, begin, slices.Clone(data)})
+	return r.err
+}
+
+func (r *recorder) recorded() []recorded {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.writes)
+}
+
+// queue returns a Queue with a single worker, closed at the end of the test.
+func queue(t *testing.T, maxBytes int64) *Queue {
+	t.Helper()
+	q := NewQueue(Options{Workers: 1, MaxBytes: maxBytes})
+	t.Cleanup(q.Close)
+	return q
+}
+
+// TestCoalesce queues blocks of a piece while the worker is busy, and checks that adjacent
+// blocks are merged into a single write in offset order while a gap splits them.
+func TestCoalesce(t *testing.T) {
+	busy, r := newRecorder(), newRecorder()
+	q := queue(t, 0)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	done := func(err error) {
+		if err != nil {
+			t.Errorf("write returned error: %v", err)
+		}
+		wg.Done()
+	}
+	wg.Add(1)
+	if err := q.Write(ctx, busy, 0, 0, []byte{0}, done); err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range []struct {
+		begin int64
+		data  []byte
+	}{{4, []byte{4, 5}}, {0, []byte{0, 1}}, {2, []byte{2, 3}}, {10, []byte{10}}} {
+		wg.Add(1)
+		if err := q.Write(ctx, r, 1, b.begin, b.data, done); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s := q.Stats(); s.Queued < 4 || s.QueuedBytes != 8 {
+		t.Errorf("Stats() = %+v while busy, want at least 4 blocks and 8 bytes queued", s)
+	}
+
+	close(busy.release)
+	close(r.release)
+	wg.Wait()
+	want := []recorded{{1, 0, []byte{0, 1, 2, 3, 4, 5}}, {1, 10, []byte{10}}}
+	got := r.recorded()
+	if len(got) != len(want) {
+		t.Fatalf("writes = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].index != want[i].index || got[i].begin != want[i].begin || !slices.Equal(got[i].data, want[i].data) {
+			t.Errorf("write %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if s := q.Stats(); s != (Stats{Written: 5, Writes: 3}) {
+		t.Errorf("Stats() = %+v after the writes", s)
+	}
+}
+
+// TestMaxBytes checks that Write waits while the queue holds MaxBytes, until a write frees
+// space or its context is cancelled.
+func TestMaxBytes(t *testing.T) {
+	r := newRecorder()
+	q := queue(t, 4)
+	ctx := context.Background()
+	if err := q.Write(ctx, r, 0, 0, make([]byte, 3), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cancelled, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := q.Write(cancelled, r, 0, 3, make([]byte, 2), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Write() on a full queue returned %v, want the context's error", err)
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		written <- q.Write(ctx, r, 0, 3, make([]byte, 2), nil)
+	}()
+	select {
+	case err := <-written:
+		t.Fatalf("Write() on a full queue returned %v without waiting", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(r.release)
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Errorf("Write() returned %v once space was freed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write() still waiting once space was freed")
+	}
+}
+
+// TestClose checks that Close writes the blocks still queued and that Write then fails, and
+// that write errors reach the callbacks.
+func TestClose(t *testing.T) {
+	r := newRecorder()
+	r.err = errors.New("disk full")
+	close(r.release)
+	q := NewQueue(Options{})
+
+	var results []error
+	var mu sync.Mutex
+	for i := range 3 {
+		err := q.Write(context.Background(), r, i, 0, []byte{byte(i)}, func(err error) {
+			mu.Lock()
+			results = append(results, err)
+			mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	q.Close()
+	if len(results) != 3 {
+		t.Fatalf("%d callbacks after Close(), want 3", len(results))
+	}
+	for _, err := range results {
+		if err != r.err {
+			t.Errorf("callback got %v, want %v", err, r.err)
+		}
+	}
+	if err := q.Write(context.Background(), r, 0, 0, []byte{0}, nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Write() after Close() returned %v, want ErrClosed", err)
+	}
+}
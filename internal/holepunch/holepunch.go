@@ -0,0 +1,134 @@
+// Package holepunch implements the holepunch extension of BEP 55 (ut_holepunch), which lets two
+// peers behind NATs connect to each other through a peer both are connected to.
+//
+// The initiator, unable to connect to the target, sends a rendezvous message naming the target
+// to the relay. The relay forwards a connect message to each side naming the other, and both
+// then connect at the same time, which NATs let through as replies to their own traffic. The
+// relay answers with an error message when it cannot help.
+//
+// Messages are sent over the extension protocol of BEP 10 in a fixed binary layout rather than
+// bencoded: the message type, the address type, the address and port of the peer concerned, and
+// a 4-byte error code, zero unless the message is an error.
+//
+// Reference: https://bittorrent.org/beps/bep_0055.html
+package holepunch
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net/netip"
+
+	"github.com/lcsabi/gobit/internal/peer"
+)
+
+// ExtensionName is the name of the holepunch extension in extension handshakes.
+const ExtensionName = "ut_holepunch"
+
+// LocalID is the extended message ID we ask peers to send ut_holepunch messages with.
+const LocalID = 3
+
+// Type is the type of a holepunch message.
+type Type byte
+
+// message types
+const (
+	Rendezvous Type = 0 // to the relay: connect me to Addr
+	Connect    Type = 1 // from the relay: connect to Addr, which is connecting to you
+	Error      Type = 2 // from the relay: the rendezvous for Addr failed with Err
+)
+
+func (t Type) String() string {
+	switch t {
+	case Rendezvous:
+		return "rendezvous"
+	case Connect:
+		return "connect"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("type %d", byte(t))
+}
+
+// ErrorCode is why a relay could not forward a rendezvous.
+type ErrorCode uint32
+
+// error codes
+const (
+	NoSuchPeer   ErrorCode = 1 // the target address is invalid
+	NotConnected ErrorCode = 2 // the relay is not connected to the target
+	NoSupport    ErrorCode = 3 // the target does not support the holepunch extension
+	NoSelf       ErrorCode = 4 // the target is the relay itself
+)
+
+func (c ErrorCode) String() string {
+	switch c {
+	case NoSuchPeer:
+		return "no such peer"
+	case NotConnected:
+		return "not connected"
+	case NoSupport:
+		return "no support"
+	case NoSelf:
+		return "no self"
+	}
+	return fmt.Sprintf("error %d", uint32(c))
+}
+
+// address types
+const (
+	addrIPv4 = 0
+	addrIPv6 = 1
+)
+
+// Message is the content of a holepunch message.
+type Message struct {
+	Type Type
+	Addr netip.AddrPort // the target of a rendezvous or error, the peer to connect to otherwise
+	Err  ErrorCode      // zero unless Type is Error
+}
+
+// Parse decodes the payload of a ut_holepunch message.
+func Parse(data []byte) (Message, error) {
+	if len(data) < 2 {
+		return Message{}, fmt.Errorf("%s message of %d bytes is too short", ExtensionName, len(data))
+	}
+	var size int
+	switch data[1] {
+	case addrIPv4:
+		size = 4
+	case addrIPv6:
+		size = 16
+	default:
+		return Message{}, fmt.Errorf("%s message has unknown address type %d", ExtensionName, data[1])
+	}
+	if len(data) != 2+size+2+4 {
+		return Message{}, fmt.Errorf("%s message of %d bytes, expected %d", ExtensionName, len(data), 2+size+2+4)
+	}
+
+	m := Message{Type: Type(data[0])}
+	if m.Type > Error {
+		return Message{}, fmt.Errorf("%s message has unknown %s", ExtensionName, m.Type)
+	}
+	addr, _ := netip.AddrFromSlice(data[2 : 2+size])
+	m.Addr = netip.AddrPortFrom(addr.Unmap(), binary.BigEndian.Uint16(data[2+size:]))
+	m.Err = ErrorCode(binary.BigEndian.Uint32(data[2+size+2:]))
+	return m, nil
+}
+
+// Encode returns the payload of m.
+func (m Message) Encode() []byte {
+	addr := m.Addr.Addr().Unmap()
+	addrType := byte(addrIPv4)
+	if !addr.Is4() {
+		addrType = addrIPv6
+	}
+	data := append([]byte{byte(m.Type), addrType}, addr.AsSlice()...)
+	data = binary.BigEndian.AppendUint16(data, m.Addr.Port())
+	return binary.BigEndian.AppendUint32(data, uint32(m.Err))
+}
+
+// NewMessage returns the extended message carrying m, sent with the peer's ut_holepunch
+// extended message ID.
+func NewMessage(id uint8, m Message) *peer.Message {
+	return peer.NewExtended(id, m.Encode())
+}
@@ -0,0 +1,63 @@
+package holepunch
+
+import (
+	"net/netip"
+	"testing"
+)
+
+// TestEncode checks the binary layout of a rendezvous and an error message.
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		message  Message
+		expected string
+	}{
+		{Message{Type: Rendezvous, Addr: netip.MustParseAddrPort("1.2.3.4:6881")},
+			"\x00\x00\x01\x02\x03\x04\x1a\xe1\x00\x00\x00\x00"},
+		{Message{Type: Error, Addr: netip.MustParseAddrPort("[2001:db8::1]:80"), Err: NoSupport},
+			"\x02\x01\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x50\x00\x00\x00\x03"},
+		{Message{Type: Connect, Addr: netip.MustParseAddrPort("[::ffff:1.2.3.4]:1")},
+			"\x01\x00\x01\x02\x03\x04\x00\x01\x00\x00\x00\x00"},
+	}
+	for _, tc := range tests {
+		if got := string(tc.message.Encode()); got != tc.expected {
+			t.Errorf("Encode(%+v) = %q, want %q", tc.message, got, tc.expected)
+		}
+	}
+}
+
+// TestRoundTrip encodes messages of each type and family and parses them back.
+func TestRoundTrip(t *testing.T) {
+	for _, m := range []Message{
+		{Type: Rendezvous, Addr: netip.MustParseAddrPort("10.0.0.1:6881")},
+		{Type: Connect, Addr: netip.MustParseAddrPort("[2001:db8::2]:51413")},
+		{Type: Error, Addr: netip.MustParseAddrPort("10.0.0.2:1"), Err: NotConnected},
+	} {
+		id, payload, err := NewMessage(7, m).ParseExtended()
+		if err != nil || id != 7 {
+			t.Fatalf("ParseExtended() = %d, %v, want ID 7", id, err)
+		}
+		got, err := Parse(payload)
+		if err != nil {
+			t.Fatalf("Parse() returned error: %v", err)
+		}
+		if got != m {
+			t.Errorf("Parse() = %+v, want %+v", got, m)
+		}
+	}
+}
+
+// TestParseErrors checks that malformed payloads are rejected.
+func TestParseErrors(t *testing.T) {
+	for _, payload := range []string{
+		"",
+		"\x00",
+		"\x00\x02\x01\x02\x03\x04\x1a\xe1\x00\x00\x00\x00", // unknown address type
+		"\x03\x00\x01\x02\x03\x04\x1a\xe1\x00\x00\x00\x00", // unknown message type
+		"\x00\x00\x01\x02\x03\x04\x1a\xe1\x00\x00\x00",     // truncated error code
+		"\x00\x01\x01\x02\x03\x04\x1a\xe1\x00\x00\x00\x00", // IPv6 type with an IPv4 address
+	} {
+		if _, err := Parse([]byte(payload)); err == nil {
+			t.Errorf("Parse(%q): expected error, got nil", payload)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package infohash provides the info hash types identifying torrents: the 20-byte SHA-1 hash
+// of BitTorrent v1 and the 32-byte SHA-256 hash of v2, with the text forms they take in magnet
+// links, tracker requests and on the command line.
+//
+// Both types are byte arrays, so values of [20]byte and [32]byte, such as those returned by
+// sha1.Sum and sha256.Sum256, can be assigned to them directly.
+//
+// References:
+//   - https://bittorrent.org/beps/bep_0003.html
+//   - https://bittorrent.org/beps/bep_0009.html#magnet-uri-format
+//   - https://bittorrent.org/beps/bep_0052.html
+package infohash
+
+import (
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// sizes of the info hashes in bytes
+const (
+	Size   = 20
+	SizeV2 = 32
+)
+
+// SHA256Multihash is the multihash prefix of a SHA-256 digest: function code 0x12, length 0x20.
+// v2 info hashes appear in this form in magnet links.
+const SHA256Multihash = "1220"
+
+// V1 is the SHA-1 info hash of v1 and hybrid torrents, which also identifies v2 swarms in
+// their truncated form, see V2.Truncate.
+type V1 [Size]byte
+
+// V2 is the SHA-256 info hash of v2 and hybrid torrents.
+type V2 [SizeV2]byte
+
+// Parse parses a v1 info hash given as 40 hex digits, or as 32 base32 characters as in older
+// magnet links, both case-insensitive. These are the forms users type, so any other string is
+// rejected, even one that happens to be 20 bytes long: see ParseURLEncoded for the raw form.
+func Parse(s string) (V1, error) {
+	var h V1
+	if len(s) == hex.EncodedLen(Size) {
+		if _, err := hex.Decode(h[:], []byte(s)); err == nil {
+			return h, nil
+		}
+	}
+	if len(s) == base32.StdEncoding.EncodedLen(Size) {
+		if decoded, err := base32.StdEncoding.DecodeString(strings.ToUpper(s)); err == nil {
+			return V1(decoded), nil
+		}
+	}
+	return h, fmt.Errorf("invalid info hash %q: must be 40 hex digits or 32 base32 characters", s)
+}
+
+// ParseURLEncoded parses a v1 info hash given as its URL-encoded raw bytes, as in the query
+// strings of tracker requests.
+func ParseURLEncoded(s string) (V1, error) {
+	unescaped, err := url.PathUnescape(s)
+	if err != nil || len(unescaped) != Size {
+		return V1{}, fmt.Errorf("invalid info hash %q: must be %d URL-encoded bytes", s, Size)
+	}
+	return V1([]byte(unescaped)), nil
+}
+
+// ParseV2 parses a v2 info hash given as 64 hex digits, or as the 68 hex digits of a SHA-256
+// multihash as in magnet links.
+func ParseV2(s string) (V2, error) {
+	var h V2
+	if len(s) == len(SHA256Multihash)+hex.EncodedLen(SizeV2) {
+		if !strings.HasPrefix(s, SHA256Multihash) {
+			return h, fmt.Errorf("unsupported v2 info hash %q: expected a SHA-256 multihash", s)
+		}
+		s = s[len(SHA256Multihash):]
+	}
+	if len(s) != hex.EncodedLen(SizeV2) {
+		return h, fmt.Errorf("invalid v2 info hash %q: must be 64 hex digits", s)
+	}
+	if _, err := hex.Decode(h[:], []byte(s)); err != nil {
+		return h, fmt.Errorf("invalid v2 info hash %q: %w", s, err)
+	}
+	return h, nil
+}
+
+// IsZero reports whether h is unset.
+func (h V1) IsZero() bool {
+	return h == V1{}
+}
+
+// Hex returns the 40 lowercase hex digits of h.
+func (h V1) Hex() string {
+	return hex.EncodeToString(h[:])
+}
+
+// Base32 returns the 32 uppercase base32 characters of h, as in older magnet links.
+func (h V1) Base32() string {
+	return base32.StdEncoding.EncodeToString(h[:])
+}
+
+// URLEncode returns h percent-encoded for the 'info_hash' parameter of tracker requests.
+// Unreserved characters are kept as they are, every other byte is escaped, which unlike
+// url.QueryEscape never turns a byte into '+'.
+func (h V1) URLEncode() string {
+	return EscapeBytes(h[:])
+}
+
+// String returns the hex form of h.
+func (h V1) String() string {
+	return h.Hex()
+}
+
+// Format implements fmt.Formatter so that %x, like %s and %v, prints the hex form of h rather
+// than the hex encoding of String, and %X prints it in uppercase.
+func (h V1) Format(f fmt.State, verb rune) {
+	formatHash(f, verb, h[:])
+}
+
+// MarshalText implements encoding.TextMarshaler with the hex form of h.
+func (h V1) MarshalText() ([]byte, error) {
+	return []byte(h.Hex()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting every form Parse does.
+func (h *V1) UnmarshalText(text []byte) error {
+	parsed, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// IsZero reports whether h is unset.
+func (h V2) IsZero() bool {
+	return h == V2{}
+}
+
+// Hex returns the 64 lowercase hex digits of h.
+func (h V2) Hex() string {
+	return hex.EncodeToString(h[:])
+}
+
+// Multihash returns the hex SHA-256 multihash of h, as in the 'urn:btmh:' topics of magnet links.
+func (h V2) Multihash() string {
+	return SHA256Multihash + h.Hex()
+}
+
+// Truncate returns the first 20 bytes of h, which identify v2 swarms wherever a v1 info hash
+// is expected, such as in tracker requests, the DHT and the peer handshake.
+func (h V2) Truncate() V1 {
+	return V1(h[:Size])
+}
+
+// String returns the hex form of h.
+func (h V2) String() string {
+	return h.Hex()
+}
+
+// Format implements fmt.Formatter like V1.Format.
+func (h V2) Format(f fmt.State, verb rune) {
+	formatHash(f, verb, h[:])
+}
+
+// MarshalText implements encoding.TextMarshaler with the hex form of h.
+func (h V2) MarshalText() ([]byte, error) {
+	return []byte(h.Hex()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, accepting every form ParseV2 does.
+func (h *V2) UnmarshalText(text []byte) error {
+	parsed, err := ParseV2(string(text))
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// formatHash writes the hash h for the fmt verb.
+func formatHash(f fmt.State, verb rune, h []byte) {
+	encoded := hex.EncodeToString(h)
+	switch verb {
+	case 'x', 's', 'v':
+		fmt.Fprint(f, encoded)
+	case 'X':
+		fmt.Fprint(f, strings.ToUpper(encoded))
+	case 'q':
+		fmt.Fprintf(f, "%q", encoded)
+	default:
+		fmt.Fprintf(f, "%%!%c(infohash=%s)", verb, encoded)
+	}
+}
+
+// EscapeBytes percent-encodes every byte of b except the unreserved characters of RFC 3986, as
+// the raw info hashes and peer IDs of tracker requests are.
+func EscapeBytes(b []byte) string {
+	const digits = "0123456789ABCDEF"
+	var sb strings.Builder
+	for _, c := range b {
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(digits[c>>4])
+		sb.WriteByte(digits[c&0x0f])
+	}
+	return sb.String()
+}
@@ -0,0 +1,131 @@
+package infohash
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testHash is a v1 info hash whose raw bytes include unreserved characters, spaces and '+'.
+var testHash = V1{'a', ' ', '+', 0x00, 0xff, '~', 0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, '-', '.', '_', 'Z', '9', '%'}
+
+// TestV1Forms checks every text form of a v1 info hash and that Parse accepts each of them.
+func TestV1Forms(t *testing.T) {
+	forms := map[string]string{
+		"hex":          testHash.Hex(),
+		"base32":       testHash.Base32(),
+		"upper hex":    strings.ToUpper(testHash.Hex()),
+		"lower base32": strings.ToLower(testHash.Base32()),
+	}
+	if forms["hex"] != "61202b00ff7e123456789abcdef02d2e5f5a3925" {
+		t.Errorf("Hex() = %q", forms["hex"])
+	}
+	if forms["base32"] != "MEQCWAH7PYJDIVTYTK6N54BNFZPVUOJF" {
+		t.Errorf("Base32() = %q", forms["base32"])
+	}
+	encoded := testHash.URLEncode()
+	if encoded != "a%20%2B%00%FF~%124Vx%9A%BC%DE%F0-._Z9%25" {
+		t.Errorf("URLEncode() = %q", encoded)
+	}
+	if h, err := ParseURLEncoded(encoded); err != nil || h != testHash {
+		t.Errorf("ParseURLEncoded(%q) = %v, %v, expected %v", encoded, h, err, testHash)
+	}
+
+	for name, form := range forms {
+		h, err := Parse(form)
+		if err != nil || h != testHash {
+			t.Errorf("Parse() of the %s form %q = %v, %v, expected %v", name, form, h, err, testHash)
+		}
+	}
+
+	invalid := []string{"", "abc", strings.Repeat("g", 40), strings.Repeat("1", 32), strings.Repeat("a", 20), encoded}
+	for _, s := range invalid {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) returned no error", s)
+		}
+	}
+	for _, s := range []string{"%zz" + strings.Repeat("a", 17), strings.Repeat("a", 21)} {
+		if _, err := ParseURLEncoded(s); err == nil {
+			t.Errorf("ParseURLEncoded(%q) returned no error", s)
+		}
+	}
+}
+
+// TestV2Forms checks the text forms of a v2 info hash and its truncation to the v1 size.
+func TestV2Forms(t *testing.T) {
+	var h V2
+	for i := range h {
+		h[i] = byte(i)
+	}
+	hexForm := "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	if h.Hex() != hexForm || h.String() != hexForm || h.Multihash() != "1220"+hexForm {
+		t.Errorf("Hex() = %q, Multihash() = %q", h.Hex(), h.Multihash())
+	}
+	if truncated := h.Truncate(); truncated.Hex() != hexForm[:40] {
+		t.Errorf("Truncate() = %v", truncated)
+	}
+
+	for _, form := range []string{hexForm, "1220" + hexForm, strings.ToUpper(hexForm)} {
+		if parsed, err := ParseV2(form); err != nil || parsed != h {
+			t.Errorf("ParseV2(%q) = %v, %v", form, parsed, err)
+		}
+	}
+	for _, s := range []string{hexForm[:40], "1320" + hexForm, "zz" + hexForm[2:]} {
+		if _, err := ParseV2(s); err == nil {
+			t.Errorf("ParseV2(%q) returned no error", s)
+		}
+	}
+}
+
+// TestFormat checks that the fmt verbs print the hex form, not the encoding of String.
+func TestFormat(t *testing.T) {
+	hexForm := testHash.Hex()
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"%x", hexForm},
+		{"%s", hexForm},
+		{"%v", hexForm},
+		{"%X", strings.ToUpper(hexForm)},
+		{"%q", `"` + hexForm + `"`},
+		{"%d", "%!d(infohash=" + hexForm + ")"},
+	}
+	for _, tc := range tests {
+		if got := fmt.Sprintf(tc.format, testHash); got != tc.expected {
+			t.Errorf("Sprintf(%q) = %q, expected %q", tc.format, got, tc.expected)
+		}
+	}
+	if got := fmt.Sprintf("%x", V2{0xab}); got != "ab"+strings.Repeat("0", 62) {
+		t.Errorf("Sprintf(%%x) of a v2 hash = %q", got)
+	}
+}
+
+// TestJSON checks that both types are encoded as hex strings in JSON.
+func TestJSON(t *testing.T) {
+	type hashes struct {
+		V1 V1
+		V2 V2
+	}
+	in := hashes{V1: testHash, V2: V2{0xab}}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("json.Marshal() returned error: %v", err)
+	}
+	expected := `{"V1":"61202b00ff7e123456789abcdef02d2e5f5a3925","V2":"ab00000000000000000000000000000000000000000000000000000000000000"}`
+	if string(data) != expected {
+		t.Errorf("json.Marshal() = %s, expected %s", data, expected)
+	}
+
+	var out hashes
+	if err := json.Unmarshal(data, &out); err != nil || out != in {
+		t.Errorf("json.Unmarshal() = %+v, %v, expected %+v", out, err, in)
+	}
+	if err := json.Unmarshal([]byte(`{"V1":"nope"}`), &out); err == nil {
+		t.Error("json.Unmarshal() of an invalid hash returned no error")
+	}
+	if !(V1{}).IsZero() || testHash.IsZero() || !(V2{}).IsZero() || in.V2.IsZero() {
+		t.Error("IsZero() returned a wrong result")
+	}
+}
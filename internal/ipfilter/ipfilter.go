@@ -0,0 +1,368 @@
+// Package ipfilter blocks peers by IP address, as loaded from the blocklists published for
+// BitTorrent clients.
+//
+// Three line formats are understood, and may be mixed in one file:
+//
+//	# the eMule ipfilter.dat format: first - last , access level , description
+//	001.002.004.000 - 001.002.004.255 , 000 , Some Network
+//	# the P2P plaintext format of PeerGuardian: description:first-last
+//	Some Network:1.2.4.0-1.2.4.255
+//	# CIDR prefixes and single addresses, IPv4 or IPv6
+//	10.0.0.0/8
+//	2001:db8::/32
+//
+// Blank lines and lines starting with '#' or "//" are skipped. As in eMule, .dat entries with
+// an access level above 127 are allowed rather than blocked.
+//
+// References:
+//   - https://www.emule-project.net/home/perl/help.cgi?l=1&rm=show_topic&topic_id=142
+//   - https://sourceforge.net/p/peerguardian/wiki/dev-blocklist-format-p2p/
+package ipfilter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/logging"
+)
+
+// maxBlockedLevel is the highest eMule access level that blocks a range.
+const maxBlockedLevel = 127
+
+// Range is an inclusive range of blocked addresses of the same IP version.
+type Range struct {
+	First       netip.Addr
+	Last        netip.Addr
+	Description string // name of the blocked network, if the list gives one
+}
+
+// Contains reports whether addr is in r.
+func (r Range) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return r.First.Compare(addr) <= 0 && addr.Compare(r.Last) <= 0
+}
+
+func (r Range) String() string {
+	s := r.First.String()
+	if r.Last != r.First {
+		s += "-" + r.Last.String()
+	}
+	if r.Description != "" {
+		s += " (" + r.Description + ")"
+	}
+	return s
+}
+
+// Direction tells whether a connection is accepted or dialed.
+type Direction int
+
+const (
+	Inbound  Direction = iota // connection accepted from a peer
+	Outbound                  // connection dialed to a peer
+)
+
+// Stats are the counters of a Filter.
+type Stats struct {
+	Ranges          int       // number of blocked ranges, after merging overlapping ones
+	BlockedInbound  int64     // inbound connections refused
+	BlockedOutbound int64     // outbound connections not attempted
+	LoadedAt        time.Time // when the ranges were last set
+}
+
+// Filter is a set of blocked address ranges that can be replaced while in use. Its methods
+// are safe for concurrent use, and a nil Filter blocks nothing.
+type Filter struct {
+	path   string // file the ranges are loaded from, empty if set directly
+	logger *slog.Logger
+
+	mu       sync.RWMutex
+	ranges   []Range // sorted and disjoint
+	loadedAt time.Time
+	modTime  time.Time // modification time of path when it was loaded
+
+	blockedInbound  atomic.Int64
+	blockedOutbound atomic.Int64
+}
+
+// New returns a Filter blocking ranges.
+func New(ranges []Range) *Filter {
+	f := &Filter{logger: logging.For(logging.Session)}
+	f.Set(ranges)
+	return f
+}
+
+// Load returns a Filter blocking the ranges listed in the file at path, which Reload and
+// Watch load again.
+func Load(path string) (*Filter, error) {
+	f := &Filter{path: path, logger: logging.For(logging.Session)}
+	if err := f.Reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Set replaces the blocked ranges with ranges. The counters are kept.
+func (f *Filter) Set(ranges []Range) {
+	merged := merge(ranges)
+	f.mu.Lock()
+	f.ranges = merged
+	f.loadedAt = time.Now()
+	f.mu.Unlock()
+}
+
+// Reload loads the file the Filter was loaded from again, keeping the current ranges if it
+// fails. It returns an error for a Filter created with New.
+func (f *Filter) Reload() error {
+	if f.path == "" {
+		return errors.New("blocklist was not loaded from a file")
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("loading blocklist: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("loading blocklist: %w", err)
+	}
+	ranges, err := Parse(file)
+	if err != nil {
+		return fmt.Errorf("loading blocklist %s: %w", f.path, err)
+	}
+
+	f.Set(ranges)
+	f.mu.Lock()
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	f.logger.Info("blocklist loaded", "path", f.path, "ranges", f.Stats().Ranges)
+	return nil
+}
+
+// Watch reloads the file the Filter was loaded from whenever its modification time changes,
+// checking every interval until ctx is cancelled. Failed reloads are logged and keep the
+// current ranges.
+func (f *Filter) Watch(ctx context.Context, interval time.Duration) {
+	if f == nil || f.path == "" {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(f.path)
+		if err != nil {
+			f.logger.Warn("checking blocklist failed", "path", f.path, "error", err)
+			continue
+		}
+		f.mu.RLock()
+		changed := !info.ModTime().Equal(f.modTime)
+		f.mu.RUnlock()
+		if changed {
+			if err := f.Reload(); err != nil {
+				f.logger.Warn("reloading blocklist failed", "error", err)
+			}
+		}
+	}
+}
+
+// Lookup returns the blocked range containing addr, if any.
+func (f *Filter) Lookup(addr netip.Addr) (Range, bool) {
+	if f == nil {
+		return Range{}, false
+	}
+	addr = addr.Unmap()
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	// the first range not ending before addr is the only one that can contain it
+	i, _ := slices.BinarySearchFunc(f.ranges, addr, func(r Range, addr netip.Addr) int {
+		return r.Last.Compare(addr)
+	})
+	if i < len(f.ranges) && f.ranges[i].Contains(addr) {
+		return f.ranges[i], true
+	}
+	return Range{}, false
+}
+
+// Allow reports whether a connection in the given direction to or from addr is allowed,
+// counting it in Stats if it is blocked.
+func (f *Filter) Allow(addr netip.Addr, dir Direction) bool {
+	if _, blocked := f.Lookup(addr); !blocked {
+		return true
+	}
+	if dir == Inbound {
+		f.blockedInbound.Add(1)
+	} else {
+		f.blockedOutbound.Add(1)
+	}
+	return false
+}
+
+// Stats returns the number of blocked ranges and of blocked connections.
+func (f *Filter) Stats() Stats {
+	if f == nil {
+		return Stats{}
+	}
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return Stats{
+		Ranges:          len(f.ranges),
+		BlockedInbound:  f.blockedInbound.Load(),
+		BlockedOutbound: f.blockedOutbound.Load(),
+		LoadedAt:        f.loadedAt,
+	}
+}
+
+// =====================================================================================
+
+// Parse reads the blocked ranges of a blocklist in any of the formats described in the
+// package documentation.
+func Parse(r io.Reader) ([]Range, error) {
+	var ranges []Range
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "//") {
+			continue
+		}
+		rng, blocked, err := parseLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if blocked {
+			ranges = append(ranges, rng)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// parseLine parses a line of a blocklist, reporting whether the range it lists is blocked.
+func parseLine(text string) (Range, bool, error) {
+	// P2P: the description may contain anything, the range after the last ':' is IPv4,
+	// which tells it apart from IPv6 addresses
+	if i := strings.LastIndexByte(text, ':'); i > 0 && strings.Contains(text[i+1:], ".") {
+		rng, err := parseRange(text[i+1:])
+		if err != nil {
+			return Range{}, false, err
+		}
+		rng.Description = strings.TrimSpace(text[:i])
+		return rng, true, nil
+	}
+
+	// eMule .dat
+	if fields := strings.Split(text, ","); len(fields) >= 2 {
+		rng, err := parseRange(fields[0])
+		if err != nil {
+			return Range{}, false, err
+		}
+		level, err := strconv.Atoi(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return Range{}, false, fmt.Errorf("invalid access level %q", strings.TrimSpace(fields[1]))
+		}
+		if len(fields) > 2 {
+			rng.Description = strings.TrimSpace(strings.Join(fields[2:], ","))
+		}
+		return rng, level <= maxBlockedLevel, nil
+	}
+
+	if prefix, err := netip.ParsePrefix(text); err == nil {
+		prefix = prefix.Masked()
+		return Range{First: prefix.Addr(), Last: lastAddr(prefix)}, true, nil
+	}
+	rng, err := parseRange(text)
+	return rng, err == nil, err
+}
+
+// parseRange parses "first-last" or a single address.
+func parseRange(s string) (Range, error) {
+	firstText, lastText, isRange := strings.Cut(s, "-")
+	first, err := parseAddr(firstText)
+	if err != nil {
+		return Range{}, err
+	}
+	last := first
+	if isRange {
+		if last, err = parseAddr(lastText); err != nil {
+			return Range{}, err
+		}
+	}
+	if first.Is4() != last.Is4() {
+		return Range{}, fmt.Errorf("range %q mixes IPv4 and IPv6", strings.TrimSpace(s))
+	}
+	if last.Less(first) {
+		return Range{}, fmt.Errorf("range %q ends before it starts", strings.TrimSpace(s))
+	}
+	return Range{First: first, Last: last}, nil
+}
+
+// parseAddr parses an IP address, accepting the zero-padded IPv4 octets of .dat files.
+func parseAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	if octets := strings.Split(s, "."); len(octets) == 4 {
+		for i, octet := range octets {
+			if trimmed := strings.TrimLeft(octet, "0"); len(trimmed) < len(octet) {
+				if trimmed == "" {
+					trimmed = "0"
+				}
+				octets[i] = trimmed
+			}
+		}
+		s = strings.Join(octets, ".")
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	return addr.Unmap(), nil
+}
+
+// lastAddr returns the last address of the masked prefix p.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Addr().AsSlice()
+	for bit := p.Bits(); bit < len(b)*8; bit++ {
+		b[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// merge returns ranges sorted, with overlapping and adjacent ranges joined. A joined range
+// keeps the description of its first part.
+func merge(ranges []Range) []Range {
+	sorted := slices.Clone(ranges)
+	slices.SortFunc(sorted, func(a, b Range) int {
+		return a.First.Compare(b.First)
+	})
+	var merged []Range
+	for _, r := range sorted {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if next := last.Last.Next(); last.Last.Is4() == r.First.Is4() && (!next.IsValid() || r.First.Compare(next) <= 0) {
+				if last.Last.Less(r.Last) {
+					last.Last = r.Last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,169 @@
+package ipfilter
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParse covers every line format, comments and the eMule access level.
+func TestParse(t *testing.T) {
+	list := `# comment
+// another comment
+
+001.002.004.000 - 001.002.004.255 , 000 , Some Network, Inc
+005.000.000.000 - 005.000.000.255 , 200 , Allowed
+Company: Sales:10.0.0.1-10.0.0.9
+192.168.0.0/16
+2001:db8::/32
+172.16.0.1
+`
+	got, err := Parse(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	want := []Range{
+		{netip.MustParseAddr("1.2.4.0"), netip.MustParseAddr("1.2.4.255"), "Some Network, Inc"},
+		{netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("10.0.0.9"), "Company: Sales"},
+		{netip.MustParseAddr("192.168.0.0"), netip.MustParseAddr("192.168.255.255"), ""},
+		{netip.MustParseAddr("2001:db8::"), netip.MustParseAddr("2001:db8:ffff:ffff:ffff:ffff:ffff:ffff"), ""},
+		{netip.MustParseAddr("172.16.0.1"), netip.MustParseAddr("172.16.0.1"), ""},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %v\nwant %v", got, want)
+	}
+}
+
+// TestParseErrors checks that malformed lines are reported with their line number.
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		wantErr string
+	}{
+		{"bad address", "1.2.3.x - 1.2.3.4 , 0 , x", `invalid address "1.2.3.x"`},
+		{"bad level", "1.2.3.0 - 1.2.3.4 , low , x", `invalid access level "low"`},
+		{"reversed", "desc:1.2.3.9-1.2.3.0", "ends before it starts"},
+		{"mixed families", "1.2.3.4-::1", "mixes IPv4 and IPv6"},
+		{"garbage", "not a blocklist", "invalid address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader("# header\n" + tt.line + "\n"))
+			if err == nil || !strings.Contains(err.Error(), "line 2: ") || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Parse() error = %v, want line 2 and %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestFilter checks lookups against merged ranges and the counters of Allow.
+func TestFilter(t *testing.T) {
+	r := func(first, last, desc string) Range {
+		return Range{netip.MustParseAddr(first), netip.MustParseAddr(last), desc}
+	}
+	f := New([]Range{
+		r("10.0.0.10", "10.0.0.20", "b"),
+		r("10.0.0.0", "10.0.0.9", "a"), // adjacent to b, merged into a
+		r("10.0.0.15", "10.0.0.30", "c"),
+		r("::ffff:0", "::ffff:ff", "v6"),
+	})
+	if got := f.Stats().Ranges; got != 2 {
+		t.Errorf("Ranges = %d, want 2 after merging", got)
+	}
+
+	tests := []struct {
+		addr    string
+		blocked bool
+		desc    string
+	}{
+		{"9.255.255.255", false, ""},
+		{"10.0.0.0", true, "a"},
+		{"10.0.0.25", true, "a"},
+		{"10.0.0.30", true, "a"},
+		{"10.0.0.31", false, ""},
+		{"::ffff:10.0.0.5", true, "a"}, // IPv4-mapped addresses match IPv4 ranges
+		{"::ffff:ff", true, "v6"},
+		{"::1:0", false, ""},
+	}
+	for _, tt := range tests {
+		rng, blocked := f.Lookup(netip.MustParseAddr(tt.addr))
+		if blocked != tt.blocked || rng.Description != tt.desc {
+			t.Errorf("Lookup(%s) = %v, %v; want blocked %v by %q", tt.addr, rng, blocked, tt.blocked, tt.desc)
+		}
+	}
+
+	f.Allow(netip.MustParseAddr("10.0.0.1"), Inbound)
+	f.Allow(netip.MustParseAddr("10.0.0.1"), Outbound)
+	f.Allow(netip.MustParseAddr("10.0.0.2"), Outbound)
+	f.Allow(netip.MustParseAddr("8.8.8.8"), Outbound)
+	if stats := f.Stats(); stats.BlockedInbound != 1 || stats.BlockedOutbound != 2 {
+		t.Errorf("Stats() = %+v, want 1 inbound and 2 outbound blocked", stats)
+	}
+
+	var none *Filter
+	if !none.Allow(netip.MustParseAddr("10.0.0.1"), Inbound) {
+		t.Error("a nil Filter blocked an address")
+	}
+}
+
+// TestReload checks that Reload and Watch pick up a rewritten list and keep the current
+// ranges if it becomes invalid.
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.p2p")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocked := func(f *Filter, addr string) bool {
+		_, ok := f.Lookup(netip.MustParseAddr(addr))
+		return ok
+	}
+
+	start := time.Now().Add(-time.Hour)
+	write("first:1.1.1.0-1.1.1.255\n", start)
+	f, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !blocked(f, "1.1.1.1") {
+		t.Fatal("1.1.1.1 not blocked after Load()")
+	}
+
+	write("broken\n", start.Add(time.Minute))
+	if err := f.Reload(); err == nil {
+		t.Error("Reload() of an invalid list returned no error")
+	}
+	if !blocked(f, "1.1.1.1") {
+		t.Error("failed Reload() dropped the current ranges")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go f.Watch(ctx, 10*time.Millisecond)
+	write("second:2.2.2.0-2.2.2.255\n", start.Add(2*time.Minute))
+	deadline := time.Now().Add(5 * time.Second)
+	for !blocked(f, "2.2.2.2") {
+		if time.Now().After(deadline) {
+			t.Fatal("Watch() did not reload the rewritten list")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if blocked(f, "1.1.1.1") {
+		t.Error("ranges of the previous list still blocked after the reload")
+	}
+
+	if err := New(nil).Reload(); err == nil {
+		t.Error("Reload() of a Filter not loaded from a file returned no error")
+	}
+}
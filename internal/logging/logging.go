@@ -0,0 +1,88 @@
+// Package logging provides the loggers used by gobit's subsystems.
+//
+// Every subsystem logs through log/slog. A component configured with its own *slog.Logger,
+// such as tracker.Client or session.Config, uses it; otherwise it falls back to the logger of
+// its subsystem returned by For. Those default to a single package-level logger, which
+// discards everything until SetDefault is called, so the library stays quiet unless asked.
+// Any slog.Handler can be plugged in to route the output elsewhere.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// Subsystem names, attached to every record as the "subsystem" attribute.
+const (
+	Parser  = "parser"
+	Tracker = "tracker"
+	Peer    = "peer"
+	DHT     = "dht"
+	Session = "session"
+	RPC     = "rpc"
+)
+
+// SubsystemKey is the attribute key naming the subsystem of a record.
+const SubsystemKey = "subsystem"
+
+var (
+	mu         sync.RWMutex
+	base       = Discard()
+	subsystems = make(map[string]*slog.Logger)
+)
+
+// SetDefault sets the logger every subsystem without a logger of its own writes to.
+// A nil logger discards output again.
+func SetDefault(l *slog.Logger) {
+	if l == nil {
+		l = Discard()
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	base = l
+}
+
+// Set overrides the logger of a single subsystem, for instance to log the tracker at debug
+// level while keeping everything else at info. A nil logger removes the override.
+func Set(subsystem string, l *slog.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l == nil {
+		delete(subsystems, subsystem)
+		return
+	}
+	subsystems[subsystem] = l
+}
+
+// For returns the logger of the given subsystem: its override if one was set, the default
+// logger otherwise, with the subsystem attribute attached.
+func For(subsystem string) *slog.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	if l, ok := subsystems[subsystem]; ok {
+		return l.With(SubsystemKey, subsystem)
+	}
+	return base.With(SubsystemKey, subsystem)
+}
+
+// Or returns l if it is not nil, and the logger of the given subsystem otherwise.
+func Or(l *slog.Logger, subsystem string) *slog.Logger {
+	if l != nil {
+		return l
+	}
+	return For(subsystem)
+}
+
+// Discard returns a logger that drops every record.
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+// discardHandler is a slog.Handler that drops every record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// TestFor verifies that subsystem loggers write to the default logger, or to their override,
+// with the subsystem attribute attached, and discard everything before SetDefault.
+func TestFor(t *testing.T) {
+	t.Cleanup(func() {
+		SetDefault(nil)
+		Set(Tracker, nil)
+	})
+
+	var base, tracker bytes.Buffer
+	newLogger := func(buf *bytes.Buffer) *slog.Logger {
+		return slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	}
+
+	if For(Parser).Enabled(context.Background(), slog.LevelError) {
+		t.Error("expected the default logger to discard everything")
+	}
+
+	SetDefault(newLogger(&base))
+	Set(Tracker, newLogger(&tracker))
+
+	tests := []struct {
+		subsystem string
+		buf       *bytes.Buffer
+	}{
+		{Parser, &base},
+		{Peer, &base},
+		{Tracker, &tracker},
+	}
+	for _, tc := range tests {
+		tc.buf.Reset()
+		For(tc.subsystem).Debug("hello")
+		if got := tc.buf.String(); !strings.Contains(got, "subsystem="+tc.subsystem) || !strings.Contains(got, "msg=hello") {
+			t.Errorf("For(%q) wrote %q", tc.subsystem, got)
+		}
+	}
+
+	Set(Tracker, nil)
+	base.Reset()
+	For(Tracker).Info("again")
+	if !strings.Contains(base.String(), "subsystem=tracker") {
+		t.Errorf("expected the tracker to fall back to the default logger, got %q", base.String())
+	}
+}
+
+// TestOr checks that an explicit logger takes precedence over the subsystem logger.
+func TestOr(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(slog.NewTextHandler(&buf, nil))
+	if Or(l, Peer) != l {
+		t.Error("expected Or to return the given logger")
+	}
+	if Or(nil, Peer) == nil {
+		t.Error("expected Or to fall back to the subsystem logger")
+	}
+}
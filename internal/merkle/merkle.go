@@ -0,0 +1,124 @@
+// Package merkle computes and verifies the SHA-256 merkle trees of BitTorrent v2.
+//
+// Every file of a v2 torrent has its own binary tree. Its leaves are the hashes of the 16 KiB
+// blocks of the file, followed by zero hashes up to a power of two, and each node is the hash
+// of its two children concatenated. The root is the pieces root of the file tree. The layer
+// whose nodes cover a piece each is the piece layer of the metainfo, padded with the roots of
+// all-zero subtrees rather than zero hashes.
+//
+// Peers exchange parts of a tree as a run of hashes of one layer, along with the uncle hashes
+// proving them against a node higher up that the receiver already trusts.
+//
+// Reference: https://bittorrent.org/beps/bep_0052.html
+package merkle
+
+import (
+	"crypto/sha256"
+	"fmt"
+)
+
+// BlockSize is the size of the blocks hashed into the leaves of a tree (16 KiB).
+const BlockSize = 16 * 1024
+
+// HashBlock returns the leaf hash of a block, which is at most BlockSize bytes long.
+func HashBlock(data []byte) [32]byte {
+	return sha256.Sum256(data)
+}
+
+// PadHash returns the root of a subtree of 2^height zero leaves, the hash padding a layer
+// height levels above the leaves.
+func PadHash(height int) [32]byte {
+	var hash [32]byte
+	for ; height > 0; height-- {
+		hash = hashPair(hash, hash)
+	}
+	return hash
+}
+
+// Root returns the root of the tree over hashes, padding the layer with the padding hash up
+// to the next power of two.
+func Root(hashes [][32]byte, padding [32]byte) [32]byte {
+	layer := append([][32]byte(nil), hashes...)
+	for len(layer)&(len(layer)-1) != 0 {
+		layer = append(layer, padding)
+	}
+
+	for len(layer) > 1 {
+		next := layer[:len(layer)/2]
+		for idx := range next {
+			next[idx] = hashPair(layer[2*idx], layer[2*idx+1])
+		}
+		layer = next
+	}
+	return layer[0]
+}
+
+// Proof returns the uncle hashes proving the length hashes of layer starting at index, from
+// the root of their subtree up to proofLayers levels above it, lowest first. The layer is
+// padded with the padding hash of its height, and length must be a power of two dividing
+// index. Fewer hashes are returned when the root of the tree is reached first.
+func Proof(layer [][32]byte, height, index, length, proofLayers int) ([][32]byte, error) {
+	if length <= 0 || length&(length-1) != 0 || index < 0 || index%length != 0 || index >= len(layer) {
+		return nil, fmt.Errorf("invalid range of %d hashes at index %d of a layer of %d", length, index, len(layer))
+	}
+
+	// climb to the root of the subtree holding the range
+	nodes := append([][32]byte(nil), layer...)
+	for width := 1; width < length; width *= 2 {
+		nodes = parentLayer(nodes, PadHash(height))
+		height++
+	}
+	position := index / length
+
+	var proof [][32]byte
+	for ; proofLayers > 0 && len(nodes) > 1; proofLayers-- {
+		sibling := PadHash(height)
+		if position^1 < len(nodes) {
+			sibling = nodes[position^1]
+		}
+		proof = append(proof, sibling)
+		nodes = parentLayer(nodes, PadHash(height))
+		height++
+		position /= 2
+	}
+	return proof, nil
+}
+
+// Verify reports whether hashes, a run of a layer starting at index whose length is a power
+// of two dividing index, hash up to expected through the uncle hashes of proof, lowest first.
+func Verify(hashes [][32]byte, index int, proof [][32]byte, expected [32]byte) bool {
+	length := len(hashes)
+	if length == 0 || length&(length-1) != 0 || index < 0 || index%length != 0 {
+		return false
+	}
+	node := Root(hashes, [32]byte{})
+	position := index / length
+	for _, uncle := range proof {
+		if position%2 == 0 {
+			node = hashPair(node, uncle)
+		} else {
+			node = hashPair(uncle, node)
+		}
+		position /= 2
+	}
+	return node == expected
+}
+
+// =====================================================================================
+
+func hashPair(left, right [32]byte) [32]byte {
+	return sha256.Sum256(append(left[:], right[:]...))
+}
+
+// parentLayer returns the layer above nodes, padding an odd layer with padding.
+func parentLayer(nodes [][32]byte, padding [32]byte) [][32]byte {
+	parents := make([][32]byte, (len(nodes)+1)/2)
+	for idx := range parents {
+		right := padding
+		if 2*idx+1 < len(nodes) {
+			right = nodes[2*idx+1]
+		}
+		parents[idx] = hashPair(nodes[2*idx], right)
+	}
+	return parents
+}
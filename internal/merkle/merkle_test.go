@@ -0,0 +1,100 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+// hash returns the hash of the concatenated hashes.
+func hash(hashes ...[32]byte) [32]byte {
+	var data []byte
+	for _, h := range hashes {
+		data = append(data, h[:]...)
+	}
+	return sha256.Sum256(data)
+}
+
+// TestRoot verifies padding of a layer to the next power of two.
+func TestRoot(t *testing.T) {
+	a, b, c := [32]byte{1}, [32]byte{2}, [32]byte{3}
+	padding := [32]byte{9}
+
+	if got := Root([][32]byte{a}, padding); got != a {
+		t.Errorf("root of a single hash = %x, want the hash itself", got)
+	}
+	if got, want := Root([][32]byte{a, b, c}, padding), hash(hash(a, b), hash(c, padding)); got != want {
+		t.Errorf("Root() = %x, want %x", got, want)
+	}
+}
+
+// TestPadHash checks the roots of all-zero subtrees.
+func TestPadHash(t *testing.T) {
+	var zero [32]byte
+	if got := PadHash(0); got != zero {
+		t.Errorf("PadHash(0) = %x, want the zero hash", got)
+	}
+	if got, want := PadHash(2), hash(hash(zero, zero), hash(zero, zero)); got != want {
+		t.Errorf("PadHash(2) = %x, want %x", got, want)
+	}
+	if got, want := PadHash(2), Root(make([][32]byte, 4), zero); got != want {
+		t.Errorf("PadHash(2) = %x, want the root of 4 zero leaves %x", got, want)
+	}
+}
+
+// TestProofVerify proves runs of the leaves of a tree of 5 leaves, padded to 8, against
+// nodes above them and against the root.
+func TestProofVerify(t *testing.T) {
+	var leaves [][32]byte
+	for i := range 5 {
+		leaves = append(leaves, HashBlock([]byte{byte(i)}))
+	}
+	var zero [32]byte
+	root := Root(leaves, zero)
+	left := hash(hash(leaves[0], leaves[1]), hash(leaves[2], leaves[3]))
+
+	tests := []struct {
+		name                       string
+		index, length, proofLayers int
+		proofLength                int
+		expected                   [32]byte
+	}{
+		{"subtree root only", 0, 4, 0, 0, left},
+		{"up to the root", 4, 2, 2, 2, root},
+		{"proof layers beyond the root", 2, 1, 5, 3, root},
+		{"single leaf against its parent", 1, 1, 1, 1, hash(leaves[0], leaves[1])},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			proof, err := Proof(leaves, 0, tc.index, tc.length, tc.proofLayers)
+			if err != nil {
+				t.Fatalf("Proof() returned error: %v", err)
+			}
+			if len(proof) != tc.proofLength {
+				t.Fatalf("Proof() returned %d hashes, want %d", len(proof), tc.proofLength)
+			}
+			hashes := make([][32]byte, tc.length)
+			copy(hashes, leaves[tc.index:])
+			if !Verify(hashes, tc.index, proof, tc.expected) {
+				t.Error("Verify() rejected a valid proof")
+			}
+			hashes[0][0] ^= 1
+			if Verify(hashes, tc.index, proof, tc.expected) {
+				t.Error("Verify() accepted a tampered hash")
+			}
+		})
+	}
+}
+
+// TestProofInvalid ensures that runs not aligned on their length are rejected.
+func TestProofInvalid(t *testing.T) {
+	leaves := make([][32]byte, 8)
+	for _, tc := range []struct{ index, length int }{{1, 2}, {0, 3}, {8, 1}, {-2, 2}, {0, 0}} {
+		if _, err := Proof(leaves, 0, tc.index, tc.length, 0); err == nil {
+			t.Errorf("Proof(index %d, length %d): expected error, got nil", tc.index, tc.length)
+		}
+	}
+	if Verify(leaves[:2], 1, nil, Root(leaves[:2], [32]byte{})) {
+		t.Error("Verify() accepted a run not aligned on its length")
+	}
+}
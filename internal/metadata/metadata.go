@@ -0,0 +1,254 @@
+// Package metadata implements the metadata exchange of BEP 9 (ut_metadata), which lets a client
+// download the info dictionary of a torrent from its peers, starting from just a magnet link.
+//
+// The info dictionary is split into pieces of 16 KiB that are requested over the extension
+// protocol of BEP 10. Once complete, it is verified against the info hash of the magnet link
+// and converted into a torrent.MetaInfo.
+//
+// Reference: https://bittorrent.org/beps/bep_0009.html
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// ExtensionName is the name of the metadata extension in extension handshakes.
+const ExtensionName = "ut_metadata"
+
+// PieceSize is the size of every metadata piece except the last one.
+const PieceSize = 16 * 1024
+
+// MaxSize limits the metadata size accepted from peers to prevent memory exhaustion.
+const MaxSize = 16 * 1024 * 1024 // 16 MB
+
+// LocalID is the extended message ID we ask peers to send ut_metadata messages with.
+const LocalID = 1
+
+// DefaultPeerTimeout bounds the exchange with a single peer in FetchFromPeers.
+const DefaultPeerTimeout = 30 * time.Second
+
+// ut_metadata message types
+const (
+	msgRequest = 0
+	msgData    = 1
+	msgReject  = 2
+)
+
+// message is the bencoded header of a ut_metadata message.
+type message struct {
+	Type      int64 `bencode:"msg_type"`
+	Piece     int64 `bencode:"piece"`
+	TotalSize int64 `bencode:"total_size,omitempty"` // only in data messages
+}
+
+// NewRequest returns a request for the metadata piece at index, sent with the peer's
+// ut_metadata extended message ID.
+func NewRequest(id uint8, index int) *peer.Message {
+	return newMessage(id, message{Type: msgRequest, Piece: int64(index)}, nil)
+}
+
+// NewData returns a data message carrying the metadata piece at index of metadata,
+// sent with the peer's ut_metadata extended message ID.
+func NewData(id uint8, index int, metadata []byte) *peer.Message {
+	start := index * PieceSize
+	end := min(start+PieceSize, len(metadata))
+	return newMessage(id, message{Type: msgData, Piece: int64(index), TotalSize: int64(len(metadata))}, metadata[start:end])
+}
+
+// NewReject returns a message rejecting the request for the metadata piece at index.
+func NewReject(id uint8, index int) *peer.Message {
+	return newMessage(id, message{Type: msgReject, Piece: int64(index)}, nil)
+}
+
+func newMessage(id uint8, header message, data []byte) *peer.Message {
+	payload, err := bencode.Marshal(header)
+	if err != nil {
+		panic(err) // the header only holds integers
+	}
+	return peer.NewExtended(id, append(payload, data...))
+}
+
+// parseMessage splits the payload of a ut_metadata message into its header and trailing data.
+func parseMessage(payload []byte) (message, []byte, error) {
+	_, n, err := bencode.DecodePrefix(payload, bencode.DecodeOptions{})
+	if err != nil {
+		return message{}, nil, fmt.Errorf("decoding %s message: %w", ExtensionName, err)
+	}
+	var m message
+	if err := bencode.Unmarshal(payload[:n], &m); err != nil {
+		return message{}, nil, fmt.Errorf("decoding %s message: %w", ExtensionName, err)
+	}
+	return m, payload[n:], nil
+}
+
+// Answer returns the reply to the payload of a ut_metadata message received from a peer:
+// the requested piece of metadata, or a reject if metadata is nil or the piece does not exist.
+// It returns nil for messages that need no reply. remoteID is the peer's ut_metadata ID.
+func Answer(payload []byte, remoteID uint8, metadata []byte) (*peer.Message, error) {
+	header, _, err := parseMessage(payload)
+	if err != nil {
+		return nil, err
+	}
+	if header.Type != msgRequest {
+		return nil, nil
+	}
+
+	index := int(header.Piece)
+	if metadata == nil || index < 0 || index*PieceSize >= len(metadata) {
+		return NewReject(remoteID, index), nil
+	}
+	return NewData(remoteID, index, metadata), nil
+}
+
+// Fetch downloads the info dictionary from the peer over pc and verifies it against magnet,
+// returning the resulting MetaInfo. The peer must support the extension protocol, see
+// peer.ExtensionProtocol. Fetch consumes the messages of pc until it returns.
+func Fetch(ctx context.Context, pc *peer.PeerConn, magnet *torrent.MagnetInfo) (*torrent.MetaInfo, error) {
+	if !peer.SupportsExtensions(pc.Reserved()) {
+		return nil, errors.New("peer does not support the extension protocol")
+	}
+	handshake, err := peer.NewExtensionHandshake(peer.ExtensionHandshake{M: map[string]int64{ExtensionName: LocalID}})
+	if err != nil {
+		return nil, err
+	}
+	if err := pc.Send(handshake); err != nil {
+		return nil, err
+	}
+
+	remote, err := waitExtensions(ctx, pc)
+	if err != nil {
+		return nil, err
+	}
+	remoteID, ok := remote.ExtensionID(ExtensionName)
+	if !ok {
+		return nil, fmt.Errorf("peer does not support %s", ExtensionName)
+	}
+	size := remote.MetadataSize
+	if size <= 0 || size > MaxSize {
+		return nil, fmt.Errorf("invalid metadata size %d", size)
+	}
+
+	numPieces := int((size + PieceSize - 1) / PieceSize)
+	for index := 0; index < numPieces; index++ {
+		if err := pc.Send(NewRequest(remoteID, index)); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := make([]byte, size)
+	received := make([]bool, numPieces)
+	remaining := numPieces
+	for remaining > 0 {
+		m, err := next(ctx, pc)
+		if err != nil {
+			return nil, err
+		}
+		id, payload, err := m.ParseExtended()
+		if err != nil || id != LocalID {
+			continue // not a ut_metadata message
+		}
+
+		header, data, err := parseMessage(payload)
+		if err != nil {
+			return nil, err
+		}
+		switch header.Type {
+		case msgReject:
+			return nil, fmt.Errorf("peer rejected the request for metadata piece %d", header.Piece)
+		case msgData:
+		default:
+			continue
+		}
+
+		index := int(header.Piece)
+		if index < 0 || index >= numPieces || header.TotalSize != size {
+			return nil, fmt.Errorf("invalid metadata piece %d of total size %d", header.Piece, header.TotalSize)
+		}
+		start := int64(index) * PieceSize
+		if expected := min(PieceSize, size-start); int64(len(data)) != expected {
+			return nil, fmt.Errorf("metadata piece %d has %d bytes, expected %d", index, len(data), expected)
+		}
+		copy(metadata[start:], data)
+		if !received[index] {
+			received[index] = true
+			remaining--
+		}
+	}
+
+	return magnet.VerifyMetadata(metadata)
+}
+
+// FetchFromPeers connects to each of the peers in turn until one of them provides the info
+// dictionary of magnet, spending at most DefaultPeerTimeout on each. cfg configures the
+// connections; its info hash, extension bits and piece count are filled in by FetchFromPeers.
+func FetchFromPeers(ctx context.Context, magnet *torrent.MagnetInfo, peers []netip.AddrPort, cfg peer.Config) (*torrent.MetaInfo, error) {
+	if !magnet.HasV1() {
+		return nil, errors.New("metadata exchange requires a v1 info hash")
+	}
+	cfg.InfoHash = magnet.InfoHash
+	cfg.Reserved[5] |= peer.ExtensionProtocol[5]
+	cfg.RequiredReserved = peer.ExtensionProtocol
+	cfg.NumPieces = 0 // unknown until the metadata arrives
+
+	var errs []error
+	for _, addr := range peers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		mi, err := fetchFrom(ctx, addr, magnet, cfg)
+		if err == nil {
+			return mi, nil
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", addr, err))
+	}
+
+	if len(errs) == 0 {
+		return nil, errors.New("no peers to fetch metadata from")
+	}
+	return nil, fmt.Errorf("fetching metadata failed: %w", errors.Join(errs...))
+}
+
+func fetchFrom(ctx context.Context, addr netip.AddrPort, magnet *torrent.MagnetInfo, cfg peer.Config) (*torrent.MetaInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultPeerTimeout)
+	defer cancel()
+
+	pc, err := peer.Dial(ctx, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+	return Fetch(ctx, pc, magnet)
+}
+
+// waitExtensions waits for the extension handshake of the peer.
+func waitExtensions(ctx context.Context, pc *peer.PeerConn) (peer.ExtensionHandshake, error) {
+	for {
+		if h, ok := pc.PeerExtensions(); ok {
+			return h, nil
+		}
+		if _, err := next(ctx, pc); err != nil {
+			return peer.ExtensionHandshake{}, err
+		}
+	}
+}
+
+// next returns the next message from the peer.
+func next(ctx context.Context, pc *peer.PeerConn) (*peer.Message, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case m, ok := <-pc.Messages():
+		if !ok {
+			return nil, fmt.Errorf("peer disconnected: %w", pc.Err())
+		}
+		return m, nil
+	}
+}
@@ -0,0 +1,263 @@
+package metadata
+
+import (
+	"context"
+	"crypto/sha1"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// remoteID is the ut_metadata ID announced by the test peers.
+const remoteID = 3
+
+var testPeerID = [20]byte([]byte("-GB0001-metadatatest"))
+
+// testMetadata returns the bencoded info dictionary of a torrent with 1000 pieces,
+// which spans two metadata pieces, and a magnet link for it.
+func testMetadata(t *testing.T) ([]byte, *torrent.MagnetInfo) {
+	t.Helper()
+	info := torrent.InfoDict{
+		Name:        "metadata",
+		PieceLength: 16384,
+		Pieces:      make([][20]byte, 1000),
+		Files:       []torrent.FileInfo{{Length: 1000 * 16384, Path: []string{"metadata"}}},
+	}
+	dict, err := info.ToDictionary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, err := bencode.Encode(dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metadata) <= PieceSize {
+		t.Fatalf("test metadata of %d bytes fits into a single piece", len(metadata))
+	}
+	return metadata, &torrent.MagnetInfo{InfoHash: sha1.Sum(metadata)}
+}
+
+// servePeer runs the remote side of a connection over conn, advertising metadataSize and
+// answering ut_metadata requests with metadata, until the connection is closed.
+func servePeer(conn net.Conn, infoHash [20]byte, metadataSize int, metadata []byte) {
+	defer conn.Close()
+	if _, err := peer.ReadHandshake(conn); err != nil {
+		return
+	}
+	h := peer.Handshake{Reserved: peer.ExtensionProtocol, InfoHash: infoHash, PeerID: [20]byte{'r'}}
+	if _, err := h.WriteTo(conn); err != nil {
+		return
+	}
+	handshake, _ := peer.NewExtensionHandshake(peer.ExtensionHandshake{
+		M:            map[string]int64{ExtensionName: remoteID},
+		MetadataSize: int64(metadataSize),
+	})
+	if _, err := handshake.WriteTo(conn); err != nil {
+		return
+	}
+
+	for {
+		m, err := peer.ReadMessage(conn)
+		if err != nil {
+			return
+		}
+		if m == nil || m.ID != peer.MsgExtended {
+			continue
+		}
+		id, payload, err := m.ParseExtended()
+		if err != nil || id != remoteID {
+			continue
+		}
+		// replies go to the ut_metadata ID the local side announced
+		reply, err := Answer(payload, LocalID, metadata)
+		if err != nil {
+			return
+		}
+		if reply != nil {
+			reply.WriteTo(conn)
+		}
+	}
+}
+
+// connect returns a PeerConn to a test peer serving metadata over an in-memory pipe.
+func connect(t *testing.T, infoHash [20]byte, metadataSize int, metadata []byte) *peer.PeerConn {
+	t.Helper()
+	local, remote := net.Pipe()
+	go servePeer(remote, infoHash, metadataSize, metadata)
+
+	pc, err := peer.NewPeerConn(local, peer.Config{InfoHash: infoHash, PeerID: testPeerID, Reserved: peer.ExtensionProtocol})
+	if err != nil {
+		t.Fatalf("NewPeerConn() returned error: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc
+}
+
+// TestMessages verifies the encoding of ut_metadata messages.
+func TestMessages(t *testing.T) {
+	metadata := []byte(strings.Repeat("m", PieceSize+5))
+	tests := []struct {
+		name     string
+		message  *peer.Message
+		expected string
+	}{
+		{"request", NewRequest(2, 1), "d8:msg_typei0e5:piecei1ee"},
+		{"reject", NewReject(2, 1), "d8:msg_typei2e5:piecei1ee"},
+		{"data", NewData(2, 1, metadata), "d8:msg_typei1e5:piecei1e10:total_sizei16389eemmmmm"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			id, payload, err := tc.message.ParseExtended()
+			if err != nil || id != 2 {
+				t.Fatalf("ParseExtended() = %d, %v, want ID 2", id, err)
+			}
+			if string(payload) != tc.expected {
+				t.Errorf("payload = %q, want %q", payload, tc.expected)
+			}
+		})
+	}
+}
+
+// TestAnswer checks the replies to requests for existing and missing pieces.
+func TestAnswer(t *testing.T) {
+	metadata := []byte(strings.Repeat("m", PieceSize+5))
+	request := func(index int) []byte {
+		_, payload, _ := NewRequest(LocalID, index).ParseExtended()
+		return payload
+	}
+
+	tests := []struct {
+		name     string
+		payload  []byte
+		metadata []byte
+		expected string // payload of the reply, empty for none
+	}{
+		{"last piece", request(1), metadata, "d8:msg_typei1e5:piecei1e10:total_sizei16389eemmmmm"},
+		{"piece out of range", request(2), metadata, "d8:msg_typei2e5:piecei2ee"},
+		{"no metadata", request(0), nil, "d8:msg_typei2e5:piecei0ee"},
+		{"not a request", []byte("d8:msg_typei2e5:piecei0ee"), metadata, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			reply, err := Answer(tc.payload, 7, tc.metadata)
+			if err != nil {
+				t.Fatalf("Answer() returned error: %v", err)
+			}
+			if tc.expected == "" {
+				if reply != nil {
+					t.Errorf("expected no reply, got %s", reply)
+				}
+				return
+			}
+			id, payload, err := reply.ParseExtended()
+			if err != nil || id != 7 || string(payload) != tc.expected {
+				t.Errorf("reply = %d %q, %v, want 7 %q", id, payload, err, tc.expected)
+			}
+		})
+	}
+
+	if _, err := Answer([]byte("not bencode"), 7, metadata); err == nil {
+		t.Error("expected error for a malformed message, got nil")
+	}
+}
+
+// TestFetch downloads metadata spanning two pieces from a peer and verifies the result.
+func TestFetch(t *testing.T) {
+	metadata, magnet := testMetadata(t)
+	magnet.Trackers = []string{"http://tracker.example.com/announce"}
+	pc := connect(t, magnet.InfoHash, len(metadata), metadata)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mi, err := Fetch(ctx, pc, magnet)
+	if err != nil {
+		t.Fatalf("Fetch() returned error: %v", err)
+	}
+	if mi.InfoHash != magnet.InfoHash || mi.Info.Name != "metadata" || mi.Info.NumPieces() != 1000 {
+		t.Errorf("unexpected metadata: %x %q with %d pieces", mi.InfoHash, mi.Info.Name, mi.Info.NumPieces())
+	}
+	if mi.Announce != magnet.Trackers[0] {
+		t.Errorf("Announce = %q, want %q", mi.Announce, magnet.Trackers[0])
+	}
+}
+
+// TestFetchFailures ensures that peers without valid metadata are rejected.
+func TestFetchFailures(t *testing.T) {
+	metadata, magnet := testMetadata(t)
+	corrupt := []byte(strings.Replace(string(metadata), "metadata", "corrupts", 1))
+
+	tests := []struct {
+		name         string
+		metadataSize int
+		metadata     []byte
+		contains     string
+	}{
+		{"rejected", len(metadata), nil, "rejected"},
+		{"hash mismatch", len(corrupt), corrupt, "info hash mismatch"},
+		{"no size", 0, metadata, "invalid metadata size 0"},
+		{"too large", MaxSize + 1, metadata, "invalid metadata size"},
+		{"wrong size", len(metadata) - 1, metadata, "total size"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pc := connect(t, magnet.InfoHash, tc.metadataSize, tc.metadata)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err := Fetch(ctx, pc, magnet)
+			if err == nil || !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("expected error containing %q, got %v", tc.contains, err)
+			}
+		})
+	}
+}
+
+// TestFetchFromPeers skips an unreachable peer and fetches the metadata from the next one.
+func TestFetchFromPeers(t *testing.T) {
+	metadata, magnet := testMetadata(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			servePeer(conn, magnet.InfoHash, len(metadata), metadata)
+		}
+	}()
+
+	// a closed listener yields a port nobody listens on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed.Close()
+
+	peers := []netip.AddrPort{
+		closed.Addr().(*net.TCPAddr).AddrPort(),
+		listener.Addr().(*net.TCPAddr).AddrPort(),
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mi, err := FetchFromPeers(ctx, magnet, peers, peer.Config{PeerID: testPeerID})
+	if err != nil {
+		t.Fatalf("FetchFromPeers() returned error: %v", err)
+	}
+	if mi.InfoHash != magnet.InfoHash {
+		t.Errorf("InfoHash = %x, want %x", mi.InfoHash, magnet.InfoHash)
+	}
+
+	if _, err := FetchFromPeers(ctx, magnet, nil, peer.Config{PeerID: testPeerID}); err == nil {
+		t.Error("expected error without peers, got nil")
+	}
+}
@@ -0,0 +1,387 @@
+// Package mse implements Message Stream Encryption, also known as protocol encryption (PE),
+// which obfuscates BitTorrent peer connections so they cannot be told apart from random
+// traffic by the ISPs that throttle or block them.
+//
+// Both sides agree on a shared secret with a Diffie-Hellman key exchange, prove that they
+// know the info hash of the torrent without revealing it, and negotiate whether the rest of
+// the connection is RC4-encrypted or sent in plaintext. Random padding hides the lengths of
+// the handshake messages.
+//
+// Reference: https://wiki.vuze.com/w/Message_Stream_Encryption
+package mse
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+)
+
+// CryptoMethod is a set of stream encryption methods, as offered in crypto_provide and
+// picked in crypto_select.
+type CryptoMethod uint32
+
+// crypto methods defined by the specification
+const (
+	CryptoPlaintext CryptoMethod = 0x01 // only the handshake is encrypted
+	CryptoRC4       CryptoMethod = 0x02 // the whole stream is RC4-encrypted
+)
+
+// Policy decides whether peer connections use encryption.
+type Policy int
+
+const (
+	// Disabled connects in plaintext, without the encryption handshake.
+	Disabled Policy = iota
+	// Preferred connects with the encryption handshake, offering both RC4 and plaintext,
+	// and falls back to a plaintext connection if the peer does not support it.
+	Preferred
+	// Required only accepts RC4-encrypted connections.
+	Required
+)
+
+// ParsePolicy returns the policy named by s: "disabled", "preferred" or "required".
+func ParsePolicy(s string) (Policy, error) {
+	for p := Disabled; p <= Required; p++ {
+		if p.String() == s {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown encryption policy %q", s)
+}
+
+func (p Policy) String() string {
+	switch p {
+	case Disabled:
+		return "disabled"
+	case Preferred:
+		return "preferred"
+	case Required:
+		return "required"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+// Provide returns the crypto methods offered under the policy, zero if encryption is disabled.
+func (p Policy) Provide() CryptoMethod {
+	switch p {
+	case Preferred:
+		return CryptoRC4 | CryptoPlaintext
+	case Required:
+		return CryptoRC4
+	}
+	return 0
+}
+
+// sizes of the handshake fields
+const (
+	keySize    = 96  // Diffie-Hellman public keys and shared secret, 768 bits
+	privSize   = 20  // private keys, 160 bits as the specification recommends
+	maxPadding = 512 // longest padding allowed anywhere in the handshake
+	discard    = 1024
+)
+
+var (
+	// prime is the 768-bit Diffie-Hellman modulus P. The generator G is 2.
+	prime, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74"+
+		"020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7"+
+		"EC6F44C42E9A63A36210000000000090563", 16)
+	generator = big.NewInt(2)
+
+	// vc is the verification constant, whose encrypted form marks the end of the padding.
+	vc [8]byte
+)
+
+// Initiate runs the initiating side of the handshake over conn for the torrent with the given
+// info hash, offering the crypto methods in provide. The initial payload is sent encrypted along
+// with the handshake and may be empty.
+//
+// It returns a connection carrying the rest of the stream, encrypted or not as the peer chose,
+// and the chosen method. It returns an error if the peer does not speak MSE, does not know the
+// torrent or picks a method that was not offered; conn is not closed.
+func Initiate(conn net.Conn, infoHash [20]byte, provide CryptoMethod, initialPayload []byte) (net.Conn, CryptoMethod, error) {
+	if provide == 0 {
+		return nil, 0, errors.New("no crypto method to provide")
+	}
+	if len(initialPayload) > 0xffff {
+		return nil, 0, fmt.Errorf("initial payload of %d bytes is too long", len(initialPayload))
+	}
+	r := bufio.NewReader(conn)
+
+	priv, pub, err := newKeyPair()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := writePadded(conn, pub); err != nil {
+		return nil, 0, fmt.Errorf("sending public key: %w", err)
+	}
+	secret, err := readSecret(r, priv)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	enc := newCipher("keyA", secret, infoHash)
+	dec := newCipher("keyB", secret, infoHash)
+
+	// HASH('req1', S), HASH('req2', SKEY) xor HASH('req3', S), ENCRYPT(VC, crypto_provide, len(PadC), PadC, len(IA)), ENCRYPT(IA)
+	var msg bytes.Buffer
+	req1 := hash("req1", secret)
+	msg.Write(req1[:])
+	msg.Write(xor(hash("req2", infoHash[:]), hash("req3", secret)))
+	plain := binary.BigEndian.AppendUint32(vc[:], uint32(provide))
+	plain = binary.BigEndian.AppendUint16(plain, 0) // no PadC, the lengths are already hidden by PadA
+	plain = binary.BigEndian.AppendUint16(plain, uint16(len(initialPayload)))
+	plain = append(plain, initialPayload...)
+	enc.XORKeyStream(plain, plain)
+	msg.Write(plain)
+	if _, err := conn.Write(msg.Bytes()); err != nil {
+		return nil, 0, fmt.Errorf("sending crypto offer: %w", err)
+	}
+
+	// PadB, ENCRYPT(VC, crypto_select, len(padD), padD)
+	mark := make([]byte, len(vc))
+	dec.XORKeyStream(mark, vc[:])
+	if err := sync(r, mark, maxPadding); err != nil {
+		return nil, 0, err
+	}
+	var reply [6]byte
+	if _, err := io.ReadFull(r, reply[:]); err != nil {
+		return nil, 0, fmt.Errorf("reading crypto select: %w", err)
+	}
+	dec.XORKeyStream(reply[:], reply[:])
+	selected := CryptoMethod(binary.BigEndian.Uint32(reply[:4]))
+	if selected != CryptoPlaintext && selected != CryptoRC4 || selected&provide == 0 {
+		return nil, 0, fmt.Errorf("peer selected crypto method %#x, provided %#x", uint32(selected), uint32(provide))
+	}
+	if err := skipPadding(r, dec, binary.BigEndian.Uint16(reply[4:])); err != nil {
+		return nil, 0, err
+	}
+
+	return newConn(conn, r, selected, enc, dec), selected, nil
+}
+
+// Accept runs the receiving side of the handshake over conn. The initiator must name one of the
+// info hashes in infoHashes, and the method picked is RC4 if both sides allow it, plaintext
+// otherwise, among the methods in allow.
+//
+// It returns a connection carrying the rest of the stream, whose reads start with the initial
+// payload sent by the initiator, and the info hash it named. conn is not closed on error.
+func Accept(conn net.Conn, infoHashes [][20]byte, allow CryptoMethod) (net.Conn, [20]byte, error) {
+	r := bufio.NewReader(conn)
+
+	var pubA [keySize]byte
+	if _, err := io.ReadFull(r, pubA[:]); err != nil {
+		return nil, [20]byte{}, fmt.Errorf("reading public key: %w", err)
+	}
+	priv, pub, err := newKeyPair()
+	if err != nil {
+		return nil, [20]byte{}, err
+	}
+	if err := writePadded(conn, pub); err != nil {
+		return nil, [20]byte{}, fmt.Errorf("sending public key: %w", err)
+	}
+	secret := sharedSecret(pubA[:], priv)
+
+	req1 := hash("req1", secret)
+	if err := sync(r, req1[:], maxPadding); err != nil {
+		return nil, [20]byte{}, err
+	}
+	var obfuscated [20]byte
+	if _, err := io.ReadFull(r, obfuscated[:]); err != nil {
+		return nil, [20]byte{}, fmt.Errorf("reading info hash: %w", err)
+	}
+	req2 := xor(hash("req3", secret), obfuscated)
+	var infoHash [20]byte
+	found := false
+	for _, candidate := range infoHashes {
+		if want := hash("req2", candidate[:]); bytes.Equal(req2, want[:]) {
+			infoHash, found = candidate, true
+			break
+		}
+	}
+	if !found {
+		return nil, [20]byte{}, errors.New("peer requested an unknown torrent")
+	}
+
+	dec := newCipher("keyA", secret, infoHash)
+	enc := newCipher("keyB", secret, infoHash)
+
+	var offer [14]byte // VC, crypto_provide, len(PadC)
+	if _, err := io.ReadFull(r, offer[:]); err != nil {
+		return nil, [20]byte{}, fmt.Errorf("reading crypto offer: %w", err)
+	}
+	dec.XORKeyStream(offer[:], offer[:])
+	if !bytes.Equal(offer[:8], vc[:]) {
+		return nil, [20]byte{}, errors.New("invalid verification constant")
+	}
+	provided := CryptoMethod(binary.BigEndian.Uint32(offer[8:12]))
+	if err := skipPadding(r, dec, binary.BigEndian.Uint16(offer[12:])); err != nil {
+		return nil, [20]byte{}, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, [20]byte{}, fmt.Errorf("reading initial payload: %w", err)
+	}
+	dec.XORKeyStream(length[:], length[:])
+	initialPayload := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, initialPayload); err != nil {
+		return nil, [20]byte{}, fmt.Errorf("reading initial payload: %w", err)
+	}
+	dec.XORKeyStream(initialPayload, initialPayload)
+
+	var selected CryptoMethod
+	switch common := provided & allow; {
+	case common&CryptoRC4 != 0:
+		selected = CryptoRC4
+	case common&CryptoPlaintext != 0:
+		selected = CryptoPlaintext
+	default:
+		return nil, [20]byte{}, fmt.Errorf("no common crypto method, peer provided %#x", uint32(provided))
+	}
+
+	reply := binary.BigEndian.AppendUint32(vc[:], uint32(selected))
+	reply = binary.BigEndian.AppendUint16(reply, 0) // no PadD
+	enc.XORKeyStream(reply, reply)
+	if _, err := conn.Write(reply); err != nil {
+		return nil, [20]byte{}, fmt.Errorf("sending crypto select: %w", err)
+	}
+
+	c := newConn(conn, r, selected, enc, dec)
+	c.r = io.MultiReader(bytes.NewReader(initialPayload), c.r)
+	return c, infoHash, nil
+}
+
+// Conn is a peer connection after a successful handshake. Reads and writes are decrypted and
+// encrypted if RC4 was selected, and pass through otherwise. Writes are not safe for
+// concurrent use.
+type Conn struct {
+	net.Conn
+	r io.Reader
+	w io.Writer
+}
+
+func newConn(conn net.Conn, r *bufio.Reader, selected CryptoMethod, enc, dec cipher.Stream) *Conn {
+	if selected == CryptoPlaintext {
+		return &Conn{Conn: conn, r: r, w: conn}
+	}
+	return &Conn{
+		Conn: conn,
+		r:    cipher.StreamReader{S: dec, R: r},
+		w:    cipher.StreamWriter{S: enc, W: conn},
+	}
+}
+
+// Read implements net.Conn.
+func (c *Conn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Write implements net.Conn.
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// newKeyPair returns a random private key and the matching public key.
+func newKeyPair() (*big.Int, *big.Int, error) {
+	var b [privSize]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, nil, fmt.Errorf("generating private key: %w", err)
+	}
+	priv := new(big.Int).SetBytes(b[:])
+	return priv, new(big.Int).Exp(generator, priv, prime), nil
+}
+
+// readSecret reads the peer's public key from r and returns the shared secret.
+func readSecret(r io.Reader, priv *big.Int) ([]byte, error) {
+	var pub [keySize]byte
+	if _, err := io.ReadFull(r, pub[:]); err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	return sharedSecret(pub[:], priv), nil
+}
+
+// sharedSecret returns the Diffie-Hellman secret S, padded to keySize bytes.
+func sharedSecret(pub []byte, priv *big.Int) []byte {
+	s := new(big.Int).Exp(new(big.Int).SetBytes(pub), priv, prime)
+	return s.FillBytes(make([]byte, keySize))
+}
+
+// writePadded writes the public key followed by up to maxPadding random bytes.
+func writePadded(w io.Writer, pub *big.Int) error {
+	n, err := rand.Int(rand.Reader, big.NewInt(maxPadding+1))
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, keySize+int(n.Int64()))
+	pub.FillBytes(buf[:keySize])
+	if _, err := rand.Read(buf[keySize:]); err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// sync consumes r up to and including mark, which must follow at most maxSkip bytes of padding.
+func sync(r *bufio.Reader, mark []byte, maxSkip int) error {
+	window := make([]byte, 0, maxSkip+len(mark))
+	for len(window) < cap(window) {
+		b, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("synchronizing handshake: %w", err)
+		}
+		window = append(window, b)
+		if bytes.HasSuffix(window, mark) {
+			return nil
+		}
+	}
+	return errors.New("synchronizing handshake: marker not found")
+}
+
+// skipPadding reads and decrypts n bytes of padding, which must not exceed maxPadding.
+func skipPadding(r io.Reader, dec cipher.Stream, n uint16) error {
+	if n > maxPadding {
+		return fmt.Errorf("padding of %d bytes is too long", n)
+	}
+	pad := make([]byte, n)
+	if _, err := io.ReadFull(r, pad); err != nil {
+		return fmt.Errorf("reading padding: %w", err)
+	}
+	dec.XORKeyStream(pad, pad)
+	return nil
+}
+
+// newCipher returns the RC4 stream keyed with HASH(name, S, SKEY), its first 1024 bytes discarded.
+func newCipher(name string, secret []byte, infoHash [20]byte) cipher.Stream {
+	key := hash(name, secret, infoHash[:])
+	c, _ := rc4.NewCipher(key[:]) // cannot fail, the key is 20 bytes
+	var skip [discard]byte
+	c.XORKeyStream(skip[:], skip[:])
+	return c
+}
+
+// hash returns the SHA-1 of the concatenation of prefix and parts.
+func hash(prefix string, parts ...[]byte) [20]byte {
+	h := sha1.New()
+	h.Write([]byte(prefix))
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return [20]byte(h.Sum(nil))
+}
+
+// xor returns a xor b.
+func xor(a, b [20]byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
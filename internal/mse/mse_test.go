@@ -0,0 +1,168 @@
+package mse
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+var testInfoHash = [20]byte([]byte(strings.Repeat("i", 20)))
+
+type acceptResult struct {
+	conn     net.Conn
+	infoHash [20]byte
+	err      error
+}
+
+// accept runs the receiving side of the handshake over conn in the background.
+func accept(conn net.Conn, infoHashes [][20]byte, allow CryptoMethod) <-chan acceptResult {
+	done := make(chan acceptResult, 1)
+	go func() {
+		c, infoHash, err := Accept(conn, infoHashes, allow)
+		done <- acceptResult{c, infoHash, err}
+	}()
+	return done
+}
+
+// TestHandshake checks that both sides agree on the crypto method and then exchange data,
+// starting with the initial payload.
+func TestHandshake(t *testing.T) {
+	tests := []struct {
+		name    string
+		provide CryptoMethod
+		allow   CryptoMethod
+		want    CryptoMethod
+	}{
+		{name: "rc4 preferred", provide: CryptoRC4 | CryptoPlaintext, allow: CryptoRC4 | CryptoPlaintext, want: CryptoRC4},
+		{name: "rc4 only", provide: CryptoRC4, allow: CryptoRC4 | CryptoPlaintext, want: CryptoRC4},
+		{name: "receiver wants plaintext", provide: CryptoRC4 | CryptoPlaintext, allow: CryptoPlaintext, want: CryptoPlaintext},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+			defer remote.Close()
+
+			done := accept(remote, [][20]byte{{1}, testInfoHash}, tc.allow)
+			conn, selected, err := Initiate(local, testInfoHash, tc.provide, []byte("initial"))
+			if err != nil {
+				t.Fatalf("Initiate() returned error: %v", err)
+			}
+			res := <-done
+			if res.err != nil {
+				t.Fatalf("Accept() returned error: %v", res.err)
+			}
+			if selected != tc.want {
+				t.Errorf("selected = %#x, want %#x", selected, tc.want)
+			}
+			if res.infoHash != testInfoHash {
+				t.Errorf("info hash = %x, want %x", res.infoHash, testInfoHash)
+			}
+
+			go conn.Write([]byte(" payload"))
+			got := make([]byte, len("initial payload"))
+			if _, err := io.ReadFull(res.conn, got); err != nil {
+				t.Fatalf("reading from the receiver: %v", err)
+			}
+			if string(got) != "initial payload" {
+				t.Errorf("receiver read %q, want %q", got, "initial payload")
+			}
+
+			go res.conn.Write([]byte("reply"))
+			got = make([]byte, len("reply"))
+			if _, err := io.ReadFull(conn, got); err != nil {
+				t.Fatalf("reading from the initiator: %v", err)
+			}
+			if string(got) != "reply" {
+				t.Errorf("initiator read %q, want %q", got, "reply")
+			}
+		})
+	}
+}
+
+// TestHandshakeEncrypts checks that RC4 streams do not carry the data in plaintext.
+func TestHandshakeEncrypts(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	done := accept(remote, [][20]byte{testInfoHash}, CryptoRC4)
+	conn, _, err := Initiate(local, testInfoHash, CryptoRC4, nil)
+	if err != nil {
+		t.Fatalf("Initiate() returned error: %v", err)
+	}
+	if res := <-done; res.err != nil {
+		t.Fatalf("Accept() returned error: %v", res.err)
+	}
+
+	secret := []byte("BitTorrent protocol")
+	go conn.Write(secret)
+	got := make([]byte, len(secret))
+	if _, err := io.ReadFull(remote, got); err != nil {
+		t.Fatalf("reading raw stream: %v", err)
+	}
+	if bytes.Equal(got, secret) {
+		t.Error("stream was sent in plaintext")
+	}
+}
+
+// TestHandshakeRejected checks that the handshake fails when the sides cannot agree.
+func TestHandshakeRejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		infoHashes [][20]byte
+		provide    CryptoMethod
+		allow      CryptoMethod
+	}{
+		{name: "unknown torrent", infoHashes: [][20]byte{{1}}, provide: CryptoRC4, allow: CryptoRC4},
+		{name: "no common method", infoHashes: [][20]byte{testInfoHash}, provide: CryptoRC4, allow: CryptoPlaintext},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer local.Close()
+
+			done := accept(remote, tc.infoHashes, tc.allow)
+			go func() {
+				<-done
+				remote.Close() // the initiator is left waiting for a reply
+			}()
+			if _, _, err := Initiate(local, testInfoHash, tc.provide, nil); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestInitiatePlaintextPeer checks that the handshake fails against a peer that does not
+// speak MSE and answers with a BitTorrent handshake.
+func TestInitiatePlaintextPeer(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+
+	go io.Copy(io.Discard, remote)
+	go func() {
+		defer remote.Close()
+		remote.Write(append([]byte{19}, "BitTorrent protocol"+strings.Repeat("\x00", 48)...))
+	}()
+	if _, _, err := Initiate(local, testInfoHash, CryptoRC4|CryptoPlaintext, nil); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
+
+// TestParsePolicy checks that every policy round-trips through its name.
+func TestParsePolicy(t *testing.T) {
+	for _, p := range []Policy{Disabled, Preferred, Required} {
+		got, err := ParsePolicy(p.String())
+		if err != nil || got != p {
+			t.Errorf("ParsePolicy(%q) = %v, %v, want %v", p.String(), got, err, p)
+		}
+	}
+	if _, err := ParsePolicy("sometimes"); err == nil {
+		t.Error("expected error for an unknown policy, got nil")
+	}
+}
@@ -0,0 +1,474 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/logging"
+	"github.com/lcsabi/gobit/internal/mse"
+	"github.com/lcsabi/gobit/internal/peerid"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// DefaultHandshakeTimeout bounds the handshake when Config.HandshakeTimeout is zero.
+const DefaultHandshakeTimeout = 10 * time.Second
+
+// messageBuffer is the number of incoming messages buffered before the read loop blocks.
+const messageBuffer = 32
+
+// Config holds the parameters of a peer connection.
+type Config struct {
+	InfoHash infohash.V1 // info hash of the torrent, which the peer must confirm
+	PeerID   [20]byte    // ID of this client
+	Reserved [8]byte     // extension bits advertised in our handshake
+
+	// RequiredReserved lists the extension bits the peer must advertise, the connection
+	// is rejected otherwise. Zero accepts any peer.
+	RequiredReserved [8]byte
+
+	// NumPieces is the number of pieces of the torrent, used to validate and track the
+	// pieces the peer has. Zero disables tracking.
+	NumPieces int
+
+	// Encryption decides whether Dial runs the MSE handshake before the BitTorrent one.
+	// The zero value, mse.Disabled, connects in plaintext.
+	Encryption mse.Policy
+
+	HandshakeTimeout time.Duration // zero means DefaultHandshakeTimeout
+	Logger           *slog.Logger  // logging.For(logging.Peer) if nil
+}
+
+// PeerConn is an established connection to a peer after a successful handshake.
+// It tracks the choking and interest state of both sides and the pieces the peer has,
+// and delivers every incoming message other than keep-alives through Messages.
+//
+// Both sides start out choking and not interested. The state is updated as messages are
+// sent through PeerConn and received from the peer, before they are delivered.
+type PeerConn struct {
+	conn     net.Conn
+	remote   Handshake
+	logger   *slog.Logger
+	messages chan *Message
+
+	writeMu sync.Mutex // serializes writes to conn
+
+	mu             sync.Mutex
+	amChoking      bool
+	amInterested   bool
+	peerChoking    bool
+	peerInterested bool
+	have           torrent.Bitfield // pieces the peer has, nil if not tracked
+	numPieces      int
+	extensions     *ExtensionHandshake // the peer's extension handshake, nil until received
+	err            error               // why the read loop stopped
+
+	closed    chan struct{} // closed by Close to release a blocked read loop
+	closeOnce sync.Once
+}
+
+// Dial connects to the peer at addr and performs the handshake.
+//
+// Unless cfg.Encryption is mse.Disabled, the connection is encrypted first. If the peer does
+// not speak MSE and encryption is only preferred, Dial reconnects and falls back to plaintext.
+func Dial(ctx context.Context, addr netip.AddrPort, cfg Config) (*PeerConn, error) {
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Encryption != mse.Disabled {
+		encrypted, err := encrypt(conn, cfg)
+		if err != nil {
+			conn.Close()
+			if cfg.Encryption == mse.Required {
+				return nil, fmt.Errorf("encrypting connection to %s: %w", addr, err)
+			}
+			logging.Or(cfg.Logger, logging.Peer).Debug("encryption failed, retrying in plaintext", "peer", addr.String(), "error", err)
+			if conn, err = dial(ctx, addr); err != nil {
+				return nil, err
+			}
+		} else {
+			conn = encrypted
+		}
+	}
+
+	pc, err := NewPeerConn(conn, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return pc, nil
+}
+
+func dial(ctx context.Context, addr netip.AddrPort) (net.Conn, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr.String())
+	if err != nil {
+		return nil, fmt.Errorf("dialing peer %s: %w", addr, err)
+	}
+	return conn, nil
+}
+
+// encrypt runs the MSE handshake over conn, offering the crypto methods of cfg.Encryption.
+func encrypt(conn net.Conn, cfg Config) (net.Conn, error) {
+	timeout := cfg.HandshakeTimeout
+	if timeout == 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	encrypted, _, err := mse.Initiate(conn, cfg.InfoHash, cfg.Encryption.Provide(), nil)
+	return encrypted, err
+}
+
+// NewPeerConn performs the handshake over an established connection, sending ours first,
+// and starts reading messages. The connection is owned by the returned PeerConn.
+//
+// It returns an error if the peer's handshake names another torrent, lacks one of the
+// required extension bits or carries our own peer ID.
+func NewPeerConn(conn net.Conn, cfg Config) (*PeerConn, error) {
+	timeout := cfg.HandshakeTimeout
+	if timeout == 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	local := Handshake{Reserved: cfg.Reserved, InfoHash: cfg.InfoHash, PeerID: cfg.PeerID}
+	if _, err := local.WriteTo(conn); err != nil {
+		return nil, fmt.Errorf("sending handshake: %w", err)
+	}
+	remote, err := ReadHandshake(conn)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateHandshake(remote, cfg); err != nil {
+		return nil, err
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return newPeerConn(conn, remote, cfg), nil
+}
+
+// AcceptPeerConn completes the handshake of an inbound connection whose handshake, remote,
+// was already read to find the torrent it is for. It sends our handshake after validating the
+// peer's, and starts reading messages. The connection is owned by the returned PeerConn.
+//
+// The peer's handshake is validated like in NewPeerConn.
+func AcceptPeerConn(conn net.Conn, remote Handshake, cfg Config) (*PeerConn, error) {
+	if err := validateHandshake(remote, cfg); err != nil {
+		return nil, err
+	}
+	timeout := cfg.HandshakeTimeout
+	if timeout == 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	local := Handshake{Reserved: cfg.Reserved, InfoHash: cfg.InfoHash, PeerID: cfg.PeerID}
+	if _, err := local.WriteTo(conn); err != nil {
+		return nil, fmt.Errorf("sending handshake: %w", err)
+	}
+
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return newPeerConn(conn, remote, cfg), nil
+}
+
+// validateHandshake checks the handshake received from the peer against cfg.
+func validateHandshake(remote Handshake, cfg Config) error {
+	if remote.InfoHash != cfg.InfoHash {
+		return fmt.Errorf("peer handshake is for info hash %x, expected %x", remote.InfoHash, cfg.InfoHash)
+	}
+	for i, required := range cfg.RequiredReserved {
+		if remote.Reserved[i]&required != required {
+			return fmt.Errorf("peer does not support the required extension bits %x", cfg.RequiredReserved)
+		}
+	}
+	if remote.PeerID == cfg.PeerID {
+		return errors.New("connected to ourselves")
+	}
+	return nil
+}
+
+func newPeerConn(conn net.Conn, remote Handshake, cfg Config) *PeerConn {
+	logger := logging.Or(cfg.Logger, logging.Peer)
+
+	pc := &PeerConn{
+		conn:        conn,
+		remote:      remote,
+		logger:      logger.With("peer", conn.RemoteAddr().String()),
+		messages:    make(chan *Message, messageBuffer),
+		closed:      make(chan struct{}),
+		amChoking:   true,
+		peerChoking: true,
+		numPieces:   cfg.NumPieces,
+	}
+	if cfg.NumPieces > 0 {
+		pc.have = torrent.NewBitfield(cfg.NumPieces)
+	}
+
+	go pc.readLoop()
+	return pc
+}
+
+// PeerID returns the ID the peer sent in its handshake.
+func (pc *PeerConn) PeerID() [20]byte {
+	return pc.remote.PeerID
+}
+
+// Client identifies the software of the peer from its peer ID. It reports false if the
+// client is not recognized, in which case the name is "unknown".
+func (pc *PeerConn) Client() (peerid.Client, bool) {
+	if c, ok := peerid.Identify(pc.remote.PeerID); ok {
+		return c, true
+	}
+	return peerid.Client{Name: "unknown"}, false
+}
+
+// Reserved returns the extension bits the peer sent in its handshake.
+func (pc *PeerConn) Reserved() [8]byte {
+	return pc.remote.Reserved
+}
+
+// RemoteAddr returns the network address of the peer.
+func (pc *PeerConn) RemoteAddr() net.Addr {
+	return pc.conn.RemoteAddr()
+}
+
+// Messages returns the channel delivering incoming messages. It is closed when the connection
+// fails or is closed, after which Err reports the reason. Reading must keep up with the peer,
+// since the connection stops reading while the channel is full.
+func (pc *PeerConn) Messages() <-chan *Message {
+	return pc.messages
+}
+
+// Err returns the error that stopped the connection, or nil while it is still running.
+// It returns net.ErrClosed after Close.
+func (pc *PeerConn) Err() error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.err
+}
+
+// AmChoking reports whether we are choking the peer.
+func (pc *PeerConn) AmChoking() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.amChoking
+}
+
+// AmInterested reports whether we are interested in the peer.
+func (pc *PeerConn) AmInterested() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.amInterested
+}
+
+// PeerChoking reports whether the peer is choking us.
+func (pc *PeerConn) PeerChoking() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.peerChoking
+}
+
+// PeerInterested reports whether the peer is interested in us.
+func (pc *PeerConn) PeerInterested() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.peerInterested
+}
+
+// PeerHas reports whether the peer announced the piece at index.
+// It is always false if Config.NumPieces was zero.
+func (pc *PeerConn) PeerHas(index int) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.have.Has(index)
+}
+
+// PeerBitfield returns a copy of the pieces the peer announced, or nil if not tracked.
+func (pc *PeerConn) PeerBitfield() torrent.Bitfield {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.have == nil {
+		return nil
+	}
+	return bytes.Clone(pc.have)
+}
+
+// PeerExtensions returns the extension handshake received from the peer, or false if it has
+// not sent one yet.
+func (pc *PeerConn) PeerExtensions() (ExtensionHandshake, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.extensions == nil {
+		return ExtensionHandshake{}, false
+	}
+	return *pc.extensions, true
+}
+
+// Send writes m to the peer, updating our choking and interest state for the corresponding
+// messages. A nil message is sent as a keep-alive.
+func (pc *PeerConn) Send(m *Message) error {
+	pc.writeMu.Lock()
+	defer pc.writeMu.Unlock()
+
+	// the state is updated first, so it is current by the time the peer can react
+	if m != nil {
+		pc.mu.Lock()
+		switch m.ID {
+		case MsgChoke:
+			pc.amChoking = true
+		case MsgUnchoke:
+			pc.amChoking = false
+		case MsgInterested:
+			pc.amInterested = true
+		case MsgNotInterested:
+			pc.amInterested = false
+		}
+		pc.mu.Unlock()
+	}
+
+	if _, err := m.WriteTo(pc.conn); err != nil {
+		return fmt.Errorf("sending %s: %w", m, err)
+	}
+	return nil
+}
+
+// Choke tells the peer that we will not serve its requests.
+func (pc *PeerConn) Choke() error { return pc.Send(&Message{ID: MsgChoke}) }
+
+// Unchoke tells the peer that we will serve its requests.
+func (pc *PeerConn) Unchoke() error { return pc.Send(&Message{ID: MsgUnchoke}) }
+
+// Interested tells the peer that we want pieces it has.
+func (pc *PeerConn) Interested() error { return pc.Send(&Message{ID: MsgInterested}) }
+
+// NotInterested tells the peer that we do not want any of its pieces.
+func (pc *PeerConn) NotInterested() error { return pc.Send(&Message{ID: MsgNotInterested}) }
+
+// Close closes the connection. Messages is closed once the read loop has stopped.
+func (pc *PeerConn) Close() error {
+	var err error
+	pc.closeOnce.Do(func() {
+		pc.setErr(net.ErrClosed)
+		close(pc.closed)
+		err = pc.conn.Close()
+	})
+	return err
+}
+
+func (pc *PeerConn) readLoop() {
+	defer close(pc.messages)
+	for {
+		m, err := ReadMessage(pc.conn)
+		if err != nil {
+			pc.fail(err)
+			return
+		}
+		if m == nil {
+			continue // keep-alive
+		}
+		if err := pc.handle(m); err != nil {
+			pc.fail(err)
+			return
+		}
+		select {
+		case pc.messages <- m:
+		case <-pc.closed:
+			return
+		}
+	}
+}
+
+// handle updates the connection state for an incoming message.
+func (pc *PeerConn) handle(m *Message) error {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	switch m.ID {
+	case MsgChoke:
+		pc.peerChoking = true
+	case MsgUnchoke:
+		pc.peerChoking = false
+	case MsgInterested:
+		pc.peerInterested = true
+	case MsgNotInterested:
+		pc.peerInterested = false
+
+	case MsgHave:
+		index, err := m.ParseHave()
+		if err != nil {
+			return err
+		}
+		if pc.have != nil {
+			if int64(index) >= int64(pc.numPieces) {
+				return fmt.Errorf("peer announced piece %d of %d", index, pc.numPieces)
+			}
+			pc.have.Set(int(index))
+		}
+
+	case MsgBitfield:
+		if pc.have != nil {
+			if len(m.Payload) != len(pc.have) {
+				return fmt.Errorf("invalid bitfield length %d, expected %d", len(m.Payload), len(pc.have))
+			}
+			bitfield := torrent.Bitfield(bytes.Clone(m.Payload))
+			for i := pc.numPieces; i < len(bitfield)*8; i++ {
+				if bitfield.Has(i) {
+					return errors.New("bitfield has spare bits set")
+				}
+			}
+			pc.have = bitfield
+		}
+
+	case MsgExtended:
+		id, payload, err := m.ParseExtended()
+		if err != nil {
+			return err
+		}
+		if id == ExtensionHandshakeID {
+			h, err := ParseExtensionHandshake(payload)
+			if err != nil {
+				return err
+			}
+			pc.extensions = &h
+		}
+	}
+	return nil
+}
+
+// fail records err as the reason the connection stopped, unless it was closed deliberately.
+func (pc *PeerConn) fail(err error) {
+	if pc.setErr(err) {
+		pc.logger.Debug("peer connection failed", "error", err)
+	}
+	pc.conn.Close()
+}
+
+// setErr records err unless an error was already recorded, reporting whether it did.
+func (pc *PeerConn) setErr(err error) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.err != nil {
+		return false
+	}
+	pc.err = err
+	return true
+}
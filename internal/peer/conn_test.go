@@ -0,0 +1,312 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/mse"
+)
+
+var (
+	testInfoHash = [20]byte([]byte(strings.Repeat("i", 20)))
+	testLocalID  = [20]byte([]byte("-GB0001-localpeer000"))
+	testRemoteID = [20]byte([]byte("-XX0001-remotepeer00"))
+)
+
+// remotePeer runs the remote side of a handshake over conn with the given handshake,
+// reporting failures through the returned channel.
+func remotePeer(conn net.Conn, h Handshake) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		if _, err := ReadHandshake(conn); err != nil {
+			done <- err
+			return
+		}
+		_, err := h.WriteTo(conn)
+		done <- err
+	}()
+	return done
+}
+
+// connectPipe returns a PeerConn handshaken over an in-memory pipe and the remote end of the pipe.
+func connectPipe(t *testing.T, cfg Config) (*PeerConn, net.Conn) {
+	t.Helper()
+	local, remote := net.Pipe()
+	t.Cleanup(func() { remote.Close() })
+
+	done := remotePeer(remote, Handshake{InfoHash: testInfoHash, PeerID: testRemoteID})
+	pc, err := NewPeerConn(local, cfg)
+	if err != nil {
+		t.Fatalf("NewPeerConn() returned error: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("remote handshake failed: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return pc, remote
+}
+
+// receive returns the next message delivered by pc, failing the test after a timeout.
+func receive(t *testing.T, pc *PeerConn) *Message {
+	t.Helper()
+	select {
+	case m, ok := <-pc.Messages():
+		if !ok {
+			t.Fatalf("connection closed: %v", pc.Err())
+		}
+		return m
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+// TestPeerConnState verifies that incoming and outgoing messages update the connection state.
+func TestPeerConnState(t *testing.T) {
+	pc, remote := connectPipe(t, Config{InfoHash: testInfoHash, PeerID: testLocalID, NumPieces: 10})
+	if pc.PeerID() != testRemoteID {
+		t.Errorf("PeerID() = %q, want %q", pc.PeerID(), testRemoteID)
+	}
+	if !pc.AmChoking() || pc.AmInterested() || !pc.PeerChoking() || pc.PeerInterested() {
+		t.Fatal("expected both sides to start choking and not interested")
+	}
+
+	go func() {
+		for _, m := range []*Message{NewBitfield([]byte{0x80, 0x40}), nil, {ID: MsgUnchoke}, NewHave(3), {ID: MsgInterested}} {
+			m.WriteTo(remote)
+		}
+	}()
+	for _, expected := range []MessageID{MsgBitfield, MsgUnchoke, MsgHave, MsgInterested} {
+		if m := receive(t, pc); m.ID != expected {
+			t.Fatalf("received %s, want %s", m, expected)
+		}
+	}
+	if _, ok := pc.PeerExtensions(); ok {
+		t.Error("expected no extension handshake yet")
+	}
+	go func() {
+		handshake, _ := NewExtensionHandshake(ExtensionHandshake{M: map[string]int64{"ut_metadata": 3}})
+		handshake.WriteTo(remote)
+	}()
+	if m := receive(t, pc); m.ID != MsgExtended {
+		t.Fatalf("received %s, want extended", m)
+	}
+	if h, ok := pc.PeerExtensions(); !ok || h.M["ut_metadata"] != 3 {
+		t.Errorf("PeerExtensions() = %+v, %v, want ut_metadata with ID 3", h, ok)
+	}
+
+	if pc.PeerChoking() || !pc.PeerInterested() {
+		t.Error("expected the peer to be unchoking and interested")
+	}
+	for index, expected := range map[int]bool{0: true, 1: false, 3: true, 9: true} {
+		if pc.PeerHas(index) != expected {
+			t.Errorf("PeerHas(%d) = %v, want %v", index, !expected, expected)
+		}
+	}
+
+	go func() {
+		if err := pc.Interested(); err != nil {
+			t.Errorf("Interested() returned error: %v", err)
+		}
+	}()
+	if m, err := ReadMessage(remote); err != nil || m.ID != MsgInterested {
+		t.Fatalf("remote read %s, %v, want interested", m, err)
+	}
+	if !pc.AmInterested() {
+		t.Error("expected AmInterested() after sending interested")
+	}
+
+	pc.Close()
+	if _, ok := <-pc.Messages(); ok {
+		t.Error("expected Messages to be closed")
+	}
+	if !errors.Is(pc.Err(), net.ErrClosed) {
+		t.Errorf("Err() = %v, want net.ErrClosed", pc.Err())
+	}
+}
+
+// TestPeerConnInvalidMessages ensures that protocol violations stop the connection.
+func TestPeerConnInvalidMessages(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *Message
+	}{
+		{"bitfield of wrong length", NewBitfield([]byte{0xff})},
+		{"bitfield with spare bits", NewBitfield([]byte{0x00, 0x20})},
+		{"have out of range", NewHave(10)},
+		{"malformed have", &Message{ID: MsgHave, Payload: []byte{1}}},
+		{"extended without an ID", &Message{ID: MsgExtended}},
+		{"malformed extension handshake", NewExtended(ExtensionHandshakeID, []byte("d1:mi1ee"))},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pc, remote := connectPipe(t, Config{InfoHash: testInfoHash, PeerID: testLocalID, NumPieces: 10})
+			go tc.message.WriteTo(remote)
+
+			select {
+			case m, ok := <-pc.Messages():
+				if ok {
+					t.Fatalf("expected the connection to fail, received %s", m)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for the connection to fail")
+			}
+			if err := pc.Err(); err == nil || errors.Is(err, net.ErrClosed) {
+				t.Errorf("expected a protocol error, got %v", err)
+			}
+		})
+	}
+}
+
+// TestPeerConnHandshakeRejected checks the validation of the peer's handshake.
+func TestPeerConnHandshakeRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		remote Handshake
+		cfg    Config
+	}{
+		{
+			name:   "other torrent",
+			remote: Handshake{InfoHash: [20]byte{1}, PeerID: testRemoteID},
+			cfg:    Config{InfoHash: testInfoHash, PeerID: testLocalID},
+		},
+		{
+			name:   "missing extension bits",
+			remote: Handshake{InfoHash: testInfoHash, PeerID: testRemoteID, Reserved: [8]byte{5: 0x01}},
+			cfg:    Config{InfoHash: testInfoHash, PeerID: testLocalID, RequiredReserved: [8]byte{5: 0x10}},
+		},
+		{
+			name:   "ourselves",
+			remote: Handshake{InfoHash: testInfoHash, PeerID: testLocalID},
+			cfg:    Config{InfoHash: testInfoHash, PeerID: testLocalID},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer remote.Close()
+			defer local.Close()
+
+			remotePeer(remote, tc.remote)
+			if _, err := NewPeerConn(local, tc.cfg); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// listenPeer accepts connections on a local port and answers the handshake on each, running
+// the receiving side of the MSE handshake first if allow is not zero. Connections that fail
+// the MSE handshake or the BitTorrent one are closed.
+func listenPeer(t *testing.T, allow mse.CryptoMethod) netip.AddrPort {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			t.Cleanup(func() { conn.Close() })
+			if allow != 0 {
+				encrypted, _, err := mse.Accept(conn, [][20]byte{testInfoHash}, allow)
+				if err != nil {
+					conn.Close()
+					continue
+				}
+				conn = encrypted
+			}
+			go func() {
+				if err := <-remotePeer(conn, Handshake{InfoHash: testInfoHash, PeerID: testRemoteID}); err != nil {
+					conn.Close()
+				}
+			}()
+		}
+	}()
+	return netip.MustParseAddrPort(ln.Addr().String())
+}
+
+// TestDialEncryption checks the encryption policies of Dial against peers with and without
+// MSE support.
+func TestDialEncryption(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  mse.Policy
+		allow   mse.CryptoMethod // methods the peer accepts, zero if it does not speak MSE
+		wantErr bool
+	}{
+		{name: "disabled", policy: mse.Disabled},
+		{name: "preferred", policy: mse.Preferred, allow: mse.CryptoRC4 | mse.CryptoPlaintext},
+		{name: "preferred with plaintext peer", policy: mse.Preferred},
+		{name: "required", policy: mse.Required, allow: mse.CryptoRC4},
+		{name: "required with plaintext peer", policy: mse.Required, wantErr: true},
+		{name: "required with peer refusing rc4", policy: mse.Required, allow: mse.CryptoPlaintext, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			addr := listenPeer(t, tc.allow)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			pc, err := Dial(ctx, addr, Config{InfoHash: testInfoHash, PeerID: testLocalID, Encryption: tc.policy})
+			if tc.wantErr {
+				if err == nil {
+					pc.Close()
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Dial() returned error: %v", err)
+			}
+			defer pc.Close()
+			if pc.PeerID() != testRemoteID {
+				t.Errorf("PeerID() = %q, want %q", pc.PeerID(), testRemoteID)
+			}
+		})
+	}
+}
+
+// TestAcceptPeerConn checks the receiving side of the handshake.
+func TestAcceptPeerConn(t *testing.T) {
+	local, remote := net.Pipe()
+	defer remote.Close()
+
+	cfg := Config{InfoHash: testInfoHash, PeerID: testLocalID}
+	if _, err := AcceptPeerConn(local, Handshake{InfoHash: [20]byte{1}, PeerID: testRemoteID}, cfg); err == nil {
+		t.Error("expected error for a handshake of another torrent, got nil")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		h, err := ReadHandshake(remote)
+		if err == nil && h.PeerID != testLocalID {
+			err = errors.New("unexpected peer ID in our handshake")
+		}
+		done <- err
+	}()
+	pc, err := AcceptPeerConn(local, Handshake{InfoHash: testInfoHash, PeerID: testRemoteID}, cfg)
+	if err != nil {
+		t.Fatalf("AcceptPeerConn() returned error: %v", err)
+	}
+	defer pc.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("remote handshake failed: %v", err)
+	}
+	if pc.PeerID() != testRemoteID {
+		t.Errorf("PeerID() = %q, want %q", pc.PeerID(), testRemoteID)
+	}
+}
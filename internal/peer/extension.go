@@ -0,0 +1,85 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// ExtensionProtocol has the reserved handshake bit set that advertises support for the BEP 10
+// extension protocol. Use it in Config.Reserved, or Config.RequiredReserved to only accept
+// peers supporting extensions.
+//
+// Reference: https://bittorrent.org/beps/bep_0010.html
+var ExtensionProtocol = [8]byte{5: 0x10}
+
+// ExtensionHandshakeID is the extended message ID of the extension handshake.
+const ExtensionHandshakeID = 0
+
+// SupportsExtensions reports whether the reserved handshake bits advertise the extension protocol.
+func SupportsExtensions(reserved [8]byte) bool {
+	return reserved[5]&ExtensionProtocol[5] != 0
+}
+
+// ExtensionHandshake is the payload of the extension handshake, the first extended message
+// sent by each side. M maps the names of the supported extensions to the extended message ID
+// the sender wants to receive them with; an ID of 0 disables the extension.
+type ExtensionHandshake struct {
+	M            map[string]int64 `bencode:"m"`
+	Version      string           `bencode:"v,omitempty"`             // client name and version
+	Port         int64            `bencode:"p,omitempty"`             // listen port of the sender
+	Reqq         int64            `bencode:"reqq,omitempty"`          // number of outstanding requests the sender accepts
+	MetadataSize int64            `bencode:"metadata_size,omitempty"` // size of the info dictionary, BEP 9
+}
+
+// NewExtended returns an extended message with the given extended message ID and payload.
+func NewExtended(id uint8, payload []byte) *Message {
+	return &Message{ID: MsgExtended, Payload: append([]byte{id}, payload...)}
+}
+
+// NewExtensionHandshake returns the extended message carrying h.
+func NewExtensionHandshake(h ExtensionHandshake) (*Message, error) {
+	if h.M == nil {
+		h.M = map[string]int64{} // 'm' is required even without extensions
+	}
+	payload, err := bencode.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("encoding extension handshake: %w", err)
+	}
+	return NewExtended(ExtensionHandshakeID, payload), nil
+}
+
+// ParseExtended returns the extended message ID and payload of an extended message.
+// The payload shares memory with the message.
+func (m *Message) ParseExtended() (uint8, []byte, error) {
+	if m == nil || m.ID != MsgExtended {
+		return 0, nil, fmt.Errorf("expected extended message, got %s", m)
+	}
+	if len(m.Payload) == 0 {
+		return 0, nil, errors.New("extended message without an ID")
+	}
+	return m.Payload[0], m.Payload[1:], nil
+}
+
+// ParseExtensionHandshake decodes the payload of an extension handshake.
+func ParseExtensionHandshake(payload []byte) (ExtensionHandshake, error) {
+	var h ExtensionHandshake
+	if err := bencode.Unmarshal(payload, &h); err != nil {
+		return ExtensionHandshake{}, fmt.Errorf("decoding extension handshake: %w", err)
+	}
+	if h.M == nil {
+		return ExtensionHandshake{}, errors.New("extension handshake lacks the 'm' dictionary")
+	}
+	return h, nil
+}
+
+// ExtensionID returns the extended message ID the sender of h wants to receive the named
+// extension with, or false if it does not support it.
+func (h ExtensionHandshake) ExtensionID(name string) (uint8, bool) {
+	id, ok := h.M[name]
+	if !ok || id <= 0 || id > 255 {
+		return 0, false
+	}
+	return uint8(id), true
+}
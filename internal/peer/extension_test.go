@@ -0,0 +1,60 @@
+package peer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestExtensionHandshake round-trips an extension handshake and checks its encoding.
+func TestExtensionHandshake(t *testing.T) {
+	h := ExtensionHandshake{
+		M:            map[string]int64{"ut_metadata": 1, "ut_pex": 0},
+		Version:      "gobit 0.1",
+		MetadataSize: 31235,
+	}
+	m, err := NewExtensionHandshake(h)
+	if err != nil {
+		t.Fatalf("NewExtensionHandshake() returned error: %v", err)
+	}
+
+	id, payload, err := m.ParseExtended()
+	if err != nil || id != ExtensionHandshakeID {
+		t.Fatalf("ParseExtended() = %d, %v, want the handshake ID", id, err)
+	}
+	if expected := "d1:md11:ut_metadatai1e6:ut_pexi0ee13:metadata_sizei31235e1:v9:gobit 0.1e"; string(payload) != expected {
+		t.Errorf("payload = %q, want %q", payload, expected)
+	}
+
+	got, err := ParseExtensionHandshake(payload)
+	if err != nil {
+		t.Fatalf("ParseExtensionHandshake() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("ParseExtensionHandshake() = %+v, want %+v", got, h)
+	}
+
+	if id, ok := got.ExtensionID("ut_metadata"); !ok || id != 1 {
+		t.Errorf("ExtensionID(ut_metadata) = %d, %v, want 1", id, ok)
+	}
+	for _, name := range []string{"ut_pex", "unknown"} {
+		if _, ok := got.ExtensionID(name); ok {
+			t.Errorf("expected %s to be unsupported", name)
+		}
+	}
+}
+
+// TestParseExtensionHandshakeInvalid ensures that malformed handshakes are rejected.
+func TestParseExtensionHandshakeInvalid(t *testing.T) {
+	for _, payload := range []string{"", "le", "de", "d1:mi1ee", "d1:md1:a1:xee", "d1:mde1:p1:xe"} {
+		if _, err := ParseExtensionHandshake([]byte(payload)); err == nil {
+			t.Errorf("ParseExtensionHandshake(%q): expected error, got nil", payload)
+		}
+	}
+}
+
+// TestSupportsExtensions checks the reserved bit of the extension protocol.
+func TestSupportsExtensions(t *testing.T) {
+	if !SupportsExtensions(ExtensionProtocol) || SupportsExtensions([8]byte{7: 0x01}) {
+		t.Error("unexpected result for the extension protocol bit")
+	}
+}
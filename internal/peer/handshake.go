@@ -0,0 +1,65 @@
+// Package peer implements the BitTorrent peer wire protocol.
+// Reference: https://wiki.theory.org/BitTorrentSpecification#Peer_wire_protocol_.28TCP.29
+package peer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+)
+
+// Protocol is the protocol string sent at the start of every handshake.
+const Protocol = "BitTorrent protocol"
+
+// HandshakeLength is the size of an encoded handshake in bytes.
+const HandshakeLength = 1 + len(Protocol) + 8 + 20 + 20
+
+// Handshake is the first message exchanged on a peer connection.
+// Reference: https://wiki.theory.org/BitTorrentSpecification#Handshake
+type Handshake struct {
+	Reserved [8]byte     // extension bits, e.g. for the extension protocol or DHT
+	InfoHash infohash.V1 // info hash of the torrent the connection is for
+	PeerID   [20]byte    // ID of the sending peer
+}
+
+// WriteTo writes the encoded handshake to w, implementing io.WriterTo.
+func (h Handshake) WriteTo(w io.Writer) (int64, error) {
+	buf := make([]byte, 0, HandshakeLength)
+	buf = append(buf, byte(len(Protocol)))
+	buf = append(buf, Protocol...)
+	buf = append(buf, h.Reserved[:]...)
+	buf = append(buf, h.InfoHash[:]...)
+	buf = append(buf, h.PeerID[:]...)
+
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// ReadHandshake reads a handshake from r.
+// It returns an error if the peer does not speak the BitTorrent protocol.
+func ReadHandshake(r io.Reader) (Handshake, error) {
+	var buf [HandshakeLength]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return Handshake{}, fmt.Errorf("reading handshake: %w", err)
+	}
+	if int(buf[0]) != len(Protocol) {
+		return Handshake{}, fmt.Errorf("unexpected protocol string length %d", buf[0])
+	}
+	if _, err := io.ReadFull(r, buf[1:]); err != nil {
+		return Handshake{}, fmt.Errorf("reading handshake: %w", err)
+	}
+
+	rest := buf[1:]
+	if !bytes.Equal(rest[:len(Protocol)], []byte(Protocol)) {
+		return Handshake{}, fmt.Errorf("unexpected protocol %q", rest[:len(Protocol)])
+	}
+	rest = rest[len(Protocol):]
+
+	var h Handshake
+	copy(h.Reserved[:], rest[:8])
+	copy(h.InfoHash[:], rest[8:28])
+	copy(h.PeerID[:], rest[28:48])
+	return h, nil
+}
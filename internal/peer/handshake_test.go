@@ -0,0 +1,53 @@
+package peer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// TestHandshake verifies the encoded form of a handshake and decoding it back.
+func TestHandshake(t *testing.T) {
+	h := Handshake{
+		Reserved: [8]byte{0, 0, 0, 0, 0, 0x10, 0, 0x01},
+		InfoHash: [20]byte([]byte(strings.Repeat("i", 20))),
+		PeerID:   [20]byte([]byte("-GB0001-abcdefghijkl")),
+	}
+
+	var buf bytes.Buffer
+	n, err := h.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() returned error: %v", err)
+	}
+	expected := "\x13BitTorrent protocol\x00\x00\x00\x00\x00\x10\x00\x01" + strings.Repeat("i", 20) + "-GB0001-abcdefghijkl"
+	if n != int64(HandshakeLength) || buf.String() != expected {
+		t.Fatalf("WriteTo() wrote %d bytes %q, want %q", n, buf.String(), expected)
+	}
+
+	got, err := ReadHandshake(&buf)
+	if err != nil {
+		t.Fatalf("ReadHandshake() returned error: %v", err)
+	}
+	if got != h {
+		t.Errorf("ReadHandshake() = %+v, want %+v", got, h)
+	}
+}
+
+// TestReadHandshakeInvalid ensures that foreign protocols and truncated handshakes are rejected.
+func TestReadHandshakeInvalid(t *testing.T) {
+	valid := "\x13BitTorrent protocol" + strings.Repeat("\x00", 48)
+	tests := map[string]string{
+		"wrong length":   "\x04HTTP",
+		"wrong protocol": "\x13BitTorrent protoco1" + strings.Repeat("\x00", 48),
+		"truncated":      valid[:40],
+		"empty":          "",
+	}
+
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ReadHandshake(strings.NewReader(input)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package peer
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// ProtocolV2 has the reserved handshake bit set that advertises support for the BitTorrent v2
+// protocol, including the hash request, hashes and hash reject messages.
+//
+// Reference: https://bittorrent.org/beps/bep_0052.html
+var ProtocolV2 = [8]byte{7: 0x10}
+
+// SupportsV2 reports whether the reserved handshake bits advertise the v2 protocol.
+func SupportsV2(reserved [8]byte) bool {
+	return reserved[7]&ProtocolV2[7] != 0
+}
+
+// hashRequestLength is the payload length of hash request and hash reject messages.
+const hashRequestLength = 32 + 4*4
+
+// HashRequest asks for Length hashes of the merkle tree of the file with the given pieces
+// root, starting at Index of the layer BaseLayer levels above the leaves, along with the uncle
+// hashes proving them up to ProofLayers levels above their subtree.
+type HashRequest struct {
+	PiecesRoot  [32]byte
+	BaseLayer   uint32 // 0 for the block hashes
+	Index       uint32 // index of the first hash within the base layer, a multiple of Length
+	Length      uint32 // number of hashes, a power of two
+	ProofLayers uint32
+}
+
+func (r HashRequest) appendTo(payload []byte) []byte {
+	payload = append(payload, r.PiecesRoot[:]...)
+	payload = binary.BigEndian.AppendUint32(payload, r.BaseLayer)
+	payload = binary.BigEndian.AppendUint32(payload, r.Index)
+	payload = binary.BigEndian.AppendUint32(payload, r.Length)
+	return binary.BigEndian.AppendUint32(payload, r.ProofLayers)
+}
+
+// NewHashRequest returns a hash request message.
+func NewHashRequest(r HashRequest) *Message {
+	return &Message{ID: MsgHashRequest, Payload: r.appendTo(nil)}
+}
+
+// NewHashReject returns a hash reject message refusing the request r.
+func NewHashReject(r HashRequest) *Message {
+	return &Message{ID: MsgHashReject, Payload: r.appendTo(nil)}
+}
+
+// NewHashes returns a hashes message answering the request r with the requested hashes
+// followed by the uncle hashes of the proof, lowest first.
+func NewHashes(r HashRequest, hashes, proof [][32]byte) *Message {
+	payload := r.appendTo(make([]byte, 0, hashRequestLength+32*(len(hashes)+len(proof))))
+	for _, hash := range append(hashes[:len(hashes):len(hashes)], proof...) {
+		payload = append(payload, hash[:]...)
+	}
+	return &Message{ID: MsgHashes, Payload: payload}
+}
+
+// ParseHashRequest returns the request of a hash request or hash reject message.
+func (m *Message) ParseHashRequest() (HashRequest, error) {
+	if m == nil || (m.ID != MsgHashRequest && m.ID != MsgHashReject) {
+		return HashRequest{}, fmt.Errorf("expected hash request or hash reject message, got %s", m)
+	}
+	if len(m.Payload) != hashRequestLength {
+		return HashRequest{}, fmt.Errorf("invalid %s payload length %d, expected %d", m.ID, len(m.Payload), hashRequestLength)
+	}
+	return parseHashRequest(m.Payload), nil
+}
+
+// ParseHashes returns the request answered by a hashes message, the requested hashes and the
+// uncle hashes of the proof, lowest first.
+func (m *Message) ParseHashes() (r HashRequest, hashes, proof [][32]byte, err error) {
+	if m == nil || m.ID != MsgHashes {
+		return HashRequest{}, nil, nil, fmt.Errorf("expected hashes message, got %s", m)
+	}
+	if len(m.Payload) < hashRequestLength || (len(m.Payload)-hashRequestLength)%32 != 0 {
+		return HashRequest{}, nil, nil, fmt.Errorf("invalid hashes payload length %d", len(m.Payload))
+	}
+	r = parseHashRequest(m.Payload)
+	all := make([][32]byte, (len(m.Payload)-hashRequestLength)/32)
+	for idx := range all {
+		copy(all[idx][:], m.Payload[hashRequestLength+32*idx:])
+	}
+	if uint64(r.Length) > uint64(len(all)) {
+		return HashRequest{}, nil, nil, fmt.Errorf("hashes message holds %d hashes, fewer than the %d requested", len(all), r.Length)
+	}
+	return r, all[:r.Length], all[r.Length:], nil
+}
+
+func parseHashRequest(payload []byte) HashRequest {
+	var r HashRequest
+	copy(r.PiecesRoot[:], payload)
+	r.BaseLayer = binary.BigEndian.Uint32(payload[32:])
+	r.Index = binary.BigEndian.Uint32(payload[36:])
+	r.Length = binary.BigEndian.Uint32(payload[40:])
+	r.ProofLayers = binary.BigEndian.Uint32(payload[44:])
+	return r
+}
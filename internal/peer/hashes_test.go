@@ -0,0 +1,68 @@
+package peer
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestHashMessages round-trips hash request, hashes and hash reject messages and checks the
+// layout of a hash request.
+func TestHashMessages(t *testing.T) {
+	r := HashRequest{PiecesRoot: [32]byte{0: 0xaa, 31: 0xbb}, BaseLayer: 1, Index: 4, Length: 2, ProofLayers: 3}
+	m := NewHashRequest(r)
+	expected := "\xaa" + string(make([]byte, 30)) + "\xbb" +
+		"\x00\x00\x00\x01\x00\x00\x00\x04\x00\x00\x00\x02\x00\x00\x00\x03"
+	if m.ID != MsgHashRequest || string(m.Payload) != expected {
+		t.Fatalf("NewHashRequest() = %s %q, want %q", m.ID, m.Payload, expected)
+	}
+	if got, err := m.ParseHashRequest(); err != nil || got != r {
+		t.Errorf("ParseHashRequest() = %+v, %v, want %+v", got, err, r)
+	}
+	if got, err := NewHashReject(r).ParseHashRequest(); err != nil || got != r {
+		t.Errorf("ParseHashRequest() of a reject = %+v, %v, want %+v", got, err, r)
+	}
+
+	hashes := [][32]byte{{1}, {2}}
+	proof := [][32]byte{{3}, {4}, {5}}
+	got, gotHashes, gotProof, err := NewHashes(r, hashes, proof).ParseHashes()
+	if err != nil {
+		t.Fatalf("ParseHashes() returned error: %v", err)
+	}
+	if got != r || !reflect.DeepEqual(gotHashes, hashes) || !reflect.DeepEqual(gotProof, proof) {
+		t.Errorf("ParseHashes() = %+v, %v, %v, want %+v, %v, %v", got, gotHashes, gotProof, r, hashes, proof)
+	}
+
+	invalid := []struct {
+		name  string
+		parse func() error
+	}{
+		{"hash request with wrong id", func() error { _, err := NewHave(1).ParseHashRequest(); return err }},
+		{"short hash request", func() error {
+			_, err := (&Message{ID: MsgHashRequest, Payload: make([]byte, 47)}).ParseHashRequest()
+			return err
+		}},
+		{"hashes from a request", func() error { _, _, _, err := m.ParseHashes(); return err }},
+		{"partial hash", func() error {
+			_, _, _, err := (&Message{ID: MsgHashes, Payload: make([]byte, 48+31)}).ParseHashes()
+			return err
+		}},
+		{"fewer hashes than requested", func() error {
+			_, _, _, err := NewHashes(r, hashes[:1], nil).ParseHashes()
+			return err
+		}},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.parse(); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestSupportsV2 checks the reserved bit advertising the v2 protocol.
+func TestSupportsV2(t *testing.T) {
+	if !SupportsV2(ProtocolV2) || SupportsV2(ExtensionProtocol) {
+		t.Error("SupportsV2() does not match the v2 reserved bit")
+	}
+}
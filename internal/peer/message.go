@@ -0,0 +1,220 @@
+package peer
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// MaxMessageLength limits the length prefix accepted by ReadMessage to prevent memory exhaustion.
+// It comfortably fits a piece message for a 16 KiB block and the bitfield of any sane torrent.
+const MaxMessageLength = 1024 * 1024 // 1 MB
+
+// MessageID identifies the type of a peer wire message.
+type MessageID uint8
+
+// Reference: https://wiki.theory.org/BitTorrentSpecification#Messages
+const (
+	MsgChoke         MessageID = 0
+	MsgUnchoke       MessageID = 1
+	MsgInterested    MessageID = 2
+	MsgNotInterested MessageID = 3
+	MsgHave          MessageID = 4
+	MsgBitfield      MessageID = 5
+	MsgRequest       MessageID = 6
+	MsgPiece         MessageID = 7
+	MsgCancel        MessageID = 8
+	MsgPort          MessageID = 9
+	MsgExtended      MessageID = 20 // BEP 10 extension protocol
+	MsgHashRequest   MessageID = 21 // BEP 52 request for merkle tree hashes
+	MsgHashes        MessageID = 22 // BEP 52 merkle tree hashes
+	MsgHashReject    MessageID = 23 // BEP 52 refused hash request
+)
+
+// String returns the name of the message type, e.g. "not interested".
+func (id MessageID) String() string {
+	switch id {
+	case MsgChoke:
+		return "choke"
+	case MsgUnchoke:
+		return "unchoke"
+	case MsgInterested:
+		return "interested"
+	case MsgNotInterested:
+		return "not interested"
+	case MsgHave:
+		return "have"
+	case MsgBitfield:
+		return "bitfield"
+	case MsgRequest:
+		return "request"
+	case MsgPiece:
+		return "piece"
+	case MsgCancel:
+		return "cancel"
+	case MsgPort:
+		return "port"
+	case MsgExtended:
+		return "extended"
+	case MsgHashRequest:
+		return "hash request"
+	case MsgHashes:
+		return "hashes"
+	case MsgHashReject:
+		return "hash reject"
+	default:
+		return "unknown message " + strconv.Itoa(int(id))
+	}
+}
+
+// Message is a peer wire message. A nil *Message represents a keep-alive, which has no ID.
+type Message struct {
+	ID      MessageID
+	Payload []byte
+}
+
+// WriteTo writes the length-prefixed message to w, implementing io.WriterTo.
+// A nil message is written as a keep-alive.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	if m == nil {
+		n, err := w.Write([]byte{0, 0, 0, 0})
+		return int64(n), err
+	}
+
+	buf := make([]byte, 4+1+len(m.Payload))
+	binary.BigEndian.PutUint32(buf, uint32(1+len(m.Payload)))
+	buf[4] = byte(m.ID)
+	copy(buf[5:], m.Payload)
+
+	n, err := w.Write(buf)
+	return int64(n), err
+}
+
+// ReadMessage reads the next length-prefixed message from r.
+// It returns a nil message for a keep-alive.
+func ReadMessage(r io.Reader) (*Message, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(prefix[:])
+	if length == 0 {
+		return nil, nil // keep-alive
+	}
+	if length > MaxMessageLength {
+		return nil, fmt.Errorf("message length %d exceeds maximum of %d", length, MaxMessageLength)
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("reading message: %w", err)
+	}
+	return &Message{ID: MessageID(buf[0]), Payload: buf[1:]}, nil
+}
+
+// String returns a short description of the message for logging.
+func (m *Message) String() string {
+	if m == nil {
+		return "keep-alive"
+	}
+	return fmt.Sprintf("%s [%d bytes]", m.ID, len(m.Payload))
+}
+
+// NewHave returns a have message announcing the piece at index.
+func NewHave(index uint32) *Message {
+	return &Message{ID: MsgHave, Payload: binary.BigEndian.AppendUint32(nil, index)}
+}
+
+// NewBitfield returns a bitfield message with the given bitfield, high bit first.
+func NewBitfield(bitfield []byte) *Message {
+	return &Message{ID: MsgBitfield, Payload: bitfield}
+}
+
+// NewRequest returns a request message for length bytes at offset begin of the piece at index.
+func NewRequest(index, begin, length uint32) *Message {
+	return &Message{ID: MsgRequest, Payload: blockPayload(index, begin, length)}
+}
+
+// NewCancel returns a cancel message for a block previously requested with NewRequest.
+func NewCancel(index, begin, length uint32) *Message {
+	return &Message{ID: MsgCancel, Payload: blockPayload(index, begin, length)}
+}
+
+// NewPiece returns a piece message carrying block at offset begin of the piece at index.
+func NewPiece(index, begin uint32, block []byte) *Message {
+	payload := make([]byte, 8, 8+len(block))
+	binary.BigEndian.PutUint32(payload, index)
+	binary.BigEndian.PutUint32(payload[4:], begin)
+	return &Message{ID: MsgPiece, Payload: append(payload, block...)}
+}
+
+// NewPort returns a port message announcing the port of the sender's DHT node.
+func NewPort(port uint16) *Message {
+	return &Message{ID: MsgPort, Payload: binary.BigEndian.AppendUint16(nil, port)}
+}
+
+// ParseHave returns the piece index of a have message.
+func (m *Message) ParseHave() (uint32, error) {
+	if err := m.expect(MsgHave, 4); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(m.Payload), nil
+}
+
+// ParseRequest returns the piece index, offset and length of a request or cancel message.
+func (m *Message) ParseRequest() (index, begin, length uint32, err error) {
+	if m == nil || (m.ID != MsgRequest && m.ID != MsgCancel) {
+		return 0, 0, 0, fmt.Errorf("expected request or cancel message, got %s", m)
+	}
+	if len(m.Payload) != 12 {
+		return 0, 0, 0, fmt.Errorf("invalid %s payload length %d, expected 12", m.ID, len(m.Payload))
+	}
+	return binary.BigEndian.Uint32(m.Payload),
+		binary.BigEndian.Uint32(m.Payload[4:]),
+		binary.BigEndian.Uint32(m.Payload[8:]),
+		nil
+}
+
+// ParsePiece returns the piece index, offset and data of a piece message.
+// The block shares memory with the message payload.
+func (m *Message) ParsePiece() (index, begin uint32, block []byte, err error) {
+	if m == nil || m.ID != MsgPiece {
+		return 0, 0, nil, fmt.Errorf("expected piece message, got %s", m)
+	}
+	if len(m.Payload) < 8 {
+		return 0, 0, nil, fmt.Errorf("invalid piece payload length %d, expected at least 8", len(m.Payload))
+	}
+	return binary.BigEndian.Uint32(m.Payload), binary.BigEndian.Uint32(m.Payload[4:]), m.Payload[8:], nil
+}
+
+// ParsePort returns the DHT port of a port message.
+func (m *Message) ParsePort() (uint16, error) {
+	if err := m.expect(MsgPort, 2); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(m.Payload), nil
+}
+
+// expect checks that m has the given ID and payload length.
+func (m *Message) expect(id MessageID, payloadLength int) error {
+	if m == nil || m.ID != id {
+		return fmt.Errorf("expected %s message, got %s", id, m)
+	}
+	if len(m.Payload) != payloadLength {
+		return fmt.Errorf("invalid %s payload length %d, expected %d", id, len(m.Payload), payloadLength)
+	}
+	return nil
+}
+
+func blockPayload(index, begin, length uint32) []byte {
+	payload := make([]byte, 12)
+	binary.BigEndian.PutUint32(payload, index)
+	binary.BigEndian.PutUint32(payload[4:], begin)
+	binary.BigEndian.PutUint32(payload[8:], length)
+	return payload
+}
@@ -0,0 +1,113 @@
+package peer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestMessageEncoding checks each message type against its known byte sequence and decodes it back.
+func TestMessageEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		message  *Message
+		expected string
+	}{
+		{"keep-alive", nil, "\x00\x00\x00\x00"},
+		{"choke", &Message{ID: MsgChoke}, "\x00\x00\x00\x01\x00"},
+		{"unchoke", &Message{ID: MsgUnchoke}, "\x00\x00\x00\x01\x01"},
+		{"interested", &Message{ID: MsgInterested}, "\x00\x00\x00\x01\x02"},
+		{"not interested", &Message{ID: MsgNotInterested}, "\x00\x00\x00\x01\x03"},
+		{"have", NewHave(0x01020304), "\x00\x00\x00\x05\x04\x01\x02\x03\x04"},
+		{"bitfield", NewBitfield([]byte{0xa0, 0x01}), "\x00\x00\x00\x03\x05\xa0\x01"},
+		{"request", NewRequest(1, 16384, 16384), "\x00\x00\x00\x0d\x06\x00\x00\x00\x01\x00\x00\x40\x00\x00\x00\x40\x00"},
+		{"piece", NewPiece(2, 8, []byte("data")), "\x00\x00\x00\x0d\x07\x00\x00\x00\x02\x00\x00\x00\x08data"},
+		{"cancel", NewCancel(1, 0, 16384), "\x00\x00\x00\x0d\x08\x00\x00\x00\x01\x00\x00\x00\x00\x00\x00\x40\x00"},
+		{"port", NewPort(6881), "\x00\x00\x00\x03\x09\x1a\xe1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			n, err := tc.message.WriteTo(&buf)
+			if err != nil {
+				t.Fatalf("WriteTo() returned error: %v", err)
+			}
+			if int(n) != len(tc.expected) || buf.String() != tc.expected {
+				t.Fatalf("WriteTo() wrote %q, want %q", buf.String(), tc.expected)
+			}
+
+			got, err := ReadMessage(&buf)
+			if err != nil {
+				t.Fatalf("ReadMessage() returned error: %v", err)
+			}
+			if tc.message == nil {
+				if got != nil {
+					t.Errorf("expected keep-alive, got %s", got)
+				}
+				return
+			}
+			if got.ID != tc.message.ID || !bytes.Equal(got.Payload, tc.message.Payload) {
+				t.Errorf("ReadMessage() = %s, want %s", got, tc.message)
+			}
+		})
+	}
+}
+
+// TestMessageParsing verifies the payload accessors and their validation.
+func TestMessageParsing(t *testing.T) {
+	if index, err := NewHave(42).ParseHave(); err != nil || index != 42 {
+		t.Errorf("ParseHave() = %d, %v", index, err)
+	}
+	index, begin, length, err := NewCancel(3, 16384, 100).ParseRequest()
+	if err != nil || index != 3 || begin != 16384 || length != 100 {
+		t.Errorf("ParseRequest() = %d, %d, %d, %v", index, begin, length, err)
+	}
+	index, begin, block, err := NewPiece(5, 32, []byte("abc")).ParsePiece()
+	if err != nil || index != 5 || begin != 32 || !reflect.DeepEqual(block, []byte("abc")) {
+		t.Errorf("ParsePiece() = %d, %d, %q, %v", index, begin, block, err)
+	}
+	if port, err := NewPort(51413).ParsePort(); err != nil || port != 51413 {
+		t.Errorf("ParsePort() = %d, %v", port, err)
+	}
+
+	invalid := []struct {
+		name  string
+		parse func() error
+	}{
+		{"have with wrong id", func() error { _, err := NewPort(1).ParseHave(); return err }},
+		{"short have", func() error { _, err := (&Message{ID: MsgHave, Payload: []byte{1}}).ParseHave(); return err }},
+		{"request from keep-alive", func() error { _, _, _, err := (*Message)(nil).ParseRequest(); return err }},
+		{"short request", func() error {
+			_, _, _, err := (&Message{ID: MsgRequest, Payload: make([]byte, 8)}).ParseRequest()
+			return err
+		}},
+		{"short piece", func() error {
+			_, _, _, err := (&Message{ID: MsgPiece, Payload: make([]byte, 7)}).ParsePiece()
+			return err
+		}},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.parse(); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestReadMessageInvalid ensures that truncated and oversized messages are rejected.
+func TestReadMessageInvalid(t *testing.T) {
+	if _, err := ReadMessage(strings.NewReader("")); !errors.Is(err, io.EOF) {
+		t.Errorf("expected io.EOF for a closed stream, got %v", err)
+	}
+	if _, err := ReadMessage(strings.NewReader("\x00\x00\x00\x05\x04\x00")); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated message, got %v", err)
+	}
+	if _, err := ReadMessage(strings.NewReader("\xff\xff\xff\xff")); err == nil {
+		t.Error("expected error for an oversized message, got nil")
+	}
+}
@@ -0,0 +1,211 @@
+// Package peerid generates the peer ID of gobit and identifies other clients by theirs.
+//
+// The specification only requires peer IDs to be 20 bytes, but clients encode their name and
+// version at the start by convention. Three encodings are common:
+//
+//   - Azureus style, used by most clients: '-', a two-letter client code, four version
+//     characters and '-', such as "-qB4250-" for qBittorrent 4.2.5.
+//   - Shadow style: a client letter followed by up to five version characters, one per
+//     component, each from the alphabet 0-9A-Za-z. and padded with '-', such as "S58B-----".
+//   - Mainline style: a client letter followed by dash-separated version numbers, such as
+//     "M4-3-6--".
+//
+// Reference: https://wiki.theory.org/BitTorrentSpecification#peer_id
+package peerid
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+)
+
+// identification of gobit in its peer IDs and extension handshakes
+const (
+	ClientName = "gobit"
+	ClientCode = "GB"
+	Version    = "0.1.0"
+
+	// Prefix starts the peer IDs of this version of gobit, in the Azureus style.
+	Prefix = "-" + ClientCode + "0100-"
+)
+
+// randomAlphabet is the alphabet of the random part of generated peer IDs. Keeping them
+// printable avoids trouble with trackers and tools that mishandle raw bytes.
+const randomAlphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// New returns a peer ID made of Prefix followed by random alphanumeric characters.
+func New() ([20]byte, error) {
+	var id [20]byte
+	n := copy(id[:], Prefix)
+	if _, err := rand.Read(id[n:]); err != nil {
+		return id, fmt.Errorf("generating peer ID: %w", err)
+	}
+	for i := n; i < len(id); i++ {
+		id[i] = randomAlphabet[int(id[i])%len(randomAlphabet)]
+	}
+	return id, nil
+}
+
+// Client is the software behind a peer ID.
+type Client struct {
+	Name    string // client name, such as "qBittorrent"
+	Version string // dotted version, empty if unknown
+}
+
+// String returns the name and the version of the client.
+func (c Client) String() string {
+	if c.Version == "" {
+		return c.Name
+	}
+	return c.Name + " " + c.Version
+}
+
+// azureusClients maps Azureus-style client codes to client names.
+var azureusClients = map[string]string{
+	"AG": "Ares",
+	"AZ": "Vuze",
+	"BC": "BitComet",
+	"BI": "BiglyBT",
+	"BT": "BitTorrent",
+	"DE": "Deluge",
+	"FD": "Free Download Manager",
+	"FW": "FrostWire",
+	"GB": ClientName,
+	"KT": "KTorrent",
+	"LT": "libtorrent",
+	"lt": "rTorrent",
+	"PI": "PicoTorrent",
+	"qB": "qBittorrent",
+	"SD": "Thunder",
+	"TR": "Transmission",
+	"UM": "µTorrent Mac",
+	"UT": "µTorrent",
+	"UW": "µTorrent Web",
+	"WW": "WebTorrent",
+	"XL": "Xunlei",
+}
+
+// shadowClients maps Shadow-style client letters to client names.
+var shadowClients = map[byte]string{
+	'A': "ABC",
+	'O': "Osprey Permaseed",
+	'Q': "BTQueue",
+	'R': "Tribler",
+	'S': "Shadow",
+	'T': "BitTornado",
+	'U': "UPnP NAT Bit Torrent",
+}
+
+// shadowDigits is the alphabet of Shadow-style version characters, by value.
+const shadowDigits = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz."
+
+// Identify returns the client that generated id. It reports false if the encoding or the
+// client is not recognized.
+func Identify(id [20]byte) (Client, bool) {
+	if c, ok := identifyAzureus(id); ok {
+		return c, true
+	}
+	if c, ok := identifyMainline(id); ok {
+		return c, true
+	}
+	return identifyShadow(id)
+}
+
+func identifyAzureus(id [20]byte) (Client, bool) {
+	if id[0] != '-' || id[7] != '-' {
+		return Client{}, false
+	}
+	name, ok := azureusClients[string(id[1:3])]
+	if !ok {
+		return Client{}, false
+	}
+	digits := string(id[3:7])
+
+	if string(id[1:3]) == "TR" {
+		// Transmission up to 3.x encodes the major version in one digit and the minor one in
+		// two, followed by 'Z' or 'X' for betas: "-TR2940-" is 2.94. Since 4.0 it encodes the
+		// major, minor and patch versions in one digit each, followed by a character telling
+		// releases from development and beta builds: "-TR406Z-" is 4.0.6
+		switch {
+		case !isDigits(digits[:3]):
+			return Client{Name: name}, true
+		case digits[0] >= '4':
+			return Client{Name: name, Version: fmt.Sprintf("%c.%c.%c", digits[0], digits[1], digits[2])}, true
+		default:
+			return Client{Name: name, Version: fmt.Sprintf("%c.%s", digits[0], digits[1:3])}, true
+		}
+	}
+
+	// one character per component, letters counting from 10 in some clients
+	components := make([]string, 0, 4)
+	for i := range len(digits) {
+		value := strings.IndexByte(shadowDigits[:36], digits[i])
+		if value < 0 {
+			return Client{Name: name}, true
+		}
+		components = append(components, fmt.Sprint(value))
+	}
+	if components[3] == "0" {
+		components = components[:3]
+	}
+	return Client{Name: name, Version: strings.Join(components, ".")}, true
+}
+
+func identifyMainline(id [20]byte) (Client, bool) {
+	if id[0] != 'M' && id[0] != 'Q' {
+		return Client{}, false
+	}
+	// "M4-3-6--" or "M4-20-8-": three numbers separated by dashes, padded to 8 characters
+	version := string(id[1:8])
+	if !strings.HasSuffix(version, "-") {
+		return Client{}, false
+	}
+	components := strings.Split(strings.TrimRight(version, "-"), "-")
+	if len(components) != 3 {
+		return Client{}, false
+	}
+	for _, component := range components {
+		if !isDigits(component) {
+			return Client{}, false
+		}
+	}
+	name := "BitTorrent"
+	if id[0] == 'Q' {
+		name = "Queen Bee"
+	}
+	return Client{Name: name, Version: strings.Join(components, ".")}, true
+}
+
+func identifyShadow(id [20]byte) (Client, bool) {
+	name, ok := shadowClients[id[0]]
+	if !ok {
+		return Client{}, false
+	}
+	// up to five version characters, padded with '-'
+	var components []string
+	padded := false
+	for _, c := range id[1:6] {
+		if c == '-' {
+			padded = true
+			continue
+		}
+		value := strings.IndexByte(shadowDigits, c)
+		if padded || value < 0 {
+			return Client{}, false
+		}
+		components = append(components, fmt.Sprint(value))
+	}
+	if len(components) == 0 {
+		return Client{}, false
+	}
+	return Client{Name: name, Version: strings.Join(components, ".")}, true
+}
+
+func isDigits(s string) bool {
+	for i := range len(s) {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
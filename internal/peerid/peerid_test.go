@@ -0,0 +1,67 @@
+package peerid
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestNew checks the prefix and the alphabet of generated peer IDs.
+func TestNew(t *testing.T) {
+	id, err := New()
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if !strings.HasPrefix(string(id[:]), Prefix) {
+		t.Errorf("New() = %q, want prefix %q", id, Prefix)
+	}
+	for _, c := range id[len(Prefix):] {
+		if !strings.ContainsRune(randomAlphabet, rune(c)) {
+			t.Errorf("New() = %q contains %q outside the random alphabet", id, c)
+		}
+	}
+	if other, _ := New(); other == id {
+		t.Error("New() returned the same ID twice")
+	}
+	if c, ok := Identify(id); !ok || c.String() != ClientName+" "+Version {
+		t.Errorf("Identify(New()) = %v, %v, want %s %s", c, ok, ClientName, Version)
+	}
+}
+
+// TestIdentify checks the identification of the common peer ID encodings.
+func TestIdentify(t *testing.T) {
+	tests := []struct {
+		id     string
+		want   string
+		wantOK bool
+	}{
+		{id: "-qB4250-abcdefghijkl", want: "qBittorrent 4.2.5", wantOK: true},
+		{id: "-LT2093-abcdefghijkl", want: "libtorrent 2.0.9.3", wantOK: true},
+		{id: "-TR2940-abcdefghijkl", want: "Transmission 2.94", wantOK: true},
+		{id: "-TR300Z-abcdefghijkl", want: "Transmission 3.00", wantOK: true},
+		{id: "-TR400Z-abcdefghijkl", want: "Transmission 4.0.0", wantOK: true},
+		{id: "-TR406B-abcdefghijkl", want: "Transmission 4.0.6", wantOK: true},
+		{id: "-UT3B00-abcdefghijkl", want: "µTorrent 3.11.0", wantOK: true},
+		{id: "-GB0100-abcdefghijkl", want: "gobit 0.1.0", wantOK: true},
+		{id: "-DE1a2b-abcdefghijkl", want: "Deluge", wantOK: true},
+		{id: "M4-3-6--abcdefghijkl", want: "BitTorrent 4.3.6", wantOK: true},
+		{id: "M7-10-2-abcdefghijkl", want: "BitTorrent 7.10.2", wantOK: true},
+		{id: "M7-10--2abcdefghijkl", wantOK: false},
+		{id: "S58B-----abcdefghijk", want: "Shadow 5.8.11", wantOK: true},
+		{id: "T03I--00abcdefghijkl", want: "BitTornado 0.3.18", wantOK: true},
+		{id: "-ZZ1000-abcdefghijkl", wantOK: false},
+		{id: "abcdefghijklmnopqrst", wantOK: false},
+		{id: "S-5-----abcdefghijkl", wantOK: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.id, func(t *testing.T) {
+			c, ok := Identify([20]byte([]byte(tc.id)))
+			if ok != tc.wantOK {
+				t.Fatalf("Identify() ok = %v, want %v", ok, tc.wantOK)
+			}
+			if ok && c.String() != tc.want {
+				t.Errorf("Identify() = %q, want %q", c, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// Package pex implements peer exchange (ut_pex), which lets connected peers share the addresses
+// of the other peers they know in the swarm.
+//
+// PEX messages are sent over the extension protocol of BEP 10. Each lists the peers added and
+// dropped since the previous message to the same peer, in compact form. At most one message
+// should be sent per minute and each list holds at most 50 peers.
+//
+// Reference: https://bittorrent.org/beps/bep_0011.html
+package pex
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/compact"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// ExtensionName is the name of the peer exchange extension in extension handshakes.
+const ExtensionName = "ut_pex"
+
+// LocalID is the extended message ID we ask peers to send ut_pex messages with.
+const LocalID = 2
+
+// DefaultInterval is the minimum time between two PEX messages to the same peer.
+const DefaultInterval = time.Minute
+
+// MaxPeers is the maximum number of peers in each of the added and dropped lists of a message.
+const MaxPeers = 50
+
+// Flags describe an added peer, as found in the 'added.f' field.
+const (
+	FlagEncryption = 0x01 // prefers encrypted connections
+	FlagSeed       = 0x02 // is a seed or partial seed
+	FlagUTP        = 0x04 // supports uTP
+	FlagHolepunch  = 0x08 // supports the holepunch extension
+	FlagReachable  = 0x10 // accepts incoming connections
+)
+
+// Peer is a peer added to the swarm.
+type Peer struct {
+	Addr  netip.AddrPort
+	Flags byte // combination of the Flag constants
+}
+
+// Message is the content of a PEX message. IPv4 and IPv6 peers are mixed in both lists.
+type Message struct {
+	Added   []Peer
+	Dropped []netip.AddrPort
+}
+
+// payload is the bencoded form of a PEX message.
+type payload struct {
+	Added       []byte `bencode:"added,omitempty"`
+	AddedFlags  []byte `bencode:"added.f,omitempty"`
+	Added6      []byte `bencode:"added6,omitempty"`
+	Added6Flags []byte `bencode:"added6.f,omitempty"`
+	Dropped     []byte `bencode:"dropped,omitempty"`
+	Dropped6    []byte `bencode:"dropped6,omitempty"`
+}
+
+// Parse decodes the payload of a ut_pex message. Missing flags default to zero.
+func Parse(data []byte) (Message, error) {
+	var p payload
+	if err := bencode.Unmarshal(data, &p); err != nil {
+		return Message{}, fmt.Errorf("decoding %s message: %w", ExtensionName, err)
+	}
+
+	var m Message
+	for _, family := range []struct {
+		addedKey, droppedKey string
+		added, flags         []byte
+		dropped              []byte
+		parse                func([]byte) ([]netip.AddrPort, error)
+	}{
+		{"added", "dropped", p.Added, p.AddedFlags, p.Dropped, compact.ParsePeers},
+		{"added6", "dropped6", p.Added6, p.Added6Flags, p.Dropped6, compact.ParsePeers6},
+	} {
+		added, err := family.parse(family.added)
+		if err != nil {
+			return Message{}, fmt.Errorf("'%s': %w", family.addedKey, err)
+		}
+		for i, addr := range added {
+			var flags byte
+			if i < len(family.flags) {
+				flags = family.flags[i]
+			}
+			m.Added = append(m.Added, Peer{Addr: addr, Flags: flags})
+		}
+
+		dropped, err := family.parse(family.dropped)
+		if err != nil {
+			return Message{}, fmt.Errorf("'%s': %w", family.droppedKey, err)
+		}
+		m.Dropped = append(m.Dropped, dropped...)
+	}
+	return m, nil
+}
+
+// Encode returns the bencoded payload of m, splitting the peers by address family.
+func (m Message) Encode() ([]byte, error) {
+	var p payload
+	for _, added := range m.Added {
+		switch {
+		case !added.Addr.IsValid():
+			continue // no address to pair the flags with
+		case added.Addr.Addr().Unmap().Is4():
+			p.Added = compact.AppendPeer(p.Added, added.Addr)
+			p.AddedFlags = append(p.AddedFlags, added.Flags)
+		default:
+			p.Added6 = compact.AppendPeer(p.Added6, added.Addr)
+			p.Added6Flags = append(p.Added6Flags, added.Flags)
+		}
+	}
+	p.Dropped, p.Dropped6 = compact.EncodePeers(m.Dropped)
+	return bencode.Marshal(p)
+}
+
+// Empty reports whether m neither adds nor drops any peer.
+func (m Message) Empty() bool {
+	return len(m.Added) == 0 && len(m.Dropped) == 0
+}
+
+// NewMessage returns the extended message carrying m, sent with the peer's ut_pex extended
+// message ID.
+func NewMessage(id uint8, m Message) (*peer.Message, error) {
+	data, err := m.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return peer.NewExtended(id, data), nil
+}
+
+// State tracks the peers announced to a single connected peer, so each message only carries
+// the changes since the previous one. The zero value has announced nothing.
+type State struct {
+	sent map[netip.AddrPort]struct{}
+}
+
+// Update returns the message announcing the difference between the peers announced so far and
+// current, the peers connected now, and records it as sent. Each list is capped at MaxPeers;
+// the remaining changes are carried by later messages.
+func (s *State) Update(current []Peer) Message {
+	if s.sent == nil {
+		s.sent = make(map[netip.AddrPort]struct{})
+	}
+
+	var m Message
+	connected := make(map[netip.AddrPort]struct{}, len(current))
+	for _, p := range current {
+		connected[p.Addr] = struct{}{}
+		if _, ok := s.sent[p.Addr]; !ok && len(m.Added) < MaxPeers {
+			m.Added = append(m.Added, p)
+			s.sent[p.Addr] = struct{}{}
+		}
+	}
+	for addr := range s.sent {
+		if _, ok := connected[addr]; !ok && len(m.Dropped) < MaxPeers {
+			m.Dropped = append(m.Dropped, addr)
+			delete(s.sent, addr)
+		}
+	}
+	slices.SortFunc(m.Dropped, netip.AddrPort.Compare)
+	return m
+}
@@ -0,0 +1,158 @@
+package pex
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/peer"
+)
+
+// TestEncode checks the compact encoding of a message with an added and a dropped peer.
+func TestEncode(t *testing.T) {
+	m := Message{
+		Added:   []Peer{{Addr: netip.MustParseAddrPort("1.2.3.4:6881"), Flags: FlagSeed | FlagReachable}},
+		Dropped: []netip.AddrPort{netip.MustParseAddrPort("5.6.7.8:80")},
+	}
+	data, err := m.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+	expected := "d5:added6:\x01\x02\x03\x04\x1a\xe17:added.f1:\x127:dropped6:\x05\x06\x07\x08\x00\x50e"
+	if string(data) != expected {
+		t.Errorf("Encode() = %q, want %q", data, expected)
+	}
+
+	// IPv4-mapped IPv6 addresses are sent in the IPv4 lists
+	mapped := Message{
+		Added:   []Peer{{Addr: netip.MustParseAddrPort("[::ffff:1.2.3.4]:6881"), Flags: FlagSeed | FlagReachable}},
+		Dropped: []netip.AddrPort{netip.MustParseAddrPort("[::ffff:5.6.7.8]:80")},
+	}
+	if data, err := mapped.Encode(); err != nil || string(data) != expected {
+		t.Errorf("Encode() of mapped addresses = %q, %v; want %q", data, err, expected)
+	}
+}
+
+// TestRoundTrip encodes messages mixing IPv4 and IPv6 peers and parses them back.
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+	}{
+		{"empty", Message{}},
+		{"IPv4", Message{
+			Added: []Peer{
+				{Addr: netip.MustParseAddrPort("10.0.0.1:1"), Flags: FlagEncryption},
+				{Addr: netip.MustParseAddrPort("10.0.0.2:65535")},
+			},
+			Dropped: []netip.AddrPort{netip.MustParseAddrPort("10.0.0.3:6881")},
+		}},
+		{"IPv6", Message{
+			Added:   []Peer{{Addr: netip.MustParseAddrPort("[2001:db8::1]:6881"), Flags: FlagUTP}},
+			Dropped: []netip.AddrPort{netip.MustParseAddrPort("[2001:db8::2]:6882")},
+		}},
+		{"mixed", Message{
+			Added: []Peer{
+				{Addr: netip.MustParseAddrPort("10.0.0.1:1")},
+				{Addr: netip.MustParseAddrPort("[2001:db8::1]:6881"), Flags: FlagSeed},
+			},
+			Dropped: []netip.AddrPort{
+				netip.MustParseAddrPort("10.0.0.3:6881"),
+				netip.MustParseAddrPort("[2001:db8::2]:6882"),
+			},
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := NewMessage(5, tc.message)
+			if err != nil {
+				t.Fatalf("NewMessage() returned error: %v", err)
+			}
+			id, payload, err := msg.ParseExtended()
+			if err != nil || id != 5 {
+				t.Fatalf("ParseExtended() = %d, %v, want ID 5", id, err)
+			}
+			got, err := Parse(payload)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			if got.Empty() != tc.message.Empty() || (!got.Empty() && !reflect.DeepEqual(got, tc.message)) {
+				t.Errorf("Parse() = %+v, want %+v", got, tc.message)
+			}
+		})
+	}
+}
+
+// TestParse covers missing flags and malformed payloads.
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte("d5:added12:\x01\x02\x03\x04\x00\x01\x05\x06\x07\x08\x00\x027:added.f1:\x02e"))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	expected := []Peer{
+		{Addr: netip.MustParseAddrPort("1.2.3.4:1"), Flags: FlagSeed},
+		{Addr: netip.MustParseAddrPort("5.6.7.8:2")},
+	}
+	if !reflect.DeepEqual(m.Added, expected) {
+		t.Errorf("Added = %v, want %v", m.Added, expected)
+	}
+
+	for _, payload := range []string{"", "le", "d5:added5:12345e", "d7:dropped7:1234567e", "d6:added66:123456e"} {
+		if _, err := Parse([]byte(payload)); err == nil {
+			t.Errorf("Parse(%q): expected error, got nil", payload)
+		}
+	}
+}
+
+// TestStateUpdate checks that successive updates only announce the changes.
+func TestStateUpdate(t *testing.T) {
+	a := Peer{Addr: netip.MustParseAddrPort("10.0.0.1:1")}
+	b := Peer{Addr: netip.MustParseAddrPort("10.0.0.2:2")}
+	c := Peer{Addr: netip.MustParseAddrPort("10.0.0.3:3")}
+
+	var s State
+	steps := []struct {
+		current  []Peer
+		expected Message
+	}{
+		{[]Peer{a, b}, Message{Added: []Peer{a, b}}},
+		{[]Peer{a, b}, Message{}},
+		{[]Peer{b, c}, Message{Added: []Peer{c}, Dropped: []netip.AddrPort{a.Addr}}},
+		{nil, Message{Dropped: []netip.AddrPort{b.Addr, c.Addr}}},
+	}
+	for i, step := range steps {
+		got := s.Update(step.current)
+		if got.Empty() != step.expected.Empty() || (!got.Empty() && !reflect.DeepEqual(got, step.expected)) {
+			t.Errorf("step %d: Update() = %+v, want %+v", i, got, step.expected)
+		}
+	}
+}
+
+// TestStateUpdateLimit ensures that at most MaxPeers peers are added per message.
+func TestStateUpdateLimit(t *testing.T) {
+	var current []Peer
+	for i := 0; i < MaxPeers+10; i++ {
+		current = append(current, Peer{Addr: netip.MustParseAddrPort(fmt.Sprintf("10.0.0.%d:6881", i+1))})
+	}
+
+	var s State
+	if first := s.Update(current); len(first.Added) != MaxPeers {
+		t.Errorf("first update added %d peers, want %d", len(first.Added), MaxPeers)
+	}
+	if second := s.Update(current); len(second.Added) != 10 {
+		t.Errorf("second update added %d peers, want 10", len(second.Added))
+	}
+}
+
+// TestNewMessageID checks that the message is sent as an extended message.
+func TestNewMessageID(t *testing.T) {
+	m, err := NewMessage(LocalID, Message{})
+	if err != nil {
+		t.Fatalf("NewMessage() returned error: %v", err)
+	}
+	if m.ID != peer.MsgExtended {
+		t.Errorf("ID = %v, want %v", m.ID, peer.MsgExtended)
+	}
+}
@@ -0,0 +1,474 @@
+// Package picker decides which blocks to request from which peer.
+//
+// A Picker tracks the pieces we have, the pieces each peer has and the blocks requested
+// from each peer. Peers are handed out blocks of the pieces we are already downloading
+// first, so pieces complete quickly, then blocks of new pieces in the order chosen by a
+// Strategy. The first few pieces are picked at random instead, to get something to share
+// as soon as possible. Once every missing block has been requested, the picker enters
+// endgame mode and requests the outstanding blocks from several peers at once.
+package picker
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// defaults for the zero values of Options
+const (
+	DefaultPipelineDepth     = 5
+	DefaultRandomFirstPieces = 4
+)
+
+// Block identifies a range of a piece requested from a peer.
+type Block struct {
+	Piece  int // piece index
+	Begin  int // offset within the piece
+	Length int // length in bytes, at most torrent.BlockSize
+}
+
+// Options configures a Picker.
+type Options struct {
+	// PipelineDepth is the maximum number of outstanding requests per peer.
+	// Zero means DefaultPipelineDepth.
+	PipelineDepth int
+
+	// RandomFirstPieces is the number of pieces picked at random before switching to
+	// Strategy. Zero means DefaultRandomFirstPieces, a negative value disables random picking.
+	RandomFirstPieces int
+
+	// Strategy orders the pieces to start downloading. Nil means RarestFirst.
+	Strategy Strategy
+}
+
+// blockState is the download state of a single block.
+type blockState uint8
+
+const (
+	blockMissing blockState = iota
+	blockRequested
+	blockReceived
+)
+
+// peerState holds what the picker knows about a single peer.
+type peerState struct {
+	have    torrent.Bitfield
+	pending map[Block]struct{} // blocks requested from the peer and not yet received
+}
+
+// Picker hands out block requests to peers. It is safe for concurrent use.
+type Picker struct {
+	mu   sync.Mutex
+	info *torrent.InfoDict
+	opts Options
+
+	have         torrent.Bitfield
+	haveCount    int
+	availability []int                     // number of peers having each piece
+	inProgress   map[int][]blockState      // block states of pieces being downloaded
+	requestedBy  map[Block]map[string]bool // peers each outstanding block was requested from
+	peers        map[string]*peerState
+}
+
+// New returns a Picker for the torrent described by info, with have holding the pieces
+// already downloaded. A nil have means no pieces.
+func New(info *torrent.InfoDict, have torrent.Bitfield, opts Options) *Picker {
+	if opts.PipelineDepth <= 0 {
+		opts.PipelineDepth = DefaultPipelineDepth
+	}
+	if opts.RandomFirstPieces == 0 {
+		opts.RandomFirstPieces = DefaultRandomFirstPieces
+	}
+	if opts.Strategy == nil {
+		opts.Strategy = RarestFirst{}
+	}
+
+	numPieces := info.NumPieces()
+	p := &Picker{
+		info:         info,
+		opts:         opts,
+		have:         torrent.NewBitfield(numPieces),
+		availability: make([]int, numPieces),
+		inProgress:   make(map[int][]blockState),
+		requestedBy:  make(map[Block]map[string]bool),
+		peers:        make(map[string]*peerState),
+	}
+	for i := 0; i < numPieces; i++ {
+		if have.Has(i) {
+			p.have.Set(i)
+			p.haveCount++
+		}
+	}
+	return p
+}
+
+// AddPeer registers a peer with the pieces announced in its bitfield, replacing any
+// previous state of the same peer. A nil bitfield means no pieces.
+func (p *Picker) AddPeer(id string, bitfield torrent.Bitfield) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.removePeer(id)
+	state := &peerState{have: torrent.NewBitfield(len(p.availability)), pending: make(map[Block]struct{})}
+	for i := range p.availability {
+		if bitfield.Has(i) {
+			state.have.Set(i)
+			p.availability[i]++
+		}
+	}
+	p.peers[id] = state
+}
+
+// PeerHave records that the peer announced the piece at index.
+func (p *Picker) PeerHave(id string, index int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state, ok := p.peers[id]
+	if !ok {
+		return fmt.Errorf("unknown peer %q", id)
+	}
+	if index < 0 || index >= len(p.availability) {
+		return fmt.Errorf("piece index %d out of range", index)
+	}
+	if !state.have.Has(index) {
+		state.have.Set(index)
+		p.availability[index]++
+	}
+	return nil
+}
+
+// RemovePeer forgets a peer, making the blocks requested from it available to other peers.
+func (p *Picker) RemovePeer(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.removePeer(id)
+}
+
+func (p *Picker) removePeer(id string) {
+	state, ok := p.peers[id]
+	if !ok {
+		return
+	}
+	for i := range p.availability {
+		if state.have.Has(i) {
+			p.availability[i]--
+		}
+	}
+	for block := range state.pending {
+		p.dropRequest(block, id)
+	}
+	delete(p.peers, id)
+}
+
+// Interesting reports whether the peer has a piece we do not have yet.
+func (p *Picker) Interesting(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state, ok := p.peers[id]
+	if !ok {
+		return false
+	}
+	for i := range p.availability {
+		if state.have.Has(i) && !p.have.Has(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the blocks to request from the peer now, filling its pipeline up to the
+// configured depth. The returned blocks are recorded as requested from the peer.
+// It returns nothing if the peer has no piece we need or its pipeline is full.
+func (p *Picker) Next(id string) []Block {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	state, ok := p.peers[id]
+	if !ok {
+		return nil
+	}
+	capacity := p.opts.PipelineDepth - len(state.pending)
+	if capacity <= 0 {
+		return nil
+	}
+
+	var blocks []Block
+	pick := func(block Block) bool {
+		blocks = append(blocks, block)
+		p.request(block, id, state)
+		capacity--
+		return capacity > 0
+	}
+
+	// finish the pieces already being downloaded first
+	for _, piece := range p.orderedInProgress(state) {
+		if !p.pickMissing(piece, pick) {
+			return blocks
+		}
+	}
+
+	// then start new pieces
+	for _, piece := range p.newPieces(state) {
+		if !p.pickMissing(piece, pick) {
+			return blocks
+		}
+	}
+
+	// endgame: every block we still need is requested, so ask this peer for them as well
+	if p.endgame() {
+		for _, piece := range p.orderedInProgress(state) {
+			for idx, st := range p.inProgress[piece] {
+				if st != blockRequested {
+					continue
+				}
+				block := p.block(piece, idx)
+				if _, pending := state.pending[block]; pending {
+					continue
+				}
+				if !pick(block) {
+					return blocks
+				}
+			}
+		}
+	}
+	return blocks
+}
+
+// BlockReceived records that the peer delivered block. It returns the other peers the block
+// is still requested from, which should be sent a cancel, as happens in endgame mode.
+// Blocks that were not requested from the peer are still accepted.
+func (p *Picker) BlockReceived(id string, block Block) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	states, ok := p.inProgress[block.Piece]
+	if !ok {
+		return nil, fmt.Errorf("piece %d is not being downloaded", block.Piece)
+	}
+	idx := block.Begin / torrent.BlockSize
+	if block.Begin%torrent.BlockSize != 0 || idx >= len(states) || block != p.block(block.Piece, idx) {
+		return nil, fmt.Errorf("invalid block %+v", block)
+	}
+	states[idx] = blockReceived
+
+	var cancel []string
+	for other := range p.requestedBy[block] {
+		if other != id {
+			cancel = append(cancel, other)
+		}
+		if state, ok := p.peers[other]; ok {
+			delete(state.pending, block)
+		}
+	}
+	delete(p.requestedBy, block)
+	slices.Sort(cancel)
+	return cancel, nil
+}
+
+// PieceComplete reports whether every block of the piece at index has been received,
+// so it can be verified.
+func (p *Picker) PieceComplete(index int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	states, ok := p.inProgress[index]
+	if !ok {
+		return false
+	}
+	for _, st := range states {
+		if st != blockReceived {
+			return false
+		}
+	}
+	return true
+}
+
+// PieceVerified marks the piece at index as downloaded.
+func (p *Picker) PieceVerified(index int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if index < 0 || index >= len(p.availability) {
+		return fmt.Errorf("piece index %d out of range", index)
+	}
+	p.forgetPiece(index)
+	if !p.have.Has(index) {
+		p.have.Set(index)
+		p.haveCount++
+	}
+	return nil
+}
+
+// PieceFailed discards the blocks of the piece at index after a failed hash check,
+// so the whole piece is downloaded again.
+func (p *Picker) PieceFailed(index int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.forgetPiece(index)
+}
+
+// BlocksFailed marks the blocks at the given block indices of the piece at index as missing
+// again, keeping the others, after the blocks of a failed piece were verified one by one.
+func (p *Picker) BlocksFailed(index int, blocks []int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	states, ok := p.inProgress[index]
+	if !ok {
+		return fmt.Errorf("piece %d is not being downloaded", index)
+	}
+	for _, idx := range blocks {
+		if idx < 0 || idx >= len(states) {
+			return fmt.Errorf("block index %d out of range for piece %d", idx, index)
+		}
+	}
+	for _, idx := range blocks {
+		block := p.block(index, idx)
+		for id := range p.requestedBy[block] {
+			if state, ok := p.peers[id]; ok {
+				delete(state.pending, block)
+			}
+		}
+		delete(p.requestedBy, block)
+		states[idx] = blockMissing
+	}
+	return nil
+}
+
+// Endgame reports whether the picker is in endgame mode.
+func (p *Picker) Endgame() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.endgame()
+}
+
+// Done reports whether every piece has been downloaded.
+func (p *Picker) Done() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.haveCount == len(p.availability)
+}
+
+// =====================================================================================
+
+// block returns the block at blockIndex within the piece.
+func (p *Picker) block(piece, blockIndex int) Block {
+	begin := blockIndex * torrent.BlockSize
+	length := min(int64(torrent.BlockSize), p.info.PieceSize(piece)-int64(begin))
+	return Block{Piece: piece, Begin: begin, Length: int(length)}
+}
+
+// pickMissing offers the unrequested blocks of the piece to pick until it returns false,
+// reporting whether picking should continue.
+func (p *Picker) pickMissing(piece int, pick func(Block) bool) bool {
+	states, ok := p.inProgress[piece]
+	if !ok {
+		numBlocks := int((p.info.PieceSize(piece) + torrent.BlockSize - 1) / torrent.BlockSize)
+		states = make([]blockState, numBlocks)
+		p.inProgress[piece] = states
+	}
+	for idx, st := range states {
+		if st == blockMissing && !pick(p.block(piece, idx)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Picker) request(block Block, id string, state *peerState) {
+	p.inProgress[block.Piece][block.Begin/torrent.BlockSize] = blockRequested
+	state.pending[block] = struct{}{}
+	if p.requestedBy[block] == nil {
+		p.requestedBy[block] = make(map[string]bool)
+	}
+	p.requestedBy[block][id] = true
+}
+
+// dropRequest forgets that block was requested from the peer, making it missing again
+// if no other peer has it pending.
+func (p *Picker) dropRequest(block Block, id string) {
+	delete(p.requestedBy[block], id)
+	if len(p.requestedBy[block]) > 0 {
+		return
+	}
+	delete(p.requestedBy, block)
+	if states, ok := p.inProgress[block.Piece]; ok && states[block.Begin/torrent.BlockSize] == blockRequested {
+		states[block.Begin/torrent.BlockSize] = blockMissing
+	}
+}
+
+// forgetPiece drops the download state of the piece, including its outstanding requests.
+func (p *Picker) forgetPiece(index int) {
+	states, ok := p.inProgress[index]
+	if !ok {
+		return
+	}
+	for idx := range states {
+		block := p.block(index, idx)
+		for id := range p.requestedBy[block] {
+			if state, ok := p.peers[id]; ok {
+				delete(state.pending, block)
+			}
+		}
+		delete(p.requestedBy, block)
+	}
+	delete(p.inProgress, index)
+}
+
+// orderedInProgress returns the pieces being downloaded that the peer has, in ascending order.
+func (p *Picker) orderedInProgress(state *peerState) []int {
+	var pieces []int
+	for i := range p.availability {
+		if _, ok := p.inProgress[i]; ok && state.have.Has(i) {
+			pieces = append(pieces, i)
+		}
+	}
+	return pieces
+}
+
+// newPieces returns the pieces the peer has that we neither have nor download yet,
+// in the order they should be started.
+func (p *Picker) newPieces(state *peerState) []int {
+	var candidates []int
+	for i := range p.availability {
+		if _, ok := p.inProgress[i]; !ok && !p.have.Has(i) && state.have.Has(i) {
+			candidates = append(candidates, i)
+		}
+	}
+
+	if p.haveCount < p.opts.RandomFirstPieces {
+		rand.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		return candidates
+	}
+	p.opts.Strategy.Prioritize(candidates, p.availability)
+	return candidates
+}
+
+// endgame reports whether every block of every missing piece has been requested or received.
+func (p *Picker) endgame() bool {
+	if p.haveCount == len(p.availability) {
+		return false
+	}
+	for i := range p.availability {
+		if p.have.Has(i) {
+			continue
+		}
+		states, ok := p.inProgress[i]
+		if !ok {
+			return false
+		}
+		for _, st := range states {
+			if st == blockMissing {
+				return false
+			}
+		}
+	}
+	return true
+}
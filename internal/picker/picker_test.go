@@ -0,0 +1,270 @@
+package picker
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// testInfo returns an InfoDict with 3 pieces of two blocks each, the last one holding a
+// single block of 100 bytes: 2*32 KiB + 100 bytes in total.
+func testInfo() *torrent.InfoDict {
+	return &torrent.InfoDict{
+		Name:        "picker",
+		PieceLength: 2 * torrent.BlockSize,
+		Pieces:      make([][20]byte, 3),
+		Files:       []torrent.FileInfo{{Length: 4*torrent.BlockSize + 100, Path: []string{"picker"}}},
+	}
+}
+
+// bitfield returns a bitfield of numPieces pieces with the given pieces set.
+func bitfield(numPieces int, pieces ...int) torrent.Bitfield {
+	b := torrent.NewBitfield(numPieces)
+	for _, piece := range pieces {
+		b.Set(piece)
+	}
+	return b
+}
+
+// TestNextPipelineDepth verifies that a peer is never given more outstanding blocks than
+// the pipeline depth and that blocks of a started piece are finished first.
+func TestNextPipelineDepth(t *testing.T) {
+	p := New(testInfo(), nil, Options{PipelineDepth: 3, RandomFirstPieces: -1, Strategy: Sequential{}})
+	p.AddPeer("a", bitfield(3, 0, 1, 2))
+
+	blocks := p.Next("a")
+	expected := []Block{
+		{Piece: 0, Begin: 0, Length: torrent.BlockSize},
+		{Piece: 0, Begin: torrent.BlockSize, Length: torrent.BlockSize},
+		{Piece: 1, Begin: 0, Length: torrent.BlockSize},
+	}
+	if !slices.Equal(blocks, expected) {
+		t.Fatalf("Next() = %+v, want %+v", blocks, expected)
+	}
+	if more := p.Next("a"); len(more) != 0 {
+		t.Errorf("expected a full pipeline, got %+v", more)
+	}
+
+	if _, err := p.BlockReceived("a", blocks[0]); err != nil {
+		t.Fatalf("BlockReceived() returned error: %v", err)
+	}
+	expected = []Block{{Piece: 1, Begin: torrent.BlockSize, Length: torrent.BlockSize}}
+	if got := p.Next("a"); !slices.Equal(got, expected) {
+		t.Errorf("Next() = %+v, want %+v", got, expected)
+	}
+}
+
+// TestNextRarestFirst verifies that the piece held by the fewest peers is started first,
+// and that only pieces the peer has are requested from it.
+func TestNextRarestFirst(t *testing.T) {
+	p := New(testInfo(), nil, Options{PipelineDepth: 1, RandomFirstPieces: -1})
+	p.AddPeer("a", bitfield(3, 0, 1, 2))
+	p.AddPeer("b", bitfield(3, 0, 2))
+	p.AddPeer("c", bitfield(3, 0))
+
+	if got := p.Next("a"); len(got) != 1 || got[0].Piece != 1 {
+		t.Errorf("Next(a) = %+v, want a block of the rarest piece 1", got)
+	}
+	if got := p.Next("c"); len(got) != 1 || got[0].Piece != 0 {
+		t.Errorf("Next(c) = %+v, want a block of piece 0, the only one it has", got)
+	}
+	if got := p.Next("unknown"); got != nil {
+		t.Errorf("Next(unknown) = %+v, want nil", got)
+	}
+}
+
+// TestNextRandomFirst verifies that pieces are picked at random until enough are downloaded.
+func TestNextRandomFirst(t *testing.T) {
+	info := testInfo()
+	info.Pieces = make([][20]byte, 64)
+	info.Files[0].Length = 64 * info.PieceLength
+
+	// with every piece equally available, rarest-first alone would still pick at random,
+	// so the sequential strategy is used to observe the random first pieces
+	seen := make(map[int]bool)
+	for range 10 {
+		p := New(info, nil, Options{PipelineDepth: 1, Strategy: Sequential{}})
+		all := make([]int, 64)
+		for i := range all {
+			all[i] = i
+		}
+		p.AddPeer("a", bitfield(64, all...))
+		seen[p.Next("a")[0].Piece] = true
+	}
+	if len(seen) < 2 {
+		t.Errorf("expected random first pieces, always got %v", seen)
+	}
+
+	have := bitfield(64, 10, 11, 12, 13)
+	p := New(info, have, Options{PipelineDepth: 1, Strategy: Sequential{}})
+	p.AddPeer("a", bitfield(64, 5, 20))
+	if got := p.Next("a"); got[0].Piece != 5 {
+		t.Errorf("Next() = %+v, want piece 5 once enough pieces are downloaded", got)
+	}
+}
+
+// TestEndgame verifies that outstanding blocks are requested from further peers once every
+// block is requested, and that the duplicates are reported for cancellation.
+func TestEndgame(t *testing.T) {
+	p := New(testInfo(), bitfield(3, 0, 1), Options{RandomFirstPieces: -1})
+	p.AddPeer("a", bitfield(3, 2))
+	p.AddPeer("b", bitfield(3, 2))
+
+	if p.Endgame() {
+		t.Error("expected no endgame before the last block is requested")
+	}
+	last := Block{Piece: 2, Begin: 0, Length: 100}
+	if got := p.Next("a"); !slices.Equal(got, []Block{last}) {
+		t.Fatalf("Next(a) = %+v, want %+v", got, []Block{last})
+	}
+	if !p.Endgame() {
+		t.Error("expected endgame once every block is requested")
+	}
+	if got := p.Next("b"); !slices.Equal(got, []Block{last}) {
+		t.Fatalf("Next(b) = %+v, want the duplicate %+v", got, []Block{last})
+	}
+	if got := p.Next("a"); len(got) != 0 {
+		t.Errorf("expected no duplicate for the same peer, got %+v", got)
+	}
+
+	cancel, err := p.BlockReceived("b", last)
+	if err != nil {
+		t.Fatalf("BlockReceived() returned error: %v", err)
+	}
+	if !slices.Equal(cancel, []string{"a"}) {
+		t.Errorf("BlockReceived() = %q, want [a]", cancel)
+	}
+	if !p.PieceComplete(2) {
+		t.Error("expected piece 2 to be complete")
+	}
+	if err := p.PieceVerified(2); err != nil {
+		t.Fatalf("PieceVerified() returned error: %v", err)
+	}
+	if !p.Done() || p.Endgame() {
+		t.Error("expected the download to be done and out of endgame")
+	}
+}
+
+// TestRemovePeer verifies that the blocks requested from a removed peer go to other peers.
+func TestRemovePeer(t *testing.T) {
+	p := New(testInfo(), bitfield(3, 1, 2), Options{RandomFirstPieces: -1})
+	p.AddPeer("a", bitfield(3, 0))
+	p.AddPeer("b", bitfield(3, 0))
+
+	requested := p.Next("a")
+	if len(requested) != 2 {
+		t.Fatalf("Next(a) = %+v, want both blocks of piece 0", requested)
+	}
+	p.RemovePeer("a")
+	if got := p.Next("b"); !slices.Equal(got, requested) {
+		t.Errorf("Next(b) = %+v, want %+v", got, requested)
+	}
+}
+
+// TestPieceFailed verifies that a piece failing its hash check is downloaded again.
+func TestPieceFailed(t *testing.T) {
+	p := New(testInfo(), bitfield(3, 1, 2), Options{RandomFirstPieces: -1})
+	p.AddPeer("a", bitfield(3, 0))
+
+	requested := p.Next("a")
+	for _, block := range requested {
+		if _, err := p.BlockReceived("a", block); err != nil {
+			t.Fatalf("BlockReceived() returned error: %v", err)
+		}
+	}
+	if !p.PieceComplete(0) {
+		t.Fatal("expected piece 0 to be complete")
+	}
+
+	p.PieceFailed(0)
+	if p.PieceComplete(0) {
+		t.Error("expected piece 0 to be incomplete after failing")
+	}
+	if got := p.Next("a"); !slices.Equal(got, requested) {
+		t.Errorf("Next() = %+v, want %+v again", got, requested)
+	}
+}
+
+// TestBlocksFailed verifies that only the blocks failing their hash check are downloaded again.
+func TestBlocksFailed(t *testing.T) {
+	p := New(testInfo(), bitfield(3, 1, 2), Options{RandomFirstPieces: -1})
+	p.AddPeer("a", bitfield(3, 0))
+
+	requested := p.Next("a")
+	for _, block := range requested {
+		if _, err := p.BlockReceived("a", block); err != nil {
+			t.Fatalf("BlockReceived() returned error: %v", err)
+		}
+	}
+	if err := p.BlocksFailed(0, []int{1}); err != nil {
+		t.Fatalf("BlocksFailed() returned error: %v", err)
+	}
+	if p.PieceComplete(0) {
+		t.Error("expected piece 0 to be incomplete after a block failed")
+	}
+	if got := p.Next("a"); !slices.Equal(got, requested[1:]) {
+		t.Errorf("Next() = %+v, want %+v", got, requested[1:])
+	}
+
+	if err := p.BlocksFailed(0, []int{2}); err == nil {
+		t.Error("BlocksFailed() of a block past the piece: expected error, got nil")
+	}
+	if err := p.BlocksFailed(1, []int{0}); err == nil {
+		t.Error("BlocksFailed() of a piece not downloaded: expected error, got nil")
+	}
+}
+
+// TestBlockReceivedInvalid ensures that blocks outside the pieces being downloaded are rejected.
+func TestBlockReceivedInvalid(t *testing.T) {
+	p := New(testInfo(), nil, Options{RandomFirstPieces: -1, Strategy: Sequential{}})
+	p.AddPeer("a", bitfield(3, 0))
+	p.Next("a")
+
+	tests := []struct {
+		name  string
+		block Block
+	}{
+		{"piece not downloaded", Block{Piece: 1, Begin: 0, Length: torrent.BlockSize}},
+		{"unaligned", Block{Piece: 0, Begin: 1, Length: torrent.BlockSize}},
+		{"past the piece", Block{Piece: 0, Begin: 2 * torrent.BlockSize, Length: torrent.BlockSize}},
+		{"wrong length", Block{Piece: 0, Begin: 0, Length: 10}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := p.BlockReceived("a", tc.block); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestPeerHave verifies that announced pieces become available and invalid ones are rejected.
+func TestPeerHave(t *testing.T) {
+	p := New(testInfo(), nil, Options{RandomFirstPieces: -1})
+	p.AddPeer("a", nil)
+
+	if got := p.Next("a"); len(got) != 0 {
+		t.Errorf("expected nothing to request from a peer without pieces, got %+v", got)
+	}
+	if p.Interesting("a") {
+		t.Error("expected a peer without pieces not to be interesting")
+	}
+	if err := p.PeerHave("a", 2); err != nil {
+		t.Fatalf("PeerHave() returned error: %v", err)
+	}
+	if got := p.Next("a"); len(got) != 1 || got[0].Piece != 2 {
+		t.Errorf("Next() = %+v, want the block of piece 2", got)
+	}
+
+	if !p.Interesting("a") || p.Interesting("unknown") {
+		t.Error("expected only the peer having piece 2 to be interesting")
+	}
+	if err := p.PeerHave("a", 3); err == nil {
+		t.Error("expected error for an out of range piece")
+	}
+	if err := p.PeerHave("unknown", 0); err == nil {
+		t.Error("expected error for an unknown peer")
+	}
+}
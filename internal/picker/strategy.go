@@ -0,0 +1,37 @@
+package picker
+
+import (
+	"math/rand/v2"
+	"slices"
+	"sort"
+)
+
+// Strategy decides in which order new pieces are started.
+type Strategy interface {
+	// Prioritize sorts candidates, a list of piece indices, in place so the piece to start
+	// first comes first. availability holds the number of connected peers having each piece.
+	Prioritize(candidates []int, availability []int)
+}
+
+// RarestFirst starts the pieces held by the fewest peers first, keeping rare pieces alive
+// in the swarm. Pieces with equal availability are ordered randomly.
+type RarestFirst struct{}
+
+// Prioritize implements Strategy.
+func (RarestFirst) Prioritize(candidates []int, availability []int) {
+	// shuffle before the stable sort so ties end up in random order
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return availability[candidates[i]] < availability[candidates[j]]
+	})
+}
+
+// Sequential starts pieces in ascending order, as needed for streaming.
+type Sequential struct{}
+
+// Prioritize implements Strategy.
+func (Sequential) Prioritize(candidates []int, _ []int) {
+	slices.Sort(candidates)
+}
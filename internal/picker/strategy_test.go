@@ -0,0 +1,26 @@
+package picker
+
+import (
+	"slices"
+	"testing"
+)
+
+// TestStrategies verifies the order produced by the built-in strategies.
+func TestStrategies(t *testing.T) {
+	availability := []int{3, 1, 2, 1, 0}
+
+	candidates := []int{0, 1, 2, 3, 4}
+	RarestFirst{}.Prioritize(candidates, availability)
+	if candidates[0] != 4 || candidates[3] != 2 || candidates[4] != 0 {
+		t.Errorf("RarestFirst order = %v, want 4 first, then 1 and 3, then 2, then 0", candidates)
+	}
+	if ties := candidates[1:3]; !slices.Contains(ties, 1) || !slices.Contains(ties, 3) {
+		t.Errorf("RarestFirst order = %v, want pieces 1 and 3 in the middle", candidates)
+	}
+
+	candidates = []int{3, 0, 4}
+	Sequential{}.Prioritize(candidates, availability)
+	if !slices.Equal(candidates, []int{0, 3, 4}) {
+		t.Errorf("Sequential order = %v, want [0 3 4]", candidates)
+	}
+}
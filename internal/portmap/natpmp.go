@@ -0,0 +1,153 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"time"
+)
+
+// NATPMPPort is the port NAT-PMP servers listen on.
+const NATPMPPort = 5351
+
+// NAT-PMP opcodes, responses carry the request opcode plus 128
+const (
+	opExternalAddress = 0
+	opMapUDP          = 1
+	opMapTCP          = 2
+	opResponse        = 128
+)
+
+// natpmpAttempts is the number of times a request is sent before giving up, the first after
+// natpmpTimeout and each following one after twice as long as the previous.
+const (
+	natpmpAttempts = 4
+	natpmpTimeout  = 250 * time.Millisecond
+)
+
+// natpmpResults describes the result codes of NAT-PMP responses.
+var natpmpResults = map[uint16]string{
+	1: "unsupported version",
+	2: "not authorized",
+	3: "network failure",
+	4: "out of resources",
+	5: "unsupported opcode",
+}
+
+// NATPMP maps ports with NAT-PMP. The zero value talks to the default gateway.
+type NATPMP struct {
+	Gateway netip.AddrPort // NAT-PMP server, the default gateway on NATPMPPort if zero
+}
+
+// Map implements Mapper.
+func (n *NATPMP) Map(ctx context.Context, protocol string, internalPort uint16, lifetime time.Duration) (Mapping, error) {
+	resp, err := n.call(ctx, []byte{0, opExternalAddress}, 12)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("requesting external address: %w", err)
+	}
+	externalIP := netip.AddrFrom4([4]byte(resp[8:12]))
+
+	resp, err = n.mapPort(ctx, protocol, internalPort, internalPort, lifetime)
+	if err != nil {
+		return Mapping{}, err
+	}
+	return Mapping{
+		Protocol:     protocol,
+		InternalPort: internalPort,
+		External:     netip.AddrPortFrom(externalIP, binary.BigEndian.Uint16(resp[10:12])),
+		Lifetime:     time.Duration(binary.BigEndian.Uint32(resp[12:16])) * time.Second,
+	}, nil
+}
+
+// Unmap implements Mapper.
+func (n *NATPMP) Unmap(ctx context.Context, m Mapping) error {
+	_, err := n.mapPort(ctx, m.Protocol, m.InternalPort, 0, 0) // a zero lifetime deletes the mapping
+	return err
+}
+
+func (n *NATPMP) String() string {
+	return "NAT-PMP"
+}
+
+// mapPort sends a mapping request and returns the 16-byte response.
+func (n *NATPMP) mapPort(ctx context.Context, protocol string, internalPort, externalPort uint16, lifetime time.Duration) ([]byte, error) {
+	var op byte
+	switch protocol {
+	case TCP:
+		op = opMapTCP
+	case UDP:
+		op = opMapUDP
+	default:
+		return nil, fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	req := []byte{0, op, 0, 0} // version, opcode, reserved
+	req = binary.BigEndian.AppendUint16(req, internalPort)
+	req = binary.BigEndian.AppendUint16(req, externalPort)
+	req = binary.BigEndian.AppendUint32(req, uint32(lifetime/time.Second))
+	resp, err := n.call(ctx, req, 16)
+	if err != nil {
+		return nil, fmt.Errorf("mapping port %d: %w", internalPort, err)
+	}
+	return resp, nil
+}
+
+// call sends req to the server until it answers, and returns its response of respLen bytes
+// after checking the opcode and the result code.
+func (n *NATPMP) call(ctx context.Context, req []byte, respLen int) ([]byte, error) {
+	server := n.Gateway
+	if !server.IsValid() {
+		gateway, err := defaultGateway()
+		if err != nil {
+			return nil, err
+		}
+		server = netip.AddrPortFrom(gateway, NATPMPPort)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", server.String())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	buf := make([]byte, 16)
+	timeout := natpmpTimeout
+	for range natpmpAttempts {
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		timeout *= 2
+
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break // send again
+				}
+				return nil, err
+			}
+			if n < respLen || buf[1] != req[1]+opResponse {
+				continue // stray or truncated response
+			}
+			if result := binary.BigEndian.Uint16(buf[2:4]); result != 0 {
+				if reason, ok := natpmpResults[result]; ok {
+					return nil, fmt.Errorf("gateway refused: %s", reason)
+				}
+				return nil, fmt.Errorf("gateway refused with result code %d", result)
+			}
+			return buf[:respLen], nil
+		}
+	}
+	return nil, errors.New("gateway did not answer")
+}
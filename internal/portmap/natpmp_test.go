@@ -0,0 +1,91 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+// natpmpServer answers NAT-PMP requests on a local UDP port with the external address
+// 203.0.113.7 and the requested ports, or with the given result code if not zero.
+// Mapping requests are sent to the returned channel.
+func natpmpServer(t *testing.T, result uint16) (netip.AddrPort, <-chan []byte) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	requests := make(chan []byte, 16)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			req := append([]byte(nil), buf[:n]...)
+			resp := []byte{0, req[1] + opResponse}
+			resp = binary.BigEndian.AppendUint16(resp, result)
+			resp = binary.BigEndian.AppendUint32(resp, 1234) // seconds since the mapping table was reset
+			if req[1] == opExternalAddress {
+				resp = append(resp, 203, 0, 113, 7)
+			} else {
+				requests <- req
+				resp = append(resp, req[4:12]...) // internal port, external port, lifetime
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return netip.MustParseAddrPort(conn.LocalAddr().String()), requests
+}
+
+// TestNATPMP maps and unmaps a port with a NAT-PMP server.
+func TestNATPMP(t *testing.T) {
+	server, requests := natpmpServer(t, 0)
+	n := &NATPMP{Gateway: server}
+	ctx := context.Background()
+
+	m, err := n.Map(ctx, TCP, 6881, time.Hour)
+	if err != nil {
+		t.Fatalf("Map() returned error: %v", err)
+	}
+	want := Mapping{Protocol: TCP, InternalPort: 6881, External: netip.MustParseAddrPort("203.0.113.7:6881"), Lifetime: time.Hour}
+	if m != want {
+		t.Errorf("Map() = %+v, want %+v", m, want)
+	}
+	if req := <-requests; req[1] != opMapTCP || binary.BigEndian.Uint32(req[8:]) != 3600 {
+		t.Errorf("unexpected mapping request %x", req)
+	}
+
+	if err := n.Unmap(ctx, m); err != nil {
+		t.Fatalf("Unmap() returned error: %v", err)
+	}
+	if req := <-requests; binary.BigEndian.Uint16(req[6:]) != 0 || binary.BigEndian.Uint32(req[8:]) != 0 {
+		t.Errorf("unmapping request %x should ask for a zero port and lifetime", req)
+	}
+}
+
+// TestNATPMPErrors checks refused requests and unresponsive servers.
+func TestNATPMPErrors(t *testing.T) {
+	server, _ := natpmpServer(t, 2)
+	if _, err := (&NATPMP{Gateway: server}).Map(context.Background(), TCP, 6881, time.Hour); err == nil {
+		t.Error("expected error for a refused request, got nil")
+	}
+
+	silent, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	n := &NATPMP{Gateway: netip.MustParseAddrPort(silent.LocalAddr().String())}
+	if _, err := n.Map(ctx, TCP, 6881, time.Hour); err == nil {
+		t.Error("expected error for a silent server, got nil")
+	}
+}
@@ -0,0 +1,177 @@
+// Package portmap forwards the listening port of the client on the local router, so peers
+// outside the local network can connect to it.
+//
+// Two protocols are supported: UPnP Internet Gateway Device, found on most home routers, and
+// NAT-PMP, used by Apple routers and others. Both grant mappings for a limited lifetime, so
+// Keep renews the mapping before it expires and removes it when the client stops.
+//
+// Reference: https://datatracker.ietf.org/doc/html/rfc6886
+// Reference: https://upnp.org/specs/gw/UPnP-gw-WANIPConnection-v2-Service.pdf
+package portmap
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/logging"
+)
+
+// DefaultLifetime is the lifetime requested for mappings.
+const DefaultLifetime = 2 * time.Hour
+
+// mapping protocols
+const (
+	TCP = "TCP"
+	UDP = "UDP"
+)
+
+const (
+	retryInterval = time.Minute     // wait after every mapper failed
+	unmapTimeout  = 5 * time.Second // bounds the removal of the mapping when Keep stops
+)
+
+// Mapping is a port forwarded on the router.
+type Mapping struct {
+	Protocol     string         // TCP or UDP
+	InternalPort uint16         // port the client listens on
+	External     netip.AddrPort // address peers outside the local network connect to
+	Lifetime     time.Duration  // time until the mapping expires, zero if it does not
+}
+
+// Mapper creates port mappings on the router with one protocol.
+type Mapper interface {
+	// Map forwards internalPort, asking for the same external port and the given lifetime.
+	// Mapping a port again renews the mapping.
+	Map(ctx context.Context, protocol string, internalPort uint16, lifetime time.Duration) (Mapping, error)
+	// Unmap removes a mapping returned by Map.
+	Unmap(ctx context.Context, m Mapping) error
+	// String returns the name of the protocol.
+	String() string
+}
+
+// DefaultMappers returns the mappers tried by default: UPnP, then NAT-PMP with the
+// default gateway.
+func DefaultMappers() []Mapper {
+	return []Mapper{&UPnP{}, &NATPMP{}}
+}
+
+// Keep maps internalPort with the first of mappers that succeeds, renews the mapping halfway
+// through its lifetime and removes it once ctx is cancelled. onChange, if not nil, is called
+// whenever the external address of the mapping changes. If every mapper fails, Keep tries them
+// all again after a minute. It returns once the mapping is removed.
+func Keep(ctx context.Context, mappers []Mapper, protocol string, internalPort uint16, logger *slog.Logger, onChange func(Mapping)) {
+	logger = logging.Or(logger, logging.Session)
+
+	var (
+		current Mapper // mapper of the current mapping, nil if none
+		mapping Mapping
+	)
+	defer func() {
+		if current == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), unmapTimeout)
+		defer cancel()
+		if err := current.Unmap(ctx, mapping); err != nil {
+			logger.Debug("removing port mapping failed", "method", current.String(), "error", err)
+		}
+	}()
+
+	for {
+		// renew with the current mapper, falling back to every mapper in order
+		candidates := mappers
+		if current != nil {
+			candidates = []Mapper{current}
+			for _, mapper := range mappers {
+				if mapper != current {
+					candidates = append(candidates, mapper)
+				}
+			}
+		}
+		var (
+			mapper Mapper
+			m      Mapping
+			errs   []error
+		)
+		for _, candidate := range candidates {
+			var err error
+			if m, err = candidate.Map(ctx, protocol, internalPort, DefaultLifetime); err == nil {
+				mapper = candidate
+				break
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", candidate, err))
+		}
+
+		wait := retryInterval
+		if mapper == nil {
+			logger.Warn("port mapping failed", "port", internalPort, "error", errors.Join(errs...))
+			current = nil
+		} else {
+			if mapper != current || m.External != mapping.External {
+				logger.Info("port mapped", "method", mapper.String(), "port", internalPort, "external", m.External.String(), "lifetime", m.Lifetime)
+				if onChange != nil {
+					onChange(m)
+				}
+			}
+			current, mapping = mapper, m
+			wait = DefaultLifetime / 2
+			if m.Lifetime > 0 {
+				wait = m.Lifetime / 2
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// routeTable is the Linux routing table, read to find the default gateway.
+var routeTable = "/proc/net/route"
+
+// defaultGateway returns the IPv4 address of the default gateway.
+func defaultGateway() (netip.Addr, error) {
+	f, err := os.Open(routeTable)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("finding default gateway: %w", err)
+	}
+	defer f.Close()
+
+	// each line holds the interface, destination and gateway, in little-endian hex
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		raw, err := hex.DecodeString(fields[2])
+		if err != nil || len(raw) != 4 {
+			continue
+		}
+		var ip [4]byte
+		binary.BigEndian.PutUint32(ip[:], binary.LittleEndian.Uint32(raw))
+		if gateway := netip.AddrFrom4(ip); !gateway.IsUnspecified() {
+			return gateway, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return netip.Addr{}, fmt.Errorf("finding default gateway: %w", err)
+	}
+	return netip.Addr{}, errors.New("no default gateway")
+}
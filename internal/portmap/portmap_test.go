@@ -0,0 +1,104 @@
+package portmap
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMapper maps ports to external, or fails if external is invalid.
+type fakeMapper struct {
+	name     string
+	external netip.AddrPort
+	lifetime time.Duration
+
+	mu       sync.Mutex
+	maps     int
+	unmapped []Mapping
+}
+
+func (f *fakeMapper) Map(ctx context.Context, protocol string, internalPort uint16, lifetime time.Duration) (Mapping, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.maps++
+	if !f.external.IsValid() {
+		return Mapping{}, errors.New("no gateway")
+	}
+	return Mapping{Protocol: protocol, InternalPort: internalPort, External: f.external, Lifetime: f.lifetime}, nil
+}
+
+func (f *fakeMapper) Unmap(ctx context.Context, m Mapping) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.unmapped = append(f.unmapped, m)
+	return nil
+}
+
+func (f *fakeMapper) String() string { return f.name }
+
+// TestKeep checks that Keep falls back to the next mapper, renews the mapping and removes it
+// once cancelled.
+func TestKeep(t *testing.T) {
+	failing := &fakeMapper{name: "failing"}
+	working := &fakeMapper{name: "working", external: netip.MustParseAddrPort("203.0.113.7:7000"), lifetime: 40 * time.Millisecond}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan Mapping, 4)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Keep(ctx, []Mapper{failing, working}, TCP, 6881, nil, func(m Mapping) { changes <- m })
+	}()
+
+	m := <-changes
+	if m.External != working.external || m.InternalPort != 6881 {
+		t.Errorf("unexpected mapping %+v", m)
+	}
+	time.Sleep(100 * time.Millisecond) // a few renewals, at half the lifetime
+	cancel()
+	<-done
+
+	working.mu.Lock()
+	defer working.mu.Unlock()
+	if working.maps < 3 {
+		t.Errorf("mapping was renewed %d times, want at least 2", working.maps-1)
+	}
+	if len(working.unmapped) != 1 || working.unmapped[0] != m {
+		t.Errorf("unmapped %+v, want %+v", working.unmapped, m)
+	}
+	if len(changes) != 0 {
+		t.Errorf("onChange called again for renewals of the same mapping")
+	}
+	failing.mu.Lock()
+	defer failing.mu.Unlock()
+	if failing.maps != 1 {
+		t.Errorf("failing mapper tried %d times, want once while the other one works", failing.maps)
+	}
+}
+
+// TestDefaultGateway parses the default route of a Linux routing table.
+func TestDefaultGateway(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "route")
+	table := "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\n" +
+		"eth0\t0001A8C0\t00000000\t0001\t0\t0\t0\t00FFFFFF\n" +
+		"eth0\t00000000\t0101A8C0\t0003\t0\t0\t0\t00000000\n"
+	if err := os.WriteFile(path, []byte(table), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	old := routeTable
+	routeTable = path
+	defer func() { routeTable = old }()
+
+	gateway, err := defaultGateway()
+	if err != nil {
+		t.Fatalf("defaultGateway() returned error: %v", err)
+	}
+	if want := netip.MustParseAddr("192.168.1.1"); gateway != want {
+		t.Errorf("defaultGateway() = %v, want %v", gateway, want)
+	}
+}
@@ -0,0 +1,359 @@
+package portmap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SSDP discovery of Internet Gateway Devices
+const (
+	ssdpAddr    = "239.255.255.250:1900"
+	ssdpTarget  = "urn:schemas-upnp-org:device:InternetGatewayDevice:1"
+	ssdpTimeout = 3 * time.Second
+)
+
+// maxDescriptionSize limits how much of a device description or SOAP response is read.
+const maxDescriptionSize = 1 << 20
+
+// wanServices are the service types able to map ports, in order of preference.
+var wanServices = []string{
+	"urn:schemas-upnp-org:service:WANIPConnection:2",
+	"urn:schemas-upnp-org:service:WANIPConnection:1",
+	"urn:schemas-upnp-org:service:WANPPPConnection:1",
+}
+
+// errOnlyPermanentLeases is the UPnP error code of gateways that reject lease durations.
+const errOnlyPermanentLeases = 725
+
+// UPnP maps ports with UPnP Internet Gateway Devices. The zero value discovers the gateway
+// with SSDP on first use. It is safe for concurrent use.
+type UPnP struct {
+	Location   string       // URL of the gateway's device description, discovered if empty
+	HTTPClient *http.Client // client used for requests, http.DefaultClient if nil
+
+	mu          sync.Mutex
+	controlURL  string // SOAP endpoint of the WAN connection service, empty until discovered
+	serviceType string
+}
+
+// Map implements Mapper.
+func (u *UPnP) Map(ctx context.Context, protocol string, internalPort uint16, lifetime time.Duration) (Mapping, error) {
+	if err := u.discover(ctx); err != nil {
+		return Mapping{}, err
+	}
+	localIP, err := u.localIP()
+	if err != nil {
+		return Mapping{}, err
+	}
+
+	args := func(lease time.Duration) [][2]string {
+		return [][2]string{
+			{"NewRemoteHost", ""},
+			{"NewExternalPort", strconv.Itoa(int(internalPort))},
+			{"NewProtocol", protocol},
+			{"NewInternalPort", strconv.Itoa(int(internalPort))},
+			{"NewInternalClient", localIP.String()},
+			{"NewEnabled", "1"},
+			{"NewPortMappingDescription", "gobit"},
+			{"NewLeaseDuration", strconv.Itoa(int(lease / time.Second))},
+		}
+	}
+	_, err = u.soap(ctx, "AddPortMapping", args(lifetime))
+	var upnpErr *upnpError
+	if errors.As(err, &upnpErr) && upnpErr.Code == errOnlyPermanentLeases {
+		lifetime = 0
+		_, err = u.soap(ctx, "AddPortMapping", args(lifetime))
+	}
+	if err != nil {
+		return Mapping{}, fmt.Errorf("mapping port %d: %w", internalPort, err)
+	}
+
+	resp, err := u.soap(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return Mapping{}, fmt.Errorf("requesting external address: %w", err)
+	}
+	externalIP, err := netip.ParseAddr(resp["NewExternalIPAddress"])
+	if err != nil {
+		return Mapping{}, fmt.Errorf("invalid external address %q", resp["NewExternalIPAddress"])
+	}
+	return Mapping{
+		Protocol:     protocol,
+		InternalPort: internalPort,
+		External:     netip.AddrPortFrom(externalIP, internalPort),
+		Lifetime:     lifetime,
+	}, nil
+}
+
+// Unmap implements Mapper.
+func (u *UPnP) Unmap(ctx context.Context, m Mapping) error {
+	if err := u.discover(ctx); err != nil {
+		return err
+	}
+	_, err := u.soap(ctx, "DeletePortMapping", [][2]string{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(m.External.Port()))},
+		{"NewProtocol", m.Protocol},
+	})
+	return err
+}
+
+func (u *UPnP) String() string {
+	return "UPnP"
+}
+
+func (u *UPnP) httpClient() *http.Client {
+	if u.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return u.HTTPClient
+}
+
+// discover finds the control URL of the gateway's WAN connection service, unless it is
+// already known.
+func (u *UPnP) discover(ctx context.Context) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.controlURL != "" {
+		return nil
+	}
+
+	location := u.Location
+	if location == "" {
+		var err error
+		if location, err = ssdpSearch(ctx); err != nil {
+			return err
+		}
+	}
+	controlURL, serviceType, err := u.fetchDescription(ctx, location)
+	if err != nil {
+		return err
+	}
+	u.controlURL, u.serviceType = controlURL, serviceType
+	return nil
+}
+
+// upnpDevice is a device of a UPnP device description, with its embedded devices.
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+// fetchDescription returns the control URL and the type of the preferred WAN connection
+// service in the device description at location.
+func (u *UPnP) fetchDescription(ctx context.Context, location string) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return "", "", err
+	}
+	resp, err := u.httpClient().Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("fetching device description: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("fetching device description: unexpected HTTP status: %s", resp.Status)
+	}
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxDescriptionSize)).Decode(&root); err != nil {
+		return "", "", fmt.Errorf("decoding device description: %w", err)
+	}
+	base, err := url.Parse(location)
+	if root.URLBase != "" {
+		base, err = url.Parse(root.URLBase)
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	for _, serviceType := range wanServices {
+		devices := []upnpDevice{root.Device}
+		for len(devices) > 0 {
+			device := devices[0]
+			devices = append(devices[1:], device.Devices...)
+			for _, service := range device.Services {
+				if strings.TrimSpace(service.ServiceType) != serviceType {
+					continue
+				}
+				controlURL, err := base.Parse(strings.TrimSpace(service.ControlURL))
+				if err != nil {
+					return "", "", fmt.Errorf("invalid control URL: %w", err)
+				}
+				return controlURL.String(), serviceType, nil
+			}
+		}
+	}
+	return "", "", errors.New("gateway has no WAN connection service")
+}
+
+// localIP returns the address of this host on the gateway's network.
+func (u *UPnP) localIP() (netip.Addr, error) {
+	u.mu.Lock()
+	controlURL := u.controlURL
+	u.mu.Unlock()
+
+	parsed, err := url.Parse(controlURL)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	host := parsed.Host
+	if parsed.Port() == "" {
+		host = net.JoinHostPort(parsed.Hostname(), "80")
+	}
+	// connecting a UDP socket sends nothing, but picks the local address routing to host
+	conn, err := net.Dial("udp", host)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("finding local address: %w", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(), nil
+}
+
+// upnpError is the error returned by a gateway in a SOAP fault.
+type upnpError struct {
+	Code        int
+	Description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("gateway refused: %s (UPnP error %d)", e.Description, e.Code)
+}
+
+// soap invokes action on the WAN connection service with the given arguments, in order,
+// and returns the output arguments by name.
+func (u *UPnP) soap(ctx context.Context, action string, args [][2]string) (map[string]string, error) {
+	u.mu.Lock()
+	controlURL, serviceType := u.controlURL, u.serviceType
+	u.mu.Unlock()
+
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" ` +
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg[0])
+		xml.EscapeText(&body, []byte(arg[1]))
+		fmt.Fprintf(&body, "</%s>", arg[0])
+	}
+	fmt.Fprintf(&body, "</u:%s></s:Body></s:Envelope>", action)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, serviceType, action))
+	resp, err := u.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	values, err := xmlLeaves(io.LimitReader(resp.Body, maxDescriptionSize))
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s response: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if code, err := strconv.Atoi(values["errorCode"]); err == nil {
+			return nil, &upnpError{Code: code, Description: values["errorDescription"]}
+		}
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+	return values, nil
+}
+
+// xmlLeaves returns the text of the elements of an XML document that have no child elements,
+// by local name.
+func xmlLeaves(r io.Reader) (map[string]string, error) {
+	values := make(map[string]string)
+	decoder := xml.NewDecoder(r)
+	var (
+		name string // innermost open element, empty once it has a child
+		text strings.Builder
+	)
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+			text.Reset()
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			if name == t.Name.Local {
+				values[name] = strings.TrimSpace(text.String())
+			}
+			name = ""
+		}
+	}
+}
+
+// ssdpSearch multicasts an SSDP search for Internet Gateway Devices and returns the location
+// of the description of the first one to answer.
+func ssdpSearch(ctx context.Context) (string, error) {
+	conn, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	dst, err := net.ResolveUDPAddr("udp4", ssdpAddr)
+	if err != nil {
+		return "", err
+	}
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: " + ssdpAddr + "\r\n" +
+		"ST: " + ssdpTarget + "\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n\r\n"
+	if _, err := conn.WriteTo([]byte(search), dst); err != nil {
+		return "", fmt.Errorf("sending SSDP search: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(ssdpTimeout))
+	buf := make([]byte, 2048)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", fmt.Errorf("no UPnP gateway found: %w", err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if location := resp.Header.Get("Location"); location != "" {
+			return location, nil
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package portmap
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatewayDescription nests the WAN connection service in embedded devices, like real gateways.
+const gatewayDescription = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <deviceList><device>
+      <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+      <deviceList><device>
+        <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+        <serviceList><service>
+          <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+          <controlURL>/ctl/IPConn</controlURL>
+        </service></serviceList>
+      </device></deviceList>
+    </device></deviceList>
+  </device>
+</root>`
+
+// fakeGateway is a UPnP gateway recording the SOAP actions it receives.
+type fakeGateway struct {
+	permanentOnly bool // refuse lease durations with UPnP error 725
+
+	mu      sync.Mutex
+	actions []string // action and body of each request
+}
+
+func (g *fakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/desc.xml" {
+		io.WriteString(w, gatewayDescription)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	action := r.Header.Get("SOAPAction")
+	g.mu.Lock()
+	g.actions = append(g.actions, action+" "+string(body))
+	g.mu.Unlock()
+
+	switch {
+	case strings.HasSuffix(action, `#AddPortMapping"`) && g.permanentOnly && !strings.Contains(string(body), "<NewLeaseDuration>0<"):
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `<s:Envelope><s:Body><s:Fault><detail><UPnPError><errorCode>725</errorCode>`+
+			`<errorDescription>OnlyPermanentLeasesSupported</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`)
+	case strings.HasSuffix(action, `#GetExternalIPAddress"`):
+		io.WriteString(w, `<s:Envelope><s:Body><u:GetExternalIPAddressResponse>`+
+			`<NewExternalIPAddress>203.0.113.7</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`)
+	default:
+		io.WriteString(w, `<s:Envelope><s:Body></s:Body></s:Envelope>`)
+	}
+}
+
+// TestUPnP maps and unmaps a port with a UPnP gateway.
+func TestUPnP(t *testing.T) {
+	tests := []struct {
+		name          string
+		permanentOnly bool
+		wantLifetime  time.Duration
+	}{
+		{name: "lease", wantLifetime: time.Hour},
+		{name: "permanent leases only", permanentOnly: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			gateway := &fakeGateway{permanentOnly: tc.permanentOnly}
+			server := httptest.NewServer(gateway)
+			defer server.Close()
+			u := &UPnP{Location: server.URL + "/desc.xml"}
+			ctx := context.Background()
+
+			m, err := u.Map(ctx, TCP, 6881, time.Hour)
+			if err != nil {
+				t.Fatalf("Map() returned error: %v", err)
+			}
+			want := Mapping{Protocol: TCP, InternalPort: 6881, External: netip.MustParseAddrPort("203.0.113.7:6881"), Lifetime: tc.wantLifetime}
+			if m != want {
+				t.Errorf("Map() = %+v, want %+v", m, want)
+			}
+			if err := u.Unmap(ctx, m); err != nil {
+				t.Fatalf("Unmap() returned error: %v", err)
+			}
+
+			gateway.mu.Lock()
+			defer gateway.mu.Unlock()
+			add := gateway.actions[len(gateway.actions)-3]
+			for _, arg := range []string{
+				`"urn:schemas-upnp-org:service:WANIPConnection:1#AddPortMapping"`,
+				"<NewExternalPort>6881</NewExternalPort>",
+				"<NewInternalClient>127.0.0.1</NewInternalClient>",
+				fmt.Sprintf("<NewLeaseDuration>%d</NewLeaseDuration>", int(tc.wantLifetime.Seconds())),
+			} {
+				if !strings.Contains(add, arg) {
+					t.Errorf("AddPortMapping request %q does not contain %q", add, arg)
+				}
+			}
+			if last := gateway.actions[len(gateway.actions)-1]; !strings.Contains(last, "#DeletePortMapping") {
+				t.Errorf("last action = %q, want DeletePortMapping", last)
+			}
+		})
+	}
+}
+
+// TestUPnPNoWANService checks that gateways without a WAN connection service are rejected.
+func TestUPnPNoWANService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `<root><device><serviceList></serviceList></device></root>`)
+	}))
+	defer server.Close()
+
+	u := &UPnP{Location: server.URL}
+	if _, err := u.Map(context.Background(), TCP, 6881, time.Hour); err == nil {
+		t.Error("expected error, got nil")
+	}
+}
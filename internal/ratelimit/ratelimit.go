@@ -0,0 +1,166 @@
+// Package ratelimit limits the transfer rate of the session, with limits that can change
+// by time of day and day of week following a Schedule.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minBurst is the smallest number of bytes a Limiter lets through at once, so that slow
+// limits still pass whole blocks without waiting for each one.
+const minBurst = 64 << 10
+
+// Limiter is a token bucket limiting a rate in bytes per second, shared by every
+// connection of a session. Its methods are safe for concurrent use, and a nil Limiter
+// does not limit anything.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   int64     // bytes per second, unlimited if zero
+	tokens float64   // bytes that may pass, negative while transfers wait
+	last   time.Time // when tokens was last refilled
+}
+
+// NewLimiter returns a Limiter allowing rate bytes per second, unlimited if zero.
+func NewLimiter(rate int64) *Limiter {
+	l := &Limiter{}
+	l.SetRate(rate)
+	return l
+}
+
+// Rate returns the rate in bytes per second, zero if unlimited.
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// SetRate changes the rate to rate bytes per second, unlimited if zero or negative.
+// Transfers already waiting keep the delay computed at the previous rate.
+func (l *Limiter) SetRate(rate int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	l.refill(now)
+	wasUnlimited := l.rate == 0
+	l.rate = max(rate, 0)
+	switch {
+	case l.rate == 0:
+		l.tokens = 0
+	case wasUnlimited:
+		l.tokens = float64(l.burst()) // start with a full bucket, as after an idle period
+	default:
+		l.tokens = min(l.tokens, float64(l.burst()))
+	}
+}
+
+// WaitN waits until n bytes may pass, or returns the context's error if ctx is cancelled
+// first. The bytes are accounted for even if WaitN returns early.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// refill adds the tokens earned since the last refill, up to the burst. l.mu must be held.
+func (l *Limiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*float64(l.rate), float64(l.burst()))
+	}
+	l.last = now
+}
+
+// burst returns the number of bytes that may pass at once after an idle period: one
+// second's worth, at least minBurst. l.mu must be held.
+func (l *Limiter) burst() int64 {
+	return max(l.rate, minBurst)
+}
+
+// =====================================================================================
+
+// ParseRate parses a rate in bytes per second: "unlimited" or 0, or a number with an
+// optional binary unit and "/s" suffix, such as "512KiB/s", "1M" or "65536".
+// Unlimited is returned as zero.
+func ParseRate(s string) (int64, error) {
+	text := strings.TrimSpace(s)
+	if strings.EqualFold(text, "unlimited") {
+		return 0, nil
+	}
+	text = strings.TrimSuffix(text, "/s")
+	number := strings.TrimRight(text, "BbiKkMmGg")
+	unit := strings.ToUpper(strings.TrimSuffix(strings.TrimSuffix(text[len(number):], "B"), "i"))
+	var multiplier int64
+	switch unit {
+	case "":
+		multiplier = 1
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	default:
+		return 0, fmt.Errorf("unknown unit in rate %q", s)
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n < 0 || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	rate := n * float64(multiplier)
+	if rate >= math.MaxInt64 {
+		return 0, fmt.Errorf("rate %q is too large", s)
+	}
+	return int64(rate), nil
+}
+
+// FormatRate formats a rate in bytes per second with the largest binary unit that keeps
+// it whole, such as "1MiB/s", or "unlimited" for zero. ParseRate reads it back.
+func FormatRate(rate int64) string {
+	if rate <= 0 {
+		return "unlimited"
+	}
+	for _, unit := range []struct {
+		name string
+		size int64
+	}{{"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}} {
+		if rate%unit.size == 0 {
+			return fmt.Sprintf("%d%s/s", rate/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%dB/s", rate)
+}
@@ -0,0 +1,88 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLimiter checks that transfers beyond the burst wait for the rate, and that an
+// unlimited or nil Limiter never waits.
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewLimiter(1 << 20)
+
+	start := time.Now()
+	if err := l.WaitN(ctx, 1<<20); err != nil { // the initial burst
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("WaitN() within the burst took %v", elapsed)
+	}
+	start = time.Now()
+	if err := l.WaitN(ctx, 100<<10); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond || elapsed > time.Second {
+		t.Errorf("WaitN() of 100 KiB at 1 MiB/s took %v, want about 100ms", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := l.WaitN(cancelled, 1<<20); !errors.Is(err, context.Canceled) {
+		t.Errorf("WaitN() with a cancelled context returned %v", err)
+	}
+
+	l.SetRate(0)
+	if l.Rate() != 0 {
+		t.Errorf("Rate() = %d after SetRate(0)", l.Rate())
+	}
+	start = time.Now()
+	var none *Limiter
+	none.SetRate(1)
+	for range 100 {
+		l.WaitN(ctx, 1<<30)
+		none.WaitN(ctx, 1<<30)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("unlimited WaitN() took %v", elapsed)
+	}
+}
+
+// TestParseRate covers units, suffixes and invalid rates, and the round trip through
+// FormatRate.
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{"unlimited", 0, false},
+		{"0", 0, false},
+		{"65536", 65536, false},
+		{"512KiB/s", 512 << 10, false},
+		{"1M", 1 << 20, false},
+		{"1.5MiB", 3 << 19, false},
+		{"2GB/s", 2 << 30, false},
+		{"fast", 0, true},
+		{"-1K", 0, true},
+		{"10TB", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+		{"1e30", 0, true},
+		{"8589934592G", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v; want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	for _, rate := range []int64{0, 1000, 1 << 10, 3 << 19, 1 << 30} {
+		if got, err := ParseRate(FormatRate(rate)); err != nil || got != rate {
+			t.Errorf("ParseRate(FormatRate(%d)) = %d, %v", rate, got, err)
+		}
+	}
+}
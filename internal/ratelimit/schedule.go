@@ -0,0 +1,259 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rates are the global transfer rate limits in bytes per second, unlimited if zero.
+type Rates struct {
+	Download int64
+	Upload   int64
+}
+
+// Weekdays is a set of days of the week, bit 1<<d standing for time.Weekday d.
+type Weekdays uint8
+
+// common sets of days
+const (
+	EveryDay Weekdays = 1<<7 - 1
+	Workdays Weekdays = 1<<time.Monday | 1<<time.Tuesday | 1<<time.Wednesday | 1<<time.Thursday | 1<<time.Friday
+	Weekends Weekdays = 1<<time.Saturday | 1<<time.Sunday
+)
+
+// Has reports whether d is in the set.
+func (w Weekdays) Has(d time.Weekday) bool {
+	return w&(1<<d) != 0
+}
+
+// String returns the set as "daily", "workdays", "weekends" or the comma-separated
+// abbreviated names of its days, such as "mon,wed".
+func (w Weekdays) String() string {
+	switch w {
+	case EveryDay:
+		return "daily"
+	case Workdays:
+		return "workdays"
+	case Weekends:
+		return "weekends"
+	}
+	var days []string
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if w.Has(d) {
+			days = append(days, dayNames[d])
+		}
+	}
+	return strings.Join(days, ",")
+}
+
+var dayNames = [7]string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// minutesPerDay is the number of minutes in a day, also the End of a window lasting until
+// midnight.
+const minutesPerDay = 24 * 60
+
+// Rule applies other rates during a daily time window.
+type Rule struct {
+	Days Weekdays // days the window starts on
+	// Start and End are the minutes since midnight the window starts and ends at. A window
+	// ending before it starts lasts past midnight into the next day, and one ending where
+	// it starts lasts the whole day.
+	Start, End int
+	Download   int64 // bytes per second during the window, unlimited if zero, the base rate if negative
+	Upload     int64 // bytes per second during the window, unlimited if zero, the base rate if negative
+}
+
+// contains reports whether the window of r includes t.
+func (r Rule) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	yesterday := (day + 6) % 7
+	switch {
+	case r.Start == r.End%minutesPerDay:
+		return r.Days.Has(day)
+	case r.Start < r.End:
+		return r.Days.Has(day) && r.Start <= minute && minute < r.End
+	default:
+		return r.Days.Has(day) && minute >= r.Start || r.Days.Has(yesterday) && minute < r.End
+	}
+}
+
+// String returns the rule in the syntax of ParseSchedule.
+func (r Rule) String() string {
+	s := fmt.Sprintf("%s %02d:%02d-%02d:%02d", r.Days, r.Start/60, r.Start%60, r.End/60, r.End%60)
+	if r.Download >= 0 {
+		s += " down=" + FormatRate(r.Download)
+	}
+	if r.Upload >= 0 {
+		s += " up=" + FormatRate(r.Upload)
+	}
+	return s
+}
+
+// Schedule lists the rules changing the rates by time of day and day of week. The first
+// rule whose window includes the current time applies; the base rates apply outside of
+// every window.
+type Schedule []Rule
+
+// At returns the rates in effect at t, given the base rates.
+func (s Schedule) At(t time.Time, base Rates) Rates {
+	for _, r := range s {
+		if !r.contains(t) {
+			continue
+		}
+		rates := base
+		if r.Download >= 0 {
+			rates.Download = r.Download
+		}
+		if r.Upload >= 0 {
+			rates.Upload = r.Upload
+		}
+		return rates
+	}
+	return base
+}
+
+// String returns the schedule in the syntax of ParseSchedule.
+func (s Schedule) String() string {
+	rules := make([]string, len(s))
+	for i, r := range s {
+		rules[i] = r.String()
+	}
+	return strings.Join(rules, "; ")
+}
+
+// ParseSchedule parses a schedule of rules separated by ';', each made of optional days,
+// a time window and the rates applying during it:
+//
+//	workdays 09:00-17:00 down=1MiB/s up=256KiB/s; 23:00-07:00 down=unlimited up=unlimited
+//
+// The days are "daily", the default, "workdays", "weekends", or a comma-separated list of
+// abbreviated day names and ranges such as "mon-thu,sat". A rate that is not given keeps
+// the base rate during the window. An empty string is an empty schedule.
+func ParseSchedule(s string) (Schedule, error) {
+	var schedule Schedule
+	for i, text := range strings.Split(s, ";") {
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		r, err := parseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		schedule = append(schedule, r)
+	}
+	return schedule, nil
+}
+
+// parseRule parses a rule of a schedule.
+func parseRule(text string) (Rule, error) {
+	fields := strings.Fields(text)
+	r := Rule{Days: EveryDay, Download: -1, Upload: -1}
+	if len(fields) > 0 && (fields[0][0] < '0' || fields[0][0] > '9') {
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return Rule{}, err
+		}
+		r.Days = days
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return Rule{}, errors.New("missing time window")
+	}
+
+	startText, endText, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return Rule{}, fmt.Errorf("invalid time window %q: expected HH:MM-HH:MM", fields[0])
+	}
+	var err error
+	if r.Start, err = parseClock(startText); err != nil {
+		return Rule{}, err
+	}
+	if r.End, err = parseClock(endText); err != nil {
+		return Rule{}, err
+	}
+	if r.Start == minutesPerDay {
+		return Rule{}, fmt.Errorf("invalid time window %q: must not start at 24:00", fields[0])
+	}
+
+	if len(fields) == 1 {
+		return Rule{}, errors.New("missing rates: expected down=RATE or up=RATE")
+	}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		rate, err := ParseRate(value)
+		if err != nil {
+			return Rule{}, err
+		}
+		switch key {
+		case "down":
+			r.Download = rate
+		case "up":
+			r.Upload = rate
+		default:
+			return Rule{}, fmt.Errorf("unknown rate %q: expected down or up", key)
+		}
+	}
+	return r, nil
+}
+
+// parseDays parses "daily", "workdays", "weekends" or a list of day names and ranges.
+func parseDays(s string) (Weekdays, error) {
+	switch strings.ToLower(s) {
+	case "daily":
+		return EveryDay, nil
+	case "workdays", "weekdays":
+		return Workdays, nil
+	case "weekends":
+		return Weekends, nil
+	}
+
+	var days Weekdays
+	for _, item := range strings.Split(s, ",") {
+		firstText, lastText, isRange := strings.Cut(item, "-")
+		first, err := parseDay(firstText)
+		if err != nil {
+			return 0, err
+		}
+		last := first
+		if isRange {
+			if last, err = parseDay(lastText); err != nil {
+				return 0, err
+			}
+		}
+		// ranges may wrap around the end of the week, such as fri-mon
+		for d := first; ; d = (d + 1) % 7 {
+			days |= 1 << d
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseDay parses an abbreviated or full day name, in any case.
+func parseDay(s string) (time.Weekday, error) {
+	name := strings.ToLower(s)
+	for d, abbreviation := range dayNames {
+		if name == abbreviation || len(name) > 3 && name == strings.ToLower(time.Weekday(d).String()) {
+			return time.Weekday(d), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown day %q", s)
+}
+
+// parseClock parses a time of day written HH:MM, up to 24:00, as minutes since midnight.
+func parseClock(s string) (int, error) {
+	hoursText, minutesText, ok := strings.Cut(s, ":")
+	hours, hoursErr := strconv.Atoi(hoursText)
+	minutes, minutesErr := strconv.Atoi(minutesText)
+	if !ok || hoursErr != nil || minutesErr != nil || hours < 0 || minutes < 0 || minutes > 59 ||
+		hours*60+minutes > minutesPerDay {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", s)
+	}
+	return hours*60 + minutes, nil
+}
@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSchedule checks which rates apply through the week, including a window past midnight.
+func TestSchedule(t *testing.T) {
+	s, err := ParseSchedule("workdays 09:00-17:00 down=1MiB/s; fri,sat 23:00-07:00 down=unlimited up=unlimited")
+	if err != nil {
+		t.Fatalf("ParseSchedule() returned error: %v", err)
+	}
+	base := Rates{Download: 4 << 20, Upload: 1 << 20}
+
+	// 2024-01-01 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		name string
+		t    time.Time
+		want Rates
+	}{
+		{"monday morning", at(1, 8, 59), base},
+		{"monday work hours", at(1, 9, 0), Rates{Download: 1 << 20, Upload: 1 << 20}},
+		{"monday evening", at(1, 17, 0), base},
+		{"friday night", at(5, 23, 30), Rates{}},
+		{"saturday early", at(6, 6, 59), Rates{}},
+		{"saturday day", at(6, 12, 0), base},
+		{"sunday early", at(7, 3, 0), Rates{}},
+		{"monday early", at(8, 3, 0), base},
+	}
+	for _, tt := range tests {
+		if got := s.At(tt.t, base); got != tt.want {
+			t.Errorf("%s: At(%s) = %+v, want %+v", tt.name, tt.t.Format("Mon 15:04"), got, tt.want)
+		}
+	}
+}
+
+// TestParseSchedule covers the day syntax, the round trip through String and invalid rules.
+func TestParseSchedule(t *testing.T) {
+	valid := []struct {
+		in   string
+		want string
+	}{
+		{"", ""},
+		{"00:00-24:00 up=0", "daily 00:00-24:00 up=unlimited"},
+		{"Saturday,sunday 8:00-20:30 down=100K", "weekends 08:00-20:30 down=100KiB/s"},
+		{"fri-mon 22:00-06:00 up=1M; wed 10:00-10:00 down=2M", "sun,mon,fri,sat 22:00-06:00 up=1MiB/s; wed 10:00-10:00 down=2MiB/s"},
+	}
+	for _, tt := range valid {
+		s, err := ParseSchedule(tt.in)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if got := s.String(); got != tt.want {
+			t.Errorf("ParseSchedule(%q).String() = %q, want %q", tt.in, got, tt.want)
+		}
+		if again, err := ParseSchedule(s.String()); err != nil || again.String() != tt.want {
+			t.Errorf("ParseSchedule(%q) = %v, %v; want the same schedule", s.String(), again, err)
+		}
+	}
+
+	invalid := []struct {
+		in      string
+		wantErr string
+	}{
+		{"workdays", "rule 1: missing time window"},
+		{"09:00-17:00", "missing rates"},
+		{"09:00 down=1M", "invalid time window"},
+		{"9-17 down=1M", "invalid time"},
+		{"09:00-25:00 down=1M", "invalid time"},
+		{"24:00-01:00 down=1M", "must not start at 24:00"},
+		{"funday 09:00-17:00 down=1M", `unknown day "funday"`},
+		{"09:00-17:00 sideways=1M", "unknown rate"},
+		{"daily 09:00-17:00 down=1M; 10:00-11:00 down=slow", "rule 2: invalid rate"},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseSchedule(tt.in); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("ParseSchedule(%q) error = %v, want one containing %q", tt.in, err, tt.wantErr)
+		}
+	}
+}
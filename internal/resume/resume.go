@@ -0,0 +1,172 @@
+// Package resume persists the state of a torrent between runs, so a restart does not have to
+// hash all of its content again.
+//
+// The state is stored in a bencoded resume file holding the verified pieces, the size and
+// modification time of every file of the content, the transfer counters, the seeding time and
+// the tracker ID.
+// The file states let a client tell whether the content changed while it was not running:
+// if any file differs, the resume data is stale and the content must be checked again.
+package resume
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// FileExtension is the extension of the resume files written by Save.
+const FileExtension = ".resume"
+
+// ErrStale is returned by Data.Check when the content on disk changed since the snapshot.
+var ErrStale = errors.New("resume data is stale")
+
+// FileState is the size and modification time of a file of the content. A file that does not
+// exist has Missing set.
+type FileState struct {
+	Size    int64 `bencode:"size"`
+	ModTime int64 `bencode:"mtime"` // UNIX time in nanoseconds
+	Missing bool  `bencode:"missing,omitempty"`
+}
+
+// Data is the resume state of a torrent.
+type Data struct {
+	InfoHash   infohash.V1 `bencode:"info-hash"`
+	Have       []byte      `bencode:"pieces"` // bitfield of the verified pieces
+	Files      []FileState `bencode:"files"`  // state of each file when the snapshot was taken
+	Downloaded int64       `bencode:"downloaded"`
+	Uploaded   int64       `bencode:"uploaded"`
+	TrackerID  string      `bencode:"tracker id,omitempty"`
+	// SeedingTime is the time spent seeding in seconds.
+	SeedingTime int64 `bencode:"seeding time,omitempty"`
+}
+
+// FileStates returns the current state of every file of the content described by info below
+// the download directory base, indexed like info.Files.
+func FileStates(info *torrent.InfoDict, base string) ([]FileState, error) {
+	return FileStatesFunc(info, contentPath(info, base))
+}
+
+// FileStatesFunc is like FileStates for content whose files are located by path.
+func FileStatesFunc(info *torrent.InfoDict, path func(fileIndex int) string) ([]FileState, error) {
+	states := make([]FileState, len(info.Files))
+	for idx := range info.Files {
+		stat, err := os.Stat(path(idx))
+		if errors.Is(err, fs.ErrNotExist) {
+			states[idx].Missing = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		states[idx] = FileState{Size: stat.Size(), ModTime: stat.ModTime().UnixNano()}
+	}
+	return states, nil
+}
+
+// Snapshot returns the resume data of the torrent mi whose content is stored below base,
+// with the pieces in have verified. The file states are read from disk.
+func Snapshot(mi *torrent.MetaInfo, base string, have torrent.Bitfield) (*Data, error) {
+	return SnapshotFunc(mi, contentPath(&mi.Info, base), have)
+}
+
+// SnapshotFunc is like Snapshot for content whose files are located by path.
+func SnapshotFunc(mi *torrent.MetaInfo, path func(fileIndex int) string, have torrent.Bitfield) (*Data, error) {
+	files, err := FileStatesFunc(&mi.Info, path)
+	if err != nil {
+		return nil, fmt.Errorf("reading file states: %w", err)
+	}
+	return &Data{InfoHash: mi.InfoHash, Have: append([]byte(nil), have...), Files: files}, nil
+}
+
+// Check reports whether d can be trusted for the torrent mi whose content is stored below base.
+// It returns an error wrapping ErrStale if d belongs to another torrent, or if any file was
+// created, removed, resized or modified since the snapshot was taken.
+func (d *Data) Check(mi *torrent.MetaInfo, base string) error {
+	return d.CheckFunc(mi, contentPath(&mi.Info, base))
+}
+
+// CheckFunc is like Check for content whose files are located by path.
+func (d *Data) CheckFunc(mi *torrent.MetaInfo, path func(fileIndex int) string) error {
+	if d.InfoHash != mi.InfoHash {
+		return fmt.Errorf("%w: info hash %x, want %x", ErrStale, d.InfoHash, mi.InfoHash)
+	}
+	if len(d.Have) != len(torrent.NewBitfield(mi.Info.NumPieces())) {
+		return fmt.Errorf("%w: bitfield of %d bytes for %d pieces", ErrStale, len(d.Have), mi.Info.NumPieces())
+	}
+	if len(d.Files) != len(mi.Info.Files) {
+		return fmt.Errorf("%w: %d file states for %d files", ErrStale, len(d.Files), len(mi.Info.Files))
+	}
+
+	current, err := FileStatesFunc(&mi.Info, path)
+	if err != nil {
+		return fmt.Errorf("reading file states: %w", err)
+	}
+	for idx, state := range current {
+		if state != d.Files[idx] {
+			return fmt.Errorf("%w: file %d changed", ErrStale, idx)
+		}
+	}
+	return nil
+}
+
+// contentPath returns the function locating the files of the content described by info
+// below the download directory base.
+func contentPath(info *torrent.InfoDict, base string) func(fileIndex int) string {
+	return func(fileIndex int) string { return info.ContentPath(base, fileIndex) }
+}
+
+// Bitfield returns the verified pieces.
+func (d *Data) Bitfield() torrent.Bitfield {
+	return append(torrent.Bitfield(nil), d.Have...)
+}
+
+// Path returns the path of the resume file of the torrent with the given info hash in dir.
+func Path(dir string, infoHash infohash.V1) string {
+	return filepath.Join(dir, infoHash.Hex()+FileExtension)
+}
+
+// Save writes d to path, replacing any existing file. The data is written to a temporary file
+// first and renamed into place, so a crash never leaves a truncated resume file behind.
+func Save(path string, d *Data) error {
+	encoded, err := bencode.Marshal(d)
+	if err != nil {
+		return fmt.Errorf("encoding resume data: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	if _, err := f.Write(encoded); err != nil {
+		f.Close()
+		return fmt.Errorf("writing resume data: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Load reads the resume data at path. A missing file yields an error wrapping fs.ErrNotExist.
+func Load(path string) (*Data, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var d Data
+	if err := bencode.Unmarshal(encoded, &d); err != nil {
+		return nil, fmt.Errorf("decoding resume data: %w", err)
+	}
+	return &d, nil
+}
@@ -0,0 +1,128 @@
+package resume
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// testTorrent returns a two-file torrent with five pieces whose first file exists below base
+// and whose second file is missing.
+func testTorrent(t *testing.T, base string) *torrent.MetaInfo {
+	t.Helper()
+	mi := &torrent.MetaInfo{
+		InfoHash: [20]byte{1, 2, 3},
+		Info: torrent.InfoDict{
+			Name:        "content",
+			PieceLength: 4,
+			Pieces:      make([][20]byte, 5),
+			Files: []torrent.FileInfo{
+				{Length: 10, Path: []string{"a"}},
+				{Length: 10, Path: []string{"b"}},
+			},
+		},
+	}
+	if err := os.MkdirAll(filepath.Join(base, "content"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mi.Info.ContentPath(base, 0), make([]byte, 10), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return mi
+}
+
+// TestSaveLoad round-trips a snapshot through a resume file.
+func TestSaveLoad(t *testing.T) {
+	base := t.TempDir()
+	mi := testTorrent(t, base)
+	have := torrent.NewBitfield(5)
+	have.Set(0)
+	have.Set(1)
+
+	data, err := Snapshot(mi, base, have)
+	if err != nil {
+		t.Fatalf("Snapshot() returned error: %v", err)
+	}
+	if data.Files[0].Size != 10 || data.Files[0].Missing || !data.Files[1].Missing {
+		t.Errorf("unexpected file states: %+v", data.Files)
+	}
+	data.Downloaded, data.Uploaded, data.TrackerID, data.SeedingTime = 100, 50, "abc", 3600
+
+	path := Path(filepath.Join(t.TempDir(), "resume"), mi.InfoHash)
+	if filepath.Ext(path) != FileExtension {
+		t.Errorf("Path() = %q, want extension %q", path, FileExtension)
+	}
+	if err := Save(path, data); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(loaded, data) {
+		t.Errorf("Load() = %+v, want %+v", loaded, data)
+	}
+	if err := loaded.Check(mi, base); err != nil {
+		t.Errorf("Check() of unchanged content returned error: %v", err)
+	}
+	if bf := loaded.Bitfield(); !bf.Has(0) || !bf.Has(1) || bf.Has(2) {
+		t.Errorf("Bitfield() = %08b", []byte(bf))
+	}
+
+	if _, err := Load(Path(t.TempDir(), mi.InfoHash)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v for a missing resume file, got %v", fs.ErrNotExist, err)
+	}
+}
+
+// TestCheckStale ensures that changes to the content or a mismatching torrent make the resume data stale.
+func TestCheckStale(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, mi *torrent.MetaInfo, base string)
+	}{
+		{"modified file", func(t *testing.T, mi *torrent.MetaInfo, base string) {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(mi.Info.ContentPath(base, 0), later, later); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"resized file", func(t *testing.T, mi *torrent.MetaInfo, base string) {
+			if err := os.Truncate(mi.Info.ContentPath(base, 0), 3); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"created file", func(t *testing.T, mi *torrent.MetaInfo, base string) {
+			if err := os.WriteFile(mi.Info.ContentPath(base, 1), nil, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"other torrent", func(t *testing.T, mi *torrent.MetaInfo, base string) {
+			mi.InfoHash[0] ^= 0xff
+		}},
+		{"other piece count", func(t *testing.T, mi *torrent.MetaInfo, base string) {
+			mi.Info.Pieces = make([][20]byte, 9)
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			base := t.TempDir()
+			mi := testTorrent(t, base)
+			data, err := Snapshot(mi, base, torrent.NewBitfield(5))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tc.change(t, mi, base)
+			if err := data.Check(mi, base); !errors.Is(err, ErrStale) {
+				t.Errorf("expected %v, got %v", ErrStale, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+)
+
+// Client calls the control API of a daemon. It is safe for concurrent use, calls being sent
+// one at a time.
+type Client struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	reader  *bufio.Reader
+	encoder *json.Encoder
+	nextID  int64
+}
+
+// Dial connects to the daemon listening on the control address addr: "unix:" followed by
+// the path of a Unix socket, or a TCP host and port.
+func Dial(ctx context.Context, addr string) (*Client, error) {
+	var dialer net.Dialer
+	network, address := splitAddr(addr)
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to daemon: %w", err)
+	}
+	return &Client{conn: conn, reader: bufio.NewReader(conn), encoder: json.NewEncoder(conn)}, nil
+}
+
+// Close closes the connection to the daemon.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Call invokes method with params, which are omitted if nil, and unmarshals its result into
+// result unless it is nil. Errors returned by the daemon are of type *Error.
+func (c *Client) Call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := c.nextID
+	req := request{Version: Version, Method: method, ID: json.RawMessage(strconv.FormatInt(id, 10))}
+	if params != nil {
+		var err error
+		if req.Params, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+
+	stop := context.AfterFunc(ctx, func() { c.conn.SetDeadline(time.Now()) })
+	defer stop()
+	if err := c.encoder.Encode(req); err != nil {
+		return c.failed(ctx, method, err)
+	}
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		return c.failed(ctx, method, err)
+	}
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("calling %s: decoding response: %w", method, err)
+	}
+	if string(resp.ID) != string(req.ID) {
+		return fmt.Errorf("calling %s: response to request %s, want %s", method, resp.ID, req.ID)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("calling %s: decoding result: %w", method, err)
+	}
+	return nil
+}
+
+// failed returns the error of a call whose request or response could not be transferred.
+// The connection cannot be used afterwards, as a late response would be mistaken for the
+// answer to the next call.
+func (c *Client) failed(ctx context.Context, method string, err error) error {
+	c.conn.Close()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return fmt.Errorf("calling %s: %w", method, err)
+}
+
+// Add adds a torrent to the daemon, starting it unless p.Paused is set.
+func (c *Client) Add(ctx context.Context, p AddParams) (TorrentStatus, error) {
+	var status TorrentStatus
+	err := c.Call(ctx, "torrent.add", p, &status)
+	return status, err
+}
+
+// Remove stops the torrent with the given info hash and removes it from the daemon.
+func (c *Client) Remove(ctx context.Context, infoHash infohash.V1) error {
+	return c.Call(ctx, "torrent.remove", torrentParams(infoHash), nil)
+}
+
+// Start starts or resumes the torrent with the given info hash.
+func (c *Client) Start(ctx context.Context, infoHash infohash.V1) (TorrentStatus, error) {
+	return c.control(ctx, "torrent.start", infoHash)
+}
+
+// Pause disconnects the torrent with the given info hash from its peers.
+func (c *Client) Pause(ctx context.Context, infoHash infohash.V1) (TorrentStatus, error) {
+	return c.control(ctx, "torrent.pause", infoHash)
+}
+
+// Stop stops the torrent with the given info hash.
+func (c *Client) Stop(ctx context.Context, infoHash infohash.V1) (TorrentStatus, error) {
+	return c.control(ctx, "torrent.stop", infoHash)
+}
+
+func (c *Client) control(ctx context.Context, method string, infoHash infohash.V1) (TorrentStatus, error) {
+	var status TorrentStatus
+	err := c.Call(ctx, method, torrentParams(infoHash), &status)
+	return status, err
+}
+
+// List returns the status of every torrent of the daemon, sorted by name.
+func (c *Client) List(ctx context.Context) ([]TorrentStatus, error) {
+	var statuses []TorrentStatus
+	err := c.Call(ctx, "torrent.list", nil, &statuses)
+	return statuses, err
+}
+
+// Peers returns the connected peers of the torrent with the given info hash, sorted by address.
+func (c *Client) Peers(ctx context.Context, infoHash infohash.V1) ([]PeerStatus, error) {
+	var peers []PeerStatus
+	err := c.Call(ctx, "torrent.peers", torrentParams(infoHash), &peers)
+	return peers, err
+}
+
+// Limits returns the limits of the daemon's session.
+func (c *Client) Limits(ctx context.Context) (Limits, error) {
+	var limits Limits
+	err := c.Call(ctx, "session.limits", nil, &limits)
+	return limits, err
+}
+
+// SetLimits changes the limits set to non-zero values in l and returns the resulting limits.
+func (c *Client) SetLimits(ctx context.Context, l Limits) (Limits, error) {
+	var limits Limits
+	err := c.Call(ctx, "session.setLimits", l, &limits)
+	return limits, err
+}
+
+// Rates returns the rate limits of the daemon's session.
+func (c *Client) Rates(ctx context.Context) (RateStatus, error) {
+	var status RateStatus
+	err := c.Call(ctx, "session.rates", nil, &status)
+	return status, err
+}
+
+// SetRates replaces the rate limits and schedule of the daemon's session with r.
+func (c *Client) SetRates(ctx context.Context, r Rates) (RateStatus, error) {
+	var status RateStatus
+	err := c.Call(ctx, "session.setRates", r, &status)
+	return status, err
+}
+
+// Blocklist returns the state of the daemon's IP blocklist.
+func (c *Client) Blocklist(ctx context.Context) (BlocklistStatus, error) {
+	var status BlocklistStatus
+	err := c.Call(ctx, "session.blocklist", nil, &status)
+	return status, err
+}
+
+// ReloadBlocklist makes the daemon load its IP blocklist again from its file.
+func (c *Client) ReloadBlocklist(ctx context.Context) (BlocklistStatus, error) {
+	var status BlocklistStatus
+	err := c.Call(ctx, "session.reloadBlocklist", nil, &status)
+	return status, err
+}
+
+// Disk returns the activity of the daemon's disk write queue and read cache.
+func (c *Client) Disk(ctx context.Context) (DiskStatus, error) {
+	var status DiskStatus
+	err := c.Call(ctx, "session.disk", nil, &status)
+	return status, err
+}
+
+func torrentParams(infoHash infohash.V1) TorrentParams {
+	return TorrentParams{InfoHash: infoHash.Hex()}
+}
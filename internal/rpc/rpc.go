@@ -0,0 +1,222 @@
+// Package rpc is the control API of the gobit daemon.
+//
+// The daemon serves JSON-RPC 2.0 over a stream connection, a Unix socket or TCP, one
+// newline-terminated JSON object per request and response. Each method works on the
+// session of the daemon:
+//
+//	torrent.add              AddParams     -> TorrentStatus    add a torrent file or magnet link
+//	torrent.remove           TorrentParams -> null             stop and remove a torrent, keeping its content
+//	torrent.start            TorrentParams -> TorrentStatus    start or resume a torrent
+//	torrent.pause            TorrentParams -> TorrentStatus    disconnect from the peers of a torrent
+//	torrent.stop             TorrentParams -> TorrentStatus    stop a torrent and close its files
+//	torrent.list             none          -> []TorrentStatus
+//	torrent.peers            TorrentParams -> []PeerStatus
+//	session.limits           none          -> Limits
+//	session.setLimits        Limits        -> Limits           change the limits set to non-zero values
+//	session.blocklist        none          -> BlocklistStatus
+//	session.reloadBlocklist  none          -> BlocklistStatus  load the IP blocklist again from its file
+//	session.rates            none          -> RateStatus
+//	session.setRates         Rates         -> RateStatus       replace the rate limits and their schedule
+//	session.disk             none          -> DiskStatus
+//
+// Torrents are identified by their hex-encoded v1 info hash.
+//
+// Reference: https://www.jsonrpc.org/specification
+package rpc
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/session"
+)
+
+// Version is the JSON-RPC version spoken by the daemon.
+const Version = "2.0"
+
+// error codes defined by JSON-RPC, and CodeServerError for failures of a method
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeServerError    = -32000
+)
+
+// Error is a JSON-RPC error returned by the daemon.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+// AddParams are the parameters of torrent.add. Exactly one of Torrent and Magnet is set.
+type AddParams struct {
+	Torrent []byte `json:"torrent,omitempty"` // content of a .torrent file
+	Magnet  string `json:"magnet,omitempty"`  // magnet link, whose metadata the daemon downloads
+	Paused  bool   `json:"paused,omitempty"`  // add the torrent without starting it
+}
+
+// TorrentParams are the parameters of the methods working on one torrent.
+type TorrentParams struct {
+	InfoHash string `json:"infoHash"` // hex-encoded v1 info hash
+}
+
+// TorrentStatus is the state and progress of a torrent.
+type TorrentStatus struct {
+	InfoHash    string  `json:"infoHash"`
+	Name        string  `json:"name"`
+	State       string  `json:"state"` // stopped, downloading, seeding or paused
+	Size        int64   `json:"size"`
+	NumPieces   int     `json:"numPieces"`
+	Have        int     `json:"have"`
+	Progress    float64 `json:"progress"` // percentage of verified pieces
+	Left        int64   `json:"left"`
+	Downloaded  int64   `json:"downloaded"`
+	Uploaded    int64   `json:"uploaded"`
+	Peers       int     `json:"peers"`
+	Ratio       float64 `json:"ratio"`       // bytes uploaded per byte downloaded
+	SeedingTime int64   `json:"seedingTime"` // seconds spent seeding
+}
+
+// PeerStatus is a connection to a peer of a torrent.
+type PeerStatus struct {
+	Addr           string    `json:"addr"`
+	Client         string    `json:"client"`
+	ConnectedAt    time.Time `json:"connectedAt"`
+	Have           int       `json:"have"`
+	Downloaded     int64     `json:"downloaded"`
+	Uploaded       int64     `json:"uploaded"`
+	DownloadRate   float64   `json:"downloadRate"` // bytes per second
+	UploadRate     float64   `json:"uploadRate"`   // bytes per second
+	AmChoking      bool      `json:"amChoking"`
+	AmInterested   bool      `json:"amInterested"`
+	PeerChoking    bool      `json:"peerChoking"`
+	PeerInterested bool      `json:"peerInterested"`
+}
+
+// Limits are the limits of the session.
+type Limits struct {
+	MaxPeers int `json:"maxPeers,omitempty"` // connections per torrent
+}
+
+// Rates are the global transfer rate limits of the session.
+type Rates struct {
+	Download int64  `json:"download"`           // bytes per second, unlimited if zero
+	Upload   int64  `json:"upload"`             // bytes per second, unlimited if zero
+	Schedule string `json:"schedule,omitempty"` // other rates by time window, see ratelimit.ParseSchedule
+}
+
+// RateStatus describes the rate limits of the session and the rates in effect now.
+type RateStatus struct {
+	Rates
+	CurrentDownload int64 `json:"currentDownload"`
+	CurrentUpload   int64 `json:"currentUpload"`
+}
+
+// BlocklistStatus describes the IP blocklist of the session and the connections it blocked.
+type BlocklistStatus struct {
+	Enabled         bool      `json:"enabled"` // false if the session has no blocklist
+	Ranges          int       `json:"ranges"`
+	BlockedInbound  int64     `json:"blockedInbound"`
+	BlockedOutbound int64     `json:"blockedOutbound"`
+	LoadedAt        time.Time `json:"loadedAt"` // zero if disabled
+}
+
+// DiskStatus describes the activity of the disk write queue and read cache of the session.
+type DiskStatus struct {
+	QueuedBlocks int   `json:"queuedBlocks"` // blocks waiting to be written
+	QueuedBytes  int64 `json:"queuedBytes"`  // bytes of the blocks queued or being written
+	Written      int64 `json:"written"`      // blocks written
+	Writes       int64 `json:"writes"`       // writes made, adjacent blocks being merged
+	CacheHits    int64 `json:"cacheHits"`    // blocks sent to peers from the read cache
+	CacheMisses  int64 `json:"cacheMisses"`  // blocks sent to peers read from disk
+	CachePieces  int   `json:"cachePieces"`
+	CacheBytes   int64 `json:"cacheBytes"`
+}
+
+// newTorrentStatus returns the status of t.
+func newTorrentStatus(t *session.Torrent) TorrentStatus {
+	mi := t.MetaInfo()
+	stats := t.Stats()
+	return TorrentStatus{
+		InfoHash:    mi.InfoHash.Hex(),
+		Name:        mi.Info.Name,
+		State:       stats.State.String(),
+		Size:        mi.Info.TotalLength(),
+		NumPieces:   stats.NumPieces,
+		Have:        stats.Have,
+		Progress:    stats.Progress(),
+		Left:        stats.Left,
+		Downloaded:  stats.Downloaded,
+		Uploaded:    stats.Uploaded,
+		Peers:       stats.Peers,
+		Ratio:       stats.Ratio,
+		SeedingTime: int64(stats.SeedingTime / time.Second),
+	}
+}
+
+// newPeerStatus returns the status of the connection described by p.
+func newPeerStatus(p session.PeerStats) PeerStatus {
+	return PeerStatus{
+		Addr:           p.Addr,
+		Client:         p.Client,
+		ConnectedAt:    p.ConnectedAt,
+		Have:           p.Have,
+		Downloaded:     p.Downloaded,
+		Uploaded:       p.Uploaded,
+		DownloadRate:   p.DownloadRate,
+		UploadRate:     p.UploadRate,
+		AmChoking:      p.AmChoking,
+		AmInterested:   p.AmInterested,
+		PeerChoking:    p.PeerChoking,
+		PeerInterested: p.PeerInterested,
+	}
+}
+
+// DefaultAddr returns the address the daemon listens on by default: the Unix socket
+// gobit.sock in the temporary directory.
+func DefaultAddr() string {
+	return "unix:" + filepath.Join(os.TempDir(), "gobit.sock")
+}
+
+// splitAddr returns the network and address of a control address: "unix:" followed by the
+// path of a Unix socket, or a TCP host and port such as "localhost:9091".
+func splitAddr(addr string) (network, address string) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return "unix", path
+	}
+	return "tcp", addr
+}
+
+// Listen listens on the control address addr, as described by DefaultAddr and Dial. A stale
+// Unix socket left by a daemon that did not shut down cleanly is replaced. The control API is
+// not authenticated, so TCP addresses must be on the loopback interface.
+func Listen(addr string) (net.Listener, error) {
+	network, address := splitAddr(addr)
+	if network == "unix" {
+		if info, err := os.Stat(address); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.Dial(network, address); err == nil {
+				conn.Close()
+				return nil, fmt.Errorf("listening on %s: a daemon is already running", addr)
+			}
+			os.Remove(address)
+		}
+	}
+	l, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	if tcp, ok := l.Addr().(*net.TCPAddr); ok && !tcp.IP.IsLoopback() {
+		l.Close()
+		return nil, fmt.Errorf("listening on %s: the control API is unauthenticated, only loopback addresses are allowed", addr)
+	}
+	return l, nil
+}
@@ -0,0 +1,230 @@
+package rpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/session"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// startDaemon serves the control API of a new session on addr and returns the session and a
+// client connected to it.
+func startDaemon(t *testing.T, addr string) (*session.Session, *Client) {
+	t.Helper()
+	s, err := session.New(session.Config{DownloadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	l, err := Listen(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- NewServer(s, nil).Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() returned error: %v", err)
+		}
+	})
+
+	if network, _ := splitAddr(addr); network == "tcp" {
+		addr = l.Addr().String() // with the port picked by the system
+	}
+	c, err := Dial(context.Background(), addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return s, c
+}
+
+// torrentFile returns a torrent file for a small file in a temporary directory, and its
+// info hash.
+func torrentFile(t *testing.T) ([]byte, [20]byte) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(path, []byte(strings.Repeat("gobit", 10000)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mi, err := torrent.Create(path, torrent.CreateOptions{PieceLength: torrent.BlockSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := mi.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, mi.InfoHash
+}
+
+// TestClient controls a daemon through every method of the client.
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	_, c := startDaemon(t, "127.0.0.1:0")
+	data, infoHash := torrentFile(t)
+
+	status, err := c.Add(ctx, AddParams{Torrent: data, Paused: true})
+	if err != nil {
+		t.Fatalf("Add() returned error: %v", err)
+	}
+	if status.InfoHash != hex.EncodeToString(infoHash[:]) || status.Name != "content" || status.State != "stopped" ||
+		status.Size != 50000 || status.NumPieces != 4 {
+		t.Errorf("Add() = %+v", status)
+	}
+	if _, err := c.Add(ctx, AddParams{Torrent: data}); err == nil {
+		t.Error("adding the torrent twice succeeded")
+	}
+
+	if status, err := c.Start(ctx, infoHash); err != nil || status.State != "downloading" {
+		t.Errorf("Start() = %+v, %v, want downloading", status, err)
+	}
+	if status, err := c.Pause(ctx, infoHash); err != nil || status.State != "paused" {
+		t.Errorf("Pause() = %+v, %v, want paused", status, err)
+	}
+	if statuses, err := c.List(ctx); err != nil || len(statuses) != 1 || statuses[0].State != "paused" {
+		t.Errorf("List() = %+v, %v, want the paused torrent", statuses, err)
+	}
+	if peers, err := c.Peers(ctx, infoHash); err != nil || len(peers) != 0 {
+		t.Errorf("Peers() = %+v, %v, want none", peers, err)
+	}
+	if status, err := c.Stop(ctx, infoHash); err != nil || status.State != "stopped" {
+		t.Errorf("Stop() = %+v, %v, want stopped", status, err)
+	}
+
+	if limits, err := c.Limits(ctx); err != nil || limits.MaxPeers != session.DefaultMaxPeers {
+		t.Errorf("Limits() = %+v, %v, want the default", limits, err)
+	}
+	if limits, err := c.SetLimits(ctx, Limits{MaxPeers: 5}); err != nil || limits.MaxPeers != 5 {
+		t.Errorf("SetLimits() = %+v, %v, want 5 peers", limits, err)
+	}
+	if limits, err := c.SetLimits(ctx, Limits{}); err != nil || limits.MaxPeers != 5 {
+		t.Errorf("SetLimits() with no limits = %+v, %v, want them unchanged", limits, err)
+	}
+
+	if status, err := c.Rates(ctx); err != nil || status != (RateStatus{}) {
+		t.Errorf("Rates() = %+v, %v, want unlimited", status, err)
+	}
+	rates := Rates{Download: 1 << 20, Schedule: "daily 00:00-24:00 down=unlimited up=64KiB/s"}
+	if status, err := c.SetRates(ctx, rates); err != nil || status.Rates != rates ||
+		status.CurrentDownload != 0 || status.CurrentUpload != 64<<10 {
+		t.Errorf("SetRates() = %+v, %v, want the scheduled rates in effect", status, err)
+	}
+
+	if status, err := c.Blocklist(ctx); err != nil || status.Enabled {
+		t.Errorf("Blocklist() = %+v, %v, want it disabled", status, err)
+	}
+	if status, err := c.Disk(ctx); err != nil || status != (DiskStatus{}) {
+		t.Errorf("Disk() = %+v, %v, want no activity", status, err)
+	}
+
+	if err := c.Remove(ctx, infoHash); err != nil {
+		t.Fatalf("Remove() returned error: %v", err)
+	}
+	if statuses, err := c.List(ctx); err != nil || len(statuses) != 0 {
+		t.Errorf("List() after Remove() = %+v, %v, want no torrents", statuses, err)
+	}
+}
+
+// TestClientErrors verifies the errors returned for invalid calls.
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	_, c := startDaemon(t, "127.0.0.1:0")
+
+	tests := []struct {
+		name   string
+		method string
+		params any
+		code   int
+	}{
+		{"unknown method", "torrent.frobnicate", nil, CodeMethodNotFound},
+		{"missing parameters", "torrent.start", nil, CodeInvalidParams},
+		{"unknown parameter", "torrent.start", map[string]string{"hash": "00"}, CodeInvalidParams},
+		{"invalid info hash", "torrent.start", TorrentParams{InfoHash: "zz"}, CodeInvalidParams},
+		{"long info hash", "torrent.start", TorrentParams{InfoHash: strings.Repeat("00", 32)}, CodeInvalidParams},
+		{"unknown torrent", "torrent.start", TorrentParams{InfoHash: strings.Repeat("00", 20)}, CodeServerError},
+		{"torrent and magnet", "torrent.add", AddParams{Torrent: []byte("d"), Magnet: "magnet:"}, CodeInvalidParams},
+		{"invalid torrent", "torrent.add", AddParams{Torrent: []byte("not bencode")}, CodeServerError},
+		{"negative limit", "session.setLimits", Limits{MaxPeers: -1}, CodeInvalidParams},
+		{"negative rate", "session.setRates", Rates{Upload: -1}, CodeInvalidParams},
+		{"invalid schedule", "session.setRates", Rates{Schedule: "sometimes"}, CodeInvalidParams},
+		{"no blocklist", "session.reloadBlocklist", nil, CodeServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := c.Call(ctx, tt.method, tt.params, nil)
+			var rpcErr *Error
+			if !errors.As(err, &rpcErr) || rpcErr.Code != tt.code {
+				t.Errorf("Call() returned %v, want error code %d", err, tt.code)
+			}
+		})
+	}
+}
+
+// TestServerRaw sends raw lines to the server and verifies its responses, including to
+// requests the client never sends.
+func TestServerRaw(t *testing.T) {
+	dir, err := os.MkdirTemp("", "gobit") // short, to fit the length limit of socket paths
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	addr := "unix:" + filepath.Join(dir, "gobit.sock")
+	startDaemon(t, addr)
+
+	if _, err := Listen(addr); err == nil {
+		t.Error("Listen() succeeded while a daemon is running")
+	}
+	for _, public := range []string{":0", "0.0.0.0:0"} {
+		if l, err := Listen(public); err == nil {
+			l.Close()
+			t.Errorf("Listen(%q) succeeded on an address reachable from other hosts", public)
+		}
+	}
+
+	network, address := splitAddr(addr)
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	tests := []struct {
+		name     string
+		request  string
+		expected string // empty if no response is expected
+	}{
+		{"parse error", `{"jsonrpc":`, `{"jsonrpc":"2.0","error":{"code":-32700,"message":"unexpected end of JSON input"},"id":null}`},
+		{"wrong version", `{"jsonrpc":"1.0","method":"torrent.list","id":1}`, `{"jsonrpc":"2.0","error":{"code":-32600,"message":"invalid request"},"id":null}`},
+		{"notification", `{"jsonrpc":"2.0","method":"torrent.list"}`, ""},
+		{"string id", `{"jsonrpc":"2.0","method":"torrent.list","id":"a"}`, `{"jsonrpc":"2.0","result":[],"id":"a"}`},
+		{"limits", `{"jsonrpc":"2.0","method":"session.limits","id":2}`, `{"jsonrpc":"2.0","result":{"maxPeers":30},"id":2}`},
+	}
+	for _, tt := range tests {
+		if _, err := conn.Write([]byte(tt.request + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		if tt.expected == "" {
+			continue
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s: reading response: %v", tt.name, err)
+		}
+		if got := strings.TrimSpace(line); got != tt.expected {
+			t.Errorf("%s: response = %s, want %s", tt.name, got, tt.expected)
+		}
+	}
+}
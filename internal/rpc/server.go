@@ -0,0 +1,361 @@
+package rpc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/logging"
+	"github.com/lcsabi/gobit/internal/ratelimit"
+	"github.com/lcsabi/gobit/internal/session"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// addMagnetTimeout bounds the download of the metadata of a magnet link added with torrent.add.
+const addMagnetTimeout = 2 * time.Minute
+
+// maxRequestSize limits the size of a request line, leaving room for large torrent files.
+const maxRequestSize = 64 << 20
+
+// request is a JSON-RPC request, or a notification if ID is absent.
+type request struct {
+	Version string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// response is a JSON-RPC response, holding either Result or Error.
+type response struct {
+	Version string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// handler runs a method with its raw parameters and returns its result.
+type handler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Server serves the control API for a session.
+type Server struct {
+	session *session.Session
+	logger  *slog.Logger
+	methods map[string]handler
+}
+
+// NewServer returns a Server controlling s. If logger is nil, the logger of the RPC subsystem
+// is used.
+func NewServer(s *session.Session, logger *slog.Logger) *Server {
+	srv := &Server{session: s, logger: logging.Or(logger, logging.RPC)}
+	srv.methods = map[string]handler{
+		"torrent.add":       srv.add,
+		"torrent.remove":    srv.remove,
+		"torrent.start":     srv.control((*session.Torrent).Start),
+		"torrent.pause":     srv.control((*session.Torrent).Pause),
+		"torrent.stop":      srv.control((*session.Torrent).Stop),
+		"torrent.list":      srv.list,
+		"torrent.peers":     srv.peers,
+		"session.limits":    srv.limits,
+		"session.setLimits": srv.setLimits,
+
+		"session.rates":           srv.rates,
+		"session.setRates":        srv.setRates,
+		"session.blocklist":       srv.blocklist,
+		"session.reloadBlocklist": srv.reloadBlocklist,
+		"session.disk":            srv.disk,
+	}
+	return srv
+}
+
+// Serve accepts control connections on l until ctx is cancelled, then closes l and the open
+// connections. It returns once every connection is closed, with the error that stopped the
+// accept loop, or nil if ctx was cancelled.
+func (srv *Server) Serve(ctx context.Context, l net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			srv.serveConn(ctx, conn)
+		}()
+	}
+}
+
+// serveConn answers the requests of conn, one at a time, until it is closed or ctx is
+// cancelled.
+func (srv *Server) serveConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(nil, maxRequestSize)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		resp, ok := srv.handle(ctx, line)
+		if !ok {
+			continue
+		}
+		if err := encoder.Encode(resp); err != nil {
+			srv.logger.Debug("writing response failed", "error", err)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		srv.logger.Debug("reading request failed", "error", err)
+	}
+}
+
+// handle runs the request in line and returns its response, or false if it is a notification.
+func (srv *Server) handle(ctx context.Context, line []byte) (response, bool) {
+	resp := response{Version: Version, ID: json.RawMessage("null")}
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		resp.Error = &Error{Code: CodeParseError, Message: err.Error()}
+		return resp, true
+	}
+	if req.Version != Version || req.Method == "" {
+		resp.Error = &Error{Code: CodeInvalidRequest, Message: "invalid request"}
+		return resp, true
+	}
+	if req.ID != nil {
+		resp.ID = req.ID
+	}
+
+	method, ok := srv.methods[req.Method]
+	if !ok {
+		resp.Error = &Error{Code: CodeMethodNotFound, Message: fmt.Sprintf("method %q not found", req.Method)}
+		return resp, req.ID != nil
+	}
+	result, err := method(ctx, req.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &Error{Code: CodeServerError, Message: err.Error()}
+		}
+		srv.logger.Debug("request failed", "method", req.Method, "error", err)
+		resp.Error = rpcErr
+		return resp, req.ID != nil
+	}
+	if resp.Result, err = json.Marshal(result); err != nil {
+		resp.Error = &Error{Code: CodeServerError, Message: err.Error()}
+	}
+	return resp, req.ID != nil
+}
+
+// decodeParams unmarshals params into v, reporting invalid parameters as such.
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return &Error{Code: CodeInvalidParams, Message: "missing parameters"}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid parameters: %v", err)}
+	}
+	return nil
+}
+
+// torrent returns the torrent named by the parameters of a method.
+func (srv *Server) torrent(params json.RawMessage) (*session.Torrent, error) {
+	var p TorrentParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	infoHash, err := infohash.Parse(p.InfoHash)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid info hash %q", p.InfoHash)}
+	}
+	t := srv.session.Torrent(infoHash)
+	if t == nil {
+		return nil, fmt.Errorf("torrent %s not found", p.InfoHash)
+	}
+	return t, nil
+}
+
+func (srv *Server) add(ctx context.Context, params json.RawMessage) (any, error) {
+	var p AddParams
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	var (
+		t   *session.Torrent
+		err error
+	)
+	switch {
+	case (p.Torrent == nil) == (p.Magnet == ""):
+		return nil, &Error{Code: CodeInvalidParams, Message: "exactly one of torrent and magnet must be set"}
+	case p.Magnet != "":
+		ctx, cancel := context.WithTimeout(ctx, addMagnetTimeout)
+		defer cancel()
+		t, err = srv.session.AddMagnet(ctx, p.Magnet)
+	default:
+		var mi *torrent.MetaInfo
+		if mi, err = torrent.ParseReader(bytes.NewReader(p.Torrent)); err == nil {
+			t, err = srv.session.AddTorrent(mi)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !p.Paused {
+		if err := t.Start(); err != nil {
+			return nil, err
+		}
+	}
+	srv.logger.Info("torrent added", "torrent", t.MetaInfo().Info.Name)
+	return newTorrentStatus(t), nil
+}
+
+func (srv *Server) remove(_ context.Context, params json.RawMessage) (any, error) {
+	t, err := srv.torrent(params)
+	if err != nil {
+		return nil, err
+	}
+	return nil, srv.session.RemoveTorrent(t.MetaInfo().InfoHash)
+}
+
+// control returns the handler calling action on a torrent.
+func (srv *Server) control(action func(*session.Torrent) error) handler {
+	return func(_ context.Context, params json.RawMessage) (any, error) {
+		t, err := srv.torrent(params)
+		if err != nil {
+			return nil, err
+		}
+		if err := action(t); err != nil {
+			return nil, err
+		}
+		return newTorrentStatus(t), nil
+	}
+}
+
+func (srv *Server) list(context.Context, json.RawMessage) (any, error) {
+	torrents := srv.session.Torrents()
+	statuses := make([]TorrentStatus, len(torrents))
+	for i, t := range torrents {
+		statuses[i] = newTorrentStatus(t)
+	}
+	slices.SortFunc(statuses, func(a, b TorrentStatus) int { return strings.Compare(a.Name, b.Name) })
+	return statuses, nil
+}
+
+func (srv *Server) peers(_ context.Context, params json.RawMessage) (any, error) {
+	t, err := srv.torrent(params)
+	if err != nil {
+		return nil, err
+	}
+	peers := t.Peers()
+	statuses := make([]PeerStatus, len(peers))
+	for i, p := range peers {
+		statuses[i] = newPeerStatus(p)
+	}
+	return statuses, nil
+}
+
+func (srv *Server) limits(context.Context, json.RawMessage) (any, error) {
+	return Limits{MaxPeers: srv.session.MaxPeers()}, nil
+}
+
+func (srv *Server) setLimits(ctx context.Context, params json.RawMessage) (any, error) {
+	var p Limits
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.MaxPeers < 0 {
+		return nil, &Error{Code: CodeInvalidParams, Message: "maxPeers must not be negative"}
+	}
+	if p.MaxPeers > 0 {
+		srv.session.SetMaxPeers(p.MaxPeers)
+	}
+	return srv.limits(ctx, nil)
+}
+
+func (srv *Server) rates(context.Context, json.RawMessage) (any, error) {
+	base, schedule := srv.session.Rates()
+	current := srv.session.CurrentRates()
+	return RateStatus{
+		Rates:           Rates{Download: base.Download, Upload: base.Upload, Schedule: schedule.String()},
+		CurrentDownload: current.Download,
+		CurrentUpload:   current.Upload,
+	}, nil
+}
+
+func (srv *Server) setRates(ctx context.Context, params json.RawMessage) (any, error) {
+	var p Rates
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Download < 0 || p.Upload < 0 {
+		return nil, &Error{Code: CodeInvalidParams, Message: "rates must not be negative"}
+	}
+	schedule, err := ratelimit.ParseSchedule(p.Schedule)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidParams, Message: fmt.Sprintf("invalid schedule: %v", err)}
+	}
+	srv.session.SetRates(ratelimit.Rates{Download: p.Download, Upload: p.Upload}, schedule)
+	return srv.rates(ctx, nil)
+}
+
+func (srv *Server) blocklist(context.Context, json.RawMessage) (any, error) {
+	filter := srv.session.IPFilter()
+	stats := filter.Stats()
+	return BlocklistStatus{
+		Enabled:         filter != nil,
+		Ranges:          stats.Ranges,
+		BlockedInbound:  stats.BlockedInbound,
+		BlockedOutbound: stats.BlockedOutbound,
+		LoadedAt:        stats.LoadedAt,
+	}, nil
+}
+
+func (srv *Server) disk(context.Context, json.RawMessage) (any, error) {
+	queue, cache := srv.session.DiskStats(), srv.session.ReadCacheStats()
+	return DiskStatus{
+		QueuedBlocks: queue.Queued,
+		QueuedBytes:  queue.QueuedBytes,
+		Written:      queue.Written,
+		Writes:       queue.Writes,
+		CacheHits:    cache.Hits,
+		CacheMisses:  cache.Misses,
+		CachePieces:  cache.Pieces,
+		CacheBytes:   cache.Bytes,
+	}, nil
+}
+
+func (srv *Server) reloadBlocklist(ctx context.Context, _ json.RawMessage) (any, error) {
+	filter := srv.session.IPFilter()
+	if filter == nil {
+		return nil, errors.New("the daemon has no blocklist")
+	}
+	if err := filter.Reload(); err != nil {
+		return nil, err
+	}
+	return srv.blocklist(ctx, nil)
+}
@@ -0,0 +1,79 @@
+package session
+
+import "os"
+
+// partSuffix is appended to the names of the files of incomplete torrents with
+// Config.PartFiles.
+const partSuffix = ".part"
+
+// locate returns the directory and the file name suffix of the content of the torrent: those
+// of incomplete torrents, unless only the download directory holds files of the content, as
+// it does once the torrent completed.
+func (t *Torrent) locate() (dir, suffix string) {
+	cfg := &t.session.cfg
+	dir = cfg.IncompleteDir
+	if dir == "" {
+		dir = cfg.DownloadDir
+	}
+	if cfg.PartFiles {
+		suffix = partSuffix
+	}
+	if dir == cfg.DownloadDir && suffix == "" {
+		return dir, suffix
+	}
+	if !t.hasFiles(dir, suffix) && t.hasFiles(cfg.DownloadDir, "") {
+		return cfg.DownloadDir, ""
+	}
+	return dir, suffix
+}
+
+// hasFiles reports whether any file of the content exists below dir with the suffix.
+func (t *Torrent) hasFiles(dir, suffix string) bool {
+	for idx := range t.meta.Info.Files {
+		if _, err := os.Lstat(t.meta.Info.ContentPath(dir, idx) + suffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// contentPath returns the on-disk path of the file at fileIndex. t.mu must be held.
+func (t *Torrent) contentPath(fileIndex int) string {
+	dir := t.contentDir
+	if dir == "" {
+		dir = t.session.cfg.DownloadDir
+	}
+	return t.meta.Info.ContentPath(dir, fileIndex) + t.contentSuffix
+}
+
+// finish moves the files of a complete torrent from the incomplete directory to the download
+// directory, dropping their part suffix, and then gives the files their attributes, creating
+// symbolic links and setting executable bits. Failures are reported as EventError events and
+// tried again by the next Start.
+func (t *Torrent) finish() {
+	dir := t.session.cfg.DownloadDir
+	t.mu.Lock()
+	st := t.storage
+	moved := t.contentDir == dir && t.contentSuffix == ""
+	t.mu.Unlock()
+	if st == nil {
+		return
+	}
+
+	if !moved {
+		if err := st.Move(dir); err != nil {
+			t.logger.Warn("moving completed content failed", "error", err)
+			t.emit(Event{Type: EventError, Err: err})
+			return
+		}
+		t.mu.Lock()
+		t.contentDir, t.contentSuffix = dir, ""
+		t.mu.Unlock()
+		t.logger.Info("moved completed content", "dir", dir)
+	}
+
+	if err := st.ApplyAttributes(); err != nil {
+		t.logger.Warn("applying file attributes failed", "error", err)
+		t.emit(Event{Type: EventError, Err: err})
+	}
+}
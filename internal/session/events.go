@@ -0,0 +1,146 @@
+package session
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+)
+
+// EventMask is a set of event types, one bit per type.
+type EventMask uint32
+
+// event types
+const (
+	EventTorrentAdded     EventMask = 1 << iota // a torrent was added to the session
+	EventTorrentRemoved                         // a torrent was removed from the session
+	EventTorrentCompleted                       // every piece of a torrent is verified
+	EventPieceVerified                          // a downloaded piece matched its hash
+	EventPieceFailed                            // a downloaded piece did not match its hash
+	EventPeerConnected                          // a peer connection completed its handshake
+	EventPeerDisconnected                       // a connected peer was dropped
+	EventAnnounce                               // an announce to the trackers succeeded or failed
+	EventError                                  // a torrent failed to read or write its content
+	EventSeedLimitReached                       // a torrent stopped seeding at one of its seed limits
+
+	// AllEvents selects every event type.
+	AllEvents EventMask = 1<<iota - 1
+)
+
+// eventNames are the names of the event types, by bit.
+var eventNames = []string{
+	"torrent added",
+	"torrent removed",
+	"torrent completed",
+	"piece verified",
+	"piece failed",
+	"peer connected",
+	"peer disconnected",
+	"announce",
+	"error",
+	"seed limit reached",
+}
+
+// String returns the names of the event types in m, separated by '|'.
+func (m EventMask) String() string {
+	var names []string
+	for i, name := range eventNames {
+		if m&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	if rest := m &^ AllEvents; rest != 0 || len(names) == 0 {
+		names = append(names, fmt.Sprintf("EventMask(%#x)", uint32(rest)))
+	}
+	return strings.Join(names, "|")
+}
+
+// Event is something that happened in a session. The fields that do not apply to its type are
+// zero.
+type Event struct {
+	Type     EventMask // exactly one event type
+	Time     time.Time
+	InfoHash infohash.V1 // torrent the event is about
+	Piece    int         // piece verified or failed, or whose content failed to be read or written
+	Peer     string      // address of the peer connected or disconnected
+	Client   string      // software of the peer connected, as identified from its peer ID
+	Tracker  string      // URL of the tracker of a successful announce
+	NumPeers int         // number of peers returned by a successful announce
+	Err      error       // failure of an announce, reason of a disconnect or cause of an error
+
+	Ratio       float64       // upload ratio of a torrent that reached a seed limit
+	SeedingTime time.Duration // seeding time of a torrent that reached a seed limit
+}
+
+// eventBuffer is the capacity of subscription channels.
+const eventBuffer = 256
+
+// subscription is a channel receiving the events of the types in mask.
+type subscription struct {
+	mask EventMask
+	ch   chan Event
+}
+
+// Subscribe returns a channel receiving the events of the types in mask, in the order they
+// happen. Events are dropped rather than slowing the session down when the channel is full,
+// so subscribers should keep receiving. The channel is closed by Unsubscribe or Close.
+func (s *Session) Subscribe(mask EventMask) <-chan Event {
+	ch := make(chan Event, eventBuffer)
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+	if s.eventsClosed {
+		close(ch)
+		return ch
+	}
+	s.subscriptions = append(s.subscriptions, subscription{mask: mask, ch: ch})
+	return ch
+}
+
+// Unsubscribe stops the delivery of events to ch, a channel returned by Subscribe, and closes
+// it. Unsubscribing an unknown channel does nothing.
+func (s *Session) Unsubscribe(ch <-chan Event) {
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+	for i, sub := range s.subscriptions {
+		if sub.ch == ch {
+			close(sub.ch)
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
+// emit delivers e to the subscriptions of its type.
+func (s *Session) emit(e Event) {
+	e.Time = time.Now()
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+	for _, sub := range s.subscriptions {
+		if sub.mask&e.Type == 0 {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			s.logger.Debug("dropping event for slow subscriber", "event", e.Type)
+		}
+	}
+}
+
+// closeEvents closes every subscription channel.
+func (s *Session) closeEvents() {
+	s.eventMu.Lock()
+	defer s.eventMu.Unlock()
+	for _, sub := range s.subscriptions {
+		close(sub.ch)
+	}
+	s.subscriptions = nil
+	s.eventsClosed = true
+}
+
+// emit delivers an event about the torrent to the subscriptions of the session.
+func (t *Torrent) emit(e Event) {
+	e.InfoHash = t.meta.InfoHash
+	t.session.emit(e)
+}
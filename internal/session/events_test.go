@@ -0,0 +1,124 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+// TestEventMaskString verifies the names of event masks.
+func TestEventMaskString(t *testing.T) {
+	tests := []struct {
+		mask     EventMask
+		expected string
+	}{
+		{EventTorrentAdded, "torrent added"},
+		{EventPieceVerified | EventPieceFailed, "piece verified|piece failed"},
+		{EventError, "error"},
+		{0, "EventMask(0x0)"},
+		{EventAnnounce | 1<<20, "announce|EventMask(0x100000)"},
+	}
+	for _, tt := range tests {
+		if got := tt.mask.String(); got != tt.expected {
+			t.Errorf("EventMask(%#x).String() = %q, want %q", uint32(tt.mask), got, tt.expected)
+		}
+	}
+}
+
+// nextEvent returns the next event received on events, failing the test after a timeout.
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-events:
+		if !ok {
+			t.Fatal("event channel closed")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+		return Event{}
+	}
+}
+
+// TestEvents downloads a torrent and verifies the events of the subscriptions, filtered by
+// their masks.
+func TestEvents(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	seed := newSeeder(t, mi, content)
+	mi.Announce = newTracker(t, seed.addr())
+
+	s, err := New(Config{DownloadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	torrentEvents := s.Subscribe(EventTorrentAdded | EventTorrentCompleted | EventTorrentRemoved)
+	pieceEvents := s.Subscribe(EventPieceVerified | EventPieceFailed)
+	all := s.Subscribe(AllEvents)
+
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, torrentEvents); e.Type != EventTorrentAdded || e.InfoHash != mi.InfoHash || e.Time.IsZero() {
+		t.Errorf("first event = %+v, want torrent added", e)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, tor)
+
+	if e := nextEvent(t, torrentEvents); e.Type != EventTorrentCompleted || e.InfoHash != mi.InfoHash {
+		t.Errorf("event after download = %+v, want torrent completed", e)
+	}
+	verified := make(map[int]bool)
+	for range mi.Info.NumPieces() {
+		e := nextEvent(t, pieceEvents)
+		if e.Type != EventPieceVerified {
+			t.Fatalf("piece event = %+v, want piece verified", e)
+		}
+		verified[e.Piece] = true
+	}
+	if len(verified) != mi.Info.NumPieces() {
+		t.Errorf("verified pieces = %v, want all %d", verified, mi.Info.NumPieces())
+	}
+
+	if err := s.RemoveTorrent(mi.InfoHash); err != nil {
+		t.Fatal(err)
+	}
+	if e := nextEvent(t, torrentEvents); e.Type != EventTorrentRemoved {
+		t.Errorf("event after RemoveTorrent() = %+v, want torrent removed", e)
+	}
+
+	// the unfiltered subscription saw the announce and the peer come and go
+	var seen EventMask
+	for seen&EventPeerDisconnected == 0 {
+		e := nextEvent(t, all)
+		seen |= e.Type
+		switch e.Type {
+		case EventAnnounce:
+			if e.Err != nil || e.Tracker != mi.Announce || e.NumPeers != 1 {
+				t.Errorf("announce event = %+v, want a successful announce returning 1 peer", e)
+			}
+		case EventPeerConnected:
+			if e.Peer != seed.addr().String() {
+				t.Errorf("peer connected event = %+v, want peer %v", e, seed.addr())
+			}
+		}
+	}
+	if want := EventTorrentAdded | EventAnnounce | EventPeerConnected | EventPieceVerified | EventTorrentCompleted; seen&want != want {
+		t.Errorf("events seen = %v, want %v", seen, want)
+	}
+
+	s.Unsubscribe(pieceEvents)
+	if _, ok := <-pieceEvents; ok {
+		t.Error("channel not closed by Unsubscribe()")
+	}
+	s.Close()
+	if _, ok := <-torrentEvents; ok {
+		t.Error("channel not closed by Close()")
+	}
+	if _, ok := <-s.Subscribe(AllEvents); ok {
+		t.Error("Subscribe() after Close() returned an open channel")
+	}
+}
@@ -0,0 +1,80 @@
+package session
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// AddressFamily selects the IP versions of the peers a session connects to.
+type AddressFamily int
+
+const (
+	AnyFamily  AddressFamily = iota // IPv4 and IPv6 peers, in the order they are found
+	PreferIPv4                      // IPv4 peers first when several are found at once
+	PreferIPv6                      // IPv6 peers first when several are found at once
+	IPv4Only                        // IPv4 peers only
+	IPv6Only                        // IPv6 peers only
+)
+
+func (f AddressFamily) String() string {
+	switch f {
+	case AnyFamily:
+		return "any"
+	case PreferIPv4:
+		return "prefer-ipv4"
+	case PreferIPv6:
+		return "prefer-ipv6"
+	case IPv4Only:
+		return "ipv4"
+	case IPv6Only:
+		return "ipv6"
+	}
+	return "unknown"
+}
+
+// ParseAddressFamily returns the address family named by s, as returned by String: "any",
+// "prefer-ipv4", "prefer-ipv6", "ipv4" or "ipv6".
+func ParseAddressFamily(s string) (AddressFamily, error) {
+	for f := AnyFamily; f <= IPv6Only; f++ {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown address family %q", s)
+}
+
+// allows reports whether peers at addr may be connected to.
+func (f AddressFamily) allows(addr netip.Addr) bool {
+	switch f {
+	case IPv4Only:
+		return addr.Unmap().Is4()
+	case IPv6Only:
+		return !addr.Unmap().Is4()
+	}
+	return true
+}
+
+// order returns the addresses f allows, the preferred family first.
+func (f AddressFamily) order(addrs []netip.AddrPort) []netip.AddrPort {
+	allowed := make([]netip.AddrPort, 0, len(addrs))
+	for _, addr := range addrs {
+		if f.allows(addr.Addr()) {
+			allowed = append(allowed, addr)
+		}
+	}
+	if f == PreferIPv4 || f == PreferIPv6 {
+		slices.SortStableFunc(allowed, func(a, b netip.AddrPort) int {
+			return f.rank(a.Addr()) - f.rank(b.Addr())
+		})
+	}
+	return allowed
+}
+
+// rank is 0 for addresses of the preferred family and 1 for the others.
+func (f AddressFamily) rank(addr netip.Addr) int {
+	if addr.Unmap().Is4() == (f == PreferIPv4) {
+		return 0
+	}
+	return 1
+}
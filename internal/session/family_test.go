@@ -0,0 +1,35 @@
+package session
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+)
+
+// TestAddressFamilyOrder checks the filtering and ordering of peer addresses by family.
+func TestAddressFamilyOrder(t *testing.T) {
+	v4a := netip.MustParseAddrPort("192.0.2.1:6881")
+	v4b := netip.MustParseAddrPort("[::ffff:192.0.2.2]:6881")
+	v6a := netip.MustParseAddrPort("[2001:db8::1]:6881")
+	v6b := netip.MustParseAddrPort("[2001:db8::2]:6881")
+	addrs := []netip.AddrPort{v6a, v4a, v6b, v4b}
+
+	tests := []struct {
+		family AddressFamily
+		want   []netip.AddrPort
+	}{
+		{family: AnyFamily, want: []netip.AddrPort{v6a, v4a, v6b, v4b}},
+		{family: PreferIPv4, want: []netip.AddrPort{v4a, v4b, v6a, v6b}},
+		{family: PreferIPv6, want: []netip.AddrPort{v6a, v6b, v4a, v4b}},
+		{family: IPv4Only, want: []netip.AddrPort{v4a, v4b}},
+		{family: IPv6Only, want: []netip.AddrPort{v6a, v6b}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.family.String(), func(t *testing.T) {
+			if got := tc.family.order(addrs); !slices.Equal(got, tc.want) {
+				t.Errorf("order() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
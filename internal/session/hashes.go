@@ -0,0 +1,311 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/merkle"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// hashRequestTimeout bounds the wait for the hashes of a failed piece, a variable so tests can
+// shorten it.
+var hashRequestTimeout = 30 * time.Second
+
+// maxHashRequestLength is the largest number of hashes a peer may request from us at once.
+const maxHashRequestLength = 512
+
+// hashWait is a piece of a hybrid torrent that failed its SHA-1 check, waiting for the hashes
+// of its blocks to find out which of them to download again.
+type hashWait struct {
+	index int
+	tree  torrent.PieceTree
+	timer *time.Timer // gives up on the hashes
+}
+
+// reserved returns the reserved handshake bits we send: the extension protocol, and the v2
+// protocol for hybrid torrents, whose pieces can be verified block by block.
+func (t *Torrent) reserved() [8]byte {
+	reserved := peer.ExtensionProtocol
+	if t.meta.IsHybrid() {
+		reserved[7] |= peer.ProtocolV2[7]
+	}
+	return reserved
+}
+
+// requestHashes asks a connected peer supporting v2 and having the piece at index for the
+// hashes of its blocks, after it failed its SHA-1 check. It reports whether a request was sent;
+// if not, the whole piece should be downloaded again.
+func (t *Torrent) requestHashes(index int) bool {
+	tree, ok := t.meta.PieceTree(index)
+	if !ok {
+		return false
+	}
+	r := peer.HashRequest{PiecesRoot: tree.PiecesRoot, Index: uint32(tree.Index), Length: uint32(tree.Leaves)}
+
+	t.mu.Lock()
+	var target *peer.PeerConn
+	for _, pc := range t.peers {
+		if pc != nil && peer.SupportsV2(pc.Reserved()) && pc.PeerHas(index) {
+			target = pc
+			break
+		}
+	}
+	if target == nil || t.hashWaits[r] != nil {
+		t.mu.Unlock()
+		return false
+	}
+	wait := &hashWait{index: index, tree: tree}
+	wait.timer = time.AfterFunc(hashRequestTimeout, func() { t.hashesTimedOut(r, wait) })
+	t.hashWaits[r] = wait
+	t.mu.Unlock()
+
+	if err := target.Send(peer.NewHashRequest(r)); err != nil {
+		if t.takeHashWait(r, wait) {
+			wait.timer.Stop()
+		}
+		return false
+	}
+	return true
+}
+
+// takeHashWait removes wait, waiting for the hashes of r, reporting whether it was still
+// waiting: only the first of the hashes, the hash reject and the timeout handle it.
+func (t *Torrent) takeHashWait(r peer.HashRequest, wait *hashWait) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.hashWaits[r] != wait {
+		return false
+	}
+	delete(t.hashWaits, r)
+	return true
+}
+
+// hashesTimedOut downloads the piece of wait again once the hashes of r did not arrive in
+// time, unless they did meanwhile or the torrent stopped, which drops every wait.
+func (t *Torrent) hashesTimedOut(r peer.HashRequest, wait *hashWait) {
+	t.mu.Lock()
+	expired := t.ctx != nil && t.hashWaits[r] == wait
+	if expired {
+		delete(t.hashWaits, r)
+		t.writes.Add(1) // so that halt waits for the piece to be released
+	}
+	t.mu.Unlock()
+	if !expired {
+		return
+	}
+	defer t.writes.Done()
+	t.logger.Debug("hash request timed out", "piece", wait.index)
+	t.pieceFailed(wait.index)
+}
+
+// receiveHashes checks the block hashes of a piece that failed its SHA-1 check against its
+// trusted hash, and schedules the blocks not matching them for download again. Hashes not
+// matching the trusted hash drop the peer.
+func (t *Torrent) receiveHashes(m *peer.Message) error {
+	r, hashes, proof, err := m.ParseHashes()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	wait := t.hashWaits[r]
+	t.mu.Unlock()
+	if wait == nil || !t.takeHashWait(r, wait) {
+		return nil // unrequested, or too late
+	}
+	wait.timer.Stop()
+
+	if !merkle.Verify(hashes, int(r.Index), proof, wait.tree.Hash) {
+		t.pieceFailed(wait.index)
+		return fmt.Errorf("hashes of piece %d do not match its merkle tree", wait.index)
+	}
+	t.writes.Add(1)
+	go func() {
+		defer t.writes.Done()
+		if err := t.verifyBlocks(wait.index, wait.tree, hashes); err != nil {
+			t.logger.Warn("verifying blocks failed", "piece", wait.index, "error", err)
+		}
+	}()
+	return nil
+}
+
+// hashesRejected downloads the piece the peer refused to send the hashes of again.
+func (t *Torrent) hashesRejected(m *peer.Message) error {
+	r, err := m.ParseHashRequest()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	wait := t.hashWaits[r]
+	t.mu.Unlock()
+	if wait != nil && t.takeHashWait(r, wait) {
+		wait.timer.Stop()
+		t.pieceFailed(wait.index)
+	}
+	return nil
+}
+
+// verifyBlocks hashes the blocks of the piece at index on disk and compares them with hashes,
+// the trusted leaves of tree, so that only the blocks not matching are downloaded again.
+func (t *Torrent) verifyBlocks(index int, tree torrent.PieceTree, hashes [][32]byte) error {
+	t.mu.Lock()
+	st := t.storage
+	t.mu.Unlock()
+	if st == nil {
+		t.pieceFailed(index)
+		return errors.New("torrent is not running")
+	}
+
+	var failed []int
+	block := make([]byte, torrent.BlockSize)
+	for begin := int64(0); begin < tree.Length; begin += torrent.BlockSize {
+		data := block[:min(torrent.BlockSize, tree.Length-begin)]
+		if err := st.ReadBlock(index, begin, data); err != nil {
+			t.pieceFailed(index)
+			return err
+		}
+		if idx := int(begin / torrent.BlockSize); merkle.HashBlock(data) != hashes[idx] {
+			failed = append(failed, idx)
+		}
+	}
+	if len(failed) == 0 {
+		// the padding of the piece is corrupt, or its v1 and v2 hashes disagree
+		t.pieceFailed(index)
+		return nil
+	}
+	t.logger.Debug("blocks failed verification", "piece", index, "blocks", failed)
+	if err := t.picker.BlocksFailed(index, failed); err != nil {
+		t.pieceFailed(index)
+		return err
+	}
+	t.requestMissing()
+	return nil
+}
+
+// pieceFailed schedules the whole piece at index for download again.
+func (t *Torrent) pieceFailed(index int) {
+	t.picker.PieceFailed(index)
+	t.requestMissing()
+}
+
+// requestMissing fills the request pipelines of the connected peers, handing them the blocks
+// made missing again, since the peers may send nothing else that would request them.
+func (t *Torrent) requestMissing() {
+	t.mu.Lock()
+	peers := make(map[string]*peer.PeerConn, len(t.peers))
+	for key, pc := range t.peers {
+		if pc != nil {
+			peers[key] = pc
+		}
+	}
+	t.mu.Unlock()
+	for key, pc := range peers {
+		t.requestBlocks(pc, key) // a failing peer is dropped by its own loop
+	}
+}
+
+// serveHashes answers a hash request of the peer with hashes of the piece layers of the
+// metainfo, or with the block hashes of a piece we have, and rejects other requests.
+func (t *Torrent) serveHashes(pc *peer.PeerConn, m *peer.Message) error {
+	r, err := m.ParseHashRequest()
+	if err != nil {
+		return err
+	}
+	hashes, proof, ok := t.answerHashes(r)
+	if !ok {
+		return pc.Send(peer.NewHashReject(r))
+	}
+	return pc.Send(peer.NewHashes(r, hashes, proof))
+}
+
+// answerHashes returns the hashes and proof answering r, or false if we cannot answer it.
+// Block hashes are only served within a single piece.
+func (t *Torrent) answerHashes(r peer.HashRequest) (hashes, proof [][32]byte, ok bool) {
+	length, index := int(r.Length), int(r.Index)
+	if length <= 0 || length > maxHashRequestLength || length&(length-1) != 0 || index%length != 0 {
+		return nil, nil, false
+	}
+	if _, ok := t.meta.TreePiece(r.PiecesRoot, 0); !ok {
+		return nil, nil, false // not a file of the torrent
+	}
+	pieceHeight := bits.TrailingZeros64(uint64(t.meta.Info.PieceLength / torrent.BlockSize))
+	pieceLayer := t.meta.PieceLayers[r.PiecesRoot] // nil for files of a single piece
+
+	switch {
+	case r.BaseLayer == uint32(pieceHeight) && pieceLayer != nil:
+		if index >= len(pieceLayer) {
+			return nil, nil, false
+		}
+		proof, err := merkle.Proof(pieceLayer, pieceHeight, index, length, int(r.ProofLayers))
+		if err != nil {
+			return nil, nil, false
+		}
+		return padLayer(pieceLayer[index:min(index+length, len(pieceLayer))], length, pieceHeight), proof, true
+
+	case r.BaseLayer == 0:
+		piece, ok := t.meta.TreePiece(r.PiecesRoot, index)
+		if !ok {
+			return nil, nil, false
+		}
+		tree, _ := t.meta.PieceTree(piece)
+		if length > tree.Leaves {
+			return nil, nil, false // spans several pieces
+		}
+		leaves, err := t.blockHashes(piece, tree)
+		if err != nil {
+			return nil, nil, false
+		}
+		proof, err := merkle.Proof(leaves, 0, index-tree.Index, length, int(r.ProofLayers))
+		if err != nil {
+			return nil, nil, false
+		}
+		// continue the proof above the piece from the piece layer
+		above := int(r.ProofLayers) - bits.TrailingZeros(uint(tree.Leaves/length))
+		if above > 0 && pieceLayer != nil {
+			more, err := merkle.Proof(pieceLayer, pieceHeight, tree.Index/tree.Leaves, 1, above)
+			if err != nil {
+				return nil, nil, false
+			}
+			proof = append(proof, more...)
+		}
+		offset := index - tree.Index
+		return leaves[offset : offset+length], proof, true
+	}
+	return nil, nil, false
+}
+
+// blockHashes returns the leaves of tree, the merkle tree of the piece at index, hashed from
+// the piece on disk. The piece must be one we have.
+func (t *Torrent) blockHashes(index int, tree torrent.PieceTree) ([][32]byte, error) {
+	t.mu.Lock()
+	have := t.have.Has(index)
+	st := t.storage
+	t.mu.Unlock()
+	if !have || st == nil {
+		return nil, fmt.Errorf("piece %d is not available", index)
+	}
+
+	leaves := make([][32]byte, tree.Leaves)
+	block := make([]byte, torrent.BlockSize)
+	for begin := int64(0); begin < tree.Length; begin += torrent.BlockSize {
+		data := block[:min(torrent.BlockSize, tree.Length-begin)]
+		if err := st.ReadBlock(index, begin, data); err != nil {
+			return nil, err
+		}
+		leaves[begin/torrent.BlockSize] = merkle.HashBlock(data)
+	}
+	return leaves, nil
+}
+
+// padLayer returns hashes, a run of a layer height levels above the leaves, padded with the
+// hash of all-zero subtrees up to length hashes.
+func padLayer(hashes [][32]byte, length, height int) [][32]byte {
+	padded := append([][32]byte(nil), hashes...)
+	for len(padded) < length {
+		padded = append(padded, merkle.PadHash(height))
+	}
+	return padded
+}
@@ -0,0 +1,317 @@
+package session
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/merkle"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// hybridPieceLength is the piece length of the hybrid test torrent: two blocks per piece.
+const hybridPieceLength = 2 * torrent.BlockSize
+
+// hybridContent returns 4.5 blocks of deterministic content, making 3 pieces of hybridPieceLength.
+func hybridContent() []byte {
+	content := make([]byte, 4*torrent.BlockSize+torrent.BlockSize/2)
+	for i := range content {
+		content[i] = byte(i * 13)
+	}
+	return content
+}
+
+// blockHashes returns the leaf hashes of the merkle tree of content.
+func blockHashes(content []byte) [][32]byte {
+	var leaves [][32]byte
+	for begin := 0; begin < len(content); begin += torrent.BlockSize {
+		leaves = append(leaves, merkle.HashBlock(content[begin:min(begin+torrent.BlockSize, len(content))]))
+	}
+	return leaves
+}
+
+// createHybrid returns a single-file hybrid torrent of content named "content".
+func createHybrid(t *testing.T, content []byte) *torrent.MetaInfo {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mi, err := torrent.Create(path, torrent.CreateOptions{PieceLength: hybridPieceLength, Hybrid: true})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	return mi
+}
+
+// v2Peer connects to the torrent of s as a peer supporting v2.
+func v2Peer(t *testing.T, s *Session, mi *torrent.MetaInfo) *peer.PeerConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := peer.NewPeerConn(conn, peer.Config{
+		InfoHash:  mi.InfoHash,
+		PeerID:    [20]byte{'v', '2'},
+		Reserved:  peer.ProtocolV2,
+		NumPieces: mi.Info.NumPieces(),
+	})
+	if err != nil {
+		t.Fatalf("NewPeerConn() returned error: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if !peer.SupportsV2(pc.Reserved()) {
+		t.Fatal("the session does not advertise v2 for a hybrid torrent")
+	}
+	return pc
+}
+
+// expectMessage returns the next message with the given ID received on pc, skipping the others.
+func expectMessage(t *testing.T, pc *peer.PeerConn, id peer.MessageID) *peer.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-pc.Messages():
+			if !ok {
+				t.Fatalf("connection closed: %v", pc.Err())
+			}
+			if m != nil && m.ID == id {
+				return m
+			}
+		case <-timeout:
+			t.Fatalf("no %s message received", id)
+		}
+	}
+}
+
+// TestHashVerification downloads a hybrid torrent from a peer corrupting a block once, and
+// checks that the block hashes it sends for the failed piece limit the download to that block.
+func TestHashVerification(t *testing.T) {
+	content := hybridContent()
+	mi := createHybrid(t, content)
+	s, err := New(Config{DownloadDir: t.TempDir(), ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	pc := v2Peer(t, s, mi)
+	all := torrent.NewBitfield(mi.Info.NumPieces())
+	for i := range mi.Info.NumPieces() {
+		all.Set(i)
+	}
+	if err := pc.Send(peer.NewBitfield(all)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.Unchoke(); err != nil {
+		t.Fatal(err)
+	}
+
+	corrupted := false
+	requests := map[[2]uint32]int{}
+	var hashRequests []peer.HashRequest
+	timeout := time.After(10 * time.Second)
+serve:
+	for {
+		var m *peer.Message
+		select {
+		case m = <-pc.Messages():
+			if m == nil {
+				t.Fatalf("connection closed: %v", pc.Err())
+			}
+		case <-tor.Done():
+			break serve
+		case <-timeout:
+			t.Fatalf("download did not complete, stats: %+v", tor.Stats())
+		}
+
+		var err error
+		switch m.ID {
+		case peer.MsgRequest:
+			var index, begin, length uint32
+			if index, begin, length, err = m.ParseRequest(); err != nil {
+				t.Fatal(err)
+			}
+			requests[[2]uint32{index, begin}]++
+			start := int64(index)*hybridPieceLength + int64(begin)
+			block := bytes.Clone(content[start : start+int64(length)])
+			if index == 1 && begin == torrent.BlockSize && !corrupted {
+				block[0] ^= 0xff
+				corrupted = true
+			}
+			err = pc.Send(peer.NewPiece(index, begin, block))
+		case peer.MsgHashRequest:
+			var r peer.HashRequest
+			if r, err = m.ParseHashRequest(); err != nil {
+				t.Fatal(err)
+			}
+			hashRequests = append(hashRequests, r)
+			leaves := blockHashes(content)[r.Index : r.Index+r.Length]
+			err = pc.Send(peer.NewHashes(r, leaves, nil))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := peer.HashRequest{PiecesRoot: mi.Info.FileTree[0].PiecesRoot, Index: 2, Length: 2}
+	if len(hashRequests) != 1 || hashRequests[0] != want {
+		t.Errorf("hash requests = %+v, want %+v", hashRequests, want)
+	}
+	if got := requests[[2]uint32{1, 0}]; got != 1 {
+		t.Errorf("the valid block of the failed piece was requested %d times, want once", got)
+	}
+	if got := requests[[2]uint32{1, torrent.BlockSize}]; got != 2 {
+		t.Errorf("the corrupt block was requested %d times, want twice", got)
+	}
+}
+
+// TestStopWithHashRequest stops a torrent waiting for the hashes of a failed piece and checks
+// that the wait is dropped, so that the torrent started again does not act on it.
+func TestStopWithHashRequest(t *testing.T) {
+	hashTimeout := hashRequestTimeout
+	hashRequestTimeout = 500 * time.Millisecond
+	t.Cleanup(func() { hashRequestTimeout = hashTimeout })
+
+	content := hybridContent()
+	mi := createHybrid(t, content)
+	s, err := New(Config{DownloadDir: t.TempDir(), ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	pc := v2Peer(t, s, mi)
+	all := torrent.NewBitfield(mi.Info.NumPieces())
+	for i := range mi.Info.NumPieces() {
+		all.Set(i)
+	}
+	if err := pc.Send(peer.NewBitfield(all)); err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.Unchoke(); err != nil {
+		t.Fatal(err)
+	}
+	timeout := time.After(5 * time.Second)
+	for requested := false; !requested; {
+		var m *peer.Message
+		select {
+		case m = <-pc.Messages():
+			if m == nil {
+				t.Fatalf("connection closed: %v", pc.Err())
+			}
+		case <-timeout:
+			t.Fatal("no hash request received")
+		}
+		switch m.ID {
+		case peer.MsgRequest:
+			index, begin, length, err := m.ParseRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			start := int64(index)*hybridPieceLength + int64(begin)
+			block := bytes.Clone(content[start : start+int64(length)])
+			if index == 1 {
+				block[0] ^= 0xff
+			}
+			if err := pc.Send(peer.NewPiece(index, begin, block)); err != nil {
+				t.Fatal(err)
+			}
+		case peer.MsgHashRequest:
+			requested = true // never answered
+		}
+	}
+
+	if err := tor.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	tor.mu.Lock()
+	waits := len(tor.hashWaits)
+	tor.mu.Unlock()
+	if waits != 0 {
+		t.Errorf("%d hash waits left after Stop()", waits)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * hashRequestTimeout) // an expired wait would release a piece of the new picker
+}
+
+// TestServeHashes checks the answers of a seeding session to hash requests for the piece
+// layer, for the blocks of a piece with a proof, and for an unknown file.
+func TestServeHashes(t *testing.T) {
+	content := hybridContent()
+	mi := createHybrid(t, content)
+	dir := t.TempDir()
+	writeContent(t, dir, content)
+	s, err := New(Config{DownloadDir: dir, ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, tor)
+	pc := v2Peer(t, s, mi)
+	root := mi.Info.FileTree[0].PiecesRoot
+
+	layerRequest := peer.HashRequest{PiecesRoot: root, BaseLayer: 1, Length: 4}
+	if err := pc.Send(peer.NewHashRequest(layerRequest)); err != nil {
+		t.Fatal(err)
+	}
+	r, hashes, proof, err := expectMessage(t, pc, peer.MsgHashes).ParseHashes()
+	if err != nil || r != layerRequest || len(proof) != 0 {
+		t.Fatalf("ParseHashes() = %+v, %d proof hashes, %v", r, len(proof), err)
+	}
+	if !merkle.Verify(hashes, 0, nil, root) {
+		t.Error("the piece layer does not hash up to the pieces root")
+	}
+
+	blockRequest := peer.HashRequest{PiecesRoot: root, Index: 2, Length: 2, ProofLayers: 2}
+	if err := pc.Send(peer.NewHashRequest(blockRequest)); err != nil {
+		t.Fatal(err)
+	}
+	r, hashes, proof, err = expectMessage(t, pc, peer.MsgHashes).ParseHashes()
+	if err != nil || r != blockRequest {
+		t.Fatalf("ParseHashes() = %+v, %v", r, err)
+	}
+	if leaves := blockHashes(content); hashes[0] != leaves[2] || hashes[1] != leaves[3] {
+		t.Error("block hashes do not match the content")
+	}
+	if !merkle.Verify(hashes, 2, proof, root) {
+		t.Error("the block hashes and their proof do not hash up to the pieces root")
+	}
+
+	unknown := peer.HashRequest{PiecesRoot: [32]byte{1}, Length: 2}
+	if err := pc.Send(peer.NewHashRequest(unknown)); err != nil {
+		t.Fatal(err)
+	}
+	if r, err := expectMessage(t, pc, peer.MsgHashReject).ParseHashRequest(); err != nil || r != unknown {
+		t.Errorf("hash reject = %+v, %v, want %+v", r, err, unknown)
+	}
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/lcsabi/gobit/internal/holepunch"
+	"github.com/lcsabi/gobit/internal/peer"
+)
+
+// holepunchID returns the extended message ID the peer wants ut_holepunch messages with, or
+// false if it does not support the extension.
+func holepunchID(pc *peer.PeerConn) (uint8, bool) {
+	remote, _ := pc.PeerExtensions()
+	return remote.ExtensionID(holepunch.ExtensionName)
+}
+
+// handleHolepunch answers a ut_holepunch message of the peer known by key: it relays the
+// rendezvous of the peer to the target, and connects to the peers the relays name. TCP
+// connections made at the same time from both sides get through most NATs, if less reliably
+// than the uTP connections BEP 55 has in mind.
+func (t *Torrent) handleHolepunch(ctx context.Context, pc *peer.PeerConn, key string, payload []byte) error {
+	m, err := holepunch.Parse(payload)
+	if err != nil {
+		return err
+	}
+	switch m.Type {
+	case holepunch.Rendezvous:
+		return t.relay(pc, key, m.Addr)
+	case holepunch.Connect:
+		t.logger.Debug("connecting to peer through holepunch", "peer", m.Addr.String(), "relay", key)
+		t.connect(ctx, m.Addr)
+	case holepunch.Error:
+		t.logger.Debug("holepunch failed", "peer", m.Addr.String(), "relay", key, "error", m.Err)
+	}
+	return nil
+}
+
+// relay forwards the rendezvous of the peer known by key for target: each side is told to
+// connect to the other, or the peer is sent an error if the target cannot be reached.
+func (t *Torrent) relay(pc *peer.PeerConn, key string, target netip.AddrPort) error {
+	id, ok := holepunchID(pc)
+	if !ok {
+		return nil // nowhere to send the answer
+	}
+	target = netip.AddrPortFrom(target.Addr().Unmap(), target.Port())
+
+	var code holepunch.ErrorCode
+	var other *peer.PeerConn
+	switch {
+	case !target.IsValid() || target.Port() == 0 || target.Addr().IsUnspecified():
+		code = holepunch.NoSuchPeer
+	case target == t.session.ExternalAddr():
+		code = holepunch.NoSelf
+	default:
+		t.mu.Lock()
+		other = t.peerAt(target)
+		t.mu.Unlock()
+		if other == nil {
+			code = holepunch.NotConnected
+		}
+	}
+	var otherID uint8
+	if code == 0 {
+		if otherID, ok = holepunchID(other); !ok {
+			code = holepunch.NoSupport
+		}
+	}
+	if code != 0 {
+		return pc.Send(holepunch.NewMessage(id, holepunch.Message{Type: holepunch.Error, Addr: target, Err: code}))
+	}
+
+	initiator, err := netip.ParseAddrPort(key)
+	if err != nil {
+		return nil
+	}
+	if remote, _ := pc.PeerExtensions(); remote.Port > 0 && remote.Port <= 0xffff {
+		// the peer accepts connections on its listening port, not on the one it connected from
+		initiator = netip.AddrPortFrom(initiator.Addr(), uint16(remote.Port))
+	}
+	// a failing target is dropped by its own loop
+	other.Send(holepunch.NewMessage(otherID, holepunch.Message{Type: holepunch.Connect, Addr: initiator}))
+	return pc.Send(holepunch.NewMessage(id, holepunch.Message{Type: holepunch.Connect, Addr: target}))
+}
+
+// peerAt returns the connected peer known by addr, or the one listening on addr, which PEX
+// shares for the peers that connected to us. It returns nil if there is none. t.mu must be
+// held.
+func (t *Torrent) peerAt(addr netip.AddrPort) *peer.PeerConn {
+	if pc := t.peers[addr.String()]; pc != nil {
+		return pc
+	}
+	for key, pc := range t.peers {
+		if pc == nil {
+			continue
+		}
+		if listening, _, ok := t.listenAddr(key, pc); ok && listening == addr {
+			return pc
+		}
+	}
+	return nil
+}
+
+// rendezvous asks the relay known by relayKey, which told us about the peer at addr through
+// PEX, to get the peer to connect to us at the same time as we connect to it. t.mu must not
+// be held.
+func (t *Torrent) rendezvous(relayKey string, addr netip.AddrPort) {
+	t.mu.Lock()
+	relay := t.peers[relayKey]
+	t.mu.Unlock()
+	if relay == nil {
+		return
+	}
+	id, ok := holepunchID(relay)
+	if !ok {
+		return
+	}
+	t.logger.Debug("asking relay for holepunch", "peer", addr.String(), "relay", relayKey)
+	// a failing relay is dropped by its own loop
+	relay.Send(holepunch.NewMessage(id, holepunch.Message{Type: holepunch.Rendezvous, Addr: addr}))
+}
@@ -0,0 +1,220 @@
+package session
+
+import (
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/holepunch"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/pex"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// holepunchPeer connects to the torrent of s as a peer supporting PEX and holepunching that
+// claims to listen on port, if not zero, and returns the connection and its local address.
+func holepunchPeer(t *testing.T, s *Session, mi *torrent.MetaInfo, port uint16) (*peer.PeerConn, netip.AddrPort) {
+	t.Helper()
+	conn, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pc, err := peer.NewPeerConn(conn, peer.Config{
+		InfoHash:  mi.InfoHash,
+		PeerID:    [20]byte{'h', byte(port >> 8), byte(port)},
+		Reserved:  peer.ExtensionProtocol,
+		NumPieces: mi.Info.NumPieces(),
+	})
+	if err != nil {
+		t.Fatalf("NewPeerConn() returned error: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	handshake, err := peer.NewExtensionHandshake(peer.ExtensionHandshake{
+		M:    map[string]int64{pex.ExtensionName: pex.LocalID, holepunch.ExtensionName: holepunch.LocalID},
+		Port: int64(port),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pc.Send(handshake); err != nil {
+		t.Fatal(err)
+	}
+	return pc, conn.LocalAddr().(*net.TCPAddr).AddrPort()
+}
+
+// expectHolepunch returns the next ut_holepunch message received on pc, skipping the others.
+func expectHolepunch(t *testing.T, pc *peer.PeerConn) holepunch.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-pc.Messages():
+			if !ok {
+				t.Fatalf("connection closed: %v", pc.Err())
+			}
+			if m.ID != peer.MsgExtended {
+				continue
+			}
+			id, payload, err := m.ParseExtended()
+			if err != nil || id != holepunch.LocalID {
+				continue
+			}
+			hm, err := holepunch.Parse(payload)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			return hm
+		case <-timeout:
+			t.Fatal("no holepunch message received")
+		}
+	}
+}
+
+// holepunchSeed returns a session seeding a torrent, listening on the loopback interface.
+func holepunchSeed(t *testing.T) (*Session, *Torrent) {
+	t.Helper()
+	content := testContent()
+	mi := createTorrent(t, content)
+	dir := t.TempDir()
+	writeContent(t, dir, content)
+	s, err := New(Config{DownloadDir: dir, ListenAddr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitDone(t, tor)
+	return s, tor
+}
+
+// waitHolepunchPeers waits until the torrent knows n connected peers supporting holepunching.
+func waitHolepunchPeers(t *testing.T, tor *Torrent, n int) {
+	t.Helper()
+	waitFor(t, func() bool {
+		tor.mu.Lock()
+		defer tor.mu.Unlock()
+		supporting := 0
+		for _, pc := range tor.peers {
+			if pc == nil {
+				continue
+			}
+			if _, ok := holepunchID(pc); ok {
+				supporting++
+			}
+		}
+		return supporting == n
+	})
+}
+
+// TestHolepunchRelay checks that a rendezvous is relayed to both peers, naming the listening
+// port of the initiator to the target, and that a rendezvous for an unknown peer is answered
+// with an error.
+func TestHolepunchRelay(t *testing.T) {
+	s, tor := holepunchSeed(t)
+	initiator, _ := holepunchPeer(t, s, tor.MetaInfo(), 7000)
+	target, targetAddr := holepunchPeer(t, s, tor.MetaInfo(), 0)
+	waitHolepunchPeers(t, tor, 2)
+
+	if err := initiator.Send(holepunch.NewMessage(holepunch.LocalID, holepunch.Message{Type: holepunch.Rendezvous, Addr: targetAddr})); err != nil {
+		t.Fatal(err)
+	}
+	want := holepunch.Message{Type: holepunch.Connect, Addr: targetAddr}
+	if got := expectHolepunch(t, initiator); got != want {
+		t.Errorf("initiator received %+v, want %+v", got, want)
+	}
+	want.Addr = netip.MustParseAddrPort("127.0.0.1:7000")
+	if got := expectHolepunch(t, target); got != want {
+		t.Errorf("target received %+v, want %+v", got, want)
+	}
+
+	unknown := netip.MustParseAddrPort("127.0.0.1:1")
+	if err := initiator.Send(holepunch.NewMessage(holepunch.LocalID, holepunch.Message{Type: holepunch.Rendezvous, Addr: unknown})); err != nil {
+		t.Fatal(err)
+	}
+	want = holepunch.Message{Type: holepunch.Error, Addr: unknown, Err: holepunch.NotConnected}
+	if got := expectHolepunch(t, initiator); got != want {
+		t.Errorf("initiator received %+v, want %+v", got, want)
+	}
+}
+
+// TestHolepunchRelayInbound checks that a rendezvous for a peer that connected to us is relayed
+// when it names the listening port PEX shares for the peer.
+func TestHolepunchRelayInbound(t *testing.T) {
+	s, tor := holepunchSeed(t)
+	initiator, _ := holepunchPeer(t, s, tor.MetaInfo(), 7000)
+	target, _ := holepunchPeer(t, s, tor.MetaInfo(), 7001)
+	waitHolepunchPeers(t, tor, 2)
+
+	targetAddr := netip.MustParseAddrPort("127.0.0.1:7001")
+	if err := initiator.Send(holepunch.NewMessage(holepunch.LocalID, holepunch.Message{Type: holepunch.Rendezvous, Addr: targetAddr})); err != nil {
+		t.Fatal(err)
+	}
+	want := holepunch.Message{Type: holepunch.Connect, Addr: targetAddr}
+	if got := expectHolepunch(t, initiator); got != want {
+		t.Errorf("initiator received %+v, want %+v", got, want)
+	}
+	want.Addr = netip.MustParseAddrPort("127.0.0.1:7000")
+	if got := expectHolepunch(t, target); got != want {
+		t.Errorf("target received %+v, want %+v", got, want)
+	}
+}
+
+// TestHolepunchInitiate checks that a peer shared through PEX that cannot be connected to is
+// asked from the relay that shared it, and that the peer named by the relay is connected to.
+func TestHolepunchInitiate(t *testing.T) {
+	s, tor := holepunchSeed(t)
+	relay, _ := holepunchPeer(t, s, tor.MetaInfo(), 7000)
+	waitHolepunchPeers(t, tor, 1)
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := closed.Addr().(*net.TCPAddr).AddrPort()
+	closed.Close()
+	exchange := pex.Message{Added: []pex.Peer{{Addr: unreachable, Flags: pex.FlagHolepunch}}}
+	m, err := pex.NewMessage(pex.LocalID, exchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := relay.Send(m); err != nil {
+		t.Fatal(err)
+	}
+	want := holepunch.Message{Type: holepunch.Rendezvous, Addr: unreachable}
+	if got := expectHolepunch(t, relay); got != want {
+		t.Fatalf("relay received %+v, want %+v", got, want)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	connect := holepunch.Message{Type: holepunch.Connect, Addr: listener.Addr().(*net.TCPAddr).AddrPort()}
+	if err := relay.Send(holepunch.NewMessage(holepunch.LocalID, connect)); err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		accepted <- err
+	}()
+	select {
+	case err := <-accepted:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the peer named by the relay was not connected to")
+	}
+}
@@ -0,0 +1,227 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/ipfilter"
+	"github.com/lcsabi/gobit/internal/mse"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/portmap"
+)
+
+// listen starts accepting inbound peer connections on cfg.ListenAddr, or on the first free
+// port of the cfg.ListenPorts ports starting there, reporting the port it listens on to
+// trackers unless cfg.Port is set.
+func (s *Session) listen() error {
+	ln, err := listenRange(s.cfg.ListenAddr, s.cfg.ListenPorts)
+	if err != nil {
+		return fmt.Errorf("listening for peers: %w", err)
+	}
+	s.listener = ln
+	if s.cfg.Port == 0 {
+		s.cfg.Port = uint16(ln.Addr().(*net.TCPAddr).Port)
+	}
+	s.logger.Info("listening for peers", "addr", ln.Addr().String())
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+	if len(s.cfg.PortMappers) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopMap = cancel
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			port := uint16(ln.Addr().(*net.TCPAddr).Port)
+			portmap.Keep(ctx, s.cfg.PortMappers, portmap.TCP, port, s.logger, func(m portmap.Mapping) {
+				s.mu.Lock()
+				s.external = m.External
+				s.mu.Unlock()
+			})
+		}()
+	}
+	return nil
+}
+
+// listenRange listens on addr, and if its port is in use, on the following ports until one is
+// free or count ports were tried.
+func listenRange(addr string, count int) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err == nil || count <= 1 {
+		return ln, err
+	}
+
+	host, portText, splitErr := net.SplitHostPort(addr)
+	port, parseErr := strconv.ParseUint(portText, 10, 16)
+	if splitErr != nil || parseErr != nil || port == 0 {
+		return nil, err
+	}
+	for i := 1; i < count && port+uint64(i) <= 65535; i++ {
+		next := net.JoinHostPort(host, strconv.FormatUint(port+uint64(i), 10))
+		if ln, nextErr := net.Listen("tcp", next); nextErr == nil {
+			return ln, nil
+		}
+	}
+	return nil, fmt.Errorf("no free port among the %d ports from %s: %w", count, addr, err)
+}
+
+// ExternalAddr returns the address peers outside the local network reach the session at,
+// as reported by the router that mapped the listening port. It is invalid until the port is
+// mapped.
+func (s *Session) ExternalAddr() netip.AddrPort {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.external
+}
+
+// announcePort returns the port reported to trackers: the external port of the port
+// mapping once there is one, cfg.Port otherwise.
+func (s *Session) announcePort() uint16 {
+	if external := s.ExternalAddr(); external.IsValid() {
+		return external.Port()
+	}
+	return s.cfg.Port
+}
+
+// ListenAddr returns the address the session accepts peers on, or nil if it does not listen.
+func (s *Session) ListenAddr() net.Addr {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// acceptLoop accepts connections until the listener is closed, handling each on its own
+// goroutine within the connection limits.
+func (s *Session) acceptLoop() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				s.logger.Warn("accepting peer failed", "error", err)
+			}
+			return
+		}
+
+		ip := conn.RemoteAddr().(*net.TCPAddr).AddrPort().Addr().Unmap()
+		if !s.cfg.IPFilter.Allow(ip, ipfilter.Inbound) {
+			s.logger.Debug("rejecting incoming connection from blocked address", "peer", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+		if err := s.admit(ip); err != nil {
+			s.logger.Debug("rejecting incoming connection", "peer", conn.RemoteAddr().String(), "error", err)
+			conn.Close()
+			continue
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.release(ip)
+			if err := s.handleIncoming(conn); err != nil {
+				s.logger.Debug("incoming connection failed", "peer", conn.RemoteAddr().String(), "error", err)
+			}
+		}()
+	}
+}
+
+// admit counts an inbound connection from ip against the limits, or returns an error if it
+// exceeds one of them. Admitted connections are released once they end.
+func (s *Session) admit(ip netip.Addr) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.closed:
+		return errors.New("session is closed")
+	case s.numIncoming >= s.cfg.MaxIncoming:
+		return errors.New("too many incoming connections")
+	case s.incoming[ip] >= s.cfg.MaxConnsPerIP:
+		return errors.New("too many connections from the same IP address")
+	}
+	s.numIncoming++
+	s.incoming[ip]++
+	return nil
+}
+
+func (s *Session) release(ip netip.Addr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.numIncoming--
+	if s.incoming[ip]--; s.incoming[ip] == 0 {
+		delete(s.incoming, ip)
+	}
+}
+
+// handleIncoming reads the handshake of an inbound connection, decrypting it first if the
+// peer starts with the MSE handshake, and hands the connection to the torrent it names.
+// It returns once the connection ends, which closes it.
+func (s *Session) handleIncoming(conn net.Conn) error {
+	if err := conn.SetDeadline(time.Now().Add(peer.DefaultHandshakeTimeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// a plaintext handshake starts with the protocol string, anything else is taken for MSE
+	r := bufio.NewReader(conn)
+	prefix, err := r.Peek(1 + len(peer.Protocol))
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("reading handshake: %w", err)
+	}
+	plaintext := int(prefix[0]) == len(peer.Protocol) && string(prefix[1:]) == peer.Protocol
+
+	var c net.Conn = &bufferedConn{Conn: conn, r: r}
+	switch policy := s.cfg.Encryption; {
+	case plaintext && policy == mse.Required:
+		conn.Close()
+		return errors.New("plaintext connection refused, encryption is required")
+	case !plaintext && policy == mse.Disabled:
+		conn.Close()
+		return errors.New("unexpected handshake, encryption is disabled")
+	case !plaintext:
+		if c, _, err = mse.Accept(c, s.infoHashes(), policy.Provide()); err != nil {
+			conn.Close()
+			return fmt.Errorf("encryption handshake: %w", err)
+		}
+	}
+
+	remote, err := peer.ReadHandshake(c)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	t := s.Torrent(remote.InfoHash)
+	if t == nil {
+		conn.Close()
+		return fmt.Errorf("unknown torrent %x", remote.InfoHash)
+	}
+	return t.serveIncoming(c, remote)
+}
+
+// infoHashes returns the info hashes of the torrents of the session.
+func (s *Session) infoHashes() [][20]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hashes := make([][20]byte, 0, len(s.torrents))
+	for infoHash := range s.torrents {
+		hashes = append(hashes, infoHash)
+	}
+	return hashes
+}
+
+// bufferedConn is a connection whose reads go through a buffer that was peeked into.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,226 @@
+package session
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/ipfilter"
+	"github.com/lcsabi/gobit/internal/mse"
+	"github.com/lcsabi/gobit/internal/portmap"
+)
+
+// TestListen downloads a torrent from another session that only accepts the connection,
+// with each encryption policy on both sides, checking that the seeder reads each piece from
+// disk once.
+func TestListen(t *testing.T) {
+	for _, policy := range []mse.Policy{mse.Disabled, mse.Preferred, mse.Required} {
+		t.Run(policy.String(), func(t *testing.T) {
+			content := testContent()
+			mi := createTorrent(t, content)
+
+			seedDir := t.TempDir()
+			writeContent(t, seedDir, content)
+			seedSession, err := New(Config{
+				DownloadDir:    seedDir,
+				ListenAddr:     "127.0.0.1:0",
+				Encryption:     policy,
+				ReadCacheBytes: int64(len(content)),
+			})
+			if err != nil {
+				t.Fatalf("New() returned error: %v", err)
+			}
+			defer seedSession.Close()
+			seedTorrent, err := seedSession.AddTorrent(mi)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := seedTorrent.Start(); err != nil {
+				t.Fatal(err)
+			}
+			waitDone(t, seedTorrent)
+
+			addr := netip.MustParseAddrPort(seedSession.ListenAddr().String())
+			if got := seedSession.cfg.Port; got != addr.Port() {
+				t.Errorf("reported port = %d, want the listening port %d", got, addr.Port())
+			}
+			leechMeta := *mi
+			leechMeta.Announce = newTracker(t, addr)
+
+			s, err := New(Config{DownloadDir: t.TempDir(), Encryption: policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			tor, err := s.AddTorrent(&leechMeta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := tor.Start(); err != nil {
+				t.Fatal(err)
+			}
+			waitDone(t, tor)
+			if got := seedTorrent.Stats().Uploaded; got != int64(len(content)) {
+				t.Errorf("seeder Uploaded = %d, want %d", got, len(content))
+			}
+			numPieces := mi.Info.NumPieces()
+			if stats := seedSession.ReadCacheStats(); stats.Misses != int64(numPieces) || stats.Pieces != numPieces {
+				t.Errorf("seeder ReadCacheStats() = %+v, want %d pieces read once", stats, numPieces)
+			}
+		})
+	}
+}
+
+// TestListenLimits checks that inbound connections beyond the per-IP cap are closed at once,
+// and that connections for unknown torrents are rejected.
+func TestListenLimits(t *testing.T) {
+	s, err := New(Config{DownloadDir: t.TempDir(), ListenAddr: "127.0.0.1:0", MaxConnsPerIP: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	first, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	waitFor(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.numIncoming == 1
+	})
+
+	second, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	expectClosed(t, second)
+
+	// the handshake of the first connection names a torrent the session does not have
+	handshake := append([]byte{19}, "BitTorrent protocol"+string(make([]byte, 48))...)
+	if _, err := first.Write(handshake); err != nil {
+		t.Fatal(err)
+	}
+	expectClosed(t, first)
+}
+
+// TestIPFilter checks that blocked peers are neither accepted nor dialed, and counted.
+func TestIPFilter(t *testing.T) {
+	loopback := netip.MustParseAddr("127.0.0.1")
+	filter := ipfilter.New([]ipfilter.Range{{First: loopback, Last: loopback, Description: "test"}})
+
+	content := testContent()
+	mi := createTorrent(t, content)
+	seed := newSeeder(t, mi, content)
+	mi.Announce = newTracker(t, seed.addr())
+	s, err := New(Config{DownloadDir: t.TempDir(), ListenAddr: "127.0.0.1:0", IPFilter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.ListenAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	expectClosed(t, conn)
+
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return filter.Stats().BlockedOutbound > 0 })
+	if stats := filter.Stats(); stats.BlockedInbound != 1 {
+		t.Errorf("BlockedInbound = %d, want 1", stats.BlockedInbound)
+	}
+	if peers := tor.Stats().Peers; peers != 0 {
+		t.Errorf("connected to %d blocked peers", peers)
+	}
+}
+
+// writeContent writes content to the file of the torrents made by createTorrent in dir.
+func writeContent(t *testing.T, dir string, content []byte) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "content"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a timeout.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// expectClosed fails the test unless the other end closes conn without sending anything.
+func expectClosed(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if n, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("Read() = %d, %v, want the connection closed", n, err)
+	}
+}
+
+// staticMapper maps every port to a fixed external address.
+type staticMapper struct {
+	external netip.AddrPort
+	unmapped chan portmap.Mapping
+}
+
+func (m *staticMapper) Map(ctx context.Context, protocol string, internalPort uint16, lifetime time.Duration) (portmap.Mapping, error) {
+	return portmap.Mapping{Protocol: protocol, InternalPort: internalPort, External: m.external, Lifetime: lifetime}, nil
+}
+
+func (m *staticMapper) Unmap(ctx context.Context, mapping portmap.Mapping) error {
+	m.unmapped <- mapping
+	return nil
+}
+
+func (m *staticMapper) String() string { return "static" }
+
+// TestPortMapping checks that the listening port is mapped, the external port announced and
+// the mapping removed on Close.
+func TestPortMapping(t *testing.T) {
+	mapper := &staticMapper{external: netip.MustParseAddrPort("203.0.113.7:7000"), unmapped: make(chan portmap.Mapping, 1)}
+	s, err := New(Config{DownloadDir: t.TempDir(), ListenAddr: "127.0.0.1:0", PortMappers: []portmap.Mapper{mapper}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, func() bool { return s.ExternalAddr().IsValid() })
+	if got := s.ExternalAddr(); got != mapper.external {
+		t.Errorf("ExternalAddr() = %v, want %v", got, mapper.external)
+	}
+	if got := s.announcePort(); got != 7000 {
+		t.Errorf("announced port = %d, want the external port 7000", got)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-mapper.unmapped:
+		if want := netip.MustParseAddrPort(s.ListenAddr().String()).Port(); m.InternalPort != want {
+			t.Errorf("unmapped internal port %d, want %d", m.InternalPort, want)
+		}
+	default:
+		t.Error("mapping was not removed on Close")
+	}
+}
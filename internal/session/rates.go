@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/ratelimit"
+)
+
+// Rates returns the base rate limits of the session and the schedule changing them, as
+// configured or last set with SetRates.
+func (s *Session) Rates() (ratelimit.Rates, ratelimit.Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rates, s.schedule
+}
+
+// CurrentRates returns the rate limits in effect now, the base rates or those of the
+// schedule rule whose window includes the current time.
+func (s *Session) CurrentRates() ratelimit.Rates {
+	return ratelimit.Rates{Download: s.download.Rate(), Upload: s.upload.Rate()}
+}
+
+// SetRates replaces the base rate limits and the schedule, applying them at once.
+func (s *Session) SetRates(base ratelimit.Rates, schedule ratelimit.Schedule) {
+	s.mu.Lock()
+	s.rates, s.schedule = base, schedule
+	s.mu.Unlock()
+	s.applyRates(time.Now())
+}
+
+// applyRates sets the limiters to the rates in effect at now.
+func (s *Session) applyRates(now time.Time) {
+	s.mu.Lock()
+	rates := s.schedule.At(now, s.rates)
+	s.mu.Unlock()
+	if rates == s.CurrentRates() {
+		return
+	}
+	s.download.SetRate(rates.Download)
+	s.upload.SetRate(rates.Upload)
+	s.logger.Info("rate limits changed",
+		"download", ratelimit.FormatRate(rates.Download), "upload", ratelimit.FormatRate(rates.Upload))
+}
+
+// scheduleLoop applies the rates of the schedule at the start of every minute, the
+// resolution of its windows, until ctx is cancelled.
+func (s *Session) scheduleLoop(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now = <-timer.C:
+		}
+		s.applyRates(now)
+	}
+}
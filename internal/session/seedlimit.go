@@ -0,0 +1,132 @@
+package session
+
+import (
+	"fmt"
+	"time"
+)
+
+// SeedAction is what a torrent does once it reaches one of its seed limits.
+type SeedAction int
+
+const (
+	SeedStop  SeedAction = iota // stop the torrent, telling the trackers it is gone
+	SeedPause                   // disconnect from the peers, keeping the torrent ready to resume
+)
+
+func (a SeedAction) String() string {
+	switch a {
+	case SeedStop:
+		return "stop"
+	case SeedPause:
+		return "pause"
+	}
+	return "unknown"
+}
+
+// ParseSeedAction returns the seed action named by s, as returned by String: "stop" or
+// "pause".
+func ParseSeedAction(s string) (SeedAction, error) {
+	for a := SeedStop; a <= SeedPause; a++ {
+		if a.String() == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown seed action %q", s)
+}
+
+// SeedLimits are the conditions a seeding torrent stops seeding at, checked at every
+// rechoke. A zero limit is disabled.
+type SeedLimits struct {
+	Ratio  float64       // upload ratio, see Stats.Ratio
+	Time   time.Duration // time spent seeding, including previous runs with fast resume
+	Action SeedAction    // what the torrent does once either limit is reached
+}
+
+// SeedLimits returns the seed limits of the torrent: those set by SetSeedLimits, or the
+// limits of the session.
+func (t *Torrent) SeedLimits() SeedLimits {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.seedLimitsLocked()
+}
+
+// SetSeedLimits replaces the seed limits of the session for the torrent. A torrent that is
+// started again after reaching a limit stops seeding again, unless the limit is raised.
+func (t *Torrent) SetSeedLimits(limits SeedLimits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.seedLimits = &limits
+}
+
+// seedLimitsLocked returns the seed limits of the torrent. t.mu must be held.
+func (t *Torrent) seedLimitsLocked() SeedLimits {
+	if t.seedLimits != nil {
+		return *t.seedLimits
+	}
+	return t.session.cfg.SeedLimits
+}
+
+// setState changes the state of the torrent, accounting for the time spent seeding.
+// t.mu must be held.
+func (t *Torrent) setState(state State) {
+	now := time.Now()
+	switch {
+	case state == StateSeeding && t.seedingSince.IsZero():
+		t.seedingSince = now
+	case state != StateSeeding && !t.seedingSince.IsZero():
+		t.seedingTime += now.Sub(t.seedingSince)
+		t.seedingSince = time.Time{}
+	}
+	t.state = state
+}
+
+// seedingTimeAt returns the time spent seeding until now. t.mu must be held.
+func (t *Torrent) seedingTimeAt(now time.Time) time.Duration {
+	if t.seedingSince.IsZero() {
+		return t.seedingTime
+	}
+	return t.seedingTime + now.Sub(t.seedingSince)
+}
+
+// ratio returns the upload ratio of the torrent. t.mu must be held.
+func (t *Torrent) ratio() float64 {
+	downloaded := max(t.downloaded, t.meta.Info.TotalLength())
+	if downloaded == 0 {
+		return 0
+	}
+	return float64(t.uploaded) / float64(downloaded)
+}
+
+// checkSeedLimits stops seeding once the torrent reaches one of its seed limits, and emits
+// an EventSeedLimitReached event.
+func (t *Torrent) checkSeedLimits(now time.Time) {
+	t.mu.Lock()
+	limits := t.seedLimitsLocked()
+	ratio := t.ratio()
+	seedingTime := t.seedingTimeAt(now)
+	reached := t.state == StateSeeding && !t.seedLimitReached &&
+		(limits.Ratio > 0 && ratio >= limits.Ratio || limits.Time > 0 && seedingTime >= limits.Time)
+	if reached {
+		t.seedLimitReached = true
+	}
+	t.mu.Unlock()
+	if !reached {
+		return
+	}
+
+	t.logger.Info("seed limit reached", "ratio", fmt.Sprintf("%.2f", ratio), "seeding", seedingTime.Round(time.Second), "action", limits.Action)
+	// Pause and Stop wait for the goroutines of the run, including the caller
+	go func() {
+		var err error
+		switch limits.Action {
+		case SeedPause:
+			err = t.Pause()
+		default:
+			err = t.Stop()
+		}
+		if err != nil {
+			t.logger.Warn("stopping seeding failed", "error", err)
+		}
+		t.emit(Event{Type: EventSeedLimitReached, Ratio: ratio, SeedingTime: seedingTime})
+	}()
+}
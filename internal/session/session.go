@@ -0,0 +1,429 @@
+// Package session runs torrent downloads.
+//
+// A Session owns the torrents added to it and the resources they share, such as the peer ID
+// and the tracker client. Each Torrent ties the other packages together: it announces to the
+// trackers, connects to the peers they return, asks the picker which blocks to request, writes
+// the received blocks through storage and verifies completed pieces.
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/choke"
+	"github.com/lcsabi/gobit/internal/diskio"
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/ipfilter"
+	"github.com/lcsabi/gobit/internal/logging"
+	"github.com/lcsabi/gobit/internal/metadata"
+	"github.com/lcsabi/gobit/internal/mse"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/peerid"
+	"github.com/lcsabi/gobit/internal/portmap"
+	"github.com/lcsabi/gobit/internal/ratelimit"
+	"github.com/lcsabi/gobit/internal/storage"
+	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/internal/tracker"
+	"github.com/lcsabi/gobit/internal/webseed"
+)
+
+// defaults for the zero values of Config
+const (
+	DefaultMaxPeers      = 30
+	DefaultDownloadDir   = "."
+	DefaultMaxIncoming   = 200
+	DefaultMaxConnsPerIP = 3
+
+	// DefaultUserAgent identifies gobit in tracker and web seed requests.
+	DefaultUserAgent = peerid.ClientName + "/" + peerid.Version
+)
+
+// Config configures a Session.
+type Config struct {
+	DownloadDir string   // directory the content is stored in, DefaultDownloadDir if empty
+	ResumeDir   string   // directory the resume files are kept in, fast resume is disabled if empty
+	PeerID      [20]byte // ID of this client, generated with peerid.New if zero
+	Port        uint16   // port reported to trackers, the listening port if zero
+
+	// IncompleteDir is the directory torrents are downloaded into until they complete, when
+	// their files are moved to DownloadDir. Torrents are downloaded into DownloadDir if empty.
+	IncompleteDir string
+	// PartFiles appends ".part" to the names of the files of incomplete torrents, dropped
+	// once they complete.
+	PartFiles bool
+	// Allocation selects how the files of a torrent are allocated when it opens its content
+	// on Start. The zero value, storage.AllocateNone, lets the files grow as pieces arrive.
+	Allocation storage.Allocation
+
+	// DiskWorkers and DiskQueueBytes size the queue writing the received blocks in the
+	// background: the goroutines writing them, diskio.DefaultWorkers if zero, and the bytes of
+	// the blocks waiting to be written, diskio.DefaultMaxBytes if zero. Peers sending blocks
+	// are slowed down while the queue is full.
+	DiskWorkers    int
+	DiskQueueBytes int64
+
+	// ReadCacheBytes is the memory kept for the pieces recently read to be sent to peers,
+	// evicting the least recently used ones, so a piece requested by many peers is read from
+	// disk once. No pieces are cached if zero; diskio.DefaultCacheBytes is a sensible size.
+	ReadCacheBytes int64
+
+	// ListenAddr is the address to accept peers on, such as ":6881". Listening on a port
+	// without a host accepts both IPv4 and IPv6 peers. The session does not listen if empty.
+	ListenAddr string
+	// ListenPorts is the number of consecutive ports tried, starting at the port of ListenAddr,
+	// until one is free. Only the port of ListenAddr is tried if zero.
+	ListenPorts   int
+	MaxIncoming   int // inbound connections at once across all torrents, DefaultMaxIncoming if zero
+	MaxConnsPerIP int // inbound connections at once from one IP address, DefaultMaxConnsPerIP if zero
+
+	// DownloadRate and UploadRate limit the payload transfer rates of all torrents together,
+	// in bytes per second, unlimited if zero. Schedule changes them by time of day and day
+	// of week; SetRates replaces all three while the session runs.
+	DownloadRate int64
+	UploadRate   int64
+	Schedule     ratelimit.Schedule
+
+	// IPFilter blocks the peers in its ranges: their inbound connections are refused and
+	// the addresses received from trackers and PEX are not dialed. Nil blocks nothing.
+	IPFilter *ipfilter.Filter
+
+	// PortMappers forward the listening port on the router, tried in order until one
+	// succeeds, so peers outside the local network can connect. The external port is then
+	// reported to trackers. Nil disables port mapping; portmap.DefaultMappers returns the
+	// UPnP and NAT-PMP mappers for the default gateway.
+	PortMappers []portmap.Mapper
+
+	// IPv6 is the IPv6 address of this client reported to trackers, so IPv6 peers can find
+	// it even when announcing over IPv4. None is reported if invalid.
+	IPv6 netip.Addr
+
+	// AddressFamily selects the IP versions of the peers to connect to. The zero value,
+	// AnyFamily, connects to both.
+	AddressFamily AddressFamily
+
+	MaxPeers      int // maximum number of connections per torrent, DefaultMaxPeers if zero
+	PipelineDepth int // outstanding block requests per peer, picker.DefaultPipelineDepth if zero
+
+	Encryption mse.Policy // whether peer connections are encrypted, plaintext if zero
+
+	// SeedLimits stop the torrents from seeding at an upload ratio or after a seeding time,
+	// unless replaced by Torrent.SetSeedLimits. The zero value seeds forever.
+	SeedLimits SeedLimits
+
+	// NewChoker creates the choker deciding which peers each torrent uploads to.
+	// If nil, every torrent uses a choke.TitForTat with the default settings.
+	NewChoker func() choke.Choker
+
+	Tracker *tracker.Client // client used to announce, one sharing Logger if nil
+	WebSeed *webseed.Client // client used to download from web seeds, the zero Client if nil
+
+	// UserAgent is sent in the requests of the default Tracker and WebSeed clients,
+	// DefaultUserAgent if empty.
+	UserAgent string
+
+	// Logger receives the output of the session and of the trackers and peers it talks to,
+	// each record tagged with its subsystem. If nil, every subsystem uses its logger from
+	// package logging.
+	Logger *slog.Logger
+}
+
+// Session manages a set of torrents. It is safe for concurrent use.
+type Session struct {
+	cfg      Config
+	logger   *slog.Logger
+	listener net.Listener       // nil if the session does not listen
+	stopMap  context.CancelFunc // stops the port mapping, nil if the port is not mapped
+	wg       sync.WaitGroup     // accept loop, inbound connections, port mapping and rate schedule
+	maxPeers atomic.Int64       // connections per torrent, Config.MaxPeers until changed
+
+	download     *ratelimit.Limiter // payload received by all torrents
+	upload       *ratelimit.Limiter // payload sent by all torrents
+	stopSchedule context.CancelFunc // stops applying the rate schedule
+	disk         *diskio.Queue      // writes the blocks received by all torrents
+	cache        *diskio.ReadCache  // pieces read to be sent by all torrents
+
+	mu          sync.Mutex
+	torrents    map[infohash.V1]*Torrent
+	incoming    map[netip.Addr]int // inbound connections by IP address
+	numIncoming int
+	external    netip.AddrPort // external address of the port mapping, invalid if none
+	closed      bool
+	rates       ratelimit.Rates    // base rate limits
+	schedule    ratelimit.Schedule // windows with other rate limits
+
+	eventMu       sync.Mutex // guards the subscriptions, never held while taking another lock
+	subscriptions []subscription
+	eventsClosed  bool
+}
+
+// New returns a Session using cfg, filling in the defaults of its zero fields.
+func New(cfg Config) (*Session, error) {
+	if cfg.DownloadDir == "" {
+		cfg.DownloadDir = DefaultDownloadDir
+	}
+	if cfg.MaxPeers <= 0 {
+		cfg.MaxPeers = DefaultMaxPeers
+	}
+	if cfg.MaxIncoming <= 0 {
+		cfg.MaxIncoming = DefaultMaxIncoming
+	}
+	if cfg.MaxConnsPerIP <= 0 {
+		cfg.MaxConnsPerIP = DefaultMaxConnsPerIP
+	}
+	if cfg.PeerID == [20]byte{} {
+		id, err := peerid.New()
+		if err != nil {
+			return nil, err
+		}
+		cfg.PeerID = id
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = DefaultUserAgent
+	}
+	if cfg.Tracker == nil {
+		cfg.Tracker = tracker.NewClient(subsystemLogger(cfg.Logger, logging.Tracker))
+		cfg.Tracker.UserAgent = cfg.UserAgent
+	}
+	if cfg.WebSeed == nil {
+		cfg.WebSeed = &webseed.Client{UserAgent: cfg.UserAgent}
+	}
+	if cfg.NewChoker == nil {
+		cfg.NewChoker = func() choke.Choker { return &choke.TitForTat{} }
+	}
+
+	s := &Session{
+		cfg:      cfg,
+		logger:   logging.Or(subsystemLogger(cfg.Logger, logging.Session), logging.Session),
+		torrents: make(map[infohash.V1]*Torrent),
+		incoming: make(map[netip.Addr]int),
+		download: ratelimit.NewLimiter(0),
+		upload:   ratelimit.NewLimiter(0),
+		rates:    ratelimit.Rates{Download: cfg.DownloadRate, Upload: cfg.UploadRate},
+		schedule: cfg.Schedule,
+		cache:    diskio.NewReadCache(cfg.ReadCacheBytes),
+	}
+	s.maxPeers.Store(int64(cfg.MaxPeers))
+	s.applyRates(time.Now())
+	if cfg.ListenAddr != "" {
+		if err := s.listen(); err != nil {
+			return nil, err
+		}
+	}
+	s.disk = diskio.NewQueue(diskio.Options{Workers: cfg.DiskWorkers, MaxBytes: cfg.DiskQueueBytes})
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopSchedule = cancel
+	s.wg.Add(1)
+	go s.scheduleLoop(ctx)
+	return s, nil
+}
+
+// PeerID returns the peer ID the session identifies itself with.
+func (s *Session) PeerID() [20]byte {
+	return s.cfg.PeerID
+}
+
+// MaxPeers returns the maximum number of connections per torrent.
+func (s *Session) MaxPeers() int {
+	return int(s.maxPeers.Load())
+}
+
+// SetMaxPeers changes the maximum number of connections per torrent, restoring
+// DefaultMaxPeers if n is not positive. Torrents above the new limit keep their connections,
+// but make no new ones until they drop below it.
+func (s *Session) SetMaxPeers(n int) {
+	if n <= 0 {
+		n = DefaultMaxPeers
+	}
+	s.maxPeers.Store(int64(n))
+}
+
+// DiskStats returns the activity of the queue writing the received blocks to disk.
+func (s *Session) DiskStats() diskio.Stats {
+	return s.disk.Stats()
+}
+
+// ReadCacheStats returns the activity of the cache of the pieces sent to peers.
+func (s *Session) ReadCacheStats() diskio.CacheStats {
+	return s.cache.Stats()
+}
+
+// AddTorrent adds the torrent described by mi to the session in the stopped state.
+// If the session keeps resume files, the transfer counters and verified pieces of a previous
+// run are restored, sparing the check of the content on Start if it did not change since.
+// It returns an error if the torrent was already added or cannot be downloaded,
+// as is the case for pure v2 torrents.
+func (s *Session) AddTorrent(mi *torrent.MetaInfo) (*Torrent, error) {
+	if !mi.HasV1() {
+		return nil, errors.New("v2-only torrents are not supported")
+	}
+	if mi.Info.NumPieces() == 0 {
+		return nil, errors.New("torrent has no pieces")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, errors.New("session is closed")
+	}
+	if _, ok := s.torrents[mi.InfoHash]; ok {
+		return nil, fmt.Errorf("torrent %x already added", mi.InfoHash)
+	}
+
+	t := newTorrent(s, mi)
+	t.loadResume()
+	s.torrents[mi.InfoHash] = t
+	s.emit(Event{Type: EventTorrentAdded, InfoHash: mi.InfoHash})
+	return t, nil
+}
+
+// AddMagnet downloads the info dictionary of the torrent described by the magnet link uri from
+// its peers, found through the link's peer addresses and trackers, and adds the torrent to the
+// session in the stopped state.
+func (s *Session) AddMagnet(ctx context.Context, uri string) (*Torrent, error) {
+	magnet, err := torrent.ParseMagnet(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !magnet.HasV1() {
+		return nil, errors.New("magnet links without a v1 info hash are not supported")
+	}
+	if s.Torrent(magnet.InfoHash) != nil {
+		return nil, fmt.Errorf("torrent %x already added", magnet.InfoHash)
+	}
+
+	var peers []netip.AddrPort
+	for _, p := range magnet.Peers {
+		peers = append(peers, p.Addr)
+	}
+	if len(magnet.Trackers) > 0 {
+		tiers := make([][]string, len(magnet.Trackers))
+		for i, tr := range magnet.Trackers {
+			tiers[i] = []string{tr}
+		}
+		resp, _, err := s.cfg.Tracker.AnnounceTiers(ctx, tiers, tracker.AnnounceRequest{
+			InfoHash: magnet.InfoHash,
+			PeerID:   s.cfg.PeerID,
+			Port:     s.announcePort(),
+			IPv6:     s.cfg.IPv6,
+			Left:     1, // the size is unknown without the metadata, but something is left
+		})
+		if err != nil {
+			s.logger.Warn("announce for magnet link failed", "error", err)
+		} else {
+			for _, p := range resp.Peers {
+				peers = append(peers, p.Addr)
+			}
+		}
+	}
+
+	mi, err := metadata.FetchFromPeers(ctx, magnet, s.cfg.AddressFamily.order(peers), peer.Config{PeerID: s.cfg.PeerID, Encryption: s.cfg.Encryption, Logger: s.peerLogger()})
+	if err != nil {
+		return nil, err
+	}
+	return s.AddTorrent(mi)
+}
+
+// Torrent returns the torrent with the given info hash, or nil if it was not added.
+func (s *Session) Torrent(infoHash infohash.V1) *Torrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.torrents[infoHash]
+}
+
+// Torrents returns every torrent of the session, in no particular order.
+func (s *Session) Torrents() []*Torrent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	torrents := make([]*Torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		torrents = append(torrents, t)
+	}
+	return torrents
+}
+
+// RemoveTorrent stops the torrent with the given info hash and removes it from the session.
+// The downloaded content is kept.
+func (s *Session) RemoveTorrent(infoHash infohash.V1) error {
+	s.mu.Lock()
+	t, ok := s.torrents[infoHash]
+	delete(s.torrents, infoHash)
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("torrent %x not found", infoHash)
+	}
+	err := t.Stop()
+	s.emit(Event{Type: EventTorrentRemoved, InfoHash: infoHash})
+	return err
+}
+
+// IPFilter returns the filter blocking peers, nil if there is none.
+func (s *Session) IPFilter() *ipfilter.Filter {
+	return s.cfg.IPFilter
+}
+
+// Close stops listening, stops every torrent and closes the channels of the subscriptions.
+// The session cannot be used afterwards. It is Shutdown without a deadline, each torrent
+// still waiting at most a few seconds for its trackers.
+func (s *Session) Close() error {
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown closes the session like Close, stopping the torrents concurrently. Their
+// 'stopped' announces are abandoned once ctx is done, so a deadline on ctx bounds how long
+// shutting down takes; the resume files are written regardless.
+func (s *Session) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	torrents := make([]*Torrent, 0, len(s.torrents))
+	for _, t := range s.torrents {
+		torrents = append(torrents, t)
+	}
+	s.mu.Unlock()
+
+	var errs []error
+	if s.listener != nil {
+		errs = append(errs, s.listener.Close())
+	}
+	if s.stopMap != nil {
+		s.stopMap()
+	}
+	s.stopSchedule()
+	stopErrs := make([]error, len(torrents))
+	var stopping sync.WaitGroup
+	for i, t := range torrents {
+		stopping.Add(1)
+		go func() {
+			defer stopping.Done()
+			stopErrs[i] = t.stop(ctx)
+		}()
+	}
+	stopping.Wait()
+	errs = append(errs, stopErrs...)
+	s.wg.Wait()
+	s.disk.Close()
+	s.closeEvents()
+	return errors.Join(errs...)
+}
+
+// peerLogger returns the logger handed to peer connections.
+func (s *Session) peerLogger() *slog.Logger {
+	return logging.Or(subsystemLogger(s.cfg.Logger, logging.Peer), logging.Peer)
+}
+
+// subsystemLogger tags l with the given subsystem. It returns nil if l is nil, leaving the
+// choice of logger to the subsystem.
+func subsystemLogger(l *slog.Logger, subsystem string) *slog.Logger {
+	if l == nil {
+		return nil
+	}
+	return l.With(logging.SubsystemKey, subsystem)
+}
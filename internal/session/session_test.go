@@ -0,0 +1,204 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/peerid"
+	"github.com/lcsabi/gobit/internal/ratelimit"
+	"github.com/lcsabi/gobit/internal/resume"
+	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/internal/tracker/trackertest"
+)
+
+// TestNewDefaults verifies the defaults filled in for a zero Config.
+func TestNewDefaults(t *testing.T) {
+	s, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	if s.cfg.DownloadDir != DefaultDownloadDir || s.cfg.MaxPeers != DefaultMaxPeers {
+		t.Errorf("unexpected defaults: %+v", s.cfg)
+	}
+	if id := s.PeerID(); !strings.HasPrefix(string(id[:]), peerid.Prefix) {
+		t.Errorf("PeerID() = %q, want prefix %q", id, peerid.Prefix)
+	}
+
+	other, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.PeerID() == s.PeerID() {
+		t.Error("expected distinct generated peer IDs")
+	}
+}
+
+// TestAddTorrent verifies adding, looking up and removing torrents.
+func TestAddTorrent(t *testing.T) {
+	s, err := New(Config{DownloadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mi := createTorrent(t, []byte("some content"))
+
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatalf("AddTorrent() returned error: %v", err)
+	}
+	if got := tor.Stats().State; got != StateStopped {
+		t.Errorf("state = %v, want stopped", got)
+	}
+	if s.Torrent(mi.InfoHash) != tor || len(s.Torrents()) != 1 {
+		t.Error("expected the torrent to be registered")
+	}
+	if _, err := s.AddTorrent(mi); err == nil {
+		t.Error("expected error adding the torrent twice")
+	}
+
+	if err := s.RemoveTorrent(mi.InfoHash); err != nil {
+		t.Fatalf("RemoveTorrent() returned error: %v", err)
+	}
+	if s.Torrent(mi.InfoHash) != nil {
+		t.Error("expected the torrent to be removed")
+	}
+	if err := s.RemoveTorrent(mi.InfoHash); err == nil {
+		t.Error("expected error removing an unknown torrent")
+	}
+
+	v2Only := &torrent.MetaInfo{Info: mi.Info}
+	if _, err := s.AddTorrent(v2Only); err == nil {
+		t.Error("expected error adding a torrent without a v1 info hash")
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+	if _, err := s.AddTorrent(mi); err == nil {
+		t.Error("expected error adding a torrent to a closed session")
+	}
+}
+
+// TestAddMagnet fetches the metadata of a torrent from the peer returned by the tracker of
+// a magnet link and downloads its content.
+func TestAddMagnet(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	seed := newSeeder(t, mi, content)
+	magnet := mi.Magnet()
+	magnet.Trackers = []string{newTracker(t, seed.addr())}
+
+	s, err := New(Config{DownloadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tor, err := s.AddMagnet(ctx, magnet.String())
+	if err != nil {
+		t.Fatalf("AddMagnet() returned error: %v", err)
+	}
+	if got := tor.MetaInfo(); got.InfoHash != mi.InfoHash || got.Info.NumPieces() != mi.Info.NumPieces() {
+		t.Fatalf("unexpected metadata for %x with %d pieces", got.InfoHash, got.Info.NumPieces())
+	}
+	if _, err := s.AddMagnet(ctx, magnet.String()); err == nil {
+		t.Error("expected error adding the magnet link twice")
+	}
+
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	waitDone(t, tor)
+}
+
+// TestShutdown stops a torrent whose tracker answers and one whose tracker hangs: the
+// 'stopped' announce reaches the first, the deadline cuts the second short, and both
+// torrents save their resume files.
+func TestShutdown(t *testing.T) {
+	events := make(chan string, 8)
+	answering := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.URL.Query().Get("event")
+		w.Write(trackertest.AnnounceResponseBytes(1800, nil, true))
+	}))
+	defer answering.Close()
+	hanging := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hanging.Close()
+
+	cfg := Config{DownloadDir: t.TempDir(), ResumeDir: t.TempDir()}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	answered := createTorrent(t, []byte("answered"))
+	answered.Announce = answering.URL + "/announce"
+	hung := createTorrent(t, []byte("hung"))
+	hung.Announce = hanging.URL + "/announce"
+	for _, mi := range []*torrent.MetaInfo{answered, hung} {
+		tor, err := s.AddTorrent(mi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tor.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if event := <-events; event != "started" {
+		t.Fatalf("first announce event = %q, want started", event)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown() returned error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > stopAnnounceTimeout/2 {
+		t.Errorf("Shutdown() took %v despite the deadline", elapsed)
+	}
+	select {
+	case event := <-events:
+		if event != "stopped" {
+			t.Errorf("last announce event = %q, want stopped", event)
+		}
+	default:
+		t.Error("no stopped announce was sent")
+	}
+	for _, mi := range []*torrent.MetaInfo{answered, hung} {
+		if _, err := os.Stat(resume.Path(cfg.ResumeDir, mi.InfoHash)); err != nil {
+			t.Errorf("resume file of %s not saved: %v", mi.Info.Name, err)
+		}
+	}
+}
+
+// TestRates checks that the configured rates and schedule apply, and that SetRates replaces
+// them at once.
+func TestRates(t *testing.T) {
+	allDay, err := ratelimit.ParseSchedule("daily 00:00-24:00 up=4KiB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{DownloadRate: 1 << 20, UploadRate: 1 << 10, Schedule: allDay})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if got, want := s.CurrentRates(), (ratelimit.Rates{Download: 1 << 20, Upload: 4 << 10}); got != want {
+		t.Errorf("CurrentRates() = %+v, want %+v", got, want)
+	}
+
+	s.SetRates(ratelimit.Rates{Upload: 2 << 10}, nil)
+	if got, want := s.CurrentRates(), (ratelimit.Rates{Upload: 2 << 10}); got != want {
+		t.Errorf("CurrentRates() after SetRates() = %+v, want %+v", got, want)
+	}
+	if base, schedule := s.Rates(); base.Upload != 2<<10 || schedule != nil {
+		t.Errorf("Rates() = %+v, %v, want the rates set", base, schedule)
+	}
+}
@@ -0,0 +1,1446 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/choke"
+	"github.com/lcsabi/gobit/internal/holepunch"
+	"github.com/lcsabi/gobit/internal/ipfilter"
+	"github.com/lcsabi/gobit/internal/metadata"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/peerid"
+	"github.com/lcsabi/gobit/internal/pex"
+	"github.com/lcsabi/gobit/internal/picker"
+	"github.com/lcsabi/gobit/internal/resume"
+	"github.com/lcsabi/gobit/internal/storage"
+	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/internal/tracker"
+	"github.com/lcsabi/gobit/internal/webseed"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// announce timing
+const (
+	defaultAnnounceInterval = 30 * time.Minute // used when a tracker sends no interval
+	announceRetryInterval   = time.Minute      // wait after every tracker failed
+	stopAnnounceTimeout     = 5 * time.Second  // bound on the 'stopped' announce
+)
+
+// maxRequestLength is the largest block a peer may request from us.
+const maxRequestLength = 2 * torrent.BlockSize
+
+// pexInterval is the time between two PEX messages to the same peer, shortened by tests.
+var pexInterval = pex.DefaultInterval
+
+// rechokeInterval is the time between two periodic rechokes, shortened by tests.
+var rechokeInterval = choke.DefaultRechokeInterval
+
+// web seed usage
+const (
+	webSeedMaxPeers      = 5                // web seeds are only used with fewer connected peers
+	webSeedIdleInterval  = 10 * time.Second // wait while the web seed is not needed
+	webSeedRetryInterval = time.Minute      // wait after a failed web seed request
+)
+
+// State is the lifecycle state of a Torrent.
+type State int
+
+const (
+	StateStopped     State = iota // not running, the initial state
+	StateDownloading              // running with pieces missing
+	StateSeeding                  // running with every piece downloaded
+	StatePaused                   // not connected to peers, but still known to the trackers
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStopped:
+		return "stopped"
+	case StateDownloading:
+		return "downloading"
+	case StateSeeding:
+		return "seeding"
+	case StatePaused:
+		return "paused"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Stats is a snapshot of the progress of a Torrent.
+type Stats struct {
+	State      State
+	NumPieces  int   // number of pieces in the torrent
+	Have       int   // number of verified pieces
+	Left       int64 // bytes still to download
+	Downloaded int64 // payload bytes received from peers since the torrent was added, including previous runs with fast resume
+	Uploaded   int64 // payload bytes sent to peers since the torrent was added, including previous runs with fast resume
+	Peers      int   // number of connected peers
+
+	// Ratio is the number of bytes uploaded per byte downloaded, counting the whole content
+	// as downloaded if it was already on disk.
+	Ratio       float64
+	SeedingTime time.Duration // time spent seeding, including previous runs with fast resume
+}
+
+// Progress returns the percentage of verified pieces.
+func (s Stats) Progress() float64 {
+	if s.NumPieces == 0 {
+		return 0
+	}
+	return float64(s.Have) * 100 / float64(s.NumPieces)
+}
+
+// Torrent is a torrent added to a Session. Its methods are safe for concurrent use.
+//
+// A Torrent starts out stopped. Start checks the content already on disk and then downloads
+// the missing pieces, seeding once it is complete. Pause disconnects from the peers while
+// keeping the downloaded state, Stop also tells the trackers the torrent is gone.
+type Torrent struct {
+	session  *Session
+	meta     *torrent.MetaInfo
+	metadata []byte // bencoded info dictionary served to peers, nil if it cannot be reproduced
+	trackers *tracker.AnnounceList
+	logger   *slog.Logger
+	peerLog  *slog.Logger // passed to peer connections
+
+	control sync.Mutex     // serializes Start, Pause and Stop
+	wg      sync.WaitGroup // goroutines of the current run
+	writes  sync.WaitGroup // blocks queued for writing and the verifications they start
+
+	chokeMu sync.Mutex   // serializes rechokes
+	choker  choke.Choker // guarded by chokeMu
+
+	mu         sync.Mutex
+	state      State
+	have       torrent.Bitfield
+	haveCount  int
+	downloaded int64
+	uploaded   int64
+	trackerID  string
+	peers      map[string]*peer.PeerConn // connections by address, nil while dialing
+	transfers  map[string]*transfer      // transfer statistics of the connected peers by address
+	picker     *picker.Picker            // nil until the first Start
+	storage    *storage.Storage          // nil while stopped
+	ctx        context.Context           // context of the current run, nil when not running
+	cancel     context.CancelFunc        // stops the current run, nil when not running
+	resume     *resume.Data              // state of the previous run used by the next open, nil if unknown
+
+	writing   map[int]*pendingWrites         // blocks of the pieces being written, by piece index
+	hashWaits map[peer.HashRequest]*hashWait // failed pieces waiting for block hashes, by request
+
+	contentDir    string // directory of the content found by open, the download directory if empty
+	contentSuffix string // suffix of the file names of the content found by open
+
+	seedLimits       *SeedLimits   // limits set by SetSeedLimits, nil to use those of the session
+	seedingTime      time.Duration // time spent seeding until seedingSince
+	seedingSince     time.Time     // when the torrent started seeding, zero if it is not seeding
+	seedLimitReached bool          // whether the current run reached a seed limit
+
+	done     chan struct{} // closed once every piece is verified
+	doneOnce sync.Once
+}
+
+func newTorrent(s *Session, mi *torrent.MetaInfo) *Torrent {
+	return &Torrent{
+		session:   s,
+		meta:      mi,
+		metadata:  encodeMetadata(mi),
+		trackers:  tracker.NewAnnounceList(trackerTiers(mi)),
+		logger:    s.logger.With("torrent", mi.Info.Name),
+		peerLog:   s.peerLogger().With("torrent", mi.Info.Name),
+		have:      torrent.NewBitfield(mi.Info.NumPieces()),
+		choker:    s.cfg.NewChoker(),
+		peers:     make(map[string]*peer.PeerConn),
+		transfers: make(map[string]*transfer),
+		writing:   make(map[int]*pendingWrites),
+		hashWaits: make(map[peer.HashRequest]*hashWait),
+		done:      make(chan struct{}),
+	}
+}
+
+// transfer holds the payload transferred with a connected peer, for choking decisions, and how
+// the peer connected.
+type transfer struct {
+	connectedAt  time.Time
+	inbound      bool      // whether the peer connected to us, from a port it may not listen on
+	lastReceived time.Time // when the peer last sent us a block, zero if never
+	downloaded   int64     // payload bytes received from the peer
+	uploaded     int64     // payload bytes sent to the peer
+
+	// rates over the last rechoke interval, and the counters they were computed from
+	downloadRate, uploadRate     float64
+	rateDownloaded, rateUploaded int64
+}
+
+// pendingWrites tracks the blocks of a piece queued for writing, so the piece is verified once
+// the last of them is on disk.
+type pendingWrites struct {
+	blocks   int  // blocks queued and not yet written
+	complete bool // whether every block of the piece was received
+	failed   bool // whether a block could not be written, abandoning the piece
+}
+
+// encodeMetadata returns the bencoded info dictionary of mi, or nil if re-encoding it does not
+// reproduce the info hash, in which case it must not be served to peers.
+func encodeMetadata(mi *torrent.MetaInfo) []byte {
+	info, err := mi.Info.ToDictionary()
+	if err != nil {
+		return nil
+	}
+	encoded, err := bencode.Encode(info)
+	if err != nil || sha1.Sum(encoded) != mi.InfoHash {
+		return nil
+	}
+	return encoded
+}
+
+// MetaInfo returns the torrent's metainfo.
+func (t *Torrent) MetaInfo() *torrent.MetaInfo {
+	return t.meta
+}
+
+// Done returns a channel that is closed once every piece has been downloaded and verified.
+func (t *Torrent) Done() <-chan struct{} {
+	return t.done
+}
+
+// Stats returns the current progress of the torrent.
+func (t *Torrent) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return Stats{
+		State:      t.state,
+		NumPieces:  t.meta.Info.NumPieces(),
+		Have:       t.haveCount,
+		Left:       t.left(),
+		Downloaded: t.downloaded,
+		Uploaded:   t.uploaded,
+		Peers:      t.connectedPeers(),
+
+		Ratio:       t.ratio(),
+		SeedingTime: t.seedingTimeAt(time.Now()),
+	}
+}
+
+// Trackers returns the status of the torrent's trackers, in the order they are tried.
+func (t *Torrent) Trackers() []tracker.Status {
+	return t.trackers.Status()
+}
+
+// PeerStats is a snapshot of a connection to a peer of a Torrent.
+type PeerStats struct {
+	Addr           string // address of the peer
+	Client         string // software of the peer, as identified from its peer ID
+	ConnectedAt    time.Time
+	Have           int     // number of pieces the peer has
+	Downloaded     int64   // payload bytes received from the peer
+	Uploaded       int64   // payload bytes sent to the peer
+	DownloadRate   float64 // bytes per second received over the last rechoke interval
+	UploadRate     float64 // bytes per second sent over the last rechoke interval
+	AmChoking      bool
+	AmInterested   bool
+	PeerChoking    bool
+	PeerInterested bool
+}
+
+// Peers returns the connected peers of the torrent, sorted by address.
+func (t *Torrent) Peers() []PeerStats {
+	numPieces := t.meta.Info.NumPieces()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	peers := make([]PeerStats, 0, len(t.peers))
+	for key, pc := range t.peers {
+		tr := t.transfers[key]
+		if pc == nil || tr == nil {
+			continue
+		}
+		client, _ := pc.Client()
+		peers = append(peers, PeerStats{
+			Addr:           key,
+			Client:         client.String(),
+			ConnectedAt:    tr.connectedAt,
+			Have:           pc.PeerBitfield().Count(numPieces),
+			Downloaded:     tr.downloaded,
+			Uploaded:       tr.uploaded,
+			DownloadRate:   tr.downloadRate,
+			UploadRate:     tr.uploadRate,
+			AmChoking:      pc.AmChoking(),
+			AmInterested:   pc.AmInterested(),
+			PeerChoking:    pc.PeerChoking(),
+			PeerInterested: pc.PeerInterested(),
+		})
+	}
+	slices.SortFunc(peers, func(a, b PeerStats) int { return strings.Compare(a.Addr, b.Addr) })
+	return peers
+}
+
+// Start starts or resumes the torrent. When starting from the stopped state, the content
+// already on disk is verified first, so only the missing pieces are downloaded.
+// Starting a running torrent does nothing.
+func (t *Torrent) Start() error {
+	t.control.Lock()
+	defer t.control.Unlock()
+
+	t.mu.Lock()
+	state := t.state
+	t.mu.Unlock()
+
+	event := tracker.EventNone
+	switch state {
+	case StateDownloading, StateSeeding:
+		return nil
+	case StateStopped:
+		if err := t.open(); err != nil {
+			return err
+		}
+		event = tracker.EventStarted
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.mu.Lock()
+	t.ctx, t.cancel = ctx, cancel
+	t.seedLimitReached = false
+	t.setState(StateDownloading)
+	if t.complete() {
+		t.setState(StateSeeding)
+		t.doneOnce.Do(func() {
+			close(t.done)
+			t.emit(Event{Type: EventTorrentCompleted})
+		})
+	}
+	alreadyComplete := t.complete()
+	t.mu.Unlock()
+	if alreadyComplete {
+		t.finish()
+	}
+
+	if len(t.trackers.Tiers()) > 0 {
+		t.wg.Add(1)
+		go t.announceLoop(ctx, event, alreadyComplete)
+	} else {
+		// without a DHT, peers of trackerless torrents can only come from web seeds and PEX
+		t.logger.Info("torrent has no trackers", "nodes", len(t.meta.Nodes))
+	}
+	for _, seedURL := range t.meta.URLList {
+		t.wg.Add(1)
+		go t.runWebSeed(ctx, "webseed", seedURL, func(ctx context.Context, index int, begin, length int64) ([]byte, error) {
+			return t.session.cfg.WebSeed.Fetch(ctx, seedURL, &t.meta.Info, index, begin, length)
+		})
+	}
+	for _, seedURL := range t.meta.HTTPSeeds {
+		t.wg.Add(1)
+		go t.runWebSeed(ctx, "httpseed", seedURL, func(ctx context.Context, index int, begin, length int64) ([]byte, error) {
+			return t.session.cfg.WebSeed.FetchHTTPSeed(ctx, seedURL, t.meta.InfoHash, &t.meta.Info, index, begin, length)
+		})
+	}
+	t.wg.Add(1)
+	go t.rechokeLoop(ctx)
+	t.logger.Info("torrent started", "state", t.Stats().State)
+	return nil
+}
+
+// Pause disconnects from every peer and stops announcing, keeping the downloaded state.
+// Start resumes the torrent. Pausing a torrent that is not running does nothing.
+func (t *Torrent) Pause() error {
+	t.control.Lock()
+	defer t.control.Unlock()
+
+	if !t.halt() {
+		return nil
+	}
+	t.mu.Lock()
+	t.setState(StatePaused)
+	t.mu.Unlock()
+	t.logger.Info("torrent paused")
+	return nil
+}
+
+// Stop disconnects from every peer, tells the trackers the torrent stopped and closes its
+// files. Stopping a stopped torrent does nothing.
+func (t *Torrent) Stop() error {
+	return t.stop(context.Background())
+}
+
+// stop stops the torrent like Stop, abandoning the 'stopped' announce once ctx is done.
+func (t *Torrent) stop(ctx context.Context) error {
+	t.control.Lock()
+	defer t.control.Unlock()
+
+	t.mu.Lock()
+	state := t.state
+	t.mu.Unlock()
+	if state == StateStopped {
+		return nil
+	}
+
+	t.halt()
+	ctx, cancel := context.WithTimeout(ctx, stopAnnounceTimeout)
+	defer cancel()
+	if _, _, err := t.trackers.Announce(ctx, t.session.cfg.Tracker, t.announceRequest(tracker.EventStopped)); err != nil {
+		t.logger.Debug("stopped announce failed", "error", err)
+	}
+
+	t.mu.Lock()
+	st := t.storage
+	t.storage = nil
+	t.setState(StateStopped)
+	t.mu.Unlock()
+	t.logger.Info("torrent stopped")
+	t.session.cache.Drop(st)
+	if err := st.Close(); err != nil {
+		return err
+	}
+	return t.SaveResume()
+}
+
+// SaveResume writes the resume file of the torrent, if the session keeps resume files.
+// It is done by Stop, and can be called while the torrent runs to bound the work lost if
+// the process does not shut down cleanly.
+func (t *Torrent) SaveResume() error {
+	dir := t.session.cfg.ResumeDir
+	if dir == "" {
+		return nil
+	}
+
+	t.mu.Lock()
+	data, err := resume.SnapshotFunc(t.meta, t.contentPath, t.have)
+	if err == nil {
+		data.Downloaded = t.downloaded
+		data.Uploaded = t.uploaded
+		data.SeedingTime = int64(t.seedingTimeAt(time.Now()) / time.Second)
+		data.TrackerID = t.trackerID
+		t.resume = data
+	}
+	t.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("saving resume data: %w", err)
+	}
+	if err := resume.Save(resume.Path(dir, t.meta.InfoHash), data); err != nil {
+		return fmt.Errorf("saving resume data: %w", err)
+	}
+	return nil
+}
+
+// loadResume restores the transfer counters and tracker ID from the resume file of the
+// torrent, keeping its verified pieces for open.
+func (t *Torrent) loadResume() {
+	dir := t.session.cfg.ResumeDir
+	if dir == "" {
+		return
+	}
+	data, err := resume.Load(resume.Path(dir, t.meta.InfoHash))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.logger.Warn("ignoring resume file", "error", err)
+		}
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.resume = data
+	t.downloaded = data.Downloaded
+	t.uploaded = data.Uploaded
+	t.seedingTime = time.Duration(data.SeedingTime) * time.Second
+	t.trackerID = data.TrackerID
+}
+
+// open locates the content on disk and verifies it, unless the resume data shows it did not
+// change since the previous run, and prepares the storage and the picker.
+func (t *Torrent) open() error {
+	dir, suffix := t.locate()
+	t.mu.Lock()
+	data := t.resume
+	t.resume = nil
+	t.mu.Unlock()
+
+	st, err := storage.NewWithOptions(&t.meta.Info, dir, storage.Options{Suffix: suffix, Allocation: t.session.cfg.Allocation})
+	if err != nil {
+		return err
+	}
+	var have torrent.Bitfield
+	if data != nil {
+		if err := data.CheckFunc(t.meta, st.Path); err != nil {
+			t.logger.Info("checking content, resume data not usable", "reason", err)
+		} else {
+			have = data.Bitfield()
+		}
+	}
+	if have == nil {
+		if have, err = st.Recheck(context.Background(), torrent.HashOptions{}); err != nil {
+			st.Close()
+			return fmt.Errorf("checking existing content: %w", err)
+		}
+	}
+	if err := st.Preallocate(); err != nil {
+		st.Close()
+		return fmt.Errorf("preallocating content: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.storage = st
+	t.contentDir, t.contentSuffix = dir, suffix
+	t.have = have
+	t.haveCount = have.Count(t.meta.Info.NumPieces())
+	t.picker = picker.New(&t.meta.Info, have, picker.Options{PipelineDepth: t.session.cfg.PipelineDepth})
+	return nil
+}
+
+// halt stops the current run and waits for its goroutines, reporting whether it was running.
+// t.control must be held.
+func (t *Torrent) halt() bool {
+	t.mu.Lock()
+	cancel := t.cancel
+	t.ctx, t.cancel = nil, nil
+	t.mu.Unlock()
+	if cancel == nil {
+		return false
+	}
+
+	cancel()
+	t.wg.Wait()
+	t.writes.Wait()
+
+	// the next run has a new picker, and asks for the hashes it needs itself
+	t.mu.Lock()
+	for _, wait := range t.hashWaits {
+		wait.timer.Stop()
+	}
+	clear(t.hashWaits)
+	t.mu.Unlock()
+	return true
+}
+
+// =====================================================================================
+
+// announceLoop announces to the trackers until ctx is cancelled, connecting to the returned
+// peers. It announces 'completed' as soon as the download completes, unless it already was.
+func (t *Torrent) announceLoop(ctx context.Context, event tracker.Event, alreadyComplete bool) {
+	defer t.wg.Done()
+
+	completed := t.done
+	if alreadyComplete {
+		completed = nil
+	}
+	for {
+		resp, trackerURL, err := t.trackers.Announce(ctx, t.session.cfg.Tracker, t.announceRequest(event))
+		wait := announceRetryInterval
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			t.logger.Warn("announce failed", "error", err)
+			t.emit(Event{Type: EventAnnounce, Err: err})
+		} else {
+			t.emit(Event{Type: EventAnnounce, Tracker: trackerURL, NumPeers: len(resp.Peers)})
+			event = tracker.EventNone
+			wait = resp.Interval
+			if wait <= 0 {
+				wait = defaultAnnounceInterval
+			}
+			t.mu.Lock()
+			if resp.TrackerID != "" {
+				t.trackerID = resp.TrackerID
+			}
+			t.mu.Unlock()
+			addrs := make([]netip.AddrPort, len(resp.Peers))
+			for i, p := range resp.Peers {
+				addrs[i] = p.Addr
+			}
+			t.connectAll(ctx, addrs)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-completed:
+			timer.Stop()
+			completed = nil
+			event = tracker.EventCompleted
+		case <-timer.C:
+		}
+	}
+}
+
+// trackerTiers returns the tiers to announce to: the announce-list, or the announce URL alone.
+func trackerTiers(mi *torrent.MetaInfo) [][]string {
+	if len(mi.AnnounceList) > 0 {
+		return mi.AnnounceList
+	}
+	if mi.Announce == "" {
+		return nil
+	}
+	return [][]string{{mi.Announce}}
+}
+
+func (t *Torrent) announceRequest(event tracker.Event) tracker.AnnounceRequest {
+	port := t.session.announcePort() // taken first, the session lock must not be acquired under t.mu
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return tracker.AnnounceRequest{
+		InfoHash:   t.meta.InfoHash,
+		PeerID:     t.session.cfg.PeerID,
+		Port:       port,
+		Uploaded:   t.uploaded,
+		Downloaded: t.downloaded,
+		Left:       t.left(),
+		Event:      event,
+		TrackerID:  t.trackerID,
+		IPv6:       t.session.cfg.IPv6,
+	}
+}
+
+// connectAll connects to the peers at addrs, in the order of the session's address family
+// preference.
+func (t *Torrent) connectAll(ctx context.Context, addrs []netip.AddrPort) {
+	for _, addr := range t.session.cfg.AddressFamily.order(addrs) {
+		t.connect(ctx, addr)
+	}
+}
+
+// connect starts a connection to the peer at addr, unless it is already connected, the
+// connection limit is reached, or the session's address family or IP filter excludes it.
+func (t *Torrent) connect(ctx context.Context, addr netip.AddrPort) {
+	t.connectThrough(ctx, addr, "")
+}
+
+// connectThrough connects to the peer at addr like connect. If the connection fails and relay
+// is not empty, the connected peer known by relay is asked to punch a hole to the peer.
+func (t *Torrent) connectThrough(ctx context.Context, addr netip.AddrPort, relay string) {
+	if !t.session.cfg.AddressFamily.allows(addr.Addr()) {
+		return
+	}
+	if !t.session.cfg.IPFilter.Allow(addr.Addr(), ipfilter.Outbound) {
+		t.logger.Debug("not connecting to blocked peer", "peer", addr.String())
+		return
+	}
+	addr = netip.AddrPortFrom(addr.Addr().Unmap(), addr.Port()) // one key per peer, however it was reported
+	key := addr.String()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.peers[key]; ok || len(t.peers) >= t.session.MaxPeers() {
+		return
+	}
+
+	t.peers[key] = nil
+	t.wg.Add(1)
+	go t.runPeer(ctx, addr, relay)
+}
+
+// runPeer connects to the peer at addr and exchanges messages with it until the connection
+// fails or ctx is cancelled. A failed connection is retried through the holepunch relay known
+// by relay, if not empty.
+func (t *Torrent) runPeer(ctx context.Context, addr netip.AddrPort, relay string) {
+	defer t.wg.Done()
+	key := addr.String()
+
+	pc, err := peer.Dial(ctx, addr, t.peerConfig(key))
+	if err != nil {
+		t.logger.Debug("connecting to peer failed", "peer", key, "error", err)
+		t.mu.Lock()
+		delete(t.peers, key)
+		t.mu.Unlock()
+		if relay != "" && ctx.Err() == nil {
+			t.rendezvous(relay, addr)
+		}
+		return
+	}
+	t.servePeer(ctx, pc, key, false)
+}
+
+// peerConfig returns the configuration of the connection to the peer known by key.
+func (t *Torrent) peerConfig(key string) peer.Config {
+	return peer.Config{
+		InfoHash:   t.meta.InfoHash,
+		PeerID:     t.session.cfg.PeerID,
+		Reserved:   t.reserved(),
+		NumPieces:  t.meta.Info.NumPieces(),
+		Encryption: t.session.cfg.Encryption,
+		Logger:     t.peerLog.With("peer", key),
+	}
+}
+
+// serveIncoming answers an inbound connection whose handshake, remote, names the torrent and
+// exchanges messages with the peer until the connection fails or the torrent stops. The
+// connection is closed with an error if the torrent is not running, its address is in use by
+// a peer we dialed or the connection limit is reached.
+func (t *Torrent) serveIncoming(conn net.Conn, remote peer.Handshake) error {
+	key := conn.RemoteAddr().String()
+	t.mu.Lock()
+	ctx := t.ctx
+	_, taken := t.peers[key] // only by a peer we dialed; duplicate peers are dropped by servePeer
+	var err error
+	switch {
+	case ctx == nil:
+		err = errors.New("torrent is not running")
+	case taken:
+		err = errors.New("address is already in use by a peer")
+	case len(t.peers) >= t.session.MaxPeers():
+		err = errors.New("too many peers")
+	}
+	if err != nil {
+		t.mu.Unlock()
+		conn.Close()
+		return err
+	}
+	t.peers[key] = nil // reserved while handshaking, like dialed peers
+	t.wg.Add(1)
+	t.mu.Unlock()
+	defer t.wg.Done()
+
+	pc, err := peer.AcceptPeerConn(conn, remote, t.peerConfig(key))
+	if err != nil {
+		conn.Close()
+		t.mu.Lock()
+		delete(t.peers, key)
+		t.mu.Unlock()
+		return err
+	}
+	t.servePeer(ctx, pc, key, true)
+	return nil
+}
+
+// servePeer exchanges messages with the connected peer known by key, which connected to us if
+// inbound is set, until the connection fails or ctx is cancelled, closing it afterwards. A peer
+// connected twice, by its peer ID, keeps only one of its connections.
+func (t *Torrent) servePeer(ctx context.Context, pc *peer.PeerConn, key string, inbound bool) {
+	logger := t.logger.With("peer", key)
+	t.mu.Lock()
+	duplicate, keep := t.duplicateOf(pc, inbound)
+	if duplicate != nil && !keep {
+		delete(t.peers, key) // the reservation of the connection
+		t.mu.Unlock()
+		pc.Close()
+		logger.Debug("dropping duplicate connection to peer")
+		return
+	}
+	t.peers[key] = pc
+	t.transfers[key] = &transfer{connectedAt: time.Now(), inbound: inbound}
+	have := bytes.Clone(t.have)
+	haveCount := t.haveCount
+	t.mu.Unlock()
+	if duplicate != nil {
+		logger.Debug("replacing duplicate connection to peer")
+		duplicate.Close() // its own loop forgets it
+	}
+
+	var reason error // why the peer was dropped, nil if the torrent stopped
+	defer func() {
+		t.mu.Lock()
+		delete(t.peers, key)
+		delete(t.transfers, key)
+		t.mu.Unlock()
+		t.picker.RemovePeer(key)
+		t.emit(Event{Type: EventPeerDisconnected, Peer: key, Err: reason})
+	}()
+	defer pc.Close()
+	client, _ := pc.Client()
+	logger.Debug("connected to peer", "client", client.String())
+	t.emit(Event{Type: EventPeerConnected, Peer: key, Client: client.String()})
+
+	t.picker.AddPeer(key, nil)
+	if peer.SupportsExtensions(pc.Reserved()) {
+		if err := t.sendExtensionHandshake(pc); err != nil {
+			logger.Debug("sending extension handshake failed", "error", err)
+			reason = err
+			return
+		}
+	}
+	if haveCount > 0 {
+		if err := pc.Send(peer.NewBitfield(have)); err != nil {
+			logger.Debug("sending bitfield failed", "error", err)
+			reason = err
+			return
+		}
+	}
+
+	var pexState pex.State
+	pexTicker := time.NewTicker(pexInterval)
+	defer pexTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-pexTicker.C:
+			if err := t.sendPEX(pc, key, &pexState); err != nil {
+				logger.Debug("sending PEX failed", "error", err)
+				reason = err
+				return
+			}
+		case m, ok := <-pc.Messages():
+			if !ok {
+				logger.Debug("peer disconnected", "error", pc.Err())
+				reason = pc.Err()
+				return
+			}
+			if err := t.handleMessage(ctx, pc, key, m); err != nil {
+				logger.Debug("dropping peer", "error", err)
+				reason = err
+				return
+			}
+		}
+	}
+}
+
+// duplicateOf returns the other connection to the peer of pc, which connected to us if inbound
+// is set, and whether pc should be kept instead of it. When two peers connect to each other at
+// the same time, both keep the connection dialed by the one with the lower peer ID; otherwise
+// the connection made first is kept. It returns nil if the peer has no other connection. t.mu
+// must be held.
+func (t *Torrent) duplicateOf(pc *peer.PeerConn, inbound bool) (*peer.PeerConn, bool) {
+	id := pc.PeerID()
+	for key, other := range t.peers {
+		if other == nil || other == pc || other.PeerID() != id {
+			continue
+		}
+		tr := t.transfers[key]
+		if tr == nil || tr.inbound == inbound {
+			return other, false
+		}
+		ours := t.session.cfg.PeerID
+		keepDialed := bytes.Compare(ours[:], id[:]) < 0
+		return other, inbound != keepDialed
+	}
+	return nil, false
+}
+
+// handleMessage reacts to a message from the peer, after PeerConn updated its state.
+func (t *Torrent) handleMessage(ctx context.Context, pc *peer.PeerConn, key string, m *peer.Message) error {
+	switch m.ID {
+	case peer.MsgBitfield:
+		t.picker.AddPeer(key, pc.PeerBitfield())
+		return t.updateInterest(pc, key)
+	case peer.MsgHave:
+		index, err := m.ParseHave()
+		if err != nil {
+			return err
+		}
+		if err := t.picker.PeerHave(key, int(index)); err != nil {
+			return err
+		}
+		return t.updateInterest(pc, key)
+	case peer.MsgUnchoke:
+		return t.requestBlocks(pc, key)
+	case peer.MsgChoke:
+		// the peer discards our outstanding requests, so hand them to other peers
+		t.picker.RemovePeer(key)
+		t.picker.AddPeer(key, pc.PeerBitfield())
+	case peer.MsgInterested, peer.MsgNotInterested:
+		// hand a free upload slot to the peer right away, or its slot to another peer
+		t.rechoke()
+	case peer.MsgRequest:
+		return t.serveBlock(ctx, pc, key, m)
+	case peer.MsgPiece:
+		// holding back the next message until the block fits the download rate stops
+		// reading from the connection, which slows the peer down
+		if err := t.session.download.WaitN(ctx, len(m.Payload)); err != nil {
+			return nil // the torrent stopped
+		}
+		return t.receiveBlock(ctx, pc, key, m)
+	case peer.MsgExtended:
+		return t.handleExtended(ctx, pc, key, m)
+	case peer.MsgHashRequest:
+		return t.serveHashes(pc, m)
+	case peer.MsgHashes:
+		return t.receiveHashes(m)
+	case peer.MsgHashReject:
+		return t.hashesRejected(m)
+	}
+	return nil
+}
+
+// sendExtensionHandshake advertises the extensions we support to the peer.
+func (t *Torrent) sendExtensionHandshake(pc *peer.PeerConn) error {
+	h := peer.ExtensionHandshake{
+		M:       map[string]int64{},
+		Version: peerid.ClientName + " " + peerid.Version,
+		Port:    int64(t.session.announcePort()),
+	}
+	if t.metadata != nil {
+		h.M[metadata.ExtensionName] = metadata.LocalID
+		h.MetadataSize = int64(len(t.metadata))
+	}
+	if !t.meta.Info.IsPrivate() {
+		h.M[pex.ExtensionName] = pex.LocalID
+		h.M[holepunch.ExtensionName] = holepunch.LocalID
+	}
+	m, err := peer.NewExtensionHandshake(h)
+	if err != nil {
+		return err
+	}
+	return pc.Send(m)
+}
+
+// handleExtended answers the metadata requests and holepunch messages of the peer known by
+// key, and connects to the peers it shares through PEX.
+func (t *Torrent) handleExtended(ctx context.Context, pc *peer.PeerConn, key string, m *peer.Message) error {
+	id, payload, err := m.ParseExtended()
+	if err != nil {
+		return err
+	}
+	switch id {
+	case metadata.LocalID:
+		return t.answerMetadata(pc, payload)
+	case pex.LocalID:
+		if t.meta.Info.IsPrivate() {
+			return nil // peers of private torrents come from the trackers only
+		}
+		exchange, err := pex.Parse(payload)
+		if err != nil {
+			return err
+		}
+		_, relays := holepunchID(pc)
+		addrs := make([]netip.AddrPort, len(exchange.Added))
+		holepunched := make(map[netip.AddrPort]bool)
+		for i, p := range exchange.Added {
+			addrs[i] = p.Addr
+			holepunched[p.Addr] = relays && p.Flags&pex.FlagHolepunch != 0
+		}
+		for _, addr := range t.session.cfg.AddressFamily.order(addrs) {
+			relay := ""
+			if holepunched[addr] {
+				relay = key
+			}
+			t.connectThrough(ctx, addr, relay)
+		}
+	case holepunch.LocalID:
+		if t.meta.Info.IsPrivate() {
+			return nil // like PEX, holepunching would connect to peers not from the trackers
+		}
+		return t.handleHolepunch(ctx, pc, key, payload)
+	}
+	return nil
+}
+
+// answerMetadata answers a ut_metadata message of the peer.
+func (t *Torrent) answerMetadata(pc *peer.PeerConn, payload []byte) error {
+	if t.metadata == nil {
+		return nil
+	}
+	remote, _ := pc.PeerExtensions()
+	remoteID, ok := remote.ExtensionID(metadata.ExtensionName)
+	if !ok {
+		return nil
+	}
+
+	reply, err := metadata.Answer(payload, remoteID, t.metadata)
+	if err != nil || reply == nil {
+		return err
+	}
+	return pc.Send(reply)
+}
+
+// sendPEX tells the peer about the peers connected or disconnected since the previous call,
+// if it supports PEX and the torrent is not private.
+func (t *Torrent) sendPEX(pc *peer.PeerConn, key string, state *pex.State) error {
+	if t.meta.Info.IsPrivate() {
+		return nil
+	}
+	remote, _ := pc.PeerExtensions()
+	remoteID, ok := remote.ExtensionID(pex.ExtensionName)
+	if !ok {
+		return nil
+	}
+
+	numPieces := t.meta.Info.NumPieces()
+	var current []pex.Peer
+	t.mu.Lock()
+	for id, other := range t.peers {
+		if other == nil || id == key {
+			continue
+		}
+		addr, dialed, ok := t.listenAddr(id, other)
+		if !ok {
+			continue
+		}
+		p := pex.Peer{Addr: addr}
+		if dialed {
+			p.Flags |= pex.FlagReachable
+		}
+		if other.PeerBitfield().Count(numPieces) == numPieces {
+			p.Flags |= pex.FlagSeed
+		}
+		if _, ok := holepunchID(other); ok {
+			p.Flags |= pex.FlagHolepunch
+		}
+		current = append(current, p)
+	}
+	t.mu.Unlock()
+
+	exchange := state.Update(current)
+	if exchange.Empty() {
+		return nil
+	}
+	m, err := pex.NewMessage(remoteID, exchange)
+	if err != nil {
+		return err
+	}
+	return pc.Send(m)
+}
+
+// listenAddr returns the address the connected peer known by key accepts connections on, and
+// whether we dialed it there. The peers we dialed accept connections on their address; those
+// that connected to us did so from another port than the one they listen on, if they listen
+// at all, and it returns false if their extension handshake names none. t.mu must be held.
+func (t *Torrent) listenAddr(key string, pc *peer.PeerConn) (addr netip.AddrPort, dialed, ok bool) {
+	addr, err := netip.ParseAddrPort(key)
+	if err != nil {
+		return netip.AddrPort{}, false, false
+	}
+	if tr := t.transfers[key]; tr == nil || !tr.inbound {
+		return addr, true, true
+	}
+	remote, _ := pc.PeerExtensions()
+	if remote.Port <= 0 || remote.Port > 0xffff {
+		return netip.AddrPort{}, false, false
+	}
+	return netip.AddrPortFrom(addr.Addr(), uint16(remote.Port)), false, true
+}
+
+// updateInterest tells the peer whether we want any of its pieces and requests blocks if so.
+func (t *Torrent) updateInterest(pc *peer.PeerConn, key string) error {
+	interesting := t.picker.Interesting(key)
+	switch {
+	case interesting && !pc.AmInterested():
+		if err := pc.Interested(); err != nil {
+			return err
+		}
+	case !interesting && pc.AmInterested():
+		return pc.NotInterested()
+	}
+	return t.requestBlocks(pc, key)
+}
+
+// requestBlocks fills the request pipeline of the peer, unless it is choking us.
+func (t *Torrent) requestBlocks(pc *peer.PeerConn, key string) error {
+	if pc.PeerChoking() {
+		return nil
+	}
+	for _, block := range t.picker.Next(key) {
+		if err := pc.Send(peer.NewRequest(uint32(block.Piece), uint32(block.Begin), uint32(block.Length))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// receiveBlock stores a block sent by the peer and requests the next ones.
+func (t *Torrent) receiveBlock(ctx context.Context, pc *peer.PeerConn, key string, m *peer.Message) error {
+	index, begin, data, err := m.ParsePiece()
+	if err != nil {
+		return err
+	}
+	block := picker.Block{Piece: int(index), Begin: int(begin), Length: len(data)}
+	t.storeBlock(ctx, key, block, data)
+	return t.requestBlocks(pc, key)
+}
+
+// storeBlock queues a block received from the peer or web seed identified by key for writing,
+// and cancels its duplicates requested from other peers. The piece is verified once its last
+// block is written. It waits while the disk queue is full; if ctx is cancelled first, the
+// piece is downloaded again.
+func (t *Torrent) storeBlock(ctx context.Context, key string, block picker.Block, data []byte) {
+	t.mu.Lock()
+	cancel, err := t.picker.BlockReceived(key, block)
+	if err != nil {
+		t.mu.Unlock()
+		// unrequested, or a late duplicate of a piece that is already verified
+		t.logger.Debug("ignoring block", "peer", key, "error", err)
+		return
+	}
+	pending := t.writing[block.Piece]
+	if pending == nil {
+		pending = &pendingWrites{}
+		t.writing[block.Piece] = pending
+	}
+	pending.blocks++
+	if t.picker.PieceComplete(block.Piece) {
+		pending.complete = true
+	}
+	st := t.storage
+	t.writes.Add(1)
+
+	t.downloaded += int64(len(data))
+	if tr := t.transfers[key]; tr != nil {
+		tr.downloaded += int64(len(data))
+		tr.lastReceived = time.Now()
+	}
+	var others []*peer.PeerConn
+	for _, id := range cancel {
+		if other := t.peers[id]; other != nil {
+			others = append(others, other)
+		}
+	}
+	t.mu.Unlock()
+	for _, other := range others {
+		// a failing peer is dropped by its own loop
+		other.Send(peer.NewCancel(uint32(block.Piece), uint32(block.Begin), uint32(block.Length)))
+	}
+
+	err = t.session.disk.Write(ctx, st, block.Piece, int64(block.Begin), data, func(err error) {
+		defer t.writes.Done()
+		t.blockWritten(block.Piece, pending, err)
+	})
+	if err != nil {
+		t.writes.Done()
+		t.abandonPiece(block.Piece, pending)
+	}
+}
+
+// blockWritten records that a block of the piece at index was written, with the given result,
+// and starts verifying the piece once all of its blocks are on disk. A failed write is reported
+// as an EventError event and the piece is downloaded again.
+func (t *Torrent) blockWritten(index int, pending *pendingWrites, err error) {
+	if err != nil {
+		t.logger.Warn("writing block failed", "piece", index, "error", err)
+		t.emit(Event{Type: EventError, Piece: index, Err: err})
+		t.abandonPiece(index, pending)
+		return
+	}
+
+	t.mu.Lock()
+	pending.blocks--
+	verify := pending.blocks == 0 && pending.complete && !pending.failed
+	if verify {
+		delete(t.writing, index)
+	}
+	t.mu.Unlock()
+	if !verify {
+		return
+	}
+	t.writes.Add(1)
+	go func() {
+		defer t.writes.Done()
+		if err := t.verifyPiece(index); err != nil {
+			t.logger.Warn("verifying piece failed", "piece", index, "error", err)
+		}
+	}()
+}
+
+// abandonPiece gives up on the blocks of the piece at index not written, scheduling the whole
+// piece for download again. The blocks of the piece still queued are ignored once written.
+func (t *Torrent) abandonPiece(index int, pending *pendingWrites) {
+	t.mu.Lock()
+	failed := pending.failed
+	pending.failed = true
+	if t.writing[index] == pending {
+		delete(t.writing, index)
+	}
+	t.mu.Unlock()
+	if !failed {
+		t.picker.PieceFailed(index)
+	}
+}
+
+// seedFetch downloads length bytes at offset begin within the piece at index from a web seed.
+type seedFetch func(ctx context.Context, index int, begin, length int64) ([]byte, error)
+
+// runWebSeed downloads pieces with fetch from the web seed at seedURL, of the given kind, until
+// the torrent completes or ctx is cancelled. The web seed takes part in piece picking like a
+// peer having every piece, so its blocks merge with those of the peers, but it is only used
+// while few peers are connected.
+func (t *Torrent) runWebSeed(ctx context.Context, kind, seedURL string, fetch seedFetch) {
+	defer t.wg.Done()
+	key := kind + " " + seedURL
+	logger := t.logger.With(kind, seedURL)
+
+	numPieces := t.meta.Info.NumPieces()
+	all := torrent.NewBitfield(numPieces)
+	for i := 0; i < numPieces; i++ {
+		all.Set(i)
+	}
+	t.picker.AddPeer(key, all)
+	defer t.picker.RemovePeer(key)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.done:
+			return
+		default:
+		}
+
+		t.mu.Lock()
+		needed := t.connectedPeers() < webSeedMaxPeers
+		t.mu.Unlock()
+		var blocks []picker.Block
+		if needed {
+			blocks = t.picker.Next(key)
+		}
+
+		wait := webSeedIdleInterval
+		if len(blocks) > 0 {
+			err := t.fetchWebSeed(ctx, key, fetch, blocks)
+			if err == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("web seed request failed", "error", err)
+			t.picker.AddPeer(key, all) // hands the outstanding blocks to the peers
+			wait = webSeedRetryInterval
+			var busy *webseed.BusyError
+			if errors.As(err, &busy) && busy.RetryAfter > 0 {
+				wait = busy.RetryAfter // as asked by an HTTP seed
+			}
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-t.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// fetchWebSeed downloads blocks with fetch, with a single request for each run of adjacent
+// blocks of the same piece, and stores them once they fit the download rate.
+func (t *Torrent) fetchWebSeed(ctx context.Context, key string, fetch seedFetch, blocks []picker.Block) error {
+	for start := 0; start < len(blocks); {
+		end := start + 1
+		for end < len(blocks) && blocks[end].Piece == blocks[start].Piece &&
+			blocks[end].Begin == blocks[end-1].Begin+blocks[end-1].Length {
+			end++
+		}
+
+		first, last := blocks[start], blocks[end-1]
+		length := last.Begin + last.Length - first.Begin
+		data, err := fetch(ctx, first.Piece, int64(first.Begin), int64(length))
+		if err != nil {
+			return err
+		}
+		// like the blocks of peers, holding back the next request slows the seed down
+		if err := t.session.download.WaitN(ctx, len(data)); err != nil {
+			return err
+		}
+		for _, block := range blocks[start:end] {
+			offset := block.Begin - first.Begin
+			t.storeBlock(ctx, key, block, data[offset:offset+block.Length])
+		}
+		start = end
+	}
+	return nil
+}
+
+// verifyPiece checks a completely downloaded piece, announcing it to every peer if it is valid
+// and scheduling it for download again otherwise.
+func (t *Torrent) verifyPiece(index int) error {
+	t.mu.Lock()
+	st := t.storage
+	t.mu.Unlock()
+
+	if err := st.VerifyPiece(index); err != nil {
+		if !errors.Is(err, torrent.ErrPieceHashMismatch) {
+			// the piece could not be read back: download it again rather than never
+			t.picker.PieceFailed(index)
+			t.emit(Event{Type: EventError, Piece: index, Err: err})
+			return err
+		}
+		t.logger.Warn("piece failed verification", "piece", index)
+		if !t.requestHashes(index) {
+			t.picker.PieceFailed(index)
+		}
+		t.emit(Event{Type: EventPieceFailed, Piece: index})
+		return nil
+	}
+	if err := t.picker.PieceVerified(index); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	if !t.have.Has(index) {
+		t.have.Set(index)
+		t.haveCount++
+	}
+	var peers []*peer.PeerConn
+	for _, pc := range t.peers {
+		if pc != nil {
+			peers = append(peers, pc)
+		}
+	}
+	complete := t.complete()
+	if complete && t.state == StateDownloading {
+		t.setState(StateSeeding)
+	}
+	t.mu.Unlock()
+
+	for _, pc := range peers {
+		pc.Send(peer.NewHave(uint32(index))) // a failing peer is dropped by its own loop
+	}
+	t.emit(Event{Type: EventPieceVerified, Piece: index})
+	if complete {
+		// moving the content may copy it to another device, which can take minutes
+		t.writes.Add(1)
+		go func() {
+			defer t.writes.Done()
+			t.finish()
+			t.doneOnce.Do(func() {
+				t.logger.Info("download complete")
+				close(t.done)
+				t.emit(Event{Type: EventTorrentCompleted})
+			})
+		}()
+	}
+	return nil
+}
+
+// serveBlock answers a request of the peer with a block of a piece we have, once it fits the
+// upload rate, ignoring requests while we choke the peer.
+func (t *Torrent) serveBlock(ctx context.Context, pc *peer.PeerConn, key string, m *peer.Message) error {
+	index, begin, length, err := m.ParseRequest()
+	if err != nil {
+		return err
+	}
+	if length > maxRequestLength {
+		return fmt.Errorf("requested block of %d bytes exceeds %d", length, maxRequestLength)
+	}
+
+	t.mu.Lock()
+	have := t.have.Has(int(index))
+	st := t.storage
+	t.mu.Unlock()
+	if pc.AmChoking() || !have {
+		return nil
+	}
+
+	block := make([]byte, length)
+	pieceSize := t.meta.Info.PieceSize(int(index))
+	if err := t.session.cache.ReadBlock(st, int(index), pieceSize, int64(begin), block); err != nil {
+		t.emit(Event{Type: EventError, Piece: int(index), Err: err})
+		return err
+	}
+	if err := t.session.upload.WaitN(ctx, len(block)); err != nil {
+		return nil // the torrent stopped
+	}
+	if err := pc.Send(peer.NewPiece(index, begin, block)); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.uploaded += int64(length)
+	if tr := t.transfers[key]; tr != nil {
+		tr.uploaded += int64(length)
+	}
+	t.mu.Unlock()
+	return nil
+}
+
+// rechokeLoop updates the transfer rates of the peers and rechokes them every rechokeInterval
+// until ctx is cancelled.
+func (t *Torrent) rechokeLoop(ctx context.Context) {
+	defer t.wg.Done()
+	ticker := time.NewTicker(rechokeInterval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			seconds := now.Sub(last).Seconds()
+			last = now
+			t.mu.Lock()
+			for _, tr := range t.transfers {
+				tr.downloadRate = float64(tr.downloaded-tr.rateDownloaded) / seconds
+				tr.uploadRate = float64(tr.uploaded-tr.rateUploaded) / seconds
+				tr.rateDownloaded, tr.rateUploaded = tr.downloaded, tr.uploaded
+			}
+			t.mu.Unlock()
+			t.rechoke()
+			t.checkSeedLimits(now)
+		}
+	}
+}
+
+// rechoke asks the choker which peers to upload to, and chokes or unchokes every connected
+// peer accordingly.
+func (t *Torrent) rechoke() {
+	t.chokeMu.Lock()
+	defer t.chokeMu.Unlock()
+
+	round := choke.Round{Now: time.Now()}
+	conns := make(map[string]*peer.PeerConn)
+	t.mu.Lock()
+	round.Seeding = t.complete()
+	for key, pc := range t.peers {
+		tr := t.transfers[key]
+		if pc == nil || tr == nil {
+			continue
+		}
+		conns[key] = pc
+		round.Peers = append(round.Peers, choke.Peer{
+			ID:           key,
+			Interested:   pc.PeerInterested(),
+			Unchoked:     !pc.AmChoking(),
+			DownloadRate: tr.downloadRate,
+			UploadRate:   tr.uploadRate,
+			LastReceived: tr.lastReceived,
+			ConnectedAt:  tr.connectedAt,
+		})
+	}
+	t.mu.Unlock()
+
+	unchoke := t.choker.Rechoke(round)
+	for key, pc := range conns {
+		// a failing peer is dropped by its own loop
+		switch wanted := slices.Contains(unchoke, key); {
+		case wanted && pc.AmChoking():
+			pc.Unchoke()
+		case !wanted && !pc.AmChoking():
+			pc.Choke()
+		}
+	}
+}
+
+// connectedPeers returns the number of peers with an established connection. t.mu must be held.
+func (t *Torrent) connectedPeers() int {
+	peers := 0
+	for _, pc := range t.peers {
+		if pc != nil {
+			peers++
+		}
+	}
+	return peers
+}
+
+// complete reports whether every piece is verified. t.mu must be held.
+func (t *Torrent) complete() bool {
+	return t.haveCount == t.meta.Info.NumPieces()
+}
+
+// left returns the number of bytes in pieces that are not verified yet. t.mu must be held.
+func (t *Torrent) left() int64 {
+	left := t.meta.Info.TotalLength()
+	for i := 0; i < t.meta.Info.NumPieces(); i++ {
+		if t.have.Has(i) {
+			left -= t.meta.Info.PieceSize(i)
+		}
+	}
+	return left
+}
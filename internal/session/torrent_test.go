@@ -0,0 +1,865 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/metadata"
+	"github.com/lcsabi/gobit/internal/peer"
+	"github.com/lcsabi/gobit/internal/pex"
+	"github.com/lcsabi/gobit/internal/storage"
+	"github.com/lcsabi/gobit/internal/torrent"
+	"github.com/lcsabi/gobit/internal/tracker"
+	"github.com/lcsabi/gobit/internal/tracker/trackertest"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// createTorrent writes content to a file named "content" in a temporary directory and returns
+// a torrent for it with 16 KiB pieces.
+func createTorrent(t *testing.T, content []byte) *torrent.MetaInfo {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "content")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mi, err := torrent.Create(path, torrent.CreateOptions{PieceLength: torrent.BlockSize})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	return mi
+}
+
+// testContent returns 3.5 pieces of 16 KiB of deterministic content.
+func testContent() []byte {
+	content := make([]byte, 3*torrent.BlockSize+torrent.BlockSize/2)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	return content
+}
+
+// seeder serves content to every peer connecting to it: it sends a full bitfield,
+// unchokes interested peers and answers their requests, including metadata requests.
+// It shares the addresses in pex with every peer and records the PEX messages it receives.
+type seeder struct {
+	listener net.Listener
+	mi       *torrent.MetaInfo
+	metadata []byte
+	content  []byte
+	pex      []netip.AddrPort
+	received chan pex.Message
+}
+
+func newSeeder(t *testing.T, mi *torrent.MetaInfo, content []byte) *seeder {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := mi.Info.ToDictionary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, err := bencode.Encode(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &seeder{listener: listener, mi: mi, metadata: encoded, content: content, received: make(chan pex.Message, 16)}
+	t.Cleanup(func() { listener.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *seeder) addr() netip.AddrPort {
+	return s.listener.Addr().(*net.TCPAddr).AddrPort()
+}
+
+func (s *seeder) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *seeder) handle(conn net.Conn) {
+	defer conn.Close()
+	if _, err := peer.ReadHandshake(conn); err != nil {
+		return
+	}
+	port := s.addr().Port() // seeders are told apart by their peer ID
+	local := peer.Handshake{Reserved: peer.ExtensionProtocol, InfoHash: s.mi.InfoHash, PeerID: [20]byte{'s', 'e', 'e', 'd', byte(port >> 8), byte(port)}}
+	if _, err := local.WriteTo(conn); err != nil {
+		return
+	}
+	handshake, err := peer.NewExtensionHandshake(peer.ExtensionHandshake{
+		M:            map[string]int64{metadata.ExtensionName: metadata.LocalID, pex.ExtensionName: pex.LocalID},
+		MetadataSize: int64(len(s.metadata)),
+	})
+	if err != nil {
+		return
+	}
+	if _, err := handshake.WriteTo(conn); err != nil {
+		return
+	}
+
+	bitfield := torrent.NewBitfield(s.mi.Info.NumPieces())
+	for i := 0; i < s.mi.Info.NumPieces(); i++ {
+		bitfield.Set(i)
+	}
+	if _, err := peer.NewBitfield(bitfield).WriteTo(conn); err != nil {
+		return
+	}
+	if len(s.pex) > 0 {
+		var exchange pex.Message
+		for _, addr := range s.pex {
+			exchange.Added = append(exchange.Added, pex.Peer{Addr: addr})
+		}
+		m, err := pex.NewMessage(pex.LocalID, exchange)
+		if err != nil {
+			return
+		}
+		if _, err := m.WriteTo(conn); err != nil {
+			return
+		}
+	}
+
+	for {
+		m, err := peer.ReadMessage(conn)
+		if err != nil {
+			return
+		}
+		if m == nil {
+			continue
+		}
+		switch m.ID {
+		case peer.MsgInterested:
+			if _, err := (&peer.Message{ID: peer.MsgUnchoke}).WriteTo(conn); err != nil {
+				return
+			}
+		case peer.MsgRequest:
+			index, begin, length, err := m.ParseRequest()
+			if err != nil {
+				return
+			}
+			start := int64(index)*s.mi.Info.PieceLength + int64(begin)
+			block := s.content[start : start+int64(length)]
+			if _, err := peer.NewPiece(index, begin, block).WriteTo(conn); err != nil {
+				return
+			}
+		case peer.MsgExtended:
+			// every client in these tests uses the same IDs as the seeder
+			id, payload, err := m.ParseExtended()
+			if err != nil {
+				return
+			}
+			if id == pex.LocalID {
+				exchange, err := pex.Parse(payload)
+				if err != nil {
+					return
+				}
+				select {
+				case s.received <- exchange:
+				default:
+				}
+				continue
+			}
+			reply, err := metadata.Answer(payload, metadata.LocalID, s.metadata)
+			if err != nil {
+				return
+			}
+			if reply != nil {
+				if _, err := reply.WriteTo(conn); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// newTracker returns the URL of a tracker answering every announce with the given peers.
+func newTracker(t *testing.T, peers ...netip.AddrPort) string {
+	t.Helper()
+	var list []tracker.Peer
+	for _, addr := range peers {
+		list = append(list, tracker.Peer{Addr: addr})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(trackertest.AnnounceResponseBytes(1800, list, true))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/announce"
+}
+
+// waitDone waits for the torrent to complete, failing the test after a timeout.
+func waitDone(t *testing.T, tor *Torrent) {
+	t.Helper()
+	select {
+	case <-tor.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatalf("download did not complete, stats: %+v", tor.Stats())
+	}
+}
+
+// TestDownload downloads a torrent from a seeder found through the tracker.
+func TestDownload(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	seed := newSeeder(t, mi, content)
+	mi.Announce = newTracker(t, seed.addr())
+
+	dir := t.TempDir()
+	s, err := New(Config{DownloadDir: dir, PipelineDepth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	waitDone(t, tor)
+
+	stats := tor.Stats()
+	if stats.State != StateSeeding || stats.Have != 4 || stats.Left != 0 || stats.Progress() != 100 {
+		t.Errorf("unexpected stats after completion: %+v", stats)
+	}
+	if stats.Downloaded != int64(len(content)) {
+		t.Errorf("Downloaded = %d, want %d", stats.Downloaded, len(content))
+	}
+	trackers := tor.Trackers()
+	if len(trackers) != 1 || trackers[0].URL != mi.Announce || trackers[0].LastError != nil ||
+		trackers[0].NextAnnounce != trackers[0].LastAnnounce.Add(30*time.Minute) {
+		t.Errorf("unexpected tracker status: %+v", trackers)
+	}
+
+	got, err := os.ReadFile(filepath.Join(dir, "content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content does not match")
+	}
+
+	if err := tor.Stop(); err != nil {
+		t.Fatalf("Stop() returned error: %v", err)
+	}
+	if got := tor.Stats().State; got != StateStopped {
+		t.Errorf("state after Stop() = %v, want stopped", got)
+	}
+}
+
+// TestWebSeed downloads a trackerless torrent from a web seed.
+func TestWebSeed(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	mi.Nodes = []torrent.Node{{Host: "router.example.com", Port: 6881}}
+	seedDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(seedDir, "content"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(seedDir)))
+	defer server.Close()
+	mi.URLList = []string{server.URL + "/"}
+
+	dir := t.TempDir()
+	s, err := New(Config{DownloadDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	waitDone(t, tor)
+
+	if stats := tor.Stats(); stats.Downloaded != int64(len(content)) || stats.Peers != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content does not match")
+	}
+}
+
+// TestHTTPSeed downloads a trackerless torrent from a BEP 17 HTTP seed that is busy at first.
+func TestHTTPSeed(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	mi.Nodes = []torrent.Node{{Host: "router.example.com", Port: 6881}}
+	var busy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if busy.CompareAndSwap(false, true) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("1"))
+			return
+		}
+		query := r.URL.Query()
+		piece, err1 := strconv.Atoi(query.Get("piece"))
+		var first, last int64
+		_, err2 := fmt.Sscanf(query.Get("ranges"), "%d-%d", &first, &last)
+		if query.Get("info_hash") != string(mi.InfoHash[:]) || err1 != nil || err2 != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		start := int64(piece) * mi.Info.PieceLength
+		w.Write(content[start+first : start+last+1])
+	}))
+	defer server.Close()
+	mi.HTTPSeeds = []string{server.URL + "/seed.php"}
+
+	dir := t.TempDir()
+	s, err := New(Config{DownloadDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	waitDone(t, tor)
+
+	got, err := os.ReadFile(filepath.Join(dir, "content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("downloaded content does not match")
+	}
+}
+
+// TestStartComplete verifies that content already on disk is detected on Start.
+func TestStartComplete(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	mi.Announce = newTracker(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "content"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{DownloadDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	waitDone(t, tor)
+	if stats := tor.Stats(); stats.State != StateSeeding || stats.Downloaded != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+// TestPEX connects to a seeder only known through PEX and checks the PEX messages sent to it.
+func TestPEX(t *testing.T) {
+	interval := pexInterval
+	pexInterval = 50 * time.Millisecond
+	t.Cleanup(func() { pexInterval = interval })
+
+	content := testContent()
+	mi := createTorrent(t, content)
+	hidden := newSeeder(t, mi, content)
+	announced := newSeeder(t, mi, content)
+	announced.pex = []netip.AddrPort{hidden.addr()}
+	mi.Announce = newTracker(t, announced.addr())
+
+	s, err := New(Config{DownloadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+
+	// the hidden seeder is told about the announced one, which is a seed reachable by us
+	select {
+	case exchange := <-hidden.received:
+		expected := []pex.Peer{{Addr: announced.addr(), Flags: pex.FlagSeed | pex.FlagReachable}}
+		if !reflect.DeepEqual(exchange.Added, expected) || len(exchange.Dropped) != 0 {
+			t.Errorf("PEX message = %+v, want added %+v", exchange, expected)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the seeder found through PEX received no PEX message")
+	}
+	waitDone(t, tor)
+}
+
+// TestPEXInbound checks that peers that connected to us are shared through PEX at their
+// listening port and not as reachable, and not at all if they named no listening port.
+func TestPEXInbound(t *testing.T) {
+	interval := pexInterval
+	pexInterval = 50 * time.Millisecond
+	t.Cleanup(func() { pexInterval = interval })
+
+	s, tor := holepunchSeed(t)
+	_, listening := holepunchPeer(t, s, tor.MetaInfo(), 7000)
+	_, silent := holepunchPeer(t, s, tor.MetaInfo(), 0)
+	receiver, _ := holepunchPeer(t, s, tor.MetaInfo(), 7001)
+
+	want := pex.Peer{Addr: netip.AddrPortFrom(listening.Addr(), 7000), Flags: pex.FlagHolepunch}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m, ok := <-receiver.Messages():
+			if !ok {
+				t.Fatalf("connection closed: %v", receiver.Err())
+			}
+			if m.ID != peer.MsgExtended {
+				continue
+			}
+			id, payload, err := m.ParseExtended()
+			if err != nil || id != pex.LocalID {
+				continue
+			}
+			exchange, err := pex.Parse(payload)
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			found := false
+			for _, p := range exchange.Added {
+				switch {
+				case p.Addr == listening || p.Addr == silent:
+					t.Fatalf("PEX shares the port %v a peer connected from", p.Addr)
+				case p.Addr == want.Addr:
+					if p != want {
+						t.Errorf("PEX shares %+v, want %+v", p, want)
+					}
+					found = true
+				}
+			}
+			if found {
+				return
+			}
+		case <-timeout:
+			t.Fatal("the listening port of the inbound peer was not shared")
+		}
+	}
+}
+
+// TestDuplicatePeer connects a peer to the session both ways, in either order, and checks that
+// only the connection dialed by the session, having the lower peer ID, is kept.
+func TestDuplicatePeer(t *testing.T) {
+	for _, dialFirst := range []bool{true, false} {
+		t.Run(fmt.Sprintf("dialFirst=%v", dialFirst), func(t *testing.T) {
+			s, tor := holepunchSeed(t)
+			mi := tor.MetaInfo()
+			cfg := peer.Config{InfoHash: mi.InfoHash, PeerID: [20]byte{'d', 'u', 'a', 'l'}, NumPieces: mi.Info.NumPieces()}
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			listenAddr := ln.Addr().(*net.TCPAddr).AddrPort()
+
+			accepted := make(chan *peer.PeerConn, 1)
+			go func() {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				remote, err := peer.ReadHandshake(conn)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				pc, err := peer.AcceptPeerConn(conn, remote, cfg)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				accepted <- pc
+			}()
+			dialOut := func() {
+				tor.mu.Lock()
+				ctx := tor.ctx
+				tor.mu.Unlock()
+				tor.connect(ctx, listenAddr)
+				select {
+				case pc := <-accepted:
+					t.Cleanup(func() { pc.Close() })
+				case <-time.After(5 * time.Second):
+					t.Fatal("the session did not connect to the peer")
+				}
+			}
+			dialIn := func() *peer.PeerConn {
+				conn, err := net.Dial("tcp", s.ListenAddr().String())
+				if err != nil {
+					t.Fatal(err)
+				}
+				pc, err := peer.NewPeerConn(conn, cfg)
+				if err != nil {
+					t.Fatalf("NewPeerConn() returned error: %v", err)
+				}
+				t.Cleanup(func() { pc.Close() })
+				return pc
+			}
+			connections := func() []string {
+				tor.mu.Lock()
+				defer tor.mu.Unlock()
+				var keys []string
+				for key, pc := range tor.peers {
+					if pc != nil && pc.PeerID() == cfg.PeerID {
+						keys = append(keys, key)
+					}
+				}
+				return keys
+			}
+
+			var inbound *peer.PeerConn
+			if dialFirst {
+				dialOut()
+				waitFor(t, func() bool { return len(connections()) == 1 })
+				inbound = dialIn()
+			} else {
+				inbound = dialIn()
+				waitFor(t, func() bool { return len(connections()) == 1 })
+				dialOut()
+			}
+
+			timeout := time.After(5 * time.Second)
+			for closed := false; !closed; {
+				select {
+				case _, ok := <-inbound.Messages():
+					closed = !ok
+				case <-timeout:
+					t.Fatal("the connection made by the peer was not dropped")
+				}
+			}
+			waitFor(t, func() bool {
+				keys := connections()
+				return len(keys) == 1 && keys[0] == listenAddr.String()
+			})
+		})
+	}
+}
+
+// TestPauseResume verifies the state transitions of Pause and Start.
+func TestPauseResume(t *testing.T) {
+	mi := createTorrent(t, testContent())
+	mi.Announce = newTracker(t)
+
+	s, err := New(Config{DownloadDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name     string
+		action   func() error
+		expected State
+	}{
+		{"pause while stopped", tor.Pause, StateStopped},
+		{"start", tor.Start, StateDownloading},
+		{"start again", tor.Start, StateDownloading},
+		{"pause", tor.Pause, StatePaused},
+		{"resume", tor.Start, StateDownloading},
+		{"stop", tor.Stop, StateStopped},
+		{"stop again", tor.Stop, StateStopped},
+	}
+	for _, step := range steps {
+		if err := step.action(); err != nil {
+			t.Fatalf("%s: returned error: %v", step.name, err)
+		}
+		if got := tor.Stats().State; got != step.expected {
+			t.Errorf("%s: state = %v, want %v", step.name, got, step.expected)
+		}
+	}
+	select {
+	case <-tor.Done():
+		t.Error("expected the torrent not to be done")
+	default:
+	}
+}
+
+// TestFastResume downloads a torrent with resume files enabled, then adds it to a new session
+// and verifies that its counters are restored and its content is not checked again unless it
+// changed on disk.
+func TestFastResume(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	seed := newSeeder(t, mi, content)
+	mi.Announce = newTracker(t, seed.addr())
+
+	cfg := Config{DownloadDir: t.TempDir(), ResumeDir: t.TempDir()}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	waitDone(t, tor)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+
+	// corrupt the content behind the resume data's back, keeping its size and modification time
+	path := filepath.Join(cfg.DownloadDir, "content")
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := bytes.Clone(content)
+	corrupt[0] ^= 0xff
+	if err := os.WriteFile(path, corrupt, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, stat.ModTime(), stat.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+
+	mi.Announce = newTracker(t)
+	restart := func() Stats {
+		t.Helper()
+		s, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		tor, err := s.AddTorrent(mi)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if downloaded := tor.Stats().Downloaded; downloaded != int64(len(content)) {
+			t.Errorf("restored Downloaded = %d, want %d", downloaded, len(content))
+		}
+		if err := tor.Start(); err != nil {
+			t.Fatalf("Start() returned error: %v", err)
+		}
+		return tor.Stats()
+	}
+
+	if stats := restart(); stats.State != StateSeeding || stats.Have != 4 {
+		t.Errorf("expected the resume data to be trusted, got %+v", stats)
+	}
+
+	// touching the file makes the resume data stale, so the corruption is found
+	later := stat.ModTime().Add(time.Hour)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if stats := restart(); stats.State != StateDownloading || stats.Have != 3 {
+		t.Errorf("expected the content to be checked again, got %+v", stats)
+	}
+}
+
+// TestSeedLimits verifies that a seeding torrent pauses or stops once it reaches its seeding
+// time or upload ratio, emitting an event.
+func TestSeedLimits(t *testing.T) {
+	interval := rechokeInterval
+	rechokeInterval = 20 * time.Millisecond
+	defer func() { rechokeInterval = interval }()
+
+	content := testContent()
+	mi := createTorrent(t, content)
+	mi.Announce = newTracker(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "content"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{DownloadDir: dir, SeedLimits: SeedLimits{Time: 50 * time.Millisecond, Action: SeedPause}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	events := s.Subscribe(EventSeedLimitReached)
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func(want State) Event {
+		t.Helper()
+		select {
+		case e := <-events:
+			if got := tor.Stats().State; got != want {
+				t.Errorf("state = %v after the seed limit, want %v", got, want)
+			}
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the seed limit")
+		}
+		return Event{}
+	}
+
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if e := wait(StatePaused); e.InfoHash != mi.InfoHash || e.SeedingTime < 50*time.Millisecond {
+		t.Errorf("unexpected event: %+v", e)
+	}
+	seedingTime := tor.Stats().SeedingTime
+	time.Sleep(30 * time.Millisecond)
+	if got := tor.Stats().SeedingTime; got != seedingTime {
+		t.Errorf("SeedingTime grew from %v to %v while paused", seedingTime, got)
+	}
+
+	// a ratio of 1.5 over the whole content, which was not downloaded
+	tor.SetSeedLimits(SeedLimits{Ratio: 1.5, Action: SeedStop})
+	tor.mu.Lock()
+	tor.uploaded = int64(len(content)) * 3 / 2
+	tor.mu.Unlock()
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if e := wait(StateStopped); e.Ratio != 1.5 {
+		t.Errorf("event Ratio = %v, want 1.5", e.Ratio)
+	}
+}
+
+// TestIncompleteDir downloads a torrent into part files in an incomplete directory and
+// verifies that they are moved to the download directory on completion, where a new session
+// finds them.
+func TestIncompleteDir(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	seed := newSeeder(t, mi, content)
+	mi.Announce = newTracker(t, seed.addr())
+
+	cfg := Config{DownloadDir: t.TempDir(), ResumeDir: t.TempDir(), IncompleteDir: t.TempDir(), PartFiles: true}
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	waitDone(t, tor)
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+
+	if got, err := os.ReadFile(filepath.Join(cfg.DownloadDir, "content")); err != nil || !bytes.Equal(got, content) {
+		t.Errorf("content not moved to the download directory: %v", err)
+	}
+	if entries, err := os.ReadDir(cfg.IncompleteDir); err != nil || len(entries) != 0 {
+		t.Errorf("incomplete directory holds %v, %v; want nothing", entries, err)
+	}
+
+	mi.Announce = newTracker(t)
+	s, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err = s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if stats := tor.Stats(); stats.State != StateSeeding || stats.Have != 4 {
+		t.Errorf("expected the moved content to be found, got %+v", stats)
+	}
+}
+
+// TestStartCompletePartFiles verifies that complete part files found on Start are renamed.
+func TestStartCompletePartFiles(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	mi.Announce = newTracker(t)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "content.part"), content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := New(Config{DownloadDir: dir, PartFiles: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if stats := tor.Stats(); stats.State != StateSeeding {
+		t.Errorf("state = %v, want seeding", stats.State)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "content")); err != nil {
+		t.Errorf("part file not renamed: %v", err)
+	}
+}
+
+// TestAllocation verifies that Start allocates the files of the content at their full size.
+func TestAllocation(t *testing.T) {
+	content := testContent()
+	mi := createTorrent(t, content)
+	mi.Announce = newTracker(t)
+
+	dir := t.TempDir()
+	s, err := New(Config{DownloadDir: dir, Allocation: storage.AllocateFull})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	tor, err := s.AddTorrent(mi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tor.Start(); err != nil {
+		t.Fatalf("Start() returned error: %v", err)
+	}
+	if stat, err := os.Stat(filepath.Join(dir, "content")); err != nil || stat.Size() != int64(len(content)) {
+		t.Errorf("content file is %v, %v; want %d bytes", stat, err, len(content))
+	}
+	if stats := tor.Stats(); stats.State != StateDownloading || stats.Have != 0 {
+		t.Errorf("unexpected stats after allocation: %+v", stats)
+	}
+}
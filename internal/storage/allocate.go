@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+)
+
+// Allocation selects how the files of the content are allocated on disk.
+type Allocation int
+
+const (
+	AllocateNone   Allocation = iota // files are created and grown by the writes
+	AllocateSparse                   // files are created at their full size without reserving disk space
+	AllocateFull                     // the disk space of every file is reserved up front
+)
+
+func (a Allocation) String() string {
+	switch a {
+	case AllocateNone:
+		return "none"
+	case AllocateSparse:
+		return "sparse"
+	case AllocateFull:
+		return "full"
+	}
+	return "unknown"
+}
+
+// ParseAllocation returns the allocation named by s, as returned by String: "none", "sparse"
+// or "full".
+func ParseAllocation(s string) (Allocation, error) {
+	for a := AllocateNone; a <= AllocateFull; a++ {
+		if a.String() == s {
+			return a, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown allocation %q", s)
+}
+
+// zeroChunk is the size of the writes filling files with zeros.
+const zeroChunk = 1 << 20
+
+// Preallocate creates every non-empty file of the content at its full size, as selected by
+// the Allocation option, so that fragmentation is limited and a full disk is reported now
+// rather than by a later write. Full allocation uses fallocate on Linux and fills the files
+// with zeros elsewhere. Content already on disk is kept, and padding files are skipped. With
+// AllocateNone, Preallocate does nothing.
+func (s *Storage) Preallocate() error {
+	if s.allocation == AllocateNone {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx, file := range s.info.Files {
+		if file.Length == 0 || file.IsPadding() {
+			continue
+		}
+		f, err := s.open(idx, true)
+		if err != nil {
+			return err
+		}
+		stat, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		if s.allocation == AllocateSparse {
+			if stat.Size() < file.Length {
+				err = f.Truncate(file.Length)
+			}
+		} else {
+			err = allocate(f, stat.Size(), file.Length)
+		}
+		if err != nil {
+			return fmt.Errorf("allocating %s: %w", f.Name(), err)
+		}
+	}
+	return nil
+}
+
+// zeroFill writes zeros to f from offset from up to size.
+func zeroFill(f io.WriterAt, from, size int64) error {
+	zeros := make([]byte, min(zeroChunk, max(size-from, 0)))
+	for off := from; off < size; {
+		n, err := f.WriteAt(zeros[:min(int64(len(zeros)), size-off)], off)
+		if err != nil {
+			return err
+		}
+		off += int64(n)
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// allocate reserves the disk space of the first size bytes of f, whose current size is
+// current, with fallocate, or by filling it with zeros on file systems that do not
+// support it.
+func allocate(f *os.File, current, size int64) error {
+	err := syscall.Fallocate(int(f.Fd()), 0, 0, size)
+	if errors.Is(err, syscall.EOPNOTSUPP) || errors.Is(err, syscall.ENOSYS) {
+		return zeroFill(f, current, size)
+	}
+	return err
+}
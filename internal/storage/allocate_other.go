@@ -0,0 +1,11 @@
+//go:build !linux
+
+package storage
+
+import "os"
+
+// allocate reserves the disk space of the first size bytes of f, whose current size is
+// current, by filling the rest of it with zeros.
+func allocate(f *os.File, current, size int64) error {
+	return zeroFill(f, current, size)
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// TestPreallocate allocates the files of partly written content in each mode, checking their
+// sizes and that the content written before is kept.
+func TestPreallocate(t *testing.T) {
+	for _, allocation := range []Allocation{AllocateNone, AllocateSparse, AllocateFull} {
+		t.Run(allocation.String(), func(t *testing.T) {
+			content, info := testContent()
+			base := t.TempDir()
+			s, err := NewWithOptions(info, base, Options{Allocation: allocation})
+			if err != nil {
+				t.Fatalf("NewWithOptions() returned error: %v", err)
+			}
+			defer s.Close()
+			if err := s.WriteBlock(0, 0, content[:4]); err != nil {
+				t.Fatalf("WriteBlock() returned error: %v", err)
+			}
+			if err := s.Preallocate(); err != nil {
+				t.Fatalf("Preallocate() returned error: %v", err)
+			}
+
+			for path, length := range map[string]int64{"content/a": 10, "content/sub/b": 25, "content/c": 7} {
+				stat, err := os.Stat(filepath.Join(base, path))
+				switch {
+				case allocation == AllocateNone && path == "content/a":
+					if err != nil || stat.Size() != 4 {
+						t.Errorf("%s: got %v, %v; want the 4 bytes written", path, stat, err)
+					}
+				case allocation == AllocateNone:
+					if !os.IsNotExist(err) {
+						t.Errorf("%s: got %v, want no file", path, err)
+					}
+				case err != nil || stat.Size() != length:
+					t.Errorf("%s: got %v, %v; want %d bytes", path, stat, err, length)
+				}
+			}
+			block := make([]byte, 4)
+			if err := s.ReadBlock(0, 0, block); err != nil || !slices.Equal(block, content[:4]) {
+				t.Errorf("ReadBlock() = %v, %v; want the content written", block, err)
+			}
+		})
+	}
+}
+
+// TestParseAllocation checks the round trip through String.
+func TestParseAllocation(t *testing.T) {
+	for _, a := range []Allocation{AllocateNone, AllocateSparse, AllocateFull} {
+		if got, err := ParseAllocation(a.String()); err != nil || got != a {
+			t.Errorf("ParseAllocation(%q) = %v, %v", a, got, err)
+		}
+	}
+	if _, err := ParseAllocation("compact"); err == nil {
+		t.Error("ParseAllocation(\"compact\") returned no error")
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ApplyAttributes gives the files of complete content the attributes of BEP 47: symbolic
+// links are created, pointing at their target within the content, and executable files get
+// their executable bits on Unix. It is meant to be called once the content is complete and
+// in place, after Move if it is moved, and may be called again: links already pointing at
+// their target are kept. A link is never created over another file.
+func (s *Storage) ApplyAttributes() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for idx, file := range s.info.Files {
+		switch {
+		case file.IsPadding():
+		case file.IsSymlink():
+			if err := s.createSymlink(idx); err != nil {
+				errs = append(errs, err)
+			}
+		case file.IsExecutable():
+			if err := setExecutable(s.path(idx)); err != nil {
+				errs = append(errs, fmt.Errorf("making %s executable: %w", s.path(idx), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// createSymlink creates the symbolic link at fileIndex. s.mu must be held.
+func (s *Storage) createSymlink(fileIndex int) error {
+	path := s.path(fileIndex)
+	target, err := s.info.SymlinkTarget(fileIndex)
+	if err != nil {
+		return err
+	}
+	existing, err := os.Readlink(path)
+	switch {
+	case err == nil && existing == target:
+		return nil
+	case !errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("creating symbolic link %s: file exists", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	if err := os.Symlink(target, path); err != nil {
+		return fmt.Errorf("creating symbolic link: %w", err)
+	}
+	return nil
+}
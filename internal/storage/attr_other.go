@@ -0,0 +1,8 @@
+//go:build !unix
+
+package storage
+
+// setExecutable does nothing, files have no executable bits outside Unix.
+func setExecutable(path string) error {
+	return nil
+}
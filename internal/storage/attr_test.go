@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"crypto/sha1"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// TestApplyAttributes writes content holding an executable file and a symbolic link, and
+// checks that they get their attributes, again on a second call, but that no link replaces
+// another file.
+func TestApplyAttributes(t *testing.T) {
+	content := make([]byte, 16)
+	info := &torrent.InfoDict{
+		Name:        "app",
+		PieceLength: 16,
+		Files: []torrent.FileInfo{
+			{Length: 8, Path: []string{"bin", "run"}, Attr: "x"},
+			{Path: []string{"bin", "data"}, Attr: "l", SymlinkPath: []string{"lib", "data"}},
+			{Length: 8, Path: []string{"lib", "data"}},
+		},
+		Pieces: [][20]byte{sha1.Sum(content)},
+	}
+	s, base := newStorage(t, info)
+	if err := s.WriteBlock(0, 0, content); err != nil {
+		t.Fatalf("WriteBlock() returned error: %v", err)
+	}
+
+	for range 2 {
+		if err := s.ApplyAttributes(); err != nil {
+			t.Fatalf("ApplyAttributes() returned error: %v", err)
+		}
+	}
+	link := filepath.Join(base, "app", "bin", "data")
+	if target, err := os.Readlink(link); err != nil || target != filepath.Join("..", "lib", "data") {
+		t.Errorf("link target = %q, %v", target, err)
+	}
+	if data, err := os.ReadFile(link); err != nil || len(data) != 8 {
+		t.Errorf("reading through the link = %v, %v", data, err)
+	}
+	stat, err := os.Stat(filepath.Join(base, "app", "bin", "run"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := stat.Mode().Perm(); mode&0o100 == 0 {
+		t.Errorf("mode of the executable = %v, want it executable", mode)
+	}
+
+	if err := os.Remove(link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(link, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ApplyAttributes(); err == nil {
+		t.Error("ApplyAttributes() replaced a file with a link")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package storage
+
+import "os"
+
+// setExecutable adds the executable bits to the file at path for whoever may read it.
+func setExecutable(path string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	mode := stat.Mode().Perm()
+	return os.Chmod(path, mode|(mode&0o444)>>2)
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// rename renames files, replaced by tests to simulate moves across devices.
+var rename = os.Rename
+
+// Move moves the files of the content below the directory base, without the suffix, and
+// keeps storing the content there. Reads and writes wait for the move to finish.
+//
+// Each file is renamed into place, or copied to a temporary file next to its destination,
+// renamed into place and deleted when base is on another device, so a file is never seen
+// partially written at its destination. Files not on disk are skipped, and the directories
+// emptied by the move are removed. If a file cannot be moved, the files already moved are
+// moved back and the content stays where it was. A file already at the destination of a file
+// of the content is never replaced: the move fails with an error wrapping fs.ErrExist.
+func (s *Storage) Move(base string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx, f := range s.files {
+		if f != nil {
+			if err := f.Close(); err != nil {
+				return err
+			}
+		}
+		delete(s.files, idx)
+	}
+
+	type move struct{ from, to string }
+	var moved []move
+	for idx := range s.info.Files {
+		m := move{from: s.path(idx), to: s.info.ContentPath(base, idx)}
+		if m.from == m.to {
+			continue
+		}
+		err := moveFile(m.from, m.to)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			for _, back := range moved {
+				moveFile(back.to, back.from) // best effort
+			}
+			return fmt.Errorf("moving %s: %w", m.from, err)
+		}
+		moved = append(moved, m)
+	}
+
+	for _, m := range moved {
+		removeEmptyDirs(filepath.Dir(m.from), s.base)
+	}
+	s.base, s.suffix = base, ""
+	return nil
+}
+
+// removeEmptyDirs removes dir and its parents below base while they are empty.
+func removeEmptyDirs(dir, base string) {
+	for {
+		rel, err := filepath.Rel(base, dir)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") || os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// moveFile moves the file at from to the path to, creating its directories. It falls back to
+// copying and deleting the file when they are on different devices. It fails if to exists.
+func moveFile(from, to string) error {
+	if _, err := os.Lstat(from); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(to); err == nil {
+		return fmt.Errorf("%s: %w", to, fs.ErrExist)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	err := rename(from, to)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(from, to); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+// copyFile copies the file at from to the path to, with the same permissions, through a
+// temporary file renamed into place once complete.
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	stat, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.CreateTemp(filepath.Dir(to), "."+filepath.Base(to)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dst.Name()) // no-op once renamed
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(dst.Name(), stat.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(dst.Name(), to)
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// writePartFiles writes content into a Storage for info in a temporary directory, with files
+// named with a ".part" suffix, and returns the Storage and its directory.
+func writePartFiles(t *testing.T, content []byte) (*Storage, string) {
+	t.Helper()
+	_, info := testContent()
+	base := t.TempDir()
+	s, err := NewWithOptions(info, base, Options{Suffix: ".part"})
+	if err != nil {
+		t.Fatalf("NewWithOptions() returned error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	for index := range info.Pieces {
+		start := int64(index) * info.PieceLength
+		if err := s.WriteBlock(index, 0, content[start:start+info.PieceSize(index)]); err != nil {
+			t.Fatalf("WriteBlock(%d) returned error: %v", index, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(base, "content", "sub", "b.part")); err != nil {
+		t.Fatalf("expected a part file: %v", err)
+	}
+	return s, base
+}
+
+// checkFiles checks that the files of the test content are below base, with their names.
+func checkFiles(t *testing.T, base string, content []byte) {
+	t.Helper()
+	for path, expected := range map[string][]byte{
+		"content/a":     content[:10],
+		"content/sub/b": content[10:35],
+		"content/c":     content[35:],
+	} {
+		got, err := os.ReadFile(filepath.Join(base, path))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !slices.Equal(got, expected) {
+			t.Errorf("%s = %v, want %v", path, got, expected)
+		}
+	}
+}
+
+// TestMove moves part files to another directory by renaming them, and across devices by
+// copying them, checking that the content stays readable and the old directories are gone.
+func TestMove(t *testing.T) {
+	for _, crossDevice := range []bool{false, true} {
+		if crossDevice {
+			defer func(r func(string, string) error) { rename = r }(rename)
+			rename = func(from, to string) error {
+				return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EXDEV}
+			}
+		}
+
+		content, _ := testContent()
+		s, base := writePartFiles(t, content)
+		dest := filepath.Join(t.TempDir(), "complete")
+		if err := s.Move(dest); err != nil {
+			t.Fatalf("Move() returned error: %v", err)
+		}
+		checkFiles(t, dest, content)
+		if entries, err := os.ReadDir(base); err != nil || len(entries) != 0 {
+			t.Errorf("directory left with %v, %v; want it empty", entries, err)
+		}
+		if got := s.Path(1); got != filepath.Join(dest, "content", "sub", "b") {
+			t.Errorf("Path(1) = %q after Move()", got)
+		}
+		if err := s.VerifyPiece(1); err != nil {
+			t.Errorf("VerifyPiece(1) after Move() returned error: %v", err)
+		}
+	}
+}
+
+// TestMoveInPlace drops the suffix of part files without moving them.
+func TestMoveInPlace(t *testing.T) {
+	content, _ := testContent()
+	s, base := writePartFiles(t, content)
+	if err := s.Move(base); err != nil {
+		t.Fatalf("Move() returned error: %v", err)
+	}
+	checkFiles(t, base, content)
+}
+
+// TestMoveExisting checks that a move does not replace a file at its destination, and puts
+// the files already moved back.
+func TestMoveExisting(t *testing.T) {
+	content, _ := testContent()
+	s, base := writePartFiles(t, content)
+	dest := t.TempDir()
+	existing := filepath.Join(dest, "content", "c")
+	if err := os.MkdirAll(filepath.Dir(existing), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(existing, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Move(dest); !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("Move() returned %v, want an error wrapping fs.ErrExist", err)
+	}
+	if got, err := os.ReadFile(existing); err != nil || string(got) != "keep" {
+		t.Errorf("existing file = %q, %v; want it unchanged", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "content", "sub", "b.part")); err != nil {
+		t.Errorf("expected the moved file back: %v", err)
+	}
+	if err := s.VerifyPiece(1); err != nil {
+		t.Errorf("VerifyPiece(1) after a failed Move() returned error: %v", err)
+	}
+}
+
+// TestMoveFailure checks that a failed move puts the files already moved back.
+func TestMoveFailure(t *testing.T) {
+	defer func(r func(string, string) error) { rename = r }(rename)
+	rename = func(from, to string) error {
+		if strings.HasSuffix(from, "c.part") {
+			return &os.LinkError{Op: "rename", Old: from, New: to, Err: syscall.EACCES}
+		}
+		return os.Rename(from, to)
+	}
+
+	content, _ := testContent()
+	s, base := writePartFiles(t, content)
+	err := s.Move(t.TempDir())
+	if !errors.Is(err, syscall.EACCES) {
+		t.Fatalf("Move() returned %v, want a permission error", err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "content", "sub", "b.part")); err != nil {
+		t.Errorf("expected the moved file back: %v", err)
+	}
+	if err := s.VerifyPiece(1); err != nil {
+		t.Errorf("VerifyPiece(1) after a failed Move() returned error: %v", err)
+	}
+}
@@ -0,0 +1,279 @@
+// Package storage stores the content of a torrent on disk.
+//
+// A torrent's content is a single stream of bytes split into pieces, while on disk it is
+// spread across the files listed in the info dictionary. Storage maps blocks of pieces to
+// the files they cover, writes received blocks at the right offsets and verifies completed
+// pieces against their SHA-1 hashes, so corrupt pieces can be downloaded again.
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// FileSpan is the part of a range of the content that lies within a single file.
+type FileSpan struct {
+	FileIndex int   // index of the file in InfoDict.Files
+	Offset    int64 // offset within the file
+	Length    int64 // number of bytes
+}
+
+// Storage reads and writes the content of a torrent below a download directory, using the
+// layout of ScanProgress: base/name for single-file torrents, base/name/path... otherwise.
+// Files and their parent directories are created on the first write. Padding files are never
+// created: writes to them are dropped and reads return zeros.
+//
+// Storage is safe for concurrent use.
+type Storage struct {
+	info    *torrent.InfoDict
+	offsets []int64 // offset of each file within the content
+
+	mu     sync.Mutex
+	base   string
+	suffix string           // appended to the name of every file
+	files  map[int]*os.File // open files by index
+
+	allocation Allocation
+}
+
+// Options configure a Storage.
+type Options struct {
+	// Suffix is appended to the name of every file, such as ".part" to mark the files of an
+	// incomplete download. Move drops it.
+	Suffix string
+	// Allocation selects how Preallocate allocates the files.
+	Allocation Allocation
+}
+
+// New returns a Storage for the content described by info below the directory base.
+func New(info *torrent.InfoDict, base string) (*Storage, error) {
+	return NewWithOptions(info, base, Options{})
+}
+
+// NewWithOptions is like New, with the file names configured by opts.
+func NewWithOptions(info *torrent.InfoDict, base string, opts Options) (*Storage, error) {
+	if info.PieceLength <= 0 {
+		return nil, fmt.Errorf("invalid piece length %d", info.PieceLength)
+	}
+	if info.NumPieces() == 0 {
+		return nil, errors.New("torrent has no pieces")
+	}
+
+	offsets := make([]int64, len(info.Files))
+	var offset int64
+	for i, file := range info.Files {
+		offsets[i] = offset
+		offset += file.Length
+	}
+	return &Storage{
+		info:       info,
+		base:       base,
+		suffix:     opts.Suffix,
+		offsets:    offsets,
+		files:      make(map[int]*os.File),
+		allocation: opts.Allocation,
+	}, nil
+}
+
+// Path returns the on-disk path of the file at fileIndex.
+func (s *Storage) Path(fileIndex int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.path(fileIndex)
+}
+
+// path returns the on-disk path of the file at fileIndex. s.mu must be held.
+func (s *Storage) path(fileIndex int) string {
+	return s.info.ContentPath(s.base, fileIndex) + s.suffix
+}
+
+// Locate returns the parts of the files covered by length bytes starting at begin within the
+// piece at index, in content order. Empty files are never part of the result.
+func (s *Storage) Locate(index int, begin, length int64) ([]FileSpan, error) {
+	pieceSize := s.info.PieceSize(index)
+	if pieceSize == 0 {
+		return nil, fmt.Errorf("piece index %d out of range", index)
+	}
+	if begin < 0 || length < 0 || begin+length > pieceSize {
+		return nil, fmt.Errorf("piece %d: range [%d, %d) exceeds the piece size %d", index, begin, begin+length, pieceSize)
+	}
+
+	off := int64(index)*s.info.PieceLength + begin
+	end := off + length
+	var spans []FileSpan
+	for i, file := range s.info.Files {
+		fileStart := s.offsets[i]
+		fileEnd := fileStart + file.Length
+		if off >= end {
+			break
+		}
+		if off >= fileEnd {
+			continue
+		}
+
+		n := min(end, fileEnd) - off
+		spans = append(spans, FileSpan{FileIndex: i, Offset: off - fileStart, Length: n})
+		off += n
+	}
+	return spans, nil
+}
+
+// WriteBlock writes data at offset begin within the piece at index.
+func (s *Storage) WriteBlock(index int, begin int64, data []byte) error {
+	spans, err := s.Locate(index, begin, int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, span := range spans {
+		if s.info.Files[span.FileIndex].IsPadding() {
+			data = data[span.Length:]
+			continue
+		}
+		f, err := s.open(span.FileIndex, true)
+		if err != nil {
+			return err
+		}
+		if _, err := f.WriteAt(data[:span.Length], span.Offset); err != nil {
+			return fmt.Errorf("piece %d: writing %s: %w", index, f.Name(), err)
+		}
+		data = data[span.Length:]
+	}
+	return nil
+}
+
+// ReadBlock fills p with the content at offset begin within the piece at index.
+// It returns an error wrapping io.ErrUnexpectedEOF if the content is not on disk.
+func (s *Storage) ReadBlock(index int, begin int64, p []byte) error {
+	spans, err := s.Locate(index, begin, int64(len(p)))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, span := range spans {
+		if s.info.Files[span.FileIndex].IsPadding() {
+			clear(p[:span.Length])
+			p = p[span.Length:]
+			continue
+		}
+		f, err := s.open(span.FileIndex, false)
+		if err != nil {
+			return err
+		}
+		if f == nil {
+			return fmt.Errorf("piece %d: file %d is missing: %w", index, span.FileIndex, io.ErrUnexpectedEOF)
+		}
+		if _, err := f.ReadAt(p[:span.Length], span.Offset); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("piece %d: reading %s: %w", index, f.Name(), err)
+		}
+		p = p[span.Length:]
+	}
+	return nil
+}
+
+// VerifyPiece reads the piece at index back from disk and checks it against its SHA-1 hash.
+// It returns an error wrapping torrent.ErrPieceHashMismatch if the piece is corrupt or not
+// fully on disk, in which case it should be downloaded again.
+func (s *Storage) VerifyPiece(index int) error {
+	piece := make([]byte, s.info.PieceSize(index))
+	if err := s.ReadBlock(index, 0, piece); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("piece %d is incomplete: %w", index, torrent.ErrPieceHashMismatch)
+		}
+		return err
+	}
+	if sha1.Sum(piece) != s.info.Pieces[index] {
+		return fmt.Errorf("piece %d: %w", index, torrent.ErrPieceHashMismatch)
+	}
+	return nil
+}
+
+// Recheck verifies every piece on disk, hashing pieces in parallel as configured by opts, and
+// returns a Bitfield of the pieces that are complete. Corrupt and missing pieces are simply
+// left unset; other errors, such as unreadable files, stop the recheck.
+func (s *Storage) Recheck(ctx context.Context, opts torrent.HashOptions) (torrent.Bitfield, error) {
+	numPieces := s.info.NumPieces()
+	complete := make([]bool, numPieces) // written by the workers, one index each
+	err := torrent.ForEachPiece(ctx, numPieces, opts, func(index int) error {
+		err := s.VerifyPiece(index)
+		if errors.Is(err, torrent.ErrPieceHashMismatch) {
+			return nil
+		}
+		complete[index] = err == nil
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	have := torrent.NewBitfield(numPieces)
+	for index, ok := range complete {
+		if ok {
+			have.Set(index)
+		}
+	}
+	return have, nil
+}
+
+// Close closes every open file.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for idx, f := range s.files {
+		if f != nil {
+			errs = append(errs, f.Close())
+		}
+		delete(s.files, idx)
+	}
+	return errors.Join(errs...)
+}
+
+// open returns the file at fileIndex, opening it if needed. With create set, a missing file and
+// its directories are created, otherwise a missing file yields nil until it is written to.
+// s.mu must be held.
+func (s *Storage) open(fileIndex int, create bool) (*os.File, error) {
+	if f := s.files[fileIndex]; f != nil {
+		return f, nil
+	}
+
+	path := s.path(fileIndex)
+	if !create {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.files[fileIndex] = f
+		return f, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.files[fileIndex] = f
+	return f, nil
+}
@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// testContent returns 42 bytes of content and a multi-file InfoDict storing it in three files
+// of 10, 25 and 7 bytes, split into 16-byte pieces.
+func testContent() ([]byte, *torrent.InfoDict) {
+	content := make([]byte, 42)
+	for i := range content {
+		content[i] = byte(i)
+	}
+
+	info := &torrent.InfoDict{
+		Name:        "content",
+		PieceLength: 16,
+		Files: []torrent.FileInfo{
+			{Length: 10, Path: []string{"a"}},
+			{Length: 25, Path: []string{"sub", "b"}},
+			{Length: 7, Path: []string{"c"}},
+		},
+	}
+	for off := 0; off < len(content); off += 16 {
+		info.Pieces = append(info.Pieces, sha1.Sum(content[off:min(off+16, len(content))]))
+	}
+	return content, info
+}
+
+// newStorage returns a Storage for info in a temporary directory, closed at the end of the test.
+func newStorage(t *testing.T, info *torrent.InfoDict) (*Storage, string) {
+	t.Helper()
+	base := t.TempDir()
+	s, err := New(info, base)
+	if err != nil {
+		t.Fatalf("New() returned error: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, base
+}
+
+// TestLocate verifies the mapping of piece ranges to files.
+func TestLocate(t *testing.T) {
+	_, info := testContent()
+	s, _ := newStorage(t, info)
+
+	tests := []struct {
+		name          string
+		index         int
+		begin, length int64
+		expected      []FileSpan
+	}{
+		{"piece across two files", 0, 0, 16, []FileSpan{{0, 0, 10}, {1, 0, 6}}},
+		{"piece within a file", 1, 0, 16, []FileSpan{{1, 6, 16}}},
+		{"short last piece", 2, 0, 10, []FileSpan{{1, 22, 3}, {2, 0, 7}}},
+		{"block inside a piece", 2, 4, 3, []FileSpan{{2, 1, 3}}},
+		{"empty range", 1, 4, 0, nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			spans, err := s.Locate(tc.index, tc.begin, tc.length)
+			if err != nil {
+				t.Fatalf("Locate() returned error: %v", err)
+			}
+			if !slices.Equal(spans, tc.expected) {
+				t.Errorf("Locate() = %+v, want %+v", spans, tc.expected)
+			}
+		})
+	}
+}
+
+// TestLocateInvalid ensures that ranges outside a piece are rejected.
+func TestLocateInvalid(t *testing.T) {
+	_, info := testContent()
+	s, _ := newStorage(t, info)
+
+	tests := []struct {
+		name          string
+		index         int
+		begin, length int64
+	}{
+		{"negative index", -1, 0, 1},
+		{"index past the end", 3, 0, 1},
+		{"negative offset", 0, -1, 1},
+		{"past the piece", 0, 10, 7},
+		{"past the short last piece", 2, 0, 16},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := s.Locate(tc.index, tc.begin, tc.length); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestWriteVerifyRead writes every piece in blocks, verifies them and reads them back,
+// checking the files on disk.
+func TestWriteVerifyRead(t *testing.T) {
+	content, info := testContent()
+	s, base := newStorage(t, info)
+
+	for index := range info.Pieces {
+		if err := s.VerifyPiece(index); !errors.Is(err, torrent.ErrPieceHashMismatch) {
+			t.Errorf("VerifyPiece(%d) before writing = %v, want a hash mismatch", index, err)
+		}
+	}
+
+	// write in 4-byte blocks, last piece first
+	for index := len(info.Pieces) - 1; index >= 0; index-- {
+		start := int64(index) * info.PieceLength
+		size := info.PieceSize(index)
+		for begin := int64(0); begin < size; begin += 4 {
+			block := content[start+begin : start+min(begin+4, size)]
+			if err := s.WriteBlock(index, begin, block); err != nil {
+				t.Fatalf("WriteBlock(%d, %d) returned error: %v", index, begin, err)
+			}
+		}
+		if err := s.VerifyPiece(index); err != nil {
+			t.Errorf("VerifyPiece(%d) returned error: %v", index, err)
+		}
+	}
+
+	for path, expected := range map[string][]byte{
+		"content/a":     content[:10],
+		"content/sub/b": content[10:35],
+		"content/c":     content[35:],
+	} {
+		got, err := os.ReadFile(filepath.Join(base, path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, expected) {
+			t.Errorf("%s = %v, want %v", path, got, expected)
+		}
+	}
+
+	block := make([]byte, 12)
+	if err := s.ReadBlock(0, 4, block); err != nil {
+		t.Fatalf("ReadBlock() returned error: %v", err)
+	}
+	if !slices.Equal(block, content[4:16]) {
+		t.Errorf("ReadBlock() = %v, want %v", block, content[4:16])
+	}
+}
+
+// TestPadding writes the pieces of content holding a padding file, which must read as zeros
+// without being created on disk.
+func TestPadding(t *testing.T) {
+	content := make([]byte, 32)
+	for i := range 10 {
+		content[i] = byte(i + 1)
+	}
+	info := &torrent.InfoDict{
+		Name:        "content",
+		PieceLength: 16,
+		Files: []torrent.FileInfo{
+			{Length: 10, Path: []string{"a"}},
+			{Length: 6, Path: []string{".pad", "6"}, Attr: "p"},
+			{Length: 16, Path: []string{"b"}},
+		},
+		Pieces: [][20]byte{sha1.Sum(content[:16]), sha1.Sum(content[16:])},
+	}
+	s, base := newStorage(t, info)
+
+	garbage := slices.Repeat([]byte{0xff}, 16) // dropped where it falls on the padding
+	copy(garbage, content[:10])
+	if err := s.WriteBlock(0, 0, garbage); err != nil {
+		t.Fatalf("WriteBlock() returned error: %v", err)
+	}
+	if err := s.WriteBlock(1, 0, content[16:]); err != nil {
+		t.Fatalf("WriteBlock() returned error: %v", err)
+	}
+	for index := range info.Pieces {
+		if err := s.VerifyPiece(index); err != nil {
+			t.Errorf("VerifyPiece(%d) returned error: %v", index, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(base, "content", ".pad")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("padding directory exists: %v", err)
+	}
+}
+
+// TestVerifyCorruptPiece verifies that a piece with wrong data is reported as corrupt.
+func TestVerifyCorruptPiece(t *testing.T) {
+	content, info := testContent()
+	s, _ := newStorage(t, info)
+
+	corrupt := slices.Clone(content[16:32])
+	corrupt[3] ^= 0xff
+	if err := s.WriteBlock(1, 0, corrupt); err != nil {
+		t.Fatalf("WriteBlock() returned error: %v", err)
+	}
+	if err := s.VerifyPiece(1); !errors.Is(err, torrent.ErrPieceHashMismatch) {
+		t.Errorf("VerifyPiece() = %v, want a hash mismatch", err)
+	}
+
+	if err := s.WriteBlock(1, 0, content[16:32]); err != nil {
+		t.Fatalf("WriteBlock() returned error: %v", err)
+	}
+	if err := s.VerifyPiece(1); err != nil {
+		t.Errorf("VerifyPiece() after rewriting returned error: %v", err)
+	}
+}
+
+// TestSingleFile verifies that single-file torrents are stored as base/name.
+func TestSingleFile(t *testing.T) {
+	content := []byte("single file content")
+	info := &torrent.InfoDict{
+		Name:        "single.txt",
+		PieceLength: 16,
+		Pieces:      [][20]byte{sha1.Sum(content[:16]), sha1.Sum(content[16:])},
+		Files:       []torrent.FileInfo{{Length: int64(len(content)), Path: []string{"single.txt"}}},
+	}
+	s, base := newStorage(t, info)
+
+	if err := s.WriteBlock(0, 0, content[:16]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteBlock(1, 0, content[16:]); err != nil {
+		t.Fatal(err)
+	}
+	for index := range info.Pieces {
+		if err := s.VerifyPiece(index); err != nil {
+			t.Errorf("VerifyPiece(%d) returned error: %v", index, err)
+		}
+	}
+
+	got, err := os.ReadFile(filepath.Join(base, "single.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("file content = %q, want %q", got, content)
+	}
+}
+
+// TestReadBlockMissing verifies that reading content not on disk reports an incomplete read.
+func TestReadBlockMissing(t *testing.T) {
+	_, info := testContent()
+	s, _ := newStorage(t, info)
+
+	if err := s.ReadBlock(1, 0, make([]byte, 4)); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("ReadBlock() = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+// TestRecheck writes part of the content, corrupts one piece and verifies that a parallel
+// recheck reports exactly the intact pieces and calls the progress callback for each piece.
+func TestRecheck(t *testing.T) {
+	content, info := testContent()
+	s, _ := newStorage(t, info)
+
+	for index := range 2 {
+		start := int64(index) * info.PieceLength
+		if err := s.WriteBlock(index, 0, content[start:start+info.PieceSize(index)]); err != nil {
+			t.Fatalf("WriteBlock(%d) returned error: %v", index, err)
+		}
+	}
+	if err := s.WriteBlock(1, 0, []byte{0xff}); err != nil {
+		t.Fatalf("corrupting piece 1: %v", err)
+	}
+
+	var calls, lastDone int
+	have, err := s.Recheck(context.Background(), torrent.HashOptions{
+		Workers: 2,
+		Progress: func(done, total int) {
+			calls++
+			lastDone = done
+			if total != 3 {
+				t.Errorf("progress total = %d, want 3", total)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("Recheck() returned error: %v", err)
+	}
+	for index, expected := range []bool{true, false, false} {
+		if have.Has(index) != expected {
+			t.Errorf("piece %d: complete = %v, want %v", index, have.Has(index), expected)
+		}
+	}
+	if calls != 3 || lastDone != 3 {
+		t.Errorf("progress called %d times ending at %d, want 3 and 3", calls, lastDone)
+	}
+}
@@ -0,0 +1,71 @@
+package torrent
+
+import (
+	"fmt"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// ValidateAnnounceList strictly checks the announce-list against the shape required by BEP 12:
+// a non-empty list of non-empty tiers, each a list of non-empty byte strings.
+// Every deviation is reported with its tier and URL coordinates.
+//
+// Parse tolerates malformed tiers and URLs by skipping them, so for parsed torrents the
+// announce-list is checked as it appeared in the source. For torrents built in code, the
+// AnnounceList field is checked instead. A torrent without an announce-list is valid.
+//
+// Reference: https://bittorrent.org/beps/bep_0012.html
+func (t *MetaInfo) ValidateAnnounceList() []error {
+	raw := t.rawAnnounceList
+	if raw == nil {
+		if t.AnnounceList == nil {
+			return nil
+		}
+		raw = announceListToBencode(t.AnnounceList)
+	}
+
+	tiers, err := bencode.AsList(raw)
+	if err != nil {
+		return []error{fmt.Errorf("'%s' must be a list, got %s", keyAnnounceList, bencode.TypeOf(raw))}
+	}
+	if len(tiers) == 0 {
+		return []error{fmt.Errorf("'%s' has no tiers", keyAnnounceList)}
+	}
+
+	var errs []error
+	for tierIdx, tierRaw := range tiers {
+		tier, err := bencode.AsList(tierRaw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("'%s' tier %d: must be a list, got %s", keyAnnounceList, tierIdx, bencode.TypeOf(tierRaw)))
+			continue
+		}
+		if len(tier) == 0 {
+			errs = append(errs, fmt.Errorf("'%s' tier %d: empty tier", keyAnnounceList, tierIdx))
+			continue
+		}
+
+		for urlIdx, urlRaw := range tier {
+			url, err := bencode.AsByteString(urlRaw)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("'%s' tier %d, url %d: must be a byte string, got %s", keyAnnounceList, tierIdx, urlIdx, bencode.TypeOf(urlRaw)))
+				continue
+			}
+			if url == "" {
+				errs = append(errs, fmt.Errorf("'%s' tier %d, url %d: empty URL", keyAnnounceList, tierIdx, urlIdx))
+			}
+		}
+	}
+	return errs
+}
+
+func announceListToBencode(announceList [][]bencode.ByteString) bencode.List {
+	tiers := make(bencode.List, 0, len(announceList))
+	for _, tier := range announceList {
+		urls := make(bencode.List, 0, len(tier))
+		for _, url := range tier {
+			urls = append(urls, url)
+		}
+		tiers = append(tiers, urls)
+	}
+	return tiers
+}
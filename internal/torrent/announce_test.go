@@ -0,0 +1,83 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestValidateAnnounceList verifies that structural problems skipped by Parse are reported
+// with their tier and URL coordinates.
+func TestValidateAnnounceList(t *testing.T) {
+	tests := []struct {
+		name         string
+		announceList bencode.Value
+		expected     []string
+	}{
+		{
+			name: "valid",
+			announceList: bencode.List{
+				bencode.List{"http://a.example.com/announce"},
+				bencode.List{"http://b.example.com/announce", "udp://c.example.com:80"},
+			},
+		},
+		{
+			name: "non-list tier and non-string url",
+			announceList: bencode.List{
+				"http://a.example.com/announce",
+				bencode.List{"http://b.example.com/announce", bencode.Integer(42)},
+			},
+			expected: []string{"tier 0: must be a list, got byte string", "tier 1, url 1: must be a byte string, got integer"},
+		},
+		{
+			name:         "empty tier and empty url",
+			announceList: bencode.List{bencode.List{}, bencode.List{""}},
+			expected:     []string{"tier 0: empty tier", "tier 1, url 0: empty URL"},
+		},
+		{
+			name:         "not a list",
+			announceList: "http://a.example.com/announce",
+			expected:     []string{"must be a list, got byte string"},
+		},
+		{
+			name:         "no tiers",
+			announceList: bencode.List{},
+			expected:     []string{"has no tiers"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := multiFileTorrent()
+			root[keyAnnounceList] = tc.announceList
+			mi, err := Parse(writeTorrent(t, root))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+
+			errs := mi.ValidateAnnounceList()
+			if len(errs) != len(tc.expected) {
+				t.Fatalf("expected %d errors, got %d: %v", len(tc.expected), len(errs), errs)
+			}
+			for i, sub := range tc.expected {
+				if !strings.Contains(errs[i].Error(), sub) {
+					t.Errorf("error %d: expected %q, got %v", i, sub, errs[i])
+				}
+			}
+		})
+	}
+}
+
+// TestValidateAnnounceListTyped ensures that torrents built in code are validated from their fields.
+func TestValidateAnnounceListTyped(t *testing.T) {
+	mi := &MetaInfo{AnnounceList: [][]bencode.ByteString{{"http://a.example.com/announce"}, {}}}
+	errs := mi.ValidateAnnounceList()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "tier 1: empty tier") {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+
+	if errs := (&MetaInfo{}).ValidateAnnounceList(); errs != nil {
+		t.Errorf("expected no errors without an announce-list, got %v", errs)
+	}
+}
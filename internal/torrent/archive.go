@@ -0,0 +1,119 @@
+package torrent
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// supported archive formats
+const (
+	ArchiveZip   = "zip"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ParseArchive parses every .torrent entry of a zip, tar or gzip-compressed tar archive,
+// as selected by format (one of ArchiveZip, ArchiveTar or ArchiveTarGz).
+// Entries without a .torrent extension are skipped.
+//
+// A malformed entry does not abort the operation: its error, prefixed with the entry name,
+// is collected in the returned error slice while the remaining entries are still parsed.
+// The final error is only non-nil for archive-level failures such as an unknown format
+// or a corrupt archive, in which case the torrents parsed so far are still returned.
+//
+// Zip archives need random access, so they are read fully into memory first.
+func ParseArchive(r io.Reader, format string) ([]*MetaInfo, []error, error) {
+	switch strings.ToLower(format) {
+	case ArchiveZip:
+		return parseZip(r)
+
+	case ArchiveTar:
+		return parseTar(r)
+
+	case ArchiveTarGz, "tgz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		defer gz.Close()
+		return parseTar(gz)
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported archive format: %q", format)
+	}
+}
+
+// =====================================================================================
+
+func parseZip(r io.Reader) ([]*MetaInfo, []error, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("reading zip archive: %w", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("opening zip archive: %w", err)
+	}
+
+	var torrents []*MetaInfo
+	var entryErrors []error
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || !isTorrentEntry(file.Name) {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			entryErrors = append(entryErrors, fmt.Errorf("%s: %w", file.Name, err))
+			continue
+		}
+		metaInfo, err := ParseReader(rc)
+		rc.Close()
+		if err != nil {
+			entryErrors = append(entryErrors, fmt.Errorf("%s: %w", file.Name, err))
+			continue
+		}
+		torrents = append(torrents, metaInfo)
+	}
+
+	return torrents, entryErrors, nil
+}
+
+func parseTar(r io.Reader) ([]*MetaInfo, []error, error) {
+	archive := tar.NewReader(r)
+
+	var torrents []*MetaInfo
+	var entryErrors []error
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return torrents, entryErrors, fmt.Errorf("reading tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg || !isTorrentEntry(header.Name) {
+			continue
+		}
+
+		metaInfo, err := ParseReader(archive)
+		if err != nil {
+			entryErrors = append(entryErrors, fmt.Errorf("%s: %w", header.Name, err))
+			continue
+		}
+		torrents = append(torrents, metaInfo)
+	}
+
+	return torrents, entryErrors, nil
+}
+
+func isTorrentEntry(name string) bool {
+	return strings.ToLower(path.Ext(name)) == ".torrent"
+}
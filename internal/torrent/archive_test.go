@@ -0,0 +1,108 @@
+package torrent
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// testArchiveEntries returns archive entries with two valid torrents, one malformed torrent
+// and one unrelated file that must be skipped.
+func testArchiveEntries(t *testing.T) map[string][]byte {
+	t.Helper()
+	single, err := bencode.Encode(singleFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi, err := bencode.Encode(multiFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string][]byte{
+		"collection/single.torrent": single,
+		"collection/multi.TORRENT":  multi,
+		"collection/broken.torrent": []byte("d8:announce"),
+		"collection/readme.txt":     []byte("not a torrent"),
+	}
+}
+
+// checkArchiveResult verifies that both valid torrents were parsed and the malformed one reported.
+func checkArchiveResult(t *testing.T, torrents []*MetaInfo, entryErrors []error, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected archive error: %v", err)
+	}
+	if len(torrents) != 2 {
+		t.Errorf("expected 2 parsed torrents, got %d", len(torrents))
+	}
+	if len(entryErrors) != 1 {
+		t.Fatalf("expected 1 entry error, got %d: %v", len(entryErrors), entryErrors)
+	}
+	if !strings.Contains(entryErrors[0].Error(), "broken.torrent") {
+		t.Errorf("expected entry error to name the malformed entry, got %v", entryErrors[0])
+	}
+}
+
+// TestParseArchiveZip verifies bulk parsing of a zip archive with a malformed entry.
+func TestParseArchiveZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range testArchiveEntries(t) {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	torrents, entryErrors, err := ParseArchive(&buf, ArchiveZip)
+	checkArchiveResult(t, torrents, entryErrors, err)
+}
+
+// TestParseArchiveTar verifies bulk parsing of a tar archive with a malformed entry.
+func TestParseArchiveTar(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, data := range testArchiveEntries(t) {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(data)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	torrents, entryErrors, err := ParseArchive(&buf, ArchiveTar)
+	checkArchiveResult(t, torrents, entryErrors, err)
+}
+
+// TestParseArchiveInvalid ensures that archive-level failures are reported through the final error.
+func TestParseArchiveInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{"unknown format", "rar"},
+		{"corrupt zip", ArchiveZip},
+		{"corrupt gzip", ArchiveTarGz},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := ParseArchive(strings.NewReader("garbage"), tc.format)
+			if err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+)
+
+// BlockSize is the conventional size of a block requested from peers (16 KiB).
+// Every block of a piece has this size except possibly the last one.
+const BlockSize = 16 * 1024
+
+// ErrPieceHashMismatch is returned when a fully assembled piece does not match its expected SHA-1 hash.
+var ErrPieceHashMismatch = errors.New("piece hash mismatch")
+
+// PieceAssembler collects the blocks of a single piece as they arrive from peers,
+// in any order, and verifies the piece against its expected SHA-1 hash once every block is present.
+//
+// A PieceAssembler is not safe for concurrent use.
+type PieceAssembler struct {
+	index     int      // index of the piece within the torrent
+	hash      [20]byte // expected SHA-1 hash of the piece
+	data      []byte   // piece buffer, blocks are copied to their offset
+	received  []bool   // received[n] reports whether block n has been stored
+	remaining int      // number of blocks still missing
+}
+
+// NewPieceAssembler returns an assembler for the piece at index with the given size in bytes
+// and expected SHA-1 hash, typically taken from InfoDict.Pieces.
+func NewPieceAssembler(index int, size int64, hash [20]byte) (*PieceAssembler, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid piece size: must be positive, got %d", size)
+	}
+
+	blocks := int((size + BlockSize - 1) / BlockSize)
+	return &PieceAssembler{
+		index:     index,
+		hash:      hash,
+		data:      make([]byte, size),
+		received:  make([]bool, blocks),
+		remaining: blocks,
+	}, nil
+}
+
+// Index returns the index of the piece being assembled.
+func (p *PieceAssembler) Index() int {
+	return p.index
+}
+
+// AddBlock stores a block starting at byte offset begin within the piece.
+// The offset must be aligned to BlockSize and the block must have its full expected length.
+// Receiving the same block twice overwrites the previous copy.
+//
+// Once the last missing block arrives, the piece is hashed: AddBlock returns true if it matched
+// the expected hash, or ErrPieceHashMismatch if not, in which case Reset should be called
+// before requesting the blocks again.
+func (p *PieceAssembler) AddBlock(begin int, data []byte) (bool, error) {
+	if begin < 0 || begin >= len(p.data) || begin%BlockSize != 0 {
+		return false, fmt.Errorf("piece %d: invalid block offset %d", p.index, begin)
+	}
+	if want := p.blockLength(begin); len(data) != want {
+		return false, fmt.Errorf("piece %d: invalid block length at offset %d: expected %d, got %d", p.index, begin, want, len(data))
+	}
+
+	block := begin / BlockSize
+	copy(p.data[begin:], data)
+	if !p.received[block] {
+		p.received[block] = true
+		p.remaining--
+	}
+
+	if p.remaining > 0 {
+		return false, nil
+	}
+	if sha1.Sum(p.data) != p.hash {
+		return false, fmt.Errorf("piece %d: %w", p.index, ErrPieceHashMismatch)
+	}
+	return true, nil
+}
+
+// Complete reports whether every block of the piece has been received.
+func (p *PieceAssembler) Complete() bool {
+	return p.remaining == 0
+}
+
+// Missing returns the offsets of the blocks that have not been received yet, in ascending order.
+func (p *PieceAssembler) Missing() []int {
+	missing := make([]int, 0, p.remaining)
+	for block, ok := range p.received {
+		if !ok {
+			missing = append(missing, block*BlockSize)
+		}
+	}
+	return missing
+}
+
+// Bytes returns the assembled piece data. The contents are only meaningful once
+// AddBlock has reported a successful verification.
+func (p *PieceAssembler) Bytes() []byte {
+	return p.data
+}
+
+// Reset discards every received block so the piece can be requested again,
+// typically after a hash mismatch.
+func (p *PieceAssembler) Reset() {
+	clear(p.data)
+	clear(p.received)
+	p.remaining = len(p.received)
+}
+
+// blockLength returns the expected length of the block starting at begin.
+func (p *PieceAssembler) blockLength(begin int) int {
+	return min(BlockSize, len(p.data)-begin)
+}
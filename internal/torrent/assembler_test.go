@@ -0,0 +1,128 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"testing"
+)
+
+// makePiece returns deterministic piece content of the given size.
+func makePiece(size int) []byte {
+	piece := make([]byte, size)
+	for i := range piece {
+		piece[i] = byte(i * 7)
+	}
+	return piece
+}
+
+// TestPieceAssemblerOrder verifies that a piece is assembled and verified
+// regardless of the order its blocks arrive in, including a short final block.
+func TestPieceAssemblerOrder(t *testing.T) {
+	piece := makePiece(2*BlockSize + 100)
+	hash := sha1.Sum(piece)
+
+	tests := []struct {
+		name  string
+		order []int // block offsets in arrival order
+	}{
+		{"in order", []int{0, BlockSize, 2 * BlockSize}},
+		{"out of order", []int{2 * BlockSize, 0, BlockSize}},
+		{"duplicate block", []int{BlockSize, BlockSize, 0, 2 * BlockSize}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pa, err := NewPieceAssembler(3, int64(len(piece)), hash)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			for i, begin := range tc.order {
+				end := min(begin+BlockSize, len(piece))
+				ok, err := pa.AddBlock(begin, piece[begin:end])
+				if err != nil {
+					t.Fatalf("AddBlock(%d) returned error: %v", begin, err)
+				}
+				last := i == len(tc.order)-1
+				if ok != last {
+					t.Fatalf("AddBlock(%d) = %v, want %v", begin, ok, last)
+				}
+			}
+
+			if !pa.Complete() {
+				t.Error("expected piece to be complete")
+			}
+			if !bytes.Equal(pa.Bytes(), piece) {
+				t.Error("assembled piece does not match original content")
+			}
+		})
+	}
+}
+
+// TestPieceAssemblerCorruptBlock ensures that a corrupted block is detected on completion
+// and that the piece can be verified after a reset and re-download.
+func TestPieceAssemblerCorruptBlock(t *testing.T) {
+	piece := makePiece(2 * BlockSize)
+	hash := sha1.Sum(piece)
+
+	pa, err := NewPieceAssembler(0, int64(len(piece)), hash)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	corrupt := bytes.Clone(piece[BlockSize:])
+	corrupt[42] ^= 0xff
+
+	if _, err := pa.AddBlock(0, piece[:BlockSize]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ok, err := pa.AddBlock(BlockSize, corrupt)
+	if ok || !errors.Is(err, ErrPieceHashMismatch) {
+		t.Fatalf("AddBlock with corrupt block = (%v, %v), want (false, %v)", ok, err, ErrPieceHashMismatch)
+	}
+
+	pa.Reset()
+	if pa.Complete() {
+		t.Fatal("expected piece to be incomplete after reset")
+	}
+	if missing := pa.Missing(); len(missing) != 2 {
+		t.Fatalf("expected 2 missing blocks after reset, got %v", missing)
+	}
+
+	if _, err := pa.AddBlock(BlockSize, piece[BlockSize:]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ok, err = pa.AddBlock(0, piece[:BlockSize])
+	if err != nil || !ok {
+		t.Fatalf("AddBlock after reset = (%v, %v), want (true, nil)", ok, err)
+	}
+}
+
+// TestPieceAssemblerInvalidBlock ensures that misaligned, out-of-range and wrongly sized blocks are rejected.
+func TestPieceAssemblerInvalidBlock(t *testing.T) {
+	pa, err := NewPieceAssembler(0, BlockSize+10, [20]byte{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		begin int
+		size  int
+	}{
+		{"misaligned offset", 1, BlockSize},
+		{"negative offset", -BlockSize, BlockSize},
+		{"offset past end", 2 * BlockSize, 10},
+		{"short block", 0, BlockSize - 1},
+		{"long final block", BlockSize, 11},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := pa.AddBlock(tc.begin, make([]byte, tc.size)); err == nil {
+				t.Errorf("expected error for block at %d with length %d, got nil", tc.begin, tc.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package torrent
+
+// Bitfield records which pieces of a torrent are available, one bit per piece.
+// The high bit of the first byte corresponds to piece 0, matching the layout
+// of the peer wire protocol's bitfield message. Spare bits at the end are zero.
+//
+// Reference: https://wiki.theory.org/BitTorrentSpecification#bitfield:_.3Clen.3D0001.2BX.3E.3Cid.3D5.3E.3Cbitfield.3E
+type Bitfield []byte
+
+// NewBitfield returns an empty Bitfield large enough to hold numPieces bits.
+func NewBitfield(numPieces int) Bitfield {
+	return make(Bitfield, (numPieces+7)/8)
+}
+
+// Has reports whether the bit for the piece at index is set.
+// Indices outside the bitfield are reported as not set.
+func (b Bitfield) Has(index int) bool {
+	byteIndex := index / 8
+	if index < 0 || byteIndex >= len(b) {
+		return false
+	}
+	return b[byteIndex]>>(7-uint(index%8))&1 != 0
+}
+
+// Set marks the piece at index as available. Indices outside the bitfield are ignored.
+func (b Bitfield) Set(index int) {
+	byteIndex := index / 8
+	if index < 0 || byteIndex >= len(b) {
+		return
+	}
+	b[byteIndex] |= 1 << (7 - uint(index%8))
+}
+
+// Clear marks the piece at index as unavailable. Indices outside the bitfield are ignored.
+func (b Bitfield) Clear(index int) {
+	byteIndex := index / 8
+	if index < 0 || byteIndex >= len(b) {
+		return
+	}
+	b[byteIndex] &^= 1 << (7 - uint(index%8))
+}
+
+// Count returns the number of pieces set among the first numPieces bits.
+func (b Bitfield) Count(numPieces int) int {
+	count := 0
+	for i := 0; i < numPieces; i++ {
+		if b.Has(i) {
+			count++
+		}
+	}
+	return count
+}
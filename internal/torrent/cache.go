@@ -0,0 +1,105 @@
+package torrent
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+)
+
+// Cache is a concurrency-safe cache of parsed torrents keyed by info hash,
+// with optional least-recently-used eviction. Pure v2 torrents, which have no v1 info hash,
+// are keyed by their v2 info hash truncated to 20 bytes, as used in the swarm.
+//
+// Cached MetaInfo values are shared between every caller of Get and must be treated
+// as immutable: modifying a cached torrent affects all other users of the cache.
+// Copy the value before making changes.
+type Cache struct {
+	mu         sync.RWMutex
+	maxEntries int                           // maximum number of entries, zero means unlimited
+	entries    map[infohash.V1]*list.Element // info hash to element of order
+	order      *list.List                    // cached torrents, most recently used at the front
+}
+
+// NewCache returns an empty Cache holding at most maxEntries torrents, evicting the
+// least recently used one when full. A maxEntries of zero or less disables eviction.
+func NewCache(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries: max(maxEntries, 0),
+		entries:    make(map[infohash.V1]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get returns the cached torrent with the given info hash, if present,
+// and marks it as the most recently used one.
+func (c *Cache) Get(hash infohash.V1) (*MetaInfo, bool) {
+	if c.maxEntries == 0 {
+		// recency is irrelevant without eviction, so concurrent readers can share the lock
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		elem, ok := c.entries[hash]
+		if !ok {
+			return nil, false
+		}
+		return elem.Value.(*MetaInfo), true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*MetaInfo), true
+}
+
+// Put stores t under its info hash, replacing any torrent cached with the same hash.
+// If the cache is full, the least recently used torrent is evicted. Nil values are ignored.
+func (c *Cache) Put(t *MetaInfo) {
+	if t == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := t.cacheKey()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = t
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(t)
+	if c.maxEntries > 0 && c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*MetaInfo).cacheKey())
+	}
+}
+
+// Remove deletes the torrent with the given info hash from the cache, if present.
+func (c *Cache) Remove(hash infohash.V1) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[hash]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, hash)
+	}
+}
+
+// Len returns the number of cached torrents.
+func (c *Cache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.entries)
+}
+
+// cacheKey returns the hash a torrent is cached under.
+func (t *MetaInfo) cacheKey() infohash.V1 {
+	if !t.HasV1() && t.HasV2() {
+		return t.InfoHashV2.Truncate()
+	}
+	return t.InfoHash
+}
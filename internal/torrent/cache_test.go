@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"sync"
+	"testing"
+)
+
+// cachedTorrent returns a minimal MetaInfo whose info hash starts with the given byte.
+func cachedTorrent(id byte) *MetaInfo {
+	return &MetaInfo{InfoHash: [20]byte{id}}
+}
+
+// TestCacheEviction verifies least-recently-used eviction and that Get refreshes recency.
+func TestCacheEviction(t *testing.T) {
+	cache := NewCache(2)
+	cache.Put(cachedTorrent(1))
+	cache.Put(cachedTorrent(2))
+
+	if _, ok := cache.Get([20]byte{1}); !ok { // 1 becomes the most recently used
+		t.Fatal("expected torrent 1 to be cached")
+	}
+	cache.Put(cachedTorrent(3)) // evicts 2
+
+	if _, ok := cache.Get([20]byte{2}); ok {
+		t.Error("expected torrent 2 to be evicted")
+	}
+	for _, id := range []byte{1, 3} {
+		if _, ok := cache.Get([20]byte{id}); !ok {
+			t.Errorf("expected torrent %d to be cached", id)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("expected 2 entries, got %d", cache.Len())
+	}
+
+	replacement := cachedTorrent(3)
+	cache.Put(replacement)
+	if got, _ := cache.Get([20]byte{3}); got != replacement {
+		t.Error("expected Put to replace the torrent with the same info hash")
+	}
+
+	cache.Remove([20]byte{3})
+	if _, ok := cache.Get([20]byte{3}); ok || cache.Len() != 1 {
+		t.Error("expected torrent 3 to be removed")
+	}
+}
+
+// TestCacheConcurrent exercises concurrent readers and writers, meant to be run with -race.
+func TestCacheConcurrent(t *testing.T) {
+	for _, maxEntries := range []int{0, 8} {
+		cache := NewCache(maxEntries)
+		var wg sync.WaitGroup
+		for worker := 0; worker < 8; worker++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					id := byte((worker*31 + i) % 16)
+					cache.Put(cachedTorrent(id))
+					if got, ok := cache.Get([20]byte{id}); ok && got.InfoHash[0] != id {
+						t.Errorf("Get(%d) returned torrent %d", id, got.InfoHash[0])
+					}
+					cache.Len()
+				}
+			}(worker)
+		}
+		wg.Wait()
+
+		if maxEntries > 0 && cache.Len() > maxEntries {
+			t.Errorf("expected at most %d entries, got %d", maxEntries, cache.Len())
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package torrent
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lcsabi/gobit/internal/merkle"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// bounds of the automatically selected piece length
+const (
+	minAutoPieceLength = BlockSize
+	maxAutoPieceLength = 16 * 1024 * 1024
+	targetPieceCount   = 1500
+)
+
+// CreateOptions configures the torrent produced by Create.
+// The zero value creates a public torrent without trackers and with an automatic piece length.
+type CreateOptions struct {
+	// PieceLength is the number of bytes per piece, which must be a power of two.
+	// Zero selects the smallest power of two between 16 KiB and 16 MiB that keeps the
+	// torrent at around 1500 pieces.
+	PieceLength int64
+
+	// Trackers lists the tracker URLs in tiers. The first URL becomes 'announce' and,
+	// if there is more than one URL, all tiers become the announce-list.
+	Trackers [][]string
+
+	Private   bool     // restricts peer discovery to the trackers
+	Comment   string   // free-form comment
+	CreatedBy string   // name and version of the program creating the torrent
+	Source    string   // tag of the tracker or community the torrent is made for, stored in the info dictionary
+	WebSeeds  []string // URLs serving the content over HTTP, stored in the url-list (BEP 19)
+
+	// AlignFiles inserts a padding file (BEP 47) after every file of a multi-file torrent that
+	// does not end on a piece boundary, so that each file starts a piece of its own and no
+	// piece mixes the content of two files.
+	AlignFiles bool
+
+	// FileAttributes marks executable files as such and includes the symbolic links below a
+	// directory that point within it, as the file attributes of BEP 47. Otherwise symbolic
+	// links are skipped.
+	FileAttributes bool
+
+	// Hybrid also describes the content as a BitTorrent v2 torrent (BEP 52), with a file tree
+	// and piece layers next to the SHA-1 pieces, so that v1 and v2 clients can share it. It
+	// implies AlignFiles, and the piece length must be at least 16 KiB. Symbolic links are
+	// left out of the file tree, which has no file attributes.
+	Hybrid bool
+
+	// Hash configures the workers hashing the content and reports their progress.
+	Hash HashOptions
+}
+
+// Create builds a v1 torrent, or a hybrid torrent if opts.Hybrid is set, for the file or
+// directory at rootPath, hashing its content into pieces in parallel as configured by
+// opts.Hash. A directory becomes a multi-file torrent containing every regular file below it
+// in lexical path order; symbolic links, unless opts.FileAttributes is set, and other special
+// files are skipped. The torrent is named after the last element of rootPath.
+//
+// Use WriteTo or Save to emit the resulting .torrent file.
+func Create(rootPath string, opts CreateOptions) (*MetaInfo, error) {
+	if opts.PieceLength < 0 || opts.PieceLength&(opts.PieceLength-1) != 0 {
+		return nil, fmt.Errorf("invalid '%s' %d: must be a power of two", keyPieceLength, opts.PieceLength)
+	}
+	if opts.Hybrid && opts.PieceLength != 0 && opts.PieceLength < BlockSize {
+		return nil, fmt.Errorf("invalid hybrid '%s' %d: must be at least %d", keyPieceLength, opts.PieceLength, BlockSize)
+	}
+
+	rootPath = filepath.Clean(rootPath)
+	files, sources, err := collectFiles(rootPath, opts.FileAttributes)
+	if err != nil {
+		return nil, err
+	}
+
+	info := InfoDict{
+		Name:      filepath.Base(rootPath),
+		Files:     files,
+		Source:    opts.Source,
+		multiFile: len(sources) != 1 || sources[0] != rootPath,
+	}
+	if opts.Private {
+		private := bencode.Integer(1)
+		info.Private = &private
+	}
+
+	info.PieceLength = opts.PieceLength
+	if info.PieceLength == 0 {
+		info.PieceLength = choosePieceLength(info.TotalLength())
+	}
+	if opts.AlignFiles || opts.Hybrid {
+		info.Files, sources = alignFiles(files, sources, info.PieceLength)
+	}
+	if info.TotalLength() == 0 {
+		return nil, errors.New("cannot create a torrent without content")
+	}
+
+	info.Pieces = make([][20]byte, (info.TotalLength()+info.PieceLength-1)/info.PieceLength)
+
+	// block hashes of the content of each piece, without the padding, for the v2 merkle trees
+	var dataLengths []int64
+	var pieceLeaves [][][32]byte
+	if opts.Hybrid {
+		dataLengths = pieceDataLengths(&info)
+		pieceLeaves = make([][][32]byte, len(dataLengths))
+	}
+
+	content := newSourceReader(&info, func(fileIndex int) string { return sources[fileIndex] })
+	defer content.Close()
+	err = ForEachPiece(context.Background(), len(info.Pieces), opts.Hash, func(index int) error {
+		piece := make([]byte, info.PieceSize(index))
+		ok, err := content.ReadAt(piece, int64(index)*info.PieceLength)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("content of %s changed while hashing", rootPath)
+		}
+		info.Pieces[index] = sha1.Sum(piece)
+		if pieceLeaves != nil {
+			pieceLeaves[index] = blockHashes(piece[:dataLengths[index]])
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MetaInfo{Info: info, Comment: opts.Comment, CreatedBy: opts.CreatedBy, URLList: slices.Clone(opts.WebSeeds)}
+	if opts.Hybrid {
+		result.Info.MetaVersion = 2
+		result.Info.FileTree, result.PieceLayers = hybridFileTree(&result.Info, pieceLeaves)
+	}
+	var trackers int
+	for _, tier := range opts.Trackers {
+		if len(tier) == 0 {
+			continue
+		}
+		if result.Announce == "" {
+			result.Announce = tier[0]
+		}
+		result.AnnounceList = append(result.AnnounceList, append([]string(nil), tier...))
+		trackers += len(tier)
+	}
+	if trackers < 2 {
+		result.AnnounceList = nil
+	}
+
+	if err := result.hashInfo(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// WriteTo writes the bencoded .torrent file to w, implementing io.WriterTo.
+func (t *MetaInfo) WriteTo(w io.Writer) (int64, error) {
+	encoded, err := t.Encode()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := w.Write(encoded)
+	if err != nil {
+		return int64(n), fmt.Errorf("writing torrent: %w", err)
+	}
+	return int64(n), nil
+}
+
+// Save writes the bencoded .torrent file to path, replacing any existing file.
+// The file is written to a temporary file next to path first and renamed into place,
+// so rewriting a torrent in place never leaves a truncated file behind.
+func (t *MetaInfo) Save(path string) error {
+	encoded, err := t.Encode()
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	if _, err := f.Write(encoded); err != nil {
+		f.Close()
+		return fmt.Errorf("writing torrent: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// hashInfo computes the info hashes of a torrent built in code from its info dictionary.
+func (t *MetaInfo) hashInfo() error {
+	info, err := t.Info.ToDictionary()
+	if err != nil {
+		return err
+	}
+	encodedInfo, err := bencode.Encode(info)
+	if err != nil {
+		return fmt.Errorf("encoding '%s': %w", keyInfo, err)
+	}
+
+	t.setInfoHashes(encodedInfo)
+	return nil
+}
+
+// collectFiles returns the torrent files found at rootPath along with the path of each on disk.
+// A regular file yields itself, a directory every regular file below it. With attrs set,
+// executable files are marked as such and a directory also yields the symbolic links pointing
+// within it, which have no path on disk.
+func collectFiles(rootPath string, attrs bool) ([]FileInfo, []string, error) {
+	stat, err := os.Stat(rootPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stat.Mode().IsRegular() {
+		name := filepath.Base(rootPath)
+		file := FileInfo{Length: stat.Size(), Path: []bencode.ByteString{name}, Attr: fileAttr(stat.Mode(), attrs)}
+		return []FileInfo{file}, []string{rootPath}, nil
+	}
+	if !stat.IsDir() {
+		return nil, nil, fmt.Errorf("%s is neither a regular file nor a directory", rootPath)
+	}
+
+	var files []FileInfo
+	var sources []string
+	err = filepath.WalkDir(rootPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(rootPath, path)
+		if err != nil {
+			return err
+		}
+		if attrs && d.Type()&fs.ModeSymlink != 0 {
+			target, err := symlinkPath(rootPath, path)
+			if err != nil || target == nil {
+				return err
+			}
+			files = append(files, FileInfo{
+				Path:        strings.Split(filepath.ToSlash(relative), "/"),
+				Attr:        string(AttrSymlink),
+				SymlinkPath: target,
+			})
+			sources = append(sources, "")
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		fileInfo, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, FileInfo{
+			Length: fileInfo.Size(),
+			Path:   strings.Split(filepath.ToSlash(relative), "/"),
+			Attr:   fileAttr(fileInfo.Mode(), attrs),
+		})
+		sources = append(sources, path)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("walking %s: %w", rootPath, err)
+	}
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("%s contains no files", rootPath)
+	}
+	return files, sources, nil
+}
+
+// fileAttr returns the attributes of a regular file of the given mode, if attrs is set.
+func fileAttr(mode fs.FileMode, attrs bool) string {
+	if attrs && mode&0o111 != 0 {
+		return string(AttrExecutable)
+	}
+	return ""
+}
+
+// symlinkPath returns the target of the symbolic link at path as components relative to
+// rootPath, or nil if it points outside of rootPath.
+func symlinkPath(rootPath, path string) ([]bencode.ByteString, error) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(path), target)
+	}
+	if rootPath, err = filepath.Abs(rootPath); err != nil {
+		return nil, err
+	}
+	if target, err = filepath.Abs(target); err != nil {
+		return nil, err
+	}
+	relative, err := filepath.Rel(rootPath, target)
+	if err != nil || relative == "." || relative == ".." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) {
+		return nil, nil
+	}
+	return strings.Split(filepath.ToSlash(relative), "/"), nil
+}
+
+// alignFiles inserts a padding file after every file but the last whose end is not a multiple
+// of pieceLength, returning the files along with their sources, empty for padding files.
+// Padding files are named .pad/<size>, as other clients name them.
+func alignFiles(files []FileInfo, sources []string, pieceLength int64) ([]FileInfo, []string) {
+	var alignedFiles []FileInfo
+	var alignedSources []string
+	var offset int64
+	for idx, file := range files {
+		alignedFiles = append(alignedFiles, file)
+		alignedSources = append(alignedSources, sources[idx])
+		offset += file.Length
+		if idx == len(files)-1 || offset%pieceLength == 0 {
+			continue
+		}
+
+		size := pieceLength - offset%pieceLength
+		alignedFiles = append(alignedFiles, FileInfo{
+			Length: size,
+			Path:   []string{".pad", strconv.FormatInt(size, 10)},
+			Attr:   string(AttrPadding),
+		})
+		alignedSources = append(alignedSources, "")
+		offset += size
+	}
+	return alignedFiles, alignedSources
+}
+
+// pieceDataLengths returns the number of bytes of file content in each piece of an aligned
+// torrent, whose pieces each hold the content of a single file followed by padding.
+func pieceDataLengths(info *InfoDict) []int64 {
+	lengths := make([]int64, len(info.Pieces))
+	var fileStart int64
+	for _, file := range info.Files {
+		fileEnd := fileStart + file.Length
+		if !file.IsPadding() {
+			for pieceStart := fileStart; pieceStart < fileEnd; pieceStart += info.PieceLength {
+				lengths[pieceStart/info.PieceLength] = min(info.PieceLength, fileEnd-pieceStart)
+			}
+		}
+		fileStart = fileEnd
+	}
+	return lengths
+}
+
+// blockHashes returns the v2 leaf hashes of data, one for each block.
+func blockHashes(data []byte) [][32]byte {
+	leaves := make([][32]byte, 0, (len(data)+BlockSize-1)/BlockSize)
+	for begin := 0; begin < len(data); begin += BlockSize {
+		leaves = append(leaves, merkle.HashBlock(data[begin:min(begin+BlockSize, len(data))]))
+	}
+	return leaves
+}
+
+// hybridFileTree returns the v2 file tree of an aligned torrent and the piece layers of its
+// files larger than a piece, from the block hashes of each of its pieces.
+func hybridFileTree(info *InfoDict, pieceLeaves [][][32]byte) ([]FileTreeEntry, map[[32]byte][][32]byte) {
+	blocksPerPiece := int(info.PieceLength / BlockSize)
+	padding := merkle.PadHash(bits.TrailingZeros(uint(blocksPerPiece)))
+
+	var entries []FileTreeEntry
+	layers := make(map[[32]byte][][32]byte)
+	var fileStart int64
+	for _, file := range info.Files {
+		first := int(fileStart / info.PieceLength)
+		fileStart += file.Length
+		if file.IsPadding() || file.IsSymlink() {
+			continue
+		}
+		entry := FileTreeEntry{Path: file.Path, Length: file.Length}
+		if file.Length == 0 {
+			entries = append(entries, entry)
+			continue
+		}
+
+		count := int((file.Length + info.PieceLength - 1) / info.PieceLength)
+		if count == 1 {
+			entry.PiecesRoot = merkle.Root(pieceLeaves[first], [32]byte{})
+			entries = append(entries, entry)
+			continue
+		}
+		layer := make([][32]byte, count)
+		for idx := range layer {
+			leaves := make([][32]byte, blocksPerPiece) // the last piece is padded with zero hashes
+			copy(leaves, pieceLeaves[first+idx])
+			layer[idx] = merkle.Root(leaves, [32]byte{})
+		}
+		entry.PiecesRoot = merkle.Root(layer, padding)
+		layers[entry.PiecesRoot] = layer
+		entries = append(entries, entry)
+	}
+	return entries, layers
+}
+
+// choosePieceLength returns the smallest power of two within the automatic bounds that splits
+// totalLength into at most targetPieceCount pieces.
+func choosePieceLength(totalLength int64) int64 {
+	pieceLength := int64(minAutoPieceLength)
+	for pieceLength < maxAutoPieceLength && totalLength > pieceLength*targetPieceCount {
+		pieceLength *= 2
+	}
+	return pieceLength
+}
@@ -0,0 +1,333 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/merkle"
+)
+
+// writeContent creates the given files, keyed by slash-separated path, below dir.
+func writeContent(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestCreateDirectory creates a multi-file torrent and verifies its layout, pieces and saved form.
+func TestCreateDirectory(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "album")
+	first, second, third := makePiece(20000), makePiece(5000), makePiece(30000)
+	writeContent(t, root, map[string][]byte{
+		"b.bin":        second,
+		"a.bin":        first,
+		"disc 2/c.bin": third,
+	})
+
+	opts := CreateOptions{
+		PieceLength: 16384,
+		Trackers:    [][]string{{"http://a.example.com/announce"}, {"udp://b.example.com:6969"}},
+		Private:     true,
+		Comment:     "created in a test",
+		CreatedBy:   "gobit test",
+		Source:      "TEST",
+		WebSeeds:    []string{"https://seed.example.com/files/"},
+	}
+	var hashed int
+	opts.Hash = HashOptions{Workers: 3, Progress: func(done, total int) { hashed = done }}
+	mi, err := Create(root, opts)
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	if hashed != mi.Info.NumPieces() {
+		t.Errorf("progress reported %d pieces, want %d", hashed, mi.Info.NumPieces())
+	}
+
+	var paths []string
+	for _, file := range mi.Info.Files {
+		paths = append(paths, strings.Join(file.Path, "/"))
+	}
+	if expected := []string{"a.bin", "b.bin", "disc 2/c.bin"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("file paths = %q, want %q", paths, expected)
+	}
+	if mi.Info.Name != "album" || !mi.Info.IsMultiFile() {
+		t.Errorf("unexpected name %q or layout", mi.Info.Name)
+	}
+
+	content := bytes.Join([][]byte{first, second, third}, nil)
+	if mi.Info.NumPieces() != 4 {
+		t.Fatalf("NumPieces() = %d, want 4", mi.Info.NumPieces())
+	}
+	for i, piece := range mi.Info.Pieces {
+		end := min((i+1)*16384, len(content))
+		if piece != sha1.Sum(content[i*16384:end]) {
+			t.Errorf("hash of piece %d does not match the content", i)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "album.torrent")
+	if err := mi.Save(path); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	parsed, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() of saved torrent returned error: %v", err)
+	}
+	if parsed.InfoHash != mi.InfoHash {
+		t.Errorf("parsed info hash %x, want %x", parsed.InfoHash, mi.InfoHash)
+	}
+	if parsed.Announce != "http://a.example.com/announce" || len(parsed.AnnounceList) != 2 {
+		t.Errorf("unexpected trackers %q, %q", parsed.Announce, parsed.AnnounceList)
+	}
+	if parsed.Info.Private == nil || *parsed.Info.Private != 1 || parsed.Info.Source != "TEST" || parsed.Comment != opts.Comment ||
+		parsed.CreatedBy != opts.CreatedBy || !reflect.DeepEqual(parsed.URLList, opts.WebSeeds) {
+		t.Errorf("options not carried over: %+v", parsed)
+	}
+}
+
+// TestCreateSingleFile creates a single-file torrent with an automatic piece length.
+func TestCreateSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	writeContent(t, dir, map[string][]byte{"file.txt": makePiece(1000)})
+
+	mi, err := Create(filepath.Join(dir, "file.txt"), CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	if mi.Info.IsMultiFile() || mi.Info.PieceLength != minAutoPieceLength || mi.Info.NumPieces() != 1 {
+		t.Errorf("unexpected info dictionary: %+v", mi.Info)
+	}
+	if mi.Announce != "" || mi.AnnounceList != nil || mi.Info.Private != nil {
+		t.Errorf("expected no trackers and a public torrent, got %+v", mi)
+	}
+
+	var out bytes.Buffer
+	if _, err := mi.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo() returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "6:lengthi1000e4:name8:file.txt") {
+		t.Errorf("expected single-file form, got %q", out.String())
+	}
+}
+
+// TestCreateAlignFiles creates a torrent with padding files, checks that every file starts a
+// piece and that the padding survives saving, and scans the content back without padding files.
+func TestCreateAlignFiles(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "album")
+	first, second, third := makePiece(20000), makePiece(5000), makePiece(30000)
+	writeContent(t, root, map[string][]byte{"a.bin": first, "b.bin": second, "c.bin": third})
+
+	mi, err := Create(root, CreateOptions{PieceLength: 16384, AlignFiles: true})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	var paths []string
+	for _, file := range mi.Info.Files {
+		paths = append(paths, strings.Join(file.Path, "/"))
+	}
+	if expected := []string{"a.bin", ".pad/12768", "b.bin", ".pad/11384", "c.bin"}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("file paths = %q, want %q", paths, expected)
+	}
+
+	content := bytes.Join([][]byte{first, make([]byte, 12768), second, make([]byte, 11384), third}, nil)
+	if mi.Info.NumPieces() != 5 {
+		t.Fatalf("NumPieces() = %d, want 5", mi.Info.NumPieces())
+	}
+	for i, piece := range mi.Info.Pieces {
+		end := min((i+1)*16384, len(content))
+		if piece != sha1.Sum(content[i*16384:end]) {
+			t.Errorf("hash of piece %d does not match the padded content", i)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "album.torrent")
+	if err := mi.Save(path); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	parsed, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() of saved torrent returned error: %v", err)
+	}
+	if parsed.InfoHash != mi.InfoHash || !parsed.Info.Files[1].IsPadding() || parsed.Info.Files[2].IsPadding() {
+		t.Errorf("padding not carried over: %+v", parsed.Info.Files)
+	}
+	if violations := Lint(parsed).Violations(); len(violations) > 0 {
+		t.Errorf("Lint() reported %v", violations)
+	}
+
+	if _, percent, err := parsed.ScanProgress(dir); err != nil || percent != 100 {
+		t.Errorf("ScanProgress() = %v%%, %v, want 100%%", percent, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".pad")); !os.IsNotExist(err) {
+		t.Errorf("padding directory exists: %v", err)
+	}
+}
+
+// TestCreateHybrid creates a hybrid torrent and checks that its v1 pieces and v2 merkle trees
+// describe the same content once saved and parsed back.
+func TestCreateHybrid(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "album")
+	first, second := makePiece(70000), makePiece(5000)
+	writeContent(t, root, map[string][]byte{"a.bin": first, "b.bin": second, "c.empty": nil})
+
+	mi, err := Create(root, CreateOptions{PieceLength: 32768, Hybrid: true})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "album.torrent")
+	if err := mi.Save(path); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	parsed, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() of saved torrent returned error: %v", err)
+	}
+	if !parsed.IsHybrid() || parsed.InfoHash != mi.InfoHash || parsed.InfoHashV2 != mi.InfoHashV2 {
+		t.Fatalf("parsed torrent is not the same hybrid: %x %x", parsed.InfoHash, parsed.InfoHashV2)
+	}
+	if err := parsed.Validate(); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range parsed.Info.FileTree {
+		paths = append(paths, strings.Join(entry.Path, "/"))
+	}
+	if expected := []string{"a.bin", "b.bin", "c.empty"}; !reflect.DeepEqual(paths, expected) {
+		t.Fatalf("file tree paths = %q, want %q", paths, expected)
+	}
+	if got := parsed.Info.FileTree[1].PiecesRoot; got != sha256.Sum256(second) {
+		t.Errorf("pieces root of a single block file = %x, want the hash of the block", got)
+	}
+	if len(parsed.PieceLayers) != 1 || len(parsed.PieceLayers[parsed.Info.FileTree[0].PiecesRoot]) != 3 {
+		t.Errorf("piece layers = %x, want 3 hashes for a.bin", parsed.PieceLayers)
+	}
+
+	// every block of the pieces of a.bin hashes up to its piece layer hash
+	for index := range 3 {
+		tree, ok := parsed.PieceTree(index)
+		if !ok {
+			t.Fatalf("PieceTree(%d) returned no tree", index)
+		}
+		leaves := make([][32]byte, tree.Leaves)
+		data := first[index*32768 : index*32768+int(tree.Length)]
+		for begin := 0; begin < len(data); begin += BlockSize {
+			leaves[begin/BlockSize] = sha256.Sum256(data[begin:min(begin+BlockSize, len(data))])
+		}
+		if !merkle.Verify(leaves, tree.Index, nil, tree.Hash) {
+			t.Errorf("blocks of piece %d do not match its piece layer hash", index)
+		}
+	}
+	if _, percent, err := parsed.ScanProgress(dir); err != nil || percent != 100 {
+		t.Errorf("ScanProgress() = %v%%, %v, want 100%%", percent, err)
+	}
+}
+
+// TestCreateFileAttributes creates a torrent of a directory holding an executable file and
+// symbolic links, of which only the one pointing within the directory is included.
+func TestCreateFileAttributes(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "app")
+	writeContent(t, root, map[string][]byte{"bin/run": makePiece(100), "lib/data": makePiece(200)})
+	if err := os.Chmod(filepath.Join(root, "bin", "run"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "lib", "data"), filepath.Join(root, "bin", "data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(root, "outside")); err != nil {
+		t.Fatal(err)
+	}
+
+	without, err := Create(root, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	if len(without.Info.Files) != 2 || without.Info.Files[0].Attr != "" {
+		t.Errorf("files without attributes = %+v", without.Info.Files)
+	}
+
+	mi, err := Create(root, CreateOptions{FileAttributes: true})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	expected := []FileInfo{
+		{Path: []string{"bin", "data"}, Attr: "l", SymlinkPath: []string{"lib", "data"}},
+		{Length: 100, Path: []string{"bin", "run"}, Attr: "x"},
+		{Length: 200, Path: []string{"lib", "data"}},
+	}
+	if !reflect.DeepEqual(mi.Info.Files, expected) {
+		t.Fatalf("files = %+v, want %+v", mi.Info.Files, expected)
+	}
+	if target, err := mi.Info.SymlinkTarget(0); err != nil || target != filepath.Join("..", "lib", "data") {
+		t.Errorf("SymlinkTarget(0) = %q, %v", target, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.torrent")
+	if err := mi.Save(path); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	parsed, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() of saved torrent returned error: %v", err)
+	}
+	if parsed.InfoHash != mi.InfoHash || !reflect.DeepEqual(parsed.Info.Files, expected) {
+		t.Errorf("attributes not carried over: %+v", parsed.Info.Files)
+	}
+}
+
+// TestCreateInvalid ensures that unusable inputs are rejected.
+func TestCreateInvalid(t *testing.T) {
+	empty := t.TempDir()
+	emptyFile := t.TempDir()
+	writeContent(t, emptyFile, map[string][]byte{"empty": nil})
+
+	tests := []struct {
+		name string
+		path string
+		opts CreateOptions
+	}{
+		{"missing path", filepath.Join(empty, "missing"), CreateOptions{}},
+		{"empty directory", empty, CreateOptions{}},
+		{"no content", emptyFile, CreateOptions{}},
+		{"piece length not a power of two", emptyFile, CreateOptions{PieceLength: 1000}},
+		{"hybrid piece length below a block", emptyFile, CreateOptions{PieceLength: 8192, Hybrid: true}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Create(tc.path, tc.opts); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestChoosePieceLength checks the bounds of the automatic piece length.
+func TestChoosePieceLength(t *testing.T) {
+	for totalLength, expected := range map[int64]int64{
+		1:                16 * 1024,
+		1500 * 16 * 1024: 16 * 1024,
+		1500*16*1024 + 1: 32 * 1024,
+		4 << 30:          4 << 20,
+		1 << 50:          16 << 20,
+	} {
+		if got := choosePieceLength(totalLength); got != expected {
+			t.Errorf("choosePieceLength(%d) = %d, want %d", totalLength, got, expected)
+		}
+	}
+}
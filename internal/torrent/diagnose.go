@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// DiagnosticKind classifies a problem found by DiagnoseTorrent.
+type DiagnosticKind int
+
+const (
+	// DiagnosticDecode means the data is not valid bencode, even with lenient decoding.
+	DiagnosticDecode DiagnosticKind = iota
+	// DiagnosticLengthWhitespace means byte string length prefixes contain whitespace, e.g. "4 :spam".
+	DiagnosticLengthWhitespace
+	// DiagnosticStructure means the data is valid bencode but not a valid torrent.
+	DiagnosticStructure
+)
+
+// Diagnostic describes a problem found in raw torrent data.
+type Diagnostic struct {
+	Kind        DiagnosticKind
+	Message     string
+	Recoverable bool // whether parsing succeeds with ParseOptions.Lenient despite this problem
+}
+
+func (d Diagnostic) String() string {
+	return d.Message
+}
+
+// DiagnoseTorrent examines raw .torrent data and explains why it fails to parse, identifying
+// known corruption patterns that ParseOptions.Lenient can recover from.
+// It returns nil if the data parses without problems.
+func DiagnoseTorrent(data []byte) []Diagnostic {
+	var diagnostics []Diagnostic
+	opts := ParseOptions{}
+
+	if _, err := bencode.Decode(bytes.NewReader(data)); err != nil {
+		lenient := ParseOptions{Lenient: true}
+		if _, lenientErr := bencode.DecodeWithOptions(bytes.NewReader(data), lenient.decodeOptions()); lenientErr != nil {
+			return append(diagnostics, Diagnostic{
+				Kind:    DiagnosticDecode,
+				Message: fmt.Sprintf("invalid bencode: %v", err),
+			})
+		}
+
+		diagnostics = append(diagnostics, Diagnostic{
+			Kind:        DiagnosticLengthWhitespace,
+			Message:     `byte string length prefixes contain whitespace (e.g. "4 :spam"), typically written by a buggy torrent editor`,
+			Recoverable: true,
+		})
+		opts = lenient
+	}
+
+	if _, _, err := parse(data, opts); err != nil {
+		diagnostics = append(diagnostics, Diagnostic{
+			Kind:    DiagnosticStructure,
+			Message: fmt.Sprintf("invalid torrent structure: %v", err),
+		})
+		for i := range diagnostics {
+			diagnostics[i].Recoverable = false // lenient decoding is not enough to parse the torrent
+		}
+	}
+
+	return diagnostics
+}
@@ -0,0 +1,85 @@
+package torrent
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// spaceInLengthTorrent returns a valid torrent with whitespace inserted before the colon of
+// the 'comment' key's length prefix, as written by some buggy editors.
+func spaceInLengthTorrent(t *testing.T) []byte {
+	t.Helper()
+	data, err := bencode.Encode(singleFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupted := bytes.Replace(data, []byte("7:comment"), []byte("7 :comment"), 1)
+	if bytes.Equal(corrupted, data) {
+		t.Fatal("test torrent does not contain the expected comment key")
+	}
+	return corrupted
+}
+
+// TestDiagnoseTorrentLengthWhitespace verifies that whitespace in a length prefix is identified
+// as recoverable and that lenient parsing recovers the torrent while strict parsing rejects it.
+func TestDiagnoseTorrentLengthWhitespace(t *testing.T) {
+	data := spaceInLengthTorrent(t)
+
+	diagnostics := DiagnoseTorrent(data)
+	if len(diagnostics) != 1 {
+		t.Fatalf("expected 1 diagnostic, got %d: %v", len(diagnostics), diagnostics)
+	}
+	if diagnostics[0].Kind != DiagnosticLengthWhitespace || !diagnostics[0].Recoverable {
+		t.Errorf("expected recoverable length whitespace diagnostic, got %+v", diagnostics[0])
+	}
+
+	if _, err := ParseReader(bytes.NewReader(data)); err == nil {
+		t.Error("expected strict parsing to fail, got nil")
+	}
+	mi, err := ParseReaderWithOptions(bytes.NewReader(data), ParseOptions{Lenient: true})
+	if err != nil {
+		t.Fatalf("lenient parsing returned error: %v", err)
+	}
+	if mi.Comment != "test torrent" {
+		t.Errorf("expected comment %q, got %q", "test torrent", mi.Comment)
+	}
+}
+
+// TestDiagnoseTorrent checks healthy, undecodable and structurally invalid torrents.
+func TestDiagnoseTorrent(t *testing.T) {
+	valid, err := bencode.Encode(singleFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diagnostics := DiagnoseTorrent(valid); diagnostics != nil {
+		t.Errorf("expected no diagnostics for a valid torrent, got %v", diagnostics)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		kind DiagnosticKind
+		sub  string
+	}{
+		{"invalid bencode", []byte("d8:announce"), DiagnosticDecode, "invalid bencode"},
+		{"not a torrent", []byte("d3:cow3:mooe"), DiagnosticStructure, "'info' key not found"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			diagnostics := DiagnoseTorrent(tc.data)
+			if len(diagnostics) != 1 {
+				t.Fatalf("expected 1 diagnostic, got %d: %v", len(diagnostics), diagnostics)
+			}
+			if diagnostics[0].Kind != tc.kind || diagnostics[0].Recoverable {
+				t.Errorf("unexpected diagnostic: %+v", diagnostics[0])
+			}
+			if !strings.Contains(diagnostics[0].Message, tc.sub) {
+				t.Errorf("expected message to contain %q, got %q", tc.sub, diagnostics[0].Message)
+			}
+		})
+	}
+}
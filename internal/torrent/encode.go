@@ -0,0 +1,222 @@
+package torrent
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// keys handled by MetaInfo and InfoDict, anything else is carried along unchanged
+var (
+	knownRootKeys = []string{keyInfo, keyAnnounce, keyAnnounceList, keyCreationDate, keyComment,
+		keyCreatedBy, keyEncoding, keyPieceLayers, keyURLList, keyHTTPSeeds, keyNodes}
+	knownInfoKeys = []string{keyName, keyFiles, keyLength, keyPieceLength, keyPieces, keyPrivate,
+		keyMetaVersion, keyFileTree, keySource, keyAttr}
+	knownFileKeys = []string{keyLength, keyPath, keyAttr, keySymlinkPath}
+)
+
+// Encode returns the bencoded .torrent file, the form written by WriteTo and Save.
+//
+// The Extra keys of MetaInfo, InfoDict and FileInfo are written back as they were, so a
+// torrent can be loaded, have its trackers or comment edited, and be saved again without
+// changing its info hash. Two kinds of torrents still change: those whose info dictionary was
+// not bencoded canonically, such as with unsorted keys, and v2 torrents whose 'file tree'
+// entries carry other properties than 'length' and 'pieces root', which are not kept. Editing
+// Info changes the info hash too, which is not recomputed: the InfoHash fields keep
+// describing the source.
+func (t *MetaInfo) Encode() ([]byte, error) {
+	root, err := t.ToDictionary()
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := bencode.Encode(root)
+	if err != nil {
+		return nil, fmt.Errorf("encoding torrent: %w", err)
+	}
+	return encoded, nil
+}
+
+// ToDictionary reconstructs the generic bencode dictionary representing the torrent,
+// so it can be inspected or manipulated at the bencode level.
+// Optional fields are only included when they are set, and the info dictionary is
+// rebuilt in single-file or multi-file form depending on how it was parsed.
+//
+// The Extra keys are included as well, so encoding the result of a parsed torrent reproduces
+// one with the same info hash, with the exceptions listed by Encode.
+func (t *MetaInfo) ToDictionary() (bencode.Dictionary, error) {
+	info, err := t.Info.ToDictionary()
+	if err != nil {
+		return nil, err
+	}
+
+	root := withoutKeys(t.Extra, knownRootKeys)
+	root[keyInfo] = info
+	if t.Announce != "" {
+		root[keyAnnounce] = t.Announce
+	}
+	if len(t.AnnounceList) > 0 {
+		root[keyAnnounceList] = announceListToBencode(t.AnnounceList)
+	}
+	if t.CreationDate != 0 {
+		root[keyCreationDate] = t.CreationDate
+	}
+	if t.Comment != "" {
+		root[keyComment] = t.Comment
+	}
+	if t.CreatedBy != "" {
+		root[keyCreatedBy] = t.CreatedBy
+	}
+	if t.Encoding != "" {
+		root[keyEncoding] = t.Encoding
+	}
+	if len(t.PieceLayers) > 0 {
+		root[keyPieceLayers] = pieceLayersToBencode(t.PieceLayers)
+	}
+	if len(t.URLList) > 0 {
+		root[keyURLList] = urlsToBencode(t.URLList)
+	}
+	if len(t.HTTPSeeds) > 0 {
+		root[keyHTTPSeeds] = urlsToBencode(t.HTTPSeeds)
+	}
+	if len(t.Nodes) > 0 {
+		root[keyNodes] = nodesToBencode(t.Nodes)
+	}
+
+	return root, nil
+}
+
+// ToDictionary reconstructs the bencoded form of the info dictionary.
+// It returns an error if the file list does not fit the single-file or multi-file layout.
+// Pure v2 torrents are rebuilt from their file tree alone, without v1 pieces and file list.
+func (i *InfoDict) ToDictionary() (bencode.Dictionary, error) {
+	if len(i.Files) == 0 {
+		return nil, fmt.Errorf("'%s' has no files", keyInfo)
+	}
+
+	info := maps.Clone(i.Extra) // known keys only appear there if their field could not hold them
+	if info == nil {
+		info = bencode.Dictionary{}
+	}
+	info[keyName] = i.Name
+	info[keyPieceLength] = i.PieceLength
+	if i.Private != nil {
+		info[keyPrivate] = *i.Private
+	}
+	if i.Source != "" {
+		info[keySource] = i.Source
+	}
+	if i.MetaVersion != 0 {
+		info[keyMetaVersion] = i.MetaVersion
+	}
+	if len(i.FileTree) > 0 {
+		tree, err := fileTreeToBencode(i.FileTree)
+		if err != nil {
+			return nil, err
+		}
+		info[keyFileTree] = tree
+	}
+	if i.isV2Only() {
+		return info, nil // the file tree replaces the v1 pieces and file list
+	}
+
+	pieces := make([]byte, 0, len(i.Pieces)*20)
+	for _, piece := range i.Pieces {
+		pieces = append(pieces, piece[:]...)
+	}
+	info[keyPieces] = string(pieces)
+
+	if !i.IsMultiFile() {
+		info[keyLength] = i.Files[0].Length
+		if i.Files[0].Attr != "" {
+			info[keyAttr] = i.Files[0].Attr
+		}
+		return info, nil
+	}
+
+	files := make(bencode.List, 0, len(i.Files))
+	for idx, file := range i.Files {
+		if len(file.Path) == 0 {
+			return nil, fmt.Errorf("file at index %d has an empty '%s'", idx, keyPath)
+		}
+		path := make(bencode.List, 0, len(file.Path))
+		for _, component := range file.Path {
+			path = append(path, component)
+		}
+		entry := withoutKeys(file.Extra, knownFileKeys)
+		entry[keyLength] = file.Length
+		entry[keyPath] = path
+		if file.Attr != "" {
+			entry[keyAttr] = file.Attr
+		}
+		if len(file.SymlinkPath) > 0 {
+			target := make(bencode.List, 0, len(file.SymlinkPath))
+			for _, component := range file.SymlinkPath {
+				target = append(target, component)
+			}
+			entry[keySymlinkPath] = target
+		}
+		files = append(files, entry)
+	}
+	info[keyFiles] = files
+
+	return info, nil
+}
+
+// withoutKeys returns a copy of dict without the keys listed in known.
+func withoutKeys(dict bencode.Dictionary, known []string) bencode.Dictionary {
+	result := maps.Clone(dict)
+	if result == nil {
+		return bencode.Dictionary{}
+	}
+	for _, key := range known {
+		delete(result, key)
+	}
+	return result
+}
+
+// keepIgnored records the value of a known info key that could not be stored in its field, so
+// that re-encoding the info dictionary still reproduces the info hash.
+func (i *InfoDict) keepIgnored(key string, value bencode.Value) {
+	if i.Extra == nil {
+		i.Extra = bencode.Dictionary{}
+	}
+	i.Extra[key] = value
+}
+
+// mergeKeys returns dict with the entries of other added, allocating it if needed.
+func mergeKeys(dict, other bencode.Dictionary) bencode.Dictionary {
+	if len(other) == 0 {
+		return dict
+	}
+	if dict == nil {
+		return other
+	}
+	maps.Copy(dict, other)
+	return dict
+}
+
+// urlsToBencode converts URLs back to a bencoded list.
+func urlsToBencode(urls []bencode.ByteString) bencode.List {
+	list := make(bencode.List, len(urls))
+	for i, url := range urls {
+		list[i] = url
+	}
+	return list
+}
+
+// unknownKeys returns the entries of dict whose keys are not listed in known, or nil if there are none.
+func unknownKeys(dict bencode.Dictionary, known []string) bencode.Dictionary {
+	var unknown bencode.Dictionary
+	for key, value := range dict {
+		if slices.Contains(known, key) {
+			continue
+		}
+		if unknown == nil {
+			unknown = bencode.Dictionary{}
+		}
+		unknown[key] = value
+	}
+	return unknown
+}
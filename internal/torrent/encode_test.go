@@ -0,0 +1,188 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"reflect"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestToDictionaryRoundTrip verifies that a parsed torrent converted back with ToDictionary
+// reproduces the original dictionary and info hash in both single-file and multi-file mode.
+func TestToDictionaryRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		root bencode.Dictionary
+	}{
+		{"single-file", singleFileTorrent()},
+		{"multi-file", multiFileTorrent()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, err := Parse(writeTorrent(t, tc.root))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+
+			got, err := mi.ToDictionary()
+			if err != nil {
+				t.Fatalf("ToDictionary() returned error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.root) {
+				t.Errorf("ToDictionary() =>\ngot:\n%s\nwant:\n%s", bencode.ToString(got), bencode.ToString(tc.root))
+			}
+
+			encoded, err := bencode.Encode(got[keyInfo])
+			if err != nil {
+				t.Fatalf("encoding info dictionary: %v", err)
+			}
+			if sha1.Sum(encoded) != mi.InfoHash {
+				t.Error("re-encoded info dictionary does not match the original info hash")
+			}
+		})
+	}
+}
+
+// TestToDictionarySingleEntryMultiFile ensures that a multi-file torrent holding a single file
+// keeps its 'files' list instead of collapsing into single-file mode.
+func TestToDictionarySingleEntryMultiFile(t *testing.T) {
+	root := multiFileTorrent()
+	info := root[keyInfo].(bencode.Dictionary)
+	info[keyFiles] = info[keyFiles].(bencode.List)[:1]
+
+	mi, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	got, err := mi.Info.ToDictionary()
+	if err != nil {
+		t.Fatalf("ToDictionary() returned error: %v", err)
+	}
+	if _, exists := got[keyFiles]; !exists {
+		t.Errorf("expected '%s' key in reconstructed info dictionary", keyFiles)
+	}
+	if _, exists := got[keyLength]; exists {
+		t.Errorf("unexpected '%s' key in reconstructed info dictionary", keyLength)
+	}
+}
+
+// TestEncodePreservesUnknownKeys edits the trackers and comment of a torrent carrying unknown
+// root and info keys, saves it over the source and verifies the info hash is unchanged.
+func TestEncodePreservesUnknownKeys(t *testing.T) {
+	root := singleFileTorrent()
+	root["azureus_properties"] = bencode.Dictionary{"dht_backup_enable": bencode.Integer(1)}
+	root[keyInfo].(bencode.Dictionary)["x_cross_seed"] = "mb-1234"
+	path := writeTorrent(t, root)
+
+	mi, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	mi.Announce = "http://new.example.com/announce"
+	mi.AnnounceList = nil
+	mi.Comment = "edited"
+	if err := mi.Save(path); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+
+	edited, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() of saved torrent returned error: %v", err)
+	}
+	if edited.InfoHash != mi.InfoHash {
+		t.Error("editing root fields changed the info hash")
+	}
+	if edited.Announce != mi.Announce || edited.Comment != "edited" || len(edited.AnnounceList) != 0 {
+		t.Errorf("edits not saved: announce %q, comment %q, %d tiers", edited.Announce, edited.Comment, len(edited.AnnounceList))
+	}
+
+	encoded, err := edited.Encode()
+	if err != nil {
+		t.Fatalf("Encode() returned error: %v", err)
+	}
+	decoded, err := bencode.DecodeBytes(encoded, bencode.DecodeOptions{})
+	if err != nil {
+		t.Fatalf("decoding encoded torrent: %v", err)
+	}
+	got := decoded.(bencode.Dictionary)
+	if !reflect.DeepEqual(got["azureus_properties"], root["azureus_properties"]) {
+		t.Errorf("unknown root key not preserved, got %v", got["azureus_properties"])
+	}
+	if got[keyInfo].(bencode.Dictionary)["x_cross_seed"] != "mb-1234" {
+		t.Error("unknown info key not preserved")
+	}
+}
+
+// TestFileExtraKeys parses a torrent whose file entries carry keys FileInfo does not know
+// about and verifies that re-encoding its info dictionary reproduces the info hash.
+func TestFileExtraKeys(t *testing.T) {
+	root := multiFileTorrent()
+	files := root[keyInfo].(bencode.Dictionary)[keyFiles].(bencode.List)
+	files[0].(bencode.Dictionary)["md5sum"] = "0123456789abcdef0123456789abcdef"
+	files[1].(bencode.Dictionary)["path.utf-8"] = bencode.List{"cover.jpg"}
+	mi, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if got := mi.Info.Files[0].Extra["md5sum"]; got != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("Files[0].Extra[md5sum] = %v", got)
+	}
+
+	info, err := mi.Info.ToDictionary()
+	if err != nil {
+		t.Fatalf("ToDictionary() returned error: %v", err)
+	}
+	encoded, err := bencode.Encode(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sha1.Sum(encoded) != mi.InfoHash {
+		t.Error("re-encoding the info dictionary changed the info hash")
+	}
+}
+
+// TestExtraKeys ensures that unknown keys end up in Extra, that known keys never do, and that
+// keys added by the caller are encoded without overriding the parsed fields.
+func TestExtraKeys(t *testing.T) {
+	root := multiFileTorrent()
+	root["azureus_properties"] = bencode.Dictionary{"dht_backup_enable": bencode.Integer(1)}
+	root["future key"] = bencode.List{"a", bencode.Integer(2)}
+	root[keyInfo].(bencode.Dictionary)["x_cross_seed"] = "mb-1234"
+
+	mi, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	expected := bencode.Dictionary{
+		"azureus_properties": root["azureus_properties"],
+		"future key":         root["future key"],
+	}
+	if !reflect.DeepEqual(mi.Extra, expected) {
+		t.Errorf("Extra = %v, want %v", mi.Extra, expected)
+	}
+	if !reflect.DeepEqual(mi.Info.Extra, bencode.Dictionary{"x_cross_seed": "mb-1234"}) {
+		t.Errorf("Info.Extra = %v", mi.Info.Extra)
+	}
+
+	mi.Extra["added"] = bencode.Integer(7)
+	mi.Extra[keyComment] = "ignored"
+	got, err := mi.ToDictionary()
+	if err != nil {
+		t.Fatalf("ToDictionary() returned error: %v", err)
+	}
+	if got["added"] != bencode.Integer(7) {
+		t.Error("key added to Extra was not encoded")
+	}
+	if _, exists := got[keyComment]; exists {
+		t.Errorf("known key '%s' encoded from Extra", keyComment)
+	}
+
+	if mi, err = Parse(writeTorrent(t, singleFileTorrent())); err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if mi.Extra != nil || mi.Info.Extra != nil {
+		t.Errorf("expected no extra keys, got %v and %v", mi.Extra, mi.Info.Extra)
+	}
+}
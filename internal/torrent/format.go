@@ -0,0 +1,51 @@
+package torrent
+
+import (
+	"fmt"
+	"time"
+)
+
+// TimeLayout is the layout of the dates written by FormatTime.
+const TimeLayout = "2006-01-02 15:04:05 MST"
+
+// CreationTime returns the 'creation date' of the torrent in UTC, or the zero time if the
+// torrent has none.
+func (t *MetaInfo) CreationTime() time.Time {
+	if t.CreationDate == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t.CreationDate, 0).UTC()
+}
+
+// SetCreationTime sets the 'creation date' of the torrent to date, or removes it if date is
+// the zero time.
+func (t *MetaInfo) SetCreationTime(date time.Time) {
+	if date.IsZero() {
+		t.CreationDate = 0
+		return
+	}
+	t.CreationDate = date.Unix()
+}
+
+// FormatSize formats a size in bytes with binary units, such as "1.5 MiB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	value, exp := float64(n)/unit, 0
+	for (value >= unit || value <= -unit) && exp < 5 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[exp])
+}
+
+// FormatTime formats date in UTC with TimeLayout, such as "2023-11-14 22:13:20 UTC".
+// It returns an empty string for the zero time.
+func FormatTime(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.UTC().Format(TimeLayout)
+}
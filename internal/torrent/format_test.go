@@ -0,0 +1,56 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFormatSize checks the unit chosen for sizes around each boundary.
+func TestFormatSize(t *testing.T) {
+	tests := []struct {
+		size     int64
+		expected string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{16 << 20, "16.0 MiB"},
+		{5 << 30, "5.0 GiB"},
+		{3 << 40, "3.0 TiB"},
+		{1<<63 - 1, "8.0 EiB"},
+		{-2048, "-2.0 KiB"},
+	}
+
+	for _, tc := range tests {
+		if got := FormatSize(tc.size); got != tc.expected {
+			t.Errorf("FormatSize(%d) = %q, expected %q", tc.size, got, tc.expected)
+		}
+	}
+}
+
+// TestCreationTime checks the conversion of the 'creation date' timestamp in both directions.
+func TestCreationTime(t *testing.T) {
+	var mi MetaInfo
+	if date := mi.CreationTime(); !date.IsZero() || FormatTime(date) != "" {
+		t.Errorf("CreationTime() without a creation date = %v, expected the zero time", date)
+	}
+
+	mi.CreationDate = 1700000000
+	date := mi.CreationTime()
+	if !date.Equal(time.Date(2023, time.November, 14, 22, 13, 20, 0, time.UTC)) || date.Location() != time.UTC {
+		t.Errorf("CreationTime() = %v", date)
+	}
+	if got := FormatTime(date.In(time.FixedZone("CET", 3600))); got != "2023-11-14 22:13:20 UTC" {
+		t.Errorf("FormatTime() = %q", got)
+	}
+
+	mi.SetCreationTime(date.Add(time.Hour))
+	if mi.CreationDate != 1700003600 {
+		t.Errorf("SetCreationTime() set %d", mi.CreationDate)
+	}
+	mi.SetCreationTime(time.Time{})
+	if mi.CreationDate != 0 {
+		t.Errorf("SetCreationTime() with the zero time set %d", mi.CreationDate)
+	}
+}
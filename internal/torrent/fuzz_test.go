@@ -0,0 +1,51 @@
+package torrent
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// FuzzParseTorrent checks that no input makes the parser panic, in any mode, and that a parsed
+// torrent encodes to one that parses again with the same info hashes.
+func FuzzParseTorrent(f *testing.F) {
+	for _, root := range []bencode.Dictionary{singleFileTorrent(), multiFileTorrent(), hybridTorrent(), v2OnlyTorrent()} {
+		data, err := bencode.Encode(root)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("d4:infod6:lengthi0e4:name0:12:piece lengthi0e6:pieces0:ee"))
+	f.Add([]byte("d4:infod5:filesld6:lengthi1e4:pathl2:..eee4:name1:a12:piece lengthi1e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"))
+	// a file entry with keys the parser does not know, which must survive the round trip
+	f.Add([]byte("d4:infod5:filesld6:lengthi1e6:md5sum32:0123456789abcdef0123456789abcdef4:pathl1:be10:path.utf-8l1:beee4:name1:a12:piece lengthi1e6:pieces20:aaaaaaaaaaaaaaaaaaaaee"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, opts := range []ParseOptions{{}, {Lenient: true, Paths: PathLenient, ValidateTrackers: true}, {Strict: true}} {
+			mi, err := ParseReaderWithOptions(bytes.NewReader(data), opts)
+			if err != nil {
+				continue
+			}
+			mi.TotalLength()
+			mi.NumPieces()
+			for i := range mi.Info.Files {
+				mi.Info.ContentPath("", i)
+			}
+
+			encoded, err := mi.Encode()
+			if err != nil {
+				t.Fatalf("Encode() of a parsed torrent returned error: %v", err)
+			}
+			again, err := ParseReaderWithOptions(bytes.NewReader(encoded), opts)
+			if err != nil {
+				t.Fatalf("parsing the encoded torrent %q returned error: %v", encoded, err)
+			}
+			if again.InfoHash != mi.InfoHash || again.InfoHashV2 != mi.InfoHashV2 {
+				t.Fatalf("info hashes changed from %x/%x to %x/%x after encoding", mi.InfoHash, mi.InfoHashV2, again.InfoHash, again.InfoHashV2)
+			}
+		}
+		DiagnoseTorrent(data)
+	})
+}
@@ -0,0 +1,90 @@
+package torrent
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// HashOptions configures the worker pool that hashes pieces in Create, ScanProgressWithOptions
+// and storage rechecks. The zero value hashes on GOMAXPROCS goroutines without reporting progress.
+type HashOptions struct {
+	// Workers is the number of pieces processed in parallel. Zero or less uses runtime.GOMAXPROCS(0).
+	Workers int
+
+	// Progress, if set, is called after each piece with the number of pieces done so far and
+	// the total. Calls are serialized, so it needs no locking of its own.
+	Progress func(done, total int)
+}
+
+func (o HashOptions) workers(numPieces int) int {
+	workers := o.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return max(1, min(workers, numPieces))
+}
+
+// ForEachPiece calls fn for every piece index in [0, numPieces) from a pool of opts.Workers
+// goroutines, so fn must be safe for concurrent use. Pieces are handed out in index order.
+//
+// The first error returned by fn stops the pool and is returned once every running call has
+// finished. Cancelling ctx stops it as well, returning the context's error.
+func ForEachPiece(ctx context.Context, numPieces int, opts HashOptions, fn func(index int) error) error {
+	if numPieces <= 0 {
+		return ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	indices := make(chan int)
+	var (
+		mu       sync.Mutex
+		done     int
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	var wg sync.WaitGroup
+	for range opts.workers(numPieces) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indices {
+				if err := fn(index); err != nil {
+					fail(err)
+					return
+				}
+				if opts.Progress != nil {
+					mu.Lock()
+					done++
+					opts.Progress(done, numPieces)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+feed:
+	for index := range numPieces {
+		select {
+		case indices <- index:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indices)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// TestForEachPiece verifies that every piece is visited exactly once and that progress counts up
+// to the total, for several worker counts.
+func TestForEachPiece(t *testing.T) {
+	for _, workers := range []int{0, 1, 3, 100} {
+		visits := make([]atomic.Int32, 50)
+		var progress []int
+		opts := HashOptions{Workers: workers, Progress: func(done, total int) {
+			if total != len(visits) {
+				t.Errorf("progress total = %d, want %d", total, len(visits))
+			}
+			progress = append(progress, done)
+		}}
+
+		err := ForEachPiece(context.Background(), len(visits), opts, func(index int) error {
+			visits[index].Add(1)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("ForEachPiece() with %d workers returned error: %v", workers, err)
+		}
+		for index := range visits {
+			if n := visits[index].Load(); n != 1 {
+				t.Errorf("%d workers: piece %d visited %d times", workers, index, n)
+			}
+		}
+		for i, done := range progress {
+			if done != i+1 {
+				t.Fatalf("%d workers: progress %v is not counting up", workers, progress)
+			}
+		}
+		if len(progress) != len(visits) {
+			t.Errorf("%d workers: progress called %d times, want %d", workers, len(progress), len(visits))
+		}
+	}
+}
+
+// TestForEachPieceError ensures that the first error stops the pool and is returned.
+func TestForEachPieceError(t *testing.T) {
+	errBad := errors.New("bad piece")
+	var calls atomic.Int32
+	err := ForEachPiece(context.Background(), 1000, HashOptions{Workers: 4}, func(index int) error {
+		calls.Add(1)
+		if index == 10 {
+			return errBad
+		}
+		return nil
+	})
+	if !errors.Is(err, errBad) {
+		t.Errorf("expected %v, got %v", errBad, err)
+	}
+	if calls.Load() == 1000 {
+		t.Error("expected the pool to stop before visiting every piece")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ForEachPiece(ctx, 10, HashOptions{}, func(int) error { return nil }); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,64 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// singleFileTorrent returns the root dictionary of a single-file torrent with every optional root key set.
+func singleFileTorrent() bencode.Dictionary {
+	return bencode.Dictionary{
+		"announce": "http://tracker.example.com/announce",
+		"announce-list": bencode.List{
+			bencode.List{"http://tracker.example.com/announce"},
+			bencode.List{"udp://backup.example.com:6969/announce", "http://backup.example.com/announce"},
+		},
+		"creation date": bencode.Integer(1700000000),
+		"comment":       "test torrent",
+		"created by":    "gobit",
+		"encoding":      "UTF-8",
+		"url-list":      bencode.List{"http://seed.example.com/files/", "http://mirror.example.com/file.txt"},
+		"info": bencode.Dictionary{
+			"name":         "file.txt",
+			"length":       bencode.Integer(40000),
+			"piece length": bencode.Integer(16384),
+			"pieces":       strings.Repeat("a", 60),
+			"private":      bencode.Integer(1),
+		},
+	}
+}
+
+// multiFileTorrent returns the root dictionary of a multi-file torrent with only the required keys.
+func multiFileTorrent() bencode.Dictionary {
+	return bencode.Dictionary{
+		"announce": "http://tracker.example.com/announce",
+		"info": bencode.Dictionary{
+			"name":         "album",
+			"piece length": bencode.Integer(32768),
+			"pieces":       strings.Repeat("b", 40),
+			"files": bencode.List{
+				bencode.Dictionary{"length": bencode.Integer(30000), "path": bencode.List{"disc 1", "track 1.flac"}},
+				bencode.Dictionary{"length": bencode.Integer(20000), "path": bencode.List{"cover.jpg"}},
+			},
+		},
+	}
+}
+
+// writeTorrent bencodes root into a .torrent file inside a temporary directory and returns its path.
+func writeTorrent(t *testing.T, root bencode.Dictionary) string {
+	t.Helper()
+	data, err := bencode.Encode(root)
+	if err != nil {
+		t.Fatalf("encoding test torrent: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "test.torrent")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("writing test torrent: %v", err)
+	}
+	return path
+}
@@ -0,0 +1,89 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// StructuralFingerprint returns a stable hex-encoded SHA-256 digest of the torrent's layout:
+// its name, piece length and the path and length of every file.
+// Unlike the info hash, it ignores the piece hashes, trackers and every other field, so
+// two torrents describing the same file layout share a fingerprint even if their content
+// or tracker lists differ. This makes it suitable as a cache key for layout validation.
+func (t *MetaInfo) StructuralFingerprint() string {
+	files := make(bencode.List, 0, len(t.Info.Files))
+	for _, file := range t.Info.Files {
+		path := make(bencode.List, 0, len(file.Path))
+		for _, component := range file.Path {
+			path = append(path, component)
+		}
+		files = append(files, bencode.Dictionary{
+			keyLength: file.Length,
+			keyPath:   path,
+		})
+	}
+
+	// bencode gives a canonical, unambiguous serialization since dictionary keys are sorted
+	// and every string is length-prefixed; encoding these types cannot fail
+	encoded, _ := bencode.Encode(bencode.Dictionary{
+		keyName:        t.Info.Name,
+		keyPieceLength: t.Info.PieceLength,
+		keyFiles:       files,
+	})
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// HasV1 reports whether the torrent has a v1 (SHA-1) info hash.
+func (t *MetaInfo) HasV1() bool {
+	return !t.InfoHash.IsZero()
+}
+
+// HasV2 reports whether the torrent has a v2 (SHA-256) info hash.
+func (t *MetaInfo) HasV2() bool {
+	return !t.InfoHashV2.IsZero()
+}
+
+// IsHybrid reports whether the torrent carries both v1 and v2 metadata.
+func (t *MetaInfo) IsHybrid() bool {
+	return t.HasV1() && t.HasV2()
+}
+
+// SameContent reports whether a and b describe the same content by comparing info hashes
+// of the same protocol version: the v1 hashes if both have one, or the v2 hashes if both have one.
+func SameContent(a, b *MetaInfo) bool {
+	if a.HasV1() && b.HasV1() && a.InfoHash == b.InfoHash {
+		return true
+	}
+	return a.HasV2() && b.HasV2() && a.InfoHashV2 == b.InfoHashV2
+}
+
+// SameHybridContent extends SameContent across protocol versions, reporting whether any
+// of a's info hashes matches any of b's. The v2 hash is compared in its 20-byte truncated
+// form, which is how v2 swarms are identified in v1 contexts such as trackers and the DHT.
+// This recognizes, for example, a pure v1 torrent and a hybrid torrent of the same content.
+func SameHybridContent(a, b *MetaInfo) bool {
+	for _, x := range a.swarmHashes() {
+		for _, y := range b.swarmHashes() {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// swarmHashes returns the 20-byte forms of every info hash the torrent has.
+func (t *MetaInfo) swarmHashes() []infohash.V1 {
+	var hashes []infohash.V1
+	if t.HasV1() {
+		hashes = append(hashes, t.InfoHash)
+	}
+	if t.HasV2() {
+		hashes = append(hashes, t.InfoHashV2.Truncate())
+	}
+	return hashes
+}
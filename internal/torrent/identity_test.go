@@ -0,0 +1,152 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestStructuralFingerprint verifies that the fingerprint is stable, ignores trackers and
+// piece hashes, and changes with the file layout.
+func TestStructuralFingerprint(t *testing.T) {
+	original, err := Parse(writeTorrent(t, multiFileTorrent()))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	fingerprint := original.StructuralFingerprint()
+	if len(fingerprint) != 64 {
+		t.Fatalf("expected 64 hex characters, got %q", fingerprint)
+	}
+	if again := original.StructuralFingerprint(); again != fingerprint {
+		t.Errorf("fingerprint is not stable: %q != %q", again, fingerprint)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(root bencode.Dictionary)
+		same   bool
+	}{
+		{
+			name: "different trackers",
+			modify: func(root bencode.Dictionary) {
+				root[keyAnnounce] = "http://other.example.com/announce"
+				root[keyAnnounceList] = bencode.List{bencode.List{"udp://other.example.com:80"}}
+			},
+			same: true,
+		},
+		{
+			name: "different pieces",
+			modify: func(root bencode.Dictionary) {
+				root[keyInfo].(bencode.Dictionary)[keyPieces] = string(make([]byte, 40))
+			},
+			same: true,
+		},
+		{
+			name: "different piece length",
+			modify: func(root bencode.Dictionary) {
+				root[keyInfo].(bencode.Dictionary)[keyPieceLength] = bencode.Integer(65536)
+			},
+			same: false,
+		},
+		{
+			name: "different file length",
+			modify: func(root bencode.Dictionary) {
+				files := root[keyInfo].(bencode.Dictionary)[keyFiles].(bencode.List)
+				files[1].(bencode.Dictionary)[keyLength] = bencode.Integer(20001)
+			},
+			same: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := multiFileTorrent()
+			tc.modify(root)
+			mi, err := Parse(writeTorrent(t, root))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+
+			if got := mi.StructuralFingerprint() == fingerprint; got != tc.same {
+				t.Errorf("fingerprint equality = %v, want %v", got, tc.same)
+			}
+		})
+	}
+}
+
+// TestParseMetaVersion verifies that the v2 info hash is only computed for torrents declaring meta version 2.
+func TestParseMetaVersion(t *testing.T) {
+	v1, err := Parse(writeTorrent(t, singleFileTorrent()))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if !v1.HasV1() || v1.HasV2() || v1.IsHybrid() {
+		t.Errorf("expected v1-only torrent, got HasV1=%v HasV2=%v", v1.HasV1(), v1.HasV2())
+	}
+
+	root := singleFileTorrent()
+	info := root[keyInfo].(bencode.Dictionary)
+	info[keyMetaVersion] = bencode.Integer(2)
+	info[keyFileTree] = bencode.Dictionary{
+		"file.txt": bencode.Dictionary{"": bencode.Dictionary{
+			keyLength:     bencode.Integer(40000),
+			keyPiecesRoot: string(make([]byte, 32)),
+		}},
+	}
+	hybrid, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	encoded, _ := bencode.Encode(info)
+	if !hybrid.IsHybrid() || hybrid.InfoHashV2 != sha256.Sum256(encoded) {
+		t.Errorf("expected hybrid torrent with SHA-256 info hash, got %x", hybrid.InfoHashV2)
+	}
+
+	info[keyMetaVersion] = bencode.Integer(3)
+	if _, err := Parse(writeTorrent(t, root)); err == nil {
+		t.Error("expected error for unsupported meta version, got nil")
+	}
+}
+
+// TestSameHybridContent pairs v1-only, v2-only and hybrid torrents of the same and different content.
+func TestSameHybridContent(t *testing.T) {
+	v1Hash := [20]byte{1, 2, 3}
+	v2Hash := [32]byte{4, 5, 6}
+	var truncated [20]byte
+	copy(truncated[:], v2Hash[:20])
+
+	v1Only := &MetaInfo{InfoHash: v1Hash}
+	hybrid := &MetaInfo{InfoHash: v1Hash, InfoHashV2: v2Hash}
+	v2Only := &MetaInfo{InfoHashV2: v2Hash}
+	truncatedV1 := &MetaInfo{InfoHash: truncated}
+	unrelated := &MetaInfo{InfoHash: [20]byte{9}, InfoHashV2: [32]byte{9}}
+
+	tests := []struct {
+		name        string
+		a, b        *MetaInfo
+		sameContent bool
+		sameHybrid  bool
+	}{
+		{"v1 and hybrid", v1Only, hybrid, true, true},
+		{"hybrid and v2", hybrid, v2Only, true, true},
+		{"v1 and v2 of the same hybrid", v1Only, v2Only, false, false},
+		{"v2 truncated into v1 context", v2Only, truncatedV1, false, true},
+		{"unrelated", hybrid, unrelated, false, false},
+		{"empty hashes", &MetaInfo{}, &MetaInfo{}, false, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := SameContent(tc.a, tc.b); got != tc.sameContent {
+				t.Errorf("SameContent() = %v, want %v", got, tc.sameContent)
+			}
+			if got := SameHybridContent(tc.a, tc.b); got != tc.sameHybrid {
+				t.Errorf("SameHybridContent() = %v, want %v", got, tc.sameHybrid)
+			}
+			if got := SameHybridContent(tc.b, tc.a); got != tc.sameHybrid {
+				t.Errorf("SameHybridContent() is not symmetric")
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package torrent
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// TotalLength returns the total size in bytes of the content described by the torrent,
+// summed across all files.
+func (i *InfoDict) TotalLength() int64 {
+	var total int64
+	for _, file := range i.Files {
+		total += file.Length
+	}
+	return total
+}
+
+// NumPieces returns the number of pieces in the torrent.
+func (i *InfoDict) NumPieces() int {
+	return len(i.Pieces)
+}
+
+// PieceSize returns the size in bytes of the piece at index. Every piece has PieceLength bytes
+// except the last one, which holds the remainder of the content. It returns 0 for invalid indices.
+func (i *InfoDict) PieceSize(index int) int64 {
+	if index < 0 || index >= i.NumPieces() {
+		return 0
+	}
+	start := int64(index) * i.PieceLength
+	return min(i.PieceLength, i.TotalLength()-start)
+}
+
+// LastPieceSize returns the size in bytes of the last piece, which is shorter than PieceLength
+// unless the content length is a multiple of it. It returns 0 for torrents without pieces.
+func (i *InfoDict) LastPieceSize() int64 {
+	return i.PieceSize(i.NumPieces() - 1)
+}
+
+// TotalLength returns the total size in bytes of the torrent's content.
+func (t *MetaInfo) TotalLength() int64 {
+	return t.Info.TotalLength()
+}
+
+// NumPieces returns the number of pieces in the torrent.
+func (t *MetaInfo) NumPieces() int {
+	return t.Info.NumPieces()
+}
+
+// FullPath joins the path components of the file with the OS separator, giving its path
+// relative to the torrent's directory. It returns an error instead of a path that could
+// escape that directory or is invalid on some operating system, see PathStrict.
+func (f *FileInfo) FullPath() (string, error) {
+	if err := checkPath(f.Path); err != nil {
+		return "", fmt.Errorf("file '%s' %q: %w", keyPath, strings.Join(f.Path, "/"), err)
+	}
+	return filepath.Join(f.Path...), nil
+}
+
+// FullPaths returns the FullPath of every file, indexed like Files.
+// It fails on the first file whose path is unsafe.
+func (i *InfoDict) FullPaths() ([]string, error) {
+	paths := make([]string, len(i.Files))
+	for idx := range i.Files {
+		path, err := i.Files[idx].FullPath()
+		if err != nil {
+			return nil, fmt.Errorf("file at index %d: %w", idx, err)
+		}
+		paths[idx] = path
+	}
+	return paths, nil
+}
+
+// PieceOffsets returns the offset within the concatenated content at which each piece starts,
+// indexed by piece. The slice has NumPieces entries.
+func (i *InfoDict) PieceOffsets() []int64 {
+	offsets := make([]int64, i.NumPieces())
+	for index := range offsets {
+		offsets[index] = int64(index) * i.PieceLength
+	}
+	return offsets
+}
+
+// PieceFileOverlap returns the portion of the piece at pieceIndex that lies within the file at
+// fileIndex, as an offset relative to the start of the piece and a length in bytes.
+// ok is false if either index is invalid or the piece and the file do not overlap.
+//
+// A piece can only be verified once every file it overlaps is available, so this tells a client
+// doing selective downloads how much of a boundary piece belongs to a selected file.
+func (i *InfoDict) PieceFileOverlap(pieceIndex, fileIndex int) (offsetInPiece int64, length int64, ok bool) {
+	if fileIndex < 0 || fileIndex >= len(i.Files) {
+		return 0, 0, false
+	}
+	pieceSize := i.PieceSize(pieceIndex)
+	if pieceSize == 0 {
+		return 0, 0, false
+	}
+
+	pieceStart := int64(pieceIndex) * i.PieceLength
+	pieceEnd := pieceStart + pieceSize
+	fileStart := i.fileOffset(fileIndex)
+	fileEnd := fileStart + i.Files[fileIndex].Length
+
+	start := max(pieceStart, fileStart)
+	end := min(pieceEnd, fileEnd)
+	if start >= end {
+		return 0, 0, false
+	}
+	return start - pieceStart, end - start, true
+}
+
+// fileOffset returns the offset of the file at fileIndex within the concatenated content.
+func (i *InfoDict) fileOffset(fileIndex int) int64 {
+	var offset int64
+	for _, file := range i.Files[:fileIndex] {
+		offset += file.Length
+	}
+	return offset
+}
@@ -0,0 +1,146 @@
+package torrent
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// testLayout returns an InfoDict with three files of 10, 25 and 7 bytes split into 16-byte pieces:
+//
+//	piece 0: [0, 16)  file 0 [0, 10), file 1 [0, 6)
+//	piece 1: [16, 32) file 1 [6, 22)
+//	piece 2: [32, 42) file 1 [22, 25), file 2 [0, 7)
+func testLayout() *InfoDict {
+	return &InfoDict{
+		Name:        "layout",
+		PieceLength: 16,
+		Pieces:      make([][20]byte, 3),
+		Files: []FileInfo{
+			{Length: 10, Path: []string{"a"}},
+			{Length: 25, Path: []string{"b"}},
+			{Length: 7, Path: []string{"c"}},
+		},
+	}
+}
+
+// TestPieceSize verifies the total length, piece count and short last piece.
+func TestPieceSize(t *testing.T) {
+	info := testLayout()
+	if got := info.TotalLength(); got != 42 {
+		t.Errorf("TotalLength() = %d, want 42", got)
+	}
+	if got := info.NumPieces(); got != 3 {
+		t.Errorf("NumPieces() = %d, want 3", got)
+	}
+
+	for index, expected := range map[int]int64{-1: 0, 0: 16, 1: 16, 2: 10, 3: 0} {
+		if got := info.PieceSize(index); got != expected {
+			t.Errorf("PieceSize(%d) = %d, want %d", index, got, expected)
+		}
+	}
+	if got := info.LastPieceSize(); got != 10 {
+		t.Errorf("LastPieceSize() = %d, want 10", got)
+	}
+	if got := (&InfoDict{}).LastPieceSize(); got != 0 {
+		t.Errorf("LastPieceSize() without pieces = %d, want 0", got)
+	}
+}
+
+// TestFullPath verifies that file paths are joined with the OS separator and that components
+// which could escape the torrent directory are rejected.
+func TestFullPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    []string
+		want    string
+		wantErr bool
+	}{
+		{"single component", []string{"a.txt"}, "a.txt", false},
+		{"nested", []string{"disc 1", "track 1.flac"}, filepath.Join("disc 1", "track 1.flac"), false},
+		{"dots inside name", []string{"my..file"}, "my..file", false},
+		{"empty path", nil, "", true},
+		{"parent traversal", []string{"..", "etc", "passwd"}, "", true},
+		{"current directory", []string{"dir", "."}, "", true},
+		{"empty component", []string{"dir", ""}, "", true},
+		{"embedded separator", []string{"dir/../../x"}, "", true},
+		{"windows separator", []string{`..\x`}, "", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			file := FileInfo{Length: 1, Path: tc.path}
+			got, err := file.FullPath()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for path %q, got %q", tc.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("FullPath() = %q, want %q", got, tc.want)
+			}
+		})
+	}
+
+	info := testLayout()
+	paths, err := info.FullPaths()
+	if err != nil || !slices.Equal(paths, []string{"a", "b", "c"}) {
+		t.Errorf("FullPaths() = %q, %v", paths, err)
+	}
+	info.Files[1].Path = []string{".."}
+	if _, err := info.FullPaths(); err == nil {
+		t.Error("expected FullPaths() error for traversal, got nil")
+	}
+}
+
+// TestPieceOffsets verifies the start of each piece and that the last piece ends the content.
+func TestPieceOffsets(t *testing.T) {
+	info := testLayout()
+	offsets := info.PieceOffsets()
+
+	expected := []int64{0, 16, 32}
+	if !slices.Equal(offsets, expected) {
+		t.Fatalf("PieceOffsets() = %v, want %v", offsets, expected)
+	}
+
+	last := len(offsets) - 1
+	if end := offsets[last] + info.PieceSize(last); end != info.TotalLength() {
+		t.Errorf("last piece ends at %d, want TotalLength() = %d", end, info.TotalLength())
+	}
+}
+
+// TestPieceFileOverlap checks the overlap of boundary and inner pieces with each file.
+func TestPieceFileOverlap(t *testing.T) {
+	info := testLayout()
+	tests := []struct {
+		name       string
+		piece      int
+		file       int
+		wantOffset int64
+		wantLength int64
+		wantOK     bool
+	}{
+		{"boundary piece, first file", 0, 0, 0, 10, true},
+		{"boundary piece, selected file", 0, 1, 10, 6, true},
+		{"inner piece of a file", 1, 1, 0, 16, true},
+		{"last piece, file tail", 2, 1, 0, 3, true},
+		{"last piece, last file", 2, 2, 3, 7, true},
+		{"no overlap", 1, 0, 0, 0, false},
+		{"invalid piece", 3, 2, 0, 0, false},
+		{"invalid file", 0, 3, 0, 0, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			offset, length, ok := info.PieceFileOverlap(tc.piece, tc.file)
+			if offset != tc.wantOffset || length != tc.wantLength || ok != tc.wantOK {
+				t.Errorf("PieceFileOverlap(%d, %d) = (%d, %d, %v), want (%d, %d, %v)",
+					tc.piece, tc.file, offset, length, ok, tc.wantOffset, tc.wantLength, tc.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package torrent
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Piece lengths outside this range are valid but unusual: smaller pieces bloat the torrent file
+// and the bitfield, larger ones waste bandwidth on every failed hash check.
+const (
+	lintMinPieceLength = BlockSize
+	lintMaxPieceLength = 32 << 20
+)
+
+// firstTorrentDate is the release date of the first BitTorrent client, earlier creation dates
+// cannot be genuine.
+var firstTorrentDate = time.Date(2001, time.July, 2, 0, 0, 0, 0, time.UTC)
+
+// Lint checks t against the specification and common best practices, beyond what Parse
+// requires to accept a torrent. Problems that make the torrent unusable or non-compliant,
+// such as a piece count that does not match the content length, are reported as violations;
+// questionable but valid content, such as a piece length that is not a power of two, as
+// warnings. The returned report is empty if nothing was found.
+//
+// Lint works on parsed torrents as well as on torrents built in code. It only sees the fields
+// as parsed, so malformed entries that Parse skipped are reported by ParseWithReport instead.
+func Lint(t *MetaInfo) *ValidationReport {
+	report := &ValidationReport{}
+	t.lintPieces(report)
+	t.lintFiles(report)
+	t.lintTrackers(report)
+	t.lintWebSeeds(report)
+	t.lintCreationDate(report)
+
+	if err := t.Validate(); err != nil {
+		var joined interface{ Unwrap() []error }
+		if errors.As(err, &joined) {
+			for _, err := range joined.Unwrap() {
+				report.violation(keyInfo, "%v", err)
+			}
+		} else {
+			report.violation(keyInfo, "%v", err)
+		}
+	}
+	return report
+}
+
+func (t *MetaInfo) lintPieces(report *ValidationReport) {
+	pieceLength := t.Info.PieceLength
+	if pieceLength <= 0 {
+		report.violation(keyPieceLength, "must be positive, got %d", pieceLength)
+		return
+	}
+	if pieceLength&(pieceLength-1) != 0 {
+		report.warn(keyPieceLength, "%d is not a power of two", pieceLength)
+	}
+	if pieceLength < lintMinPieceLength || pieceLength > lintMaxPieceLength {
+		report.warn(keyPieceLength, "%d is outside the usual range of %d to %d bytes", pieceLength, lintMinPieceLength, lintMaxPieceLength)
+	}
+
+	if t.Info.isV2Only() {
+		return
+	}
+	total := t.TotalLength()
+	expected := (total + pieceLength - 1) / pieceLength
+	if got := int64(t.NumPieces()); got != expected {
+		report.violation(keyPieces, "has %d hashes, expected %d for %d bytes in pieces of %d bytes", got, expected, total, pieceLength)
+	}
+}
+
+func (t *MetaInfo) lintFiles(report *ValidationReport) {
+	if t.TotalLength() == 0 {
+		report.violation(keyLength, "the torrent has no content")
+	}
+	if err := t.Info.checkPaths(); err != nil {
+		report.violation(keyPath, "%v", err)
+	}
+
+	seen := make(map[string]bool, len(t.Info.Files))
+	for _, file := range t.Info.Files {
+		if file.IsPadding() {
+			continue // padding files of the same size share their path
+		}
+		path := strings.Join(file.Path, "/")
+		if seen[path] {
+			report.violation(keyPath, "duplicate file %q", path)
+		}
+		seen[path] = true
+
+		if file.Length == 0 && t.IsMultiFile() && !file.IsSymlink() {
+			report.warn(keyLength, "file %q is empty", path)
+		}
+	}
+}
+
+func (t *MetaInfo) lintTrackers(report *ValidationReport) {
+	if t.Announce != "" && !validTrackerURL(t.Announce) {
+		report.violation(keyAnnounce, "invalid tracker URL %q", t.Announce)
+	}
+	for tierIdx, tier := range t.AnnounceList {
+		for urlIdx, tracker := range tier {
+			if tracker != "" && !validTrackerURL(tracker) {
+				report.violation(keyAnnounceList, "tier %d, url %d: invalid tracker URL %q", tierIdx, urlIdx, tracker)
+			}
+		}
+	}
+	for _, err := range t.ValidateAnnounceList() {
+		report.violation(keyAnnounceList, "%v", err)
+	}
+
+	switch {
+	case t.Info.IsPrivate() && len(t.AllTrackers()) == 0:
+		report.warn(keyPrivate, "the torrent is private but has no usable trackers, peers cannot be found")
+	case !t.Info.IsPrivate():
+		t.warnTrackerless(report)
+	}
+	if t.Info.IsPrivate() && len(t.Nodes) > 0 {
+		report.warn(keyNodes, "the torrent is private, clients must not use its DHT nodes")
+	}
+}
+
+func (t *MetaInfo) lintWebSeeds(report *ValidationReport) {
+	for _, seed := range t.URLList {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			report.warn(keyURLList, "invalid web seed URL %q", seed)
+		}
+	}
+	for _, seed := range t.HTTPSeeds {
+		u, err := url.Parse(seed)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			report.warn(keyHTTPSeeds, "invalid HTTP seed URL %q", seed)
+		}
+	}
+}
+
+func (t *MetaInfo) lintCreationDate(report *ValidationReport) {
+	date := t.CreationTime()
+	if date.IsZero() {
+		return
+	}
+	switch {
+	case date.Before(firstTorrentDate):
+		report.warn(keyCreationDate, "%s is before BitTorrent existed", date.Format(time.RFC3339))
+	case date.After(time.Now().Add(24 * time.Hour)):
+		report.warn(keyCreationDate, "%s is in the future", date.Format(time.RFC3339))
+	}
+}
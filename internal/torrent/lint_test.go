@@ -0,0 +1,165 @@
+package torrent
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestLint checks the violations and warnings reported for well-formed torrents modified to
+// break each rule.
+func TestLint(t *testing.T) {
+	tests := []struct {
+		name       string
+		root       func() bencode.Dictionary
+		modify     func(mi *MetaInfo)
+		violations []string // fields, in reporting order
+		warnings   []string
+	}{
+		{name: "single file", root: singleFileTorrent, modify: func(*MetaInfo) {}},
+		{name: "multi file", root: multiFileTorrent, modify: func(*MetaInfo) {}},
+		{
+			name:     "piece length not a power of two",
+			root:     singleFileTorrent,
+			modify:   func(mi *MetaInfo) { mi.Info.PieceLength = 19000 },
+			warnings: []string{"piece length"},
+		},
+		{
+			name:       "tiny piece length",
+			root:       singleFileTorrent,
+			modify:     func(mi *MetaInfo) { mi.Info.PieceLength = 1024 },
+			violations: []string{"pieces"},
+			warnings:   []string{"piece length"},
+		},
+		{
+			name:       "piece count mismatch",
+			root:       multiFileTorrent,
+			modify:     func(mi *MetaInfo) { mi.Info.Files[0].Length = 70000 },
+			violations: []string{"pieces"},
+		},
+		{
+			name: "empty and duplicate files",
+			root: multiFileTorrent,
+			modify: func(mi *MetaInfo) {
+				mi.Info.Files = append(mi.Info.Files, FileInfo{Length: 0, Path: []string{"cover.jpg"}})
+			},
+			violations: []string{"path"},
+			warnings:   []string{"length"},
+		},
+		{
+			name: "padding files sharing a path",
+			root: multiFileTorrent,
+			modify: func(mi *MetaInfo) {
+				padding := FileInfo{Length: 0, Path: []string{".pad", "0"}, Attr: "p"}
+				mi.Info.Files = append(mi.Info.Files, padding, padding)
+			},
+		},
+		{
+			name: "no content",
+			root: singleFileTorrent,
+			modify: func(mi *MetaInfo) {
+				mi.Info.Files[0].Length = 0
+				mi.Info.Pieces = nil
+			},
+			violations: []string{"length"},
+		},
+		{
+			name: "invalid trackers",
+			root: singleFileTorrent,
+			modify: func(mi *MetaInfo) {
+				mi.Announce = "tracker.example.com"
+				mi.AnnounceList = [][]string{{"http://tracker.example.com/announce", "wss://tracker.example.com"}, {}}
+				mi.rawAnnounceList = nil // checked as built in code
+			},
+			violations: []string{"announce", "announce-list", "announce-list"},
+		},
+		{
+			name: "private without trackers",
+			root: singleFileTorrent,
+			modify: func(mi *MetaInfo) {
+				mi.Announce, mi.AnnounceList = "", nil
+				mi.Nodes = []Node{{Host: "router.example.com", Port: 6881}}
+			},
+			warnings: []string{"private", "nodes"},
+		},
+		{
+			name: "public without trackers or nodes",
+			root: multiFileTorrent,
+			modify: func(mi *MetaInfo) {
+				mi.Announce = ""
+			},
+			warnings: []string{"announce"},
+		},
+		{
+			name:     "invalid web seed",
+			root:     singleFileTorrent,
+			modify:   func(mi *MetaInfo) { mi.URLList = []string{"ftp://seed.example.com/file.txt"} },
+			warnings: []string{"url-list"},
+		},
+		{
+			name:     "invalid HTTP seed",
+			root:     singleFileTorrent,
+			modify:   func(mi *MetaInfo) { mi.HTTPSeeds = []string{"seed.example.com/seed.php"} },
+			warnings: []string{"httpseeds"},
+		},
+		{
+			name:     "creation date before BitTorrent",
+			root:     singleFileTorrent,
+			modify:   func(mi *MetaInfo) { mi.CreationDate = 86400 },
+			warnings: []string{"creation date"},
+		},
+		{
+			name:     "creation date in the future",
+			root:     singleFileTorrent,
+			modify:   func(mi *MetaInfo) { mi.CreationDate = 1 << 40 },
+			warnings: []string{"creation date"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, err := Parse(writeTorrent(t, tc.root()))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			tc.modify(mi)
+
+			report := Lint(mi)
+			if got := issueFields(report.Violations()); !reflect.DeepEqual(got, tc.violations) {
+				t.Errorf("violations = %v, expected %v (%v)", got, tc.violations, report.Issues)
+			}
+			if got := issueFields(report.Warnings()); !reflect.DeepEqual(got, tc.warnings) {
+				t.Errorf("warnings = %v, expected %v (%v)", got, tc.warnings, report.Issues)
+			}
+		})
+	}
+}
+
+// TestLintMessages checks that issues name the offending values.
+func TestLintMessages(t *testing.T) {
+	mi, err := Parse(writeTorrent(t, multiFileTorrent()))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	mi.Info.Files[1].Length = 0
+	mi.Info.Pieces = mi.Info.Pieces[:1]
+
+	var messages []string
+	for _, issue := range Lint(mi).Issues {
+		messages = append(messages, issue.String())
+	}
+	expected := []string{
+		`warning: 'length': file "cover.jpg" is empty`,
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Lint() issues = %q, expected %q", messages, expected)
+	}
+
+	mi.Info.Files[1].Length = 40000
+	issues := Lint(mi).Issues
+	if len(issues) != 1 || !strings.Contains(issues[0].Message, "has 1 hashes, expected 3 for 70000 bytes in pieces of 32768 bytes") {
+		t.Errorf("Lint() issues = %v, expected a piece count violation", issues)
+	}
+}
@@ -0,0 +1,218 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/tracker"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// magnet link query parameters
+const (
+	magnetExactTopic  = "xt"
+	magnetDisplayName = "dn"
+	magnetTracker     = "tr"
+	magnetWebSeed     = "ws"
+	magnetPeer        = "x.pe"
+)
+
+// exact topic prefixes of v1 and v2 info hashes
+const (
+	urnBTIH = "urn:btih:"
+	urnBTMH = "urn:btmh:"
+)
+
+// MagnetInfo is the information carried by a magnet link.
+// At least one of InfoHash and InfoHashV2 is set.
+// Reference: https://bittorrent.org/beps/bep_0009.html#magnet-uri-format
+type MagnetInfo struct {
+	InfoHash   infohash.V1    // SHA-1 info hash from an 'urn:btih:' exact topic (v1 and hybrid torrents)
+	InfoHashV2 infohash.V2    // SHA-256 info hash from an 'urn:btmh:' exact topic (v2 and hybrid torrents)
+	Name       string         // suggested display name (optional)
+	Trackers   []string       // tracker URLs (optional)
+	WebSeeds   []string       // HTTP web seed URLs, see BEP 19 (optional)
+	Peers      []tracker.Peer // peer addresses to try before trackers respond (optional)
+}
+
+// HasV1 reports whether the magnet link carries a v1 info hash.
+func (m *MagnetInfo) HasV1() bool {
+	return !m.InfoHash.IsZero()
+}
+
+// HasV2 reports whether the magnet link carries a v2 info hash.
+func (m *MagnetInfo) HasV2() bool {
+	return !m.InfoHashV2.IsZero()
+}
+
+// ParseMagnet parses a magnet link. The link must carry a v1 info hash, either hex or base32
+// encoded, a v2 info hash, or both for hybrid torrents.
+//
+// Peer hints ('x.pe') must be IP literals with a port, bracketed for IPv6 such as
+// "[2001:db8::1]:6881". Malformed hints and hints naming a host are skipped, as they are
+// only an optimization over trackers and DHT.
+func ParseMagnet(uri string) (*MagnetInfo, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("parsing magnet link: %w", err)
+	}
+	if u.Scheme != "magnet" {
+		return nil, fmt.Errorf("expected magnet scheme, got %q", u.Scheme)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("parsing magnet link query: %w", err)
+	}
+
+	result := MagnetInfo{
+		Name:     query.Get(magnetDisplayName),
+		Trackers: query[magnetTracker],
+		WebSeeds: query[magnetWebSeed],
+	}
+	for _, topic := range query[magnetExactTopic] {
+		if err := result.parseExactTopic(topic); err != nil {
+			return nil, err
+		}
+	}
+	if !result.HasV1() && !result.HasV2() {
+		return nil, errors.New("magnet link has no BitTorrent info hash")
+	}
+
+	for _, hint := range query[magnetPeer] {
+		addr, err := netip.ParseAddrPort(hint)
+		if err != nil || addr.Port() == 0 {
+			continue
+		}
+		result.Peers = append(result.Peers, tracker.Peer{Addr: addr})
+	}
+
+	return &result, nil
+}
+
+// String returns the magnet link for m. Exact topics come first, followed by the display name,
+// trackers, web seeds and peer hints, each query-escaped.
+func (m *MagnetInfo) String() string {
+	var params []string
+	if m.HasV1() {
+		params = append(params, magnetExactTopic+"="+urnBTIH+m.InfoHash.Hex())
+	}
+	if m.HasV2() {
+		params = append(params, magnetExactTopic+"="+urnBTMH+m.InfoHashV2.Multihash())
+	}
+	if m.Name != "" {
+		params = append(params, magnetDisplayName+"="+url.QueryEscape(m.Name))
+	}
+	for _, tr := range m.Trackers {
+		params = append(params, magnetTracker+"="+url.QueryEscape(tr))
+	}
+	for _, ws := range m.WebSeeds {
+		params = append(params, magnetWebSeed+"="+url.QueryEscape(ws))
+	}
+	for _, peer := range m.Peers {
+		params = append(params, magnetPeer+"="+url.QueryEscape(peer.Addr.String()))
+	}
+
+	return "magnet:?" + strings.Join(params, "&")
+}
+
+// Magnet returns the magnet link information of the torrent: its info hashes, its name as the
+// display name, every usable tracker as reported by AllTrackers and its web seeds.
+// Use its String method to obtain the link itself.
+func (t *MetaInfo) Magnet() *MagnetInfo {
+	return &MagnetInfo{
+		InfoHash:   t.InfoHash,
+		InfoHashV2: t.InfoHashV2,
+		Name:       t.Info.Name,
+		Trackers:   t.AllTrackers(),
+		WebSeeds:   slices.Clone(t.URLList),
+	}
+}
+
+// VerifyMetadata checks that infoBytes, the bencoded info dictionary fetched from peers for
+// this magnet link, hashes to the info hashes advertised by the link, and returns the full
+// torrent on success. Both the v1 and the v2 hash are checked when the link carries both.
+//
+// The magnet link's trackers become the announce-list, one tier each, with the first one also
+// used as 'announce', and its web seeds become the url-list. The display name is used if the info dictionary has no name of its own.
+//
+// Reference: https://bittorrent.org/beps/bep_0009.html
+func (m *MagnetInfo) VerifyMetadata(infoBytes []byte) (*MetaInfo, error) {
+	if !m.HasV1() && !m.HasV2() {
+		return nil, errors.New("magnet link has no BitTorrent info hash")
+	}
+
+	hashV1 := sha1.Sum(infoBytes)
+	if m.HasV1() && hashV1 != m.InfoHash {
+		return nil, fmt.Errorf("metadata info hash mismatch: expected %x, got %x", m.InfoHash, hashV1)
+	}
+	hashV2 := sha256.Sum256(infoBytes)
+	if m.HasV2() && hashV2 != m.InfoHashV2 {
+		return nil, fmt.Errorf("metadata v2 info hash mismatch: expected %x, got %x", m.InfoHashV2, hashV2)
+	}
+
+	decoded, err := bencode.Decode(bytes.NewReader(infoBytes))
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	infoRoot, err := bencode.AsDictionary(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("'%s' must be a dictionary, got %s", keyInfo, bencode.TypeOf(decoded))
+	}
+	// the hashes were verified on the raw bytes, so filling in the name does not affect them
+	if _, exists := infoRoot[keyName]; !exists && m.Name != "" {
+		infoRoot[keyName] = m.Name
+	}
+
+	var result MetaInfo
+	if err := result.parseInfo(bencode.Dictionary{keyInfo: infoRoot}, nil); err != nil {
+		return nil, err
+	}
+	result.setInfoHashes(infoBytes)
+
+	for _, tr := range m.Trackers {
+		if result.Announce == "" {
+			result.Announce = tr
+		}
+		result.AnnounceList = append(result.AnnounceList, []bencode.ByteString{tr})
+	}
+	result.URLList = slices.Clone(m.WebSeeds)
+
+	return &result, nil
+}
+
+// parseExactTopic decodes a v1 or v2 info hash from an 'xt' value.
+// Topics of other URN namespaces are ignored.
+func (m *MagnetInfo) parseExactTopic(topic string) error {
+	switch {
+	case strings.HasPrefix(topic, urnBTIH):
+		encoded := strings.TrimPrefix(topic, urnBTIH)
+		if len(encoded) != 40 && len(encoded) != 32 {
+			return fmt.Errorf("invalid v1 info hash length in %q", topic)
+		}
+		infoHash, err := infohash.Parse(encoded)
+		if err != nil {
+			return fmt.Errorf("decoding v1 info hash: %w", err)
+		}
+		m.InfoHash = infoHash
+
+	case strings.HasPrefix(topic, urnBTMH):
+		encoded := strings.TrimPrefix(topic, urnBTMH)
+		if !strings.HasPrefix(encoded, infohash.SHA256Multihash) || len(encoded) != len(infohash.SHA256Multihash)+64 {
+			return fmt.Errorf("unsupported v2 info hash %q: expected a SHA-256 multihash", encoded)
+		}
+		infoHashV2, err := infohash.ParseV2(encoded)
+		if err != nil {
+			return fmt.Errorf("decoding v2 info hash: %w", err)
+		}
+		m.InfoHashV2 = infoHashV2
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/tracker"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+const testMagnetHash = "c12fe1c06bba254a9dc9f519b335aa7c1367a88a"
+
+// TestParseMagnet verifies info hashes, display name, trackers and peer hints of a magnet link.
+func TestParseMagnet(t *testing.T) {
+	uri := "magnet:?xt=urn:btih:" + testMagnetHash +
+		"&dn=example.iso" +
+		"&tr=http%3A%2F%2Ftracker.example.com%2Fannounce" +
+		"&tr=udp%3A%2F%2Fbackup.example.com%3A6969" +
+		"&x.pe=10.0.0.1:6881" +
+		"&x.pe=%5B2001:db8::1%5D:51413" +
+		"&x.pe=peer.example.com:6881" +
+		"&x.pe=10.0.0.2" +
+		"&x.pe=10.0.0.3:0"
+
+	m, err := ParseMagnet(uri)
+	if err != nil {
+		t.Fatalf("ParseMagnet() returned error: %v", err)
+	}
+	if hex.EncodeToString(m.InfoHash[:]) != testMagnetHash || m.HasV2() {
+		t.Errorf("unexpected info hashes: %x, %x", m.InfoHash, m.InfoHashV2)
+	}
+	if m.Name != "example.iso" {
+		t.Errorf("Name = %q, want %q", m.Name, "example.iso")
+	}
+	expectedTrackers := []string{"http://tracker.example.com/announce", "udp://backup.example.com:6969"}
+	if !slices.Equal(m.Trackers, expectedTrackers) {
+		t.Errorf("Trackers = %q, want %q", m.Trackers, expectedTrackers)
+	}
+	expectedPeers := []tracker.Peer{
+		{Addr: netip.MustParseAddrPort("10.0.0.1:6881")},
+		{Addr: netip.MustParseAddrPort("[2001:db8::1]:51413")},
+	}
+	if !slices.Equal(m.Peers, expectedPeers) {
+		t.Errorf("Peers = %v, want %v", m.Peers, expectedPeers)
+	}
+}
+
+// TestParseMagnetInfoHashes checks the supported info hash encodings and rejected links.
+func TestParseMagnetInfoHashes(t *testing.T) {
+	v2Hash := "8d2ebbe5de1cf67b61bdc9ee2c5d2e2def5b4c9fb5fc3d0e5bdcef1b2fb6c1a2"
+	tests := []struct {
+		name    string
+		uri     string
+		wantV1  bool
+		wantV2  bool
+		wantErr bool
+	}{
+		{name: "hex v1", uri: "magnet:?xt=urn:btih:" + testMagnetHash, wantV1: true},
+		{name: "base32 v1", uri: "magnet:?xt=urn:btih:YEX6DQDLXISUVHOJ6UM3GNNKPQJWPKEK", wantV1: true},
+		{name: "v2", uri: "magnet:?xt=urn:btmh:1220" + v2Hash, wantV2: true},
+		{name: "hybrid", uri: "magnet:?xt=urn:btih:" + testMagnetHash + "&xt=urn:btmh:1220" + v2Hash, wantV1: true, wantV2: true},
+		{name: "not a magnet", uri: "http://example.com/?xt=urn:btih:" + testMagnetHash, wantErr: true},
+		{name: "missing info hash", uri: "magnet:?dn=example", wantErr: true},
+		{name: "short info hash", uri: "magnet:?xt=urn:btih:c12fe1", wantErr: true},
+		{name: "unsupported multihash", uri: "magnet:?xt=urn:btmh:1114" + testMagnetHash, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := ParseMagnet(tc.uri)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if m.HasV1() != tc.wantV1 || m.HasV2() != tc.wantV2 {
+				t.Errorf("HasV1() = %v, HasV2() = %v, want %v, %v", m.HasV1(), m.HasV2(), tc.wantV1, tc.wantV2)
+			}
+			if tc.wantV1 && hex.EncodeToString(m.InfoHash[:]) != testMagnetHash {
+				t.Errorf("unexpected v1 info hash %x", m.InfoHash)
+			}
+		})
+	}
+}
+
+// TestMagnetString verifies that generated magnet links parse back into the same information.
+func TestMagnetString(t *testing.T) {
+	hybridBytes := encodedInfo(t, hybridTorrent())
+	m := &MagnetInfo{
+		InfoHash:   sha1.Sum(hybridBytes),
+		InfoHashV2: sha256.Sum256(hybridBytes),
+		Name:       "name with spaces & symbols",
+		Trackers:   []string{"http://tracker.example.com/announce?key=a&b=c"},
+		WebSeeds:   []string{"https://seed.example.com/files/"},
+		Peers:      []tracker.Peer{{Addr: netip.MustParseAddrPort("[2001:db8::1]:6881")}},
+	}
+
+	parsed, err := ParseMagnet(m.String())
+	if err != nil {
+		t.Fatalf("ParseMagnet(%q) returned error: %v", m.String(), err)
+	}
+	if !reflect.DeepEqual(parsed, m) {
+		t.Errorf("round trip mismatch:\ngot:  %+v\nwant: %+v", parsed, m)
+	}
+}
+
+// TestMetaInfoMagnet checks the magnet link generated from a parsed torrent.
+func TestMetaInfoMagnet(t *testing.T) {
+	mi, err := Parse(writeTorrent(t, singleFileTorrent()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "magnet:?xt=urn:btih:" + hex.EncodeToString(mi.InfoHash[:]) +
+		"&dn=file.txt" +
+		"&tr=http%3A%2F%2Ftracker.example.com%2Fannounce" +
+		"&tr=udp%3A%2F%2Fbackup.example.com%3A6969%2Fannounce" +
+		"&tr=http%3A%2F%2Fbackup.example.com%2Fannounce" +
+		"&ws=http%3A%2F%2Fseed.example.com%2Ffiles%2F" +
+		"&ws=http%3A%2F%2Fmirror.example.com%2Ffile.txt"
+	if got := mi.Magnet().String(); got != expected {
+		t.Errorf("Magnet().String() =\n%s\nwant\n%s", got, expected)
+	}
+}
+
+// encodedInfo returns the bencoded info dictionary of the given torrent root.
+func encodedInfo(t *testing.T, root bencode.Dictionary) []byte {
+	t.Helper()
+	data, err := bencode.Encode(root["info"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestVerifyMetadata verifies that matching metadata yields the full torrent merged with the magnet link.
+func TestVerifyMetadata(t *testing.T) {
+	root := singleFileTorrent()
+	delete(root["info"].(bencode.Dictionary), "name")
+	infoBytes := encodedInfo(t, root)
+
+	m := &MagnetInfo{
+		InfoHash: sha1.Sum(infoBytes),
+		Name:     "from-magnet.txt",
+		Trackers: []string{"http://a.example.com/announce", "udp://b.example.com:6969"},
+		WebSeeds: []string{"http://seed.example.com/"},
+	}
+	mi, err := m.VerifyMetadata(infoBytes)
+	if err != nil {
+		t.Fatalf("VerifyMetadata() returned error: %v", err)
+	}
+	if mi.InfoHash != m.InfoHash {
+		t.Errorf("InfoHash = %x, want %x", mi.InfoHash, m.InfoHash)
+	}
+	if mi.Info.Name != "from-magnet.txt" || mi.Info.TotalLength() != 40000 {
+		t.Errorf("unexpected info dictionary: %+v", mi.Info)
+	}
+	if mi.Announce != "http://a.example.com/announce" || len(mi.AnnounceList) != 2 {
+		t.Errorf("unexpected trackers: %q, %q", mi.Announce, mi.AnnounceList)
+	}
+	if !slices.Equal(mi.URLList, m.WebSeeds) {
+		t.Errorf("URLList = %q, want %q", mi.URLList, m.WebSeeds)
+	}
+
+	// v2 and hybrid magnet links are checked against the SHA-256 hash as well
+	hybridBytes := encodedInfo(t, hybridTorrent())
+	hybrid := &MagnetInfo{InfoHash: sha1.Sum(hybridBytes), InfoHashV2: sha256.Sum256(hybridBytes)}
+	mi, err = hybrid.VerifyMetadata(hybridBytes)
+	if err != nil {
+		t.Fatalf("VerifyMetadata() of hybrid metadata returned error: %v", err)
+	}
+	if mi.InfoHashV2 != hybrid.InfoHashV2 || mi.Info.Name != "hybrid" {
+		t.Errorf("unexpected hybrid torrent: %x, %q", mi.InfoHashV2, mi.Info.Name)
+	}
+}
+
+// TestVerifyMetadataMismatch ensures that metadata not matching the advertised hashes is rejected.
+func TestVerifyMetadataMismatch(t *testing.T) {
+	infoBytes := encodedInfo(t, singleFileTorrent())
+	other := encodedInfo(t, multiFileTorrent())
+
+	tests := []struct {
+		name   string
+		magnet *MagnetInfo
+	}{
+		{"v1 mismatch", &MagnetInfo{InfoHash: sha1.Sum(other)}},
+		{"v2 mismatch", &MagnetInfo{InfoHashV2: sha256.Sum256(other)}},
+		{"hybrid with v2 mismatch", &MagnetInfo{InfoHash: sha1.Sum(infoBytes), InfoHashV2: sha256.Sum256(other)}},
+		{"no info hash", &MagnetInfo{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tc.magnet.VerifyMetadata(infoBytes); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
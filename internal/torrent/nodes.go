@@ -0,0 +1,91 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// Node is a DHT node listed in the 'nodes' key of a trackerless torrent, used to bootstrap
+// the DHT. The host is either an IP address or a domain name.
+type Node struct {
+	Host string
+	Port int
+}
+
+// Addr returns the node address in host:port form, suitable for net.Dial.
+func (n Node) Addr() string {
+	return net.JoinHostPort(n.Host, strconv.Itoa(n.Port))
+}
+
+// IsTrackerless reports whether the torrent relies on the DHT alone: it has no usable tracker
+// but lists bootstrap nodes.
+func (t *MetaInfo) IsTrackerless() bool {
+	return len(t.AllTrackers()) == 0 && len(t.Nodes) > 0
+}
+
+// parseNodes reads the [host, port] pairs of 'nodes'. Malformed entries are skipped.
+// Reference: https://bittorrent.org/beps/bep_0005.html#torrent-file-extensions
+func (t *MetaInfo) parseNodes(root bencode.Dictionary, report *ValidationReport) {
+	raw, exists := root[keyNodes]
+	if !exists {
+		report.missing(keyNodes)
+		return
+	}
+
+	rawList, err := bencode.AsList(raw)
+	if err != nil {
+		report.violation(keyNodes, "ignored: %v", err)
+		return
+	}
+
+	var nodes []Node
+	for nodeIdx, nodeRaw := range rawList {
+		node, err := parseNode(nodeRaw)
+		if err != nil {
+			report.violation(keyNodes, "node %d skipped: %v", nodeIdx, err)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	t.Nodes = nodes
+}
+
+// parseNode validates a single [host, port] pair.
+func parseNode(raw bencode.Value) (Node, error) {
+	pair, err := bencode.AsList(raw)
+	if err != nil {
+		return Node{}, err
+	}
+	if len(pair) != 2 {
+		return Node{}, fmt.Errorf("expected [host, port], got %d elements", len(pair))
+	}
+
+	host, err := bencode.AsByteString(pair[0])
+	if err != nil {
+		return Node{}, fmt.Errorf("host: %w", err)
+	}
+	if host == "" {
+		return Node{}, errors.New("host is empty")
+	}
+	port, err := bencode.AsInteger(pair[1])
+	if err != nil {
+		return Node{}, fmt.Errorf("port: %w", err)
+	}
+	if port < 1 || port > 65535 {
+		return Node{}, fmt.Errorf("port %d out of range", port)
+	}
+	return Node{Host: host, Port: int(port)}, nil
+}
+
+// nodesToBencode converts nodes back to their list of [host, port] pairs.
+func nodesToBencode(nodes []Node) bencode.List {
+	list := make(bencode.List, len(nodes))
+	for i, node := range nodes {
+		list[i] = bencode.List{node.Host, bencode.Integer(node.Port)}
+	}
+	return list
+}
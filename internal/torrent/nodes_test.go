@@ -0,0 +1,84 @@
+package torrent
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestParseNodes checks that valid [host, port] pairs are kept and malformed ones skipped.
+func TestParseNodes(t *testing.T) {
+	root := multiFileTorrent()
+	root[keyNodes] = bencode.List{
+		bencode.List{"router.example.com", bencode.Integer(6881)},
+		bencode.List{"10.0.0.1", bencode.Integer(51413)},
+		bencode.List{"2001:db8::1", bencode.Integer(1)},
+		bencode.List{"", bencode.Integer(6881)},
+		bencode.List{"10.0.0.2", bencode.Integer(0)},
+		bencode.List{"10.0.0.3", bencode.Integer(65536)},
+		bencode.List{"10.0.0.4"},
+		bencode.List{"10.0.0.5", "6881"},
+		"10.0.0.6:6881",
+	}
+
+	mi, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	expected := []Node{{"router.example.com", 6881}, {"10.0.0.1", 51413}, {"2001:db8::1", 1}}
+	if !slices.Equal(mi.Nodes, expected) {
+		t.Errorf("Nodes = %v, want %v", mi.Nodes, expected)
+	}
+	if got := mi.Nodes[2].Addr(); got != "[2001:db8::1]:1" {
+		t.Errorf("Addr() = %q, want %q", got, "[2001:db8::1]:1")
+	}
+	if !mi.HasField(keyNodes) || mi.IsTrackerless() {
+		t.Error("expected 'nodes' to be present on a torrent with a tracker")
+	}
+}
+
+// TestParseTrackerless verifies that torrents without 'announce' rely on their DHT nodes.
+func TestParseTrackerless(t *testing.T) {
+	tests := []struct {
+		name        string
+		nodes       bencode.Value // nil leaves the key out
+		trackerless bool
+	}{
+		{"nodes", bencode.List{bencode.List{"router.example.com", bencode.Integer(6881)}}, true},
+		{"no nodes", nil, false},
+		{"only malformed nodes", bencode.List{bencode.List{"", bencode.Integer(6881)}}, false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := multiFileTorrent()
+			delete(root, keyAnnounce)
+			if tc.nodes != nil {
+				root[keyNodes] = tc.nodes
+			}
+
+			mi, err := Parse(writeTorrent(t, root))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			if mi.Announce != "" || mi.IsTrackerless() != tc.trackerless {
+				t.Errorf("IsTrackerless() = %v, want %v", mi.IsTrackerless(), tc.trackerless)
+			}
+			if !tc.trackerless {
+				return
+			}
+
+			dict, err := mi.ToDictionary()
+			if err != nil {
+				t.Fatalf("ToDictionary() returned error: %v", err)
+			}
+			if _, ok := dict[keyAnnounce]; ok {
+				t.Error("expected no 'announce' key in the rebuilt dictionary")
+			}
+			if nodes, ok := dict[keyNodes].(bencode.List); !ok || len(nodes) != 1 {
+				t.Errorf("unexpected 'nodes' in the rebuilt dictionary: %v", dict[keyNodes])
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package torrent
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/lcsabi/gobit/internal/logging"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// ParseOptions configures how torrent files are parsed.
+// The zero value parses torrents as-is.
+type ParseOptions struct {
+	// Preprocess, if set, transforms the raw torrent bytes before they are bencode-decoded.
+	// It is an extension point for undoing tracker-specific wrappers or obfuscation schemes
+	// that gobit does not support natively. A nil Preprocess leaves the data unchanged.
+	Preprocess func([]byte) ([]byte, error)
+
+	// Lenient recovers from known, harmless corruptions produced by buggy torrent editors
+	// instead of rejecting the torrent, currently whitespace in byte string length prefixes
+	// such as "4 :spam". Use DiagnoseTorrent to find out whether a torrent needs it.
+	Lenient bool
+
+	// Strict rejects torrents whose bencoding is not canonical, such as dictionaries with
+	// unsorted or duplicate keys. The info hash is computed from the re-encoded info dictionary,
+	// which differs from the original bytes for such torrents, so their info hash would not match
+	// the one used by the rest of the swarm. Strict takes precedence over Lenient.
+	Strict bool
+
+	// MaxSize is the size of the largest torrent accepted in bytes, MaxTorrentSize if zero.
+	// A single byte string such as the piece hashes may take up all of it, so raising MaxSize
+	// is enough to parse torrents with millions of pieces.
+	MaxSize int64
+
+	// ValidateTrackers removes tracker URLs that cannot be parsed, or that lack a supported
+	// scheme or a host, from Announce and AnnounceList and records them in
+	// MetaInfo.InvalidTrackers so they can be surfaced to the user.
+	ValidateTrackers bool
+
+	// Paths selects how file paths that could escape the download directory or are invalid
+	// on some operating system are handled: PathStrict, the default, rejects the torrent,
+	// PathLenient accepts it and leaves renaming the offending components to ContentPath.
+	Paths PathMode
+
+	// Logger receives debug output about the parsed torrent and the issues found in it.
+	// If nil, the parser subsystem logger of package logging is used.
+	Logger *slog.Logger
+}
+
+func (o ParseOptions) logger() *slog.Logger {
+	return logging.Or(o.Logger, logging.Parser)
+}
+
+func (o ParseOptions) maxSize() int64 {
+	if o.MaxSize == 0 {
+		return MaxTorrentSize
+	}
+	return o.MaxSize
+}
+
+func (o ParseOptions) decodeOptions() bencode.DecodeOptions {
+	return bencode.DecodeOptions{
+		AllowLengthWhitespace: o.Lenient,
+		Strict:                o.Strict,
+		MaxStringLength:       o.maxSize(),
+		MaxSize:               o.maxSize(),
+	}
+}
+
+func (o ParseOptions) preprocess(data []byte) ([]byte, error) {
+	if o.Preprocess == nil {
+		return data, nil
+	}
+
+	processed, err := o.Preprocess(data)
+	if err != nil {
+		return nil, fmt.Errorf("preprocessing torrent data: %w", err)
+	}
+	return processed, nil
+}
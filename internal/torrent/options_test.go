@@ -0,0 +1,128 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestParseOptionsPreprocess verifies that the Preprocess hook runs on the raw bytes before decoding.
+func TestParseOptionsPreprocess(t *testing.T) {
+	data, err := bencode.Encode(singleFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reversed := bytes.Clone(data)
+	slices.Reverse(reversed)
+
+	if _, err := ParseReader(bytes.NewReader(reversed)); err == nil {
+		t.Fatal("expected obfuscated torrent to fail without a preprocessor")
+	}
+
+	opts := ParseOptions{
+		Preprocess: func(b []byte) ([]byte, error) {
+			out := bytes.Clone(b)
+			slices.Reverse(out)
+			return out, nil
+		},
+	}
+	mi, err := ParseReaderWithOptions(bytes.NewReader(reversed), opts)
+	if err != nil {
+		t.Fatalf("ParseReaderWithOptions() returned error: %v", err)
+	}
+	if mi.Info.Name != "file.txt" {
+		t.Errorf("expected name %q, got %q", "file.txt", mi.Info.Name)
+	}
+}
+
+// TestParseOptionsPreprocessError ensures that preprocessing errors abort parsing and are wrapped.
+func TestParseOptionsPreprocessError(t *testing.T) {
+	errObfuscated := errors.New("unknown scheme")
+	opts := ParseOptions{
+		Preprocess: func([]byte) ([]byte, error) { return nil, errObfuscated },
+	}
+
+	_, err := ParseWithOptions(writeTorrent(t, singleFileTorrent()), opts)
+	if !errors.Is(err, errObfuscated) {
+		t.Errorf("expected error wrapping %v, got %v", errObfuscated, err)
+	}
+}
+
+// TestParseOptionsStrict verifies that strict parsing rejects an info dictionary with unsorted
+// keys, whose info hash is otherwise computed from the re-encoded, sorted dictionary.
+func TestParseOptionsStrict(t *testing.T) {
+	info := "d4:name8:file.txt6:lengthi40000e12:piece lengthi16384e6:pieces60:" + strings.Repeat("a", 60) + "e"
+	data := []byte("d8:announce35:http://tracker.example.com/announce4:info" + info + "e")
+
+	mi, err := ParseReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseReader() returned error: %v", err)
+	}
+	if mi.InfoHash == sha1.Sum([]byte(info)) {
+		t.Error("expected the info hash of the re-encoded info dictionary, got the hash of the original bytes")
+	}
+
+	if _, err := ParseReaderWithOptions(bytes.NewReader(data), ParseOptions{Strict: true}); err == nil {
+		t.Error("expected strict parsing of unsorted keys to fail, got nil")
+	}
+	canonical, err := bencode.Encode(singleFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseReaderWithOptions(bytes.NewReader(canonical), ParseOptions{Strict: true}); err != nil {
+		t.Errorf("strict parsing of a canonical torrent returned error: %v", err)
+	}
+}
+
+// TestParseOptionsMaxSize verifies that MaxSize bounds both the torrent and its byte strings,
+// in both directions from the MaxTorrentSize default.
+func TestParseOptionsMaxSize(t *testing.T) {
+	torrent := singleFileTorrent()
+	info := torrent["info"].(bencode.Dictionary)
+	info["length"] = bencode.Integer(1 << 36)
+	info["piece length"] = bencode.Integer(1 << 16)
+	info["pieces"] = strings.Repeat("a", 20<<20) // 1Mi pieces, larger than MaxTorrentSize
+	data, err := bencode.Encode(torrent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ParseReader(bytes.NewReader(data)); err == nil {
+		t.Error("expected a torrent larger than MaxTorrentSize to fail by default, got nil")
+	}
+	if _, err := ParseReaderWithOptions(bytes.NewReader(data), ParseOptions{MaxSize: 2 * int64(len(data))}); err != nil {
+		t.Errorf("ParseReaderWithOptions() with a raised MaxSize returned error: %v", err)
+	}
+
+	small, err := bencode.Encode(singleFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseReaderWithOptions(bytes.NewReader(small), ParseOptions{MaxSize: int64(len(small)) - 1}); err == nil {
+		t.Error("expected a torrent larger than a lowered MaxSize to fail, got nil")
+	}
+}
+
+// TestParseOptionsLogger verifies that the parsed layout and the validation issues are logged
+// at debug level to the configured logger.
+func TestParseOptionsLogger(t *testing.T) {
+	var buf bytes.Buffer
+	opts := ParseOptions{
+		Logger: slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	}
+
+	if _, err := ParseWithOptions(writeTorrent(t, multiFileTorrent()), opts); err != nil {
+		t.Fatalf("ParseWithOptions() returned error: %v", err)
+	}
+	for _, want := range []string{"mode=multi-file", "kind=missing field=comment"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected log output to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
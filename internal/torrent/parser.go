@@ -2,13 +2,16 @@ package torrent
 
 import (
 	"bytes"
-	"crypto/sha1"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 
+	"github.com/lcsabi/gobit/internal/infohash"
 	"github.com/lcsabi/gobit/pkg/bencode"
 )
 
@@ -22,6 +25,10 @@ const (
 	keyComment      = "comment"
 	keyCreatedBy    = "created by"
 	keyEncoding     = "encoding"
+	keyPieceLayers  = "piece layers"
+	keyURLList      = "url-list"
+	keyHTTPSeeds    = "httpseeds"
+	keyNodes        = "nodes"
 
 	// info dictionary keys
 	keyName        = "name"
@@ -29,31 +36,55 @@ const (
 	keyPieceLength = "piece length"
 	keyPieces      = "pieces"
 	keyPrivate     = "private"
+	keyMetaVersion = "meta version"
+	keyFileTree    = "file tree"
+	keySource      = "source"
+
+	// file tree keys
+	keyPiecesRoot = "pieces root"
 
 	// file dictionary keys
-	keyLength = "length"
-	keyPath   = "path"
+	keyLength      = "length"
+	keyPath        = "path"
+	keyAttr        = "attr"
+	keySymlinkPath = "symlink path"
 )
 
+// MaxTorrentSize is the size of the largest torrent accepted by default, see ParseOptions.MaxSize.
 const MaxTorrentSize = 10 * 1024 * 1024 // 10 MB
 
 // TODO: reorder struct fields for memory efficiency, visualize with structlayout
 // TODO: make sure to parse the required fields first, and the quickest ones from those for efficiency
-// TODO: add keys to root level: azureus_properties, add info dict key: source
-// TODO: add ToString() method
 
 // MetaInfo represents the root structure of a .torrent file.
 // It includes tracker URLs, metadata, and optional attributes such as comments or encoding.
 // Reference: https://wiki.theory.org/BitTorrentSpecification#Metainfo_File_Structure
 type MetaInfo struct {
-	Info         InfoDict               // info dictionary that describes the file(s) to be shared (required)
-	InfoHash     [20]byte               // SHA-1 hash of the bencoded 'info' dictionary (required)
-	Announce     bencode.ByteString     // primary tracker URL (required)
-	AnnounceList [][]bencode.ByteString // tiered list of alternative tracker URLs (optional)
-	CreationDate bencode.Integer        // creation time as a UNIX timestamp (optional)
-	Comment      bencode.ByteString     // free-form comment added by the torrent creator (optional)
-	CreatedBy    bencode.ByteString     // name and version of the program that created the torrent (optional)
-	Encoding     bencode.ByteString     // used to generate the pieces part of the info dictionary (optional)
+	Info         InfoDict                // info dictionary that describes the file(s) to be shared (required)
+	InfoHash     infohash.V1             // SHA-1 hash of the bencoded 'info' dictionary (v1 and hybrid torrents only)
+	InfoHashV2   infohash.V2             // SHA-256 hash of the bencoded 'info' dictionary (v2 and hybrid torrents only)
+	Announce     bencode.ByteString      // primary tracker URL (optional, DHT and magnet-only torrents often lack it)
+	AnnounceList [][]bencode.ByteString  // tiered list of alternative tracker URLs (optional)
+	CreationDate bencode.Integer         // creation time as a UNIX timestamp (optional)
+	Comment      bencode.ByteString      // free-form comment added by the torrent creator (optional)
+	CreatedBy    bencode.ByteString      // name and version of the program that created the torrent (optional)
+	Encoding     bencode.ByteString      // used to generate the pieces part of the info dictionary (optional)
+	PieceLayers  map[[32]byte][][32]byte // v2 piece hashes of each file larger than a piece, keyed by pieces root (optional)
+	URLList      []bencode.ByteString    // web seed URLs serving the content over HTTP, see BEP 19 (optional)
+	HTTPSeeds    []bencode.ByteString    // HTTP seed URLs of the older protocol of BEP 17 (optional)
+	Nodes        []Node                  // DHT bootstrap nodes of trackerless torrents, see BEP 5 (optional)
+
+	// InvalidTrackers lists the tracker URLs that were removed from Announce and AnnounceList
+	// because they could not be parsed. Only populated when ParseOptions.ValidateTrackers is set.
+	InvalidTrackers []string
+
+	// Extra holds the root keys MetaInfo does not know about, such as 'azureus_properties',
+	// with their values as decoded. They are written back by Encode, and callers may add
+	// their own keys. Keys handled by MetaInfo itself are ignored in favor of its fields.
+	Extra bencode.Dictionary
+
+	present         []string      // optional keys found in the source, see PresentFields
+	rawAnnounceList bencode.Value // 'announce-list' as found in the source, see ValidateAnnounceList
 }
 
 // InfoDict represents the "info" dictionary in the .torrent file.
@@ -64,6 +95,12 @@ type InfoDict struct {
 	PieceLength bencode.Integer    // number of bytes per piece (required)
 	Pieces      [][20]byte         // SHA-1 hashes of each piece, sliced into 20-byte blocks (required)
 	Private     *bencode.Integer   // if 1, restricts peer discovery to trackers only (optional)
+	MetaVersion bencode.Integer    // 2 for BitTorrent v2 and hybrid torrents, zero for v1 (optional)
+	FileTree    []FileTreeEntry    // files of the v2 'file tree' in tree order (required for v2 and hybrid torrents)
+	Source      bencode.ByteString // tag of the tracker or community the torrent was made for, changes the info hash (optional)
+	Extra       bencode.Dictionary // info keys unknown to InfoDict, or whose value it could not hold, kept for re-encoding (see MetaInfo.Encode)
+
+	multiFile bool // set when parsed from a 'files' list, even if it holds a single entry
 }
 
 // FileInfo represents a file within a multi-file torrent.
@@ -71,11 +108,42 @@ type InfoDict struct {
 type FileInfo struct {
 	Length bencode.Integer      // file size in bytes (required)
 	Path   []bencode.ByteString // file path as a slice of components (required)
+	Attr   bencode.ByteString   // attribute flags of BEP 47, such as 'p' for padding files (optional)
+
+	// SymlinkPath is the target of a symbolic link, as path components relative to the
+	// directory of a multi-file torrent (required for symbolic links, see IsSymlink).
+	SymlinkPath []bencode.ByteString
+
+	// Extra holds the keys of a 'files' entry FileInfo does not know about, such as 'md5sum'
+	// or 'path.utf-8', kept so re-encoding preserves the info hash. The keys of a single-file
+	// torrent are in the info dictionary and end up in InfoDict.Extra instead.
+	Extra bencode.Dictionary
+}
+
+// file attributes of BEP 47
+const (
+	AttrPadding    = 'p' // the file only aligns the next one on a piece boundary and holds zeros
+	AttrSymlink    = 'l' // the file is a symbolic link to SymlinkPath and has no content
+	AttrExecutable = 'x' // the file is executable
+)
+
+// IsPadding reports whether the file is a padding file. Padding files are part of the content
+// the pieces are hashed over, but are never stored on disk: they read as zeros.
+// Reference: https://bittorrent.org/beps/bep_0047.html
+func (f *FileInfo) IsPadding() bool {
+	return strings.ContainsRune(f.Attr, AttrPadding)
+}
+
+// IsSymlink reports whether the file is a symbolic link to SymlinkPath.
+func (f *FileInfo) IsSymlink() bool {
+	return strings.ContainsRune(f.Attr, AttrSymlink)
+}
+
+// IsExecutable reports whether the file is marked executable.
+func (f *FileInfo) IsExecutable() bool {
+	return strings.ContainsRune(f.Attr, AttrExecutable)
 }
 
-// TODO: implement NumPieces, FullPath, or TotalLength methods
-// TODO: create Torrent file linter / validator
-// TODO: create Torrent file editor / repair tool
 // TODO: consider creating debug builds for logging
 
 func (t *MetaInfo) IsMultiFile() bool {
@@ -83,54 +151,170 @@ func (t *MetaInfo) IsMultiFile() bool {
 }
 
 func (i *InfoDict) IsMultiFile() bool {
-	return len(i.Files) > 1
+	return i.multiFile || len(i.Files) > 1
+}
+
+// IsPrivate reports whether the torrent is private (BEP 27): peers may then only be obtained
+// from its trackers, not through DHT or peer exchange.
+func (i *InfoDict) IsPrivate() bool {
+	return i.Private != nil && *i.Private == 1
 }
 
 func Parse(path string) (*MetaInfo, error) {
-	data, path, err := readTorrentFile(path)
+	return ParseWithOptions(path, ParseOptions{})
+}
+
+// ParseWithOptions parses the .torrent file at path using the given options.
+// Use ParseWithReport to also learn about missing optional fields and ignored content.
+func ParseWithOptions(path string, opts ParseOptions) (*MetaInfo, error) {
+	result, _, err := ParseWithReport(path, opts)
+	return result, err
+}
+
+// ParseReader parses a .torrent file read from r, for torrents that do not come from the
+// local filesystem such as HTTP downloads or archive entries. At most MaxTorrentSize bytes are accepted.
+func ParseReader(r io.Reader) (*MetaInfo, error) {
+	return ParseReaderWithOptions(r, ParseOptions{})
+}
+
+// ParseReaderWithOptions parses a .torrent file read from r using the given options.
+func ParseReaderWithOptions(r io.Reader, opts ParseOptions) (*MetaInfo, error) {
+	result, _, err := ParseReaderWithReport(r, opts)
+	return result, err
+}
+
+// ParseContext is like ParseWithOptions but gives up with the context's error once ctx is
+// cancelled, for files on slow or network filesystems.
+func ParseContext(ctx context.Context, path string, opts ParseOptions) (*MetaInfo, error) {
+	result, _, err := parseFile(ctx, path, opts)
+	return result, err
+}
+
+// ParseReaderContext is like ParseReaderWithOptions but stops reading with the context's
+// error once ctx is cancelled.
+func ParseReaderContext(ctx context.Context, r io.Reader, opts ParseOptions) (*MetaInfo, error) {
+	result, _, err := parseReader(ctx, r, opts)
+	return result, err
+}
+
+// =====================================================================================
+
+// parseFile reads and parses the .torrent file at path, reading until ctx is cancelled.
+func parseFile(ctx context.Context, path string, opts ParseOptions) (*MetaInfo, *ValidationReport, error) {
+	data, path, err := readTorrentFile(ctx, path, opts.maxSize())
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	decodedData, err := bencode.Decode(bytes.NewReader(data))
+	result, report, err := parse(data, opts)
 	if err != nil {
-		return nil, err
+		return nil, nil, fmt.Errorf("parsing %s: %w", path, err)
 	}
-	root, err := bencode.AsDictionary(decodedData)
+	return result, report, nil
+}
+
+// parseReader reads at most the maximum torrent size from r until ctx is cancelled, and
+// parses it.
+func parseReader(ctx context.Context, r io.Reader, opts ParseOptions) (*MetaInfo, *ValidationReport, error) {
+	maxSize := opts.maxSize()
+	data, err := io.ReadAll(io.LimitReader(contextReader{ctx, r}, maxSize+1))
 	if err != nil {
-		return nil, fmt.Errorf("expected bencoded dictionary at top-level of %s", path)
+		return nil, nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, nil, fmt.Errorf("torrent data too large, max allowed is %d bytes", maxSize)
 	}
-	result := MetaInfo{}
 
-	// announce
-	if err := result.parseAnnounce(root); err != nil {
-		return nil, err
+	return parse(data, opts)
+}
+
+func parse(data []byte, opts ParseOptions) (*MetaInfo, *ValidationReport, error) {
+	data, err := opts.preprocess(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	decodedData, err := bencode.DecodeWithOptions(bytes.NewReader(data), opts.decodeOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+	root, err := bencode.AsDictionary(decodedData)
+	if err != nil {
+		return nil, nil, errors.New("expected bencoded dictionary at top-level")
 	}
+	result := MetaInfo{}
+	report := &ValidationReport{}
 
 	// info
-	if err := result.parseInfo(root); err != nil {
-		return nil, err
+	if err := result.parseInfo(root, report); err != nil {
+		return nil, nil, err
+	}
+	if opts.Paths == PathStrict {
+		if err := result.Info.checkPaths(); err != nil {
+			return nil, nil, err
+		}
 	}
 
 	// create information hash
-	infoHash, err := createInfoHash(root)
+	encodedInfo, err := encodeInfo(root)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	result.InfoHash = infoHash
+	result.setInfoHashes(encodedInfo)
 
-	result.parseAnnounceList(root)
-	result.parseCreationDate(root)
-	result.parseComment(root)
-	result.parseCreatedBy(root)
-	result.parseEncoding(root)
+	// piece layers
+	if result.Info.MetaVersion == 2 {
+		if err := result.parsePieceLayers(root); err != nil {
+			return nil, nil, err
+		}
+	}
 
-	return &result, nil
+	result.parseAnnounce(root, report)
+	result.parseAnnounceList(root, report)
+	if opts.ValidateTrackers {
+		result.removeInvalidTrackers(report)
+	}
+	result.parseCreationDate(root, report)
+	result.parseComment(root, report)
+	result.parseCreatedBy(root, report)
+	result.parseEncoding(root, report)
+	result.parseURLList(root, report)
+	result.parseHTTPSeeds(root, report)
+	result.parseNodes(root, report)
+	result.warnTrackerless(report)
+	result.recordPresentFields(root)
+	result.Extra = unknownKeys(root, knownRootKeys)
+	result.logParsed(opts.logger(), report)
+
+	return &result, report, nil
 }
 
-// =====================================================================================
+// warnTrackerless warns if the torrent has neither usable trackers nor DHT nodes. Parse and
+// Lint both report it, so the warnings of the two match.
+func (t *MetaInfo) warnTrackerless(report *ValidationReport) {
+	if len(t.AllTrackers()) == 0 && len(t.Nodes) == 0 {
+		report.warn(keyAnnounce, "no usable trackers or DHT nodes, peers can only come from web seeds or peer exchange")
+	}
+}
+
+// logParsed writes the layout of the parsed torrent and the issues found in it at debug level.
+func (t *MetaInfo) logParsed(logger *slog.Logger, report *ValidationReport) {
+	if !logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
 
-func readTorrentFile(path string) ([]byte, string, error) {
+	mode := "single-file"
+	if t.Info.IsMultiFile() {
+		mode = "multi-file"
+	}
+	logger.Debug("parsed torrent", "name", t.Info.Name, "mode", mode,
+		"files", len(t.Info.Files), "pieces", t.Info.NumPieces())
+	for _, issue := range report.Issues {
+		logger.Debug("torrent validation issue", "kind", issue.Kind.String(), "field", issue.Field, "message", issue.Message)
+	}
+}
+
+func readTorrentFile(ctx context.Context, path string, maxSize int64) ([]byte, string, error) {
 	path = strings.TrimSpace(path)
 	if path == "" {
 		return nil, "", errors.New("empty path provided")
@@ -151,33 +335,59 @@ func readTorrentFile(path string) ([]byte, string, error) {
 	if err != nil {
 		return nil, "", fmt.Errorf("failed to stat file: %w", err)
 	}
-	if info.Size() > MaxTorrentSize {
-		return nil, "", fmt.Errorf("torrent file too large (%d bytes), max allowed is %d bytes", info.Size(), MaxTorrentSize)
+	if info.Size() > maxSize {
+		return nil, "", fmt.Errorf("torrent file too large (%d bytes), max allowed is %d bytes", info.Size(), maxSize)
 	}
 
-	data, err := os.ReadFile(cleaned)
+	f, err := os.Open(cleaned)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	// the file may have grown since the stat
+	data, err := io.ReadAll(io.LimitReader(contextReader{ctx, f}, maxSize+1))
 	if err != nil {
 		return nil, "", err
 	}
+	if int64(len(data)) > maxSize {
+		return nil, "", fmt.Errorf("torrent file too large, max allowed is %d bytes", maxSize)
+	}
 	return data, cleaned, nil
 }
 
-func (t *MetaInfo) parseAnnounce(root bencode.Dictionary) error {
+// contextReader reads from r until ctx is cancelled. A Read already blocked in r is not
+// interrupted, the cancellation is seen by the next one.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+func (t *MetaInfo) parseAnnounce(root bencode.Dictionary, report *ValidationReport) {
 	raw, exists := root[keyAnnounce]
 	if !exists {
-		return fmt.Errorf("'%s' key not found", keyAnnounce)
+		report.missing(keyAnnounce)
+		return
 	}
 
 	announce, err := bencode.AsByteString(raw)
 	if err != nil {
-		return fmt.Errorf("parsing '%s': %w", keyAnnounce, err)
+		report.violation(keyAnnounce, "ignored: %v", err)
+		return
 	}
 
 	t.Announce = announce
-	return nil
 }
 
-func (t *MetaInfo) parseInfo(root bencode.Dictionary) error {
+// parseInfo parses the info dictionary, recording the problems of its optional fields in
+// report, which may be nil.
+func (t *MetaInfo) parseInfo(root bencode.Dictionary, report *ValidationReport) error {
 	var infoDictionary InfoDict
 	raw, exists := root[keyInfo]
 	if !exists {
@@ -186,7 +396,7 @@ func (t *MetaInfo) parseInfo(root bencode.Dictionary) error {
 
 	info, err := bencode.AsDictionary(raw)
 	if err != nil {
-		return fmt.Errorf("parsing '%s': %w", keyInfo, err)
+		return fmt.Errorf("'%s' must be a dictionary, got %s", keyInfo, bencode.TypeOf(raw))
 	}
 
 	// piece length
@@ -194,37 +404,60 @@ func (t *MetaInfo) parseInfo(root bencode.Dictionary) error {
 		return err
 	}
 
-	// pieces
-	if err := infoDictionary.parsePieces(info); err != nil {
+	// meta version
+	if err := infoDictionary.parseMetaVersion(info); err != nil {
 		return err
 	}
 
+	// pure v2 torrents have no v1 pieces and file list, only a file tree
+	_, hasPieces := info[keyPieces]
+	v2Only := infoDictionary.MetaVersion == 2 && !hasPieces
+
+	// pieces
+	if !v2Only {
+		if err := infoDictionary.parsePieces(info); err != nil {
+			return err
+		}
+	}
+
 	// name
 	if err := infoDictionary.parseName(info); err != nil {
 		return err
 	}
 
 	// files
-	if err := infoDictionary.parseFiles(info); err != nil {
-		return err
+	if !v2Only {
+		if err := infoDictionary.parseFiles(info); err != nil {
+			return err
+		}
 	}
 
 	// private
-	infoDictionary.parsePrivate(info)
+	infoDictionary.parsePrivate(info, report)
+
+	// source
+	infoDictionary.parseSource(info, report)
+
+	// file tree
+	if infoDictionary.MetaVersion == 2 {
+		if err := infoDictionary.parseFileTree(info); err != nil {
+			return err
+		}
+		if v2Only {
+			infoDictionary.filesFromTree()
+		}
+	}
+
+	infoDictionary.Extra = mergeKeys(infoDictionary.Extra, unknownKeys(info, knownInfoKeys))
 
 	t.Info = infoDictionary
 	return nil
 }
 
 func (i *InfoDict) parseName(infoRoot bencode.Dictionary) error {
-	raw, exists := infoRoot[keyName]
-	if !exists {
-		return fmt.Errorf("'%s' key not found", keyName)
-	}
-
-	name, err := bencode.AsByteString(raw)
+	name, err := bencode.GetString(infoRoot, keyName)
 	if err != nil {
-		return fmt.Errorf("parsing '%s': %w", keyName, err)
+		return err
 	}
 
 	i.Name = filepath.Clean(name) // remvove any unwanted garbage
@@ -236,58 +469,87 @@ func (i *InfoDict) parseFiles(infoRoot bencode.Dictionary) error {
 	raw, exists := infoRoot[keyFiles]
 	if !exists {
 		// single-file mode
-		fmt.Println("detected single-file mode torrent") // TODO: change to log or remove
+		if err := validateSingleFileName(infoRoot); err != nil {
+			return err
+		}
 		length, err := parseFileLength(infoRoot)
 		if err != nil {
-			return fmt.Errorf("parsing single-file mode torrent '%s': %w", keyLength, err)
+			return fmt.Errorf("parsing single-file mode torrent file %q: %w", i.Name, err)
+		}
+		attr, err := parseFileAttr(infoRoot)
+		if err != nil {
+			return fmt.Errorf("parsing single-file mode torrent file %q: %w", i.Name, err)
 		}
 
 		fileInfoList = append(fileInfoList, FileInfo{
 			Length: length,
 			Path:   []string{i.Name}, // by this point, it's guaranteed i.Name is not nil
+			Attr:   attr,
 		})
 	} else {
 		// multi-file mode
-		fmt.Println("detected multi-file mode torrent") // TODO: change to log or remove
-		multiFileList, err := bencode.AsList(raw)       // contains dictionaries with file path and length
+		multiFileList, err := bencode.AsList(raw) // contains dictionaries with file path and length
 		if err != nil {
 			return fmt.Errorf("parsing '%s': %w", keyFiles, err)
 		}
+		if len(multiFileList) == 0 {
+			return fmt.Errorf("parsing '%s': the list is empty", keyFiles)
+		}
 		for idx, elem := range multiFileList {
 			multiFileDict, err := bencode.AsDictionary(elem) // contains file path and length keys
 			if err != nil {
 				return fmt.Errorf("parsing entry %d in '%s': %w", idx, keyFiles, err)
 			}
 
+			// path first, so length errors can name the offending file
+			path, err := parseFilePath(multiFileDict)
+			if err != nil {
+				return fmt.Errorf("parsing file path at index %d: %w", idx, err)
+			}
 			length, err := parseFileLength(multiFileDict)
 			if err != nil {
-				return fmt.Errorf("parsing file length at index %d: %w", idx, err)
+				return fmt.Errorf("parsing file length at index %d (%q): %w", idx, strings.Join(path, "/"), err)
 			}
-			path, err := parseFilePath(multiFileDict)
+			attr, err := parseFileAttr(multiFileDict)
 			if err != nil {
-				return fmt.Errorf("parsing file path at index %d: %w", idx, err)
+				return fmt.Errorf("parsing file attributes at index %d (%q): %w", idx, strings.Join(path, "/"), err)
+			}
+			file := FileInfo{Length: length, Path: path, Attr: attr, Extra: unknownKeys(multiFileDict, knownFileKeys)}
+			if file.SymlinkPath, err = parseSymlinkPath(multiFileDict, file.IsSymlink()); err != nil {
+				return fmt.Errorf("parsing symbolic link at index %d (%q): %w", idx, strings.Join(path, "/"), err)
 			}
 
-			fileInfoList = append(fileInfoList, FileInfo{
-				Length: length,
-				Path:   path,
-			})
+			fileInfoList = append(fileInfoList, file)
 		}
+		i.multiFile = true
 	}
 
 	i.Files = fileInfoList
 	return nil
 }
 
-func (i *InfoDict) parsePieceLength(infoRoot bencode.Dictionary) error {
-	raw, exists := infoRoot[keyPieceLength]
-	if !exists {
-		return fmt.Errorf("'%s' key not found", keyPieceLength)
+// validateSingleFileName checks the raw 'name' of a single-file torrent, which must be a bare
+// file name. The cleaned InfoDict.Name cannot be used since filepath.Clean hides traversal
+// such as "dir/../name", while a name like "../../etc/passwd" would escape the download directory.
+func validateSingleFileName(infoRoot bencode.Dictionary) error {
+	name, err := bencode.AsByteString(infoRoot[keyName])
+	if err != nil {
+		return fmt.Errorf("parsing '%s': %w", keyName, err)
+	}
+
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid single-file '%s' %q: must not contain path separators", keyName, name)
+	}
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid single-file '%s' %q: must be a file name", keyName, name)
 	}
+	return nil
+}
 
-	pieceLength, err := bencode.AsInteger(raw)
+func (i *InfoDict) parsePieceLength(infoRoot bencode.Dictionary) error {
+	pieceLength, err := bencode.GetInt(infoRoot, keyPieceLength)
 	if err != nil {
-		return fmt.Errorf("parsing '%s': %w", keyPieceLength, err)
+		return err
 	}
 
 	// avoid potential division by zero or buffers with zero length
@@ -327,33 +589,70 @@ func (i *InfoDict) parsePieces(infoRoot bencode.Dictionary) error {
 	return nil
 }
 
-func (i *InfoDict) parsePrivate(infoRoot bencode.Dictionary) {
+func (i *InfoDict) parsePrivate(infoRoot bencode.Dictionary, report *ValidationReport) {
 	raw, exists := infoRoot[keyPrivate]
 	if !exists {
-		fmt.Printf("'%s' key not found\n", keyPrivate) // TODO: change to log or remove
+		report.missing(keyPrivate)
 		return
 	}
 
 	private, err := bencode.AsInteger(raw)
 	if err != nil {
-		fmt.Printf("parsing '%s': %v\n", keyPrivate, err) // TODO: change to log or remove
+		report.violation(keyPrivate, "ignored: %v", err)
+		i.keepIgnored(keyPrivate, raw)
 		return
 	}
+	if private != 0 && private != 1 {
+		report.violation(keyPrivate, "expected 0 or 1, got %d, the torrent is treated as public", private)
+	}
 
 	// we return a pointer just to make sure nil can get handled
 	// even though decoding should guarantee no nil value is passed
 	i.Private = &private
 }
 
-func parseFileLength(root bencode.Dictionary) (bencode.Integer, error) {
-	raw, exists := root[keyLength]
+func (i *InfoDict) parseSource(infoRoot bencode.Dictionary, report *ValidationReport) {
+	raw, exists := infoRoot[keySource]
+	if !exists {
+		return
+	}
+
+	source, err := bencode.AsByteString(raw)
+	if err != nil {
+		report.violation(keySource, "ignored: %v", err)
+		i.keepIgnored(keySource, raw)
+		return
+	}
+	if source == "" {
+		i.keepIgnored(keySource, raw) // Source cannot tell an empty tag from a missing one
+	}
+
+	i.Source = source
+}
+
+// Reference: https://bittorrent.org/beps/bep_0052.html
+func (i *InfoDict) parseMetaVersion(infoRoot bencode.Dictionary) error {
+	raw, exists := infoRoot[keyMetaVersion]
 	if !exists {
-		return 0, fmt.Errorf("'%s' key not found", keyLength)
+		return nil // v1 torrent
+	}
+
+	metaVersion, err := bencode.AsInteger(raw)
+	if err != nil {
+		return fmt.Errorf("parsing '%s': %w", keyMetaVersion, err)
 	}
+	if metaVersion != 2 {
+		return fmt.Errorf("unsupported '%s': %d", keyMetaVersion, metaVersion)
+	}
+
+	i.MetaVersion = metaVersion
+	return nil
+}
 
-	length, err := bencode.AsInteger(raw)
+func parseFileLength(root bencode.Dictionary) (bencode.Integer, error) {
+	length, err := bencode.GetInt(root, keyLength)
 	if err != nil {
-		return 0, fmt.Errorf("parsing '%s': %w", keyLength, err)
+		return 0, err
 	}
 
 	if length < 0 {
@@ -363,15 +662,47 @@ func parseFileLength(root bencode.Dictionary) (bencode.Integer, error) {
 	return length, nil
 }
 
-func parseFilePath(root bencode.Dictionary) ([]bencode.ByteString, error) {
-	raw, exists := root[keyPath]
+// parseFileAttr returns the optional attribute flags of a file, empty if absent.
+// Reference: https://bittorrent.org/beps/bep_0047.html
+func parseFileAttr(root bencode.Dictionary) (bencode.ByteString, error) {
+	raw, exists := root[keyAttr]
 	if !exists {
-		return nil, fmt.Errorf("'%s' key not found", keyPath)
+		return "", nil
+	}
+	attr, err := bencode.AsByteString(raw)
+	if err != nil {
+		return "", fmt.Errorf("parsing '%s': %w", keyAttr, err)
+	}
+	return attr, nil
+}
+
+// parseSymlinkPath returns the target of a symbolic link, which is required if symlink is set.
+// A target given for another file is kept, so the info dictionary can be re-encoded as is.
+func parseSymlinkPath(root bencode.Dictionary, symlink bool) ([]bencode.ByteString, error) {
+	if _, exists := root[keySymlinkPath]; !exists && !symlink {
+		return nil, nil
 	}
+	components, err := bencode.GetList(root, keySymlinkPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(components) == 0 {
+		return nil, fmt.Errorf("'%s' is empty", keySymlinkPath)
+	}
+	target, err := bencode.ConvertListToByteStrings(components)
+	if err != nil {
+		return nil, fmt.Errorf("parsing '%s': %w", keySymlinkPath, err)
+	}
+	return target, nil
+}
 
-	paths, err := bencode.AsList(raw)
+func parseFilePath(root bencode.Dictionary) ([]bencode.ByteString, error) {
+	paths, err := bencode.GetList(root, keyPath)
 	if err != nil {
-		return nil, fmt.Errorf("parsing '%s': %w", keyPath, err)
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("'%s' is empty", keyPath)
 	}
 
 	result, err := bencode.ConvertListToByteStrings(paths)
@@ -382,38 +713,38 @@ func parseFilePath(root bencode.Dictionary) ([]bencode.ByteString, error) {
 	return result, nil
 }
 
-// TODO: test somehow
 // do not modify 'infoDict' before encoding because info hash depends on exact byte structure
-func createInfoHash(root bencode.Dictionary) ([20]byte, error) {
+func encodeInfo(root bencode.Dictionary) ([]byte, error) {
 	raw, exists := root[keyInfo]
 	if !exists {
-		return [20]byte{}, fmt.Errorf("'%s' key not found", keyInfo)
+		return nil, fmt.Errorf("'%s' key not found", keyInfo)
 	}
 
 	infoDict, err := bencode.AsDictionary(raw)
 	if err != nil {
-		return [20]byte{}, fmt.Errorf("'%s' is not a dictionary: %w", keyInfo, err)
+		return nil, fmt.Errorf("'%s' is not a dictionary: %w", keyInfo, err)
 	}
 
 	encoded, err := bencode.Encode(infoDict)
 	if err != nil {
-		return [20]byte{}, fmt.Errorf("encoding '%s': %w", keyInfo, err)
+		return nil, fmt.Errorf("encoding '%s': %w", keyInfo, err)
 	}
 
-	return sha1.Sum(encoded), nil
+	return encoded, nil
 }
 
 // Reference: https://bittorrent.org/beps/bep_0012.html
-func (t *MetaInfo) parseAnnounceList(root bencode.Dictionary) {
+func (t *MetaInfo) parseAnnounceList(root bencode.Dictionary, report *ValidationReport) {
 	raw, exists := root[keyAnnounceList]
 	if !exists {
-		fmt.Printf("'%s' key not found\n", keyAnnounceList) // TODO: change to log or remove
+		report.missing(keyAnnounceList)
 		return
 	}
+	t.rawAnnounceList = raw // malformed tiers are skipped below but kept for validation
 
 	rawList, err := bencode.AsList(raw)
 	if err != nil {
-		fmt.Printf("parsing '%s': %+v\n", keyAnnounceList, err) // TODO: change to log or remove
+		report.violation(keyAnnounceList, "ignored: %v", err)
 		return
 	}
 
@@ -422,7 +753,7 @@ func (t *MetaInfo) parseAnnounceList(root bencode.Dictionary) {
 	for tierIdx, tierRaw := range rawList {
 		tier, err := bencode.AsList(tierRaw)
 		if err != nil {
-			fmt.Printf("tier %d: %+v\n", tierIdx, err)
+			report.violation(keyAnnounceList, "tier %d skipped: %v", tierIdx, err)
 			continue
 		}
 
@@ -431,7 +762,7 @@ func (t *MetaInfo) parseAnnounceList(root bencode.Dictionary) {
 		for urlIdx, urlRaw := range tier {
 			url, err := bencode.AsByteString(urlRaw)
 			if err != nil {
-				fmt.Printf("tier %d, url %d: %+v\n", tierIdx, urlIdx, err)
+				report.violation(keyAnnounceList, "tier %d, url %d skipped: %v", tierIdx, urlIdx, err)
 				continue
 			}
 			urls = append(urls, url)
@@ -445,67 +776,117 @@ func (t *MetaInfo) parseAnnounceList(root bencode.Dictionary) {
 	t.AnnounceList = announceList
 }
 
-// TODO: add conversion function to display human-readable date
-func (t *MetaInfo) parseCreationDate(root bencode.Dictionary) {
+func (t *MetaInfo) parseCreationDate(root bencode.Dictionary, report *ValidationReport) {
 	raw, exists := root[keyCreationDate]
 	if !exists {
-		fmt.Printf("'%s' not found\n", keyCreationDate) // TODO: change to log or remove
+		report.missing(keyCreationDate)
 		return
 	}
 
 	creationDate, err := bencode.AsInteger(raw)
 	if err != nil {
-		fmt.Printf("parsing '%s': %+v\n", keyCreationDate, err) // TODO: change to log or remove
+		report.violation(keyCreationDate, "ignored: %v", err)
 		return
 	}
 
 	t.CreationDate = creationDate
 }
 
-func (t *MetaInfo) parseComment(root bencode.Dictionary) {
+func (t *MetaInfo) parseComment(root bencode.Dictionary, report *ValidationReport) {
 	raw, exists := root[keyComment]
 	if !exists {
-		fmt.Printf("'%s' not found\n", keyComment) // TODO: change to log or remove
+		report.missing(keyComment)
 		return
 	}
 
 	comment, err := bencode.AsByteString(raw)
 	if err != nil {
-		fmt.Printf("parsing '%s': %+v\n", keyComment, err) // TODO: change to log or remove
+		report.violation(keyComment, "ignored: %v", err)
 		return
 	}
 
 	t.Comment = comment
 }
 
-func (t *MetaInfo) parseCreatedBy(root bencode.Dictionary) {
+func (t *MetaInfo) parseCreatedBy(root bencode.Dictionary, report *ValidationReport) {
 	raw, exists := root[keyCreatedBy]
 	if !exists {
-		fmt.Printf("'%s' not found\n", keyCreatedBy) // TODO: change to log or remove
+		report.missing(keyCreatedBy)
 		return
 	}
 
 	createdBy, err := bencode.AsByteString(raw)
 	if err != nil {
-		fmt.Printf("parsing '%s': %+v\n", keyCreatedBy, err) // TODO: change to log or remove
+		report.violation(keyCreatedBy, "ignored: %v", err)
 		return
 	}
 
 	t.CreatedBy = createdBy
 }
 
-func (t *MetaInfo) parseEncoding(root bencode.Dictionary) {
+func (t *MetaInfo) parseEncoding(root bencode.Dictionary, report *ValidationReport) {
 	raw, exists := root[keyEncoding]
 	if !exists {
-		fmt.Printf("'%s' not found\n", keyEncoding) // TODO: change to log or remove
+		report.missing(keyEncoding)
 		return
 	}
 
 	encoding, err := bencode.AsByteString(raw)
 	if err != nil {
-		fmt.Printf("parsing '%s': %+v\n", keyEncoding, err) // TODO: change to log or remove
+		report.violation(keyEncoding, "ignored: %v", err)
 		return
 	}
 
 	t.Encoding = encoding
 }
+
+// parseURLList accepts both a single URL and a list of URLs. Empty URLs are skipped, as some
+// clients write an empty string when the torrent has no web seeds.
+// Reference: https://bittorrent.org/beps/bep_0019.html
+func (t *MetaInfo) parseURLList(root bencode.Dictionary, report *ValidationReport) {
+	if _, exists := root[keyURLList]; !exists {
+		report.missing(keyURLList)
+		return
+	}
+	t.URLList = parseURLs(root, keyURLList, report)
+}
+
+// parseHTTPSeeds accepts the same forms as 'url-list'. The key predates web seeds and is rare
+// in recent torrents, so its absence is not reported.
+// Reference: https://bittorrent.org/beps/bep_0017.html
+func (t *MetaInfo) parseHTTPSeeds(root bencode.Dictionary, report *ValidationReport) {
+	t.HTTPSeeds = parseURLs(root, keyHTTPSeeds, report)
+}
+
+// parseURLs returns the non-empty URLs under key, given as a single URL or a list of URLs.
+func parseURLs(root bencode.Dictionary, key string, report *ValidationReport) []bencode.ByteString {
+	raw, exists := root[key]
+	if !exists {
+		return nil
+	}
+
+	if single, err := bencode.AsByteString(raw); err == nil {
+		if single == "" {
+			return nil
+		}
+		return []bencode.ByteString{single}
+	}
+	rawList, err := bencode.AsList(raw)
+	if err != nil {
+		report.violation(key, "ignored: %v", err)
+		return nil
+	}
+
+	var urls []bencode.ByteString
+	for urlIdx, urlRaw := range rawList {
+		url, err := bencode.AsByteString(urlRaw)
+		if err != nil {
+			report.violation(key, "url %d skipped: %v", urlIdx, err)
+			continue
+		}
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
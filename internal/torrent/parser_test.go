@@ -0,0 +1,271 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestParseSingleFileName ensures that single-file torrents whose name contains
+// path separators or traversal components are rejected.
+func TestParseSingleFileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"bare file name", "file.txt", false},
+		{"dots inside name", "my..file.txt", false},
+		{"parent traversal", "../../etc/passwd", true},
+		{"nested path", "dir/file.txt", true},
+		{"hidden traversal", "dir/../file.txt", true},
+		{"windows separator", `..\windows\system.ini`, true},
+		{"parent directory", "..", true},
+		{"current directory", ".", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := singleFileTorrent()
+			root[keyInfo].(bencode.Dictionary)[keyName] = tc.input
+
+			mi, err := Parse(writeTorrent(t, root))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for name %q, got nil", tc.input)
+				}
+				if !strings.Contains(err.Error(), "single-file") {
+					t.Errorf("expected single-file name error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if mi.Info.Name != tc.input {
+				t.Errorf("expected name %q, got %q", tc.input, mi.Info.Name)
+			}
+		})
+	}
+}
+
+// TestParseNegativeFileLength ensures that negative file lengths are reported with the
+// offending file and value in both single-file and multi-file mode.
+func TestParseNegativeFileLength(t *testing.T) {
+	single := singleFileTorrent()
+	single[keyInfo].(bencode.Dictionary)[keyLength] = bencode.Integer(-5)
+
+	multi := multiFileTorrent()
+	files := multi[keyInfo].(bencode.Dictionary)[keyFiles].(bencode.List)
+	files[1].(bencode.Dictionary)[keyLength] = bencode.Integer(-7)
+
+	tests := []struct {
+		name     string
+		root     bencode.Dictionary
+		expected []string
+	}{
+		{"single-file", single, []string{`"file.txt"`, "-5"}},
+		{"multi-file", multi, []string{"index 1", `"cover.jpg"`, "-7"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(writeTorrent(t, tc.root))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			for _, sub := range tc.expected {
+				if !strings.Contains(err.Error(), sub) {
+					t.Errorf("expected error to contain %q, got %v", sub, err)
+				}
+			}
+		})
+	}
+}
+
+// TestParseInfoNotDictionary ensures that a corrupt 'info' value is reported with its actual type.
+func TestParseInfoNotDictionary(t *testing.T) {
+	tests := []struct {
+		name     string
+		info     bencode.Value
+		expected string
+	}{
+		{"list", bencode.List{"name", bencode.Integer(1)}, "'info' must be a dictionary, got list"},
+		{"integer", bencode.Integer(42), "'info' must be a dictionary, got integer"},
+		{"byte string", "info", "'info' must be a dictionary, got byte string"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := singleFileTorrent()
+			root[keyInfo] = tc.info
+
+			_, err := Parse(writeTorrent(t, root))
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected error to contain %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+// TestParseURLList checks that 'url-list' is accepted as a single URL or a list of URLs.
+func TestParseURLList(t *testing.T) {
+	tests := []struct {
+		name     string
+		urlList  bencode.Value // nil leaves the key out
+		expected []string
+	}{
+		{"absent", nil, nil},
+		{"single URL", "http://seed.example.com/file.txt", []string{"http://seed.example.com/file.txt"}},
+		{"empty string", "", nil},
+		{"list", bencode.List{"http://a.example.com/", "http://b.example.com/"}, []string{"http://a.example.com/", "http://b.example.com/"}},
+		{"invalid entries skipped", bencode.List{bencode.Integer(1), "", "http://a.example.com/"}, []string{"http://a.example.com/"}},
+		{"wrong type", bencode.Integer(1), nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := multiFileTorrent()
+			if tc.urlList != nil {
+				root[keyURLList] = tc.urlList
+			}
+
+			mi, err := Parse(writeTorrent(t, root))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(mi.URLList, tc.expected) {
+				t.Errorf("URLList = %q, want %q", mi.URLList, tc.expected)
+			}
+		})
+	}
+}
+
+// TestParseHTTPSeeds checks that 'httpseeds' is parsed like 'url-list', written back by
+// ToDictionary, and not reported as missing when absent.
+func TestParseHTTPSeeds(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpSeeds bencode.Value // nil leaves the key out
+		expected  []string
+	}{
+		{"absent", nil, nil},
+		{"list", bencode.List{"http://seed.example.com/seed.php", ""}, []string{"http://seed.example.com/seed.php"}},
+		{"single URL", "http://seed.example.com/seed.php", []string{"http://seed.example.com/seed.php"}},
+		{"wrong type", bencode.Integer(1), nil},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := singleFileTorrent()
+			if tc.httpSeeds != nil {
+				root[keyHTTPSeeds] = tc.httpSeeds
+			}
+
+			mi, report, err := ParseWithReport(writeTorrent(t, root), ParseOptions{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(mi.HTTPSeeds, tc.expected) {
+				t.Errorf("HTTPSeeds = %q, want %q", mi.HTTPSeeds, tc.expected)
+			}
+			if slices.Contains(report.Missing(), keyHTTPSeeds) {
+				t.Errorf("'%s' reported missing", keyHTTPSeeds)
+			}
+
+			dict, err := mi.ToDictionary()
+			if err != nil {
+				t.Fatalf("ToDictionary() returned error: %v", err)
+			}
+			if _, exists := dict[keyHTTPSeeds]; exists != (len(tc.expected) > 0) {
+				t.Errorf("'%s' written back = %v, want %v", keyHTTPSeeds, exists, len(tc.expected) > 0)
+			}
+		})
+	}
+}
+
+// TestParseFileAttributes checks the attributes and symbolic link targets of file entries.
+func TestParseFileAttributes(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   bencode.Dictionary // added to the files of multiFileTorrent
+		wantErr bool
+	}{
+		{"executable", bencode.Dictionary{"length": bencode.Integer(0), "path": bencode.List{"run.sh"}, "attr": "x"}, false},
+		{"symbolic link", bencode.Dictionary{"length": bencode.Integer(0), "path": bencode.List{"disc 1", "link"}, "attr": "l",
+			"symlink path": bencode.List{"cover.jpg"}}, false},
+		{"symbolic link without target", bencode.Dictionary{"length": bencode.Integer(0), "path": bencode.List{"link"}, "attr": "l"}, true},
+		{"symbolic link out of the torrent", bencode.Dictionary{"length": bencode.Integer(0), "path": bencode.List{"link"}, "attr": "l",
+			"symlink path": bencode.List{"..", "etc", "passwd"}}, true},
+		{"attributes not a string", bencode.Dictionary{"length": bencode.Integer(0), "path": bencode.List{"file"}, "attr": bencode.Integer(1)}, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := multiFileTorrent()
+			info := root[keyInfo].(bencode.Dictionary)
+			info[keyFiles] = append(info[keyFiles].(bencode.List), tc.entry)
+
+			mi, err := Parse(writeTorrent(t, root))
+			if tc.wantErr {
+				if err == nil {
+					t.Error("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			file := mi.Info.Files[2]
+			if file.Attr != tc.entry[keyAttr] {
+				t.Errorf("Attr = %q, want %q", file.Attr, tc.entry[keyAttr])
+			}
+			dict, err := mi.ToDictionary()
+			if err != nil {
+				t.Fatalf("ToDictionary() returned error: %v", err)
+			}
+			if !reflect.DeepEqual(dict, root) {
+				t.Errorf("ToDictionary() =>\ngot:\n%s\nwant:\n%s", bencode.ToString(dict), bencode.ToString(root))
+			}
+		})
+	}
+}
+
+// TestParseContext checks that the context variants parse like the others, and give up with
+// the context's error once it is cancelled.
+func TestParseContext(t *testing.T) {
+	path := writeTorrent(t, singleFileTorrent())
+	data, err := bencode.Encode(singleFileTorrent())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi, err := ParseContext(context.Background(), path, ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseContext() returned error: %v", err)
+	}
+	if want, _ := Parse(path); mi.InfoHash != want.InfoHash {
+		t.Errorf("ParseContext() info hash = %x, want %x", mi.InfoHash, want.InfoHash)
+	}
+	if _, err := ParseReaderContext(context.Background(), bytes.NewReader(data), ParseOptions{}); err != nil {
+		t.Errorf("ParseReaderContext() returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseContext(ctx, path, ParseOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseContext() with a cancelled context returned %v, want context.Canceled", err)
+	}
+	if _, err := ParseReaderContext(ctx, bytes.NewReader(data), ParseOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseReaderContext() with a cancelled context returned %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,46 @@
+package torrent
+
+import "github.com/lcsabi/gobit/pkg/bencode"
+
+// optional keys tracked by PresentFields, in reporting order
+var (
+	optionalRootKeys = []string{keyAnnounceList, keyCreationDate, keyComment, keyCreatedBy, keyEncoding, keyPieceLayers, keyURLList, keyHTTPSeeds, keyNodes}
+	optionalInfoKeys = []string{keyPrivate, keyMetaVersion, keySource}
+)
+
+// PresentFields returns the bencode key names of the optional fields that were present
+// in the parsed source, such as "comment" or "creation date", in a fixed order.
+// Keys of the info dictionary are reported by their own name, e.g. "private".
+// Torrents that were not produced by Parse report no fields.
+//
+// This saves callers from checking each optional field for its zero value, which cannot
+// distinguish an absent field from one explicitly set to zero or an empty string.
+func (t *MetaInfo) PresentFields() []string {
+	return append([]string(nil), t.present...)
+}
+
+// HasField reports whether the optional field with the given bencode key was present in the source.
+func (t *MetaInfo) HasField(key string) bool {
+	for _, present := range t.present {
+		if present == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *MetaInfo) recordPresentFields(root bencode.Dictionary) {
+	t.present = nil
+	for _, key := range optionalRootKeys {
+		if _, exists := root[key]; exists {
+			t.present = append(t.present, key)
+		}
+	}
+
+	info, _ := bencode.AsDictionary(root[keyInfo]) // already validated by parseInfo
+	for _, key := range optionalInfoKeys {
+		if _, exists := info[key]; exists {
+			t.present = append(t.present, key)
+		}
+	}
+}
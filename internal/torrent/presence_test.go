@@ -0,0 +1,58 @@
+package torrent
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestPresentFields verifies reporting of optional fields for torrents with all, some or none of them.
+func TestPresentFields(t *testing.T) {
+	subset := singleFileTorrent()
+	delete(subset, keyAnnounceList)
+	delete(subset, keyCreatedBy)
+	delete(subset, keyEncoding)
+	delete(subset, keyURLList)
+	subset[keyComment] = "" // present even though empty
+	delete(subset[keyInfo].(bencode.Dictionary), keyPrivate)
+
+	tests := []struct {
+		name     string
+		root     bencode.Dictionary
+		expected []string
+	}{
+		{
+			name:     "all fields",
+			root:     singleFileTorrent(),
+			expected: []string{"announce-list", "creation date", "comment", "created by", "encoding", "url-list", "private"},
+		},
+		{
+			name:     "subset",
+			root:     subset,
+			expected: []string{"creation date", "comment"},
+		},
+		{
+			name:     "required only",
+			root:     multiFileTorrent(),
+			expected: nil,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, err := Parse(writeTorrent(t, tc.root))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			if got := mi.PresentFields(); !slices.Equal(got, tc.expected) {
+				t.Errorf("PresentFields() = %q, want %q", got, tc.expected)
+			}
+			for _, key := range tc.expected {
+				if !mi.HasField(key) {
+					t.Errorf("HasField(%q) = false, want true", key)
+				}
+			}
+		})
+	}
+}
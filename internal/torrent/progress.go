@@ -0,0 +1,238 @@
+package torrent
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ScanProgress verifies the content found on disk under the download directory base against
+// the piece hashes, returning a Bitfield of the complete pieces and the percentage of pieces
+// that are complete. This is what a client does on startup to resume a download.
+//
+// Missing or short files are not an error, their pieces are simply reported as incomplete.
+// Pieces are hashed in parallel, reading one piece per worker at a time, so memory use is
+// bounded by the piece length times the number of workers.
+func (t *MetaInfo) ScanProgress(base string) (Bitfield, float64, error) {
+	return t.ScanProgressContext(context.Background(), base)
+}
+
+// ScanProgressContext is like ScanProgress but stops early with the context's error
+// once ctx is cancelled.
+func (t *MetaInfo) ScanProgressContext(ctx context.Context, base string) (Bitfield, float64, error) {
+	return t.ScanProgressWithOptions(ctx, base, HashOptions{})
+}
+
+// ScanProgressWithOptions is like ScanProgressContext, with the number of hashing workers and
+// the progress callback configured by opts.
+func (t *MetaInfo) ScanProgressWithOptions(ctx context.Context, base string, opts HashOptions) (Bitfield, float64, error) {
+	info := &t.Info
+	numPieces := info.NumPieces()
+	have := NewBitfield(numPieces)
+	if numPieces == 0 {
+		return have, 0, ctx.Err()
+	}
+
+	content := newContentReader(info, base)
+	defer content.Close()
+
+	complete := make([]bool, numPieces) // written by the workers, one index each
+	err := ForEachPiece(ctx, numPieces, opts, func(index int) error {
+		piece := make([]byte, info.PieceSize(index))
+		ok, err := content.ReadAt(piece, int64(index)*info.PieceLength)
+		if err != nil {
+			return fmt.Errorf("reading piece %d: %w", index, err)
+		}
+		complete[index] = ok && sha1.Sum(piece) == info.Pieces[index]
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	count := 0
+	for index, ok := range complete {
+		if ok {
+			have.Set(index)
+			count++
+		}
+	}
+	return have, float64(count) * 100 / float64(numPieces), nil
+}
+
+// ContentPath returns the on-disk path of the file at fileIndex under the download directory base.
+// Single-file torrents are stored as base/name, multi-file torrents as base/name/path...
+//
+// Unsafe path components, such as ".." or reserved Windows names, are renamed so the result
+// always lies below base, even for torrents parsed with PathLenient.
+func (i *InfoDict) ContentPath(base string, fileIndex int) string {
+	if !i.IsMultiFile() {
+		return filepath.Join(base, sanitizePathComponent(i.Name))
+	}
+	elems := []string{base, sanitizePathComponent(i.Name)}
+	for _, component := range i.Files[fileIndex].Path {
+		elems = append(elems, sanitizePathComponent(component))
+	}
+	return filepath.Join(elems...)
+}
+
+// SymlinkTarget returns the target of the symbolic link at fileIndex relative to the directory
+// holding the link, as it is to be created on disk below ContentPath. Unsafe components are
+// renamed like those of ContentPath, so the target always lies below the torrent directory.
+func (i *InfoDict) SymlinkTarget(fileIndex int) (string, error) {
+	file := &i.Files[fileIndex]
+	if !i.IsMultiFile() || !file.IsSymlink() || len(file.SymlinkPath) == 0 {
+		return "", fmt.Errorf("file at index %d is not a symbolic link", fileIndex)
+	}
+	var dir, target []string
+	for _, component := range file.Path[:len(file.Path)-1] {
+		dir = append(dir, sanitizePathComponent(component))
+	}
+	for _, component := range file.SymlinkPath {
+		target = append(target, sanitizePathComponent(component))
+	}
+	return filepath.Rel(filepath.Join(append([]string{"."}, dir...)...), filepath.Join(target...))
+}
+
+// contentReader reads ranges of a torrent's content spread across its files on disk.
+// Files are opened lazily and kept open until Close. It is safe for concurrent use.
+type contentReader struct {
+	info *InfoDict
+	path func(fileIndex int) string // on-disk location of each file
+
+	mu    sync.Mutex
+	files map[int]*os.File // open files by index, nil if missing
+}
+
+// newContentReader returns a reader of the content stored below the download directory base.
+func newContentReader(info *InfoDict, base string) *contentReader {
+	return newSourceReader(info, func(fileIndex int) string {
+		return info.ContentPath(base, fileIndex)
+	})
+}
+
+// newSourceReader returns a reader of content whose files are located by path.
+func newSourceReader(info *InfoDict, path func(fileIndex int) string) *contentReader {
+	return &contentReader{info: info, path: path, files: make(map[int]*os.File)}
+}
+
+// ReadAt fills p with the content starting at the global offset off. It reports false
+// if any part of the range is missing on disk, because a file is absent or too short.
+// Padding files are not read, their range is filled with zeros.
+func (c *contentReader) ReadAt(p []byte, off int64) (bool, error) {
+	var fileStart int64
+	for idx, file := range c.info.Files {
+		fileEnd := fileStart + file.Length
+		if len(p) == 0 {
+			break
+		}
+		if off >= fileEnd {
+			fileStart = fileEnd
+			continue
+		}
+
+		n := min(int64(len(p)), fileEnd-off)
+		if file.IsPadding() {
+			clear(p[:n])
+			p = p[n:]
+			off += n
+			fileStart = fileEnd
+			continue
+		}
+		f, err := c.open(idx)
+		if err != nil {
+			return false, err
+		}
+		if f == nil {
+			return false, nil
+		}
+		if _, err := f.ReadAt(p[:n], off-fileStart); err != nil {
+			if errors.Is(err, io.EOF) {
+				return false, nil
+			}
+			return false, err
+		}
+
+		p = p[n:]
+		off += n
+		fileStart = fileEnd
+	}
+	return len(p) == 0, nil
+}
+
+func (c *contentReader) open(fileIndex int) (*os.File, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if f, ok := c.files[fileIndex]; ok {
+		return f, nil
+	}
+
+	f, err := os.Open(c.path(fileIndex))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.files[fileIndex] = f
+	return f, nil
+}
+
+// Close closes every file opened by the reader.
+func (c *contentReader) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var errs []error
+	for _, f := range c.files {
+		if f != nil {
+			errs = append(errs, f.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LeftForSelection returns the number of bytes still needed from the selected files, given the
+// verified pieces in have. It is the 'left' value to report to trackers during a selective
+// download: the bytes of each selected file that are not covered by a verified piece.
+// Invalid and duplicate file indices are ignored, and so are padding files, which are never
+// downloaded.
+func (t *MetaInfo) LeftForSelection(selected []int, have Bitfield) int64 {
+	info := &t.Info
+	if info.PieceLength <= 0 {
+		return 0
+	}
+
+	var left int64
+	seen := make(map[int]bool, len(selected))
+	for _, fileIndex := range selected {
+		if fileIndex < 0 || fileIndex >= len(info.Files) || seen[fileIndex] || info.Files[fileIndex].IsPadding() {
+			continue
+		}
+		seen[fileIndex] = true
+
+		length := info.Files[fileIndex].Length
+		left += length
+		if length == 0 {
+			continue
+		}
+
+		start := info.fileOffset(fileIndex)
+		firstPiece := int(start / info.PieceLength)
+		lastPiece := int((start + length - 1) / info.PieceLength)
+		for piece := firstPiece; piece <= lastPiece; piece++ {
+			if !have.Has(piece) {
+				continue
+			}
+			if _, overlap, ok := info.PieceFileOverlap(piece, fileIndex); ok {
+				left -= overlap
+			}
+		}
+	}
+	return left
+}
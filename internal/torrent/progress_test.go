@@ -0,0 +1,111 @@
+package torrent
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// progressTorrent returns a multi-file torrent describing content split into files of the given
+// lengths, with pieces of pieceLength bytes hashed from content.
+func progressTorrent(content []byte, pieceLength int64, lengths ...int64) *MetaInfo {
+	info := InfoDict{Name: "download", PieceLength: pieceLength, multiFile: true}
+	for i, length := range lengths {
+		info.Files = append(info.Files, FileInfo{Length: length, Path: []string{"dir", string(rune('a' + i))}})
+	}
+	for start := int64(0); start < int64(len(content)); start += pieceLength {
+		end := min(start+pieceLength, int64(len(content)))
+		info.Pieces = append(info.Pieces, sha1.Sum(content[start:end]))
+	}
+	return &MetaInfo{Info: info}
+}
+
+// TestScanProgress verifies the bitfield and percentage of a partially-complete download,
+// where one file is complete, one is truncated and one is missing.
+func TestScanProgress(t *testing.T) {
+	content := makePiece(100)
+	mi := progressTorrent(content, 16, 40, 40, 20)
+	// pieces: 0 [0,16) 1 [16,32) 2 [32,48) 3 [48,64) 4 [64,80) 5 [80,96) 6 [96,100)
+	// file a [0,40) complete, file b [40,80) only its first 20 bytes, file c [80,100) missing
+
+	base := t.TempDir()
+	dir := filepath.Join(base, "download", "dir")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "a"), content[:40], 0o644)
+	os.WriteFile(filepath.Join(dir, "b"), content[40:60], 0o644)
+
+	have, percent, err := mi.ScanProgress(base)
+	if err != nil {
+		t.Fatalf("ScanProgress() returned error: %v", err)
+	}
+	for index, expected := range []bool{true, true, true, false, false, false, false} {
+		if have.Has(index) != expected {
+			t.Errorf("piece %d: complete = %v, want %v", index, have.Has(index), expected)
+		}
+	}
+	if want := 3 * 100.0 / 7; percent != want {
+		t.Errorf("percent = %f, want %f", percent, want)
+	}
+
+	// corrupting the first file and completing the others changes which pieces verify
+	corrupt := append([]byte(nil), content[:40]...)
+	corrupt[0] ^= 0xff
+	os.WriteFile(filepath.Join(dir, "a"), corrupt, 0o644)
+	os.WriteFile(filepath.Join(dir, "b"), content[40:80], 0o644)
+	os.WriteFile(filepath.Join(dir, "c"), content[80:], 0o644)
+
+	have, percent, err = mi.ScanProgress(base)
+	if err != nil {
+		t.Fatalf("ScanProgress() returned error: %v", err)
+	}
+	if have.Has(0) || have.Count(7) != 6 || percent != 6*100.0/7 {
+		t.Errorf("unexpected progress after corruption: %08b, %f%%", []byte(have), percent)
+	}
+}
+
+// TestScanProgressCancelled ensures that a cancelled context stops the scan.
+func TestScanProgressCancelled(t *testing.T) {
+	content := makePiece(64)
+	mi := progressTorrent(content, 16, 64)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := mi.ScanProgressContext(ctx, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
+
+// TestLeftForSelection verifies the remaining bytes of selected files against a partial bitfield,
+// including pieces shared with files that are not selected.
+func TestLeftForSelection(t *testing.T) {
+	mi := &MetaInfo{Info: *testLayout()}
+	// files: a [0,10) b [10,35) c [35,42); pieces of 16 bytes: 0 [0,16) 1 [16,32) 2 [32,42)
+
+	tests := []struct {
+		name     string
+		selected []int
+		have     Bitfield
+		expected int64
+	}{
+		{"nothing verified", []int{1}, bitfieldOf(3), 25},
+		{"boundary piece verified", []int{1}, bitfieldOf(3, 0), 19},
+		{"all pieces of the file verified", []int{1}, bitfieldOf(3, 0, 1, 2), 0},
+		{"piece outside the selection", []int{0}, bitfieldOf(3, 1, 2), 10},
+		{"several files", []int{0, 2}, bitfieldOf(3, 2), 10},
+		{"duplicate and invalid indices", []int{2, 2, -1, 7}, bitfieldOf(3), 7},
+		{"empty selection", nil, bitfieldOf(3), 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := mi.LeftForSelection(tc.selected, tc.have); got != tc.expected {
+				t.Errorf("LeftForSelection(%v) = %d, want %d", tc.selected, got, tc.expected)
+			}
+		})
+	}
+}
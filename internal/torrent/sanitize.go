@@ -0,0 +1,125 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PathMode selects how file path components that are unsafe to use on disk are handled.
+type PathMode int
+
+const (
+	// PathStrict rejects torrents whose file paths contain unsafe components.
+	PathStrict PathMode = iota
+	// PathLenient accepts such torrents and renames the unsafe components when the content
+	// is stored, see ContentPath. The parsed paths, and thus the info hash, are left untouched.
+	PathLenient
+)
+
+// reservedWindowsNames are the device names Windows refuses as file names, with or without extension.
+var reservedWindowsNames = []string{
+	"CON", "PRN", "AUX", "NUL",
+	"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+	"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9",
+}
+
+// checkPathComponent returns an error if component cannot safely be used as a single file or
+// directory name below the download directory: it must not be empty, "." or "..", contain
+// separators or NUL bytes, start with a drive letter, or be a reserved Windows device name.
+func checkPathComponent(component string) error {
+	switch {
+	case component == "":
+		return errors.New("empty path component")
+	case component == "." || component == "..":
+		return fmt.Errorf("path component %q refers to a directory", component)
+	case strings.ContainsAny(component, `/\`):
+		return fmt.Errorf("path component %q contains a path separator", component)
+	case strings.ContainsRune(component, 0):
+		return fmt.Errorf("path component %q contains a NUL byte", component)
+	case hasDriveLetter(component):
+		return fmt.Errorf("path component %q is an absolute path", component)
+	case isReservedWindowsName(component):
+		return fmt.Errorf("path component %q is a reserved Windows name", component)
+	}
+	return nil
+}
+
+// sanitizePathComponent returns component unchanged if it is safe, and otherwise a safe
+// name derived from it by replacing separators, NUL bytes and drive colons with underscores
+// and prefixing dot-only and reserved names with an underscore.
+func sanitizePathComponent(component string) string {
+	if checkPathComponent(component) == nil {
+		return component
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == 0 {
+			return '_'
+		}
+		return r
+	}, component)
+	if hasDriveLetter(sanitized) {
+		sanitized = sanitized[:1] + "_" + sanitized[2:]
+	}
+	if sanitized == "" || sanitized == "." || sanitized == ".." || isReservedWindowsName(sanitized) {
+		sanitized = "_" + sanitized
+	}
+	return sanitized
+}
+
+// checkPaths validates the name and every file path of the info dictionary, in both the v1
+// file list and the v2 file tree, along with the targets of symbolic links.
+func (i *InfoDict) checkPaths() error {
+	if err := checkPathComponent(i.Name); err != nil {
+		return fmt.Errorf("invalid '%s': %w", keyName, err)
+	}
+	for idx, file := range i.Files {
+		if err := checkPath(file.Path); err != nil {
+			return fmt.Errorf("invalid file path at index %d (%q): %w", idx, strings.Join(file.Path, "/"), err)
+		}
+		if len(file.SymlinkPath) == 0 {
+			continue
+		}
+		if err := checkPath(file.SymlinkPath); err != nil {
+			return fmt.Errorf("invalid '%s' at index %d (%q): %w", keySymlinkPath, idx, strings.Join(file.SymlinkPath, "/"), err)
+		}
+	}
+	for _, entry := range i.FileTree {
+		if err := checkPath(entry.Path); err != nil {
+			return fmt.Errorf("invalid '%s' entry %q: %w", keyFileTree, strings.Join(entry.Path, "/"), err)
+		}
+	}
+	return nil
+}
+
+func checkPath(path []string) error {
+	if len(path) == 0 {
+		return fmt.Errorf("empty '%s'", keyPath)
+	}
+	for _, component := range path {
+		if err := checkPathComponent(component); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasDriveLetter(component string) bool {
+	if len(component) < 2 || component[1] != ':' {
+		return false
+	}
+	letter := component[0] | 0x20 // lower case
+	return letter >= 'a' && letter <= 'z'
+}
+
+func isReservedWindowsName(component string) bool {
+	base, _, _ := strings.Cut(component, ".")
+	base = strings.TrimRight(base, " ")
+	for _, reserved := range reservedWindowsNames {
+		if strings.EqualFold(base, reserved) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package torrent
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestSanitizePathComponent checks which components are rejected and what they are renamed to.
+func TestSanitizePathComponent(t *testing.T) {
+	tests := []struct {
+		component string
+		unsafe    bool
+		sanitized string
+	}{
+		{"track 1.flac", false, "track 1.flac"},
+		{"..hidden", false, "..hidden"},
+		{"CONSOLE.txt", false, "CONSOLE.txt"},
+		{"", true, "_"},
+		{".", true, "_."},
+		{"..", true, "_.."},
+		{"a/b", true, "a_b"},
+		{`..\..\x`, true, ".._.._x"},
+		{"/etc", true, "_etc"},
+		{"nul\x00byte", true, "nul_byte"},
+		{"C:", true, "C_"},
+		{"c:windows", true, "c_windows"},
+		{"con", true, "_con"},
+		{"LPT1.log", true, "_LPT1.log"},
+		{"aux .tar.gz", true, "_aux .tar.gz"},
+	}
+
+	for _, tc := range tests {
+		err := checkPathComponent(tc.component)
+		if (err != nil) != tc.unsafe {
+			t.Errorf("checkPathComponent(%q) = %v, want unsafe %v", tc.component, err, tc.unsafe)
+		}
+		got := sanitizePathComponent(tc.component)
+		if got != tc.sanitized {
+			t.Errorf("sanitizePathComponent(%q) = %q, want %q", tc.component, got, tc.sanitized)
+		}
+		if err := checkPathComponent(got); err != nil {
+			t.Errorf("sanitized component %q is still unsafe: %v", got, err)
+		}
+	}
+}
+
+// TestParsePathModes ensures that unsafe multi-file paths are rejected by default, and that in
+// lenient mode the torrent parses with its info hash intact while its content stays below the
+// download directory.
+func TestParsePathModes(t *testing.T) {
+	strict := multiFileTorrent()
+	path := writeTorrent(t, strict)
+	safe, err := Parse(path)
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	root := multiFileTorrent()
+	files := root[keyInfo].(bencode.Dictionary)[keyFiles].(bencode.List)
+	files[0].(bencode.Dictionary)[keyPath] = bencode.List{"..", "..", "evil"}
+	files[1].(bencode.Dictionary)[keyPath] = bencode.List{"AUX.jpg"}
+	path = writeTorrent(t, root)
+
+	if _, err := Parse(path); err == nil || !strings.Contains(err.Error(), "index 0") {
+		t.Fatalf("expected error naming file index 0, got %v", err)
+	}
+
+	mi, err := ParseWithOptions(path, ParseOptions{Paths: PathLenient})
+	if err != nil {
+		t.Fatalf("ParseWithOptions(PathLenient) returned error: %v", err)
+	}
+	if mi.InfoHash == safe.InfoHash {
+		t.Error("expected the info hash to reflect the original paths")
+	}
+	if mi.Info.Files[0].Path[0] != ".." {
+		t.Errorf("parsed path was modified: %q", mi.Info.Files[0].Path)
+	}
+
+	base := t.TempDir()
+	for idx, expected := range []string{
+		filepath.Join(base, "album", "_..", "_..", "evil"),
+		filepath.Join(base, "album", "_AUX.jpg"),
+	} {
+		if got := mi.Info.ContentPath(base, idx); got != expected {
+			t.Errorf("ContentPath(%d) = %q, want %q", idx, got, expected)
+		}
+	}
+}
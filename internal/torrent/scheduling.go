@@ -0,0 +1,67 @@
+package torrent
+
+import (
+	"math/rand/v2"
+	"sort"
+)
+
+// RarestFirst returns the indices of the pieces missing from have, ordered by ascending
+// availability across the given peer bitfields, so the rarest pieces come first.
+// Pieces with equal availability are ordered randomly to spread requests across the swarm.
+// Pieces that no peer has are still included, at the front, since their availability is zero.
+func RarestFirst(have Bitfield, peers []Bitfield, numPieces int) []int {
+	availability := make([]int, numPieces)
+	for _, peer := range peers {
+		for i := 0; i < numPieces; i++ {
+			if peer.Has(i) {
+				availability[i]++
+			}
+		}
+	}
+
+	needed := make([]int, 0, numPieces)
+	for i := 0; i < numPieces; i++ {
+		if !have.Has(i) {
+			needed = append(needed, i)
+		}
+	}
+
+	// shuffle before the stable sort so ties end up in random order
+	rand.Shuffle(len(needed), func(i, j int) {
+		needed[i], needed[j] = needed[j], needed[i]
+	})
+	sort.SliceStable(needed, func(i, j int) bool {
+		return availability[needed[i]] < availability[needed[j]]
+	})
+
+	return needed
+}
+
+// SequentialOrder returns the indices of the pieces missing from have in ascending order,
+// for clients that consume the content front to back, such as media players.
+func SequentialOrder(have Bitfield, numPieces int) []int {
+	needed := make([]int, 0, numPieces)
+	for i := 0; i < numPieces; i++ {
+		if !have.Has(i) {
+			needed = append(needed, i)
+		}
+	}
+	return needed
+}
+
+// PriorityWindow returns the indices of the pieces missing from have among the count pieces
+// starting at from, in ascending order, e.g. the pieces just ahead of the playback position.
+// The window is clipped to the bitfield, so callers should keep it within the torrent's
+// piece count, since the spare bits at the end of the bitfield are never set.
+func PriorityWindow(have Bitfield, from, count int) []int {
+	start := max(from, 0)
+	end := min(from+count, len(have)*8)
+
+	var needed []int
+	for i := start; i < end; i++ {
+		if !have.Has(i) {
+			needed = append(needed, i)
+		}
+	}
+	return needed
+}
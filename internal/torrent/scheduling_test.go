@@ -0,0 +1,116 @@
+package torrent
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// bitfieldOf returns a Bitfield of numPieces bits with the given indices set.
+func bitfieldOf(numPieces int, indices ...int) Bitfield {
+	b := NewBitfield(numPieces)
+	for _, i := range indices {
+		b.Set(i)
+	}
+	return b
+}
+
+// TestRarestFirst verifies that missing pieces are ordered by ascending availability
+// and that pieces we already have are excluded.
+func TestRarestFirst(t *testing.T) {
+	const numPieces = 10
+	have := bitfieldOf(numPieces, 0, 9)
+	peers := []Bitfield{
+		bitfieldOf(numPieces, 1, 2, 3, 4, 5, 6, 7, 8),
+		bitfieldOf(numPieces, 1, 2, 3, 4, 5, 6, 8),
+		bitfieldOf(numPieces, 1, 2, 3, 5, 6, 8),
+		bitfieldOf(numPieces, 1, 2, 6),
+	}
+	// availability: 1=4 2=4 3=3 4=2 5=3 6=4 7=1 8=3
+
+	got := RarestFirst(have, peers, numPieces)
+	if len(got) != 8 {
+		t.Fatalf("expected 8 needed pieces, got %d: %v", len(got), got)
+	}
+	if got[0] != 7 {
+		t.Errorf("expected rarest piece 7 first, got %d", got[0])
+	}
+	if got[1] != 4 {
+		t.Errorf("expected piece 4 second, got %d", got[1])
+	}
+
+	// ties are shuffled, so compare each availability group as a set
+	groups := [][]int{got[2:5], got[5:8]}
+	want := [][]int{{3, 5, 8}, {1, 2, 6}}
+	for i, group := range groups {
+		sorted := append([]int(nil), group...)
+		sort.Ints(sorted)
+		if !reflect.DeepEqual(sorted, want[i]) {
+			t.Errorf("availability group %d = %v, want %v", i, sorted, want[i])
+		}
+	}
+}
+
+// TestRarestFirstNoPeers ensures that every missing piece is returned when no peers are connected.
+func TestRarestFirstNoPeers(t *testing.T) {
+	got := RarestFirst(bitfieldOf(4, 1), nil, 4)
+	sort.Ints(got)
+	if !reflect.DeepEqual(got, []int{0, 2, 3}) {
+		t.Errorf("RarestFirst() = %v, want [0 2 3]", got)
+	}
+}
+
+// TestSequentialOrder verifies ascending order of missing pieces and the playback window.
+func TestSequentialOrder(t *testing.T) {
+	const numPieces = 12
+	have := bitfieldOf(numPieces, 0, 1, 4, 6, 7)
+
+	if got := SequentialOrder(have, numPieces); !reflect.DeepEqual(got, []int{2, 3, 5, 8, 9, 10, 11}) {
+		t.Errorf("SequentialOrder() = %v, want [2 3 5 8 9 10 11]", got)
+	}
+
+	tests := []struct {
+		name        string
+		from, count int
+		expected    []int
+	}{
+		{"window with gaps", 3, 4, []int{3, 5}},
+		{"fully available window", 6, 2, nil},
+		{"window clipped at the start", -2, 4, nil},
+		{"window at the end", 9, 3, []int{9, 10, 11}},
+		{"empty window", 2, 0, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := PriorityWindow(have, tc.from, tc.count); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("PriorityWindow(%d, %d) = %v, want %v", tc.from, tc.count, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestBitfield checks setting, clearing and counting bits, including out-of-range indices.
+func TestBitfield(t *testing.T) {
+	b := NewBitfield(10)
+	if len(b) != 2 {
+		t.Fatalf("expected 2 bytes for 10 pieces, got %d", len(b))
+	}
+
+	b.Set(0)
+	b.Set(9)
+	b.Set(42) // ignored
+	if b[0] != 0x80 || b[1] != 0x40 {
+		t.Errorf("unexpected bit layout: %08b", []byte(b))
+	}
+	if !b.Has(9) || b.Has(8) || b.Has(-1) || b.Has(42) {
+		t.Error("Has reported unexpected values")
+	}
+	if got := b.Count(10); got != 2 {
+		t.Errorf("Count(10) = %d, want 2", got)
+	}
+
+	b.Clear(0)
+	if b.Has(0) {
+		t.Error("expected bit 0 to be cleared")
+	}
+}
@@ -0,0 +1,121 @@
+package torrent
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// String returns a multi-line summary of the torrent for humans: its layout and info hashes,
+// the optional metadata it carries, its tracker tiers, web seeds and DHT nodes, followed by
+// the table of its files.
+func (t *MetaInfo) String() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	field := summaryField(w)
+
+	t.Info.writeLayout(field)
+	if t.HasV1() {
+		field("Info hash", t.InfoHash.Hex())
+		field("Info hash (base32)", t.InfoHash.Base32())
+	}
+	if t.HasV2() {
+		field("Info hash v2", t.InfoHashV2.Hex())
+	}
+	field("Created", FormatTime(t.CreationTime()))
+	field("Created by", t.CreatedBy)
+	field("Comment", t.Comment)
+	field("Source", t.Info.Source)
+
+	tiers := t.AnnounceList
+	if len(tiers) == 0 && t.Announce != "" {
+		tiers = [][]string{{t.Announce}}
+	}
+	for i, tier := range tiers {
+		field(fmt.Sprintf("Tracker tier %d", i+1), strings.Join(tier, ", "))
+	}
+	for _, seed := range t.URLList {
+		field("Web seed", seed)
+	}
+	for _, seed := range t.HTTPSeeds {
+		field("HTTP seed", seed)
+	}
+	for _, node := range t.Nodes {
+		field("DHT node", node.Addr())
+	}
+	w.Flush()
+
+	t.Info.writeFiles(&sb)
+	return sb.String()
+}
+
+// String returns a multi-line summary of the info dictionary: its name, size, pieces and
+// privacy, followed by the table of its files.
+func (i *InfoDict) String() string {
+	var sb strings.Builder
+	w := tabwriter.NewWriter(&sb, 0, 0, 2, ' ', 0)
+	field := summaryField(w)
+
+	i.writeLayout(field)
+	field("Source", i.Source)
+	w.Flush()
+
+	i.writeFiles(&sb)
+	return sb.String()
+}
+
+// String returns the slash-separated path of the file followed by its size, such as
+// "disc 1/track 1.flac (29.3 KiB)".
+func (f FileInfo) String() string {
+	return fmt.Sprintf("%s (%s)", strings.Join(f.Path, "/"), FormatSize(f.Length))
+}
+
+// =====================================================================================
+
+// summaryField returns the function writing a "Name: value" line of a summary to w, skipping
+// empty values.
+func summaryField(w *tabwriter.Writer) func(name, value string) {
+	return func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", name, value)
+		}
+	}
+}
+
+// writeLayout writes the summary lines describing the content of the torrent.
+func (i *InfoDict) writeLayout(field func(name, value string)) {
+	total := i.TotalLength()
+	field("Name", i.Name)
+	field("Size", fmt.Sprintf("%s (%d bytes)", FormatSize(total), total))
+	pieces := fmt.Sprintf("%d x %s", i.NumPieces(), FormatSize(i.PieceLength))
+	if last := i.LastPieceSize(); last != 0 && last != i.PieceLength {
+		pieces += fmt.Sprintf(", last %s", FormatSize(last))
+	}
+	field("Pieces", pieces)
+	field("Private", fmt.Sprint(i.IsPrivate()))
+}
+
+// writeFiles writes the table of files with their sizes right-aligned. In multi-file torrents
+// the paths start with the torrent name, the directory the files are stored in. Padding files
+// are left out.
+func (i *InfoDict) writeFiles(sb *strings.Builder) {
+	var files []FileInfo
+	for _, f := range i.Files {
+		if !f.IsPadding() {
+			files = append(files, f)
+		}
+	}
+	fmt.Fprintf(sb, "Files (%d):\n", len(files))
+	w := tabwriter.NewWriter(sb, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, f := range files {
+		path := strings.Join(f.Path, "/")
+		if i.IsMultiFile() {
+			path = i.Name + "/" + path
+		}
+		if f.IsSymlink() {
+			path += " -> " + strings.Join(f.SymlinkPath, "/")
+		}
+		fmt.Fprintf(w, "  %s\t  %s\n", FormatSize(f.Length), path)
+	}
+	w.Flush()
+}
@@ -0,0 +1,53 @@
+package torrent
+
+import (
+	"encoding/base32"
+	"fmt"
+	"testing"
+)
+
+// TestString checks the summaries of a multi-file torrent, its info dictionary and its files.
+func TestString(t *testing.T) {
+	mi, err := Parse(writeTorrent(t, multiFileTorrent()))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	mi.Info.Private = nil
+	mi.AnnounceList = [][]string{{"http://tracker.example.com/announce"}, {"udp://backup.example.com:6969/announce"}}
+	mi.CreationDate = 1700000000
+	mi.Nodes = []Node{{Host: "::1", Port: 6881}}
+
+	expected := fmt.Sprintf(`Name:                album
+Size:                48.8 KiB (50000 bytes)
+Pieces:              2 x 32.0 KiB, last 16.8 KiB
+Private:             false
+Info hash:           %x
+Info hash (base32):  %s
+Created:             2023-11-14 22:13:20 UTC
+Tracker tier 1:      http://tracker.example.com/announce
+Tracker tier 2:      udp://backup.example.com:6969/announce
+DHT node:            [::1]:6881
+Files (2):
+    29.3 KiB  album/disc 1/track 1.flac
+    19.5 KiB  album/cover.jpg
+`, mi.InfoHash, base32.StdEncoding.EncodeToString(mi.InfoHash[:]))
+	if got := mi.String(); got != expected {
+		t.Errorf("MetaInfo.String() =\n%s\nexpected\n%s", got, expected)
+	}
+
+	expected = `Name:     album
+Size:     48.8 KiB (50000 bytes)
+Pieces:   2 x 32.0 KiB, last 16.8 KiB
+Private:  false
+Files (2):
+    29.3 KiB  album/disc 1/track 1.flac
+    19.5 KiB  album/cover.jpg
+`
+	if got := mi.Info.String(); got != expected {
+		t.Errorf("InfoDict.String() =\n%s\nexpected\n%s", got, expected)
+	}
+
+	if got := fmt.Sprint(mi.Info.Files[0]); got != "disc 1/track 1.flac (29.3 KiB)" {
+		t.Errorf("FileInfo.String() = %q", got)
+	}
+}
@@ -0,0 +1,70 @@
+package torrent
+
+import (
+	"net/url"
+	"slices"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// supported tracker URL schemes
+var trackerSchemes = []string{"http", "https", "udp"}
+
+// AllTrackers returns every usable tracker URL of the torrent: the 'announce' URL followed by
+// the announce-list in tier order, without duplicates. URLs that do not parse as tracker URLs
+// are skipped.
+func (t *MetaInfo) AllTrackers() []string {
+	var trackers []string
+	add := func(tracker string) {
+		if validTrackerURL(tracker) && !slices.Contains(trackers, tracker) {
+			trackers = append(trackers, tracker)
+		}
+	}
+
+	add(t.Announce)
+	for _, tier := range t.AnnounceList {
+		for _, tracker := range tier {
+			add(tracker)
+		}
+	}
+	return trackers
+}
+
+// removeInvalidTrackers drops tracker URLs that do not parse as tracker URLs from Announce and
+// AnnounceList, recording them in InvalidTrackers and as warnings in report. Tiers left empty
+// are dropped as well.
+func (t *MetaInfo) removeInvalidTrackers(report *ValidationReport) {
+	if t.Announce != "" && !validTrackerURL(t.Announce) {
+		t.InvalidTrackers = append(t.InvalidTrackers, t.Announce)
+		report.warn(keyAnnounce, "removed invalid tracker URL %q", t.Announce)
+		t.Announce = ""
+	}
+
+	var announceList [][]bencode.ByteString
+	for _, tier := range t.AnnounceList {
+		var urls []bencode.ByteString
+		for _, tracker := range tier {
+			if !validTrackerURL(tracker) {
+				if !slices.Contains(t.InvalidTrackers, tracker) {
+					t.InvalidTrackers = append(t.InvalidTrackers, tracker)
+					report.warn(keyAnnounceList, "removed invalid tracker URL %q", tracker)
+				}
+				continue
+			}
+			urls = append(urls, tracker)
+		}
+		if len(urls) > 0 {
+			announceList = append(announceList, urls)
+		}
+	}
+	t.AnnounceList = announceList
+}
+
+// validTrackerURL reports whether tracker is an absolute URL with a supported scheme and a host.
+func validTrackerURL(tracker string) bool {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(trackerSchemes, u.Scheme) && u.Host != ""
+}
@@ -0,0 +1,60 @@
+package torrent
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestParseInvalidTrackers verifies that garbage tracker URLs are reported while valid ones remain usable.
+func TestParseInvalidTrackers(t *testing.T) {
+	root := singleFileTorrent()
+	root["announce-list"] = bencode.List{
+		bencode.List{"http://tracker.example.com/announce"},
+		bencode.List{"::not a url::"},
+	}
+	data, err := bencode.Encode(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi, err := ParseReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ParseReader() returned error: %v", err)
+	}
+	if mi.InvalidTrackers != nil {
+		t.Errorf("expected no invalid trackers without validation, got %q", mi.InvalidTrackers)
+	}
+
+	mi, err = ParseReaderWithOptions(bytes.NewReader(data), ParseOptions{ValidateTrackers: true})
+	if err != nil {
+		t.Fatalf("ParseReaderWithOptions() returned error: %v", err)
+	}
+	if expected := []string{"::not a url::"}; !slices.Equal(mi.InvalidTrackers, expected) {
+		t.Errorf("InvalidTrackers = %q, want %q", mi.InvalidTrackers, expected)
+	}
+	if len(mi.AnnounceList) != 1 {
+		t.Errorf("expected the garbage tier to be dropped, got %q", mi.AnnounceList)
+	}
+	if expected := []string{"http://tracker.example.com/announce"}; !slices.Equal(mi.AllTrackers(), expected) {
+		t.Errorf("AllTrackers() = %q, want %q", mi.AllTrackers(), expected)
+	}
+}
+
+// TestAllTrackers checks ordering, deduplication and skipping of unusable URLs.
+func TestAllTrackers(t *testing.T) {
+	mi := &MetaInfo{
+		Announce: "http://a.example.com/announce",
+		AnnounceList: [][]bencode.ByteString{
+			{"http://a.example.com/announce", "udp://b.example.com:6969"},
+			{"ftp://c.example.com/announce", "https://d.example.com/announce", "udp://"},
+		},
+	}
+
+	expected := []string{"http://a.example.com/announce", "udp://b.example.com:6969", "https://d.example.com/announce"}
+	if got := mi.AllTrackers(); !slices.Equal(got, expected) {
+		t.Errorf("AllTrackers() = %q, want %q", got, expected)
+	}
+}
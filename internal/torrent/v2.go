@@ -0,0 +1,380 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lcsabi/gobit/internal/merkle"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// FileTreeEntry represents a file in the v2 'file tree' of the info dictionary.
+// Reference: https://bittorrent.org/beps/bep_0052.html
+type FileTreeEntry struct {
+	Path       []bencode.ByteString // file path as a slice of components (required)
+	Length     bencode.Integer      // file size in bytes (required)
+	PiecesRoot [32]byte             // root of the file's SHA-256 merkle tree, zero for empty files
+}
+
+func (i *InfoDict) parseFileTree(infoRoot bencode.Dictionary) error {
+	raw, exists := infoRoot[keyFileTree]
+	if !exists {
+		return fmt.Errorf("'%s' key not found", keyFileTree)
+	}
+
+	tree, err := bencode.AsDictionary(raw)
+	if err != nil {
+		return fmt.Errorf("parsing '%s': %w", keyFileTree, err)
+	}
+
+	var entries []FileTreeEntry
+	if err := walkFileTree(tree, nil, &entries); err != nil {
+		return fmt.Errorf("parsing '%s': %w", keyFileTree, err)
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("'%s' has no files", keyFileTree)
+	}
+
+	i.FileTree = entries
+	return nil
+}
+
+// filesFromTree fills Files from the file tree of a pure v2 torrent, which has no v1 file list.
+func (i *InfoDict) filesFromTree() {
+	files := make([]FileInfo, 0, len(i.FileTree))
+	for _, entry := range i.FileTree {
+		files = append(files, FileInfo{Length: entry.Length, Path: entry.Path})
+	}
+	i.Files = files
+	i.multiFile = len(files) > 1 || len(files[0].Path) > 1
+}
+
+// isV2Only reports whether the info dictionary describes a pure v2 torrent without v1 pieces.
+func (i *InfoDict) isV2Only() bool {
+	return i.MetaVersion == 2 && len(i.Pieces) == 0
+}
+
+// setInfoHashes computes the info hashes from the bencoded info dictionary: the SHA-1 hash unless
+// the torrent is pure v2, and the SHA-256 hash for v2 and hybrid torrents.
+func (t *MetaInfo) setInfoHashes(encodedInfo []byte) {
+	if !t.Info.isV2Only() {
+		t.InfoHash = sha1.Sum(encodedInfo)
+	}
+	if t.Info.MetaVersion == 2 {
+		t.InfoHashV2 = sha256.Sum256(encodedInfo)
+	}
+}
+
+// parsePieceLayers parses the root-level 'piece layers' dictionary, which maps the pieces root of
+// every file larger than a piece to the concatenated SHA-256 hashes of its pieces.
+func (t *MetaInfo) parsePieceLayers(root bencode.Dictionary) error {
+	raw, exists := root[keyPieceLayers]
+	if !exists {
+		return nil
+	}
+
+	layers, err := bencode.AsDictionary(raw)
+	if err != nil {
+		return fmt.Errorf("parsing '%s': %w", keyPieceLayers, err)
+	}
+
+	pieceLayers := make(map[[32]byte][][32]byte, len(layers))
+	for key, rawLayer := range layers {
+		if len(key) != 32 {
+			return fmt.Errorf("invalid '%s' key %x: expected 32 bytes, got %d", keyPieceLayers, key, len(key))
+		}
+		layer, err := bencode.AsByteString(rawLayer)
+		if err != nil {
+			return fmt.Errorf("parsing '%s' of %x: %w", keyPieceLayers, key, err)
+		}
+		if len(layer) == 0 || len(layer)%32 != 0 {
+			return fmt.Errorf("invalid '%s' of %x: length %d is not a multiple of 32", keyPieceLayers, key, len(layer))
+		}
+
+		hashes := make([][32]byte, len(layer)/32)
+		for idx := range hashes {
+			copy(hashes[idx][:], layer[idx*32:])
+		}
+		pieceLayers[[32]byte([]byte(key))] = hashes
+	}
+
+	t.PieceLayers = pieceLayers
+	return nil
+}
+
+// pieceLayersToBencode rebuilds the 'piece layers' dictionary.
+func pieceLayersToBencode(pieceLayers map[[32]byte][][32]byte) bencode.Dictionary {
+	layers := make(bencode.Dictionary, len(pieceLayers))
+	for root, hashes := range pieceLayers {
+		var layer bytes.Buffer
+		for _, hash := range hashes {
+			layer.Write(hash[:])
+		}
+		layers[string(root[:])] = layer.String()
+	}
+	return layers
+}
+
+// walkFileTree appends the files found under node to entries, in bytewise path order.
+// A file is a dictionary with a single empty key mapping to its properties.
+func walkFileTree(node bencode.Dictionary, path []bencode.ByteString, entries *[]FileTreeEntry) error {
+	names := make([]string, 0, len(node))
+	for name := range node {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" {
+			return fmt.Errorf("unexpected file properties in directory %q", strings.Join(path, "/"))
+		}
+		childPath := append(path[:len(path):len(path)], name)
+
+		child, err := bencode.AsDictionary(node[name])
+		if err != nil {
+			return fmt.Errorf("entry %q: %w", strings.Join(childPath, "/"), err)
+		}
+
+		rawProperties, isFile := child[""]
+		if !isFile {
+			if err := walkFileTree(child, childPath, entries); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entry, err := parseFileTreeEntry(rawProperties, childPath)
+		if err != nil {
+			return fmt.Errorf("file %q: %w", strings.Join(childPath, "/"), err)
+		}
+		*entries = append(*entries, entry)
+	}
+	return nil
+}
+
+func parseFileTreeEntry(raw bencode.Value, path []bencode.ByteString) (FileTreeEntry, error) {
+	properties, err := bencode.AsDictionary(raw)
+	if err != nil {
+		return FileTreeEntry{}, err
+	}
+
+	length, err := parseFileLength(properties)
+	if err != nil {
+		return FileTreeEntry{}, err
+	}
+
+	entry := FileTreeEntry{Path: path, Length: length}
+	if rawRoot, exists := properties[keyPiecesRoot]; exists {
+		root, err := bencode.AsByteString(rawRoot)
+		if err != nil {
+			return FileTreeEntry{}, fmt.Errorf("parsing '%s': %w", keyPiecesRoot, err)
+		}
+		if len(root) != 32 {
+			return FileTreeEntry{}, fmt.Errorf("invalid '%s' length: expected 32, got %d", keyPiecesRoot, len(root))
+		}
+		copy(entry.PiecesRoot[:], root)
+	} else if length > 0 {
+		return FileTreeEntry{}, fmt.Errorf("'%s' key not found", keyPiecesRoot)
+	}
+
+	return entry, nil
+}
+
+// fileTreeToBencode rebuilds the nested 'file tree' dictionary from its entries.
+func fileTreeToBencode(entries []FileTreeEntry) (bencode.Dictionary, error) {
+	tree := bencode.Dictionary{}
+	for idx, entry := range entries {
+		if len(entry.Path) == 0 {
+			return nil, fmt.Errorf("'%s' entry %d has an empty path", keyFileTree, idx)
+		}
+
+		node := tree
+		for _, component := range entry.Path[:len(entry.Path)-1] {
+			child, ok := node[component].(bencode.Dictionary)
+			if !ok {
+				child = bencode.Dictionary{}
+				node[component] = child
+			}
+			node = child
+		}
+
+		properties := bencode.Dictionary{keyLength: entry.Length}
+		if entry.Length > 0 {
+			properties[keyPiecesRoot] = string(entry.PiecesRoot[:])
+		}
+		node[entry.Path[len(entry.Path)-1]] = bencode.Dictionary{"": properties}
+	}
+	return tree, nil
+}
+
+// Validate checks the consistency of the parsed metadata beyond what Parse enforces.
+//
+// For v2 and hybrid torrents, the piece length must be a power of two of at least 16 KiB, and
+// every file larger than a piece must have a piece layer whose merkle root is the file's pieces root.
+//
+// Hybrid torrents are also cross-checked, since their v1 pieces and v2 file tree describe
+// the same content: in a hybrid, every file starts on a piece boundary thanks to padding
+// files, so the number of v1 pieces must equal the sum of each v2 file's piece count.
+// Malformed hybrids would otherwise be treated differently by v1 and v2 clients.
+//
+// All problems found are returned joined into a single error, or nil if there are none.
+func (t *MetaInfo) Validate() error {
+	var errs []error
+	if t.Info.MetaVersion == 2 {
+		if err := t.validatePieceLayers(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if t.Info.MetaVersion == 2 && t.Info.NumPieces() > 0 {
+		if err := t.Info.validateHybridPieces(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validatePieceLayers checks the v2 piece length and that the piece layer of every file larger
+// than a piece hashes up to its pieces root.
+func (t *MetaInfo) validatePieceLayers() error {
+	pieceLength := t.Info.PieceLength
+	if pieceLength < BlockSize || pieceLength&(pieceLength-1) != 0 {
+		return fmt.Errorf("invalid v2 '%s' %d: must be a power of two of at least %d", keyPieceLength, pieceLength, BlockSize)
+	}
+
+	// hash of a piece lying entirely beyond the end of a file, whose blocks hash to zero
+	padding := merkle.PadHash(bits.TrailingZeros64(uint64(pieceLength / BlockSize)))
+
+	var errs []error
+	for _, entry := range t.Info.FileTree {
+		if entry.Length <= pieceLength {
+			continue // the pieces root covers the file directly
+		}
+		path := strings.Join(entry.Path, "/")
+
+		layer, exists := t.PieceLayers[entry.PiecesRoot]
+		if !exists {
+			errs = append(errs, fmt.Errorf("file %q: missing '%s' entry", path, keyPieceLayers))
+			continue
+		}
+		if expected := int((entry.Length + pieceLength - 1) / pieceLength); len(layer) != expected {
+			errs = append(errs, fmt.Errorf("file %q: piece layer has %d hashes, expected %d", path, len(layer), expected))
+			continue
+		}
+		if merkle.Root(layer, padding) != entry.PiecesRoot {
+			errs = append(errs, fmt.Errorf("file %q: piece layer does not match its '%s'", path, keyPiecesRoot))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// PieceTree locates the v1 piece of a hybrid torrent in the v2 merkle tree of its file, so that
+// its blocks can be verified one by one against hashes received from peers.
+type PieceTree struct {
+	PiecesRoot [32]byte // pieces root of the file holding the piece
+	Index      int      // index of the first block of the piece among the leaves of the file's tree
+	Leaves     int      // number of leaves under Hash, a power of two
+	Length     int64    // bytes of the file within the piece, the leaves beyond it are zero hashes
+	Hash       [32]byte // trusted root of the leaves: a piece layer hash, or the pieces root of a small file
+}
+
+// PieceTree returns the location of the piece at index in the v2 merkle tree of its file.
+// ok is false unless the torrent is a hybrid and the piece starts a piece of a file of the
+// file tree, which holds for every piece of a well-formed hybrid except those of padding files.
+func (t *MetaInfo) PieceTree(index int) (tree PieceTree, ok bool) {
+	info := &t.Info
+	if !t.IsHybrid() || info.PieceSize(index) == 0 || info.PieceLength < BlockSize {
+		return PieceTree{}, false
+	}
+	pieceStart := int64(index) * info.PieceLength
+
+	var fileStart int64
+	for _, file := range info.Files {
+		fileEnd := fileStart + file.Length
+		if pieceStart < fileStart || pieceStart >= fileEnd {
+			fileStart = fileEnd
+			continue
+		}
+		if fileStart%info.PieceLength != 0 {
+			return PieceTree{}, false // not aligned, the piece covers the end of another file
+		}
+		idx := slices.IndexFunc(info.FileTree, func(entry FileTreeEntry) bool {
+			return slices.Equal(entry.Path, file.Path)
+		})
+		if idx < 0 || info.FileTree[idx].Length != file.Length {
+			return PieceTree{}, false // padding, or a file the v2 tree disagrees about
+		}
+		entry := info.FileTree[idx]
+
+		blocksPerPiece := int(info.PieceLength / BlockSize)
+		tree = PieceTree{
+			PiecesRoot: entry.PiecesRoot,
+			Index:      int((pieceStart - fileStart) / BlockSize),
+			Length:     min(info.PieceLength, fileEnd-pieceStart),
+		}
+		if file.Length <= info.PieceLength {
+			blocks := int((file.Length + BlockSize - 1) / BlockSize)
+			tree.Leaves = 1 << bits.Len(uint(blocks-1))
+			tree.Hash = entry.PiecesRoot
+			return tree, true
+		}
+		layer := t.PieceLayers[entry.PiecesRoot]
+		pieceInFile := int((pieceStart - fileStart) / info.PieceLength)
+		if pieceInFile >= len(layer) {
+			return PieceTree{}, false
+		}
+		tree.Leaves = blocksPerPiece
+		tree.Hash = layer[pieceInFile]
+		return tree, true
+	}
+	return PieceTree{}, false
+}
+
+// TreePiece returns the index of the v1 piece of a hybrid torrent holding the leaf at block of
+// the merkle tree of the file with the given pieces root, the reverse of PieceTree.
+func (t *MetaInfo) TreePiece(piecesRoot [32]byte, block int) (int, bool) {
+	info := &t.Info
+	if !t.IsHybrid() || block < 0 || info.PieceLength < BlockSize {
+		return 0, false
+	}
+	idx := slices.IndexFunc(info.FileTree, func(entry FileTreeEntry) bool {
+		return entry.Length > 0 && entry.PiecesRoot == piecesRoot
+	})
+	if idx < 0 || int64(block)*BlockSize >= info.FileTree[idx].Length {
+		return 0, false
+	}
+	entry := info.FileTree[idx]
+
+	var fileStart int64
+	for _, file := range info.Files {
+		if slices.Equal(file.Path, entry.Path) {
+			if fileStart%info.PieceLength != 0 {
+				return 0, false
+			}
+			return int((fileStart + int64(block)*BlockSize) / info.PieceLength), true
+		}
+		fileStart += file.Length
+	}
+	return 0, false
+}
+
+func (i *InfoDict) validateHybridPieces() error {
+	if i.PieceLength <= 0 {
+		return fmt.Errorf("invalid '%s': %d", keyPieceLength, i.PieceLength)
+	}
+
+	expected := 0
+	for _, entry := range i.FileTree {
+		expected += int((entry.Length + i.PieceLength - 1) / i.PieceLength)
+	}
+	if got := i.NumPieces(); got != expected {
+		return fmt.Errorf("hybrid torrent has %d v1 pieces, but its v2 '%s' requires %d", got, keyFileTree, expected)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// hybridTorrent returns a hybrid torrent with two files of 20000 and 10 bytes in 16 KiB pieces.
+// The v1 file list pads the first file to a piece boundary, giving 3 pieces. The first file spans
+// two pieces, so it has a piece layer whose two hashes form its pieces root.
+func hybridTorrent() bencode.Dictionary {
+	layer := strings.Repeat("l", 2*32)
+	rootA := sha256.Sum256([]byte(layer))
+	rootB := strings.Repeat("r", 32)
+	return bencode.Dictionary{
+		"announce": "http://tracker.example.com/announce",
+		"info": bencode.Dictionary{
+			"name":         "hybrid",
+			"meta version": bencode.Integer(2),
+			"piece length": bencode.Integer(16384),
+			"pieces":       strings.Repeat("p", 3*20),
+			"files": bencode.List{
+				bencode.Dictionary{"length": bencode.Integer(20000), "path": bencode.List{"a.bin"}},
+				bencode.Dictionary{"length": bencode.Integer(12768), "path": bencode.List{".pad", "12768"}},
+				bencode.Dictionary{"length": bencode.Integer(10), "path": bencode.List{"sub", "b.bin"}},
+			},
+			"file tree": bencode.Dictionary{
+				"a.bin": bencode.Dictionary{"": bencode.Dictionary{"length": bencode.Integer(20000), "pieces root": string(rootA[:])}},
+				"sub": bencode.Dictionary{
+					"b.bin": bencode.Dictionary{"": bencode.Dictionary{"length": bencode.Integer(10), "pieces root": rootB}},
+					"empty": bencode.Dictionary{"": bencode.Dictionary{"length": bencode.Integer(0)}},
+				},
+			},
+		},
+		"piece layers": bencode.Dictionary{string(rootA[:]): layer},
+	}
+}
+
+// TestParseFileTree verifies that the v2 file tree is flattened in path order and round-trips.
+func TestParseFileTree(t *testing.T) {
+	root := hybridTorrent()
+	mi, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	var paths []string
+	for _, entry := range mi.Info.FileTree {
+		paths = append(paths, strings.Join(entry.Path, "/"))
+	}
+	if expected := []string{"a.bin", "sub/b.bin", "sub/empty"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("file tree paths = %q, want %q", paths, expected)
+	}
+	if mi.Info.FileTree[2].PiecesRoot != [32]byte{} {
+		t.Error("expected zero pieces root for the empty file")
+	}
+
+	got, err := mi.ToDictionary()
+	if err != nil {
+		t.Fatalf("ToDictionary() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, root) {
+		t.Errorf("ToDictionary() =>\ngot:\n%s\nwant:\n%s", bencode.ToString(got), bencode.ToString(root))
+	}
+}
+
+// TestValidateHybridPieces checks a consistent hybrid torrent and one whose v1 piece count
+// does not match its v2 file tree.
+func TestValidateHybridPieces(t *testing.T) {
+	consistent, err := Parse(writeTorrent(t, hybridTorrent()))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if err := consistent.Validate(); err != nil {
+		t.Errorf("expected consistent hybrid to validate, got %v", err)
+	}
+
+	root := hybridTorrent()
+	info := root[keyInfo].(bencode.Dictionary)
+	info[keyPieces] = strings.Repeat("p", 2*20)
+	inconsistent, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	err = inconsistent.Validate()
+	if err == nil || !strings.Contains(err.Error(), "has 2 v1 pieces, but its v2 'file tree' requires 3") {
+		t.Errorf("expected piece count mismatch, got %v", err)
+	}
+}
+
+// TestParseFileTreeInvalid ensures that malformed file trees are rejected.
+func TestParseFileTreeInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		tree bencode.Value
+	}{
+		{"not a dictionary", bencode.List{}},
+		{"empty", bencode.Dictionary{}},
+		{"missing pieces root", bencode.Dictionary{"a": bencode.Dictionary{"": bencode.Dictionary{"length": bencode.Integer(5)}}}},
+		{"short pieces root", bencode.Dictionary{"a": bencode.Dictionary{"": bencode.Dictionary{"length": bencode.Integer(5), "pieces root": "short"}}}},
+		{"negative length", bencode.Dictionary{"a": bencode.Dictionary{"": bencode.Dictionary{"length": bencode.Integer(-1)}}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := hybridTorrent()
+			root[keyInfo].(bencode.Dictionary)[keyFileTree] = tc.tree
+			if _, err := Parse(writeTorrent(t, root)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// v2OnlyTorrent returns a pure v2 torrent: hybridTorrent without the v1 pieces and file list.
+func v2OnlyTorrent() bencode.Dictionary {
+	root := hybridTorrent()
+	info := root[keyInfo].(bencode.Dictionary)
+	delete(info, keyPieces)
+	delete(info, keyFiles)
+	return root
+}
+
+// TestParseV2Only verifies that pure v2 torrents derive their files from the file tree,
+// only carry a v2 info hash and round-trip through ToDictionary.
+func TestParseV2Only(t *testing.T) {
+	root := v2OnlyTorrent()
+	mi, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+
+	encodedInfo, err := bencode.Encode(root[keyInfo])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mi.HasV1() || mi.InfoHashV2 != sha256.Sum256(encodedInfo) {
+		t.Errorf("unexpected info hashes: v1 %x, v2 %x", mi.InfoHash, mi.InfoHashV2)
+	}
+	if !mi.Info.IsMultiFile() || len(mi.Info.Files) != 3 || mi.Info.TotalLength() != 20010 {
+		t.Errorf("unexpected files derived from the file tree: %+v", mi.Info.Files)
+	}
+	if len(mi.PieceLayers) != 1 || !mi.HasField(keyPieceLayers) {
+		t.Errorf("expected one piece layer, got %d", len(mi.PieceLayers))
+	}
+	if err := mi.Validate(); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+
+	got, err := mi.ToDictionary()
+	if err != nil {
+		t.Fatalf("ToDictionary() returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, root) {
+		t.Errorf("ToDictionary() =>\ngot:\n%s\nwant:\n%s", bencode.ToString(got), bencode.ToString(root))
+	}
+}
+
+// TestValidatePieceLayers checks the v2 piece length and the piece layer of each large file.
+func TestValidatePieceLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(root, info bencode.Dictionary)
+		contains string
+	}{
+		{
+			name: "piece length not a power of two",
+			modify: func(root, info bencode.Dictionary) {
+				info[keyPieceLength] = bencode.Integer(20000)
+			},
+			contains: "must be a power of two",
+		},
+		{
+			name:     "missing piece layer",
+			modify:   func(root, info bencode.Dictionary) { delete(root, keyPieceLayers) },
+			contains: `file "a.bin": missing 'piece layers' entry`,
+		},
+		{
+			name: "wrong number of hashes",
+			modify: func(root, info bencode.Dictionary) {
+				for key := range root[keyPieceLayers].(bencode.Dictionary) {
+					root[keyPieceLayers] = bencode.Dictionary{key: strings.Repeat("l", 3*32)}
+				}
+			},
+			contains: "piece layer has 3 hashes, expected 2",
+		},
+		{
+			name: "layer not matching the pieces root",
+			modify: func(root, info bencode.Dictionary) {
+				for key := range root[keyPieceLayers].(bencode.Dictionary) {
+					root[keyPieceLayers] = bencode.Dictionary{key: strings.Repeat("x", 2*32)}
+				}
+			},
+			contains: "piece layer does not match its 'pieces root'",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := v2OnlyTorrent()
+			tc.modify(root, root[keyInfo].(bencode.Dictionary))
+			mi, err := Parse(writeTorrent(t, root))
+			if err != nil {
+				t.Fatalf("Parse() returned error: %v", err)
+			}
+			err = mi.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("expected error containing %q, got %v", tc.contains, err)
+			}
+		})
+	}
+}
+
+// TestParsePieceLayersInvalid ensures that malformed piece layers are rejected.
+func TestParsePieceLayersInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		layers bencode.Value
+	}{
+		{"not a dictionary", bencode.List{}},
+		{"short key", bencode.Dictionary{"short": strings.Repeat("l", 64)}},
+		{"layer not a byte string", bencode.Dictionary{strings.Repeat("k", 32): bencode.Integer(1)}},
+		{"truncated layer", bencode.Dictionary{strings.Repeat("k", 32): strings.Repeat("l", 40)}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			root := hybridTorrent()
+			root[keyPieceLayers] = tc.layers
+			if _, err := Parse(writeTorrent(t, root)); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+// TestPieceTree locates the pieces of a hybrid in the merkle trees of their files and back, and
+// checks that padding and v1 torrents have no tree.
+func TestPieceTree(t *testing.T) {
+	mi, err := Parse(writeTorrent(t, hybridTorrent()))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	rootA := mi.Info.FileTree[0].PiecesRoot
+	rootB := mi.Info.FileTree[1].PiecesRoot
+	layer := mi.PieceLayers[rootA]
+
+	tests := []struct {
+		index    int
+		expected PieceTree
+	}{
+		{0, PieceTree{PiecesRoot: rootA, Index: 0, Leaves: 1, Length: 16384, Hash: layer[0]}},
+		{1, PieceTree{PiecesRoot: rootA, Index: 1, Leaves: 1, Length: 3616, Hash: layer[1]}},
+		{2, PieceTree{PiecesRoot: rootB, Index: 0, Leaves: 1, Length: 10, Hash: rootB}},
+	}
+	for _, tc := range tests {
+		got, ok := mi.PieceTree(tc.index)
+		if !ok || got != tc.expected {
+			t.Errorf("PieceTree(%d) = %+v, %v, want %+v", tc.index, got, ok, tc.expected)
+		}
+		if index, ok := mi.TreePiece(tc.expected.PiecesRoot, tc.expected.Index); !ok || index != tc.index {
+			t.Errorf("TreePiece() = %d, %v, want %d", index, ok, tc.index)
+		}
+	}
+	if _, ok := mi.TreePiece(rootB, 1); ok {
+		t.Error("TreePiece() of a block past the end of the file returned a piece")
+	}
+	if _, ok := mi.PieceTree(3); ok {
+		t.Error("PieceTree() of an invalid index returned a tree")
+	}
+
+	root := hybridTorrent()
+	info := root["info"].(bencode.Dictionary)
+	info["files"] = bencode.List{
+		bencode.Dictionary{"length": bencode.Integer(20000), "path": bencode.List{"a.bin"}},
+		bencode.Dictionary{"length": bencode.Integer(28768), "path": bencode.List{".pad", "28768"}},
+		bencode.Dictionary{"length": bencode.Integer(10), "path": bencode.List{"sub", "b.bin"}},
+	}
+	padded, err := Parse(writeTorrent(t, root))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if _, ok := padded.PieceTree(2); ok {
+		t.Error("PieceTree() of a padding piece returned a tree")
+	}
+
+	v1, err := Parse(writeTorrent(t, multiFileTorrent()))
+	if err != nil {
+		t.Fatalf("Parse() returned error: %v", err)
+	}
+	if _, ok := v1.PieceTree(0); ok {
+		t.Error("PieceTree() of a v1 torrent returned a tree")
+	}
+}
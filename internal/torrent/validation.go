@@ -0,0 +1,117 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+// IssueKind classifies an entry of a ValidationReport.
+type IssueKind int
+
+const (
+	// IssueMissing means an optional field is absent.
+	IssueMissing IssueKind = iota
+	// IssueViolation means a field breaks the specification and was ignored or partially kept.
+	IssueViolation
+	// IssueWarning means the torrent is valid but likely to cause problems.
+	IssueWarning
+)
+
+func (k IssueKind) String() string {
+	switch k {
+	case IssueMissing:
+		return "missing"
+	case IssueViolation:
+		return "violation"
+	case IssueWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("IssueKind(%d)", int(k))
+	}
+}
+
+// Issue is a single finding of a ValidationReport.
+type Issue struct {
+	Kind    IssueKind
+	Field   string // bencode key the issue is about, e.g. "announce-list"
+	Message string // empty for missing fields
+}
+
+func (i Issue) String() string {
+	if i.Message == "" {
+		return fmt.Sprintf("%s: '%s'", i.Kind, i.Field)
+	}
+	return fmt.Sprintf("%s: '%s': %s", i.Kind, i.Field, i.Message)
+}
+
+// ValidationReport lists the problems found while parsing a torrent that did not prevent it
+// from being parsed, in the order they were found.
+type ValidationReport struct {
+	Issues []Issue
+}
+
+// Missing returns the keys of the optional fields that were absent.
+func (r *ValidationReport) Missing() []string {
+	var fields []string
+	for _, issue := range r.Issues {
+		if issue.Kind == IssueMissing {
+			fields = append(fields, issue.Field)
+		}
+	}
+	return fields
+}
+
+// Violations returns the fields that break the specification.
+func (r *ValidationReport) Violations() []Issue {
+	return r.filter(IssueViolation)
+}
+
+// Warnings returns the findings about valid but questionable content.
+func (r *ValidationReport) Warnings() []Issue {
+	return r.filter(IssueWarning)
+}
+
+// ParseWithReport parses the .torrent file at path like ParseWithOptions, and also returns
+// the report of missing optional fields, spec violations and warnings found along the way.
+func ParseWithReport(path string, opts ParseOptions) (*MetaInfo, *ValidationReport, error) {
+	return parseFile(context.Background(), path, opts)
+}
+
+// ParseReaderWithReport parses a .torrent file read from r like ParseReaderWithOptions, and
+// also returns the report of the problems found along the way.
+func ParseReaderWithReport(r io.Reader, opts ParseOptions) (*MetaInfo, *ValidationReport, error) {
+	return parseReader(context.Background(), r, opts)
+}
+
+// =====================================================================================
+
+func (r *ValidationReport) filter(kind IssueKind) []Issue {
+	var issues []Issue
+	for _, issue := range r.Issues {
+		if issue.Kind == kind {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// The recording methods do nothing on a nil report, for callers that do not need one.
+
+func (r *ValidationReport) missing(field string) {
+	if r != nil {
+		r.Issues = append(r.Issues, Issue{Kind: IssueMissing, Field: field})
+	}
+}
+
+func (r *ValidationReport) violation(field, format string, args ...any) {
+	if r != nil {
+		r.Issues = append(r.Issues, Issue{Kind: IssueViolation, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
+
+func (r *ValidationReport) warn(field, format string, args ...any) {
+	if r != nil {
+		r.Issues = append(r.Issues, Issue{Kind: IssueWarning, Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+}
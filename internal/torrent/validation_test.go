@@ -0,0 +1,128 @@
+package torrent
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TestParseWithReport checks the missing fields, violations and warnings reported for
+// complete, minimal and malformed torrents.
+func TestParseWithReport(t *testing.T) {
+	malformed := singleFileTorrent()
+	malformed[keyAnnounce] = bencode.Integer(1)
+	malformed[keyAnnounceList] = bencode.List{bencode.List{"http://tracker.example.com/announce", bencode.Integer(2)}, "not a tier"}
+	malformed[keyComment] = bencode.List{}
+	malformed[keyInfo].(bencode.Dictionary)[keyPrivate] = bencode.Integer(2)
+
+	noAnnounce := multiFileTorrent()
+	delete(noAnnounce, keyAnnounce)
+
+	tests := []struct {
+		name       string
+		root       bencode.Dictionary
+		missing    []string
+		violations []string // fields, in reporting order
+		warnings   []string
+	}{
+		{
+			name:    "complete",
+			root:    singleFileTorrent(),
+			missing: []string{"nodes"},
+		},
+		{
+			name:    "required only",
+			root:    multiFileTorrent(),
+			missing: []string{"private", "announce-list", "creation date", "comment", "created by", "encoding", "url-list", "nodes"},
+		},
+		{
+			name:     "no announce",
+			root:     noAnnounce,
+			missing:  []string{"private", "announce", "announce-list", "creation date", "comment", "created by", "encoding", "url-list", "nodes"},
+			warnings: []string{"announce"},
+		},
+		{
+			name:       "malformed optional fields",
+			root:       malformed,
+			missing:    []string{"nodes"},
+			violations: []string{"private", "announce", "announce-list", "announce-list", "comment"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mi, report, err := ParseWithReport(writeTorrent(t, tc.root), ParseOptions{})
+			if err != nil {
+				t.Fatalf("ParseWithReport() returned error: %v", err)
+			}
+			if mi == nil {
+				t.Fatal("expected a torrent along with the report")
+			}
+			if got := report.Missing(); !slices.Equal(got, tc.missing) {
+				t.Errorf("Missing() = %q, want %q", got, tc.missing)
+			}
+			if got := issueFields(report.Violations()); !slices.Equal(got, tc.violations) {
+				t.Errorf("Violations() = %q, want fields %q", report.Violations(), tc.violations)
+			}
+			if got := issueFields(report.Warnings()); !slices.Equal(got, tc.warnings) {
+				t.Errorf("Warnings() = %q, want fields %q", report.Warnings(), tc.warnings)
+			}
+		})
+	}
+}
+
+// TestParseReaderWithReportTrackers verifies that trackers removed by validation are reported
+// as warnings, and that failures still return an error.
+func TestParseReaderWithReportTrackers(t *testing.T) {
+	root := singleFileTorrent()
+	root[keyAnnounce] = "::not a url::"
+	data, err := bencode.Encode(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mi, report, err := ParseReaderWithReport(bytes.NewReader(data), ParseOptions{ValidateTrackers: true})
+	if err != nil {
+		t.Fatalf("ParseReaderWithReport() returned error: %v", err)
+	}
+	warnings := report.Warnings()
+	if len(warnings) != 1 || warnings[0].Field != keyAnnounce || !strings.Contains(warnings[0].Message, "::not a url::") {
+		t.Errorf("unexpected warnings: %q", warnings)
+	}
+	if mi.Announce != "" {
+		t.Errorf("expected the invalid announce URL to be removed, got %q", mi.Announce)
+	}
+
+	if _, _, err := ParseReaderWithReport(strings.NewReader("d3:cow3:mooe"), ParseOptions{}); err == nil {
+		t.Error("expected error for data that is not a torrent, got nil")
+	}
+}
+
+// TestIssueString checks the formatting of report entries.
+func TestIssueString(t *testing.T) {
+	tests := []struct {
+		issue    Issue
+		expected string
+	}{
+		{Issue{Kind: IssueMissing, Field: "comment"}, "missing: 'comment'"},
+		{Issue{Kind: IssueViolation, Field: "private", Message: "expected 0 or 1"}, "violation: 'private': expected 0 or 1"},
+		{Issue{Kind: IssueKind(7), Field: "x", Message: "y"}, "IssueKind(7): 'x': y"},
+	}
+	for _, tc := range tests {
+		if got := tc.issue.String(); got != tc.expected {
+			t.Errorf("String() = %q, want %q", got, tc.expected)
+		}
+	}
+}
+
+// issueFields returns the field of each issue.
+func issueFields(issues []Issue) []string {
+	var fields []string
+	for _, issue := range issues {
+		fields = append(fields, issue.Field)
+	}
+	return fields
+}
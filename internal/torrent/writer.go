@@ -0,0 +1,141 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// TorrentWriter creates a single-file torrent from content streamed through Write,
+// hashing pieces on the fly so the content never has to be stored or read twice.
+// This allows creating a torrent for data produced on the fly, such as a backup stream.
+//
+// Close hashes the final piece and writes the complete bencoded .torrent to the
+// underlying writer. The resulting MetaInfo is then available through MetaInfo.
+type TorrentWriter struct {
+	out         io.Writer
+	name        string
+	announce    string
+	pieceLength int64
+
+	pieces   *pieceHasher
+	metaInfo *MetaInfo // set by Close
+	closed   bool
+}
+
+// NewTorrentWriter returns a TorrentWriter emitting a torrent named name to out, with pieces of
+// pieceLength bytes and the given announce URL. The piece length must be known up front
+// since pieces are hashed as the content flows through.
+func NewTorrentWriter(out io.Writer, name string, pieceLength int64, announce string) (*TorrentWriter, error) {
+	if pieceLength <= 0 {
+		return nil, fmt.Errorf("invalid '%s': must be positive, got %d", keyPieceLength, pieceLength)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("'%s' must not be empty", keyName)
+	}
+
+	return &TorrentWriter{
+		out:         out,
+		name:        name,
+		announce:    announce,
+		pieceLength: pieceLength,
+		pieces:      newPieceHasher(pieceLength),
+	}, nil
+}
+
+// Write hashes p as the next part of the content. It never returns a short write.
+func (w *TorrentWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed TorrentWriter")
+	}
+
+	return w.pieces.Write(p)
+}
+
+// Close hashes the last, possibly short, piece and writes the .torrent file to the underlying writer.
+// It returns an error if no content was written, since a torrent cannot describe empty content.
+func (w *TorrentWriter) Close() error {
+	if w.closed {
+		return errors.New("TorrentWriter already closed")
+	}
+	w.closed = true
+
+	pieces := w.pieces.Finish()
+	if w.pieces.length == 0 {
+		return errors.New("cannot create a torrent without content")
+	}
+
+	metaInfo := &MetaInfo{
+		Announce: w.announce,
+		Info: InfoDict{
+			Name:        w.name,
+			PieceLength: w.pieceLength,
+			Pieces:      pieces,
+			Files:       []FileInfo{{Length: w.pieces.length, Path: []bencode.ByteString{w.name}}},
+		},
+	}
+	if err := metaInfo.hashInfo(); err != nil {
+		return err
+	}
+	if _, err := metaInfo.WriteTo(w.out); err != nil {
+		return err
+	}
+
+	w.metaInfo = metaInfo
+	return nil
+}
+
+// MetaInfo returns the torrent produced by a successful Close, or nil before that.
+func (w *TorrentWriter) MetaInfo() *MetaInfo {
+	return w.metaInfo
+}
+
+// pieceHasher splits a stream of content into pieces and computes their SHA-1 hashes.
+type pieceHasher struct {
+	pieceLength int64
+	hasher      hash.Hash  // SHA-1 state of the current piece
+	pending     int64      // bytes hashed into the current piece
+	length      int64      // total bytes written
+	pieces      [][20]byte // hashes of completed pieces
+}
+
+func newPieceHasher(pieceLength int64) *pieceHasher {
+	return &pieceHasher{pieceLength: pieceLength, hasher: sha1.New()}
+}
+
+// Write hashes p as the next part of the content. It never returns an error.
+func (h *pieceHasher) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(int64(len(p)), h.pieceLength-h.pending)
+		h.hasher.Write(p[:n]) // hash.Hash never returns an error
+		h.pending += n
+		h.length += n
+		p = p[n:]
+
+		if h.pending == h.pieceLength {
+			h.finishPiece()
+		}
+	}
+	return written, nil
+}
+
+// Finish hashes the last, possibly short, piece and returns the hashes of all pieces.
+func (h *pieceHasher) Finish() [][20]byte {
+	if h.pending > 0 {
+		h.finishPiece()
+	}
+	return h.pieces
+}
+
+func (h *pieceHasher) finishPiece() {
+	var sum [20]byte
+	h.hasher.Sum(sum[:0])
+	h.pieces = append(h.pieces, sum)
+	h.hasher.Reset()
+	h.pending = 0
+}
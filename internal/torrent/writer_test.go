@@ -0,0 +1,70 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"testing"
+)
+
+// TestTorrentWriter streams content through a TorrentWriter in uneven chunks and verifies
+// that the produced torrent parses and its pieces match the content.
+func TestTorrentWriter(t *testing.T) {
+	const pieceLength = 1024
+	content := makePiece(5*pieceLength + 123)
+
+	var out bytes.Buffer
+	w, err := NewTorrentWriter(&out, "backup.tar", pieceLength, "http://tracker.example.com/announce")
+	if err != nil {
+		t.Fatalf("NewTorrentWriter() returned error: %v", err)
+	}
+	for rest, chunk := content, 1; len(rest) > 0; chunk = chunk*3 + 1 {
+		n := min(chunk, len(rest))
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("Write() returned error: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close() returned error: %v", err)
+	}
+
+	mi, err := ParseReader(&out)
+	if err != nil {
+		t.Fatalf("ParseReader() returned error: %v", err)
+	}
+	if mi.InfoHash != w.MetaInfo().InfoHash {
+		t.Error("parsed info hash does not match the writer's MetaInfo")
+	}
+	if mi.Info.TotalLength() != int64(len(content)) || mi.Info.NumPieces() != 6 {
+		t.Fatalf("unexpected layout: length %d, %d pieces", mi.Info.TotalLength(), mi.Info.NumPieces())
+	}
+	for i, expected := range mi.Info.Pieces {
+		start := int64(i) * pieceLength
+		piece := content[start : start+mi.Info.PieceSize(i)]
+		if sha1.Sum(piece) != expected {
+			t.Errorf("piece %d does not verify against the content", i)
+		}
+	}
+
+	if _, err := w.Write([]byte("late")); err == nil {
+		t.Error("expected error writing after Close, got nil")
+	}
+}
+
+// TestTorrentWriterInvalid ensures that invalid parameters and empty content are rejected.
+func TestTorrentWriterInvalid(t *testing.T) {
+	if _, err := NewTorrentWriter(&bytes.Buffer{}, "name", 0, ""); err == nil {
+		t.Error("expected error for zero piece length, got nil")
+	}
+	if _, err := NewTorrentWriter(&bytes.Buffer{}, "", 1024, ""); err == nil {
+		t.Error("expected error for empty name, got nil")
+	}
+
+	w, err := NewTorrentWriter(&bytes.Buffer{}, "empty", 1024, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("expected error closing a writer without content, got nil")
+	}
+}
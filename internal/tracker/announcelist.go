@@ -0,0 +1,138 @@
+package tracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Status describes the announces made to a single tracker of an AnnounceList.
+type Status struct {
+	URL          string
+	Tier         int       // index of the tier the tracker belongs to
+	LastAnnounce time.Time // time of the last announce attempt, zero if never tried
+	LastError    error     // error of the last attempt, nil if it succeeded or never happened
+	NextAnnounce time.Time // when the tracker asked to be announced to again, zero if unknown
+}
+
+// AnnounceList keeps the trackers of a torrent's announce-list in the order BEP 12 prescribes:
+// each tier is shuffled once, and a tracker answering an announce is moved to the front of its
+// tier, so later announces try it first. It is safe for concurrent use.
+//
+// Reference: https://bittorrent.org/beps/bep_0012.html
+type AnnounceList struct {
+	mu    sync.Mutex
+	tiers [][]*Status
+}
+
+// NewAnnounceList returns an AnnounceList for the given tiers, shuffling the trackers of
+// each tier. Empty tiers are dropped.
+func NewAnnounceList(tiers [][]string) *AnnounceList {
+	return newAnnounceList(tiers, true)
+}
+
+func newAnnounceList(tiers [][]string, shuffle bool) *AnnounceList {
+	l := &AnnounceList{}
+	for _, tier := range tiers {
+		if len(tier) == 0 {
+			continue
+		}
+		trackers := make([]*Status, len(tier))
+		for i, announceURL := range tier {
+			trackers[i] = &Status{URL: announceURL, Tier: len(l.tiers)}
+		}
+		if shuffle {
+			rand.Shuffle(len(trackers), func(i, j int) { trackers[i], trackers[j] = trackers[j], trackers[i] })
+		}
+		l.tiers = append(l.tiers, trackers)
+	}
+	return l
+}
+
+// Announce announces to the trackers in their current order until one succeeds, falling back
+// to the next tier once every tracker of a tier failed. The tracker that answered is promoted
+// to the front of its tier. It returns the response and the URL of that tracker, or an error
+// wrapping every tracker failure.
+func (l *AnnounceList) Announce(ctx context.Context, c *Client, req AnnounceRequest) (*AnnounceResponse, string, error) {
+	log := c.logger()
+	var errs []error
+	for tierIdx, tier := range l.Tiers() {
+		for _, announceURL := range tier {
+			if err := ctx.Err(); err != nil {
+				return nil, "", err
+			}
+
+			started := time.Now()
+			resp, err := c.Announce(ctx, announceURL, req)
+			l.record(tierIdx, announceURL, started, resp, err)
+			if err == nil {
+				return resp, announceURL, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", announceURL, err))
+			log.DebugContext(ctx, "failing over to next tracker", "tier", tierIdx, "failed", announceURL)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, "", errors.New("no trackers to announce to")
+	}
+	return nil, "", fmt.Errorf("all trackers failed: %w", errors.Join(errs...))
+}
+
+// Tiers returns the announce URLs of every tier in their current order.
+func (l *AnnounceList) Tiers() [][]string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tiers := make([][]string, len(l.tiers))
+	for i, tier := range l.tiers {
+		for _, tracker := range tier {
+			tiers[i] = append(tiers[i], tracker.URL)
+		}
+	}
+	return tiers
+}
+
+// Status returns the status of every tracker, tier by tier in their current order.
+func (l *AnnounceList) Status() []Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var statuses []Status
+	for _, tier := range l.tiers {
+		for _, tracker := range tier {
+			statuses = append(statuses, *tracker)
+		}
+	}
+	return statuses
+}
+
+// record stores the outcome of an announce to the tracker at announceURL in the given tier,
+// promoting the tracker to the front of the tier if it succeeded.
+func (l *AnnounceList) record(tierIdx int, announceURL string, started time.Time, resp *AnnounceResponse, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	tier := l.tiers[tierIdx]
+	i := slices.IndexFunc(tier, func(s *Status) bool { return s.URL == announceURL })
+	if i < 0 {
+		return
+	}
+	tracker := tier[i]
+	tracker.LastAnnounce = started
+	tracker.LastError = err
+	if err != nil {
+		return
+	}
+
+	tracker.NextAnnounce = time.Time{}
+	if resp.Interval > 0 {
+		tracker.NextAnnounce = started.Add(resp.Interval)
+	}
+	copy(tier[1:i+1], tier[:i])
+	tier[0] = tracker
+}
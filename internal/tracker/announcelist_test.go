@@ -0,0 +1,139 @@
+package tracker
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTracker is a test tracker answering every announce with body and counting them.
+type countingTracker struct {
+	server *httptest.Server
+	hits   atomic.Int32
+}
+
+func newCountingTracker(t *testing.T, body string) *countingTracker {
+	t.Helper()
+	tr := &countingTracker{}
+	tr.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr.hits.Add(1)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(tr.server.Close)
+	return tr
+}
+
+func (tr *countingTracker) url() string {
+	return tr.server.URL + "/announce"
+}
+
+// TestNewAnnounceList checks that tiers keep their trackers and empty tiers are dropped.
+func TestNewAnnounceList(t *testing.T) {
+	l := NewAnnounceList([][]string{{"http://a", "http://b", "http://c"}, {}, {"http://d"}})
+	tiers := l.Tiers()
+	if len(tiers) != 2 {
+		t.Fatalf("got %d tiers, want 2", len(tiers))
+	}
+	first := slices.Clone(tiers[0])
+	slices.Sort(first)
+	if !slices.Equal(first, []string{"http://a", "http://b", "http://c"}) || !slices.Equal(tiers[1], []string{"http://d"}) {
+		t.Errorf("unexpected tiers: %q", tiers)
+	}
+
+	for _, status := range l.Status() {
+		expectedTier := 0
+		if status.URL == "http://d" {
+			expectedTier = 1
+		}
+		if status.Tier != expectedTier || !status.LastAnnounce.IsZero() || status.LastError != nil {
+			t.Errorf("unexpected initial status: %+v", status)
+		}
+	}
+}
+
+// TestAnnounceListFailover falls back to the second tier and verifies that the working
+// tracker is promoted and tried first afterwards.
+func TestAnnounceListFailover(t *testing.T) {
+	failing := []*countingTracker{
+		newCountingTracker(t, "d14:failure reason4:downe"),
+		newCountingTracker(t, "d14:failure reason4:downe"),
+		newCountingTracker(t, "d14:failure reason4:downe"),
+	}
+	working := newCountingTracker(t, "d8:intervali60e5:peers0:e")
+
+	l := NewAnnounceList([][]string{
+		{failing[0].url(), failing[1].url()},
+		{failing[2].url(), working.url()},
+	})
+	var client Client
+	before := time.Now()
+	for i := 0; i < 2; i++ {
+		resp, used, err := l.Announce(context.Background(), &client, AnnounceRequest{})
+		if err != nil {
+			t.Fatalf("announce %d: unexpected error: %v", i, err)
+		}
+		if used != working.url() || resp.Interval != time.Minute {
+			t.Errorf("announce %d: answered by %q with %+v", i, used, resp)
+		}
+	}
+
+	if got := l.Tiers()[1][0]; got != working.url() {
+		t.Errorf("expected the working tracker at the front of its tier, got %q", got)
+	}
+	// the first tier is tried on every announce, the failing tracker of the second tier at most
+	// once, before the working tracker was promoted
+	if failing[0].hits.Load() != 2 || failing[1].hits.Load() != 2 || failing[2].hits.Load() > 1 {
+		t.Errorf("unexpected announce counts: %d %d %d", failing[0].hits.Load(), failing[1].hits.Load(), failing[2].hits.Load())
+	}
+	if working.hits.Load() != 2 {
+		t.Errorf("working tracker received %d announces, want 2", working.hits.Load())
+	}
+
+	for _, status := range l.Status() {
+		switch status.URL {
+		case working.url():
+			if status.LastError != nil || status.LastAnnounce.Before(before) || status.NextAnnounce != status.LastAnnounce.Add(time.Minute) {
+				t.Errorf("unexpected status of the working tracker: %+v", status)
+			}
+		case failing[0].url(), failing[1].url():
+			if status.LastError == nil || !strings.Contains(status.LastError.Error(), "down") || !status.NextAnnounce.IsZero() {
+				t.Errorf("unexpected status of a failing tracker: %+v", status)
+			}
+		}
+	}
+}
+
+// TestAnnounceListErrors covers announce-lists where no tracker answers.
+func TestAnnounceListErrors(t *testing.T) {
+	failing := newCountingTracker(t, "d14:failure reason4:downe")
+	var client Client
+
+	tests := []struct {
+		name     string
+		tiers    [][]string
+		ctx      func() context.Context
+		contains string
+	}{
+		{"no trackers", nil, context.Background, "no trackers"},
+		{"all failed", [][]string{{failing.url()}}, context.Background, "all trackers failed"},
+		{"cancelled", [][]string{{failing.url()}}, func() context.Context {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx
+		}, "canceled"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := NewAnnounceList(tc.tiers).Announce(tc.ctx(), &client, AnnounceRequest{})
+			if err == nil || !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("expected error containing %q, got %v", tc.contains, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package tracker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/compact"
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/logging"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// store response dictionary keys
+const (
+	keyFailureReason  = "failure reason"
+	keyWarningMessage = "warning message"
+	keyInterval       = "interval"
+	keyMinInterval    = "min interval"
+	keyTrackerID      = "tracker id"
+	keyComplete       = "complete"
+	keyIncomplete     = "incomplete"
+	keyPeers          = "peers"
+	keyPeers6         = "peers6"
+
+	// dictionary model peer keys
+	keyPeerID = "peer id"
+	keyIP     = "ip"
+	keyPort   = "port"
+)
+
+// MaxResponseSize limits how much of a tracker response is read to prevent memory exhaustion.
+const MaxResponseSize = 2 * 1024 * 1024 // 2 MB
+
+// Event is the optional event reported to the tracker in an announce request.
+type Event string
+
+const (
+	EventNone      Event = ""
+	EventStarted   Event = "started"
+	EventCompleted Event = "completed"
+	EventStopped   Event = "stopped"
+)
+
+// AnnounceRequest holds the parameters sent to a tracker in an announce request.
+// Reference: https://wiki.theory.org/BitTorrentSpecification#Tracker_Request_Parameters
+type AnnounceRequest struct {
+	InfoHash   infohash.V1 // SHA-1 hash of the bencoded info dictionary
+	PeerID     [20]byte    // unique ID of this client
+	Port       uint16      // port this client is listening on
+	Uploaded   int64       // total bytes uploaded since the 'started' event
+	Downloaded int64       // total bytes downloaded since the 'started' event
+	Left       int64       // bytes this client still has to download
+	Event      Event       // started, completed, stopped or none for regular announces
+	NumWant    int         // number of peers requested, zero leaves it to the tracker
+	TrackerID  string      // tracker id returned by a previous announce, if any
+
+	// IPv6 is the IPv6 address of this client, sent in the 'ipv6' parameter so trackers
+	// can hand it out to IPv6 peers even when announcing over IPv4. Omitted if invalid.
+	IPv6 netip.Addr
+}
+
+// Peer is a peer address returned by a tracker.
+type Peer struct {
+	ID   string         // peer ID, only present in the dictionary model
+	Addr netip.AddrPort // IP address and port of the peer
+}
+
+// AnnounceResponse is the decoded response of a successful announce.
+// Reference: https://wiki.theory.org/BitTorrentSpecification#Tracker_Response
+type AnnounceResponse struct {
+	Interval    time.Duration // time to wait between regular announces
+	MinInterval time.Duration // minimum announce interval, zero if not provided
+	TrackerID   string        // tracker id to send back in subsequent announces
+	Complete    int64         // number of seeders
+	Incomplete  int64         // number of leechers
+	Warning     string        // warning message, the response is still processed
+	Peers       []Peer        // peers returned by the tracker
+}
+
+// Client announces to HTTP trackers.
+// The zero value is ready to use with http.DefaultClient and the tracker subsystem logger.
+type Client struct {
+	HTTPClient *http.Client // client used for requests, http.DefaultClient if nil
+	Logger     *slog.Logger // logger for announce diagnostics, logging.For(logging.Tracker) if nil
+	UserAgent  string       // User-Agent header of the requests, Go's default if empty
+}
+
+// NewClient returns a Client using the given logger, or the tracker subsystem logger if nil.
+func NewClient(logger *slog.Logger) *Client {
+	return &Client{Logger: logger}
+}
+
+// Announce sends an announce request to a single tracker and decodes its response.
+func (c *Client) Announce(ctx context.Context, announceURL string, req AnnounceRequest) (*AnnounceResponse, error) {
+	log := c.logger()
+	log.DebugContext(ctx, "announcing to tracker", "url", announceURL, "event", string(req.Event))
+
+	resp, err := c.announce(ctx, announceURL, req)
+	if err != nil {
+		log.WarnContext(ctx, "tracker announce failed", "url", announceURL, "error", err)
+		return nil, err
+	}
+
+	log.DebugContext(ctx, "tracker announce succeeded",
+		"url", announceURL,
+		"interval", resp.Interval,
+		"peers", len(resp.Peers),
+	)
+	if resp.Warning != "" {
+		log.WarnContext(ctx, "tracker returned warning", "url", announceURL, "warning", resp.Warning)
+	}
+	return resp, nil
+}
+
+// AnnounceTiers announces to the trackers of a BEP 12 announce-list, trying each tracker
+// of each tier in order until one succeeds. It returns the response and the URL of the
+// tracker that answered, or an error wrapping every tracker failure. Unlike AnnounceList,
+// it keeps no state between calls.
+//
+// Reference: https://bittorrent.org/beps/bep_0012.html
+func (c *Client) AnnounceTiers(ctx context.Context, tiers [][]string, req AnnounceRequest) (*AnnounceResponse, string, error) {
+	return newAnnounceList(tiers, false).Announce(ctx, c, req)
+}
+
+// =====================================================================================
+
+func (c *Client) logger() *slog.Logger {
+	return logging.Or(c.Logger, logging.Tracker)
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+func (c *Client) announce(ctx context.Context, announceURL string, req AnnounceRequest) (*AnnounceResponse, error) {
+	u, err := buildAnnounceURL(announceURL, req)
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if c.UserAgent != "" {
+		httpReq.Header.Set("User-Agent", c.UserAgent)
+	}
+	httpResp, err := c.httpClient().Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected HTTP status: %s", httpResp.Status)
+	}
+
+	return ParseAnnounceResponse(io.LimitReader(httpResp.Body, MaxResponseSize))
+}
+
+func buildAnnounceURL(announceURL string, req AnnounceRequest) (string, error) {
+	u, err := url.Parse(announceURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid announce URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported tracker scheme: %q", u.Scheme)
+	}
+
+	query := u.Query()
+	query.Set("port", strconv.Itoa(int(req.Port)))
+	query.Set("uploaded", strconv.FormatInt(req.Uploaded, 10))
+	query.Set("downloaded", strconv.FormatInt(req.Downloaded, 10))
+	query.Set("left", strconv.FormatInt(req.Left, 10))
+	query.Set("compact", "1")
+	if req.Event != EventNone {
+		query.Set("event", string(req.Event))
+	}
+	if req.NumWant > 0 {
+		query.Set("numwant", strconv.Itoa(req.NumWant))
+	}
+	if req.TrackerID != "" {
+		query.Set("trackerid", req.TrackerID)
+	}
+	if req.IPv6.Is6() && !req.IPv6.Is4In6() {
+		query.Set("ipv6", req.IPv6.String())
+	}
+
+	// raw 20-byte values are escaped by hand, url.Values would encode spaces as '+'
+	rawQuery := "info_hash=" + req.InfoHash.URLEncode() + "&peer_id=" + infohash.EscapeBytes(req.PeerID[:])
+	rawQuery += "&" + query.Encode()
+	u.RawQuery = rawQuery
+	return u.String(), nil
+}
+
+// ParseAnnounceResponse decodes a bencoded tracker response, accepting peers in both
+// the compact (BEP 23) and the dictionary model, and IPv6 peers in the compact 'peers6'
+// list of BEP 7. One of 'peers' and 'peers6' must be present.
+func ParseAnnounceResponse(r io.Reader) (*AnnounceResponse, error) {
+	decoded, err := bencode.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("decoding tracker response: %w", err)
+	}
+	root, err := bencode.AsDictionary(decoded)
+	if err != nil {
+		return nil, fmt.Errorf("expected bencoded dictionary in tracker response: %w", err)
+	}
+
+	if raw, exists := root[keyFailureReason]; exists {
+		reason, _ := bencode.AsByteString(raw)
+		return nil, fmt.Errorf("tracker failure: %s", reason)
+	}
+
+	var resp AnnounceResponse
+	raw, exists := root[keyInterval]
+	if !exists {
+		return nil, fmt.Errorf("'%s' key not found", keyInterval)
+	}
+	interval, err := bencode.AsInteger(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing '%s': %w", keyInterval, err)
+	}
+	resp.Interval = time.Duration(interval) * time.Second
+
+	if raw, exists := root[keyMinInterval]; exists {
+		if minInterval, err := bencode.AsInteger(raw); err == nil {
+			resp.MinInterval = time.Duration(minInterval) * time.Second
+		}
+	}
+	if raw, exists := root[keyTrackerID]; exists {
+		resp.TrackerID, _ = bencode.AsByteString(raw)
+	}
+	if raw, exists := root[keyWarningMessage]; exists {
+		resp.Warning, _ = bencode.AsByteString(raw)
+	}
+	if raw, exists := root[keyComplete]; exists {
+		resp.Complete, _ = bencode.AsInteger(raw)
+	}
+	if raw, exists := root[keyIncomplete]; exists {
+		resp.Incomplete, _ = bencode.AsInteger(raw)
+	}
+
+	raw, hasPeers := root[keyPeers]
+	if hasPeers {
+		peers, err := parsePeers(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing '%s': %w", keyPeers, err)
+		}
+		resp.Peers = peers
+	}
+	raw, hasPeers6 := root[keyPeers6]
+	if hasPeers6 {
+		peers6, err := bencode.AsByteString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parsing '%s': %w", keyPeers6, err)
+		}
+		peers, err := parseCompactPeers(peers6, compact.ParsePeers6)
+		if err != nil {
+			return nil, fmt.Errorf("parsing '%s': %w", keyPeers6, err)
+		}
+		resp.Peers = append(resp.Peers, peers...)
+	}
+	if !hasPeers && !hasPeers6 {
+		return nil, fmt.Errorf("'%s' key not found", keyPeers)
+	}
+
+	return &resp, nil
+}
+
+func parsePeers(raw bencode.Value) ([]Peer, error) {
+	switch peers := raw.(type) {
+	case bencode.ByteString:
+		return parseCompactPeers(peers, compact.ParsePeers)
+
+	case bencode.List:
+		return parseDictionaryPeers(peers)
+
+	default:
+		return nil, fmt.Errorf("expected byte string or list, got %s", bencode.TypeOf(raw))
+	}
+}
+
+// parseCompactPeers decodes compact peers with parse: IPv4 peers in 'peers' and IPv6 peers in
+// 'peers6'.
+//
+// Reference: https://bittorrent.org/beps/bep_0023.html
+// Reference: https://bittorrent.org/beps/bep_0007.html
+func parseCompactPeers(peers string, parse func([]byte) ([]netip.AddrPort, error)) ([]Peer, error) {
+	addrs, err := parse([]byte(peers))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Peer, 0, len(addrs))
+	for _, addr := range addrs {
+		result = append(result, Peer{Addr: addr})
+	}
+	return result, nil
+}
+
+func parseDictionaryPeers(peers bencode.List) ([]Peer, error) {
+	result := make([]Peer, 0, len(peers))
+	for idx, elem := range peers {
+		dict, err := bencode.AsDictionary(elem)
+		if err != nil {
+			return nil, fmt.Errorf("peer %d: %w", idx, err)
+		}
+
+		rawIP, err := bencode.AsByteString(dict[keyIP])
+		if err != nil {
+			return nil, fmt.Errorf("peer %d: parsing '%s': %w", idx, keyIP, err)
+		}
+		ip, err := netip.ParseAddr(rawIP)
+		if err != nil {
+			return nil, fmt.Errorf("peer %d: invalid '%s' %q", idx, keyIP, rawIP)
+		}
+
+		port, err := bencode.AsInteger(dict[keyPort])
+		if err != nil {
+			return nil, fmt.Errorf("peer %d: parsing '%s': %w", idx, keyPort, err)
+		}
+		if port <= 0 || port > 65535 {
+			return nil, fmt.Errorf("peer %d: invalid port %d", idx, port)
+		}
+
+		peerID, _ := bencode.AsByteString(dict[keyPeerID]) // optional
+		result = append(result, Peer{
+			ID:   peerID,
+			Addr: netip.AddrPortFrom(ip.Unmap(), uint16(port)),
+		})
+	}
+	return result, nil
+}
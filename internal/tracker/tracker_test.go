@@ -0,0 +1,250 @@
+package tracker
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingHandler is a slog.Handler that keeps every record for later inspection.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+// messages returns the level and message of each recorded entry.
+func (h *recordingHandler) messages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var result []string
+	for _, r := range h.records {
+		result = append(result, r.Level.String()+" "+r.Message)
+	}
+	return result
+}
+
+// attr returns the value of the named attribute of the first record with the given message.
+func (h *recordingHandler) attr(message, key string) (slog.Value, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Message != message {
+			continue
+		}
+		var value slog.Value
+		found := false
+		r.Attrs(func(a slog.Attr) bool {
+			if a.Key == key {
+				value, found = a.Value, true
+				return false
+			}
+			return true
+		})
+		return value, found
+	}
+	return slog.Value{}, false
+}
+
+// TestAnnounceTiersLogging verifies that announce attempts, failures, failover and
+// successful responses are logged at the expected levels.
+func TestAnnounceTiersLogging(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d14:failure reason12:unregisterede"))
+	}))
+	defer failing.Close()
+
+	working := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// two compact peers: 10.0.0.1:6881 and 10.0.0.2:6882
+		w.Write([]byte("d8:intervali1800e5:peers12:\x0a\x00\x00\x01\x1a\xe1\x0a\x00\x00\x02\x1a\xe2e"))
+	}))
+	defer working.Close()
+
+	handler := &recordingHandler{}
+	client := NewClient(slog.New(handler))
+
+	tiers := [][]string{{failing.URL + "/announce"}, {working.URL + "/announce"}}
+	resp, used, err := client.AnnounceTiers(context.Background(), tiers, AnnounceRequest{Left: 100})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if used != working.URL+"/announce" {
+		t.Errorf("expected answer from %q, got %q", working.URL, used)
+	}
+	if resp.Interval != 30*time.Minute || len(resp.Peers) != 2 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	expected := []string{
+		"DEBUG announcing to tracker",
+		"WARN tracker announce failed",
+		"DEBUG failing over to next tracker",
+		"DEBUG announcing to tracker",
+		"DEBUG tracker announce succeeded",
+	}
+	if got := handler.messages(); !slices.Equal(got, expected) {
+		t.Fatalf("unexpected log records:\ngot:  %q\nwant: %q", got, expected)
+	}
+
+	if peers, ok := handler.attr("tracker announce succeeded", "peers"); !ok || peers.Int64() != 2 {
+		t.Errorf("expected peers=2 attribute, got %v", peers)
+	}
+	if errValue, ok := handler.attr("tracker announce failed", "error"); !ok || !strings.Contains(errValue.String(), "unregistered") {
+		t.Errorf("expected error attribute mentioning failure reason, got %v", errValue)
+	}
+}
+
+// TestAnnounceDefaultLogger ensures that a Client without a logger works and stays quiet.
+func TestAnnounceDefaultLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("compact") != "1" {
+			t.Errorf("expected compact=1 in query, got %q", r.URL.RawQuery)
+		}
+		w.Write([]byte("d8:intervali60e5:peers0:e"))
+	}))
+	defer server.Close()
+
+	var client Client
+	resp, err := client.Announce(context.Background(), server.URL, AnnounceRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Interval != time.Minute || len(resp.Peers) != 0 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+// TestAnnounceUserAgent checks that the User-Agent of the client is sent, and that Go's default
+// is kept without one.
+func TestAnnounceUserAgent(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.UserAgent()
+		w.Write([]byte("d8:intervali60e5:peers0:e"))
+	}))
+	defer server.Close()
+
+	client := Client{UserAgent: "gobit/0.1.0"}
+	if _, err := client.Announce(context.Background(), server.URL, AnnounceRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "gobit/0.1.0" {
+		t.Errorf("User-Agent = %q, expected %q", got, "gobit/0.1.0")
+	}
+
+	client.UserAgent = ""
+	if _, err := client.Announce(context.Background(), server.URL, AnnounceRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(got, "Go-http-client/") {
+		t.Errorf("User-Agent without a configured one = %q", got)
+	}
+}
+
+// TestParseAnnounceResponse checks decoding of compact and dictionary model peers.
+func TestParseAnnounceResponse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []Peer
+		wantErr  bool
+	}{
+		{
+			name:     "compact peers",
+			input:    "d8:intervali900e5:peers6:\x7f\x00\x00\x01\x1a\xe1e",
+			expected: []Peer{{Addr: netip.MustParseAddrPort("127.0.0.1:6881")}},
+		},
+		{
+			name:  "dictionary peers",
+			input: "d8:intervali900e5:peersld2:ip3:::17:peer id20:-GB0001-aaaaaaaaaaaa4:porti51413eeee",
+			expected: []Peer{{
+				ID:   "-GB0001-aaaaaaaaaaaa",
+				Addr: netip.MustParseAddrPort("[::1]:51413"),
+			}},
+		},
+		{
+			name:  "compact IPv6 peers",
+			input: "d8:intervali900e5:peers6:\x7f\x00\x00\x01\x1a\xe16:peers618:\x20\x01\x0d\xb8" + strings.Repeat("\x00", 11) + "\x01\x1a\xe1e",
+			expected: []Peer{
+				{Addr: netip.MustParseAddrPort("127.0.0.1:6881")},
+				{Addr: netip.MustParseAddrPort("[2001:db8::1]:6881")},
+			},
+		},
+		{
+			name:     "only IPv6 peers",
+			input:    "d8:intervali900e6:peers618:" + strings.Repeat("\x00", 15) + "\x01\x1a\xe1e",
+			expected: []Peer{{Addr: netip.MustParseAddrPort("[::1]:6881")}},
+		},
+		{name: "failure reason", input: "d14:failure reason4:nopee", wantErr: true},
+		{name: "truncated compact IPv6 peers", input: "d8:intervali900e6:peers66:\x7f\x00\x00\x01\x1a\xe1e", wantErr: true},
+		{name: "missing peers", input: "d8:intervali900ee", wantErr: true},
+		{name: "truncated compact peers", input: "d8:intervali900e5:peers5:\x7f\x00\x00\x01\x1ae", wantErr: true},
+		{name: "missing interval", input: "d5:peers0:e", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := ParseAnnounceResponse(strings.NewReader(tc.input))
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !slices.Equal(resp.Peers, tc.expected) {
+				t.Errorf("expected peers %v, got %v", tc.expected, resp.Peers)
+			}
+		})
+	}
+}
+
+// TestBuildAnnounceURLIPv6 checks that only a real IPv6 address is sent in 'ipv6'.
+func TestBuildAnnounceURLIPv6(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   netip.Addr
+		want string
+	}{
+		{name: "IPv6", ip: netip.MustParseAddr("2001:db8::1"), want: "2001:db8::1"},
+		{name: "unset", ip: netip.Addr{}},
+		{name: "IPv4", ip: netip.MustParseAddr("192.0.2.1")},
+		{name: "IPv4-mapped", ip: netip.MustParseAddr("::ffff:192.0.2.1")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			raw, err := buildAnnounceURL("http://tracker.example/announce", AnnounceRequest{IPv6: tc.ip})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			u, err := url.Parse(raw)
+			if err != nil {
+				t.Fatalf("invalid URL %q: %v", raw, err)
+			}
+			if got := u.Query().Get("ipv6"); got != tc.want {
+				t.Errorf("ipv6 = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
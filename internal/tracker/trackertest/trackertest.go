@@ -0,0 +1,58 @@
+package trackertest
+
+import (
+	"net/netip"
+
+	"github.com/lcsabi/gobit/internal/compact"
+	"github.com/lcsabi/gobit/internal/tracker"
+	"github.com/lcsabi/gobit/pkg/bencode"
+)
+
+// AnnounceResponseBytes returns a valid bencoded announce response with the given interval
+// in seconds and peers. With compact set, IPv4 peers are encoded in the compact model of BEP 23,
+// IPv6 peers in the compact 'peers6' list of BEP 7, and peer IDs are dropped; otherwise every
+// peer is encoded as a dictionary.
+//
+// Reference: https://wiki.theory.org/BitTorrentSpecification#Tracker_Response
+func AnnounceResponseBytes(interval int, peers []tracker.Peer, compact bool) []byte {
+	response := bencode.Dictionary{
+		"interval": bencode.Integer(interval),
+	}
+
+	if compact {
+		buf, buf6 := encodeCompact(peers)
+		response["peers"] = string(buf)
+		if len(buf6) > 0 {
+			response["peers6"] = string(buf6)
+		}
+	} else {
+		list := make(bencode.List, 0, len(peers))
+		for _, peer := range peers {
+			entry := bencode.Dictionary{
+				"ip":   peer.Addr.Addr().String(),
+				"port": bencode.Integer(peer.Addr.Port()),
+			}
+			if peer.ID != "" {
+				entry["peer id"] = peer.ID
+			}
+			list = append(list, entry)
+		}
+		response["peers"] = list
+	}
+
+	// encoding only fails for unsupported types, which are never used here
+	encoded, err := bencode.Encode(response)
+	if err != nil {
+		panic("trackertest: encoding announce response: " + err.Error())
+	}
+	return encoded
+}
+
+// encodeCompact returns the compact 'peers' and 'peers6' strings of peers.
+func encodeCompact(peers []tracker.Peer) (buf, buf6 []byte) {
+	addrs := make([]netip.AddrPort, 0, len(peers))
+	for _, peer := range peers {
+		addrs = append(addrs, peer.Addr)
+	}
+	return compact.EncodePeers(addrs)
+}
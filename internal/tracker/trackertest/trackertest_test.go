@@ -0,0 +1,83 @@
+package trackertest
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/tracker"
+)
+
+// TestAnnounceResponseBytes verifies that the tracker client parses generated responses
+// served by an httptest server in both compact and dictionary form.
+func TestAnnounceResponseBytes(t *testing.T) {
+	peers := []tracker.Peer{
+		{ID: "-GB0001-000000000001", Addr: netip.MustParseAddrPort("192.0.2.1:6881")},
+		{ID: "-GB0001-000000000002", Addr: netip.MustParseAddrPort("198.51.100.7:51413")},
+	}
+
+	tests := []struct {
+		name     string
+		compact  bool
+		expected []tracker.Peer
+	}{
+		{
+			name:    "compact",
+			compact: true,
+			expected: []tracker.Peer{
+				{Addr: peers[0].Addr}, // compact peers carry no peer ID
+				{Addr: peers[1].Addr},
+			},
+		},
+		{
+			name:     "dictionary",
+			compact:  false,
+			expected: peers,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write(AnnounceResponseBytes(1800, peers, tc.compact))
+			}))
+			defer server.Close()
+
+			var client tracker.Client
+			resp, err := client.Announce(context.Background(), server.URL+"/announce", tracker.AnnounceRequest{})
+			if err != nil {
+				t.Fatalf("Announce() returned error: %v", err)
+			}
+			if resp.Interval != 30*time.Minute {
+				t.Errorf("expected interval of 30m, got %v", resp.Interval)
+			}
+			if !slices.Equal(resp.Peers, tc.expected) {
+				t.Errorf("expected peers %v, got %v", tc.expected, resp.Peers)
+			}
+		})
+	}
+}
+
+// TestAnnounceResponseBytesIPv6 ensures that IPv6 peers are kept in dictionary form and
+// moved to 'peers6' in compact form.
+func TestAnnounceResponseBytesIPv6(t *testing.T) {
+	peers := []tracker.Peer{
+		{Addr: netip.MustParseAddrPort("192.0.2.1:6881")},
+		{Addr: netip.MustParseAddrPort("[2001:db8::1]:6881")},
+	}
+
+	for _, compact := range []bool{false, true} {
+		resp, err := tracker.ParseAnnounceResponse(bytes.NewReader(AnnounceResponseBytes(60, peers, compact)))
+		if err != nil {
+			t.Fatalf("compact=%v: unexpected error: %v", compact, err)
+		}
+		if !slices.Equal(resp.Peers, peers) {
+			t.Errorf("compact=%v: expected peers %v, got %v", compact, peers, resp.Peers)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package webseed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// maxBusyBody bounds the body of a 503 response read for its retry delay.
+const maxBusyBody = 64
+
+// BusyError is returned by FetchHTTPSeed when the HTTP seed is too busy to serve the request.
+type BusyError struct {
+	RetryAfter time.Duration // how long the seed asked to be left alone, zero if it did not say
+}
+
+func (e *BusyError) Error() string {
+	if e.RetryAfter == 0 {
+		return "HTTP seed is busy"
+	}
+	return fmt.Sprintf("HTTP seed is busy, retry after %v", e.RetryAfter)
+}
+
+// HTTPSeedURL returns the URL requesting length bytes at offset begin within the piece at
+// index from the HTTP seed at seedURL. The query parameters are appended to those of the seed
+// URL, which is usually a script serving the content of many torrents.
+func HTTPSeedURL(seedURL string, infoHash infohash.V1, index int, begin, length int64) (string, error) {
+	u, err := url.Parse(seedURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid HTTP seed URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported HTTP seed scheme: %q", u.Scheme)
+	}
+
+	query := "info_hash=" + infoHash.URLEncode() + "&piece=" + strconv.Itoa(index) +
+		"&ranges=" + strconv.FormatInt(begin, 10) + "-" + strconv.FormatInt(begin+length-1, 10)
+	if u.RawQuery != "" {
+		query = u.RawQuery + "&" + query
+	}
+	u.RawQuery = query
+	return u.String(), nil
+}
+
+// FetchHTTPSeed downloads length bytes at offset begin within the piece at index from the
+// HTTP seed at seedURL, using the protocol of BEP 17: the seed is asked for the piece by info
+// hash and index rather than for the files by path. It returns a *BusyError when the seed
+// asks to be retried later.
+//
+// Reference: https://bittorrent.org/beps/bep_0017.html
+func (c *Client) FetchHTTPSeed(ctx context.Context, seedURL string, infoHash infohash.V1, info *torrent.InfoDict, index int, begin, length int64) ([]byte, error) {
+	if err := checkRange(info, index, begin, length); err != nil {
+		return nil, err
+	}
+	requestURL, err := HTTPSeedURL(seedURL, infoHash, index, begin, length)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusServiceUnavailable:
+		// the body holds the number of seconds to wait before asking again
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxBusyBody))
+		busy := &BusyError{}
+		if seconds, err := strconv.Atoi(strings.TrimSpace(string(body))); err == nil && seconds > 0 {
+			busy.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, busy
+	default:
+		return nil, fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, fmt.Errorf("piece %d: reading %d bytes at offset %d: %w", index, length, begin, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,121 @@
+package webseed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+)
+
+// TestHTTPSeedURL checks the query of requests, appended to the one of the seed URL if any.
+func TestHTTPSeedURL(t *testing.T) {
+	hash := infohash.V1{0x12, 0x34, ' ', 0xff}
+	tests := []struct {
+		name     string
+		seedURL  string
+		expected string
+	}{
+		{"plain", "http://seed.example.com/seed.php",
+			"http://seed.example.com/seed.php?info_hash=%124%20%FF%00%00%00%00%00%00%00%00%00%00%00%00%00%00%00%00&piece=3&ranges=16-31"},
+		{"existing query", "https://seed.example.com/seed?key=abc",
+			"https://seed.example.com/seed?key=abc&info_hash=%124%20%FF%00%00%00%00%00%00%00%00%00%00%00%00%00%00%00%00&piece=3&ranges=16-31"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := HTTPSeedURL(tc.seedURL, hash, 3, 16, 16)
+			if err != nil {
+				t.Fatalf("HTTPSeedURL() returned error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("HTTPSeedURL() = %q, want %q", got, tc.expected)
+			}
+		})
+	}
+
+	if _, err := HTTPSeedURL("ftp://seed.example.com/", hash, 0, 0, 1); err == nil {
+		t.Error("expected error for an unsupported scheme")
+	}
+}
+
+// TestFetchHTTPSeed downloads a range of a piece from a script serving the torrent by info
+// hash, piece and ranges.
+func TestFetchHTTPSeed(t *testing.T) {
+	info := multiFileInfo()
+	hash := infohash.V1{1, 2, 3}
+	whole := content(0, 30)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("info_hash") != string(hash[:]) || query.Get("piece") != "1" || query.Get("ranges") != "2-6" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		w.Write(whole[8+2 : 8+7])
+	}))
+	defer server.Close()
+
+	var client Client
+	got, err := client.FetchHTTPSeed(context.Background(), server.URL+"/seed.php", hash, info, 1, 2, 5)
+	if err != nil {
+		t.Fatalf("FetchHTTPSeed() returned error: %v", err)
+	}
+	if !bytes.Equal(got, whole[10:15]) {
+		t.Errorf("FetchHTTPSeed() = %v, want %v", got, whole[10:15])
+	}
+}
+
+// TestFetchHTTPSeedErrors covers busy seeds, HTTP errors, truncated responses and invalid ranges.
+func TestFetchHTTPSeedErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/busy":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("30\n"))
+		case "/overloaded":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			w.Write([]byte("short"))
+		}
+	}))
+	defer server.Close()
+
+	info := multiFileInfo()
+	tests := []struct {
+		name     string
+		path     string
+		index    int
+		contains string
+		busy     time.Duration // expected RetryAfter of a *BusyError, -1 unless busy
+	}{
+		{"busy", "/busy", 0, "retry after 30s", 30 * time.Second},
+		{"busy without delay", "/overloaded", 0, "busy", 0},
+		{"not found", "/missing", 0, "404", -1},
+		{"truncated", "/seed", 0, "unexpected EOF", -1},
+		{"piece out of range", "/seed", 4, "out of range", -1},
+	}
+
+	var client Client
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.FetchHTTPSeed(context.Background(), server.URL+tc.path, infohash.V1{}, info, tc.index, 0, 8)
+			if err == nil || !strings.Contains(err.Error(), tc.contains) {
+				t.Fatalf("expected error containing %q, got %v", tc.contains, err)
+			}
+			var busy *BusyError
+			if errors.As(err, &busy) != (tc.busy >= 0) {
+				t.Fatalf("error %v: busy = %v, want %v", err, busy != nil, tc.busy >= 0)
+			}
+			if busy != nil && busy.RetryAfter != tc.busy {
+				t.Errorf("RetryAfter = %v, want %v", busy.RetryAfter, tc.busy)
+			}
+		})
+	}
+}
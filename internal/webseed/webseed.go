@@ -0,0 +1,141 @@
+// Package webseed downloads torrent content from HTTP web seeds.
+//
+// A web seed is a plain HTTP server hosting the torrent's files, listed in the 'url-list' key
+// of the metainfo. Any byte range of a piece is fetched with ranged GET requests, one for each
+// file the range overlaps.
+//
+// Older torrents list HTTP seeds in the 'httpseeds' key instead. These are scripts asked for a
+// byte range of a piece by info hash and piece index, and may answer that they are busy.
+//
+// References:
+//   - https://bittorrent.org/beps/bep_0019.html
+//   - https://bittorrent.org/beps/bep_0017.html
+package webseed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// Client downloads from web seeds.
+// The zero value is ready to use with http.DefaultClient.
+type Client struct {
+	HTTPClient *http.Client // client used for requests, http.DefaultClient if nil
+	UserAgent  string       // User-Agent header of the requests, Go's default if empty
+}
+
+// FileURL returns the URL of the file at fileIndex on the web seed at seedURL.
+//
+// For single-file torrents, a seed URL ending in '/' is a directory the file name is appended
+// to, any other URL points at the file itself. For multi-file torrents, the torrent name and
+// the file path are appended to the seed URL.
+func FileURL(seedURL string, info *torrent.InfoDict, fileIndex int) (string, error) {
+	if fileIndex < 0 || fileIndex >= len(info.Files) {
+		return "", fmt.Errorf("file index %d out of range", fileIndex)
+	}
+	u, err := url.Parse(seedURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid web seed URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported web seed scheme: %q", u.Scheme)
+	}
+
+	var segments []string
+	switch {
+	case info.IsMultiFile():
+		segments = append([]string{info.Name}, info.Files[fileIndex].Path...)
+	case strings.HasSuffix(u.Path, "/"):
+		segments = []string{info.Name}
+	default:
+		return u.String(), nil
+	}
+	return u.JoinPath(segments...).String(), nil
+}
+
+// Fetch downloads length bytes at offset begin within the piece at index from the web seed
+// at seedURL.
+func (c *Client) Fetch(ctx context.Context, seedURL string, info *torrent.InfoDict, index int, begin, length int64) ([]byte, error) {
+	if err := checkRange(info, index, begin, length); err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, length)
+	start := int64(index)*info.PieceLength + begin // offset of the range in the whole content
+	end := start + length
+	var fileStart int64
+	for i, file := range info.Files {
+		fileEnd := fileStart + file.Length
+		if lo, hi := max(start, fileStart), min(end, fileEnd); lo < hi && !file.IsPadding() {
+			fileURL, err := FileURL(seedURL, info, i)
+			if err != nil {
+				return nil, err
+			}
+			if err := c.fetchRange(ctx, fileURL, lo-fileStart, data[lo-start:hi-start]); err != nil {
+				return nil, fmt.Errorf("%s: %w", fileURL, err)
+			}
+		}
+		fileStart = fileEnd
+	}
+	return data, nil
+}
+
+// =====================================================================================
+
+// checkRange reports whether length bytes at offset begin are within the piece at index.
+func checkRange(info *torrent.InfoDict, index int, begin, length int64) error {
+	pieceSize := info.PieceSize(index)
+	if pieceSize == 0 {
+		return fmt.Errorf("piece index %d out of range", index)
+	}
+	if begin < 0 || length < 0 || begin+length > pieceSize {
+		return fmt.Errorf("piece %d: range [%d, %d) exceeds the piece size %d", index, begin, begin+length, pieceSize)
+	}
+	return nil
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// fetchRange fills p with the content of the file at fileURL starting at offset.
+func (c *Client) fetchRange(ctx context.Context, fileURL string, offset int64, p []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+int64(len(p))-1))
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server ignored the range and sends the whole file
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			return fmt.Errorf("skipping to offset %d: %w", offset, err)
+		}
+	default:
+		return fmt.Errorf("unexpected HTTP status: %s", resp.Status)
+	}
+
+	if _, err := io.ReadFull(resp.Body, p); err != nil {
+		return fmt.Errorf("reading %d bytes at offset %d: %w", len(p), offset, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package webseed
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// multiFileInfo returns a torrent of two files of 10 and 20 bytes with 8-byte pieces,
+// so piece 1 spans both files.
+func multiFileInfo() *torrent.InfoDict {
+	return &torrent.InfoDict{
+		Name:        "album",
+		PieceLength: 8,
+		Pieces:      make([][20]byte, 4),
+		Files: []torrent.FileInfo{
+			{Length: 10, Path: []string{"disc 1", "track.flac"}},
+			{Length: 20, Path: []string{"cover.jpg"}},
+		},
+	}
+}
+
+// content returns n bytes of deterministic content starting with the given byte.
+func content(first byte, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = first + byte(i)
+	}
+	return data
+}
+
+// TestFileURL checks the URLs of single-file and multi-file torrents.
+func TestFileURL(t *testing.T) {
+	single := &torrent.InfoDict{Name: "file name.txt", PieceLength: 8, Files: []torrent.FileInfo{{Length: 10}}}
+	multi := multiFileInfo()
+
+	tests := []struct {
+		name      string
+		seedURL   string
+		info      *torrent.InfoDict
+		fileIndex int
+		expected  string
+	}{
+		{"single file directory", "http://seed.example.com/files/", single, 0, "http://seed.example.com/files/file%20name.txt"},
+		{"single file URL", "http://seed.example.com/other.txt", single, 0, "http://seed.example.com/other.txt"},
+		{"multi-file", "http://seed.example.com/files/", multi, 0, "http://seed.example.com/files/album/disc%201/track.flac"},
+		{"multi-file without slash", "https://seed.example.com/files", multi, 1, "https://seed.example.com/files/album/cover.jpg"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := FileURL(tc.seedURL, tc.info, tc.fileIndex)
+			if err != nil {
+				t.Fatalf("FileURL() returned error: %v", err)
+			}
+			if got != tc.expected {
+				t.Errorf("FileURL() = %q, want %q", got, tc.expected)
+			}
+		})
+	}
+
+	for _, seedURL := range []string{"ftp://seed.example.com/", "://invalid"} {
+		if _, err := FileURL(seedURL, single, 0); err == nil {
+			t.Errorf("FileURL(%q): expected error, got nil", seedURL)
+		}
+	}
+	if _, err := FileURL("http://seed.example.com/", single, 1); err == nil {
+		t.Error("expected error for a file index out of range")
+	}
+}
+
+// TestFetch downloads ranges spanning one and two files from a file server.
+func TestFetch(t *testing.T) {
+	dir := t.TempDir()
+	track, cover := content(0, 10), content(100, 20)
+	if err := os.MkdirAll(filepath.Join(dir, "album", "disc 1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "album", "disc 1", "track.flac"), track, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "album", "cover.jpg"), cover, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	whole := append(append([]byte(nil), track...), cover...)
+	info := multiFileInfo()
+	tests := []struct {
+		name          string
+		index         int
+		begin, length int64
+	}{
+		{"first piece", 0, 0, 8},
+		{"across files", 1, 0, 8},
+		{"block inside piece", 2, 3, 4},
+		{"short last piece", 3, 0, 6},
+	}
+
+	var client Client
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := client.Fetch(context.Background(), server.URL+"/", info, tc.index, tc.begin, tc.length)
+			if err != nil {
+				t.Fatalf("Fetch() returned error: %v", err)
+			}
+			start := int64(tc.index)*info.PieceLength + tc.begin
+			if expected := whole[start : start+tc.length]; !bytes.Equal(got, expected) {
+				t.Errorf("Fetch() = %v, want %v", got, expected)
+			}
+		})
+	}
+}
+
+// TestFetchIgnoredRange accepts servers that answer ranged requests with the whole file.
+func TestFetchIgnoredRange(t *testing.T) {
+	data := content(0, 20)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	info := &torrent.InfoDict{Name: "file", PieceLength: 8, Pieces: make([][20]byte, 3), Files: []torrent.FileInfo{{Length: 20}}}
+	var client Client
+	got, err := client.Fetch(context.Background(), server.URL+"/file", info, 1, 2, 6)
+	if err != nil {
+		t.Fatalf("Fetch() returned error: %v", err)
+	}
+	if !bytes.Equal(got, data[10:16]) {
+		t.Errorf("Fetch() = %v, want %v", got, data[10:16])
+	}
+}
+
+// TestFetchErrors covers invalid ranges, HTTP errors and truncated files.
+func TestFetchErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("short"))
+	}))
+	defer server.Close()
+
+	info := &torrent.InfoDict{Name: "file", PieceLength: 8, Pieces: make([][20]byte, 3), Files: []torrent.FileInfo{{Length: 20}}}
+	tests := []struct {
+		name          string
+		seedURL       string
+		index         int
+		begin, length int64
+		contains      string
+	}{
+		{"piece out of range", server.URL + "/file", 3, 0, 1, "out of range"},
+		{"range exceeds piece", server.URL + "/file", 2, 2, 4, "exceeds"},
+		{"not found", server.URL + "/missing", 0, 0, 8, "404"},
+		{"truncated", server.URL + "/file", 0, 0, 8, "unexpected EOF"},
+	}
+
+	var client Client
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := client.Fetch(context.Background(), tc.seedURL, info, tc.index, tc.begin, tc.length)
+			if err == nil || !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("expected error containing %q, got %v", tc.contains, err)
+			}
+		})
+	}
+}
@@ -1,13 +1,16 @@
 package bencode
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"unsafe"
 )
 
 // Value represents any valid bencode value. It may be one of:
@@ -51,17 +54,134 @@ func Decode(r io.Reader) (Value, error) {
 		return nil, err
 	}
 
-	br := bytes.NewReader(data)
-	val, err := parseBencode(br)
+	return decodeAll(data, DecodeOptions{})
+}
+
+// DefaultMaxStringLength is the longest byte string accepted when DecodeOptions.MaxStringLength
+// is zero. It fits the 'pieces' string of torrents of a few hundred gigabytes.
+const DefaultMaxStringLength = 10 * 1024 * 1024 // 10 MB
+
+// DefaultMaxDepth is the deepest nesting of lists and dictionaries accepted when
+// DecodeOptions.MaxDepth is zero. Torrents nest a few levels deep, v2 file trees one more per
+// directory, so it only rejects input crafted to exhaust the stack of the recursive decoder.
+const DefaultMaxDepth = 512
+
+// ErrMaxDepth is returned, wrapped, when the input nests lists and dictionaries deeper than
+// allowed by DecodeOptions.MaxDepth.
+var ErrMaxDepth = errors.New("maximum nesting depth exceeded")
+
+// SyntaxError describes invalid input and the byte offset it was found at, counted from the
+// start of the data being decoded. Limit violations, such as ErrMaxDepth, are reported the
+// same way and can be matched with errors.Is.
+type SyntaxError struct {
+	Offset int64  // position of the offending byte, or the length of the input if it ended early
+	Msg    string // description of the problem
+	Err    error  // underlying error, such as io.ErrUnexpectedEOF or ErrMaxDepth, if any
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.Msg, e.Offset)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// DecodeOptions configures optional decoding behavior. The zero value decodes like Decode:
+// it rejects malformed input, but accepts non-canonical encodings unless Strict is set.
+type DecodeOptions struct {
+	// AllowLengthWhitespace tolerates spaces and tabs between the digits of a byte string's
+	// length and its ':' separator, e.g. "4 :spam", as produced by some buggy torrent editors.
+	// Such input is rejected by default.
+	AllowLengthWhitespace bool
+
+	// ZeroCopy makes decoded byte strings reference the input buffer instead of copying it,
+	// which saves an allocation and a copy per byte string, e.g. for the large 'pieces' blob.
+	// It is only supported by DecodeBytes, where the caller owns the buffer.
+	//
+	// WARNING: the decoded values alias the input, so the buffer must not be modified or
+	// reused for as long as any decoded value is in use. Doing so silently changes the
+	// contents of strings that Go otherwise guarantees to be immutable.
+	ZeroCopy bool
+
+	// Strict only accepts the canonical encoding of a value, the one Encode produces: dictionary
+	// keys must be unique and sorted, and integers must not carry a '+' sign. Non-canonical input
+	// is accepted by default for interoperability, but re-encoding it yields different bytes, so
+	// code that hashes re-encoded data, such as info hashes, should decode strictly.
+	// Strict takes precedence over AllowLengthWhitespace.
+	Strict bool
+
+	// Limits bound the resources spent on untrusted input, such as tracker responses or
+	// messages from peers, and can be raised for unusually large torrents. Decoding fails as
+	// soon as one is exceeded.
+	MaxStringLength int64 // longest byte string in bytes, DefaultMaxStringLength if zero
+	MaxElements     int   // number of values, counting dictionary keys and nested values, unlimited if zero
+	MaxSize         int64 // size of the whole input in bytes, unlimited if zero
+	MaxDepth        int   // deepest nesting of lists and dictionaries, DefaultMaxDepth if zero
+}
+
+// maxStringLength returns the effective byte string length limit.
+func (o DecodeOptions) maxStringLength() int64 {
+	if o.MaxStringLength == 0 {
+		return DefaultMaxStringLength
+	}
+	return o.MaxStringLength
+}
+
+// maxDepth returns the effective nesting depth limit.
+func (o DecodeOptions) maxDepth() int {
+	if o.MaxDepth == 0 {
+		return DefaultMaxDepth
+	}
+	return o.MaxDepth
+}
+
+// checkSize returns an error if n bytes of input exceed MaxSize.
+func (o DecodeOptions) checkSize(n int64) error {
+	if o.MaxSize > 0 && n > o.MaxSize {
+		return fmt.Errorf("input too large: more than %d bytes", o.MaxSize)
+	}
+	return nil
+}
+
+// DecodeWithOptions is like Decode but applies the given options.
+// It returns an error if opts.ZeroCopy is set, use DecodeBytes instead.
+func DecodeWithOptions(r io.Reader, opts DecodeOptions) (Value, error) {
+	if opts.ZeroCopy {
+		return nil, errors.New("zero-copy decoding requires DecodeBytes")
+	}
+
+	if opts.MaxSize > 0 {
+		r = io.LimitReader(r, opts.MaxSize+1) // one byte more to detect oversized input
+	}
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 
-	// check for trailing data
-	if br.Len() != 0 {
-		return nil, fmt.Errorf("trailing data after valid bencode")
+	return decodeAll(data, opts)
+}
+
+// DecodeBytes decodes a single bencoded value spanning the whole of data using the given options.
+// Unless opts.ZeroCopy is set, the result does not reference data.
+func DecodeBytes(data []byte, opts DecodeOptions) (Value, error) {
+	return decodeAll(data, opts)
+}
+
+// DecodePrefix decodes the single bencoded value at the start of data and returns it together
+// with the number of bytes it spans. Unlike DecodeBytes, trailing data is left to the caller,
+// as needed by protocols that append raw bytes to a bencoded header, such as BEP 9 metadata
+// messages.
+func DecodePrefix(data []byte, opts DecodeOptions) (Value, int, error) {
+	d := &decoder{r: bytes.NewReader(data), data: data, opts: opts}
+	if err := opts.checkSize(int64(len(data))); err != nil {
+		return nil, 0, err
 	}
-	return val, nil
+	val, err := d.parse()
+	if err != nil {
+		return nil, 0, err
+	}
+	return val, len(data) - d.r.Len(), nil
 }
 
 // Encode encodes the given Value into its bencoded byte representation.
@@ -71,6 +191,9 @@ func Decode(r io.Reader) (Value, error) {
 //   - []Value   		→ encoded as a list
 //   - map[string]Value → encoded as a dictionary with sorted keys
 //
+// Other values, such as unsigned integers, bools, []string or structs, are encoded through
+// reflection as described for Marshal. Unsigned integers larger than math.MaxInt64 are rejected.
+//
 // The encoded data is returned as a new byte slice.
 func Encode(val Value) ([]byte, error) {
 	var buf bytes.Buffer
@@ -89,28 +212,32 @@ func Encode(val Value) ([]byte, error) {
 //
 // Reference: https://wiki.theory.org/BitTorrentSpecification#Bencoding
 func EncodeTo(w *bytes.Buffer, rawInput Value) error {
-	switch input := rawInput.(type) {
-	case []byte:
-		return encodeByteString(w, string(input))
-
-	case string:
-		return encodeByteString(w, input)
-
-	case int:
-		return encodeInteger(w, int64(input))
-
-	case int64:
-		return encodeInteger(w, input)
+	return encodeValue(w, rawInput)
+}
 
-	case []Value:
-		return encodeList(w, input)
+// Encoder writes bencoded values to an io.Writer, such as a file, a network connection
+// or a hash, without building the whole encoding in memory first.
+type Encoder struct {
+	dst io.Writer
+	w   *bufio.Writer
+}
 
-	case map[string]Value:
-		return encodeDictionary(w, input)
+// NewEncoder returns an Encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{dst: w, w: bufio.NewWriter(w)}
+}
 
-	default:
-		return fmt.Errorf("unsupported type %T", input)
+// Encode writes the bencoded form of val to the underlying writer, accepting the same types as Encode.
+// Returns an error if the input type is unsupported or writing fails. Values larger than the
+// internal buffer are written in chunks, so the writer may have received part of the output
+// when an error is returned.
+func (e *Encoder) Encode(val Value) error {
+	if err := encodeValue(e.w, val); err != nil {
+		e.w.Reset(e.dst) // drop the partial output still buffered
+		return err
 	}
+
+	return e.w.Flush()
 }
 
 // TypeOf returns a short string description of the Value's type.
@@ -249,9 +376,14 @@ func prettyPrintValue(w io.Writer, value Value, indentLevel int) {
 
 	case Dictionary:
 		fmt.Fprintf(w, "%sdictionary:\n", indent)
-		for k, val := range v {
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // map iteration order is random, print in encoding order
+		for _, k := range keys {
 			fmt.Fprintf(w, "%s  key: %q\n", indent, k)
-			prettyPrintValue(w, val, indentLevel+2)
+			prettyPrintValue(w, v[k], indentLevel+2)
 		}
 
 	default:
@@ -259,36 +391,114 @@ func prettyPrintValue(w io.Writer, value Value, indentLevel int) {
 	}
 }
 
-func parseBencode(r *bytes.Reader) (Value, error) {
-	delimiter, err := r.ReadByte() // read beginning delimiter
+// decoder holds the state of a single decoding pass over an in-memory buffer.
+type decoder struct {
+	r    *bytes.Reader
+	data []byte // buffer behind r, referenced by byte strings in zero-copy mode
+	opts DecodeOptions
+
+	elements int // values decoded so far, checked against opts.MaxElements
+	depth    int // lists and dictionaries currently open, checked against opts.MaxDepth
+}
+
+// decodeAll decodes a single bencoded value spanning the whole of data.
+func decodeAll(data []byte, opts DecodeOptions) (Value, error) {
+	if err := opts.checkSize(int64(len(data))); err != nil {
+		return nil, err
+	}
+	d := &decoder{r: bytes.NewReader(data), data: data, opts: opts}
+	val, err := d.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	// check for trailing data
+	if d.r.Len() != 0 {
+		return nil, d.errorf(d.offset(), "trailing data after valid bencode")
+	}
+	return val, nil
+}
+
+// offset returns the position of the next byte to be read.
+func (d *decoder) offset() int64 {
+	return d.r.Size() - int64(d.r.Len())
+}
+
+// errorf returns a *SyntaxError at offset.
+func (d *decoder) errorf(offset int64, format string, args ...any) error {
+	return &SyntaxError{Offset: offset, Msg: fmt.Sprintf(format, args...)}
+}
+
+// readByte reads the next byte, reporting the end of the input as a *SyntaxError since every
+// caller expects more data.
+func (d *decoder) readByte() (byte, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, &SyntaxError{Offset: d.offset(), Msg: "unexpected end of input", Err: io.ErrUnexpectedEOF}
+	}
+	return b, nil
+}
+
+func (d *decoder) parse() (Value, error) {
+	d.elements++
+	if d.opts.MaxElements > 0 && d.elements > d.opts.MaxElements {
+		return nil, d.errorf(d.offset(), "too many elements: more than %d", d.opts.MaxElements)
+	}
+
+	delimiter, err := d.readByte() // read beginning delimiter
 	if err != nil {
 		return nil, err
 	}
 
 	switch {
 	case delimiter == 'i':
-		return decodeInteger(r)
+		return d.decodeInteger()
 
 	case delimiter >= '0' && delimiter <= '9':
-		return decodeByteString(r, delimiter) // delimiter is also the first digit of the byte string's length
+		return d.decodeByteString(delimiter) // delimiter is also the first digit of the byte string's length
 
 	case delimiter == 'l':
-		return decodeList(r)
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		return d.decodeList()
 
 	case delimiter == 'd':
-		return decodeDictionary(r)
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		return d.decodeDictionary()
 
 	default:
-		return nil, fmt.Errorf("invalid bencode prefix: %c", delimiter)
+		return nil, d.errorf(d.offset()-1, "invalid bencode prefix: %q", delimiter)
 	}
 }
 
-func decodeByteString(r *bytes.Reader, firstDigit byte) (ByteString, error) {
+// enter records the opening of a list or dictionary, failing if it nests too deep.
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > d.opts.maxDepth() {
+		msg := fmt.Sprintf("%v: more than %d levels", ErrMaxDepth, d.opts.maxDepth())
+		return &SyntaxError{Offset: d.offset() - 1, Msg: msg, Err: ErrMaxDepth}
+	}
+	return nil
+}
+
+// leave records the end of the innermost open list or dictionary.
+func (d *decoder) leave() {
+	d.depth--
+}
+
+func (d *decoder) decodeByteString(firstDigit byte) (ByteString, error) {
+	start := d.offset() - 1 // position of the first digit
+
 	// read the length of the byte string
 	var buffer bytes.Buffer
 	buffer.WriteByte(firstDigit)
 	for {
-		digit, err := r.ReadByte()
+		digit, err := d.readByte()
 		if err != nil {
 			return "", err
 		}
@@ -300,58 +510,85 @@ func decodeByteString(r *bytes.Reader, firstDigit byte) (ByteString, error) {
 		buffer.WriteByte(digit)
 	}
 
-	// check for leading zeros in string length
 	s := buffer.String()
+	if d.opts.AllowLengthWhitespace && !d.opts.Strict {
+		s = strings.TrimRight(s, " \t") // whitespace is only tolerated before the ':'
+	}
+
+	// check for leading zeros in string length
 	if len(s) > 1 && s[0] == '0' {
-		return "", fmt.Errorf("length has leading zeros")
+		return "", d.errorf(start, "length has leading zeros")
 	}
 
 	byteStringLength, err := strconv.ParseInt(s, 10, 64)
 	if err != nil {
-		return "", err
+		return "", d.errorf(start, "invalid byte string length %q", s)
 	}
 
-	// specify maximum length to prevent memory exhaustion
-	const MaxByteStringLength = 10 * 1024 * 1024 // 10 MB
-	if byteStringLength > MaxByteStringLength {
-		return "", fmt.Errorf("byte string length too large: %d", byteStringLength)
+	// limit the length to prevent memory exhaustion
+	if byteStringLength > d.opts.maxStringLength() {
+		return "", d.errorf(start, "byte string length too large: %d", byteStringLength)
 	}
 
-	byteString := make([]byte, byteStringLength) // read the byte string itself
-	_, err = io.ReadFull(r, byteString)
-	if err != nil {
-		return "", err
+	if d.opts.ZeroCopy {
+		return d.sliceByteString(byteStringLength)
+	}
+
+	if byteStringLength > int64(d.r.Len()) {
+		return "", &SyntaxError{Offset: d.r.Size(), Msg: "unexpected end of input in byte string", Err: io.ErrUnexpectedEOF}
 	}
+	byteString := make([]byte, byteStringLength) // read the byte string itself
+	io.ReadFull(d.r, byteString)                 // cannot fail, the length was checked above
 
 	return string(byteString), nil
 }
 
-func decodeInteger(r *bytes.Reader) (Integer, error) {
+// sliceByteString returns the next length bytes as a string sharing memory with the input buffer.
+func (d *decoder) sliceByteString(length int64) (ByteString, error) {
+	start := d.offset()
+	if length > int64(d.r.Len()) {
+		return "", &SyntaxError{Offset: d.r.Size(), Msg: "unexpected end of input in byte string", Err: io.ErrUnexpectedEOF}
+	}
+	if length == 0 {
+		return "", nil
+	}
+
+	if _, err := d.r.Seek(length, io.SeekCurrent); err != nil {
+		return "", err
+	}
+	return unsafe.String(&d.data[start], int(length)), nil
+}
+
+func (d *decoder) decodeInteger() (Integer, error) {
+	start := d.offset() // position of the first digit
 	var buffer bytes.Buffer
 	first := true
 
 	for {
-		digit, err := r.ReadByte()
+		digit, err := d.readByte()
 		if err != nil {
 			return 0, err
 		}
 
 		if first {
 			first = false
-			nextDigit, err := r.ReadByte()
+			if digit == 'e' {
+				break // reported as an empty integer below
+			}
+			nextDigit, err := d.readByte()
 			if err != nil {
-				return 0, fmt.Errorf("error peeking second digit: %w", err)
+				return 0, err
 			}
 
 			if digit == '-' && nextDigit == '0' {
-				return 0, fmt.Errorf("negative zero in integer")
+				return 0, d.errorf(start, "negative zero in integer")
 			}
 			if digit == '0' && nextDigit != 'e' {
-				return 0, fmt.Errorf("leading zero in integer")
+				return 0, d.errorf(start, "leading zero in integer")
 			}
 
 			// panic should not happen because we guarantee to read a byte before unreading
-			if err := r.UnreadByte(); err != nil {
+			if err := d.r.UnreadByte(); err != nil {
 				return 0, fmt.Errorf("unread error while decoding integer: %w", err)
 			}
 		}
@@ -364,16 +601,23 @@ func decodeInteger(r *bytes.Reader) (Integer, error) {
 	}
 
 	if buffer.Len() == 0 {
-		return 0, errors.New("empty integer")
+		return 0, d.errorf(start, "empty integer")
+	}
+	if d.opts.Strict && buffer.Bytes()[0] == '+' {
+		return 0, d.errorf(start, "plus sign in integer")
 	}
 
-	return strconv.ParseInt(buffer.String(), 10, 64)
+	n, err := strconv.ParseInt(buffer.String(), 10, 64)
+	if err != nil {
+		return 0, d.errorf(start, "invalid integer %q", buffer.String())
+	}
+	return n, nil
 }
 
-func decodeList(r *bytes.Reader) (List, error) {
+func (d *decoder) decodeList() (List, error) {
 	var values List
 	for {
-		delimiter, err := r.ReadByte() // peek next type
+		delimiter, err := d.readByte() // peek next type
 		if err != nil {
 			return nil, err
 		}
@@ -385,10 +629,10 @@ func decodeList(r *bytes.Reader) (List, error) {
 
 		// unread to properly identify next type
 		// panic should not happen because we guarantee to read a byte before unreading
-		if err := r.UnreadByte(); err != nil {
+		if err := d.r.UnreadByte(); err != nil {
 			return nil, fmt.Errorf("unread error while decoding list: %w", err)
 		}
-		element, err := parseBencode(r)
+		element, err := d.parse()
 		if err != nil {
 			return nil, err
 		}
@@ -399,10 +643,11 @@ func decodeList(r *bytes.Reader) (List, error) {
 	return values, nil
 }
 
-func decodeDictionary(r *bytes.Reader) (Dictionary, error) {
+func (d *decoder) decodeDictionary() (Dictionary, error) {
 	values := make(map[string]Value)
+	var previousKey string
 	for {
-		delimiter, err := r.ReadByte() // peek next type
+		delimiter, err := d.readByte() // peek next type
 		if err != nil {
 			return nil, err
 		}
@@ -412,24 +657,34 @@ func decodeDictionary(r *bytes.Reader) (Dictionary, error) {
 		}
 		// unread to properly identify next type
 		// panic should not happen because we guarantee to read a byte before unreading
-		if err := r.UnreadByte(); err != nil {
+		if err := d.r.UnreadByte(); err != nil {
 			return nil, fmt.Errorf("unread error while decoding dictionary: %w", err)
 		}
 
 		// parse the key
-		key, err := parseBencode(r)
+		keyStart := d.offset()
+		key, err := d.parse()
 		if err != nil {
 			return nil, err
 		}
 
 		// dictionaries must have byte strings as keys
-		keyAsString, err := AsByteString(key)
-		if err != nil {
-			return nil, fmt.Errorf("dictionary key is not a string: %w", err)
+		keyAsString, ok := key.(ByteString)
+		if !ok {
+			return nil, d.errorf(keyStart, "dictionary key is not a string, got %s", TypeOf(key))
 		}
 
+		// keys are sorted in bytewise lexicographic order as per BEP-3, which rules out duplicates
+		if d.opts.Strict && len(values) > 0 && keyAsString <= previousKey {
+			if _, exists := values[keyAsString]; exists {
+				return nil, d.errorf(keyStart, "duplicate dictionary key %q", keyAsString)
+			}
+			return nil, d.errorf(keyStart, "dictionary key %q is not sorted after %q", keyAsString, previousKey)
+		}
+		previousKey = keyAsString
+
 		// parse the value
-		value, err := parseBencode(r)
+		value, err := d.parse()
 		if err != nil {
 			return nil, err
 		}
@@ -441,7 +696,45 @@ func decodeDictionary(r *bytes.Reader) (Dictionary, error) {
 	return values, nil
 }
 
-func encodeByteString(w *bytes.Buffer, value string) error {
+// encodeWriter is implemented by both bytes.Buffer and bufio.Writer. Write errors are not checked
+// while encoding because the former never fails and the latter keeps the first error until Flush.
+type encodeWriter interface {
+	io.Writer
+	io.ByteWriter
+	io.StringWriter
+}
+
+func encodeValue(w encodeWriter, rawInput Value) error {
+	switch input := rawInput.(type) {
+	case []byte:
+		return encodeByteString(w, string(input))
+
+	case string:
+		return encodeByteString(w, input)
+
+	case int:
+		return encodeInteger(w, int64(input))
+
+	case int64:
+		return encodeInteger(w, input)
+
+	case []Value:
+		return encodeList(w, input)
+
+	case map[string]Value:
+		return encodeDictionary(w, input)
+
+	default:
+		// reflection is only needed for the types Decode never returns
+		value, err := toValue(reflect.ValueOf(input))
+		if err != nil {
+			return fmt.Errorf("unsupported type %T: %w", input, err)
+		}
+		return encodeValue(w, value)
+	}
+}
+
+func encodeByteString(w encodeWriter, value string) error {
 	tmp := strconv.AppendInt(nil, int64(len(value)), 10) // append to a temporary byte slice
 	w.Write(tmp)
 	w.WriteByte(':')
@@ -450,7 +743,7 @@ func encodeByteString(w *bytes.Buffer, value string) error {
 	return nil
 }
 
-func encodeInteger(w *bytes.Buffer, value int64) error {
+func encodeInteger(w encodeWriter, value int64) error {
 	w.WriteByte('i')                                // beginning delimiter for an integer
 	tmp := strconv.AppendInt(nil, int64(value), 10) // append to a temporary byte slice
 	w.Write(tmp)
@@ -459,10 +752,10 @@ func encodeInteger(w *bytes.Buffer, value int64) error {
 	return nil
 }
 
-func encodeList(w *bytes.Buffer, list List) error {
+func encodeList(w encodeWriter, list List) error {
 	w.WriteByte('l') // beginning delimiter for a list
 	for _, item := range list {
-		if err := EncodeTo(w, item); err != nil {
+		if err := encodeValue(w, item); err != nil {
 			return err
 		}
 	}
@@ -471,7 +764,7 @@ func encodeList(w *bytes.Buffer, list List) error {
 	return nil
 }
 
-func encodeDictionary(w *bytes.Buffer, dictionary Dictionary) error {
+func encodeDictionary(w encodeWriter, dictionary Dictionary) error {
 	w.WriteByte('d') // beginning delimiter for a dictionary
 	keys := make([]string, 0, len(dictionary))
 	for k := range dictionary {
@@ -483,7 +776,7 @@ func encodeDictionary(w *bytes.Buffer, dictionary Dictionary) error {
 		if err := encodeByteString(w, k); err != nil {
 			return err
 		}
-		if err := EncodeTo(w, dictionary[k]); err != nil {
+		if err := encodeValue(w, dictionary[k]); err != nil {
 			return err
 		}
 	}
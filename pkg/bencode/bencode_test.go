@@ -2,12 +2,22 @@ package bencode
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
 
+// testDecoder returns a decoder with default options reading from input.
+func testDecoder(input string) *decoder {
+	return &decoder{r: bytes.NewReader([]byte(input))}
+}
+
 // TestDecode verifies recursive decoding of a complete bencoded structure,
 // such as a torrent metadata dictionary.
 func TestDecode(t *testing.T) {
@@ -450,7 +460,7 @@ func TestParseString(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.input, func(t *testing.T) {
-			got, err := decodeByteString(bytes.NewReader([]byte(tc.input[1:])), tc.input[0]) // skip first digit
+			got, err := testDecoder(tc.input[1:]).decodeByteString(tc.input[0]) // skip first digit
 			if err != nil {
 				t.Errorf("decodeByteString(%q) returned error: %v", tc.input, err)
 				return
@@ -475,7 +485,7 @@ func TestDecodeInvalidByteString(t *testing.T) {
 
 	for _, input := range testCases {
 		t.Run(input, func(t *testing.T) {
-			_, err := decodeByteString(bytes.NewReader([]byte(input[1:])), input[0])
+			_, err := testDecoder(input[1:]).decodeByteString(input[0])
 			if err == nil {
 				t.Errorf("expected error for input %q, got nil", input)
 			}
@@ -483,6 +493,248 @@ func TestDecodeInvalidByteString(t *testing.T) {
 	}
 }
 
+// TestDecodeLengthWhitespace verifies that whitespace in byte string length prefixes
+// is rejected by default and tolerated with AllowLengthWhitespace.
+func TestDecodeLengthWhitespace(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Value
+	}{
+		{"4 :spam", "spam"},
+		{"12\t :spamspamspam", "spamspamspam"},
+		{"d3 :cow3:mooe", Dictionary{"cow": "moo"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			if _, err := Decode(strings.NewReader(tc.input)); err == nil {
+				t.Errorf("expected strict decoding of %q to fail, got nil", tc.input)
+			}
+
+			got, err := DecodeWithOptions(strings.NewReader(tc.input), DecodeOptions{AllowLengthWhitespace: true})
+			if err != nil {
+				t.Fatalf("DecodeWithOptions(%q) returned error: %v", tc.input, err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("DecodeWithOptions(%q) => got: %#v want: %#v", tc.input, got, tc.expected)
+			}
+		})
+	}
+
+	// whitespace between the digits is never valid
+	if _, err := DecodeWithOptions(strings.NewReader("1 2:spamspamspam"), DecodeOptions{AllowLengthWhitespace: true}); err == nil {
+		t.Error("expected error for whitespace between length digits, got nil")
+	}
+}
+
+// TestDecodeStrict verifies that strict decoding rejects non-canonical encodings that the
+// default mode accepts, and accepts canonical ones.
+func TestDecodeStrict(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		valid bool // whether the input is canonical
+	}{
+		{"sorted keys", "d1:ai1e1:bi2ee", true},
+		{"nested sorted keys", "d1:ad1:xi0e1:yi0ee1:bi2ee", true},
+		{"bytewise order", "d1:Zi0e1:ai0ee", true},
+		{"prefix key first", "d1:ai0e2:aai0ee", true},
+		{"negative integer", "i-42e", true},
+		{"unsorted keys", "d1:bi2e1:ai1ee", false},
+		{"nested unsorted keys", "ld1:yi0e1:xi0eee", false},
+		{"duplicate keys", "d1:ai1e1:ai2ee", false},
+		{"plus sign", "i+5e", false},
+		{"length whitespace", "4 :spam", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeBytes([]byte(tc.input), DecodeOptions{Strict: true, AllowLengthWhitespace: true})
+			if tc.valid && err != nil {
+				t.Errorf("strict decoding of %q returned error: %v", tc.input, err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected strict decoding of %q to fail, got nil", tc.input)
+			}
+		})
+	}
+
+	// the default mode keeps the last of duplicate keys
+	got, err := DecodeBytes([]byte("d1:bi2e1:ai1e1:ai3ee"), DecodeOptions{})
+	if err != nil {
+		t.Fatalf("DecodeBytes() returned error: %v", err)
+	}
+	if expected := (Dictionary{"a": Integer(3), "b": Integer(2)}); !reflect.DeepEqual(got, expected) {
+		t.Errorf("DecodeBytes() => got: %#v want: %#v", got, expected)
+	}
+}
+
+// TestDecodeLimits verifies that each configurable limit rejects input exceeding it and
+// accepts input at the limit.
+func TestDecodeLimits(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		opts  DecodeOptions
+		valid bool
+	}{
+		{"string at limit", "4:spam", DecodeOptions{MaxStringLength: 4}, true},
+		{"string over limit", "5:spams", DecodeOptions{MaxStringLength: 4}, false},
+		{"string over default", fmt.Sprintf("%d:", DefaultMaxStringLength+1), DecodeOptions{}, false},
+		{"elements at limit", "d1:al1:bee", DecodeOptions{MaxElements: 4}, true},
+		{"elements over limit", "d1:al1:b1:cee", DecodeOptions{MaxElements: 4}, false},
+		{"size at limit", "i42e", DecodeOptions{MaxSize: 4}, true},
+		{"size over limit", "i420e", DecodeOptions{MaxSize: 4}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeBytes([]byte(tc.input), tc.opts)
+			if tc.valid && err != nil {
+				t.Errorf("DecodeBytes(%q) returned error: %v", tc.input, err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected DecodeBytes(%q) to fail, got nil", tc.input)
+			}
+
+			// the reader variant enforces the same limits
+			_, err = DecodeWithOptions(strings.NewReader(tc.input), tc.opts)
+			if tc.valid != (err == nil) {
+				t.Errorf("DecodeWithOptions(%q) returned error %v, expected valid: %v", tc.input, err, tc.valid)
+			}
+		})
+	}
+}
+
+// TestDecodeMaxDepth verifies that nesting beyond the limit fails with ErrMaxDepth, that
+// siblings do not add up, and that deeply nested payloads fail fast under the default limit.
+func TestDecodeMaxDepth(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("l", depth) + strings.Repeat("e", depth)
+	}
+	opts := DecodeOptions{MaxDepth: 3}
+
+	if _, err := DecodeBytes([]byte(nested(3)), opts); err != nil {
+		t.Errorf("decoding at the depth limit returned error: %v", err)
+	}
+	if _, err := DecodeBytes([]byte("d1:ald1:bi0eee1:cld1:bi0eeee"), opts); err != nil {
+		t.Errorf("decoding siblings at the depth limit returned error: %v", err)
+	}
+	if _, err := DecodeBytes([]byte(nested(4)), opts); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("decoding beyond the depth limit returned %v, expected %v", err, ErrMaxDepth)
+	}
+	if _, err := DecodeBytes([]byte("d1:ad1:bd1:cd1:di0eeeee"), opts); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("decoding nested dictionaries beyond the depth limit returned %v, expected %v", err, ErrMaxDepth)
+	}
+
+	// a payload that would take a gigabyte of stack without the limit
+	if _, err := DecodeBytes([]byte(strings.Repeat("l", 10_000_000)), DecodeOptions{}); !errors.Is(err, ErrMaxDepth) {
+		t.Errorf("decoding a deeply nested payload returned %v, expected %v", err, ErrMaxDepth)
+	}
+}
+
+// TestSyntaxErrorOffset verifies that decoding errors are *SyntaxError values pointing at the
+// offending byte, or at the end of the input when it is truncated.
+func TestSyntaxErrorOffset(t *testing.T) {
+	testCases := []struct {
+		input  string
+		offset int64
+	}{
+		{"x", 0},
+		{"l4:spamxe", 7},
+		{"d3:cowi03ee", 7},
+		{"d3:cowi-0ee", 7},
+		{"li1ei2eie", 8},
+		{"i12a4e", 1},
+		{"d3:cow3:moo", 11},
+		{"l10:short", 9},
+		{"d3:cowi1ei2ei3ee", 9},
+		{"4:spamtrailing", 6},
+		{"03:abc", 0},
+		{"lll", 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			for _, zeroCopy := range []bool{false, true} {
+				_, err := DecodeBytes([]byte(tc.input), DecodeOptions{ZeroCopy: zeroCopy})
+				var syntaxErr *SyntaxError
+				if !errors.As(err, &syntaxErr) {
+					t.Fatalf("expected a *SyntaxError, got %T: %v", err, err)
+				}
+				if syntaxErr.Offset != tc.offset {
+					t.Errorf("expected offset %d, got %d (%v)", tc.offset, syntaxErr.Offset, err)
+				}
+			}
+		})
+	}
+
+	// truncated input wraps io.ErrUnexpectedEOF
+	if _, err := DecodeBytes([]byte("d3:cow"), DecodeOptions{}); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected error wrapping %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+}
+
+// TestDecodeBytesZeroCopy verifies that zero-copy decoding yields the same values as copying
+// decoding and that byte strings really alias the input buffer.
+func TestDecodeBytesZeroCopy(t *testing.T) {
+	input := "d4:listl4:spami42e0:e6:pieces8:abcdefghe"
+	expected := Dictionary{
+		"list":   List{"spam", Integer(42), ""},
+		"pieces": "abcdefgh",
+	}
+
+	data := []byte(input)
+	got, err := DecodeBytes(data, DecodeOptions{ZeroCopy: true})
+	if err != nil {
+		t.Fatalf("DecodeBytes returned error: %v", err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("DecodeBytes => got: %#v want: %#v", got, expected)
+	}
+
+	// mutating the source is forbidden for callers, here it proves that nothing was copied
+	copy(data[strings.Index(input, "abcdefgh"):], "ABCDEFGH")
+	if pieces := got.(Dictionary)["pieces"]; pieces != "ABCDEFGH" {
+		t.Errorf("expected byte string to alias the input buffer, got %q", pieces)
+	}
+
+	if _, err := DecodeBytes([]byte("10:short"), DecodeOptions{ZeroCopy: true}); err == nil {
+		t.Error("expected error for truncated byte string, got nil")
+	}
+	if _, err := DecodeWithOptions(strings.NewReader(input), DecodeOptions{ZeroCopy: true}); err == nil {
+		t.Error("expected DecodeWithOptions to reject ZeroCopy, got nil")
+	}
+}
+
+// TestDecodePrefix verifies that trailing data after the first value is left to the caller.
+func TestDecodePrefix(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected Value
+		consumed int
+	}{
+		{"d8:msg_typei1ee<raw piece data>", Dictionary{"msg_type": Integer(1)}, 15},
+		{"i42e", Integer(42), 4},
+		{"4:spami1e", "spam", 6},
+	}
+
+	for _, tc := range testCases {
+		got, consumed, err := DecodePrefix([]byte(tc.input), DecodeOptions{})
+		if err != nil {
+			t.Errorf("DecodePrefix(%q) returned error: %v", tc.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.expected) || consumed != tc.consumed {
+			t.Errorf("DecodePrefix(%q) => got: %#v, %d want: %#v, %d", tc.input, got, consumed, tc.expected, tc.consumed)
+		}
+	}
+
+	if _, _, err := DecodePrefix([]byte("d8:msg_type"), DecodeOptions{}); err == nil {
+		t.Error("expected error for truncated input, got nil")
+	}
+}
+
 // TestParseInteger verifies decoding of bencoded integers.
 func TestParseInteger(t *testing.T) {
 	testCases := []struct {
@@ -495,7 +747,7 @@ func TestParseInteger(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		got, err := decodeInteger(bytes.NewReader([]byte(tc.input[1:]))) // skip 'i'
+		got, err := testDecoder(tc.input[1:]).decodeInteger() // skip 'i'
 		if err != nil {
 			t.Errorf("decodeInteger(%q) returned error: %v", tc.input, err)
 			continue
@@ -519,7 +771,7 @@ func TestDecodeInvalidInteger(t *testing.T) {
 
 	for _, input := range testCases {
 		t.Run(input, func(t *testing.T) {
-			_, err := decodeInteger(bytes.NewReader([]byte(input[1:]))) // skip 'i'
+			_, err := testDecoder(input[1:]).decodeInteger() // skip 'i'
 			if err == nil {
 				t.Errorf("expected error for input %q, got nil", input)
 			}
@@ -541,7 +793,7 @@ func TestParseList(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.input, func(t *testing.T) {
-			got, err := decodeList(bytes.NewReader([]byte(tc.input[1:]))) // skip 'l'
+			got, err := testDecoder(tc.input[1:]).decodeList() // skip 'l'
 			if err != nil {
 				t.Errorf("decodeList(%q) returned error: %v", tc.input, err)
 				return
@@ -564,7 +816,7 @@ func TestDecodeInvalidList(t *testing.T) {
 
 	for _, input := range testCases {
 		t.Run(input, func(t *testing.T) {
-			_, err := decodeList(bytes.NewReader([]byte(input[1:]))) // skip 'l'
+			_, err := testDecoder(input[1:]).decodeList() // skip 'l'
 			if err == nil {
 				t.Errorf("expected error for input %q, got nil", input)
 			}
@@ -585,7 +837,7 @@ func TestParseDictionary(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.input, func(t *testing.T) {
-			got, err := decodeDictionary(bytes.NewReader([]byte(tc.input[1:]))) // skip 'd'
+			got, err := testDecoder(tc.input[1:]).decodeDictionary() // skip 'd'
 			if err != nil {
 				t.Errorf("decodeDictionary(%q) returned error: %v", tc.input, err)
 				return
@@ -608,7 +860,7 @@ func TestDecodeInvalidDictionary(t *testing.T) {
 
 	for _, input := range testCases {
 		t.Run(input, func(t *testing.T) {
-			_, err := decodeDictionary(bytes.NewReader([]byte(input[1:]))) // skip 'd'
+			_, err := testDecoder(input[1:]).decodeDictionary() // skip 'd'
 			if err == nil {
 				t.Errorf("expected error for input %q, got nil", input)
 			}
@@ -716,6 +968,223 @@ func TestEncodeDictionary(t *testing.T) {
 	}
 }
 
-// TODO: implement benchmarking decode and encode
-// TODO: test large payloads (10MB+)
-// TODO: test maximum byte string length
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("write failed") }
+
+// TestEncodeReflection verifies that types other than the generic Value types are encoded
+// like Marshal encodes them, nested or not.
+func TestEncodeReflection(t *testing.T) {
+	type peer struct {
+		IP   string `bencode:"ip"`
+		Port uint16 `bencode:"port"`
+	}
+
+	testCases := []struct {
+		name     string
+		input    any
+		expected string
+	}{
+		{"uint", uint(7), "i7e"},
+		{"uint64", uint64(math.MaxInt64), "i9223372036854775807e"},
+		{"int32", int32(-3), "i-3e"},
+		{"bool", List{true, false}, "li1ei0ee"},
+		{"string slice", []string{"a", "bc"}, "l1:a2:bce"},
+		{"string map", map[string]string{"b": "2", "a": "1"}, "d1:a1:11:b1:2e"},
+		{"nested", Dictionary{"peers": []peer{{"10.0.0.1", 6881}}}, "d5:peersld2:ip8:10.0.0.14:porti6881eeee"},
+		{"byte array", [2]byte{'h', 'i'}, "2:hi"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Encode(tc.input)
+			if err != nil {
+				t.Fatalf("Encode() returned error: %v", err)
+			}
+			if string(got) != tc.expected {
+				t.Errorf("Encode() = %q, expected %q", got, tc.expected)
+			}
+		})
+	}
+
+	for _, input := range []any{uint64(math.MaxInt64) + 1, List{1.5}, map[int]string{1: "a"}, Dictionary{"f": func() {}}} {
+		if _, err := Encode(input); err == nil {
+			t.Errorf("Encode(%#v) returned no error", input)
+		}
+	}
+}
+
+// TestEncoder verifies streaming encoding into arbitrary writers and error reporting.
+func TestEncoder(t *testing.T) {
+	value := Dictionary{"info": Dictionary{"name": "example.txt", "length": 12345}, "list": List{"a", 1}}
+	expected, err := Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := sha1.New()
+	if err := NewEncoder(hash).Encode(value); err != nil {
+		t.Fatalf("Encode() into hash returned error: %v", err)
+	}
+	if got, want := hash.Sum(nil), sha1.Sum(expected); !bytes.Equal(got, want[:]) {
+		t.Errorf("streamed hash %x, want %x", got, want)
+	}
+
+	// consecutive values are written back to back
+	var out strings.Builder
+	enc := NewEncoder(&out)
+	if err := enc.Encode("spam"); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Encode(List{"unsupported", 1.5}); err == nil {
+		t.Error("expected error for unsupported type, got nil")
+	}
+	if err := enc.Encode(42); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "4:spami42e" {
+		t.Errorf("expected %q, got %q", "4:spami42e", out.String())
+	}
+
+	if err := NewEncoder(failingWriter{}).Encode(value); err == nil {
+		t.Error("expected write error, got nil")
+	}
+}
+
+// benchmarkFixture is an encoded input of the benchmarks, see benchmarkFixtures.
+type benchmarkFixture struct {
+	name string
+	data []byte
+}
+
+// benchmarkTorrent returns an encoded torrent-like dictionary with the given number of pieces and
+// files, dominated by its 'pieces' blob when there are few files.
+func benchmarkTorrent(tb testing.TB, pieces, files int) []byte {
+	tb.Helper()
+	list := make(List, files)
+	for i := range list {
+		list[i] = Dictionary{
+			"length": Integer(1 << 20),
+			"path":   List{"disc " + strconv.Itoa(i%10), "track " + strconv.Itoa(i) + ".flac"},
+		}
+	}
+	data, err := Encode(Dictionary{
+		"announce":      "http://tracker.example.com/announce",
+		"announce-list": List{List{"http://tracker.example.com/announce"}, List{"udp://backup.example.com:6969"}},
+		"creation date": Integer(1700000000),
+		"info": Dictionary{
+			"name":         "example",
+			"files":        list,
+			"piece length": Integer(1 << 20),
+			"pieces":       strings.Repeat("x", pieces*20),
+		},
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// benchmarkFixtures returns inputs of increasing size: a tracker response, a torrent with many
+// small files, a 100k-piece torrent and a torrent over 10 MB, past DefaultMaxStringLength.
+func benchmarkFixtures(tb testing.TB) []benchmarkFixture {
+	tb.Helper()
+	response, err := Encode(Dictionary{
+		"interval":   Integer(1800),
+		"complete":   Integer(12),
+		"incomplete": Integer(3),
+		"peers":      strings.Repeat("\x0a\x00\x00\x01\x1a\xe1", 50),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return []benchmarkFixture{
+		{"Small", response},
+		{"Medium", benchmarkTorrent(tb, 1000, 1000)},
+		{"100kPieces", benchmarkTorrent(tb, 100_000, 1)},
+		{"12MB", benchmarkTorrent(tb, 600_000, 1)},
+	}
+}
+
+// benchmarkOptions raises the byte string limit for the fixtures exceeding the default.
+var benchmarkOptions = DecodeOptions{MaxStringLength: 64 << 20}
+
+// BenchmarkDecodeBytes compares copying and zero-copy decoding of each fixture.
+func BenchmarkDecodeBytes(b *testing.B) {
+	for _, fixture := range benchmarkFixtures(b) {
+		for _, zeroCopy := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/ZeroCopy=%t", fixture.name, zeroCopy), func(b *testing.B) {
+				opts := benchmarkOptions
+				opts.ZeroCopy = zeroCopy
+				b.ReportAllocs()
+				b.SetBytes(int64(len(fixture.data)))
+				for range b.N {
+					if _, err := DecodeBytes(fixture.data, opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkEncode measures encoding each decoded fixture into a fresh buffer.
+func BenchmarkEncode(b *testing.B) {
+	for _, fixture := range benchmarkFixtures(b) {
+		value, err := DecodeBytes(fixture.data, benchmarkOptions)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(fixture.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(fixture.data)))
+			for range b.N {
+				if _, err := Encode(value); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestAllocationBudget guards the allocations of decoding and encoding each fixture against
+// regressions. The budgets leave some headroom over the current counts: lower them when an
+// optimization lands, and only raise them for a deliberate trade-off.
+func TestAllocationBudget(t *testing.T) {
+	if testing.Short() {
+		t.Skip("allocation budgets are measured on large fixtures")
+	}
+	budgets := map[string]struct{ decode, zeroCopy, encode float64 }{
+		"Small":      {decode: 35, zeroCopy: 23, encode: 15},
+		"Medium":     {decode: 27_000, zeroCopy: 18_000, encode: 6_000},
+		"100kPieces": {decode: 120, zeroCopy: 80, encode: 35},
+		"12MB":       {decode: 120, zeroCopy: 80, encode: 35},
+	}
+	zeroCopyOptions := benchmarkOptions
+	zeroCopyOptions.ZeroCopy = true
+
+	for _, fixture := range benchmarkFixtures(t) {
+		budget := budgets[fixture.name]
+		value, err := DecodeBytes(fixture.data, benchmarkOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		measured := []struct {
+			operation string
+			budget    float64
+			allocs    float64
+		}{
+			{"decode", budget.decode, testing.AllocsPerRun(5, func() { DecodeBytes(fixture.data, benchmarkOptions) })},
+			{"zero-copy decode", budget.zeroCopy, testing.AllocsPerRun(5, func() { DecodeBytes(fixture.data, zeroCopyOptions) })},
+			{"encode", budget.encode, testing.AllocsPerRun(5, func() { Encode(value) })},
+		}
+		for _, m := range measured {
+			t.Logf("%s %s: %.0f allocations", fixture.name, m.operation, m.allocs)
+			if m.allocs > m.budget {
+				t.Errorf("%s %s: %.0f allocations, over the budget of %.0f", fixture.name, m.operation, m.allocs, m.budget)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package bencode
+
+import (
+	"bytes"
+	"testing"
+)
+
+// fuzzSeeds are the seed inputs shared by the bencode fuzz targets: valid values of every type,
+// torrent-like dictionaries and inputs that exercise each decoding error.
+var fuzzSeeds = []string{
+	"0:",
+	"4:spam",
+	"i0e",
+	"i-42e",
+	"le",
+	"de",
+	"l4:spami42ee",
+	"d3:cow3:moo4:spaml1:a1:bee",
+	"d8:announce35:http://tracker.example.com/announce4:infod6:lengthi40000e4:name8:file.txt" +
+		"12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaaee",
+	"d8:completei12e10:incompletei3e8:intervali1800e5:peers6:\x0a\x00\x00\x01\x1a\xe1e",
+	"i03e",
+	"i-0e",
+	"i+5e",
+	"ie",
+	"03:abc",
+	"4 :spam",
+	"d1:bi2e1:ai1ee",
+	"d1:ai1e1:ai2ee",
+	"di1e1:ae",
+	"10:short",
+	"lllllllllllllllllllllllllllllle",
+	"4:spamtrailing",
+	"x",
+}
+
+// FuzzDecode checks that no input makes decoding panic or hang in any mode, and that every
+// decoded value can be encoded again.
+func FuzzDecode(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, opts := range []DecodeOptions{{}, {ZeroCopy: true}, {Strict: true}, {AllowLengthWhitespace: true}} {
+			value, err := DecodeBytes(data, opts)
+			if err != nil {
+				continue
+			}
+			if _, err := Encode(value); err != nil {
+				t.Fatalf("Encode() of a value decoded with %+v returned error: %v", opts, err)
+			}
+		}
+		DecodePrefix(data, DecodeOptions{})
+	})
+}
+
+// FuzzRoundTrip checks that canonical input is reproduced exactly by Encode(Decode(x)), that
+// any decodable input encodes to canonical bencode of the same value, and that the JSON
+// conversion is lossless.
+func FuzzRoundTrip(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		value, err := DecodeBytes(data, DecodeOptions{})
+		if err != nil {
+			return
+		}
+		encoded, err := Encode(value)
+		if err != nil {
+			t.Fatalf("Encode() returned error: %v", err)
+		}
+
+		if _, err := DecodeBytes(data, DecodeOptions{Strict: true}); err == nil && !bytes.Equal(encoded, data) {
+			t.Fatalf("Encode(Decode(%q)) = %q, expected the canonical input", data, encoded)
+		}
+		if _, err := DecodeBytes(encoded, DecodeOptions{Strict: true}); err != nil {
+			t.Fatalf("strict decoding of Encode() output %q returned error: %v", encoded, err)
+		}
+
+		for _, binary := range []BinaryEncoding{BinaryHex, BinaryBase64} {
+			converted, err := ToJSONWithOptions(value, JSONOptions{Binary: binary})
+			if err != nil {
+				t.Fatalf("ToJSON() returned error: %v", err)
+			}
+			back, err := FromJSON(converted)
+			if err != nil {
+				t.Fatalf("FromJSON(%s) returned error: %v", converted, err)
+			}
+			// compared encoded, since empty lists decode as nil but convert back as empty
+			if reencoded, err := Encode(back); err != nil || !bytes.Equal(reencoded, encoded) {
+				t.Fatalf("FromJSON(ToJSON(v)) = %#v, expected %#v", back, value)
+			}
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package bencode
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Byte strings are arbitrary bytes, while JSON strings are text. ToJSON writes byte strings that
+// are valid UTF-8 as JSON strings and wraps the others in an object with a single marker key
+// holding their encoded bytes, e.g. {"$hex": "ff00"}. Dictionary keys that are not valid UTF-8
+// are written as the marker followed by a colon and the encoded bytes, e.g. "$hex:ff00".
+// Keys that merely start like a marker are encoded the same way, so FromJSON never mistakes
+// them for one and every value survives the round trip.
+const (
+	hexMarker    = "$hex"
+	base64Marker = "$base64"
+)
+
+// BinaryEncoding selects how ToJSON represents byte strings that are not valid UTF-8.
+type BinaryEncoding int
+
+const (
+	BinaryHex    BinaryEncoding = iota // lowercase hexadecimal under "$hex", easy to read for hashes and peer IDs
+	BinaryBase64                       // standard padded base64 under "$base64", a third smaller than hex
+)
+
+// JSONOptions configures ToJSONWithOptions. The zero value writes compact JSON with binary
+// byte strings in hexadecimal, like ToJSON.
+type JSONOptions struct {
+	Binary BinaryEncoding // encoding of byte strings that are not valid UTF-8
+	Indent string         // indentation of each nesting level, compact output if empty
+}
+
+// ToJSON converts the given Value to compact JSON, writing byte strings that are not valid UTF-8
+// in hexadecimal. Dictionary keys are sorted, as in bencode.
+//
+// Returns an error if the value contains an unsupported type.
+func ToJSON(v Value) ([]byte, error) {
+	return ToJSONWithOptions(v, JSONOptions{})
+}
+
+// ToJSONWithOptions is like ToJSON but applies the given options.
+func ToJSONWithOptions(v Value, opts JSONOptions) ([]byte, error) {
+	tree, err := toJSONTree(v, opts.Binary)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // keep tracker URLs with query strings readable
+	enc.SetIndent("", opts.Indent)
+	if err := enc.Encode(tree); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// FromJSON converts JSON produced by ToJSON, or written by hand, back to a Value. Strings become
+// byte strings, integral numbers integers, arrays lists and objects dictionaries, while the
+// binary markers of ToJSON are decoded in either encoding.
+//
+// Returns an error if the JSON is invalid or holds a value bencode cannot represent: a
+// fractional or out of range number, a boolean or null.
+func FromJSON(data []byte) (Value, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, errors.New("invalid JSON: trailing data after the top-level value")
+	}
+	return fromJSONTree(tree)
+}
+
+// ToYAML converts the given Value to a YAML document, representing byte strings as ToJSON with
+// the given encoding. Every string is double-quoted, so values such as "yes" or "1.0" keep their
+// type in YAML readers.
+//
+// Returns an error if the value contains an unsupported type.
+func ToYAML(v Value, binary BinaryEncoding) ([]byte, error) {
+	tree, err := toJSONTree(v, binary)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writeYAML(&buf, tree, 0)
+	return buf.Bytes(), nil
+}
+
+// toJSONTree converts v to the types encoding/json writes as JSON, with binary byte strings
+// replaced by their markers.
+func toJSONTree(v Value, binary BinaryEncoding) (any, error) {
+	switch val := v.(type) {
+	case ByteString:
+		if utf8.ValidString(val) {
+			return val, nil
+		}
+		marker, encoded := encodeBinary(val, binary)
+		return map[string]any{marker: encoded}, nil
+
+	case Integer:
+		return val, nil
+
+	case List:
+		out := make([]any, len(val))
+		for i, item := range val {
+			converted, err := toJSONTree(item, binary)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+
+	case Dictionary:
+		out := make(map[string]any, len(val))
+		for key, item := range val {
+			converted, err := toJSONTree(item, binary)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", key, err)
+			}
+			if !utf8.ValidString(key) || strings.HasPrefix(key, hexMarker) || strings.HasPrefix(key, base64Marker) {
+				marker, encoded := encodeBinary(key, binary)
+				key = marker + ":" + encoded
+			}
+			out[key] = converted
+		}
+		return out, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+// encodeBinary returns the marker and encoded form of s.
+func encodeBinary(s string, binary BinaryEncoding) (marker, encoded string) {
+	if binary == BinaryBase64 {
+		return base64Marker, base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	return hexMarker, hex.EncodeToString([]byte(s))
+}
+
+// decodeBinary decodes the bytes encoded under marker, reporting false if marker is not one.
+func decodeBinary(marker, encoded string) (string, bool, error) {
+	var decoded []byte
+	var err error
+	switch marker {
+	case hexMarker:
+		decoded, err = hex.DecodeString(encoded)
+	case base64Marker:
+		decoded, err = base64.StdEncoding.DecodeString(encoded)
+	default:
+		return "", false, nil
+	}
+	if err != nil {
+		return "", true, fmt.Errorf("invalid %s value: %w", marker, err)
+	}
+	return string(decoded), true, nil
+}
+
+// fromJSONTree converts a value decoded by encoding/json with UseNumber to a Value.
+func fromJSONTree(v any) (Value, error) {
+	switch val := v.(type) {
+	case string:
+		return val, nil
+
+	case json.Number:
+		n, err := strconv.ParseInt(val.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("number %s is not a 64-bit integer", val)
+		}
+		return n, nil
+
+	case []any:
+		out := make(List, len(val))
+		for i, item := range val {
+			converted, err := fromJSONTree(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = converted
+		}
+		return out, nil
+
+	case map[string]any:
+		if len(val) == 1 {
+			for marker, item := range val {
+				if encoded, ok := item.(string); ok {
+					if s, isMarker, err := decodeBinary(marker, encoded); isMarker {
+						return s, err
+					}
+				}
+			}
+		}
+		out := make(Dictionary, len(val))
+		for key, item := range val {
+			converted, err := fromJSONTree(item)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", key, err)
+			}
+			if marker, encoded, found := strings.Cut(key, ":"); found {
+				s, isMarker, err := decodeBinary(marker, encoded)
+				if err != nil {
+					return nil, fmt.Errorf("key %q: %w", key, err)
+				}
+				if isMarker {
+					key = s
+				}
+			}
+			out[key] = converted
+		}
+		return out, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported JSON value: %v", v)
+	}
+}
+
+// writeYAML writes v, a tree built by toJSONTree, to buf in block style at the given indentation.
+// Mappings and sequences start on a line of their own unless they are empty.
+func writeYAML(buf *bytes.Buffer, v any, indent int) {
+	pad := strings.Repeat("  ", indent)
+	switch val := v.(type) {
+	case map[string]any:
+		if len(val) == 0 {
+			buf.WriteString("{}\n")
+			return
+		}
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			buf.WriteString(pad)
+			buf.WriteString(yamlQuote(key))
+			buf.WriteByte(':')
+			writeYAMLChild(buf, val[key], indent)
+		}
+
+	case []any:
+		if len(val) == 0 {
+			buf.WriteString("[]\n")
+			return
+		}
+		for _, item := range val {
+			buf.WriteString(pad)
+			buf.WriteByte('-')
+			writeYAMLChild(buf, item, indent)
+		}
+
+	case string:
+		buf.WriteString(yamlQuote(val))
+		buf.WriteByte('\n')
+
+	case Integer:
+		buf.WriteString(strconv.FormatInt(val, 10))
+		buf.WriteByte('\n')
+	}
+}
+
+// writeYAMLChild writes v after the key or dash of its parent, on the same line if it is a
+// scalar or an empty collection, otherwise indented on the following lines.
+func writeYAMLChild(buf *bytes.Buffer, v any, indent int) {
+	switch val := v.(type) {
+	case map[string]any:
+		if len(val) > 0 {
+			buf.WriteByte('\n')
+			writeYAML(buf, val, indent+1)
+			return
+		}
+	case []any:
+		if len(val) > 0 {
+			buf.WriteByte('\n')
+			writeYAML(buf, val, indent+1)
+			return
+		}
+	}
+	buf.WriteByte(' ')
+	writeYAML(buf, v, indent)
+}
+
+// yamlQuote returns s as a double-quoted YAML scalar. JSON string escapes are a subset of the
+// YAML double-quoted style, so s is quoted as in JSON.
+func yamlQuote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s) // strings never fail to encode
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,110 @@
+package bencode
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestToJSON verifies the JSON form of each type, including binary byte strings and keys.
+func TestToJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    Value
+		opts     JSONOptions
+		expected string
+	}{
+		{"text", ByteString("a<b&c"), JSONOptions{}, `"a<b&c"`},
+		{"integer", Integer(-42), JSONOptions{}, `-42`},
+		{"empty list", List{}, JSONOptions{}, `[]`},
+		{"binary hex", ByteString("\xff\x00"), JSONOptions{}, `{"$hex":"ff00"}`},
+		{"binary base64", ByteString("\xff\x00"), JSONOptions{Binary: BinaryBase64}, `{"$base64":"/wA="}`},
+		{"sorted keys", Dictionary{"b": Integer(1), "a": List{ByteString("x")}}, JSONOptions{}, `{"a":["x"],"b":1}`},
+		{"binary key", Dictionary{"\xfe\x02": Integer(1)}, JSONOptions{}, `{"$hex:fe02":1}`},
+		{"marker-like key", Dictionary{"$hex": ByteString("ff")}, JSONOptions{}, `{"$hex:24686578":"ff"}`},
+		{"indent", List{Integer(1)}, JSONOptions{Indent: "  "}, "[\n  1\n]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ToJSONWithOptions(tt.input, tt.opts)
+			if err != nil {
+				t.Fatalf("ToJSONWithOptions() returned error: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("ToJSONWithOptions() = %s, expected %s", data, tt.expected)
+			}
+		})
+	}
+
+	if _, err := ToJSON(List{true}); err == nil {
+		t.Error("ToJSON() with an unsupported type returned no error")
+	}
+}
+
+// TestFromJSON verifies that ToJSON output round-trips in both binary encodings, and that
+// values bencode cannot represent are rejected.
+func TestFromJSON(t *testing.T) {
+	original := Dictionary{
+		"announce": ByteString("http://tracker.example.com/announce?a=1&b=2"),
+		"info": Dictionary{
+			"length": Integer(1 << 40),
+			"pieces": ByteString("\x00\x01\xfe\xff"),
+		},
+		"files":       Dictionary{"\xaa\xbb": Dictionary{"complete": Integer(3)}},
+		"$hex":        ByteString("not a marker"),
+		"$base64:abc": List{Integer(-1), ByteString("")},
+	}
+
+	for _, binary := range []BinaryEncoding{BinaryHex, BinaryBase64} {
+		data, err := ToJSONWithOptions(original, JSONOptions{Binary: binary, Indent: "\t"})
+		if err != nil {
+			t.Fatalf("ToJSONWithOptions() returned error: %v", err)
+		}
+		decoded, err := FromJSON(data)
+		if err != nil {
+			t.Fatalf("FromJSON(%s) returned error: %v", data, err)
+		}
+		if !reflect.DeepEqual(decoded, Value(original)) {
+			t.Errorf("FromJSON(ToJSON(v)) = %#v, expected %#v", decoded, original)
+		}
+	}
+
+	invalid := []string{`1.5`, `true`, `null`, `[1e3]`, `99999999999999999999`, `{"$hex":"zz"}`, `{"$hex:zz":1}`, `1 2`, `{`}
+	for _, input := range invalid {
+		if _, err := FromJSON([]byte(input)); err == nil {
+			t.Errorf("FromJSON(%s) returned no error", input)
+		}
+	}
+}
+
+// TestToYAML verifies the block layout of nested collections and the quoting of strings.
+func TestToYAML(t *testing.T) {
+	input := Dictionary{
+		"announce": ByteString("yes"),
+		"info": Dictionary{
+			"files":  List{Dictionary{"length": Integer(3), "path": List{ByteString("a")}}, List{}},
+			"pieces": ByteString("\xff"),
+		},
+		"nodes": Dictionary{},
+	}
+	expected := `"announce": "yes"
+"info":
+  "files":
+    -
+      "length": 3
+      "path":
+        - "a"
+    - []
+  "pieces":
+    "$hex": "ff"
+"nodes": {}
+`
+
+	data, err := ToYAML(input, BinaryHex)
+	if err != nil {
+		t.Fatalf("ToYAML() returned error: %v", err)
+	}
+	if string(data) != expected {
+		t.Errorf("ToYAML() =\n%s\nexpected\n%s", data, expected)
+	}
+}
@@ -0,0 +1,354 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Marshal returns the bencoded form of v, which is mapped to bencode values as follows:
+//   - strings, byte slices and byte arrays → byte strings
+//   - signed and unsigned integers → integers, bools → i1e or i0e
+//   - slices and arrays → lists
+//   - maps with string keys → dictionaries
+//   - structs → dictionaries, see below
+//   - pointers and interfaces → the value they point to
+//
+// Every exported struct field is encoded under the key given by its `bencode:"key"` tag, or under
+// the field name if it has no tag. The tag `bencode:"-"` skips the field and the "omitempty" option,
+// as in `bencode:"comment,omitempty"`, skips it when it holds the zero value or an empty slice or map.
+// Fields holding a nil pointer or interface are always skipped, since bencode has no null value.
+// Embedded structs are encoded as a nested dictionary like any other field.
+func Marshal(v any) ([]byte, error) {
+	value, err := toValue(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return Encode(value)
+}
+
+// Unmarshal decodes the bencoded data and stores the result in the value pointed to by v,
+// using the inverse of the mapping described for Marshal.
+// Dictionary keys without a matching struct field are ignored and struct fields without a matching
+// key are left unchanged. A target of interface type, such as any, receives the generic Value.
+//
+// Returns an error if v is not a non-nil pointer, if the data is invalid, or if a value does not fit
+// its target, in which case the error names the dictionary keys and list indices leading to it.
+func Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("unmarshal target must be a non-nil pointer, got %T", v)
+	}
+
+	value, err := DecodeBytes(data, DecodeOptions{})
+	if err != nil {
+		return err
+	}
+
+	return fromValue(value, rv.Elem())
+}
+
+// =====================================================================================
+
+// structField describes how an exported struct field maps to a dictionary key.
+type structField struct {
+	key       string
+	index     int
+	omitEmpty bool
+}
+
+var structFieldCache sync.Map // reflect.Type -> []structField
+
+// structFields returns the encoded fields of the struct type t, parsing their tags once per type.
+func structFields(t reflect.Type) []structField {
+	if cached, ok := structFieldCache.Load(t); ok {
+		return cached.([]structField)
+	}
+
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("bencode")
+		if tag == "-" {
+			continue
+		}
+
+		key, options, _ := strings.Cut(tag, ",")
+		if key == "" {
+			key = field.Name
+		}
+		fields = append(fields, structField{
+			key:       key,
+			index:     i,
+			omitEmpty: options == "omitempty",
+		})
+	}
+
+	structFieldCache.Store(t, fields)
+	return fields
+}
+
+func toValue(rv reflect.Value) (Value, error) {
+	if !rv.IsValid() {
+		return nil, errors.New("cannot marshal nil")
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return nil, fmt.Errorf("cannot marshal nil %s", rv.Type())
+		}
+		return toValue(rv.Elem())
+
+	case reflect.String:
+		return rv.String(), nil
+
+	case reflect.Bool:
+		if rv.Bool() {
+			return Integer(1), nil
+		}
+		return Integer(0), nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return nil, fmt.Errorf("cannot marshal %d: overflows a bencode integer", u)
+		}
+		return Integer(u), nil
+
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return string(rv.Bytes()), nil
+		}
+		return listToValue(rv)
+
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return string(b), nil
+		}
+		return listToValue(rv)
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot marshal %s: map keys must be strings", rv.Type())
+		}
+		dict := make(Dictionary, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			key := iter.Key().String()
+			value, err := toValue(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			dict[key] = value
+		}
+		return dict, nil
+
+	case reflect.Struct:
+		return structToValue(rv)
+
+	default:
+		return nil, fmt.Errorf("cannot marshal %s", rv.Type())
+	}
+}
+
+func listToValue(rv reflect.Value) (Value, error) {
+	list := make(List, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		value, err := toValue(rv.Index(i))
+		if err != nil {
+			return nil, fmt.Errorf("index %d: %w", i, err)
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+func structToValue(rv reflect.Value) (Value, error) {
+	dict := Dictionary{}
+	for _, field := range structFields(rv.Type()) {
+		fv := rv.Field(field.index)
+		switch {
+		case (fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface) && fv.IsNil():
+			continue
+		case field.omitEmpty && isEmptyValue(fv):
+			continue
+		}
+
+		value, err := toValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field.key, err)
+		}
+		dict[field.key] = value
+	}
+	return dict, nil
+}
+
+// isEmptyValue reports whether rv is skipped by the "omitempty" option.
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map:
+		return rv.Len() == 0
+	default:
+		return rv.IsZero()
+	}
+}
+
+func fromValue(value Value, rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Pointer:
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		return fromValue(value, rv.Elem())
+
+	case reflect.Interface:
+		if rv.NumMethod() != 0 {
+			return fmt.Errorf("cannot unmarshal into %s", rv.Type())
+		}
+		rv.Set(reflect.ValueOf(value))
+		return nil
+
+	case reflect.String:
+		s, ok := value.(ByteString)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		rv.SetString(s)
+		return nil
+
+	case reflect.Bool:
+		n, ok := value.(Integer)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		rv.SetBool(n != 0)
+		return nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, ok := value.(Integer)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		if rv.OverflowInt(n) {
+			return fmt.Errorf("integer %d overflows %s", n, rv.Type())
+		}
+		rv.SetInt(n)
+		return nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := value.(Integer)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		if n < 0 || rv.OverflowUint(uint64(n)) {
+			return fmt.Errorf("integer %d overflows %s", n, rv.Type())
+		}
+		rv.SetUint(uint64(n))
+		return nil
+
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			s, ok := value.(ByteString)
+			if !ok {
+				return unmarshalTypeError(value, rv)
+			}
+			rv.SetBytes([]byte(s))
+			return nil
+		}
+
+		list, ok := value.(List)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		slice := reflect.MakeSlice(rv.Type(), len(list), len(list))
+		for i, item := range list {
+			if err := fromValue(item, slice.Index(i)); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		rv.Set(slice)
+		return nil
+
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			s, ok := value.(ByteString)
+			if !ok {
+				return unmarshalTypeError(value, rv)
+			}
+			if len(s) != rv.Len() {
+				return fmt.Errorf("cannot unmarshal byte string of length %d into %s", len(s), rv.Type())
+			}
+			reflect.Copy(rv, reflect.ValueOf([]byte(s)))
+			return nil
+		}
+
+		list, ok := value.(List)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		if len(list) != rv.Len() {
+			return fmt.Errorf("cannot unmarshal list of length %d into %s", len(list), rv.Type())
+		}
+		for i, item := range list {
+			if err := fromValue(item, rv.Index(i)); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+		return nil
+
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("cannot unmarshal into %s: map keys must be strings", rv.Type())
+		}
+		dict, ok := value.(Dictionary)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		m := reflect.MakeMapWithSize(rv.Type(), len(dict))
+		for key, item := range dict {
+			elem := reflect.New(rv.Type().Elem()).Elem()
+			if err := fromValue(item, elem); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			m.SetMapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()), elem)
+		}
+		rv.Set(m)
+		return nil
+
+	case reflect.Struct:
+		dict, ok := value.(Dictionary)
+		if !ok {
+			return unmarshalTypeError(value, rv)
+		}
+		for _, field := range structFields(rv.Type()) {
+			item, exists := dict[field.key]
+			if !exists {
+				continue
+			}
+			if err := fromValue(item, rv.Field(field.index)); err != nil {
+				return fmt.Errorf("%s: %w", field.key, err)
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("cannot unmarshal into %s", rv.Type())
+	}
+}
+
+func unmarshalTypeError(value Value, rv reflect.Value) error {
+	return fmt.Errorf("cannot unmarshal %s into %s", TypeOf(value), rv.Type())
+}
@@ -0,0 +1,159 @@
+package bencode
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testFile struct {
+	Length int64    `bencode:"length"`
+	Path   []string `bencode:"path"`
+}
+
+type testInfo struct {
+	Name        string     `bencode:"name"`
+	PieceLength int        `bencode:"piece length"`
+	Pieces      []byte     `bencode:"pieces"`
+	Private     *bool      `bencode:"private"`
+	Files       []testFile `bencode:"files,omitempty"`
+}
+
+type testTorrent struct {
+	Announce  string              `bencode:"announce"`
+	Comment   string              `bencode:"comment,omitempty"`
+	Info      testInfo            `bencode:"info"`
+	Hash      [4]byte             `bencode:"hash"`
+	Extra     map[string]any      `bencode:"extra,omitempty"`
+	Nodes     [][2]any            `bencode:"nodes,omitempty"`
+	Untagged  uint16              // encoded under its field name
+	Skipped   string              `bencode:"-"`
+	Options   map[string][]uint32 `bencode:"options,omitempty"`
+	unexposed string
+}
+
+// TestMarshal verifies key mapping, tag options and the encoding of each supported kind.
+func TestMarshal(t *testing.T) {
+	private := true
+	v := testTorrent{
+		Announce: "http://tracker.example.com/announce",
+		Info: testInfo{
+			Name:        "album",
+			PieceLength: 16,
+			Pieces:      []byte("abcd"),
+			Private:     &private,
+			Files:       []testFile{{Length: 3, Path: []string{"a", "b"}}},
+		},
+		Hash:      [4]byte{'h', 'a', 's', 'h'},
+		Untagged:  7,
+		Skipped:   "never",
+		unexposed: "never",
+	}
+
+	data, err := Marshal(&v)
+	if err != nil {
+		t.Fatalf("Marshal() returned error: %v", err)
+	}
+
+	expected := "d8:Untaggedi7e8:announce35:http://tracker.example.com/announce4:hash4:hash" +
+		"4:infod5:filesld6:lengthi3e4:pathl1:a1:beee4:name5:album12:piece lengthi16e6:pieces4:abcd7:privatei1eee"
+	if string(data) != expected {
+		t.Errorf("Marshal() =\n%s\nwant\n%s", data, expected)
+	}
+}
+
+// TestUnmarshal verifies decoding into structs, including nested, pointer and generic targets.
+func TestUnmarshal(t *testing.T) {
+	input := "d8:announce3:url7:comment2:hi5:extrad1:ai1e1:bl1:xee4:hash4:HASH" +
+		"4:infod5:filesld6:lengthi3e4:pathl1:aeee4:name5:album12:piece lengthi16e6:pieces2:pp7:privatei1ee" +
+		"5:nodesll4:host" + "i6881eee" + "7:optionsd1:kli1ei2eee7:unknowni1ee"
+
+	var got testTorrent
+	if err := Unmarshal([]byte(input), &got); err != nil {
+		t.Fatalf("Unmarshal() returned error: %v", err)
+	}
+
+	private := true
+	expected := testTorrent{
+		Announce: "url",
+		Comment:  "hi",
+		Info: testInfo{
+			Name:        "album",
+			PieceLength: 16,
+			Pieces:      []byte("pp"),
+			Private:     &private,
+			Files:       []testFile{{Length: 3, Path: []string{"a"}}},
+		},
+		Hash:    [4]byte{'H', 'A', 'S', 'H'},
+		Extra:   map[string]any{"a": Integer(1), "b": List{"x"}},
+		Nodes:   [][2]any{{"host", Integer(6881)}},
+		Options: map[string][]uint32{"k": {1, 2}},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unmarshal() =>\ngot:  %+v\nwant: %+v", got, expected)
+	}
+
+	// marshaling the result again must reproduce an equivalent document
+	data, err := Marshal(got)
+	if err != nil {
+		t.Fatalf("Marshal() returned error: %v", err)
+	}
+	var again testTorrent
+	if err := Unmarshal(data, &again); err != nil {
+		t.Fatalf("Unmarshal() of marshaled data returned error: %v", err)
+	}
+	if !reflect.DeepEqual(again, got) {
+		t.Errorf("round trip mismatch:\ngot:  %+v\nwant: %+v", again, got)
+	}
+}
+
+// TestUnmarshalErrors ensures that mismatched types are reported with the path to the offending value.
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		target   any
+		contains string
+	}{
+		{"non-pointer target", "i1e", testTorrent{}, "non-nil pointer"},
+		{"invalid data", "d4:name", &testTorrent{}, ""},
+		{"wrong root type", "li1ee", &testTorrent{}, "cannot unmarshal list into bencode.testTorrent"},
+		{"nested type mismatch", "d4:infod4:namei1eee", &testTorrent{}, "info: name: cannot unmarshal integer into string"},
+		{"list index", "d4:infod5:filesld6:length1:xeeee", &testTorrent{}, "info: files: index 0: length"},
+		{"hash length", "d4:hash2:abe", &testTorrent{}, "length 2 into [4]uint8"},
+		{"unsigned overflow", "d8:Untaggedi-1ee", &testTorrent{}, "overflows uint16"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Unmarshal([]byte(tc.input), tc.target)
+			if err == nil {
+				t.Fatal("expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tc.contains) {
+				t.Errorf("expected error containing %q, got %v", tc.contains, err)
+			}
+		})
+	}
+}
+
+// TestMarshalErrors ensures that values without a bencode representation are rejected.
+func TestMarshalErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input any
+	}{
+		{"nil", nil},
+		{"float", 1.5},
+		{"non-string map keys", map[int]string{1: "a"}},
+		{"nested unsupported value", map[string]any{"f": func() {}}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Marshal(tc.input); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrNotFound is returned, wrapped, by the lookup functions when a dictionary key or list index
+// does not exist, so optional entries can be told apart from malformed ones with errors.Is.
+var ErrNotFound = errors.New("key not found")
+
+// Get returns the value found by following path from v. The path is a dot-separated list of
+// dictionary keys and list indices, such as "info.files.0.path"; the empty path returns v itself.
+// Keys containing a dot cannot be reached through a path, use the Get* functions one level at a
+// time for those, e.g. for the binary keys of 'piece layers'.
+//
+// Returns an error naming the part of the path that failed if a key or index does not exist,
+// wrapping ErrNotFound, or if a value on the way is not a dictionary or list.
+func Get(v Value, path string) (Value, error) {
+	if path == "" {
+		return v, nil
+	}
+
+	parts := strings.Split(path, ".")
+	for i, part := range parts {
+		at := strings.Join(parts[:i+1], ".")
+		switch container := v.(type) {
+		case Dictionary:
+			value, exists := container[part]
+			if !exists {
+				return nil, fmt.Errorf("%s: %w", at, ErrNotFound)
+			}
+			v = value
+
+		case List:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 {
+				return nil, fmt.Errorf("%s: invalid list index %q", at, part)
+			}
+			if index >= len(container) {
+				return nil, fmt.Errorf("%s: index out of range for a list of %d elements: %w", at, len(container), ErrNotFound)
+			}
+			v = container[index]
+
+		default:
+			return nil, fmt.Errorf("%s: cannot look up %q in %s", at, part, TypeOf(v))
+		}
+	}
+	return v, nil
+}
+
+// GetAs is like Get but also asserts the type of the value found, e.g.
+//
+//	files, err := bencode.GetAs[bencode.List](root, "info.files")
+func GetAs[T ByteString | Integer | List | Dictionary](v Value, path string) (T, error) {
+	found, err := Get(v, path)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	typed, ok := found.(T)
+	if !ok {
+		var zero T
+		return zero, fmt.Errorf("%s: expected %s, got %s", path, TypeOf(zero), TypeOf(found))
+	}
+	return typed, nil
+}
+
+// GetString returns the byte string under key in dict. Only a missing key is reported with an
+// error wrapping ErrNotFound; a key holding another type is reported as a parsing error, so a
+// malformed entry is not mistaken for an absent optional one.
+func GetString(dict Dictionary, key string) (ByteString, error) {
+	return getKey(dict, key, AsByteString)
+}
+
+// GetInt returns the integer under key in dict, with errors as described for GetString.
+func GetInt(dict Dictionary, key string) (Integer, error) {
+	return getKey(dict, key, AsInteger)
+}
+
+// GetList returns the list under key in dict, with errors as described for GetString.
+func GetList(dict Dictionary, key string) (List, error) {
+	return getKey(dict, key, AsList)
+}
+
+// GetDict returns the dictionary under key in dict, with errors as described for GetString.
+func GetDict(dict Dictionary, key string) (Dictionary, error) {
+	return getKey(dict, key, AsDictionary)
+}
+
+// getKey looks key up in dict and converts its value with as. Its error messages match those
+// of the torrent parser, e.g. "'name' key not found" or "parsing 'length': expected Integer...".
+func getKey[T any](dict Dictionary, key string, as func(Value) (T, error)) (T, error) {
+	raw, exists := dict[key]
+	if !exists {
+		var zero T
+		return zero, fmt.Errorf("'%s' %w", key, ErrNotFound)
+	}
+
+	value, err := as(raw)
+	if err != nil {
+		var zero T
+		return zero, fmt.Errorf("parsing '%s': %w", key, err)
+	}
+	return value, nil
+}
@@ -0,0 +1,110 @@
+package bencode
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pathTestTorrent returns a torrent-like dictionary for the lookup tests.
+func pathTestTorrent() Dictionary {
+	return Dictionary{
+		"announce": "http://tracker.example.com/announce",
+		"info": Dictionary{
+			"name":         "album",
+			"piece length": Integer(16384),
+			"files": List{
+				Dictionary{"length": Integer(3), "path": List{"disc 1", "track.flac"}},
+				Dictionary{"length": Integer(5), "path": List{"cover.jpg"}},
+			},
+		},
+	}
+}
+
+// TestGet verifies path lookups through dictionaries and lists, and the errors naming the
+// failing part of the path.
+func TestGet(t *testing.T) {
+	root := pathTestTorrent()
+	testCases := []struct {
+		path     string
+		expected Value
+		err      string // substring of the expected error, if any
+		notFound bool   // whether the error wraps ErrNotFound
+	}{
+		{path: "", expected: root},
+		{path: "announce", expected: "http://tracker.example.com/announce"},
+		{path: "info.piece length", expected: Integer(16384)},
+		{path: "info.files.1.path.0", expected: "cover.jpg"},
+		{path: "info.files.0.path", expected: List{"disc 1", "track.flac"}},
+		{path: "info.comment", err: "info.comment: key not found", notFound: true},
+		{path: "info.files.2.length", err: "info.files.2: index out of range for a list of 2 elements", notFound: true},
+		{path: "info.files.x", err: `info.files.x: invalid list index "x"`},
+		{path: "info.files.-1", err: `info.files.-1: invalid list index "-1"`},
+		{path: "info.name.first", err: `info.name.first: cannot look up "first" in byte string`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.path, func(t *testing.T) {
+			got, err := Get(root, tc.path)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Get(%q) returned error %v, expected %q", tc.path, err, tc.err)
+				}
+				if errors.Is(err, ErrNotFound) != tc.notFound {
+					t.Errorf("Get(%q) error %v wraps ErrNotFound: %t, expected %t", tc.path, err, !tc.notFound, tc.notFound)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Get(%q) returned error: %v", tc.path, err)
+			}
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("Get(%q) = %#v, expected %#v", tc.path, got, tc.expected)
+			}
+		})
+	}
+}
+
+// TestGetAs verifies the type assertion of path lookups.
+func TestGetAs(t *testing.T) {
+	root := pathTestTorrent()
+
+	length, err := GetAs[Integer](root, "info.files.1.length")
+	if err != nil || length != 5 {
+		t.Errorf("GetAs[Integer]() = %d, %v, expected 5", length, err)
+	}
+	files, err := GetAs[List](root, "info.files")
+	if err != nil || len(files) != 2 {
+		t.Errorf("GetAs[List]() = %v, %v, expected 2 files", files, err)
+	}
+
+	if _, err := GetAs[Integer](root, "info.name"); err == nil || err.Error() != "info.name: expected integer, got byte string" {
+		t.Errorf("GetAs[Integer]() of a byte string returned error %v", err)
+	}
+	if _, err := GetAs[Dictionary](root, "info.missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetAs[Dictionary]() of a missing key returned error %v, expected ErrNotFound", err)
+	}
+}
+
+// TestGetKey verifies the single-key accessors, including keys a path cannot express.
+func TestGetKey(t *testing.T) {
+	info := pathTestTorrent()["info"].(Dictionary)
+	info["a.b"] = Integer(1)
+
+	if name, err := GetString(info, "name"); err != nil || name != "album" {
+		t.Errorf("GetString() = %q, %v, expected %q", name, err, "album")
+	}
+	if n, err := GetInt(info, "a.b"); err != nil || n != 1 {
+		t.Errorf("GetInt() of a dotted key = %d, %v, expected 1", n, err)
+	}
+	if files, err := GetList(info, "files"); err != nil || len(files) != 2 {
+		t.Errorf("GetList() = %v, %v, expected 2 files", files, err)
+	}
+	if _, err := GetDict(info, "files"); err == nil || !strings.HasPrefix(err.Error(), "parsing 'files': ") {
+		t.Errorf("GetDict() of a list returned error %v", err)
+	}
+	if _, err := GetString(info, "comment"); !errors.Is(err, ErrNotFound) || err.Error() != "'comment' key not found" {
+		t.Errorf("GetString() of a missing key returned error %v", err)
+	}
+}
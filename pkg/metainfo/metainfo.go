@@ -0,0 +1,161 @@
+// Package metainfo parses, creates and writes BitTorrent metainfo (.torrent) files and magnet
+// links. It is the public entry point to gobit's torrent handling, so gobit can be used as a
+// library by other projects.
+//
+// The types are aliases of the ones used throughout gobit, so values can be passed to the
+// rest of the client without conversion. Helpers that only matter to the client itself, such
+// as piece assembly and scheduling, are not part of this package.
+//
+// References:
+//   - https://bittorrent.org/beps/bep_0003.html
+//   - https://bittorrent.org/beps/bep_0052.html
+package metainfo
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/lcsabi/gobit/internal/infohash"
+	"github.com/lcsabi/gobit/internal/torrent"
+)
+
+// MaxTorrentSize is the largest .torrent file accepted by the Parse functions by default,
+// see ParseOptions.MaxSize.
+const MaxTorrentSize = torrent.MaxTorrentSize
+
+// TimeLayout is the layout of the dates written by FormatTime.
+const TimeLayout = torrent.TimeLayout
+
+type (
+	// MetaInfo is a parsed .torrent file.
+	MetaInfo = torrent.MetaInfo
+	// InfoDict is the info dictionary of a torrent, the part its info hash is computed over.
+	InfoDict = torrent.InfoDict
+	// FileInfo describes a file of the torrent content.
+	FileInfo = torrent.FileInfo
+	// FileTreeEntry is a file of the v2 file tree.
+	FileTreeEntry = torrent.FileTreeEntry
+	// Node is a DHT bootstrap node from the 'nodes' key.
+	Node = torrent.Node
+	// Bitfield is a set of piece indices, as returned by MetaInfo.ScanProgress.
+	Bitfield = torrent.Bitfield
+	// InfoHash is the SHA-1 info hash of v1 and hybrid torrents.
+	InfoHash = infohash.V1
+	// InfoHashV2 is the SHA-256 info hash of v2 and hybrid torrents.
+	InfoHashV2 = infohash.V2
+
+	// ParseOptions configures how torrent files are parsed.
+	ParseOptions = torrent.ParseOptions
+	// PathMode selects how unsafe file paths are handled, see ParseOptions.Paths.
+	PathMode = torrent.PathMode
+	// ValidationReport lists the problems found while parsing a torrent.
+	ValidationReport = torrent.ValidationReport
+	// Issue is a single finding of a ValidationReport.
+	Issue = torrent.Issue
+	// IssueKind classifies an Issue.
+	IssueKind = torrent.IssueKind
+
+	// CreateOptions configures the torrent produced by Create.
+	CreateOptions = torrent.CreateOptions
+	// HashOptions configures the workers hashing pieces and reports their progress.
+	HashOptions = torrent.HashOptions
+
+	// MagnetInfo is the information carried by a magnet link.
+	MagnetInfo = torrent.MagnetInfo
+)
+
+// Kinds of validation issues.
+const (
+	IssueMissing   = torrent.IssueMissing
+	IssueViolation = torrent.IssueViolation
+	IssueWarning   = torrent.IssueWarning
+)
+
+// Path modes.
+const (
+	PathStrict  = torrent.PathStrict
+	PathLenient = torrent.PathLenient
+)
+
+// Parse parses the .torrent file at path.
+func Parse(path string) (*MetaInfo, error) {
+	return torrent.Parse(path)
+}
+
+// ParseWithOptions parses the .torrent file at path using opts.
+func ParseWithOptions(path string, opts ParseOptions) (*MetaInfo, error) {
+	return torrent.ParseWithOptions(path, opts)
+}
+
+// ParseReader parses a .torrent file read from r.
+func ParseReader(r io.Reader) (*MetaInfo, error) {
+	return torrent.ParseReader(r)
+}
+
+// ParseReaderWithOptions parses a .torrent file read from r using opts.
+func ParseReaderWithOptions(r io.Reader, opts ParseOptions) (*MetaInfo, error) {
+	return torrent.ParseReaderWithOptions(r, opts)
+}
+
+// ParseContext parses the .torrent file at path using opts, giving up with the context's
+// error once ctx is cancelled.
+func ParseContext(ctx context.Context, path string, opts ParseOptions) (*MetaInfo, error) {
+	return torrent.ParseContext(ctx, path, opts)
+}
+
+// ParseReaderContext parses a .torrent file read from r using opts, giving up with the
+// context's error once ctx is cancelled.
+func ParseReaderContext(ctx context.Context, r io.Reader, opts ParseOptions) (*MetaInfo, error) {
+	return torrent.ParseReaderContext(ctx, r, opts)
+}
+
+// ParseWithReport parses the .torrent file at path like ParseWithOptions, and also returns
+// the report of missing optional fields, spec violations and warnings found along the way.
+func ParseWithReport(path string, opts ParseOptions) (*MetaInfo, *ValidationReport, error) {
+	return torrent.ParseWithReport(path, opts)
+}
+
+// ParseReaderWithReport parses a .torrent file read from r like ParseReaderWithOptions, and
+// also returns the report of the problems found along the way.
+func ParseReaderWithReport(r io.Reader, opts ParseOptions) (*MetaInfo, *ValidationReport, error) {
+	return torrent.ParseReaderWithReport(r, opts)
+}
+
+// Lint checks mi against the specification and common best practices, reporting violations
+// and warnings beyond what Parse requires.
+func Lint(mi *MetaInfo) *ValidationReport {
+	return torrent.Lint(mi)
+}
+
+// FormatSize formats a size in bytes with binary units, such as "1.5 MiB".
+func FormatSize(n int64) string {
+	return torrent.FormatSize(n)
+}
+
+// FormatTime formats date in UTC with TimeLayout, or returns an empty string for the zero time.
+func FormatTime(date time.Time) string {
+	return torrent.FormatTime(date)
+}
+
+// ParseInfoHash parses a v1 info hash given as 40 hex digits or 32 base32 characters.
+func ParseInfoHash(s string) (InfoHash, error) {
+	return infohash.Parse(s)
+}
+
+// ParseInfoHashV2 parses a v2 info hash given as hex or as a hex SHA-256 multihash.
+func ParseInfoHashV2(s string) (InfoHashV2, error) {
+	return infohash.ParseV2(s)
+}
+
+// ParseMagnet parses a magnet link carrying a v1 info hash, a v2 info hash, or both.
+func ParseMagnet(uri string) (*MagnetInfo, error) {
+	return torrent.ParseMagnet(uri)
+}
+
+// Create builds a v1 torrent, or a hybrid v1 and v2 torrent if opts.Hybrid is set, for the
+// file or directory at rootPath, hashing its content into pieces. Use MetaInfo.WriteTo or
+// MetaInfo.Save to emit the .torrent file.
+func Create(rootPath string, opts CreateOptions) (*MetaInfo, error) {
+	return torrent.Create(rootPath, opts)
+}
@@ -0,0 +1,60 @@
+package metainfo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCreateParseRoundTrip creates a torrent through the public API, saves it and parses it back.
+func TestCreateParseRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	content := filepath.Join(dir, "file.bin")
+	if err := os.WriteFile(content, make([]byte, 40000), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	created, err := Create(content, CreateOptions{
+		PieceLength: 16384,
+		Trackers:    [][]string{{"http://tracker.example.com/announce"}},
+	})
+	if err != nil {
+		t.Fatalf("Create() returned error: %v", err)
+	}
+	path := filepath.Join(dir, "file.torrent")
+	if err := created.Save(path); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+
+	mi, report, err := ParseWithReport(path, ParseOptions{})
+	if err != nil {
+		t.Fatalf("ParseWithReport() returned error: %v", err)
+	}
+	if mi.InfoHash != created.InfoHash {
+		t.Errorf("info hash = %x, want %x", mi.InfoHash, created.InfoHash)
+	}
+	if mi.Info.Name != "file.bin" || len(mi.Info.Pieces) != 3 {
+		t.Errorf("unexpected name %q or %d pieces", mi.Info.Name, len(mi.Info.Pieces))
+	}
+	if len(report.Violations()) != 0 {
+		t.Errorf("unexpected violations: %v", report.Violations())
+	}
+
+	magnet, err := ParseMagnet(mi.Magnet().String())
+	if err != nil {
+		t.Fatalf("ParseMagnet() returned error: %v", err)
+	}
+	if magnet.InfoHash != mi.InfoHash {
+		t.Errorf("magnet info hash = %x, want %x", magnet.InfoHash, mi.InfoHash)
+	}
+}
+
+// TestParseInvalid ensures errors from the underlying parser are passed through.
+func TestParseInvalid(t *testing.T) {
+	if _, err := Parse(filepath.Join(t.TempDir(), "missing.torrent")); err == nil {
+		t.Error("expected error for missing file, got nil")
+	}
+	if _, err := ParseMagnet("http://example.com"); err == nil {
+		t.Error("expected error for non-magnet URI, got nil")
+	}
+}